@@ -0,0 +1,207 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+var errShortData = errors.New("unexpected end of data")
+
+// DecodeJSON appends the JSON of the value decoded from the data by the schema to the buf and returns the rest of the data.
+// The union values are written without the branch names as the Encode expects them and the bytes are written as strings.
+func (s *Schema) DecodeJSON(buf, data []byte) ([]byte, []byte, error) {
+	switch s.kind {
+	case typeNull:
+		return append(buf, "null"...), data, nil
+	case typeBoolean:
+		if len(data) < 1 {
+			return buf, data, errShortData
+		}
+		return strconv.AppendBool(buf, data[0] != 0), data[1:], nil
+	case typeInt, typeLong:
+		v, rest, err := readLong(data)
+		if err != nil {
+			return buf, data, err
+		}
+		return strconv.AppendInt(buf, v, 10), rest, nil
+	case typeFloat:
+		if len(data) < 4 {
+			return buf, data, errShortData
+		}
+		v := float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+		return appendFloat(buf, v, 32), data[4:], nil
+	case typeDouble:
+		if len(data) < 8 {
+			return buf, data, errShortData
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(data))
+		return appendFloat(buf, v, 64), data[8:], nil
+	case typeBytes, typeString:
+		v, rest, err := readBytes(data)
+		if err != nil {
+			return buf, data, err
+		}
+		return appendString(buf, v), rest, nil
+	case typeFixed:
+		if len(data) < s.size {
+			return buf, data, errShortData
+		}
+		return appendString(buf, data[:s.size]), data[s.size:], nil
+	case typeEnum:
+		i, rest, err := readLong(data)
+		if err != nil {
+			return buf, data, err
+		}
+		if i < 0 || i >= int64(len(s.symbols)) {
+			return buf, data, fmt.Errorf("wrong enum index %d", i)
+		}
+		return appendString(buf, []byte(s.symbols[i])), rest, nil
+	case typeRecord:
+		return s.decodeRecord(buf, data)
+	case typeArray, typeMap:
+		return s.decodeBlocks(buf, data)
+	case typeUnion:
+		i, rest, err := readLong(data)
+		if err != nil {
+			return buf, data, err
+		}
+		if i < 0 || i >= int64(len(s.branches)) {
+			return buf, data, fmt.Errorf("wrong union index %d", i)
+		}
+		return s.branches[i].DecodeJSON(buf, rest)
+	default:
+		return buf, data, fmt.Errorf("unknown avro type %q", s.kind)
+	}
+}
+
+func (s *Schema) decodeRecord(buf, data []byte) ([]byte, []byte, error) {
+	buf = append(buf, '{')
+	for i, field := range s.fields {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendString(buf, []byte(field.name))
+		buf = append(buf, ':')
+
+		var err error
+		if buf, data, err = field.schema.DecodeJSON(buf, data); err != nil {
+			return buf, data, fmt.Errorf("field %q: %w", field.name, err)
+		}
+	}
+	return append(buf, '}'), data, nil
+}
+
+// decodeBlocks decodes the items of the array or the map, they are written in the blocks ended with the empty one.
+func (s *Schema) decodeBlocks(buf, data []byte) ([]byte, []byte, error) {
+	open, closing := byte('['), byte(']')
+	if s.kind == typeMap {
+		open, closing = '{', '}'
+	}
+
+	buf = append(buf, open)
+	first := true
+	for {
+		count, rest, err := readLong(data)
+		if err != nil {
+			return buf, data, err
+		}
+		data = rest
+		if count == 0 {
+			return append(buf, closing), data, nil
+		}
+		if count < 0 {
+			// the negative count is followed by the size of the block in bytes
+			count = -count
+			if _, data, err = readLong(data); err != nil {
+				return buf, data, err
+			}
+		}
+
+		for ; count > 0; count-- {
+			if !first {
+				buf = append(buf, ',')
+			}
+			first = false
+
+			if s.kind == typeMap {
+				var key []byte
+				if key, data, err = readBytes(data); err != nil {
+					return buf, data, err
+				}
+				buf = appendString(buf, key)
+				buf = append(buf, ':')
+			}
+			if buf, data, err = s.items.DecodeJSON(buf, data); err != nil {
+				return buf, data, err
+			}
+		}
+	}
+}
+
+func readLong(data []byte) (int64, []byte, error) {
+	v, n := binary.Varint(data)
+	if n <= 0 {
+		return 0, data, errors.New("wrong varint")
+	}
+	return v, data[n:], nil
+}
+
+func readBytes(data []byte) ([]byte, []byte, error) {
+	l, rest, err := readLong(data)
+	if err != nil {
+		return nil, data, err
+	}
+	if l < 0 || l > int64(len(rest)) {
+		return nil, data, errShortData
+	}
+	return rest[:l], rest[l:], nil
+}
+
+// appendFloat appends the number, NaN and infinities aren't allowed in JSON, so they are written as null.
+func appendFloat(buf []byte, v float64, bitSize int) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return append(buf, "null"...)
+	}
+	return strconv.AppendFloat(buf, v, 'g', -1, bitSize)
+}
+
+const hex = "0123456789abcdef"
+
+// appendString appends the JSON string, the invalid UTF-8 bytes are replaced with the replacement character.
+func appendString(buf, s []byte) []byte {
+	buf = append(buf, '"')
+	for len(s) > 0 {
+		c := s[0]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			s = s[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s)
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[:size]...)
+		}
+		s = s[size:]
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,369 @@
+// Package avro implements the Avro binary encoding and decoding of the events by the Avro schemas.
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+const (
+	typeNull    = "null"
+	typeBoolean = "boolean"
+	typeInt     = "int"
+	typeLong    = "long"
+	typeFloat   = "float"
+	typeDouble  = "double"
+	typeBytes   = "bytes"
+	typeString  = "string"
+	typeRecord  = "record"
+	typeEnum    = "enum"
+	typeArray   = "array"
+	typeMap     = "map"
+	typeFixed   = "fixed"
+	typeUnion   = "union"
+)
+
+// Schema is a parsed Avro schema which encodes the JSON nodes into the Avro binary format and decodes them back.
+type Schema struct {
+	kind string
+
+	// record
+	fields []*recordField
+	// enum
+	symbols []string
+	// array items, map values
+	items *Schema
+	// union
+	branches []*Schema
+	// fixed
+	size int
+}
+
+type recordField struct {
+	name   string
+	schema *Schema
+	// def is the default value of the field, it's used if the field is missing in the event.
+	def *insaneJSON.Root
+}
+
+// ParseSchema parses the Avro schema in JSON format. Logical types are encoded as their underlying types.
+func ParseSchema(schema string) (*Schema, error) {
+	var raw any
+	if err := json.Unmarshal([]byte(schema), &raw); err != nil {
+		return nil, fmt.Errorf("can't decode avro schema: %w", err)
+	}
+	return parseType(raw, "", make(map[string]*Schema))
+}
+
+func parseType(raw any, namespace string, named map[string]*Schema) (*Schema, error) {
+	switch t := raw.(type) {
+	case string:
+		switch t {
+		case typeNull, typeBoolean, typeInt, typeLong, typeFloat, typeDouble, typeBytes, typeString:
+			return &Schema{kind: t}, nil
+		}
+		if s, ok := named[fullName(t, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := named[t]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown avro type %q", t)
+	case []any:
+		s := &Schema{kind: typeUnion}
+		for _, branch := range t {
+			b, err := parseType(branch, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			s.branches = append(s.branches, b)
+		}
+		return s, nil
+	case map[string]any:
+		return parseComplexType(t, namespace, named)
+	default:
+		return nil, fmt.Errorf("wrong avro type %v", raw)
+	}
+}
+
+func parseComplexType(t map[string]any, namespace string, named map[string]*Schema) (*Schema, error) {
+	kind, _ := t["type"].(string)
+	s := &Schema{kind: kind}
+
+	switch kind {
+	case typeRecord, typeEnum, typeFixed:
+		name, _ := t["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("avro %s doesn't have a name", kind)
+		}
+		if ns, ok := t["namespace"].(string); ok {
+			namespace = ns
+		}
+		// the named type is registered before parsing the fields to support the recursive types.
+		named[fullName(name, namespace)] = s
+		if i := strings.LastIndexByte(name, '.'); i != -1 {
+			namespace = name[:i]
+		}
+	}
+
+	switch kind {
+	case typeRecord:
+		fields, _ := t["fields"].([]any)
+		for _, f := range fields {
+			field, err := parseField(f, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			s.fields = append(s.fields, field)
+		}
+	case typeEnum:
+		symbols, _ := t["symbols"].([]any)
+		for _, symbol := range symbols {
+			str, ok := symbol.(string)
+			if !ok {
+				return nil, fmt.Errorf("wrong avro enum symbol %v", symbol)
+			}
+			s.symbols = append(s.symbols, str)
+		}
+	case typeArray, typeMap:
+		key := "items"
+		if kind == typeMap {
+			key = "values"
+		}
+		items, err := parseType(t[key], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		s.items = items
+	case typeFixed:
+		size, ok := t["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("wrong avro fixed size %v", t["size"])
+		}
+		s.size = int(size)
+	default:
+		// primitive type with the logical type or other attributes
+		return parseType(t["type"], namespace, named)
+	}
+
+	return s, nil
+}
+
+func parseField(raw any, namespace string, named map[string]*Schema) (*recordField, error) {
+	f, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("wrong avro field %v", raw)
+	}
+	name, _ := f["name"].(string)
+	if name == "" {
+		return nil, errors.New("avro field doesn't have a name")
+	}
+
+	schema, err := parseType(f["type"], namespace, named)
+	if err != nil {
+		return nil, fmt.Errorf("wrong type of avro field %q: %w", name, err)
+	}
+	field := &recordField{name: name, schema: schema}
+
+	if def, ok := f["default"]; ok {
+		b, err := json.Marshal(def)
+		if err != nil {
+			return nil, err
+		}
+		field.def, err = insaneJSON.DecodeBytes(b)
+		if err != nil {
+			return nil, fmt.Errorf("wrong default of avro field %q: %w", name, err)
+		}
+	}
+
+	return field, nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.ContainsRune(name, '.') {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// Encode appends the node encoded by the schema to the buf, the nil node is treated as null.
+func (s *Schema) Encode(buf []byte, node *insaneJSON.Node) ([]byte, error) {
+	if node != nil && node.IsNull() {
+		node = nil
+	}
+	if node == nil && s.kind != typeNull && s.kind != typeUnion {
+		return buf, errors.New("value is missing")
+	}
+
+	switch s.kind {
+	case typeNull:
+		if node != nil {
+			return buf, errors.New("value isn't null")
+		}
+		return buf, nil
+	case typeBoolean:
+		if !node.IsTrue() && !node.IsFalse() {
+			return buf, errors.New("value isn't boolean")
+		}
+		if node.IsTrue() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case typeInt, typeLong:
+		v, err := strconv.ParseInt(node.AsString(), 10, 64)
+		if err != nil {
+			return buf, fmt.Errorf("value isn't integer: %w", err)
+		}
+		if s.kind == typeInt && (v > math.MaxInt32 || v < math.MinInt32) {
+			return buf, errors.New("value overflows int")
+		}
+		return binary.AppendVarint(buf, v), nil
+	case typeFloat, typeDouble:
+		v, err := strconv.ParseFloat(node.AsString(), 64)
+		if err != nil {
+			return buf, fmt.Errorf("value isn't number: %w", err)
+		}
+		if s.kind == typeFloat {
+			return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v))), nil
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v)), nil
+	case typeBytes, typeString:
+		v := nodeString(node)
+		buf = binary.AppendVarint(buf, int64(len(v)))
+		return append(buf, v...), nil
+	case typeFixed:
+		v := nodeString(node)
+		if len(v) != s.size {
+			return buf, fmt.Errorf("value size isn't %d", s.size)
+		}
+		return append(buf, v...), nil
+	case typeEnum:
+		v := node.AsString()
+		for i, symbol := range s.symbols {
+			if symbol == v {
+				return binary.AppendVarint(buf, int64(i)), nil
+			}
+		}
+		return buf, fmt.Errorf("unknown enum symbol %q", v)
+	case typeRecord:
+		return s.encodeRecord(buf, node)
+	case typeArray:
+		if !node.IsArray() {
+			return buf, errors.New("value isn't array")
+		}
+		items := node.AsArray()
+		if len(items) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(items)))
+			for i, item := range items {
+				var err error
+				if buf, err = s.items.Encode(buf, item); err != nil {
+					return buf, fmt.Errorf("item %d: %w", i, err)
+				}
+			}
+		}
+		return append(buf, 0), nil
+	case typeMap:
+		if !node.IsObject() {
+			return buf, errors.New("value isn't object")
+		}
+		fields := node.AsFields()
+		if len(fields) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(fields)))
+			for _, field := range fields {
+				key := field.AsString()
+				buf = binary.AppendVarint(buf, int64(len(key)))
+				buf = append(buf, key...)
+
+				var err error
+				if buf, err = s.items.Encode(buf, field.AsFieldValue()); err != nil {
+					return buf, fmt.Errorf("key %q: %w", key, err)
+				}
+			}
+		}
+		return append(buf, 0), nil
+	case typeUnion:
+		return s.encodeUnion(buf, node)
+	default:
+		return buf, fmt.Errorf("unknown avro type %q", s.kind)
+	}
+}
+
+func (s *Schema) encodeRecord(buf []byte, node *insaneJSON.Node) ([]byte, error) {
+	if !node.IsObject() {
+		return buf, errors.New("value isn't object")
+	}
+
+	for _, field := range s.fields {
+		value := node.Dig(field.name)
+		if value == nil && field.def != nil {
+			value = field.def.Node
+		}
+
+		var err error
+		if buf, err = field.schema.Encode(buf, value); err != nil {
+			return buf, fmt.Errorf("field %q: %w", field.name, err)
+		}
+	}
+	return buf, nil
+}
+
+// encodeUnion encodes the node by the first branch which accepts it.
+func (s *Schema) encodeUnion(buf []byte, node *insaneJSON.Node) ([]byte, error) {
+	for i, branch := range s.branches {
+		if !branch.accepts(node) {
+			continue
+		}
+
+		l := len(buf)
+		buf = binary.AppendVarint(buf, int64(i))
+		result, err := branch.Encode(buf, node)
+		if err == nil {
+			return result, nil
+		}
+		buf = buf[:l]
+	}
+	return buf, errors.New("value doesn't match any union type")
+}
+
+// accepts checks whether the node can be encoded by the schema regardless the nested values.
+func (s *Schema) accepts(node *insaneJSON.Node) bool {
+	if node == nil {
+		return s.kind == typeNull
+	}
+
+	switch s.kind {
+	case typeBoolean:
+		return node.IsTrue() || node.IsFalse()
+	case typeInt, typeLong:
+		if !node.IsNumber() {
+			return false
+		}
+		_, err := strconv.ParseInt(node.AsString(), 10, 64)
+		return err == nil
+	case typeFloat, typeDouble:
+		return node.IsNumber()
+	case typeBytes, typeString, typeFixed, typeEnum:
+		return node.IsString()
+	case typeRecord, typeMap:
+		return node.IsObject()
+	case typeArray:
+		return node.IsArray()
+	default:
+		return false
+	}
+}
+
+// nodeString returns the string value of the node or the JSON of the other values.
+func nodeString(node *insaneJSON.Node) string {
+	if node.IsString() {
+		return node.AsString()
+	}
+	return node.EncodeToString()
+}
@@ -0,0 +1,156 @@
+package avro
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+const testSchema = `{
+	"type": "record",
+	"name": "Event",
+	"namespace": "logs",
+	"fields": [
+		{"name": "message", "type": "string"},
+		{"name": "code", "type": "int"},
+		{"name": "ok", "type": "boolean"},
+		{"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["info", "error"]}},
+		{"name": "trace", "type": ["null", "string"], "default": null},
+		{"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+		{"name": "labels", "type": {"type": "map", "values": "long"}},
+		{"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "ratio", "type": "double", "default": 0.5},
+		{"name": "parent", "type": ["null", "Event"], "default": null}
+	]
+}`
+
+func TestEncode(t *testing.T) {
+	schema, err := ParseSchema(testSchema)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		event    string
+		expected []byte
+		err      bool
+	}{
+		"full": {
+			event: `{"message":"hi","code":-2,"ok":true,"level":"error","trace":"t","tags":["a"],"labels":{"k":1},"ts":2,"ratio":1,"extra":"x"}`,
+			expected: []byte{
+				4, 'h', 'i', // message
+				3,         // code
+				1,         // ok
+				2,         // level
+				2, 2, 't', // trace: union branch 1 and string
+				2, 2, 'a', 0, // tags
+				2, 2, 'k', 2, 0, // labels
+				4,                            // ts
+				0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // ratio
+				0, // parent
+			},
+		},
+		"defaults": {
+			event: `{"message":"","code":0,"ok":false,"level":"info","labels":{},"ts":0,"trace":null}`,
+			expected: []byte{
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0xe0, 0x3f,
+				0,
+			},
+		},
+		"nested": {
+			event: `{"message":"","code":0,"ok":false,"level":"info","labels":{},"ts":0,"parent":{"message":"p","code":0,"ok":false,"level":"info","labels":{},"ts":0}}`,
+			expected: []byte{
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0xe0, 0x3f,
+				2, 2, 'p', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xe0, 0x3f, 0,
+			},
+		},
+		"missing field": {
+			event: `{"message":"hi"}`,
+			err:   true,
+		},
+		"unknown symbol": {
+			event: `{"message":"","code":0,"ok":false,"level":"debug","labels":{},"ts":0}`,
+			err:   true,
+		},
+		"int overflow": {
+			event: `{"message":"","code":4294967296,"ok":false,"level":"info","labels":{},"ts":0}`,
+			err:   true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root, err := insaneJSON.DecodeString(tc.event)
+			require.NoError(t, err)
+			defer insaneJSON.Release(root)
+
+			result, err := schema.Encode(nil, root.Node)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, schema := range []string{
+		`{`,
+		`"unknown"`,
+		`{"type": "record", "fields": []}`,
+		`{"type": "record", "name": "A", "fields": [{"name": "a", "type": "B"}]}`,
+		`{"type": "fixed", "name": "F"}`,
+	} {
+		_, err := ParseSchema(schema)
+		assert.Error(t, err, schema)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	schema, err := ParseSchema(testSchema)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		event    string
+		expected string
+	}{
+		"full": {
+			event:    `{"message":"hi \"there\"\n","code":-2,"ok":true,"level":"error","trace":"t","tags":["a","b"],"labels":{"k":1,"n":-3},"ts":2,"ratio":1.5}`,
+			expected: `{"message":"hi \"there\"\n","code":-2,"ok":true,"level":"error","trace":"t","tags":["a","b"],"labels":{"k":1,"n":-3},"ts":2,"ratio":1.5,"parent":null}`,
+		},
+		"nested": {
+			event:    `{"message":"","code":0,"ok":false,"level":"info","labels":{},"ts":0,"parent":{"message":"p","code":7,"ok":false,"level":"info","labels":{},"ts":0}}`,
+			expected: `{"message":"","code":0,"ok":false,"level":"info","trace":null,"tags":[],"labels":{},"ts":0,"ratio":0.5,"parent":{"message":"p","code":7,"ok":false,"level":"info","trace":null,"tags":[],"labels":{},"ts":0,"ratio":0.5,"parent":null}}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root, err := insaneJSON.DecodeString(tc.event)
+			require.NoError(t, err)
+			defer insaneJSON.Release(root)
+
+			data, err := schema.Encode(nil, root.Node)
+			require.NoError(t, err)
+
+			result, rest, err := schema.DecodeJSON(nil, data)
+			require.NoError(t, err)
+			assert.Empty(t, rest)
+			assert.Equal(t, tc.expected, string(result))
+
+			_, _, err = schema.DecodeJSON(nil, data[:len(data)-1])
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDecodeJSONBlocks(t *testing.T) {
+	schema, err := ParseSchema(`{"type":"array","items":"int"}`)
+	require.NoError(t, err)
+
+	// the block of 2 items with the byte size, then the block of 1 item
+	result, rest, err := schema.DecodeJSON(nil, []byte{3, 4, 2, 4, 2, 6, 0, 1})
+	require.NoError(t, err)
+	assert.Equal(t, `[1,2,3]`, string(result))
+	assert.Equal(t, []byte{1}, rest)
+}
@@ -1,6 +1,7 @@
 package cfg
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
@@ -14,10 +15,16 @@ import (
 	"github.com/ozontech/file.d/logger"
 )
 
+const DefaultShutdownTimeout = 20 * time.Second
+
 type Config struct {
 	Vault        VaultConfig
 	PanicTimeout time.Duration
-	Pipelines    map[string]*PipelineConfig
+	// ShutdownTimeout limits the time to process the events in processing on SIGTERM.
+	ShutdownTimeout time.Duration
+	Rollback        RollbackConfig
+	KV              KVConfig
+	Pipelines       map[string]*PipelineConfig
 }
 
 type (
@@ -39,6 +46,17 @@ type VaultConfig struct {
 	ShouldUse bool
 }
 
+// RollbackConfig sets up health watching after the config reload.
+// The previous config is restored if file.d becomes unhealthy during the bake period.
+type RollbackConfig struct {
+	// BakePeriod is the time to watch the health after the reload, zero disables rollbacks.
+	BakePeriod time.Duration
+	// MaxErrorRate is the maximum average rate of error logs per second.
+	MaxErrorRate float64
+	// MaxPluginFailures is the maximum count of plugin panics.
+	MaxPluginFailures int
+}
+
 func NewConfig() *Config {
 	return &Config{
 		Vault: VaultConfig{
@@ -46,50 +64,111 @@ func NewConfig() *Config {
 			Address:   "",
 			ShouldUse: false,
 		},
+		ShutdownTimeout: DefaultShutdownTimeout,
+		Rollback: RollbackConfig{
+			MaxErrorRate: 1,
+		},
+		KV: KVConfig{
+			Keys: make(map[string]KVValue),
+		},
 		Pipelines: make(map[string]*PipelineConfig, 20),
 	}
 }
 
 func NewConfigFromFile(path string) *Config {
+	config, err := ReadConfigFromFile(path)
+	if err != nil {
+		logger.Fatalf("%s", err.Error())
+	}
+
+	return config
+}
+
+// ReadConfigFromFile is like NewConfigFromFile but returns errors instead of exiting,
+// so the wrong config doesn't stop file.d on the reload.
+func ReadConfigFromFile(path string) (*Config, error) {
 	logger.Infof("reading config %q", path)
 	yamlContents, err := os.ReadFile(path)
 	if err != nil {
-		logger.Fatalf("can't read config file %q: %s", path, err)
+		return nil, fmt.Errorf("can't read config file %q: %w", path, err)
 	}
 
 	jsonContents, err := yaml.YAMLToJSON(yamlContents)
 	if err != nil {
 		logger.Infof("config content:\n%s", logger.Numerate(string(yamlContents)))
-		logger.Fatalf("can't parse config file yaml %q: %s", path, err.Error())
+		return nil, fmt.Errorf("can't parse config file yaml %q: %w", path, err)
 	}
 
-	json, err := simplejson.NewJson(jsonContents)
+	config, err := newConfigFromJSON(jsonContents)
 	if err != nil {
-		logger.Fatalf("can't convert config to json %q: %s", path, err.Error())
+		return nil, fmt.Errorf("can't parse config file %q: %w", path, err)
+	}
+	if len(config.Pipelines) == 0 {
+		return nil, errors.New("no pipelines defined in config")
 	}
 
-	err = applyEnvs(json)
+	logger.Infof("config parsed, found %d pipelines", len(config.Pipelines))
+
+	return config, nil
+}
+
+// NewConfigFromBytes parses the YAML or JSON config.
+// Unlike NewConfigFromFile it returns errors instead of exiting and allows configs without pipelines.
+func NewConfigFromBytes(content []byte) (*Config, error) {
+	jsonContents, err := yaml.YAMLToJSON(content)
 	if err != nil {
-		logger.Fatalf("can't get config values from environments: %s", err.Error())
+		return nil, fmt.Errorf("can't parse config yaml: %w", err)
 	}
 
-	config := parseConfig(json)
-	if !config.Vault.ShouldUse {
-		return config
+	return newConfigFromJSON(jsonContents)
+}
+
+func newConfigFromJSON(jsonContents []byte) (*Config, error) {
+	json, err := simplejson.NewJson(jsonContents)
+	if err != nil {
+		return nil, fmt.Errorf("can't convert config to json: %w", err)
 	}
 
-	vault, err := newVault(config.Vault.Address, config.Vault.Token)
+	err = applyEnvs(json)
 	if err != nil {
-		logger.Fatalf("can't create vault client: %s", err.Error())
+		return nil, fmt.Errorf("can't get config values from environments: %w", err)
 	}
 
-	for _, p := range config.Pipelines {
-		applyVault(vault, p.Raw)
+	config, err := parseConfig(json)
+	if err != nil {
+		return nil, err
 	}
 
-	logger.Infof("config parsed, found %d pipelines", len(config.Pipelines))
+	if config.Vault.ShouldUse {
+		vault, err := newVault(config.Vault.Address, config.Vault.Token)
+		if err != nil {
+			return nil, fmt.Errorf("can't create vault client: %w", err)
+		}
 
-	return config
+		for _, p := range config.Pipelines {
+			if err := applyVault(vault, p.Raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if config.KV.Address != "" {
+		store, err := newKVStore(&config.KV)
+		if err != nil {
+			return nil, fmt.Errorf("can't create kv client: %w", err)
+		}
+		defer func() {
+			_ = store.Close()
+		}()
+
+		for _, p := range config.Pipelines {
+			if err := applyKV(store, p.Raw, config.KV.Keys); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return config, nil
 }
 
 func applyEnvs(json *simplejson.Json) error {
@@ -110,7 +189,7 @@ func applyEnvs(json *simplejson.Json) error {
 	return nil
 }
 
-func parseConfig(json *simplejson.Json) *Config {
+func parseConfig(json *simplejson.Json) (*Config, error) {
 	config := NewConfig()
 	vault := json.Get("vault")
 	var err error
@@ -129,13 +208,9 @@ func parseConfig(json *simplejson.Json) *Config {
 	config.Vault.ShouldUse = config.Vault.Address != "" && config.Vault.Token != ""
 
 	pipelinesJson := json.Get("pipelines")
-	pipelines := pipelinesJson.MustMap()
-	if len(pipelines) == 0 {
-		logger.Fatalf("no pipelines defined in config")
-	}
-	for name := range pipelines {
-		if err := validatePipelineName(name); err != nil {
-			logger.Fatal(err)
+	for name := range pipelinesJson.MustMap() {
+		if err := ValidatePipelineName(name); err != nil {
+			return nil, err
 		}
 		raw := pipelinesJson.Get(name)
 		config.Pipelines[name] = &PipelineConfig{Raw: raw}
@@ -151,14 +226,59 @@ func parseConfig(json *simplejson.Json) *Config {
 
 	panicTimeout, err := time.ParseDuration(panicTimeoutStr)
 	if err != nil {
-		logger.Panicf("can't parse panic_timeout: %s", err.Error())
+		return nil, fmt.Errorf("can't parse panic_timeout: %w", err)
 	}
 	config.PanicTimeout = panicTimeout
 
-	return config
+	if shutdownTimeoutStr := json.Get("shutdown_timeout").MustString(); shutdownTimeoutStr != "" {
+		shutdownTimeout, err := time.ParseDuration(shutdownTimeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse shutdown_timeout: %w", err)
+		}
+		config.ShutdownTimeout = shutdownTimeout
+	}
+
+	if err := parseRollback(json.Get("rollback"), &config.Rollback); err != nil {
+		return nil, err
+	}
+	if err := parseKV(json.Get("kv"), &config.KV); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func parseRollback(json *simplejson.Json, config *RollbackConfig) error {
+	if json.Interface() == nil {
+		return nil
+	}
+
+	bakePeriod, err := time.ParseDuration(json.Get("bake_period").MustString("0s"))
+	if err != nil {
+		return fmt.Errorf("can't parse rollback bake_period: %w", err)
+	}
+	config.BakePeriod = bakePeriod
+
+	// values are formatted before parsing since they can be overridden with environment variables as strings
+	if maxErrorRate, ok := json.CheckGet("max_error_rate"); ok {
+		config.MaxErrorRate, err = strconv.ParseFloat(fmt.Sprint(maxErrorRate.Interface()), 64)
+		if err != nil {
+			return fmt.Errorf("can't parse rollback max_error_rate: %w", err)
+		}
+	}
+
+	if maxPluginFailures, ok := json.CheckGet("max_plugin_failures"); ok {
+		config.MaxPluginFailures, err = strconv.Atoi(fmt.Sprint(maxPluginFailures.Interface()))
+		if err != nil {
+			return fmt.Errorf("can't parse rollback max_plugin_failures: %w", err)
+		}
+	}
+
+	return nil
 }
 
-func validatePipelineName(name string) error {
+// ValidatePipelineName checks that the name can be used in metric names and URLs.
+func ValidatePipelineName(name string) error {
 	matched, err := regexp.MatchString("^[a-zA-Z0-9_]+$", name)
 	if err != nil {
 		return err
@@ -169,46 +289,60 @@ func validatePipelineName(name string) error {
 	return nil
 }
 
-func applyVault(vault secreter, json *simplejson.Json) {
+func applyVault(vault secreter, json *simplejson.Json) error {
 	if a, err := json.Array(); err == nil {
 		for i := range a {
 			field := json.GetIndex(i)
-			if value, ok := tryGetSecret(vault, field); ok {
+			value, ok, err := tryGetSecret(vault, field)
+			if err != nil {
+				return err
+			}
+			if ok {
 				a[i] = value
 
 				continue
 			}
-			applyVault(vault, field)
+			if err := applyVault(vault, field); err != nil {
+				return err
+			}
 		}
 	}
 
 	if m, err := json.Map(); err == nil {
 		for k := range m {
 			field := json.Get(k)
-			if value, ok := tryGetSecret(vault, field); ok {
+			value, ok, err := tryGetSecret(vault, field)
+			if err != nil {
+				return err
+			}
+			if ok {
 				json.Set(k, value)
 
 				continue
 			}
-			applyVault(vault, field)
+			if err := applyVault(vault, field); err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
 }
 
-func tryGetSecret(vault secreter, field *simplejson.Json) (string, bool) {
+func tryGetSecret(vault secreter, field *simplejson.Json) (string, bool, error) {
 	s, err := field.String()
 	if err != nil {
-		return "", false
+		return "", false, nil
 	}
 
 	// escape symbols.
 	if strings.HasPrefix(s, `\vault(`) {
 		s = strings.ReplaceAll(s, `\vault(`, "vault(")
-		return s, true
+		return s, true, nil
 	}
 
 	if !strings.HasPrefix(s, "vault(") || !strings.HasSuffix(s, ")") {
-		return "", false
+		return "", false, nil
 	}
 
 	args := strings.TrimPrefix(s, "vault(")
@@ -219,11 +353,11 @@ func tryGetSecret(vault secreter, field *simplejson.Json) (string, bool) {
 	logger.Infof("get secrets for %q and %q", pathAndKey[0], pathAndKey[1])
 	secret, err := vault.GetSecret(pathAndKey[0], pathAndKey[1])
 	if err != nil {
-		logger.Fatalf("can't GetSecret: %s", err.Error())
+		return "", false, fmt.Errorf("can't get secret %q and %q: %w", pathAndKey[0], pathAndKey[1], err)
 	}
 
 	logger.Infof("success getting secret %q and %q", pathAndKey[0], pathAndKey[1])
-	return secret, true
+	return secret, true, nil
 }
 
 // Parse holy shit! who write this function?
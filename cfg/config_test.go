@@ -442,6 +442,14 @@ func TestApplyVault(t *testing.T) {
 			json:     `{"welcome": {"input": {"type": "vault(test/test, value"}}}`,
 			wantJSON: `{"welcome": {"input": {"type": "vault(test/test, value"}}}`,
 		},
+		{
+			name:       "should_err_when_secret_not_found",
+			json:       `{"welcome": {"input": {"type": "vault(test/test, value)"}}}`,
+			secretPath: "test/test",
+			secretKey:  "value",
+			secretErr:  errors.New("not found"),
+			wantErr:    "not found",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -449,7 +457,7 @@ func TestApplyVault(t *testing.T) {
 			require.NoError(t, err)
 			vault := newVaultMock(t, tt.secretPath, tt.secretKey, tt.secretResult, tt.secretErr)
 
-			applyVault(vault, json)
+			err = applyVault(vault, json)
 
 			if tt.wantErr == "" {
 				require.NoError(t, err)
@@ -483,13 +491,58 @@ func TestParseDefaultInt(t *testing.T) {
 func TestPipelineValidatorValid(t *testing.T) {
 	testName := []string{"pipeline_name", "PipeLine_NAME", "pipelinename", "PIPELINENAME", "pipeline_k8s"}
 	for _, tl := range testName {
-		assert.NoError(t, validatePipelineName(tl))
+		assert.NoError(t, ValidatePipelineName(tl))
 	}
 }
 
 func TestPipelineValidatorInvalid(t *testing.T) {
 	testName := []string{"Pipeline-name", "pipeline-name", "<pipeline_name>", "пайплайн_нейм"}
 	for _, tl := range testName {
-		assert.Error(t, validatePipelineName(tl))
+		assert.Error(t, ValidatePipelineName(tl))
+	}
+}
+
+func TestParseRollback(t *testing.T) {
+	testCases := []struct {
+		json     string
+		expected RollbackConfig
+	}{
+		{json: `{}`, expected: RollbackConfig{MaxErrorRate: 1}},
+		{
+			json:     `{"rollback":{"bake_period":"1m","max_error_rate":0.5,"max_plugin_failures":2}}`,
+			expected: RollbackConfig{BakePeriod: time.Minute, MaxErrorRate: 0.5, MaxPluginFailures: 2},
+		},
+		// values overridden with environment variables are strings
+		{
+			json:     `{"rollback":{"bake_period":"30s","max_error_rate":"10","max_plugin_failures":"1"}}`,
+			expected: RollbackConfig{BakePeriod: 30 * time.Second, MaxErrorRate: 10, MaxPluginFailures: 1},
+		},
+	}
+	for i, tc := range testCases {
+		json, err := simplejson.NewJson([]byte(tc.json))
+		require.NoError(t, err)
+
+		config := NewConfig()
+		require.NoError(t, parseRollback(json.Get("rollback"), &config.Rollback))
+
+		assert.Equal(t, tc.expected, config.Rollback, "wrong rollback config tc: %d", i)
 	}
+
+	for _, rollback := range []string{`{"bake_period":"1"}`, `{"max_error_rate":"x"}`, `{"max_plugin_failures":"1.5"}`} {
+		_, err := NewConfigFromBytes([]byte(`{"rollback":` + rollback + `}`))
+		assert.Error(t, err, "wrong rollback config %s", rollback)
+	}
+}
+
+func TestParseShutdownTimeout(t *testing.T) {
+	config, err := NewConfigFromBytes([]byte("pipelines: {}"))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultShutdownTimeout, config.ShutdownTimeout)
+
+	config, err = NewConfigFromBytes([]byte("shutdown_timeout: 1m"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, config.ShutdownTimeout)
+
+	_, err = NewConfigFromBytes([]byte("shutdown_timeout: soon"))
+	assert.Error(t, err)
 }
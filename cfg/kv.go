@@ -0,0 +1,382 @@
+package cfg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ozontech/file.d/logger"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	etcd "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	KVTypeConsul = "consul"
+	KVTypeEtcd   = "etcd"
+
+	kvWaitTime       = 5 * time.Minute
+	kvRequestTimeout = 10 * time.Second
+	kvRetryInterval  = 5 * time.Second
+)
+
+var errKVNotFound = errors.New("key not found")
+
+// KVConfig sets up the KV storage which config values can be taken from with `kv(key)` placeholders.
+type KVConfig struct {
+	// Type is the type of the storage: consul or etcd.
+	Type string
+	// Address is the address of the storage.
+	Address string
+	// Token is the ACL token of consul or the auth token of etcd.
+	Token string
+	// Watch enables reloading of the config when the values of the used keys are changed.
+	Watch bool
+
+	// Keys are the keys used in the config with their versions.
+	Keys map[string]KVValue
+}
+
+// KVValue is a value of the key at the time of the config parsing.
+type KVValue struct {
+	Value string
+	Index uint64
+	Found bool
+}
+
+type kvStore interface {
+	// Get returns the value and the index to wait for the key changes from.
+	Get(ctx context.Context, key string) (string, uint64, error)
+	// WaitChange blocks until the value of the key differs from the given one.
+	WaitChange(ctx context.Context, key string, value KVValue) error
+	// Close releases the connections of the client.
+	Close() error
+}
+
+func newKVStore(config *KVConfig) (kvStore, error) {
+	switch config.Type {
+	case KVTypeConsul:
+		return newConsulKV(config)
+	case KVTypeEtcd:
+		return newEtcdKV(config)
+	default:
+		return nil, fmt.Errorf("unknown kv type %q", config.Type)
+	}
+}
+
+func parseKV(json *simplejson.Json, config *KVConfig) error {
+	if json.Interface() == nil {
+		return nil
+	}
+
+	config.Type = json.Get("type").MustString(KVTypeConsul)
+	config.Address = json.Get("address").MustString()
+	config.Token = json.Get("token").MustString()
+	// the value is formatted before parsing since it can be overridden with environment variables as a string
+	if watch, ok := json.CheckGet("watch"); ok {
+		config.Watch = fmt.Sprint(watch.Interface()) == "true"
+	}
+
+	if config.Address == "" {
+		return errors.New("kv address isn't set")
+	}
+
+	return nil
+}
+
+// applyKV replaces `kv(key)` and `kv(key, default)` placeholders with the values of the keys.
+// Values which are valid JSON, e.g. numbers or objects, are decoded.
+func applyKV(store kvStore, json *simplejson.Json, keys map[string]KVValue) error {
+	if a, err := json.Array(); err == nil {
+		for i := range a {
+			field := json.GetIndex(i)
+			value, ok, err := tryGetKV(store, field, keys)
+			if err != nil {
+				return err
+			}
+			if ok {
+				a[i] = value
+
+				continue
+			}
+			if err := applyKV(store, field, keys); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m, err := json.Map(); err == nil {
+		for k := range m {
+			field := json.Get(k)
+			value, ok, err := tryGetKV(store, field, keys)
+			if err != nil {
+				return err
+			}
+			if ok {
+				json.Set(k, value)
+
+				continue
+			}
+			if err := applyKV(store, field, keys); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func tryGetKV(store kvStore, field *simplejson.Json, keys map[string]KVValue) (any, bool, error) {
+	s, err := field.String()
+	if err != nil {
+		return nil, false, nil
+	}
+
+	// escape symbols.
+	if strings.HasPrefix(s, `\kv(`) {
+		return strings.Replace(s, `\kv(`, "kv(", 1), true, nil
+	}
+
+	if !strings.HasPrefix(s, "kv(") || !strings.HasSuffix(s, ")") {
+		return nil, false, nil
+	}
+
+	args := strings.TrimSuffix(strings.TrimPrefix(s, "kv("), ")")
+	key, def, hasDefault := strings.Cut(args, ",")
+	key = strings.TrimSpace(key)
+	def = strings.TrimSpace(def)
+
+	v, has := keys[key]
+	if !has {
+		ctx, cancel := context.WithTimeout(context.Background(), kvRequestTimeout)
+		value, index, err := store.Get(ctx, key)
+		cancel()
+		switch {
+		case err == nil:
+			v = KVValue{Value: value, Index: index, Found: true}
+		case errors.Is(err, errKVNotFound):
+			v = KVValue{Index: index}
+		default:
+			return nil, false, fmt.Errorf("can't get kv value of %q: %w", key, err)
+		}
+		keys[key] = v
+	}
+
+	value := v.Value
+	if !v.Found {
+		if !hasDefault {
+			return nil, false, fmt.Errorf("kv key %q isn't found and has no default value", key)
+		}
+		value = def
+	}
+	logger.Infof("config value is taken from kv key %q", key)
+
+	// numbers are kept as json.Number as simplejson does
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err == nil && !decoder.More() {
+		return decoded, true, nil
+	}
+	return value, true, nil
+}
+
+// WatchKV blocks until the value of any key used in the config is changed or the context is canceled.
+// It returns true if the value is changed and false immediately if there is nothing to watch.
+func WatchKV(ctx context.Context, config *KVConfig) bool {
+	if !config.Watch || len(config.Keys) == 0 {
+		return false
+	}
+
+	store, err := newKVStore(config)
+	if err != nil {
+		logger.Errorf("can't watch kv keys: %s", err.Error())
+		return false
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changed := make(chan string, len(config.Keys))
+	wg := &sync.WaitGroup{}
+	for key, value := range config.Keys {
+		wg.Add(1)
+		go func(key string, value KVValue) {
+			defer wg.Done()
+			for {
+				err := store.WaitChange(ctx, key, value)
+				if err == nil {
+					changed <- key
+					return
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Errorf("can't watch kv key %q, next attempt in %s: %s", key, kvRetryInterval, err.Error())
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(kvRetryInterval):
+				}
+			}
+		}(key, value)
+	}
+
+	result := false
+	select {
+	case key := <-changed:
+		logger.Infof("kv key %q is changed", key)
+		result = true
+	case <-ctx.Done():
+	}
+
+	cancel()
+	wg.Wait()
+
+	return result
+}
+
+// consulKV uses consul KV API with blocking queries:
+// https://developer.hashicorp.com/consul/api-docs/kv
+type consulKV struct {
+	kv *consul.KV
+}
+
+func newConsulKV(config *KVConfig) (*consulKV, error) {
+	client, err := consul.NewClient(&consul.Config{
+		Address: config.Address,
+		Token:   config.Token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &consulKV{kv: client.KV()}, nil
+}
+
+func (c *consulKV) Get(ctx context.Context, key string) (string, uint64, error) {
+	return c.get(ctx, key, 0)
+}
+
+func (c *consulKV) get(ctx context.Context, key string, index uint64) (string, uint64, error) {
+	options := &consul.QueryOptions{}
+	if index > 0 {
+		options.WaitIndex = index
+		options.WaitTime = kvWaitTime
+	}
+
+	pair, meta, err := c.kv.Get(strings.TrimPrefix(key, "/"), options.WithContext(ctx))
+	if err != nil {
+		return "", 0, err
+	}
+	if pair == nil {
+		return "", meta.LastIndex, errKVNotFound
+	}
+
+	return string(pair.Value), meta.LastIndex, nil
+}
+
+func (c *consulKV) WaitChange(ctx context.Context, key string, value KVValue) error {
+	index := value.Index
+	for {
+		newValue, newIndex, err := c.get(ctx, key, index)
+		found := err == nil
+		if err != nil && !errors.Is(err, errKVNotFound) {
+			return err
+		}
+		if found != value.Found || newValue != value.Value {
+			return nil
+		}
+
+		// the index must be reset if it goes backwards, e.g. on the consul restore
+		if newIndex < index {
+			newIndex = 0
+		}
+		index = newIndex
+	}
+}
+
+func (c *consulKV) Close() error {
+	return nil
+}
+
+// etcdKV uses etcd v3 API:
+// https://etcd.io/docs/v3.5/learning/api/
+type etcdKV struct {
+	client  *etcd.Client
+	kv      etcd.KV
+	watcher etcd.Watcher
+	token   string
+}
+
+func newEtcdKV(config *KVConfig) (*etcdKV, error) {
+	client, err := etcd.New(etcd.Config{
+		Endpoints:   []string{config.Address},
+		DialTimeout: kvRequestTimeout,
+		Logger:      logger.Instance.Desugar().Named("etcd"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcdKV{client: client, kv: client.KV, watcher: client.Watcher, token: config.Token}, nil
+}
+
+// withToken passes the auth token the same way the client does after the authentication.
+func (e *etcdKV) withToken(ctx context.Context) context.Context {
+	if e.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, rpctypes.TokenFieldNameGRPC, e.token)
+}
+
+func (e *etcdKV) Get(ctx context.Context, key string) (string, uint64, error) {
+	resp, err := e.kv.Get(e.withToken(ctx), key)
+	if err != nil {
+		return "", 0, err
+	}
+
+	revision := uint64(resp.Header.GetRevision())
+	if len(resp.Kvs) == 0 {
+		return "", revision, errKVNotFound
+	}
+
+	return string(resp.Kvs[0].Value), revision, nil
+}
+
+// WaitChange watches the key starting from the revision following the one the value was read at.
+func (e *etcdKV) WaitChange(ctx context.Context, key string, value KVValue) error {
+	ctx, cancel := context.WithCancel(e.withToken(ctx))
+	defer cancel()
+
+	watch := e.watcher.Watch(etcd.WithRequireLeader(ctx), key, etcd.WithRev(int64(value.Index+1)))
+	for resp := range watch {
+		if err := resp.Err(); err != nil {
+			return fmt.Errorf("watch error: %w", err)
+		}
+		if len(resp.Events) > 0 {
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.New("watch is closed")
+}
+
+func (e *etcdKV) Close() error {
+	if e.client == nil {
+		return nil
+	}
+	return e.client.Close()
+}
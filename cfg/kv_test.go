@@ -0,0 +1,241 @@
+package cfg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	etcd "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeConsul implements consul KV API with blocking queries.
+type fakeConsul struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	index   uint64
+	values  map[string]string
+	token   string
+}
+
+func newFakeConsul(t *testing.T, values map[string]string) (*fakeConsul, *httptest.Server) {
+	c := &fakeConsul{index: 1, values: values, token: "secret"}
+	c.changed = sync.NewCond(&c.mu)
+
+	server := httptest.NewServer(http.HandlerFunc(c.serve))
+	t.Cleanup(func() {
+		// wake up blocking queries to close the server
+		c.set("", "")
+		server.Close()
+	})
+
+	return c, server
+}
+
+func (c *fakeConsul) set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key != "" {
+		c.values[key] = value
+	}
+	c.index++
+	c.changed.Broadcast()
+}
+
+func (c *fakeConsul) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != c.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	for index != 0 && index >= c.index {
+		c.changed.Wait()
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	value, ok := c.values[strings.TrimPrefix(r.URL.Path, "/v1/kv/")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode([]consul.KVPair{{Key: r.URL.Path, Value: []byte(value), ModifyIndex: c.index}})
+}
+
+func TestApplyKV(t *testing.T) {
+	_, server := newFakeConsul(t, map[string]string{
+		"limits/default": "5000",
+		"flags/enabled":  "true",
+		"tables/levels":  `{"1":"error","2":"warn"}`,
+		"names/pipeline": "my pipeline",
+	})
+
+	json, err := simplejson.NewJson([]byte(`{
+		"limit": "kv(limits/default)",
+		"enabled": "kv(flags/enabled)",
+		"nested": {"rules": ["kv(tables/levels)", "kv(names/pipeline)"]},
+		"missing": "kv(limits/missing, 100)",
+		"escaped": "\\kv(limits/default)",
+		"plain": "value"
+	}`))
+	require.NoError(t, err)
+
+	config := &KVConfig{Type: KVTypeConsul, Address: server.URL, Token: "secret", Keys: make(map[string]KVValue)}
+	store, err := newKVStore(config)
+	require.NoError(t, err)
+	require.NoError(t, applyKV(store, json, config.Keys))
+
+	result, err := json.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"limit": 5000,
+		"enabled": true,
+		"nested": {"rules": [{"1":"error","2":"warn"}, "my pipeline"]},
+		"missing": 100,
+		"escaped": "kv(limits/default)",
+		"plain": "value"
+	}`, string(result))
+
+	assert.Equal(t, 5, len(config.Keys))
+	assert.Equal(t, KVValue{Value: "5000", Index: 1, Found: true}, config.Keys["limits/default"])
+	assert.Equal(t, KVValue{Index: 1}, config.Keys["limits/missing"])
+
+	json, err = simplejson.NewJson([]byte(`{"nested": ["kv(limits/other)"]}`))
+	require.NoError(t, err)
+	assert.Error(t, applyKV(store, json, config.Keys), "key without default value isn't found")
+
+	_, err = NewConfigFromBytes([]byte(`{"kv":{"type":"consul"}}`))
+	assert.Error(t, err, "kv address isn't set")
+}
+
+func TestWatchConsul(t *testing.T) {
+	consul, server := newFakeConsul(t, map[string]string{"limit": "1"})
+
+	config := &KVConfig{Type: KVTypeConsul, Address: server.URL, Token: "secret", Watch: true, Keys: make(map[string]KVValue)}
+	store, err := newKVStore(config)
+	require.NoError(t, err)
+	json, err := simplejson.NewJson([]byte(`{"a":"kv(limit)","b":"kv(other, 2)"}`))
+	require.NoError(t, err)
+	require.NoError(t, applyKV(store, json, config.Keys))
+
+	result := make(chan bool)
+	go func() {
+		result <- WatchKV(context.Background(), config)
+	}()
+
+	// unrelated changes don't trigger the reload
+	consul.set("unrelated", "value")
+	consul.set("limit", "1")
+	select {
+	case <-result:
+		t.Fatal("watch must not be finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the missing key appears
+	consul.set("other", "3")
+	assert.True(t, <-result)
+}
+
+func TestWatchCanceled(t *testing.T) {
+	_, server := newFakeConsul(t, map[string]string{"limit": "1"})
+
+	config := &KVConfig{
+		Type:    KVTypeConsul,
+		Address: server.URL,
+		Token:   "secret",
+		Watch:   true,
+		Keys:    map[string]KVValue{"limit": {Value: "1", Index: 1, Found: true}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.False(t, WatchKV(ctx, config))
+
+	config.Watch = false
+	assert.False(t, WatchKV(context.Background(), config))
+}
+
+// fakeEtcd implements etcd KV range and watch requests.
+type fakeEtcd struct {
+	etcd.KV
+	etcd.Watcher
+
+	revision int64
+	values   map[string]string
+	watches  chan string
+}
+
+func (e *fakeEtcd) checkToken(ctx context.Context) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if tokens := md.Get(rpctypes.TokenFieldNameGRPC); len(tokens) != 1 || tokens[0] != "secret" {
+		return rpctypes.ErrInvalidAuthToken
+	}
+	return nil
+}
+
+func (e *fakeEtcd) Get(ctx context.Context, key string, _ ...etcd.OpOption) (*etcd.GetResponse, error) {
+	if err := e.checkToken(ctx); err != nil {
+		return nil, err
+	}
+
+	resp := &etcd.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: e.revision}}
+	if value, ok := e.values[key]; ok {
+		resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: 1})
+	}
+	return resp, nil
+}
+
+func (e *fakeEtcd) Watch(ctx context.Context, key string, opts ...etcd.OpOption) etcd.WatchChan {
+	watch := make(chan etcd.WatchResponse, 2)
+	if err := e.checkToken(ctx); err != nil {
+		watch <- etcd.WatchResponse{Canceled: true}
+		close(watch)
+		return watch
+	}
+
+	e.watches <- key + "@" + strconv.FormatInt(etcd.OpGet(key, opts...).Rev(), 10)
+	watch <- etcd.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: 5}, Created: true}
+	watch <- etcd.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: 6}, Events: []*etcd.Event{{Kv: &mvccpb.KeyValue{Key: []byte(key)}}}}
+	return watch
+}
+
+func TestEtcd(t *testing.T) {
+	fake := &fakeEtcd{revision: 5, values: map[string]string{"limit": "10"}, watches: make(chan string, 1)}
+	store := &etcdKV{kv: fake, watcher: fake, token: "secret"}
+	keys := make(map[string]KVValue)
+
+	json, err := simplejson.NewJson([]byte(`{"a":"kv(limit)","b":"kv(missing, x)"}`))
+	require.NoError(t, err)
+	require.NoError(t, applyKV(store, json, keys))
+	assert.Equal(t, "10", fmt.Sprint(json.Get("a").Interface()))
+	assert.Equal(t, "x", json.Get("b").MustString())
+	assert.Equal(t, KVValue{Value: "10", Index: 5, Found: true}, keys["limit"])
+
+	assert.NoError(t, store.WaitChange(context.Background(), "limit", keys["limit"]))
+	assert.Equal(t, "limit@6", <-fake.watches)
+
+	store.token = "wrong"
+	_, _, err = store.Get(context.Background(), "limit")
+	assert.Error(t, err)
+	assert.Error(t, store.WaitChange(context.Background(), "limit", keys["limit"]))
+}
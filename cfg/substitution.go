@@ -15,6 +15,18 @@ const (
 type SubstitutionOp struct {
 	Kind SubstitutionOpKind
 	Data []string
+	// Filters are the functions applied to the field value in order, e.g. `${field|lower|substr:0:8}`.
+	Filters []SubstitutionFilter
+}
+
+// ApplyFilters returns the value transformed by the filters, the buffers are reused between the calls.
+func (op *SubstitutionOp) ApplyFilters(value []byte, bufs *[2][]byte) []byte {
+	for i, filter := range op.Filters {
+		buf := &bufs[i%2]
+		*buf = filter.Apply((*buf)[:0], value)
+		value = *buf
+	}
+	return value
 }
 
 func ParseSubstitution(substitution string) ([]SubstitutionOp, error) {
@@ -47,11 +59,20 @@ func ParseSubstitution(substitution string) ([]SubstitutionOp, error) {
 				return nil, fmt.Errorf("can't find substitution end '}': %s", substitution)
 			}
 
-			selector := substitution[pos+2 : end]
-			path := ParseFieldSelector(selector)
+			parts := strings.Split(substitution[pos+2:end], "|")
+			path := ParseFieldSelector(parts[0])
+			filters := make([]SubstitutionFilter, 0, len(parts)-1)
+			for _, part := range parts[1:] {
+				filter, err := ParseSubstitutionFilter(part)
+				if err != nil {
+					return nil, err
+				}
+				filters = append(filters, filter)
+			}
 			result = append(result, SubstitutionOp{
-				Kind: SubstitutionOpKindField,
-				Data: path,
+				Kind:    SubstitutionOpKindField,
+				Data:    path,
+				Filters: filters,
 			})
 
 			substitution = substitution[end+1:]
@@ -0,0 +1,135 @@
+package cfg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SubstitutionFilter transforms the field value of the substitution.
+type SubstitutionFilter interface {
+	// Apply appends the transformed value to dst.
+	Apply(dst []byte, value []byte) []byte
+}
+
+type filterFunc func(dst []byte, value []byte) []byte
+
+func (f filterFunc) Apply(dst []byte, value []byte) []byte {
+	return f(dst, value)
+}
+
+// ParseSubstitutionFilter parses the filter like `substr:0:8`, the arguments are separated by `:`.
+func ParseSubstitutionFilter(filter string) (SubstitutionFilter, error) {
+	args := strings.Split(strings.TrimSpace(filter), ":")
+	name, args := args[0], args[1:]
+
+	checkArgs := func(minArgs, maxArgs int) error {
+		if len(args) < minArgs || len(args) > maxArgs {
+			return fmt.Errorf("wrong number of arguments of substitution filter %q", filter)
+		}
+		return nil
+	}
+
+	switch name {
+	case "lower":
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			return append(dst, bytes.ToLower(value)...)
+		}), checkArgs(0, 0)
+	case "upper":
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			return append(dst, bytes.ToUpper(value)...)
+		}), checkArgs(0, 0)
+	case "trim":
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			return append(dst, bytes.TrimSpace(value)...)
+		}), checkArgs(0, 0)
+	case "substr":
+		if err := checkArgs(1, 2); err != nil {
+			return nil, err
+		}
+		return parseSubstr(filter, args)
+	case "replace":
+		if err := checkArgs(2, 2); err != nil {
+			return nil, err
+		}
+		old, new := []byte(args[0]), []byte(args[1])
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			return append(dst, bytes.ReplaceAll(value, old, new)...)
+		}), nil
+	case "default":
+		if err := checkArgs(1, 1); err != nil {
+			return nil, err
+		}
+		def := args[0]
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			if len(value) == 0 {
+				return append(dst, def...)
+			}
+			return append(dst, value...)
+		}), nil
+	case "sha256":
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			sum := sha256.Sum256(value)
+			return appendEncoded(dst, sum[:], hex.EncodedLen, hex.Encode)
+		}), checkArgs(0, 0)
+	case "md5":
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			sum := md5.Sum(value)
+			return appendEncoded(dst, sum[:], hex.EncodedLen, hex.Encode)
+		}), checkArgs(0, 0)
+	case "base64":
+		return filterFunc(func(dst []byte, value []byte) []byte {
+			return appendEncoded(dst, value, base64.StdEncoding.EncodedLen, func(dst, src []byte) int {
+				base64.StdEncoding.Encode(dst, src)
+				return len(dst)
+			})
+		}), checkArgs(0, 0)
+	default:
+		return nil, fmt.Errorf("unknown substitution filter %q", filter)
+	}
+}
+
+// parseSubstr parses `substr:start[:end]` filter, the positions are the characters rather than the bytes.
+func parseSubstr(filter string, args []string) (SubstitutionFilter, error) {
+	start, err := strconv.Atoi(args[0])
+	end := -1
+	if err == nil && len(args) == 2 {
+		end, err = strconv.Atoi(args[1])
+	}
+	if err != nil || start < 0 || len(args) == 2 && end < start {
+		return nil, fmt.Errorf("wrong arguments of substitution filter %q", filter)
+	}
+
+	return filterFunc(func(dst []byte, value []byte) []byte {
+		from, to := len(value), len(value)
+		for i, pos := 0, 0; pos < len(value); i++ {
+			if i == start {
+				from = pos
+			}
+			if i == end {
+				to = pos
+				break
+			}
+			_, size := utf8.DecodeRune(value[pos:])
+			pos += size
+		}
+		if from > to {
+			return dst
+		}
+		return append(dst, value[from:to]...)
+	}), nil
+}
+
+// appendEncoded appends the encoded value to dst.
+func appendEncoded(dst []byte, value []byte, encodedLen func(int) int, encode func(dst, src []byte) int) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, encodedLen(len(value)))...)
+	encode(dst[n:], value)
+	return dst
+}
@@ -48,3 +48,44 @@ func TestParseErr(t *testing.T) {
 
 	assert.NotNil(t, err, "no error")
 }
+
+func TestParseFilters(t *testing.T) {
+	result, err := ParseSubstitution("key ${a.b|trim|lower|substr:1:3}")
+
+	assert.NoError(t, err, "error occurs")
+	assert.Equal(t, 2, len(result), "wrong result")
+	assert.Equal(t, []string{"a", "b"}, result[1].Data, "wrong result")
+	assert.Equal(t, 3, len(result[1].Filters), "wrong result")
+
+	bufs := [2][]byte{}
+	assert.Equal(t, "bc", string(result[1].ApplyFilters([]byte(" ABCD "), &bufs)), "wrong result")
+}
+
+func TestSubstitutionFilters(t *testing.T) {
+	cases := []struct {
+		filter string
+		in     string
+		out    string
+	}{
+		{filter: "upper", in: "aB", out: "AB"},
+		{filter: "substr:2", in: "привет", out: "ивет"},
+		{filter: "substr:0:10", in: "abc", out: "abc"},
+		{filter: "substr:4:5", in: "abc", out: ""},
+		{filter: "replace:_:-", in: "a_b_c", out: "a-b-c"},
+		{filter: "default:none", in: "", out: "none"},
+		{filter: "default:none", in: "x", out: "x"},
+		{filter: "sha256", in: "abc", out: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{filter: "md5", in: "abc", out: "900150983cd24fb0d6963f7d28e17f72"},
+		{filter: "base64", in: "abc", out: "YWJj"},
+	}
+	for _, tc := range cases {
+		filter, err := ParseSubstitutionFilter(tc.filter)
+		assert.NoError(t, err, tc.filter)
+		assert.Equal(t, tc.out, string(filter.Apply([]byte("prefix:"), []byte(tc.in)))[len("prefix:"):], tc.filter)
+	}
+
+	for _, filter := range []string{"unknown", "lower:1", "substr", "substr:a", "substr:3:1", "replace:a"} {
+		_, err := ParseSubstitutionFilter(filter)
+		assert.Error(t, err, filter)
+	}
+}
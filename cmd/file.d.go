@@ -4,8 +4,8 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
-	"time"
 
 	"github.com/KimMachineGun/automemlimit/memlimit"
 	"github.com/alecthomas/kingpin"
@@ -15,25 +15,61 @@ import (
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/longpanic"
 	"github.com/ozontech/file.d/pipeline"
+	_ "github.com/ozontech/file.d/plugin/action/add_cloud_metadata"
 	_ "github.com/ozontech/file.d/plugin/action/add_host"
+	_ "github.com/ozontech/file.d/plugin/action/aggregate"
+	_ "github.com/ozontech/file.d/plugin/action/avro_decode"
+	_ "github.com/ozontech/file.d/plugin/action/binary_decode"
+	_ "github.com/ozontech/file.d/plugin/action/clone"
+	_ "github.com/ozontech/file.d/plugin/action/codec"
+	_ "github.com/ozontech/file.d/plugin/action/compute"
 	_ "github.com/ozontech/file.d/plugin/action/convert_date"
 	_ "github.com/ozontech/file.d/plugin/action/convert_log_level"
+	_ "github.com/ozontech/file.d/plugin/action/convert_type"
 	_ "github.com/ozontech/file.d/plugin/action/debug"
+	_ "github.com/ozontech/file.d/plugin/action/decompress"
+	_ "github.com/ozontech/file.d/plugin/action/dedup"
 	_ "github.com/ozontech/file.d/plugin/action/discard"
+	_ "github.com/ozontech/file.d/plugin/action/encrypt"
+	_ "github.com/ozontech/file.d/plugin/action/enrich"
+	_ "github.com/ozontech/file.d/plugin/action/expr"
+	_ "github.com/ozontech/file.d/plugin/action/fingerprint"
 	_ "github.com/ozontech/file.d/plugin/action/flatten"
+	_ "github.com/ozontech/file.d/plugin/action/format"
+	_ "github.com/ozontech/file.d/plugin/action/geoip"
+	_ "github.com/ozontech/file.d/plugin/action/grok"
+	_ "github.com/ozontech/file.d/plugin/action/http_lookup"
 	_ "github.com/ozontech/file.d/plugin/action/join"
 	_ "github.com/ozontech/file.d/plugin/action/join_template"
+	_ "github.com/ozontech/file.d/plugin/action/js"
 	_ "github.com/ozontech/file.d/plugin/action/json_decode"
 	_ "github.com/ozontech/file.d/plugin/action/json_encode"
 	_ "github.com/ozontech/file.d/plugin/action/keep_fields"
+	_ "github.com/ozontech/file.d/plugin/action/lua"
 	_ "github.com/ozontech/file.d/plugin/action/mask"
 	_ "github.com/ozontech/file.d/plugin/action/modify"
+	_ "github.com/ozontech/file.d/plugin/action/parse_cef"
+	_ "github.com/ozontech/file.d/plugin/action/parse_csv"
 	_ "github.com/ozontech/file.d/plugin/action/parse_es"
+	_ "github.com/ozontech/file.d/plugin/action/parse_kv"
+	_ "github.com/ozontech/file.d/plugin/action/parse_logfmt"
 	_ "github.com/ozontech/file.d/plugin/action/parse_re2"
+	_ "github.com/ozontech/file.d/plugin/action/parse_syslog"
+	_ "github.com/ozontech/file.d/plugin/action/parse_xml"
+	_ "github.com/ozontech/file.d/plugin/action/protobuf_decode"
+	_ "github.com/ozontech/file.d/plugin/action/remove_empty"
 	_ "github.com/ozontech/file.d/plugin/action/remove_fields"
 	_ "github.com/ozontech/file.d/plugin/action/rename"
+	_ "github.com/ozontech/file.d/plugin/action/resolve_dns"
+	_ "github.com/ozontech/file.d/plugin/action/route_tag"
+	_ "github.com/ozontech/file.d/plugin/action/router"
+	_ "github.com/ozontech/file.d/plugin/action/sample"
 	_ "github.com/ozontech/file.d/plugin/action/set_time"
+	_ "github.com/ozontech/file.d/plugin/action/split"
 	_ "github.com/ozontech/file.d/plugin/action/throttle"
+	_ "github.com/ozontech/file.d/plugin/action/trace_context"
+	_ "github.com/ozontech/file.d/plugin/action/truncate"
+	_ "github.com/ozontech/file.d/plugin/action/validate_schema"
 	_ "github.com/ozontech/file.d/plugin/input/dmesg"
 	_ "github.com/ozontech/file.d/plugin/input/fake"
 	_ "github.com/ozontech/file.d/plugin/input/file"
@@ -41,22 +77,33 @@ import (
 	_ "github.com/ozontech/file.d/plugin/input/journalctl"
 	_ "github.com/ozontech/file.d/plugin/input/k8s"
 	_ "github.com/ozontech/file.d/plugin/input/kafka"
+	_ "github.com/ozontech/file.d/plugin/output/cassandra"
+	_ "github.com/ozontech/file.d/plugin/output/datadog"
 	_ "github.com/ozontech/file.d/plugin/output/devnull"
 	_ "github.com/ozontech/file.d/plugin/output/elasticsearch"
 	_ "github.com/ozontech/file.d/plugin/output/file"
 	_ "github.com/ozontech/file.d/plugin/output/gelf"
+	_ "github.com/ozontech/file.d/plugin/output/http"
 	_ "github.com/ozontech/file.d/plugin/output/kafka"
+	_ "github.com/ozontech/file.d/plugin/output/mqtt"
 	_ "github.com/ozontech/file.d/plugin/output/postgres"
+	_ "github.com/ozontech/file.d/plugin/output/pulsar"
+	_ "github.com/ozontech/file.d/plugin/output/quickwit"
 	_ "github.com/ozontech/file.d/plugin/output/s3"
+	_ "github.com/ozontech/file.d/plugin/output/sentry"
 	_ "github.com/ozontech/file.d/plugin/output/splunk"
 	_ "github.com/ozontech/file.d/plugin/output/stdout"
+	_ "github.com/ozontech/file.d/plugin/output/syslog"
 	insaneJSON "github.com/vitkovskii/insane-json"
 	"go.uber.org/automaxprocs/maxprocs"
 )
 
 var (
-	fileD *fd.FileD
-	exit  = make(chan bool)
+	reloader *fd.Reloader
+	exit     = make(chan int)
+
+	kvWatchMu     sync.Mutex
+	kvWatchCancel context.CancelFunc
 
 	config        = kingpin.Flag("config", `Config file name`).Required().ExistingFile()
 	http          = kingpin.Flag("http", `HTTP listen addr eg. ":9000", "off" to disable`).Default(":9000").String()
@@ -65,6 +112,11 @@ var (
 		`Value to set GOMEMLIMIT (https://pkg.go.dev/runtime) with the value from the cgroup's memory limit and given ratio. `+
 			`If there is a need to reduce the load GC, it is recommended to set 0.9. Default is disabled.`,
 	).Default("0").Float64()
+	shutdownTimeout = kingpin.Flag(
+		"shutdown-timeout",
+		`Time to process the events in processing on SIGTERM or SIGINT, overrides shutdown_timeout of the config. `+
+			`file.d exits with the non-zero code if some events aren't processed.`,
+	).Default("0s").Duration()
 )
 
 func main() {
@@ -82,16 +134,47 @@ func main() {
 	go listenSignals()
 	longpanic.Go(start)
 
-	<-exit
+	code := <-exit
 	logger.Infof("see you soon...")
+	os.Exit(code)
 }
 
 func start() {
 	appCfg := cfg.NewConfigFromFile(*config)
-	longpanic.SetTimeout(appCfg.PanicTimeout)
 
-	fileD = fd.New(appCfg, *http)
-	fileD.Start()
+	reloader = fd.NewReloader(*http)
+	reloader.Start(appCfg)
+	watchKV(appCfg)
+}
+
+// reload applies the config file, file.d keeps running with the current pipelines if the config is wrong.
+func reload() {
+	appCfg, err := reloader.ReloadFile(*config)
+	if err != nil {
+		logger.Errorf("can't reload config, the current pipelines are kept: %s", err.Error())
+		return
+	}
+	watchKV(appCfg)
+}
+
+// watchKV reloads the config when the KV values used in the config are changed.
+// The previous watch is canceled since the new config may use the other keys.
+func watchKV(appCfg *cfg.Config) {
+	kvWatchMu.Lock()
+	defer kvWatchMu.Unlock()
+
+	if kvWatchCancel != nil {
+		kvWatchCancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	kvWatchCancel = cancel
+
+	longpanic.Go(func() {
+		if cfg.WatchKV(ctx, &appCfg.KV) {
+			logger.Infof("reloading config since kv values are changed")
+			reload()
+		}
+	})
 }
 
 func listenSignals() {
@@ -105,25 +188,18 @@ func listenSignals() {
 		case syscall.SIGHUP:
 			logger.Infof("SIGHUP received")
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-			err := fileD.Stop(ctx)
-			if err != nil {
-				logger.Fatalf("can't stop file.d with SIGHUP: %s", err.Error())
-			}
-			cancel()
-
-			start()
+			reload()
 		case syscall.SIGINT, syscall.SIGTERM:
 			logger.Infof("SIGTERM or SIGINT received")
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-			err := fileD.Stop(ctx)
+			code := 0
+			err := reloader.Shutdown(*shutdownTimeout)
 			if err != nil {
-				logger.Fatalf("can't stop file.d with SIGTERM or SIGINT: %s", err.Error())
+				logger.Errorf("can't stop file.d gracefully with SIGTERM or SIGINT: %s", err.Error())
+				code = 1
 			}
-			cancel()
 
-			exit <- true
+			exit <- code
 		}
 	}
 }
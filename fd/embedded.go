@@ -0,0 +1,357 @@
+package fd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+// InProcessPluginType is the type of the input and output plugins
+// which connect embedded pipelines with the embedding service.
+const InProcessPluginType = "in_process"
+
+// OutputHandler receives events of the in-process output.
+// The event is committed once the handler returns, so the handler must copy the data it keeps.
+type OutputHandler func(event *pipeline.Event)
+
+// Embedded runs file.d pipelines inside another service.
+// Pipelines are taken from the config and the pipeline builders,
+// the service passes events through the in-process inputs and receives them with the output handlers.
+//
+// Plugins are taken from DefaultPluginRegistry, so the service should import the plugin packages it uses.
+// HTTP server isn't started, use Handler to serve the pipeline endpoints.
+// Metrics are registered in the default prometheus registry.
+type Embedded struct {
+	config  *cfg.Config
+	plugins *PluginRegistry
+	fd      *FileD
+
+	mu       sync.Mutex
+	started  bool
+	inputs   map[string]*InputHandle
+	handlers map[string]OutputHandler
+}
+
+// NewEmbedded creates file.d with pipelines of the YAML or JSON config, the config may be empty.
+// Plugin configs are decoded and checked, so wrong configs are returned as errors.
+func NewEmbedded(configBytes []byte) (*Embedded, error) {
+	config, err := cfg.NewConfigFromBytes(configBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Embedded{
+		config:   config,
+		inputs:   make(map[string]*InputHandle),
+		handlers: make(map[string]OutputHandler),
+	}
+
+	e.plugins = DefaultPluginRegistry.clone()
+	e.plugins.plugins[e.plugins.MakeID(pipeline.PluginKindInput, InProcessPluginType)] = &pipeline.PluginStaticInfo{
+		Type: InProcessPluginType,
+		Factory: func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+			return &inProcessInput{embedded: e}, &struct{}{}
+		},
+	}
+	e.plugins.plugins[e.plugins.MakeID(pipeline.PluginKindOutput, InProcessPluginType)] = &pipeline.PluginStaticInfo{
+		Type: InProcessPluginType,
+		Factory: func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+			return &inProcessOutput{embedded: e}, &inProcessOutputConfig{}
+		},
+	}
+
+	e.fd = New(config, "off")
+	e.fd.plugins = e.plugins
+
+	if err := e.fd.validateConfig(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// AddPipeline adds the pipeline constructed in code, it must be called before Start.
+func (e *Embedded) AddPipeline(b *PipelineBuilder) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.started {
+		return errors.New("file.d is already started")
+	}
+	if _, has := e.config.Pipelines[b.name]; has {
+		return fmt.Errorf("pipeline %q already exists", b.name)
+	}
+
+	raw, err := b.build()
+	if err != nil {
+		return fmt.Errorf("can't build pipeline %q: %w", b.name, err)
+	}
+	if err := e.fd.validatePipeline(b.name, raw); err != nil {
+		return fmt.Errorf("wrong pipeline %q: %w", b.name, err)
+	}
+
+	e.config.Pipelines[b.name] = &cfg.PipelineConfig{Raw: raw}
+
+	return nil
+}
+
+// HandleOutput sets the handler of the in-process outputs with the name, it must be called before Start.
+func (e *Embedded) HandleOutput(name string, handler OutputHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.handlers[name] = handler
+}
+
+// Start starts the pipelines.
+func (e *Embedded) Start() error {
+	e.mu.Lock()
+	if e.started {
+		e.mu.Unlock()
+		return errors.New("file.d is already started")
+	}
+	if len(e.config.Pipelines) == 0 {
+		e.mu.Unlock()
+		return errors.New("no pipelines defined")
+	}
+	for name, p := range e.config.Pipelines {
+		for _, outputJSON := range pipelineOutputs(p.Raw) {
+			if outputJSON.Get("type").MustString() != InProcessPluginType {
+				continue
+			}
+			handlerName := outputJSON.Get("name").MustString()
+			if e.handlers[handlerName] == nil {
+				e.mu.Unlock()
+				return fmt.Errorf("no handler for output %q of pipeline %q", handlerName, name)
+			}
+		}
+	}
+	e.started = true
+	e.mu.Unlock()
+
+	f := e.fd
+	f.mux = http.NewServeMux()
+	// use the default registry of the service to expose all the metrics in the same place
+	registry, ok := prometheus.DefaultRegisterer.(*prometheus.Registry)
+	if !ok {
+		registry = prometheus.NewRegistry()
+	}
+	f.registry = registry
+	f.initMetrics()
+	f.startPipelines()
+
+	return nil
+}
+
+// Stop waits until the events in processing are committed or the context is done and stops the pipelines.
+// It returns an error if some events aren't committed.
+func (e *Embedded) Stop(ctx context.Context) error {
+	drainErr := e.fd.Drain(ctx)
+	if err := e.fd.Stop(ctx); err != nil {
+		return err
+	}
+	return drainErr
+}
+
+// Input returns the handle of the in-process input of the started pipeline.
+func (e *Embedded) Input(pipelineName string) (*InputHandle, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h, has := e.inputs[pipelineName]
+	if !has {
+		return nil, fmt.Errorf("pipeline %q isn't started or doesn't have the in-process input", pipelineName)
+	}
+
+	return h, nil
+}
+
+// Pipelines returns the started pipelines.
+func (e *Embedded) Pipelines() []*pipeline.Pipeline {
+	return e.fd.Pipelines
+}
+
+// Handler returns the handler of the pipeline endpoints, it's available after Start.
+func (e *Embedded) Handler() http.Handler {
+	return e.fd.mux
+}
+
+// pipelineOutputs returns configs of the outputs set by the output section or the outputs list.
+func pipelineOutputs(raw *simplejson.Json) []*simplejson.Json {
+	if outputJSON, has := raw.CheckGet(string(pipeline.PluginKindOutput)); has {
+		return []*simplejson.Json{outputJSON}
+	}
+
+	outputs := raw.Get("outputs")
+	result := make([]*simplejson.Json, 0, len(outputs.MustArray()))
+	for index := range outputs.MustArray() {
+		result = append(result, outputs.GetIndex(index))
+	}
+
+	return result
+}
+
+// PipelineBuilder constructs the pipeline in code instead of the config.
+// Plugin configs have the same fields as in the config file.
+type PipelineBuilder struct {
+	name     string
+	settings map[string]any
+	input    map[string]any
+	actions  []map[string]any
+	outputs  []map[string]any
+}
+
+func NewPipelineBuilder(name string) *PipelineBuilder {
+	return &PipelineBuilder{name: name}
+}
+
+// Settings sets the pipeline settings, e.g. capacity or decoder.
+func (b *PipelineBuilder) Settings(settings map[string]any) *PipelineBuilder {
+	b.settings = settings
+	return b
+}
+
+func (b *PipelineBuilder) Input(t string, config map[string]any) *PipelineBuilder {
+	b.input = pluginConfig(t, config)
+	return b
+}
+
+// InProcessInput makes the pipeline receive events from the service, see Embedded.Input.
+func (b *PipelineBuilder) InProcessInput() *PipelineBuilder {
+	return b.Input(InProcessPluginType, nil)
+}
+
+func (b *PipelineBuilder) Action(t string, config map[string]any) *PipelineBuilder {
+	b.actions = append(b.actions, pluginConfig(t, config))
+	return b
+}
+
+// Output adds one more output, the config may contain routing params of the output.
+func (b *PipelineBuilder) Output(t string, config map[string]any) *PipelineBuilder {
+	b.outputs = append(b.outputs, pluginConfig(t, config))
+	return b
+}
+
+// InProcessOutput makes the pipeline pass events to the handler with the name, see Embedded.HandleOutput.
+func (b *PipelineBuilder) InProcessOutput(name string) *PipelineBuilder {
+	return b.Output(InProcessPluginType, map[string]any{"name": name})
+}
+
+func (b *PipelineBuilder) build() (*simplejson.Json, error) {
+	raw := map[string]any{
+		"input":   b.input,
+		"outputs": b.outputs,
+	}
+	if b.settings != nil {
+		raw["settings"] = b.settings
+	}
+	if len(b.actions) != 0 {
+		raw["actions"] = b.actions
+	}
+
+	// pass the config through json to get the same types as in the parsed config
+	content, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return simplejson.NewJson(content)
+}
+
+func pluginConfig(t string, config map[string]any) map[string]any {
+	result := make(map[string]any, len(config)+1)
+	for k, v := range config {
+		result[k] = v
+	}
+	result["type"] = t
+
+	return result
+}
+
+// InputHandle passes events of the service into the pipeline.
+type InputHandle struct {
+	controller pipeline.InputPluginController
+	offset     atomic.Int64
+	committed  atomic.Int64
+}
+
+// In passes the event to the pipeline, data is decoded by the pipeline decoder.
+// It returns false if the event is dropped, e.g. it's empty or has wrong format.
+func (h *InputHandle) In(data []byte) bool {
+	// pipeline expects the newline at the end of the event
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		data = append(append(make([]byte, 0, len(data)+1), data...), '\n')
+	}
+
+	offset := h.offset.Inc()
+	return h.controller.In(0, "in_process", offset, data, false) != pipeline.EventSeqIDError
+}
+
+// Committed returns the count of events which are processed by all the outputs.
+func (h *InputHandle) Committed() int64 {
+	return h.committed.Load()
+}
+
+type inProcessInput struct {
+	embedded *Embedded
+	handle   *InputHandle
+}
+
+func (p *inProcessInput) Start(_ pipeline.AnyConfig, params *pipeline.InputPluginParams) {
+	p.handle = &InputHandle{controller: params.Controller}
+	params.Controller.UseSpread()
+	params.Controller.DisableStreams()
+
+	p.embedded.mu.Lock()
+	p.embedded.inputs[params.PipelineName] = p.handle
+	p.embedded.mu.Unlock()
+}
+
+func (p *inProcessInput) Stop() {}
+
+func (p *inProcessInput) Commit(_ *pipeline.Event) {
+	p.handle.committed.Inc()
+}
+
+func (p *inProcessInput) PassEvent(_ *pipeline.Event) bool {
+	return true
+}
+
+func (p *inProcessInput) RegisterMetrics(_ *metric.Ctl) {}
+
+type inProcessOutputConfig struct {
+	Name string `json:"name"`
+}
+
+type inProcessOutput struct {
+	embedded   *Embedded
+	handler    OutputHandler
+	controller pipeline.OutputPluginController
+}
+
+func (p *inProcessOutput) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+
+	p.embedded.mu.Lock()
+	p.handler = p.embedded.handlers[config.(*inProcessOutputConfig).Name]
+	p.embedded.mu.Unlock()
+}
+
+func (p *inProcessOutput) Stop() {}
+
+func (p *inProcessOutput) Out(event *pipeline.Event) {
+	p.handler(event)
+	p.controller.Commit(event)
+}
+
+func (p *inProcessOutput) RegisterMetrics(_ *metric.Ctl) {}
@@ -0,0 +1,116 @@
+package fd_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	_ "github.com/ozontech/file.d/plugin/action/discard"
+	_ "github.com/ozontech/file.d/plugin/action/json_decode"
+	_ "github.com/ozontech/file.d/plugin/output/devnull"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedded(t *testing.T) {
+	e, err := fd.NewEmbedded([]byte(`
+pipelines:
+  from_config:
+    input:
+      type: in_process
+    output:
+      type: in_process
+      name: config
+`))
+	require.NoError(t, err)
+
+	require.NoError(t, e.AddPipeline(fd.NewPipelineBuilder("from_code").
+		Settings(map[string]any{"capacity": 64}).
+		InProcessInput().
+		Action("discard", map[string]any{"match_fields": map[string]any{"level": "debug"}}).
+		Output("devnull", map[string]any{"match_fields": map[string]any{"level": "info"}}).
+		InProcessOutput("code"),
+	))
+
+	mu := &sync.Mutex{}
+	received := make(map[string][]string)
+	handle := func(name string) fd.OutputHandler {
+		return func(event *pipeline.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name] = append(received[name], event.Root.EncodeToString())
+		}
+	}
+	e.HandleOutput("config", handle("config"))
+	e.HandleOutput("code", handle("code"))
+
+	require.NoError(t, e.Start())
+	defer func() { _ = e.Stop(context.Background()) }()
+
+	input, err := e.Input("from_config")
+	require.NoError(t, err)
+	assert.True(t, input.In([]byte(`{"message":"config"}`)))
+	assert.False(t, input.In([]byte(`not json`)))
+
+	input, err = e.Input("from_code")
+	require.NoError(t, err)
+	for _, level := range []string{"debug", "info", "error"} {
+		assert.True(t, input.In([]byte(`{"level":"`+level+`"}`+"\n")))
+	}
+
+	require.Eventually(t, func() bool { return input.Committed() == 2 }, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string][]string{
+		"config": {`{"message":"config"}`},
+		"code":   {`{"level":"info"}`, `{"level":"error"}`},
+	}, received)
+}
+
+func TestEmbeddedErrors(t *testing.T) {
+	_, err := fd.NewEmbedded([]byte("pipelines: ["))
+	assert.Error(t, err)
+
+	_, err = fd.NewEmbedded([]byte(`
+pipelines:
+  test:
+    input:
+      type: unknown
+    output:
+      type: devnull
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `can't find plugin kind=input type=unknown`)
+
+	// plugin configs are decoded and parsed instead of exiting on the start
+	for name, pipeline := range map[string]string{
+		"required field": `{"input":{"type":"in_process"},"actions":[{"type":"json_decode"}],"output":{"type":"devnull"}}`,
+		"wrong option":   `{"input":{"type":"in_process"},"actions":[{"type":"json_decode","field":"log","on_error":"x"}],"output":{"type":"devnull"}}`,
+		"unknown field":  `{"input":{"type":"in_process"},"outputs":[{"type":"devnull","unknown":1}]}`,
+		"wrong settings": `{"settings":{"event_timeout":"x"},"input":{"type":"in_process"},"output":{"type":"devnull"}}`,
+		"wrong match":    `{"input":{"type":"in_process"},"actions":[{"type":"discard","match_mode":"x"}],"output":{"type":"devnull"}}`,
+	} {
+		_, err = fd.NewEmbedded([]byte(`{"pipelines":{"test":` + pipeline + `}}`))
+		assert.Error(t, err, name)
+	}
+	_, err = fd.NewEmbedded([]byte(`{"rollback":{"bake_period":"x"}}`))
+	assert.Error(t, err)
+
+	e, err := fd.NewEmbedded(nil)
+	require.NoError(t, err)
+	assert.Error(t, e.Start())
+	assert.Error(t, e.AddPipeline(fd.NewPipelineBuilder("test").InProcessInput()))
+	assert.Error(t, e.AddPipeline(fd.NewPipelineBuilder("wrong name").InProcessInput().Output("devnull", nil)))
+
+	require.NoError(t, e.AddPipeline(fd.NewPipelineBuilder("test").InProcessInput().InProcessOutput("out")))
+	assert.Error(t, e.AddPipeline(fd.NewPipelineBuilder("test").InProcessInput().Output("devnull", nil)))
+	err = e.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `no handler for output "out"`)
+
+	_, err = e.Input("test")
+	assert.Error(t, err)
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"runtime"
 	"runtime/debug"
+	"sync"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/ozontech/file.d/buildinfo"
@@ -19,6 +21,7 @@ import (
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/atomic"
 )
 
 type FileD struct {
@@ -28,12 +31,17 @@ type FileD struct {
 	plugins   *PluginRegistry
 	Pipelines []*pipeline.Pipeline
 	server    *http.Server
+	mux       *http.ServeMux
 	metricCtl *metric.Ctl
+	reloader  *Reloader
+
+	pluginFailures *atomic.Int64
 
 	// file_d metrics
 
 	longPanicMetric *prometheus.CounterVec
 	versionMetric   *prometheus.CounterVec
+	rollbackMetric  *prometheus.CounterVec
 }
 
 func New(config *cfg.Config, httpAddr string) *FileD {
@@ -42,6 +50,8 @@ func New(config *cfg.Config, httpAddr string) *FileD {
 		httpAddr:  httpAddr,
 		plugins:   DefaultPluginRegistry,
 		Pipelines: make([]*pipeline.Pipeline, 0),
+
+		pluginFailures: atomic.NewInt64(0),
 	}
 }
 
@@ -52,6 +62,8 @@ func (f *FileD) SetConfig(config *cfg.Config) {
 func (f *FileD) Start() {
 	logger.Infof("starting file.d")
 
+	// every instance has its own mux since handlers can't be registered twice after the config reload
+	f.mux = http.NewServeMux()
 	f.createRegistry()
 	f.initMetrics()
 	f.startHTTP()
@@ -65,7 +77,13 @@ func (f *FileD) initMetrics() {
 	f.versionMetric.WithLabelValues(buildinfo.Version).Inc()
 	longpanic.SetOnPanicHandler(func(_ error) {
 		f.longPanicMetric.WithLabelValues().Inc()
+		f.pluginFailures.Inc()
 	})
+
+	if f.reloader != nil {
+		f.rollbackMetric = f.metricCtl.RegisterCounter("config_rollback", "Count of config rollbacks after unhealthy reloads")
+		f.rollbackMetric.WithLabelValues().Add(float64(f.reloader.Status().Rollbacks))
+	}
 }
 
 func (f *FileD) createRegistry() {
@@ -88,33 +106,92 @@ func (f *FileD) startPipelines() {
 }
 
 func (f *FileD) addPipeline(name string, config *cfg.PipelineConfig) {
-	mux := http.DefaultServeMux
-	settings := extractPipelineParams(config.Raw.Get("settings"))
+	raw, err := copyPipelineJSON(config.Raw)
+	if err != nil {
+		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
+	}
+	config = &cfg.PipelineConfig{Raw: raw}
 
-	values := map[string]int{
-		"capacity":   settings.Capacity,
-		"gomaxprocs": runtime.GOMAXPROCS(0),
+	settings, err := extractPipelineParams(config.Raw.Get("settings"))
+	if err != nil {
+		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
 	}
+	values := pipelineValues(settings)
 
 	logger.Infof("creating pipeline %q: capacity=%d, stream field=%s, decoder=%s", name, settings.Capacity, settings.StreamField, settings.Decoder)
 
 	p := pipeline.New(name, settings, f.registry)
-	err := f.setupInput(p, config, values)
+	err = f.setupInput(p, config, values)
 	if err != nil {
 		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
 	}
 
-	f.setupActions(p, config, values)
+	err = f.setupActions(p, config, values)
+	if err != nil {
+		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
+	}
 
 	err = f.setupOutput(p, config, values)
 	if err != nil {
 		logger.Fatalf("can't create pipeline %q: %s", name, err.Error())
 	}
 
-	p.SetupHTTPHandlers(mux)
+	p.SetupHTTPHandlers(f.mux)
 	f.Pipelines = append(f.Pipelines, p)
 }
 
+// validateConfig checks the configs of all the pipelines, see validatePipeline.
+func (f *FileD) validateConfig() error {
+	for name, config := range f.config.Pipelines {
+		if err := f.validatePipeline(name, config.Raw); err != nil {
+			return fmt.Errorf("wrong pipeline %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validatePipeline decodes the settings and the plugin configs of the pipeline without creating it,
+// so the config errors are returned instead of exiting in addPipeline.
+func (f *FileD) validatePipeline(name string, raw *simplejson.Json) error {
+	if err := cfg.ValidatePipelineName(name); err != nil {
+		return err
+	}
+
+	raw, err := copyPipelineJSON(raw)
+	if err != nil {
+		return err
+	}
+
+	settings, err := extractPipelineParams(raw.Get("settings"))
+	if err != nil {
+		return err
+	}
+	values := pipelineValues(settings)
+
+	if _, err := f.getStaticInfoFromJSON(raw.Get(string(pipeline.PluginKindInput)), pipeline.PluginKindInput, values); err != nil {
+		return err
+	}
+
+	actions := raw.Get("actions")
+	for index := range actions.MustArray() {
+		if _, err := f.getActionInfo(index, actions.GetIndex(index), values); err != nil {
+			return err
+		}
+	}
+
+	_, _, err = f.getOutputsInfo(&cfg.PipelineConfig{Raw: raw}, values)
+	return err
+}
+
+// pipelineValues returns the values used in the expressions of the plugin configs.
+func pipelineValues(settings *pipeline.Settings) map[string]int {
+	return map[string]int{
+		"capacity":   settings.Capacity,
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+	}
+}
+
 func (f *FileD) setupInput(p *pipeline.Pipeline, pipelineConfig *cfg.PipelineConfig, values map[string]int) error {
 	inputInfo, err := f.getStaticInfo(pipelineConfig, pipeline.PluginKindInput, values)
 	if err != nil {
@@ -142,77 +219,185 @@ func (f *FileD) setupInput(p *pipeline.Pipeline, pipelineConfig *cfg.PipelineCon
 	return nil
 }
 
-func (f *FileD) setupActions(p *pipeline.Pipeline, pipelineConfig *cfg.PipelineConfig, values map[string]int) {
+func (f *FileD) setupActions(p *pipeline.Pipeline, pipelineConfig *cfg.PipelineConfig, values map[string]int) error {
 	actions := pipelineConfig.Raw.Get("actions")
 	for index := range actions.MustArray() {
-		actionJSON := actions.GetIndex(index)
-		if actionJSON.MustMap() == nil {
-			logger.Fatalf("empty action #%d for pipeline %q", index, p.Name)
+		info, err := f.getActionInfo(index, actions.GetIndex(index), values)
+		if err != nil {
+			return err
 		}
-
-		t := actionJSON.Get("type").MustString()
-		if t == "" {
-			logger.Fatalf("action #%d doesn't provide type %q", index, p.Name)
-		}
-		f.setupAction(p, index, t, actionJSON, values)
+		logger.Infof("creating action with type %q for pipeline %q", info.Type, p.Name)
+		p.AddAction(info)
 	}
+
+	return nil
 }
 
-func (f *FileD) setupAction(p *pipeline.Pipeline, index int, t string, actionJSON *simplejson.Json, values map[string]int) {
-	logger.Infof("creating action with type %q for pipeline %q", t, p.Name)
-	info := f.plugins.GetActionByType(t)
+func (f *FileD) getActionInfo(index int, actionJSON *simplejson.Json, values map[string]int) (*pipeline.ActionPluginStaticInfo, error) {
+	if actionJSON.MustMap() == nil {
+		return nil, fmt.Errorf("empty action #%d", index)
+	}
+
+	t := actionJSON.Get("type").MustString()
+	if t == "" {
+		return nil, fmt.Errorf("action #%d doesn't provide type", index)
+	}
+	info, err := f.plugins.lookup(pipeline.PluginKindAction, t)
+	if err != nil {
+		return nil, fmt.Errorf("action #%d: %w", index, err)
+	}
 
 	matchMode := extractMatchMode(actionJSON)
 	if matchMode == pipeline.MatchModeUnknown {
-		logger.Fatalf("unknown match_mode value for action %d/%s in pipeline %q", index, t, p.Name)
+		return nil, fmt.Errorf("unknown match_mode value for action %d/%s", index, t)
 	}
 	matchInvert, err := extractMatchInvert(actionJSON)
 	if err != nil {
-		logger.Fatalf("can't extract invert match mode for action %d/%s in pipeline %q: %s", index, t, p.Name, err.Error())
+		return nil, fmt.Errorf("can't extract invert match mode for action %d/%s: %w", index, t, err)
 	}
 	conditions, err := extractConditions(actionJSON.Get("match_fields"))
 	if err != nil {
-		logger.Fatalf("can't extract conditions for action %d/%s in pipeline %q: %s", index, t, p.Name, err.Error())
+		return nil, fmt.Errorf("can't extract conditions for action %d/%s: %w", index, t, err)
 	}
 	metricName, metricLabels := extractMetrics(actionJSON)
 	configJSON := makeActionJSON(actionJSON)
 
 	_, config := info.Factory()
 	if err := DecodeConfig(config, configJSON); err != nil {
-		logger.Fatalf("can't unmarshal config for %s action in pipeline %q: %s", info.Type, p.Name, err.Error())
+		return nil, fmt.Errorf("can't unmarshal config for %d/%s action: %w", index, t, err)
 	}
 
 	err = cfg.Parse(config, values)
 	if err != nil {
-		logger.Fatalf("wrong config for %q action in pipeline %q: %s", info.Type, p.Name, err.Error())
+		return nil, fmt.Errorf("wrong config for %d/%s action: %w", index, t, err)
 	}
 
 	infoCopy := *info
 	infoCopy.Config = config
 	infoCopy.Type = t
 
-	p.AddAction(&pipeline.ActionPluginStaticInfo{
+	return &pipeline.ActionPluginStaticInfo{
 		PluginStaticInfo: &infoCopy,
 		MatchConditions:  conditions,
 		MatchMode:        matchMode,
 		MetricName:       metricName,
 		MetricLabels:     metricLabels,
 		MatchInvert:      matchInvert,
-	})
+	}, nil
 }
 
 func (f *FileD) setupOutput(p *pipeline.Pipeline, pipelineConfig *cfg.PipelineConfig, values map[string]int) error {
-	info, err := f.getStaticInfo(pipelineConfig, pipeline.PluginKindOutput, values)
+	infos, single, err := f.getOutputsInfo(pipelineConfig, values)
 	if err != nil {
 		return err
 	}
 
-	p.SetOutput(&pipeline.OutputPluginInfo{
+	if single {
+		p.SetOutput(infos[0])
+		return nil
+	}
+	for _, info := range infos {
+		p.AddOutput(info)
+	}
+
+	return nil
+}
+
+// getOutputsInfo returns the outputs of the pipeline, single is true if the output section is used instead of the outputs list.
+func (f *FileD) getOutputsInfo(pipelineConfig *cfg.PipelineConfig, values map[string]int) (infos []*pipeline.OutputPluginInfo, single bool, err error) {
+	outputs, has := pipelineConfig.Raw.CheckGet("outputs")
+	if !has {
+		info, err := f.getOutputInfo(pipelineConfig.Raw.Get(string(pipeline.PluginKindOutput)), values)
+		if err != nil {
+			return nil, false, err
+		}
+		return []*pipeline.OutputPluginInfo{info}, true, nil
+	}
+
+	if _, has := pipelineConfig.Raw.CheckGet(string(pipeline.PluginKindOutput)); has {
+		return nil, false, fmt.Errorf("both output and outputs are provided")
+	}
+	if len(outputs.MustArray()) == 0 {
+		return nil, false, fmt.Errorf("no output plugin provided")
+	}
+
+	for index := range outputs.MustArray() {
+		info, err := f.getOutputInfo(outputs.GetIndex(index), values)
+		if err != nil {
+			return nil, false, fmt.Errorf("output #%d: %w", index, err)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, false, nil
+}
+
+// getOutputInfo extracts routing params of the output and creates the output with the rest of the config.
+func (f *FileD) getOutputInfo(outputJSON *simplejson.Json, values map[string]int) (*pipeline.OutputPluginInfo, error) {
+	routeTagFilter := extractRouteTagFilter(outputJSON)
+
+	matchMode := extractMatchMode(outputJSON)
+	if matchMode == pipeline.MatchModeUnknown {
+		return nil, fmt.Errorf("unknown match_mode value")
+	}
+	matchInvert, err := extractMatchInvert(outputJSON)
+	if err != nil {
+		return nil, fmt.Errorf("can't extract invert match mode: %w", err)
+	}
+	conditions, err := extractConditions(outputJSON.Get("match_fields"))
+	if err != nil {
+		return nil, fmt.Errorf("can't extract conditions: %w", err)
+	}
+	outputJSON.Del("match_fields")
+	outputJSON.Del("match_mode")
+	outputJSON.Del("match_invert")
+
+	fallback, err := f.getFallbackInfo(outputJSON, values)
+	if err != nil {
+		return nil, fmt.Errorf("fallback: %w", err)
+	}
+	diskQueue, err := extractDiskQueueConfig(outputJSON, values)
+	if err != nil {
+		return nil, fmt.Errorf("disk_queue: %w", err)
+	}
+	if fallback != nil && diskQueue != nil {
+		return nil, fmt.Errorf("fallback and disk_queue can't be used together")
+	}
+
+	info, err := f.getStaticInfoFromJSON(outputJSON, pipeline.PluginKindOutput, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeline.OutputPluginInfo{
 		PluginStaticInfo:  info,
 		PluginRuntimeInfo: f.instantiatePlugin(info),
-	})
+		RouteTagFilter:    routeTagFilter,
+		MatchConditions:   conditions,
+		MatchMode:         matchMode,
+		MatchInvert:       matchInvert,
+		Fallback:          fallback,
+		DiskQueue:         diskQueue,
+	}, nil
+}
 
-	return nil
+// getFallbackInfo extracts the fallback output of the output, it returns nil if the fallback isn't set.
+func (f *FileD) getFallbackInfo(outputJSON *simplejson.Json, values map[string]int) (*pipeline.OutputPluginInfo, error) {
+	fallbackJSON, has := outputJSON.CheckGet("fallback")
+	if !has {
+		return nil, nil
+	}
+	outputJSON.Del("fallback")
+
+	info, err := f.getStaticInfoFromJSON(fallbackJSON, pipeline.PluginKindOutput, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeline.OutputPluginInfo{
+		PluginStaticInfo:  info,
+		PluginRuntimeInfo: f.instantiatePlugin(info),
+	}, nil
 }
 
 func (f *FileD) instantiatePlugin(info *pipeline.PluginStaticInfo) *pipeline.PluginRuntimeInfo {
@@ -224,7 +409,10 @@ func (f *FileD) instantiatePlugin(info *pipeline.PluginStaticInfo) *pipeline.Plu
 }
 
 func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pipeline.PluginKind, values map[string]int) (*pipeline.PluginStaticInfo, error) {
-	configJSON := pipelineConfig.Raw.Get(string(pluginKind))
+	return f.getStaticInfoFromJSON(pipelineConfig.Raw.Get(string(pluginKind)), pluginKind, values)
+}
+
+func (f *FileD) getStaticInfoFromJSON(configJSON *simplejson.Json, pluginKind pipeline.PluginKind, values map[string]int) (*pipeline.PluginStaticInfo, error) {
 	if configJSON.MustMap() == nil {
 		return nil, fmt.Errorf("no %s plugin provided", pluginKind)
 	}
@@ -235,7 +423,10 @@ func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pip
 		return nil, fmt.Errorf("%s doesn't have type", pluginKind)
 	}
 	logger.Infof("creating %s with type %q", pluginKind, t)
-	info := f.plugins.Get(pluginKind, t)
+	info, err := f.plugins.lookup(pluginKind, t)
+	if err != nil {
+		return nil, err
+	}
 	configJson, err := configJSON.Encode()
 	if err != nil {
 		logger.Panicf("can't create config json for %s", t)
@@ -247,7 +438,7 @@ func (f *FileD) getStaticInfo(pipelineConfig *cfg.PipelineConfig, pluginKind pip
 
 	err = cfg.Parse(config, values)
 	if err != nil {
-		logger.Fatalf("wrong config for %q plugin %q: %s", pluginKind, t, err.Error())
+		return nil, fmt.Errorf("wrong config for %q plugin %q: %w", pluginKind, t, err)
 	}
 
 	infoCopy := *info
@@ -275,18 +466,47 @@ func (f *FileD) Stop(ctx context.Context) error {
 	return err
 }
 
+// Drain holds new events of the pipelines and waits until the events in processing are committed.
+// It returns an error if some pipelines aren't drained until the context is done.
+func (f *FileD) Drain(ctx context.Context) error {
+	logger.Infof("draining pipelines=%d", len(f.Pipelines))
+
+	wg := &sync.WaitGroup{}
+	notDrained := atomic.NewInt32(0)
+	for _, p := range f.Pipelines {
+		wg.Add(1)
+		go func(p *pipeline.Pipeline) {
+			defer wg.Done()
+			if !p.Drain(ctx) {
+				notDrained.Inc()
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if notDrained.Load() != 0 {
+		return fmt.Errorf("%d of %d pipelines aren't drained, some events in processing aren't committed", notDrained.Load(), len(f.Pipelines))
+	}
+	return nil
+}
+
 func (f *FileD) startHTTP() {
 	if f.httpAddr == "off" {
 		return
 	}
 
-	mux := http.DefaultServeMux
+	mux := f.mux
 
 	mux.HandleFunc("/live", f.serveLiveReady)
 	mux.HandleFunc("/ready", f.serveLiveReady)
 	mux.HandleFunc("/freeosmem", f.serveFreeOsMem)
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.Handle("/log/level", logger.Level)
+	// pprof handlers are registered in the default mux
+	mux.Handle("/debug/pprof/", http.DefaultServeMux)
+	if f.reloader != nil {
+		mux.HandleFunc("/reload/status", f.reloader.serveStatus)
+	}
 
 	f.server = &http.Server{Addr: f.httpAddr, Handler: mux}
 	longpanic.Go(f.listenHTTP)
@@ -294,7 +514,8 @@ func (f *FileD) startHTTP() {
 
 func (f *FileD) listenHTTP() {
 	err := f.server.ListenAndServe()
-	if err != nil {
+	// the server is closed on the config reload
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Fatalf("http listening error address=%q: %s", f.httpAddr, err.Error())
 	}
 }
@@ -1,6 +1,8 @@
 package fd
 
 import (
+	"fmt"
+
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline"
 )
@@ -14,17 +16,24 @@ type PluginRegistry struct {
 }
 
 func (r *PluginRegistry) Get(kind pipeline.PluginKind, t string) *pipeline.PluginStaticInfo {
-	id := r.MakeID(kind, t)
-
-	info := r.plugins[id]
-	if info == nil {
-		logger.Fatalf("can't find plugin kind=%s type=%s", kind, t)
+	info, err := r.lookup(kind, t)
+	if err != nil {
+		logger.Fatalf("%s", err.Error())
 		return nil
 	}
 
 	return info
 }
 
+func (r *PluginRegistry) lookup(kind pipeline.PluginKind, t string) (*pipeline.PluginStaticInfo, error) {
+	info := r.plugins[r.MakeID(kind, t)]
+	if info == nil {
+		return nil, fmt.Errorf("can't find plugin kind=%s type=%s", kind, t)
+	}
+
+	return info, nil
+}
+
 func (r *PluginRegistry) GetActionByType(t string) *pipeline.PluginStaticInfo {
 	id := r.MakeID(pipeline.PluginKindAction, t)
 
@@ -74,3 +83,12 @@ func (r *PluginRegistry) register(pluginKind pipeline.PluginKind, info *pipeline
 
 	return nil
 }
+
+func (r *PluginRegistry) clone() *PluginRegistry {
+	plugins := make(map[string]*pipeline.PluginStaticInfo, len(r.plugins))
+	for id, info := range r.plugins {
+		plugins[id] = info
+	}
+
+	return &PluginRegistry{plugins: plugins}
+}
@@ -0,0 +1,300 @@
+package fd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/longpanic"
+)
+
+const (
+	ReloadStateApplied    = "applied"
+	ReloadStateBaking     = "baking"
+	ReloadStateRolledBack = "rolled_back"
+
+	stopTimeout = 3 * time.Second
+)
+
+// healthCheckInterval is a variable to speed up tests.
+var healthCheckInterval = time.Second
+
+// ReloadStatus is the state of the last config reload.
+type ReloadStatus struct {
+	State          string    `json:"state"`
+	Rollbacks      int       `json:"rollbacks"`
+	LastRollback   time.Time `json:"last_rollback,omitempty"`
+	RollbackReason string    `json:"rollback_reason,omitempty"`
+}
+
+// Reloader restarts file.d with new configs.
+// If the config has the rollback bake period, the health of file.d is watched during the period
+// and the previous config is restored if file.d becomes unhealthy.
+type Reloader struct {
+	httpAddr string
+
+	mu         *sync.Mutex
+	fileD      *FileD
+	config     *cfg.Config
+	prevConfig *cfg.Config
+	cancelBake context.CancelFunc
+
+	// status is guarded by its own mutex to serve it while file.d is restarting
+	statusMu *sync.Mutex
+	status   ReloadStatus
+}
+
+func NewReloader(httpAddr string) *Reloader {
+	return &Reloader{
+		httpAddr: httpAddr,
+		mu:       &sync.Mutex{},
+		statusMu: &sync.Mutex{},
+		status:   ReloadStatus{State: ReloadStateApplied},
+	}
+}
+
+// Start starts file.d with the initial config.
+func (r *Reloader) Start(config *cfg.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.start(config)
+}
+
+// Reload stops file.d and starts it with the new config.
+// The config is checked before file.d is stopped, so the current pipelines are kept if it's wrong.
+func (r *Reloader) Reload(config *cfg.Config) error {
+	if err := New(config, r.httpAddr).validateConfig(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancelBake != nil {
+		r.cancelBake()
+		r.cancelBake = nil
+	}
+
+	prevConfig := r.config
+	if err := r.stop(); err != nil {
+		logger.Errorf("%s", err.Error())
+	}
+	r.start(config)
+
+	if config.Rollback.BakePeriod <= 0 || prevConfig == nil {
+		r.prevConfig = nil
+		r.setState(ReloadStateApplied)
+		return nil
+	}
+
+	logger.Infof("watching file.d health for %s after the reload", config.Rollback.BakePeriod)
+	r.prevConfig = prevConfig
+	r.setState(ReloadStateBaking)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancelBake = cancel
+	go r.bake(ctx, r.fileD, config.Rollback.BakePeriod, r.fileD.healthCheck(config.Rollback))
+
+	return nil
+}
+
+// ReloadFile reads the config file and reloads file.d with it.
+// Unlike the start, the wrong config doesn't stop the process: the error is returned and the current pipelines are kept.
+func (r *Reloader) ReloadFile(path string) (*cfg.Config, error) {
+	config, err := cfg.ReadConfigFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Reload(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Stop stops file.d and the health watching.
+func (r *Reloader) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancelBake != nil {
+		r.cancelBake()
+		r.cancelBake = nil
+	}
+
+	return r.stop()
+}
+
+// Shutdown drains the pipelines and stops file.d.
+// The timeout limits the drain, the shutdown timeout of the config is used if it's zero.
+// It returns an error if some events in processing aren't committed.
+func (r *Reloader) Shutdown(timeout time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancelBake != nil {
+		r.cancelBake()
+		r.cancelBake = nil
+	}
+	if r.fileD == nil {
+		return nil
+	}
+
+	if timeout <= 0 {
+		timeout = r.config.ShutdownTimeout
+	}
+	logger.Infof("shutting down file.d, shutdown timeout=%s", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	drainErr := r.fileD.Drain(ctx)
+
+	stopErr := r.stop()
+	if drainErr != nil {
+		if stopErr != nil {
+			logger.Errorf("%s", stopErr.Error())
+		}
+		return drainErr
+	}
+	return stopErr
+}
+
+// Status returns the state of the last config reload.
+func (r *Reloader) Status() ReloadStatus {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	return r.status
+}
+
+func (r *Reloader) bake(ctx context.Context, fileD *FileD, bakePeriod time.Duration, check func() error) {
+	err := watchHealth(ctx, bakePeriod, check)
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// file.d has been reloaded or stopped meanwhile
+	if r.fileD != fileD {
+		return
+	}
+	r.cancelBake = nil
+
+	if err == nil {
+		logger.Infof("file.d is healthy after the reload")
+		r.prevConfig = nil
+		r.setState(ReloadStateApplied)
+		return
+	}
+
+	logger.Errorf("file.d is unhealthy after the reload, rolling back the config: %s", err.Error())
+	if stopErr := r.stop(); stopErr != nil {
+		logger.Errorf("%s", stopErr.Error())
+	}
+	// let plugin goroutines waiting for the recovery exit instead of panicking
+	longpanic.RecoverFromPanic()
+
+	r.statusMu.Lock()
+	r.status.State = ReloadStateRolledBack
+	r.status.Rollbacks++
+	r.status.LastRollback = time.Now()
+	r.status.RollbackReason = err.Error()
+	r.statusMu.Unlock()
+
+	prevConfig := r.prevConfig
+	r.prevConfig = nil
+	r.start(prevConfig)
+}
+
+func (r *Reloader) start(config *cfg.Config) {
+	longpanic.SetTimeout(config.PanicTimeout)
+
+	r.config = config
+	r.fileD = New(config, r.httpAddr)
+	r.fileD.reloader = r
+	r.fileD.Start()
+}
+
+func (r *Reloader) stop() error {
+	if r.fileD == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+
+	err := r.fileD.Stop(ctx)
+	r.fileD = nil
+	if err != nil {
+		return fmt.Errorf("can't stop file.d: %w", err)
+	}
+	return nil
+}
+
+func (r *Reloader) setState(state string) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	r.status.State = state
+}
+
+func (r *Reloader) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	data, err := json.Marshal(r.Status())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// healthCheck returns a func checking that the count of error logs and plugin failures
+// since the healthCheck call doesn't exceed the limits of the config.
+func (f *FileD) healthCheck(config cfg.RollbackConfig) func() error {
+	startErrors := logger.ErrorCount()
+	startFailures := f.pluginFailures.Load()
+	maxErrors := int64(config.MaxErrorRate * config.BakePeriod.Seconds())
+
+	return func() error {
+		failures := f.pluginFailures.Load() - startFailures
+		if failures > int64(config.MaxPluginFailures) {
+			return fmt.Errorf("plugin failures count %d exceeds the limit %d", failures, config.MaxPluginFailures)
+		}
+		errs := logger.ErrorCount() - startErrors
+		if errs > maxErrors {
+			return fmt.Errorf("errors count %d exceeds the limit %d for %s", errs, maxErrors, config.BakePeriod)
+		}
+		return nil
+	}
+}
+
+// watchHealth runs the check during the bake period and returns the first error.
+func watchHealth(ctx context.Context, bakePeriod time.Duration, check func() error) error {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(bakePeriod)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := check(); err != nil {
+				return err
+			}
+		case <-deadline.C:
+			return check()
+		}
+	}
+}
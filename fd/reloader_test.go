@@ -0,0 +1,238 @@
+package fd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPluginType = "reloader_test"
+
+type testPlugin struct{}
+
+func (p *testPlugin) Stop() {}
+
+func (p *testPlugin) RegisterMetrics(_ *metric.Ctl) {}
+
+type testInput struct{ testPlugin }
+
+func (p *testInput) Start(_ pipeline.AnyConfig, _ *pipeline.InputPluginParams) {}
+
+func (p *testInput) Commit(_ *pipeline.Event) {}
+
+func (p *testInput) PassEvent(_ *pipeline.Event) bool {
+	return true
+}
+
+type testAction struct{ testPlugin }
+
+func (p *testAction) Start(_ pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {}
+
+func (p *testAction) Do(_ *pipeline.Event) pipeline.ActionResult {
+	return pipeline.ActionPass
+}
+
+type testOutput struct{ testPlugin }
+
+func (p *testOutput) Start(_ pipeline.AnyConfig, _ *pipeline.OutputPluginParams) {}
+
+func (p *testOutput) Out(_ *pipeline.Event) {}
+
+type testPluginConfig struct {
+	Field string `json:"field" required:"true"`
+}
+
+func init() {
+	DefaultPluginRegistry.RegisterInput(&pipeline.PluginStaticInfo{
+		Type: testPluginType,
+		Factory: func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+			return &testInput{}, &testPluginConfig{}
+		},
+	})
+	DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type: testPluginType,
+		Factory: func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+			return &testAction{}, &testPluginConfig{}
+		},
+	})
+	DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type: testPluginType,
+		Factory: func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+			return &testOutput{}, &testPluginConfig{}
+		},
+	})
+}
+
+// newTestConfig returns the config with the pipeline of the test plugins,
+// the plugin configs are decoded on every start of the pipeline.
+func newTestConfig(rollback cfg.RollbackConfig) *cfg.Config {
+	config, err := cfg.NewConfigFromBytes([]byte(`
+pipelines:
+  test:
+    input:
+      type: reloader_test
+      field: input
+    actions:
+      - type: reloader_test
+        field: action
+        match_fields:
+          level: error
+    output:
+      type: reloader_test
+      field: output
+      accept_tags: [tag]
+`))
+	if err != nil {
+		panic(err.Error())
+	}
+	config.PanicTimeout = time.Minute
+	config.Rollback = rollback
+	return config
+}
+
+func TestWatchHealth(t *testing.T) {
+	healthCheckInterval = 10 * time.Millisecond
+
+	cases := []struct {
+		name     string
+		config   cfg.RollbackConfig
+		errors   int
+		failures int
+		healthy  bool
+	}{
+		{
+			name:    "healthy",
+			config:  cfg.RollbackConfig{BakePeriod: 100 * time.Millisecond},
+			healthy: true,
+		},
+		{
+			name:    "errors_within_limit",
+			config:  cfg.RollbackConfig{BakePeriod: 100 * time.Millisecond, MaxErrorRate: 20},
+			errors:  2,
+			healthy: true,
+		},
+		{
+			name:   "errors_exceed_limit",
+			config: cfg.RollbackConfig{BakePeriod: time.Minute, MaxErrorRate: 0.05},
+			errors: 4,
+		},
+		{
+			name:     "plugin_failures",
+			config:   cfg.RollbackConfig{BakePeriod: time.Minute, MaxErrorRate: 100},
+			failures: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := New(cfg.NewConfig(), "off")
+			check := f.healthCheck(tc.config)
+
+			done := make(chan error)
+			go func() {
+				done <- watchHealth(context.Background(), tc.config.BakePeriod, check)
+			}()
+
+			for i := 0; i < tc.errors; i++ {
+				logger.Error("test error")
+			}
+			f.pluginFailures.Add(int64(tc.failures))
+
+			select {
+			case err := <-done:
+				if tc.healthy {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("health watching isn't finished")
+			}
+		})
+	}
+}
+
+func TestReloaderRollback(t *testing.T) {
+	healthCheckInterval = 10 * time.Millisecond
+
+	r := NewReloader("off")
+	initial := newTestConfig(cfg.RollbackConfig{})
+	r.Start(initial)
+	defer func() {
+		require.NoError(t, r.Stop())
+	}()
+
+	// the config without the bake period is applied at once
+	next := newTestConfig(cfg.RollbackConfig{})
+	require.NoError(t, r.Reload(next))
+	assert.Equal(t, ReloadStateApplied, r.Status().State)
+
+	// healthy config is applied after the bake period
+	healthy := newTestConfig(cfg.RollbackConfig{BakePeriod: 50 * time.Millisecond, MaxErrorRate: 100})
+	require.NoError(t, r.Reload(healthy))
+	assert.Equal(t, ReloadStateBaking, r.Status().State)
+	assert.Eventually(t, func() bool {
+		return r.Status().State == ReloadStateApplied
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// unhealthy config is rolled back
+	unhealthy := newTestConfig(cfg.RollbackConfig{BakePeriod: time.Minute})
+	require.NoError(t, r.Reload(unhealthy))
+	logger.Error("test error")
+	assert.Eventually(t, func() bool {
+		return r.Status().State == ReloadStateRolledBack
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := r.Status()
+	assert.Equal(t, 1, status.Rollbacks)
+	assert.Contains(t, status.RollbackReason, "errors count")
+
+	r.mu.Lock()
+	assert.Same(t, healthy, r.config)
+	assert.Nil(t, r.prevConfig)
+	r.mu.Unlock()
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	r := NewReloader("off")
+	initial := newTestConfig(cfg.RollbackConfig{})
+	r.Start(initial)
+	defer func() {
+		require.NoError(t, r.Stop())
+	}()
+
+	r.mu.Lock()
+	fileD := r.fileD
+	r.mu.Unlock()
+
+	for name, content := range map[string]string{
+		"wrong_yaml":     "pipelines: [",
+		"no_pipelines":   "pipelines: {}",
+		"wrong_rollback": "rollback: {bake_period: x}\npipelines: {test: {input: {type: fake}}}",
+		"unknown_plugin": "pipelines: {test: {input: {type: unknown}, output: {type: unknown}}}",
+	} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+		_, err := r.ReloadFile(path)
+		assert.Error(t, err, name)
+	}
+	_, err := r.ReloadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+
+	// the process isn't stopped and file.d keeps running with the current config
+	r.mu.Lock()
+	assert.Same(t, fileD, r.fileD)
+	assert.Same(t, initial, r.config)
+	r.mu.Unlock()
+	assert.Equal(t, ReloadStateApplied, r.Status().State)
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/ozontech/file.d/pipeline"
 )
 
-func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
+func extractPipelineParams(settings *simplejson.Json) (*pipeline.Settings, error) {
 	capacity := pipeline.DefaultCapacity
 	antispamThreshold := 0
 	avgInputEventSize := pipeline.DefaultAvgInputEventSize
@@ -20,6 +20,9 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 	decoder := "auto"
 	isStrict := false
 	eventTimeout := pipeline.DefaultEventTimeout
+	eventStats := false
+	eventStatsField := pipeline.DefaultEventStatsField
+	eventStatsTopK := pipeline.DefaultEventStatsTopK
 
 	if settings != nil {
 		val := settings.Get("capacity").MustInt()
@@ -51,7 +54,7 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		if str != "" {
 			i, err := time.ParseDuration(str)
 			if err != nil {
-				logger.Fatalf("can't parse pipeline maintenance interval: %s", err.Error())
+				return nil, fmt.Errorf("can't parse pipeline maintenance interval: %w", err)
 			}
 			maintenanceInterval = i
 		}
@@ -60,7 +63,7 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		if str != "" {
 			i, err := time.ParseDuration(str)
 			if err != nil {
-				logger.Fatalf("can't parse pipeline event timeout: %s", err.Error())
+				return nil, fmt.Errorf("can't parse pipeline event timeout: %w", err)
 			}
 			eventTimeout = i
 		}
@@ -69,6 +72,18 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		antispamThreshold *= int(maintenanceInterval / time.Second)
 
 		isStrict = settings.Get("is_strict").MustBool()
+
+		eventStats = settings.Get("event_stats").MustBool()
+
+		str = settings.Get("event_stats_field").MustString()
+		if str != "" {
+			eventStatsField = str
+		}
+
+		val = settings.Get("event_stats_top_k").MustInt()
+		if val != 0 {
+			eventStatsTopK = val
+		}
 	}
 
 	return &pipeline.Settings{
@@ -81,7 +96,10 @@ func extractPipelineParams(settings *simplejson.Json) *pipeline.Settings {
 		EventTimeout:        eventTimeout,
 		StreamField:         streamField,
 		IsStrict:            isStrict,
-	}
+		EventStats:          eventStats,
+		EventStatsField:     eventStatsField,
+		EventStatsTopK:      eventStatsTopK,
+	}, nil
 }
 
 func extractMatchMode(actionJSON *simplejson.Json) pipeline.MatchMode {
@@ -146,6 +164,47 @@ func extractMetrics(actionJSON *simplejson.Json) (string, []string) {
 	return metricName, metricLabels
 }
 
+// extractRouteTagFilter extracts route tag params of the output and deletes them from the output config.
+func extractRouteTagFilter(outputJSON *simplejson.Json) *pipeline.RouteTagFilter {
+	filter := &pipeline.RouteTagFilter{
+		AcceptTags: outputJSON.Get("accept_tags").MustStringArray(),
+		RejectTags: outputJSON.Get("reject_tags").MustStringArray(),
+	}
+	outputJSON.Del("accept_tags")
+	outputJSON.Del("reject_tags")
+
+	if filter.IsEmpty() {
+		return nil
+	}
+	return filter
+}
+
+// extractDiskQueueConfig extracts the disk queue config of the output, it returns nil if the queue isn't set.
+func extractDiskQueueConfig(outputJSON *simplejson.Json, values map[string]int) (*pipeline.DiskQueueConfig, error) {
+	queueJSON, has := outputJSON.CheckGet("disk_queue")
+	if !has {
+		return nil, nil
+	}
+	outputJSON.Del("disk_queue")
+
+	configJSON, err := queueJSON.Encode()
+	if err != nil {
+		return nil, err
+	}
+	config := &pipeline.DiskQueueConfig{}
+	if err := DecodeConfig(config, configJSON); err != nil {
+		return nil, err
+	}
+	if err := cfg.Parse(config, values); err != nil {
+		return nil, err
+	}
+	if config.SegmentSize_ == 0 || config.SegmentSize_*2 > config.MaxSize_ {
+		return nil, fmt.Errorf("segment_size must be positive and not greater than half of max_size")
+	}
+
+	return config, nil
+}
+
 func makeActionJSON(actionJSON *simplejson.Json) []byte {
 	actionJSON.Del("type")
 	actionJSON.Del("match_fields")
@@ -159,3 +218,18 @@ func makeActionJSON(actionJSON *simplejson.Json) []byte {
 	}
 	return configJson
 }
+
+// copyPipelineJSON returns a deep copy of the raw pipeline config.
+// Plugin configs are modified while they are decoded, so the raw config is copied to be able
+// to create the pipeline again, e.g. on a rollback of the reload.
+func copyPipelineJSON(raw *simplejson.Json) (*simplejson.Json, error) {
+	content, err := raw.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("can't encode pipeline config: %w", err)
+	}
+	copied, err := simplejson.NewJson(content)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode pipeline config: %w", err)
+	}
+	return copied, nil
+}
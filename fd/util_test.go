@@ -2,6 +2,7 @@ package fd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/ozontech/file.d/pipeline"
@@ -33,3 +34,42 @@ func Test_extractConditions(t *testing.T) {
 	}
 	require.Equal(t, expected, got)
 }
+
+func Test_extractRouteTagFilter(t *testing.T) {
+	j, err := simplejson.NewJson([]byte(`{"type": "devnull", "accept_tags": ["audit", "security"], "reject_tags": ["debug"]}`))
+	require.NoError(t, err)
+	got := extractRouteTagFilter(j)
+	require.Equal(t, &pipeline.RouteTagFilter{
+		AcceptTags: []string{"audit", "security"},
+		RejectTags: []string{"debug"},
+	}, got)
+	require.Equal(t, map[string]any{"type": "devnull"}, j.MustMap())
+
+	j, err = simplejson.NewJson([]byte(`{"type": "devnull"}`))
+	require.NoError(t, err)
+	require.Nil(t, extractRouteTagFilter(j))
+}
+
+func Test_extractDiskQueueConfig(t *testing.T) {
+	j, err := simplejson.NewJson([]byte(`{"type": "devnull", "disk_queue": {"dir": "/tmp/queue", "max_size": "1 GiB"}}`))
+	require.NoError(t, err)
+	got, err := extractDiskQueueConfig(j, nil)
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/queue", got.Dir)
+	require.Equal(t, uint64(1<<30), got.MaxSize_)
+	require.Equal(t, uint64(64<<20), got.SegmentSize_)
+	require.Equal(t, "interval", got.Fsync)
+	require.Equal(t, time.Second, got.FsyncInterval_)
+	require.Equal(t, map[string]any{"type": "devnull"}, j.MustMap())
+
+	j, err = simplejson.NewJson([]byte(`{"disk_queue": {"dir": "/tmp/queue", "max_size": "1 GiB", "segment_size": "1 GiB"}}`))
+	require.NoError(t, err)
+	_, err = extractDiskQueueConfig(j, nil)
+	require.Error(t, err, "segment is greater than half of the max size")
+
+	j, err = simplejson.NewJson([]byte(`{"type": "devnull"}`))
+	require.NoError(t, err)
+	got, err = extractDiskQueueConfig(j, nil)
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
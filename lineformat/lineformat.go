@@ -0,0 +1,138 @@
+// Package lineformat formats the events as the plain lines for the outputs writing to the files and consoles.
+package lineformat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ozontech/file.d/cfg"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+const (
+	TypeJSON     = "json"
+	TypeRaw      = "raw"
+	TypeTemplate = "template"
+	TypeCSV      = "csv"
+)
+
+// Config is a config of the line format, it's embedded into the configs of the outputs.
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Format of the lines:
+	// > * `json` – the events as is
+	// > * `raw` – the value of the `field`, e.g. the original log line
+	// > * `template` – the `template` filled with the event fields
+	// > * `csv` – the values of the `columns` separated by the `delimiter`
+	Type string `json:"type" default:"json" options:"json|raw|template|csv"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Field of `raw` format.
+	Field  cfg.FieldSelector `json:"field" default:"message" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Template of `template` format. Use `${field}` to insert event field values, `$$` to insert `$` character.
+	Template string `json:"template"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Fields of `csv` format columns.
+	Columns []string `json:"columns" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Delimiter of `csv` format columns.
+	Delimiter string `json:"delimiter" default:","` // *
+}
+
+// Formatter appends the events to the buffers by the format.
+// String values are written as is, other values are written as JSON, missing and null values are empty.
+type Formatter struct {
+	config      *Config
+	templateOps []cfg.SubstitutionOp
+	columns     [][]string
+}
+
+func New(config *Config) (*Formatter, error) {
+	f := &Formatter{config: config}
+
+	switch config.Type {
+	case TypeTemplate:
+		if config.Template == "" {
+			return nil, fmt.Errorf("template isn't set")
+		}
+		ops, err := cfg.ParseSubstitution(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse template: %w", err)
+		}
+		f.templateOps = ops
+	case TypeCSV:
+		if len(config.Columns) == 0 {
+			return nil, fmt.Errorf("columns aren't set")
+		}
+		if len(config.Delimiter) != 1 {
+			return nil, fmt.Errorf("delimiter must be a single character")
+		}
+		for _, column := range config.Columns {
+			f.columns = append(f.columns, cfg.ParseFieldSelector(column))
+		}
+	}
+
+	return f, nil
+}
+
+// Append appends the formatted event without the line separator.
+func (f *Formatter) Append(buf []byte, root *insaneJSON.Root) []byte {
+	switch f.config.Type {
+	case TypeRaw:
+		return appendValue(buf, root.Dig(f.config.Field_...))
+	case TypeTemplate:
+		for _, op := range f.templateOps {
+			if op.Kind == cfg.SubstitutionOpKindField {
+				buf = appendValue(buf, root.Dig(op.Data...))
+				continue
+			}
+			buf = append(buf, op.Data[0]...)
+		}
+		return buf
+	case TypeCSV:
+		for i, column := range f.columns {
+			if i > 0 {
+				buf = append(buf, f.config.Delimiter...)
+			}
+			buf = f.appendCSVValue(buf, root.Dig(column...))
+		}
+		return buf
+	default:
+		return root.Encode(buf)
+	}
+}
+
+func appendValue(buf []byte, node *insaneJSON.Node) []byte {
+	if node == nil || node.IsNull() {
+		return buf
+	}
+	if node.IsString() {
+		return append(buf, node.AsString()...)
+	}
+	return node.Encode(buf)
+}
+
+// appendCSVValue quotes the value if it contains the delimiter, quotes or line breaks like RFC 4180 requires.
+func (f *Formatter) appendCSVValue(buf []byte, node *insaneJSON.Node) []byte {
+	start := len(buf)
+	buf = appendValue(buf, node)
+
+	value := string(buf[start:])
+	if !strings.ContainsAny(value, f.config.Delimiter+"\"\r\n") {
+		return buf
+	}
+
+	buf = append(buf[:start], '"')
+	buf = append(buf, strings.ReplaceAll(value, `"`, `""`)...)
+	return append(buf, '"')
+}
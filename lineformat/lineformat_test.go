@@ -0,0 +1,75 @@
+package lineformat
+
+import (
+	"testing"
+
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+func TestFormatter(t *testing.T) {
+	const event = `{"ts":"2023-01-02","level":"error","message":"a, \"b\"","k8s":{"pod":"api-1"},"code":500,"tags":["x"],"empty":null}`
+
+	for name, tc := range map[string]struct {
+		config *Config
+		line   string
+	}{
+		"json": {
+			config: &Config{},
+			line:   event,
+		},
+		"raw": {
+			config: &Config{Type: TypeRaw},
+			line:   `a, "b"`,
+		},
+		"raw object": {
+			config: &Config{Type: TypeRaw, Field: "k8s"},
+			line:   `{"pod":"api-1"}`,
+		},
+		"raw missing": {
+			config: &Config{Type: TypeRaw, Field: "missing"},
+			line:   ``,
+		},
+		"template": {
+			config: &Config{Type: TypeTemplate, Template: "${ts} [${level}] ${k8s.pod}: ${code} ${missing}$$"},
+			line:   `2023-01-02 [error] api-1: 500 $`,
+		},
+		"csv": {
+			config: &Config{Type: TypeCSV, Columns: []string{"ts", "code", "message", "tags", "empty", "k8s.pod"}},
+			line:   `2023-01-02,500,"a, ""b""","[""x""]",,api-1`,
+		},
+		"csv delimiter": {
+			config: &Config{Type: TypeCSV, Columns: []string{"level", "message"}, Delimiter: ";"},
+			line:   `error;"a, ""b"""`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			test.NewConfig(tc.config, nil)
+			f, err := New(tc.config)
+			require.NoError(t, err)
+
+			root, err := insaneJSON.DecodeString(event)
+			require.NoError(t, err)
+			defer insaneJSON.Release(root)
+
+			assert.Equal(t, tc.line, string(f.Append(nil, root)))
+		})
+	}
+}
+
+func TestFormatterConfig(t *testing.T) {
+	for name, config := range map[string]*Config{
+		"no template":   {Type: TypeTemplate},
+		"bad template":  {Type: TypeTemplate, Template: "${level"},
+		"no columns":    {Type: TypeCSV},
+		"bad delimiter": {Type: TypeCSV, Columns: []string{"level"}, Delimiter: "||"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			test.NewConfig(config, nil)
+			_, err := New(config)
+			assert.Error(t, err)
+		})
+	}
+}
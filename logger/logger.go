@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -11,6 +12,9 @@ import (
 var Instance *zap.SugaredLogger
 var Level zap.AtomicLevel
 
+// errorCount is the total count of entries logged with error or higher level.
+var errorCount = atomic.NewInt64(0)
+
 const defaultLevel = zap.InfoLevel
 
 func init() {
@@ -50,11 +54,25 @@ func init() {
 			zapcore.AddSync(os.Stdout),
 			Level,
 		),
+		zap.Hooks(countErrors),
 	).Sugar().Named("fd")
 
 	Instance.Infof("Logger initialized with level: %s", level)
 }
 
+func countErrors(entry zapcore.Entry) error {
+	if entry.Level >= zap.ErrorLevel {
+		errorCount.Inc()
+	}
+	return nil
+}
+
+// ErrorCount returns the total count of entries logged with error or higher level.
+// It's used to watch the health of file.d.
+func ErrorCount() int64 {
+	return errorCount.Load()
+}
+
 func Debug(args ...any) {
 	Instance.Debug(args...)
 }
@@ -0,0 +1,83 @@
+package lookup
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// Cache is a size-limited cache with two generations:
+// once the current generation is full, it becomes the previous one and the oldest entries are evicted.
+// The entries used from the previous generation are moved to the current one, so it works like LRU.
+// It's used by the remote providers and by the actions caching their lookup results.
+type Cache struct {
+	mu      sync.Mutex
+	genSize int
+	ttl     time.Duration
+	current map[string]cacheEntry
+	prev    map[string]cacheEntry
+}
+
+// NewCache returns the cache of the size, zero size disables caching.
+// The entries expire after the ttl, zero ttl means they don't expire.
+func NewCache(size int, ttl time.Duration) *Cache {
+	genSize := size / 2
+	if size > 0 && genSize == 0 {
+		genSize = 1
+	}
+	return &Cache{
+		genSize: genSize,
+		ttl:     ttl,
+		current: make(map[string]cacheEntry),
+		prev:    make(map[string]cacheEntry),
+	}
+}
+
+// Get returns the cached value and false if the key isn't cached or the entry is expired.
+func (c *Cache) Get(key string, now time.Time) (any, bool) {
+	if c.genSize == 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.current[key]
+	if !ok {
+		entry, ok = c.prev[key]
+		if ok {
+			delete(c.prev, key)
+			c.add(strings.Clone(key), entry)
+		}
+	}
+	if !ok || (c.ttl > 0 && now.After(entry.expires)) {
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// Set caches the value, the key is copied since it may point to the event memory.
+func (c *Cache) Set(key string, value any, now time.Time) {
+	if c.genSize == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(strings.Clone(key), cacheEntry{value: value, expires: now.Add(c.ttl)})
+}
+
+func (c *Cache) add(key string, entry cacheEntry) {
+	if _, ok := c.current[key]; !ok && len(c.current) >= c.genSize {
+		c.prev = c.current
+		c.current = make(map[string]cacheEntry, c.genSize)
+	}
+	c.current[key] = entry
+}
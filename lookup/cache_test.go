@@ -0,0 +1,42 @@
+package lookup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := NewCache(4, time.Minute)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, key, now)
+	}
+	// "a" and "b" are in the previous generation, "a" is used and moved to the current one
+	_, ok := c.Get("a", now)
+	assert.True(t, ok)
+	c.Set("d", "d", now)
+
+	_, ok = c.Get("b", now)
+	assert.False(t, ok, "the least recently used entry is evicted")
+	for _, key := range []string{"a", "c", "d"} {
+		value, ok := c.Get(key, now)
+		assert.True(t, ok, key)
+		assert.Equal(t, key, value)
+	}
+
+	_, ok = c.Get("a", now.Add(2*time.Minute))
+	assert.False(t, ok, "the entry is expired")
+
+	forever := NewCache(4, 0)
+	forever.Set("a", nil, now)
+	value, ok := forever.Get("a", now.Add(time.Hour))
+	assert.True(t, ok, "the entry doesn't expire without the ttl")
+	assert.Nil(t, value)
+
+	disabled := NewCache(0, time.Minute)
+	disabled.Set("a", "a", now)
+	_, ok = disabled.Get("a", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,273 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// source is a loaded file.
+type source interface {
+	Lookup(key string) (any, bool)
+}
+
+// fileProvider looks up the values in the file and reloads it once it's changed.
+type fileProvider struct {
+	config *Config
+	logger *zap.SugaredLogger
+	load   func(data []byte) (source, error)
+
+	source  atomic.Value
+	modTime time.Time
+	size    int64
+
+	stopCh chan struct{}
+}
+
+func newFileProvider(config *Config, logger *zap.SugaredLogger) (*fileProvider, error) {
+	p := &fileProvider{
+		config: config,
+		logger: logger,
+		stopCh: make(chan struct{}),
+	}
+
+	switch config.Type {
+	case TypeCSV:
+		p.load = func(data []byte) (source, error) { return loadCSV(data, config) }
+	case TypeJSON:
+		p.load = func(data []byte) (source, error) { return loadJSON(data, config) }
+	case TypeMMDB:
+		p.load = func(data []byte) (source, error) { return openMMDB(data) }
+	}
+
+	if _, err := p.reload(); err != nil {
+		return nil, err
+	}
+
+	if config.ReloadInterval_ > 0 {
+		go p.watch()
+	}
+
+	return p, nil
+}
+
+func (p *fileProvider) Lookup(key string) (any, bool) {
+	return p.source.Load().(source).Lookup(key)
+}
+
+func (p *fileProvider) stop() {
+	close(p.stopCh)
+}
+
+func (p *fileProvider) watch() {
+	ticker := time.NewTicker(p.config.ReloadInterval_)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+			reloaded, err := p.reload()
+			if err != nil {
+				// the previous version is used until the file is fixed
+				p.logger.Errorf("can't reload lookup file %q: %s", p.config.Path, err.Error())
+				continue
+			}
+			if reloaded {
+				p.logger.Infof("lookup file %q is reloaded", p.config.Path)
+			}
+		}
+	}
+}
+
+// reload loads the file if its modification time or size is changed.
+func (p *fileProvider) reload() (bool, error) {
+	stat, err := os.Stat(p.config.Path)
+	if err != nil {
+		return false, err
+	}
+	if stat.ModTime().Equal(p.modTime) && stat.Size() == p.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(p.config.Path)
+	if err != nil {
+		return false, err
+	}
+	s, err := p.load(data)
+	if err != nil {
+		return false, fmt.Errorf("can't load %s file %q: %w", p.config.Type, p.config.Path, err)
+	}
+
+	p.source.Store(s)
+	p.modTime = stat.ModTime()
+	p.size = stat.Size()
+
+	return true, nil
+}
+
+// table is a loaded csv or json file.
+type table map[string]any
+
+func (t table) Lookup(key string) (any, bool) {
+	value, ok := t[key]
+	return value, ok
+}
+
+// networks matches IP addresses with the most specific network.
+type networks struct {
+	// the masked addresses by the prefix lengths in descending order
+	bits   []int
+	tables map[int]map[netip.Addr]any
+}
+
+func newNetworks(t table) (*networks, error) {
+	n := &networks{tables: make(map[int]map[netip.Addr]any)}
+	for key, value := range t {
+		prefix, err := netip.ParsePrefix(key)
+		if err != nil {
+			// a single address is a network of the full length
+			addr, addrErr := netip.ParseAddr(key)
+			if addrErr != nil {
+				return nil, fmt.Errorf("wrong network %q: %w", key, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefix = canonicalPrefix(prefix)
+
+		bits := prefix.Bits()
+		if _, ok := n.tables[bits]; !ok {
+			n.tables[bits] = make(map[netip.Addr]any)
+			n.bits = append(n.bits, bits)
+		}
+		n.tables[bits][prefix.Addr()] = value
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(n.bits)))
+
+	return n, nil
+}
+
+// canonicalPrefix masks the prefix, IPv4 networks are converted to IPv4-mapped IPv6 ones
+// to match both IPv4 and IPv4-mapped addresses.
+func canonicalPrefix(prefix netip.Prefix) netip.Prefix {
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4() {
+		addr = netip.AddrFrom16(addr.As16())
+		bits += 96
+	}
+	return netip.PrefixFrom(addr, bits).Masked()
+}
+
+func (n *networks) Lookup(key string) (any, bool) {
+	addr, err := netip.ParseAddr(key)
+	if err != nil {
+		return nil, false
+	}
+	if addr.Is4() {
+		addr = netip.AddrFrom16(addr.As16())
+	}
+	addr = addr.WithZone("")
+
+	for _, bits := range n.bits {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if value, ok := n.tables[bits][prefix.Addr()]; ok {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+func indexTable(t table, config *Config) (source, error) {
+	if config.KeyType == KeyTypeCIDR {
+		return newNetworks(t)
+	}
+	return t, nil
+}
+
+// loadCSV loads csv file with the header.
+func loadCSV(data []byte, config *Config) (source, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	delimiter, size := utf8.DecodeRuneInString(config.Delimiter)
+	if size != len(config.Delimiter) || delimiter == utf8.RuneError {
+		return nil, fmt.Errorf("delimiter must be a single character: %q", config.Delimiter)
+	}
+	reader.Comma = delimiter
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("can't read header: %w", err)
+	}
+	header = append([]string(nil), header...)
+
+	keyIdx, valueIdx := 0, -1
+	for i, column := range header {
+		if column == config.KeyColumn {
+			keyIdx = i
+		}
+		if column == config.ValueColumn {
+			valueIdx = i
+		}
+	}
+	if config.KeyColumn != "" && header[keyIdx] != config.KeyColumn {
+		return nil, fmt.Errorf("key column %q isn't found", config.KeyColumn)
+	}
+	if config.ValueColumn != "" && valueIdx == -1 {
+		return nil, fmt.Errorf("value column %q isn't found", config.ValueColumn)
+	}
+
+	t := make(table)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if valueIdx != -1 {
+			t[record[keyIdx]] = record[valueIdx]
+			continue
+		}
+
+		row := make(map[string]any, len(record)-1)
+		for i, value := range record {
+			if i != keyIdx {
+				row[header[i]] = value
+			}
+		}
+		t[record[keyIdx]] = row
+	}
+
+	return indexTable(t, config)
+}
+
+// loadJSON loads json file with an object.
+func loadJSON(data []byte, config *Config) (source, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	t := make(table)
+	if err := decoder.Decode(&t); err != nil {
+		return nil, err
+	}
+
+	return indexTable(t, config)
+}
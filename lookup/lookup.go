@@ -0,0 +1,241 @@
+// Package lookup provides the sources of the values for the enrichment actions:
+// local csv, json and mmdb files which are reloaded on change, redis and http services with caching.
+package lookup
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"go.uber.org/zap"
+)
+
+const (
+	TypeCSV   = "csv"
+	TypeJSON  = "json"
+	TypeMMDB  = "mmdb"
+	TypeRedis = "redis"
+	TypeHTTP  = "http"
+
+	KeyTypeExact = "exact"
+	KeyTypeCIDR  = "cidr"
+
+	RedisValueString = "string"
+	RedisValueHash   = "hash"
+)
+
+// Provider looks up the values by the keys.
+type Provider interface {
+	// Lookup returns the value of the key and false if the key isn't found.
+	// The value is a string, a number or a map[string]any/[]any for the structured values.
+	Lookup(key string) (any, bool)
+	// Stop releases the provider, it's stopped once all the users are released.
+	Stop()
+}
+
+// Config is a config of the provider, it's embedded into the configs of the enrichment actions.
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Type of the provider:
+	// > * `csv` – a csv file with the header, the key column holds the keys
+	// > * `json` – a json file with an object, the fields are the keys
+	// > * `mmdb` – a MaxMind DB file, e.g. GeoIP2 or GeoLite2, the keys are IP addresses
+	// > * `redis` – values of redis keys
+	// > * `http` – responses of http requests
+	Type string `json:"type" required:"true" options:"csv|json|mmdb|redis|http"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path to the file of `csv`, `json` or `mmdb` provider.
+	Path string `json:"path"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How often to check the file modification time, the file is reloaded if it's changed.
+	ReloadInterval  cfg.Duration `json:"reload_interval" parse:"duration" default:"1m"` // *
+	ReloadInterval_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How the keys of `csv` or `json` file are matched:
+	// > * `exact` – the key equals to the looked up value
+	// > * `cidr` – the keys are IP networks like `10.0.0.0/8` and the looked up value is an IP address,
+	// > the most specific network wins
+	KeyType string `json:"key_type" default:"exact" options:"exact|cidr"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Column of `csv` file holding the keys, the first column is used if it's empty.
+	KeyColumn string `json:"key_column"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Column of `csv` file holding the values.
+	// > If it's empty, the value is an object of all the columns except the key one.
+	ValueColumn string `json:"value_column"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Delimiter of `csv` file.
+	Delimiter string `json:"delimiter" default:","` // *
+
+	// > @3@4@5@6
+	// >
+	// > Address of redis server. Format: HOST:PORT.
+	Endpoint string `json:"endpoint"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Password to redis server.
+	Password string `json:"password"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Prefix of redis keys.
+	KeyPrefix string `json:"key_prefix"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Type of redis values:
+	// > * `string` – the value is a string, JSON objects and arrays are decoded
+	// > * `hash` – the value is an object of the hash fields, the empty hash means the key isn't found
+	RedisValue string `json:"redis_value" default:"string" options:"string|hash"` // *
+
+	// > @3@4@5@6
+	// >
+	// > URL of `http` provider, `{key}` is replaced with the escaped key,
+	// > e.g. `http://inventory/hosts?ip={key}`.
+	// > The response body is the value, `404 Not Found` means the key isn't found.
+	URL string `json:"url"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Headers of `http` requests.
+	Headers map[string]string `json:"headers"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of `redis` and `http` requests.
+	Timeout  cfg.Duration `json:"timeout" parse:"duration" default:"1s"` // *
+	Timeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many values of `redis` and `http` providers to cache, zero disables caching.
+	CacheSize int `json:"cache_size" default:"10000"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How long to cache the values of `redis` and `http` providers, including the missing keys.
+	// > Zero means the cached values don't expire.
+	CacheTTL  cfg.Duration `json:"cache_ttl" parse:"duration" default:"1m"` // *
+	CacheTTL_ time.Duration
+}
+
+// the providers are shared by the instances of the action since they can hold big tables
+var (
+	sharedMu        sync.Mutex
+	sharedProviders = make(map[*Config]*sharedProvider)
+)
+
+type sharedProvider struct {
+	provider
+	refs int
+}
+
+// provider is an implementation of the provider type.
+type provider interface {
+	Lookup(key string) (any, bool)
+	stop()
+}
+
+// New returns the provider for the config.
+// The action instances of the same pipeline share the config, so they get the same provider.
+func New(config *Config, logger *zap.SugaredLogger) (Provider, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	if p, ok := sharedProviders[config]; ok {
+		p.refs++
+		return &handle{shared: p, config: config}, nil
+	}
+
+	p, err := newProvider(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	shared := &sharedProvider{provider: p, refs: 1}
+	sharedProviders[config] = shared
+
+	return &handle{shared: shared, config: config}, nil
+}
+
+func newProvider(config *Config, logger *zap.SugaredLogger) (provider, error) {
+	switch config.Type {
+	case TypeCSV, TypeJSON, TypeMMDB:
+		if config.Path == "" {
+			return nil, fmt.Errorf("path isn't set for %s provider", config.Type)
+		}
+		return newFileProvider(config, logger)
+	case TypeRedis:
+		if config.Endpoint == "" {
+			return nil, fmt.Errorf("endpoint isn't set for redis provider")
+		}
+		return newCachedProvider(config, newRedisFetcher(config), logger), nil
+	case TypeHTTP:
+		if config.URL == "" {
+			return nil, fmt.Errorf("url isn't set for http provider")
+		}
+		return newCachedProvider(config, newHTTPFetcher(config), logger), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", config.Type)
+	}
+}
+
+// handle is a reference to the shared provider.
+type handle struct {
+	shared  *sharedProvider
+	config  *Config
+	stopped bool
+}
+
+func (h *handle) Lookup(key string) (any, bool) {
+	return h.shared.Lookup(key)
+}
+
+func (h *handle) Stop() {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	if h.stopped {
+		return
+	}
+	h.stopped = true
+
+	h.shared.refs--
+	if h.shared.refs > 0 {
+		return
+	}
+	delete(sharedProviders, h.config)
+	h.shared.stop()
+}
+
+// decodeValue decodes JSON objects and arrays, other values are kept as strings.
+func decodeValue(s string) any {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return s
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return s
+	}
+	return value
+}
@@ -0,0 +1,143 @@
+package lookup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestProvider(t *testing.T, config *Config) Provider {
+	test.NewConfig(config, nil)
+	p, err := New(config, zap.NewExample().Sugar())
+	require.NoError(t, err)
+	t.Cleanup(p.Stop)
+
+	return p
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.csv")
+	writeFile(t, path, "host;team;env\nweb-1;payments;prod\ndb-1;storage;stage\n")
+
+	p := newTestProvider(t, &Config{Type: TypeCSV, Path: path, Delimiter: ";"})
+	value, ok := p.Lookup("web-1")
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"team": "payments", "env": "prod"}, value)
+	_, ok = p.Lookup("web-2")
+	assert.False(t, ok)
+
+	p = newTestProvider(t, &Config{Type: TypeCSV, Path: path, Delimiter: ";", KeyColumn: "team", ValueColumn: "host"})
+	value, ok = p.Lookup("storage")
+	require.True(t, ok)
+	assert.Equal(t, "db-1", value)
+
+	_, err := New(&Config{Type: TypeCSV, Path: path, Delimiter: ";", KeyColumn: "owner"}, zap.NewExample().Sugar())
+	assert.Error(t, err)
+}
+
+func TestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "levels.json")
+	writeFile(t, path, `{"1":"error","2":{"name":"warn","severity":4}}`)
+
+	p := newTestProvider(t, &Config{Type: TypeJSON, Path: path})
+	value, ok := p.Lookup("1")
+	require.True(t, ok)
+	assert.Equal(t, "error", value)
+	value, ok = p.Lookup("2")
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"name": "warn", "severity": json.Number("4")}, value)
+}
+
+func TestCIDR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "networks.csv")
+	writeFile(t, path, "network,zone\n10.0.0.0/8,internal\n10.1.0.0/16,office\n10.1.2.3,printer\n2001:db8::/32,docs\n")
+
+	p := newTestProvider(t, &Config{Type: TypeCSV, Path: path, KeyType: KeyTypeCIDR, ValueColumn: "zone"})
+	for ip, zone := range map[string]string{
+		"10.200.0.1":       "internal",
+		"10.1.0.1":         "office",
+		"10.1.2.3":         "printer",
+		"::ffff:10.1.2.3":  "printer",
+		"2001:db8:1::1":    "docs",
+		"192.168.0.1":      "",
+		"not ip":           "",
+		"2001:db9::1":      "",
+		"fe80::1%eth0":     "",
+		"2001:db8::1%eth0": "docs",
+	} {
+		value, ok := p.Lookup(ip)
+		assert.Equal(t, zone != "", ok, ip)
+		if ok {
+			assert.Equal(t, zone, value, ip)
+		}
+	}
+
+	writeFile(t, path, "network,zone\n10.0.0.0/88,internal\n")
+	_, err := New(&Config{Type: TypeCSV, Path: path, KeyType: KeyTypeCIDR, Delimiter: ","}, zap.NewExample().Sugar())
+	assert.Error(t, err)
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "levels.json")
+	writeFile(t, path, `{"1":"error"}`)
+
+	p := newTestProvider(t, &Config{Type: TypeJSON, Path: path, ReloadInterval: "10ms"})
+	value, _ := p.Lookup("1")
+	assert.Equal(t, "error", value)
+
+	// the broken file is ignored
+	writeFile(t, path, `{"1":`)
+	time.Sleep(50 * time.Millisecond)
+	value, _ = p.Lookup("1")
+	assert.Equal(t, "error", value)
+
+	writeFile(t, path, `{"1":"critical"}`)
+	assert.Eventually(t, func() bool {
+		value, _ := p.Lookup("1")
+		return value == "critical"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "levels.json")
+	writeFile(t, path, `{"1":"error"}`)
+
+	config := &Config{Type: TypeJSON, Path: path}
+	first := newTestProvider(t, config)
+	second, err := New(config, zap.NewExample().Sugar())
+	require.NoError(t, err)
+	assert.Equal(t, first.(*handle).shared, second.(*handle).shared)
+
+	first.Stop()
+	first.Stop()
+	_, ok := second.Lookup("1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, sharedProviders[config].refs)
+
+	second.Stop()
+	assert.NotContains(t, sharedProviders, config)
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, config := range []*Config{
+		{Type: TypeCSV},
+		{Type: TypeJSON, Path: "/not/exists.json"},
+		{Type: TypeRedis},
+		{Type: TypeHTTP},
+		{Type: "ldap"},
+	} {
+		_, err := New(config, zap.NewExample().Sugar())
+		assert.Error(t, err, config.Type)
+	}
+}
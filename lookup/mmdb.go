@@ -0,0 +1,339 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+)
+
+// A reader of MaxMind DB files:
+// https://maxmind.github.io/MaxMind-DB/
+
+const (
+	mmdbMetadataMaxSize  = 128 * 1024
+	mmdbDataSeparator    = 16
+	mmdbMaxDecodingDepth = 64
+
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+)
+
+var (
+	mmdbMetadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+	errMMDBMalformed = errors.New("malformed mmdb")
+)
+
+type mmdb struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// the node to start IPv4 lookups from in IPv6 database
+	ipv4Start uint
+}
+
+func openMMDB(buf []byte) (*mmdb, error) {
+	metaStart := bytes.LastIndex(buf, mmdbMetadataStart)
+	if metaStart == -1 || len(buf)-metaStart > mmdbMetadataMaxSize {
+		return nil, fmt.Errorf("%w: metadata isn't found", errMMDBMalformed)
+	}
+
+	meta := buf[metaStart+len(mmdbMetadataStart):]
+	value, _, err := (&mmdbDecoder{data: meta}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata isn't a map", errMMDBMalformed)
+	}
+
+	db := &mmdb{
+		nodeCount:  metaUint(metadata["node_count"]),
+		recordSize: metaUint(metadata["record_size"]),
+		ipVersion:  metaUint(metadata["ip_version"]),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", errMMDBMalformed, db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", errMMDBMalformed, db.ipVersion)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+mmdbDataSeparator > uint(metaStart) {
+		return nil, fmt.Errorf("%w: search tree is too big", errMMDBMalformed)
+	}
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+mmdbDataSeparator : metaStart]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+func metaUint(v any) uint {
+	switch n := v.(type) {
+	case uint64:
+		return uint(n)
+	case uint32:
+		return uint(n)
+	case uint16:
+		return uint(n)
+	default:
+		return 0
+	}
+}
+
+// record returns the left (bit is 0) or the right (bit is 1) record of the node.
+func (db *mmdb) record(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := db.tree[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := db.tree[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.tree[off : off+4]))
+	}
+}
+
+// Lookup returns the record of the network containing the IP address.
+func (db *mmdb) Lookup(key string) (any, bool) {
+	addr, err := netip.ParseAddr(key)
+	if err != nil {
+		return nil, false
+	}
+	addr = addr.Unmap()
+
+	var ip []byte
+	node := uint(0)
+	if addr.Is4() {
+		a := addr.As4()
+		ip = a[:]
+		node = db.ipv4Start
+	} else {
+		if db.ipVersion == 4 {
+			return nil, false
+		}
+		a := addr.As16()
+		ip = a[:]
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return nil, false
+	}
+
+	offset := node - db.nodeCount - mmdbDataSeparator
+	value, _, err := (&mmdbDecoder{data: db.data}).decode(offset, 0)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+type mmdbDecoder struct {
+	data []byte
+}
+
+func (d *mmdbDecoder) bytes(offset, size uint) ([]byte, error) {
+	if offset+size > uint(len(d.data)) || offset+size < offset {
+		return nil, fmt.Errorf("%w: offset %d is out of the data", errMMDBMalformed, offset+size)
+	}
+	return d.data[offset : offset+size], nil
+}
+
+func (d *mmdbDecoder) uint(offset, size uint) (uint64, error) {
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return 0, err
+	}
+	if size > 8 {
+		return 0, fmt.Errorf("%w: uint size %d", errMMDBMalformed, size)
+	}
+
+	v := uint64(0)
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// decode decodes the value at the offset and returns the offset following the value.
+func (d *mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDecodingDepth {
+		return nil, 0, fmt.Errorf("%w: too deep data", errMMDBMalformed)
+	}
+
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+
+	typ := uint(ctrl[0] >> 5)
+	if typ == mmdbPointer {
+		pointer, next, err := d.pointer(ctrl[0], offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if typ == mmdbExtended {
+		ext, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset++
+		typ = 7 + uint(ext[0])
+	}
+
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		extSize := size - 28
+		v, err := d.uint(offset, extSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += extSize
+		switch size {
+		case 29:
+			size = 29 + uint(v)
+		case 30:
+			size = 285 + uint(v)
+		default:
+			size = 65821 + uint(v)
+		}
+	}
+
+	switch typ {
+	case mmdbString:
+		b, err := d.bytes(offset, size)
+		return string(b), offset + size, err
+	case mmdbBytes:
+		b, err := d.bytes(offset, size)
+		return append([]byte(nil), b...), offset + size, err
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double size %d", errMMDBMalformed, size)
+		}
+		v, err := d.uint(offset, size)
+		return math.Float64frombits(v), offset + size, err
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float size %d", errMMDBMalformed, size)
+		}
+		v, err := d.uint(offset, size)
+		return float64(math.Float32frombits(uint32(v))), offset + size, err
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		v, err := d.uint(offset, size)
+		return v, offset + size, err
+	case mmdbInt32:
+		v, err := d.uint(offset, size)
+		return int64(int32(uint32(v))), offset + size, err
+	case mmdbUint128:
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return new(big.Int).SetBytes(b).String(), offset + size, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key isn't a string", errMMDBMalformed)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", errMMDBMalformed, typ)
+	}
+}
+
+// pointer decodes the pointer to the data section, the pointer size is set in the control byte.
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl>>3)&3 + 1
+	v, err := d.uint(offset, size)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	prefix := uint(ctrl & 7)
+	var pointer uint
+	switch size {
+	case 1:
+		pointer = prefix<<8 | uint(v)
+	case 2:
+		pointer = (prefix<<16 | uint(v)) + 2048
+	case 3:
+		pointer = (prefix<<24 | uint(v)) + 526336
+	default:
+		pointer = uint(v)
+	}
+
+	return pointer, offset + size, nil
+}
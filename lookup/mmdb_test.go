@@ -0,0 +1,265 @@
+package lookup
+
+import (
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbWriter builds MaxMind DB files with 24 bit records for the tests.
+type mmdbWriter struct {
+	ipVersion int
+	// records of the nodes, the child node or the data offset
+	nodes [][2]mmdbRecord
+	data  []byte
+}
+
+type mmdbRecord struct {
+	child int
+	data  int
+}
+
+func newMMDBWriter(ipVersion int) *mmdbWriter {
+	return &mmdbWriter{ipVersion: ipVersion, nodes: [][2]mmdbRecord{{{data: -1}, {data: -1}}}}
+}
+
+// insert inserts the network with the data at the offset, the less specific networks must be inserted first.
+func (w *mmdbWriter) insert(network string, offset int) {
+	prefix := netip.MustParsePrefix(network)
+	addr, bits := prefix.Addr(), prefix.Bits()
+	var ip []byte
+	if w.ipVersion == 6 {
+		a := addr.As16()
+		ip = a[:]
+		if addr.Is4() {
+			// IPv4 networks are in ::/96 subtree
+			a4 := addr.As4()
+			ip = append(make([]byte, 12), a4[:]...)
+			bits += 96
+		}
+	} else {
+		a := addr.As4()
+		ip = a[:]
+	}
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			w.nodes[node][bit].data = offset
+			break
+		}
+		if w.nodes[node][bit].child == 0 {
+			// the data of the less specific network is pushed down
+			parentData := w.nodes[node][bit].data
+			w.nodes = append(w.nodes, [2]mmdbRecord{{data: parentData}, {data: parentData}})
+			w.nodes[node][bit].child = len(w.nodes) - 1
+		}
+		node = w.nodes[node][bit].child
+	}
+}
+
+// add appends the value to the data section and returns its offset.
+func (w *mmdbWriter) add(value any) int {
+	offset := len(w.data)
+	w.data = appendMMDBValue(w.data, value)
+	return offset
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	nodeCount := len(w.nodes)
+	var buf []byte
+	for _, node := range w.nodes {
+		for _, r := range node {
+			v := nodeCount
+			switch {
+			case r.child != 0:
+				v = r.child
+			case r.data != -1:
+				v = nodeCount + mmdbDataSeparator + r.data
+			}
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	buf = append(buf, make([]byte, mmdbDataSeparator)...)
+	buf = append(buf, w.data...)
+	buf = append(buf, mmdbMetadataStart...)
+
+	return appendMMDBValue(buf, map[string]any{
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(24),
+		"ip_version":    uint16(w.ipVersion),
+		"database_type": "test",
+	})
+}
+
+type mmdbPointerValue int
+
+func appendMMDBCtrl(buf []byte, typ int, size int) []byte {
+	first := byte(0)
+	var ext []byte
+	if typ <= 7 {
+		first = byte(typ << 5)
+	} else {
+		ext = []byte{byte(typ - 7)}
+	}
+
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		first |= byte(size)
+	case size < 285:
+		first |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		first |= 30
+		sizeBytes = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		first |= 31
+		v := size - 65821
+		sizeBytes = []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+
+	buf = append(buf, first)
+	buf = append(buf, ext...)
+	return append(buf, sizeBytes...)
+}
+
+func appendMMDBUint(buf []byte, typ int, v uint64) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	buf = appendMMDBCtrl(buf, typ, len(b))
+	return append(buf, b...)
+}
+
+func appendMMDBValue(buf []byte, value any) []byte {
+	switch v := value.(type) {
+	case string:
+		buf = appendMMDBCtrl(buf, mmdbString, len(v))
+		return append(buf, v...)
+	case uint16:
+		return appendMMDBUint(buf, mmdbUint16, uint64(v))
+	case uint32:
+		return appendMMDBUint(buf, mmdbUint32, uint64(v))
+	case uint64:
+		return appendMMDBUint(buf, mmdbUint64, v)
+	case int32:
+		buf = appendMMDBCtrl(buf, mmdbInt32, 4)
+		return binary.BigEndian.AppendUint32(buf, uint32(v))
+	case float64:
+		buf = appendMMDBCtrl(buf, mmdbDouble, 8)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+	case bool:
+		if v {
+			return appendMMDBCtrl(buf, mmdbBool, 1)
+		}
+		return appendMMDBCtrl(buf, mmdbBool, 0)
+	case []any:
+		buf = appendMMDBCtrl(buf, mmdbArray, len(v))
+		for _, item := range v {
+			buf = appendMMDBValue(buf, item)
+		}
+		return buf
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf = appendMMDBCtrl(buf, mmdbMap, len(v))
+		for _, k := range keys {
+			buf = appendMMDBValue(buf, k)
+			buf = appendMMDBValue(buf, v[k])
+		}
+		return buf
+	case mmdbPointerValue:
+		if v < 2048 {
+			return append(buf, byte(mmdbPointer<<5|(v>>8)&7), byte(v))
+		}
+		p := int(v) - 2048
+		return append(buf, byte(mmdbPointer<<5|1<<3|(p>>16)&7), byte(p>>8), byte(p))
+	default:
+		panic("unsupported type")
+	}
+}
+
+func TestMMDB(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		w := newMMDBWriter(ipVersion)
+		// the name is long enough to have the extended size
+		longName := "Moscow" + string(make([]byte, 300))
+		moscow := w.add(map[string]any{
+			"city":     map[string]any{"names": map[string]any{"en": longName}},
+			"location": map[string]any{"latitude": 55.75, "longitude": 37.62, "accuracy_radius": uint16(20)},
+			"asn":      uint32(8359),
+			"offset":   int32(-3),
+			"flags":    []any{true, false},
+			"big":      uint64(1 << 40),
+		})
+		pointer := w.add(mmdbPointerValue(moscow))
+		// the padding makes the next pointer longer
+		w.data = append(w.data, make([]byte, 3000)...)
+		other := w.add(map[string]any{"city": "Kazan"})
+		otherPointer := w.add(mmdbPointerValue(other))
+
+		w.insert("10.0.0.0/8", otherPointer)
+		w.insert("10.1.0.0/16", pointer)
+		w.insert("192.168.1.0/24", moscow)
+		if ipVersion == 6 {
+			w.insert("2001:db8::/32", other)
+		}
+
+		db, err := openMMDB(w.bytes())
+		require.NoError(t, err)
+
+		value, ok := db.Lookup("192.168.1.15")
+		require.True(t, ok)
+		record := value.(map[string]any)
+		assert.Equal(t, longName, record["city"].(map[string]any)["names"].(map[string]any)["en"])
+		assert.Equal(t, map[string]any{"latitude": 55.75, "longitude": 37.62, "accuracy_radius": uint64(20)}, record["location"])
+		assert.Equal(t, uint64(8359), record["asn"])
+		assert.Equal(t, int64(-3), record["offset"])
+		assert.Equal(t, []any{true, false}, record["flags"])
+		assert.Equal(t, uint64(1<<40), record["big"])
+
+		// the most specific network wins
+		value, ok = db.Lookup("10.1.2.3")
+		require.True(t, ok)
+		assert.Equal(t, uint64(8359), value.(map[string]any)["asn"])
+
+		value, ok = db.Lookup("10.2.0.1")
+		require.True(t, ok)
+		assert.Equal(t, map[string]any{"city": "Kazan"}, value)
+
+		_, ok = db.Lookup("192.168.2.1")
+		assert.False(t, ok)
+		_, ok = db.Lookup("not ip")
+		assert.False(t, ok)
+
+		value, ok = db.Lookup("2001:db8::1")
+		assert.Equal(t, ipVersion == 6, ok)
+		if ok {
+			assert.Equal(t, map[string]any{"city": "Kazan"}, value)
+		}
+	}
+}
+
+func TestMMDBMalformed(t *testing.T) {
+	_, err := openMMDB([]byte("not a database"))
+	assert.ErrorIs(t, err, errMMDBMalformed)
+
+	w := newMMDBWriter(4)
+	w.insert("10.0.0.0/8", 100)
+	db, err := openMMDB(w.bytes())
+	require.NoError(t, err)
+	// the data offset is out of the data section
+	_, ok := db.Lookup("10.0.0.1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,216 @@
+package lookup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+)
+
+const maxResponseSize = 1024 * 1024
+
+// fetcher gets the value from the remote service.
+type fetcher interface {
+	fetch(key string) (any, bool, error)
+	close()
+}
+
+// cachedProvider looks up the values in the remote service and caches them.
+type cachedProvider struct {
+	fetcher fetcher
+	cache   *Cache
+	logger  *zap.SugaredLogger
+}
+
+// fetched is the cached result of the fetch.
+type fetched struct {
+	value any
+	found bool
+}
+
+func newCachedProvider(config *Config, fetcher fetcher, logger *zap.SugaredLogger) *cachedProvider {
+	return &cachedProvider{
+		fetcher: fetcher,
+		cache:   NewCache(config.CacheSize, config.CacheTTL_),
+		logger:  logger,
+	}
+}
+
+func (p *cachedProvider) Lookup(key string) (any, bool) {
+	now := time.Now()
+	if cached, ok := p.cache.Get(key, now); ok {
+		result := cached.(fetched)
+		return result.value, result.found
+	}
+
+	value, found, err := p.fetcher.fetch(key)
+	if err != nil {
+		// errors aren't cached to retry on the next event
+		p.logger.Errorf("can't lookup key %q: %s", key, err.Error())
+		return nil, false
+	}
+	p.cache.Set(key, fetched{value: value, found: found}, now)
+
+	return value, found
+}
+
+func (p *cachedProvider) stop() {
+	p.fetcher.close()
+}
+
+// redisFetcher gets the values of the keys with the prefix.
+type redisFetcher struct {
+	client *redis.Client
+	prefix string
+	hash   bool
+}
+
+func newRedisFetcher(config *Config) *redisFetcher {
+	return &redisFetcher{
+		client: redis.NewClient(&redis.Options{
+			Network:      "tcp",
+			Addr:         config.Endpoint,
+			Password:     config.Password,
+			DialTimeout:  config.Timeout_,
+			ReadTimeout:  config.Timeout_,
+			WriteTimeout: config.Timeout_,
+		}),
+		prefix: config.KeyPrefix,
+		hash:   config.RedisValue == RedisValueHash,
+	}
+}
+
+func (f *redisFetcher) fetch(key string) (any, bool, error) {
+	if f.hash {
+		return f.fetchHash(key)
+	}
+
+	value, err := f.client.Get(f.prefix + key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return decodeValue(value), true, nil
+}
+
+func (f *redisFetcher) fetchHash(key string) (any, bool, error) {
+	fields, err := f.client.HGetAll(f.prefix + key).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(fields) == 0 {
+		return nil, false, nil
+	}
+
+	value := make(map[string]any, len(fields))
+	for k, v := range fields {
+		value[k] = v
+	}
+	return value, true, nil
+}
+
+func (f *redisFetcher) close() {
+	_ = f.client.Close()
+}
+
+// httpFetcher gets the values with GET requests.
+type httpFetcher struct {
+	client *HTTPClient
+	url    string
+}
+
+func newHTTPFetcher(config *Config) *httpFetcher {
+	return &httpFetcher{
+		client: NewHTTPClient(config.Headers, config.Timeout_),
+		url:    config.URL,
+	}
+}
+
+func (f *httpFetcher) fetch(key string) (any, bool, error) {
+	u := strings.ReplaceAll(f.url, "{key}", url.QueryEscape(key))
+	body, found, err := f.client.Do(http.MethodGet, u, nil)
+	if err != nil || !found {
+		return nil, false, err
+	}
+
+	return decodeValue(string(body)), true, nil
+}
+
+func (f *httpFetcher) close() {
+	f.client.Close()
+}
+
+// HTTPClient sends the lookup requests: the body of the successful response is the value
+// and `404 Not Found` means the key isn't found. It's used by the http provider
+// and by the actions building the requests from the events.
+type HTTPClient struct {
+	client  *http.Client
+	headers map[string]string
+	timeout time.Duration
+}
+
+func NewHTTPClient(headers map[string]string, timeout time.Duration) *HTTPClient {
+	return &HTTPClient{
+		client:  &http.Client{},
+		headers: headers,
+		timeout: timeout,
+	}
+}
+
+// Do sends the request and returns the response body and false if the key isn't found.
+// The body is sent as JSON if it isn't nil.
+func (c *HTTPClient) Do(method, url string, body []byte) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, false, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return respBody, true, nil
+	default:
+		return nil, false, fmt.Errorf("bad response: %s: %s", resp.Status, respBody)
+	}
+}
+
+// Close closes the idle connections.
+func (c *HTTPClient) Close() {
+	c.client.CloseIdleConnections()
+}
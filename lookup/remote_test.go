@@ -0,0 +1,94 @@
+package lookup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	s := miniredis.RunT(t)
+	require.NoError(t, s.Set("hosts:web-1", `{"team":"payments"}`))
+	require.NoError(t, s.Set("hosts:web-2", "storage"))
+
+	p := newTestProvider(t, &Config{Type: TypeRedis, Endpoint: s.Addr(), KeyPrefix: "hosts:"})
+	value, ok := p.Lookup("web-1")
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"team": "payments"}, value)
+	value, ok = p.Lookup("web-2")
+	require.True(t, ok)
+	assert.Equal(t, "storage", value)
+	_, ok = p.Lookup("web-3")
+	assert.False(t, ok)
+
+	// the values are cached
+	s.Del("hosts:web-2")
+	value, ok = p.Lookup("web-2")
+	require.True(t, ok)
+	assert.Equal(t, "storage", value)
+}
+
+func TestRedisHash(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.HSet("hosts:web-1", "team", "payments", "dc", "eu")
+
+	p := newTestProvider(t, &Config{Type: TypeRedis, Endpoint: s.Addr(), KeyPrefix: "hosts:", RedisValue: RedisValueHash})
+	value, ok := p.Lookup("web-1")
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"team": "payments", "dc": "eu"}, value)
+	_, ok = p.Lookup("web-2")
+	assert.False(t, ok)
+}
+
+func TestHTTP(t *testing.T) {
+	requests := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Query().Get("ip") {
+		case "10.0.0.1":
+			_, _ = w.Write([]byte(`{"host":"web-1"}`))
+		case "10.0.0.2":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	p := newTestProvider(t, &Config{
+		Type:     TypeHTTP,
+		URL:      server.URL + "/hosts?ip={key}",
+		Headers:  map[string]string{"Authorization": "secret"},
+		CacheTTL: "50ms",
+	})
+
+	for i := 0; i < 2; i++ {
+		value, ok := p.Lookup("10.0.0.1")
+		require.True(t, ok)
+		assert.Equal(t, map[string]any{"host": "web-1"}, value)
+		_, ok = p.Lookup("10.0.0.2")
+		assert.False(t, ok)
+	}
+	assert.Equal(t, int32(2), requests.Load(), "found and missing keys are cached")
+
+	// errors aren't cached
+	_, ok := p.Lookup("10.0.0.3")
+	assert.False(t, ok)
+	_, ok = p.Lookup("10.0.0.3")
+	assert.False(t, ok)
+	assert.Equal(t, int32(4), requests.Load())
+
+	time.Sleep(100 * time.Millisecond)
+	p.Lookup("10.0.0.1")
+	assert.Equal(t, int32(5), requests.Load(), "cached value is expired")
+}
@@ -12,6 +12,7 @@ type Ctl struct {
 	subsystem string
 	counters  map[string]*prom.CounterVec
 	gauges    map[string]*prom.GaugeVec
+	hists     map[string]*prom.HistogramVec
 }
 
 func New(subsystem string) *Ctl {
@@ -19,6 +20,7 @@ func New(subsystem string) *Ctl {
 		subsystem: subsystem,
 		counters:  make(map[string]*prom.CounterVec),
 		gauges:    make(map[string]*prom.GaugeVec),
+		hists:     make(map[string]*prom.HistogramVec),
 	}
 	return ctl
 }
@@ -58,3 +60,22 @@ func (mc *Ctl) RegisterGauge(name, help string, labels ...string) *prom.GaugeVec
 	prom.DefaultRegisterer.MustRegister(promGauge)
 	return promGauge
 }
+
+func (mc *Ctl) RegisterHistogram(name, help string, buckets []float64, labels ...string) *prom.HistogramVec {
+	if metric, hasHist := mc.hists[name]; hasHist {
+		return metric
+	}
+
+	promHist := prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: PromNamespace,
+		Subsystem: mc.subsystem,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}, labels)
+
+	mc.hists[name] = promHist
+	prom.DefaultRegisterer.Unregister(promHist)
+	prom.DefaultRegisterer.MustRegister(promHist)
+	return promHist
+}
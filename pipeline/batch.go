@@ -22,6 +22,9 @@ type Batch struct {
 	maxSizeCount int
 	// maxSizeBytes max size of events per batch in bytes
 	maxSizeBytes int
+
+	// fallback is true if the events should be passed to the fallback output instead of committing
+	fallback bool
 }
 
 func newBatch(maxSizeCount int, maxSizeBytes int, timeout time.Duration) *Batch {
@@ -47,6 +50,7 @@ func (b *Batch) reset() {
 	b.Events = b.Events[:0]
 	b.eventsSize = 0
 	b.startTime = time.Now()
+	b.fallback = false
 }
 
 func (b *Batch) append(e *Event) {
@@ -154,7 +158,11 @@ func (b *Batcher) commitBatch(ctx context.Context, events []*Event, batch *Batch
 	b.commitSeq++
 
 	for _, e := range events {
-		b.opts.Controller.Commit(e)
+		if batch.fallback {
+			b.opts.Controller.Fallback(e)
+		} else {
+			b.opts.Controller.Commit(e)
+		}
 	}
 
 	b.cond.Broadcast()
@@ -165,6 +173,17 @@ func (b *Batcher) commitBatch(ctx context.Context, events []*Event, batch *Batch
 	return events
 }
 
+// Fallback makes the batch events to be passed to the fallback output after OutFn returns.
+// It returns false if the output doesn't have the fallback output, so the output should handle the failure itself.
+func (b *Batcher) Fallback(batch *Batch) bool {
+	if !b.opts.Controller.HasFallback() {
+		return false
+	}
+
+	batch.fallback = true
+	return true
+}
+
 func (b *Batcher) heartbeat() {
 	for {
 		if b.shouldStop.Load() {
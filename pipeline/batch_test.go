@@ -12,7 +12,8 @@ import (
 )
 
 type batcherTail struct {
-	commit func(event *Event)
+	commit   func(event *Event)
+	fallback func(event *Event) // nil if the output doesn't have the fallback
 }
 
 func (b *batcherTail) Commit(event *Event) {
@@ -23,6 +24,14 @@ func (b *batcherTail) Error(err string) {
 	logger.Panic(err)
 }
 
+func (b *batcherTail) HasFallback() bool {
+	return b.fallback != nil
+}
+
+func (b *batcherTail) Fallback(event *Event) {
+	b.fallback(event)
+}
+
 func (b *batcherTail) RecoverFromPanic() {}
 
 func TestBatcher(t *testing.T) {
@@ -162,3 +171,63 @@ func TestBatcherMaxSize(t *testing.T) {
 	assert.Equal(t, int32(eventCount), commitsCount.Load(), "wrong commits count")
 	assert.Equal(t, int32(eventCount/(batchSize/eventSize)), batchCount.Load(), "wrong batches count")
 }
+
+func TestBatcherFallback(t *testing.T) {
+	eventCount := 1000
+	batchSize := 10
+
+	wg := sync.WaitGroup{}
+	wg.Add(eventCount)
+
+	var batcher *Batcher
+	batcherOut := func(_ *WorkerData, batch *Batch) {
+		// fail every odd batch
+		if batch.Events[0].SeqID/uint64(batchSize)%2 == 1 {
+			assert.True(t, batcher.Fallback(batch))
+		}
+	}
+
+	commitsCount := atomic.Int32{}
+	fallbackCount := atomic.Int32{}
+	tail := &batcherTail{
+		commit: func(event *Event) {
+			assert.Equal(t, uint64(0), event.SeqID/uint64(batchSize)%2, "failed event is committed")
+			commitsCount.Inc()
+			wg.Done()
+		},
+		fallback: func(event *Event) {
+			assert.Equal(t, uint64(1), event.SeqID/uint64(batchSize)%2, "sent event is passed to the fallback")
+			fallbackCount.Inc()
+			wg.Done()
+		},
+	}
+
+	batcher = NewBatcher(BatcherOptions{
+		PipelineName:   "test",
+		OutputType:     "devnull",
+		OutFn:          batcherOut,
+		Controller:     tail,
+		Workers:        1,
+		BatchSizeCount: batchSize,
+		FlushTimeout:   time.Second,
+	})
+	batcher.Start(context.Background())
+
+	for i := 0; i < eventCount; i++ {
+		batcher.Add(&Event{SeqID: uint64(i)})
+	}
+
+	wg.Wait()
+	batcher.Stop()
+
+	assert.Equal(t, int32(eventCount/2), commitsCount.Load(), "wrong commits count")
+	assert.Equal(t, int32(eventCount/2), fallbackCount.Load(), "wrong fallback events count")
+}
+
+func TestBatcherNoFallback(t *testing.T) {
+	batcher := NewBatcher(BatcherOptions{Controller: &batcherTail{}})
+	batch := newBatch(1, 0, time.Second)
+
+	assert.False(t, batcher.Fallback(batch))
+	assert.False(t, batch.fallback)
+}
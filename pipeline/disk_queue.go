@@ -0,0 +1,544 @@
+package pipeline
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/longpanic"
+	"github.com/ozontech/file.d/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	diskQueueFsyncAlways   = "always"
+	diskQueueFsyncInterval = "interval"
+	diskQueueFsyncNever    = "never"
+
+	diskQueueSegmentExt = ".seg"
+	diskQueueAckFile    = "ack"
+
+	// record is the payload length and the CRC-32C of the payload followed by the payload
+	diskQueueHeaderSize = 8
+
+	diskQueueMaintenanceInterval = time.Second
+)
+
+var diskQueueCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DiskQueueConfig is the config of the write-ahead queue between the pipeline and the output.
+type DiskQueueConfig struct {
+	// Dir is the directory of the queue segments, every output must have its own directory.
+	Dir string `json:"dir" required:"true"`
+
+	// MaxSize is the disk budget of the queue, the pipeline is blocked when it's exceeded.
+	MaxSize  string `json:"max_size" default:"1 GiB" parse:"data_unit"`
+	MaxSize_ uint64
+
+	// SegmentSize is the size of the segment files, acknowledged segments are removed.
+	SegmentSize  string `json:"segment_size" default:"64 MiB" parse:"data_unit"`
+	SegmentSize_ uint64
+
+	// Fsync is the policy of syncing the segments to the disk.
+	Fsync string `json:"fsync" default:"interval" options:"always|interval|never"`
+
+	// FsyncInterval is the interval of the syncs for the interval policy.
+	FsyncInterval  cfg.Duration `json:"fsync_interval" default:"1s" parse:"duration"`
+	FsyncInterval_ time.Duration
+}
+
+// diskQueuePos is the position of the record end in the queue.
+type diskQueuePos struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+type diskQueueSegment struct {
+	id   uint64
+	size int64
+}
+
+// diskQueue writes events passed to the output into the segment files and commits them at once,
+// the events are replayed from the segments to the output and the segments are removed once the output commits them.
+// So the pipeline keeps accepting events while the output is down until the disk budget is exceeded.
+// The position of the last committed record is saved, so not committed records are replayed after the restart.
+type diskQueue struct {
+	outputType string
+	config     *DiskQueueConfig
+	output     OutputPlugin
+	controller OutputPluginController
+	logger     *zap.SugaredLogger
+
+	mu *sync.Mutex
+	// cond is signaled when records are written or committed and when the queue is stopped
+	cond    *sync.Cond
+	stopped bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+
+	// segments are sorted by id, the last one is written
+	segments []*diskQueueSegment
+	size     uint64
+	writer   *os.File
+	buf      []byte
+
+	readPos  diskQueuePos
+	ackPos   diskQueuePos
+	savedAck diskQueuePos
+	// pending are the end positions of the records passed to the output by seq
+	pending   map[uint64]diskQueuePos
+	committed map[uint64]bool
+	nextSeq   uint64
+	ackSeq    uint64
+
+	// events are free events to replay, their count limits the events in processing of the output
+	events chan *Event
+
+	sizeMetric      prometheus.Gauge
+	corruptedMetric prometheus.Counter
+}
+
+func newDiskQueue(outputType string, config *DiskQueueConfig, output OutputPlugin) *diskQueue {
+	q := &diskQueue{
+		outputType: outputType,
+		config:     config,
+		output:     output,
+		mu:         &sync.Mutex{},
+		stopCh:     make(chan struct{}),
+		pending:    make(map[uint64]diskQueuePos),
+		committed:  make(map[uint64]bool),
+	}
+	q.cond = sync.NewCond(q.mu)
+
+	return q
+}
+
+func (q *diskQueue) Start(config AnyConfig, params *OutputPluginParams) {
+	q.controller = params.Controller
+	q.logger = params.Logger.Named("disk queue")
+
+	if err := q.open(); err != nil {
+		q.logger.Fatalf("can't open disk queue in %s: %s", q.config.Dir, err.Error())
+	}
+	q.logger.Infof("disk queue is opened, segments=%d, size=%d", len(q.segments), q.size)
+
+	q.events = make(chan *Event, params.PipelineSettings.Capacity)
+	for i := 0; i < params.PipelineSettings.Capacity; i++ {
+		q.events <- newEvent()
+	}
+
+	q.output.Start(config, &OutputPluginParams{
+		PluginDefaultParams: params.PluginDefaultParams,
+		Controller:          q,
+		Logger:              params.Logger,
+	})
+
+	q.wg.Add(2)
+	longpanic.Go(q.replay)
+	longpanic.Go(q.maintenance)
+}
+
+// Stop stops the output and saves the position of the committed records.
+// Events in processing of the output are replayed after the restart.
+func (q *diskQueue) Stop() {
+	q.mu.Lock()
+	q.stopped = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	close(q.stopCh)
+	// the output is stopped first since the replay may be blocked in the output under backpressure
+	q.output.Stop()
+	q.wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closeWriter()
+	if err := q.saveAck(); err != nil {
+		q.logger.Errorf("can't save disk queue position: %s", err.Error())
+	}
+}
+
+func (q *diskQueue) RegisterMetrics(ctl *metric.Ctl) {
+	q.output.RegisterMetrics(ctl)
+
+	q.sizeMetric = ctl.RegisterGauge("output_disk_queue_size", "Size of the disk queue segments in bytes", "output").WithLabelValues(q.outputType)
+	q.corruptedMetric = ctl.RegisterCounter("output_disk_queue_corrupted_records", "Count of the disk queue records skipped because of corruption", "output").WithLabelValues(q.outputType)
+}
+
+// Out writes the event into the queue and commits it, it blocks while the queue exceeds the max size.
+func (q *diskQueue) Out(event *Event) {
+	q.mu.Lock()
+	for !q.stopped && q.size >= q.config.MaxSize_ {
+		q.cond.Wait()
+	}
+	// the event isn't committed, so it will be read by the input again
+	if q.stopped {
+		q.mu.Unlock()
+		return
+	}
+
+	q.buf = append(q.buf[:0], make([]byte, diskQueueHeaderSize)...)
+	q.buf = event.Root.Encode(q.buf)
+	payload := q.buf[diskQueueHeaderSize:]
+	binary.LittleEndian.PutUint32(q.buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(q.buf[4:8], crc32.Checksum(payload, diskQueueCRCTable))
+	q.write()
+	q.mu.Unlock()
+
+	q.controller.Commit(event)
+}
+
+// Commit marks the replayed event as committed and removes the segments committed completely.
+func (q *diskQueue) Commit(event *Event) {
+	q.mu.Lock()
+	q.committed[event.SeqID] = true
+	for q.committed[q.ackSeq] {
+		q.ackPos = q.pending[q.ackSeq]
+		delete(q.committed, q.ackSeq)
+		delete(q.pending, q.ackSeq)
+		q.ackSeq++
+	}
+	q.removeAcked()
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.events <- event
+}
+
+func (q *diskQueue) Error(err string) {
+	q.controller.Error(err)
+}
+
+func (q *diskQueue) HasFallback() bool {
+	return false
+}
+
+func (q *diskQueue) Fallback(_ *Event) {
+	q.logger.Panicf("output with disk queue doesn't have the fallback output")
+}
+
+// open loads the segments and the position of the committed records and creates the segment to write.
+func (q *diskQueue) open() error {
+	if err := os.MkdirAll(q.config.Dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(q.config.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, diskQueueSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, diskQueueSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, &diskQueueSegment{id: id, size: info.Size()})
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].id < q.segments[j].id })
+
+	nextID := uint64(0)
+	if len(q.segments) > 0 {
+		nextID = q.segments[len(q.segments)-1].id + 1
+	}
+
+	data, err := os.ReadFile(filepath.Join(q.config.Dir, diskQueueAckFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &q.ackPos); err != nil {
+			return fmt.Errorf("can't parse position: %w", err)
+		}
+		if q.ackPos.Segment >= nextID {
+			nextID = q.ackPos.Segment + 1
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	q.savedAck = q.ackPos
+	q.readPos = q.ackPos
+	if err := q.createSegment(nextID); err != nil {
+		return err
+	}
+
+	for _, segment := range q.segments {
+		q.size += uint64(segment.size)
+	}
+	q.removeAcked()
+
+	return nil
+}
+
+func (q *diskQueue) segmentPath(id uint64) string {
+	return filepath.Join(q.config.Dir, fmt.Sprintf("%020d%s", id, diskQueueSegmentExt))
+}
+
+func (q *diskQueue) createSegment(id uint64) error {
+	file, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	q.writer = file
+	q.segments = append(q.segments, &diskQueueSegment{id: id})
+	return nil
+}
+
+// write appends the record of the buf to the last segment, mu should be locked.
+func (q *diskQueue) write() {
+	n, err := q.writer.Write(q.buf)
+	if err != nil {
+		q.logger.Fatalf("can't write into disk queue segment %s: %s", q.writer.Name(), err.Error())
+	}
+	if q.config.Fsync == diskQueueFsyncAlways {
+		q.sync()
+	}
+
+	segment := q.segments[len(q.segments)-1]
+	segment.size += int64(n)
+	q.size += uint64(n)
+
+	if uint64(segment.size) >= q.config.SegmentSize_ {
+		q.closeWriter()
+		if err := q.createSegment(segment.id + 1); err != nil {
+			q.logger.Fatalf("can't create disk queue segment: %s", err.Error())
+		}
+	}
+
+	q.cond.Broadcast()
+}
+
+func (q *diskQueue) sync() {
+	if err := q.writer.Sync(); err != nil {
+		q.logger.Fatalf("can't sync disk queue segment %s: %s", q.writer.Name(), err.Error())
+	}
+}
+
+func (q *diskQueue) closeWriter() {
+	if q.config.Fsync != diskQueueFsyncNever {
+		q.sync()
+	}
+	if err := q.writer.Close(); err != nil {
+		q.logger.Errorf("can't close disk queue segment %s: %s", q.writer.Name(), err.Error())
+	}
+}
+
+// removeAcked removes the committed segments except the written one, mu should be locked.
+func (q *diskQueue) removeAcked() {
+	for len(q.segments) > 1 {
+		segment := q.segments[0]
+		if segment.id > q.ackPos.Segment || segment.id == q.ackPos.Segment && q.ackPos.Offset < segment.size {
+			return
+		}
+
+		if err := os.Remove(q.segmentPath(segment.id)); err != nil {
+			q.logger.Errorf("can't remove disk queue segment: %s", err.Error())
+		}
+		q.size -= uint64(segment.size)
+		q.segments = q.segments[1:]
+	}
+}
+
+func (q *diskQueue) saveAck() error {
+	if q.ackPos == q.savedAck {
+		return nil
+	}
+
+	data, err := json.Marshal(q.ackPos)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(q.config.Dir, diskQueueAckFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.config.Dir, diskQueueAckFile)); err != nil {
+		return err
+	}
+
+	q.savedAck = q.ackPos
+	return nil
+}
+
+// waitRecord waits for the record to read and returns the segment and its readable size, mu should be locked.
+func (q *diskQueue) waitRecord() (uint64, int64, bool) {
+	for {
+		if q.stopped {
+			return 0, 0, false
+		}
+
+		// the read segment may be removed if it's committed completely
+		var segment *diskQueueSegment
+		for _, s := range q.segments {
+			if s.id >= q.readPos.Segment {
+				segment = s
+				break
+			}
+		}
+		if segment.id != q.readPos.Segment {
+			q.readPos = diskQueuePos{Segment: segment.id}
+		}
+
+		if q.readPos.Offset < segment.size {
+			return segment.id, segment.size, true
+		}
+		if segment == q.segments[len(q.segments)-1] {
+			q.cond.Wait()
+			continue
+		}
+		q.readPos = diskQueuePos{Segment: segment.id + 1}
+	}
+}
+
+// replay reads the records and passes them to the output.
+// Stop waits for it, so the records aren't passed to the stopped output.
+func (q *diskQueue) replay() {
+	defer q.wg.Done()
+
+	var file *os.File
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+
+	header := make([]byte, diskQueueHeaderSize)
+	for {
+		var event *Event
+		select {
+		case event = <-q.events:
+		case <-q.stopCh:
+			return
+		}
+
+		q.mu.Lock()
+		segment, limit, ok := q.waitRecord()
+		offset := q.readPos.Offset
+		q.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		if file == nil || file.Name() != q.segmentPath(segment) {
+			if file != nil {
+				_ = file.Close()
+			}
+			var err error
+			file, err = os.Open(q.segmentPath(segment))
+			if err != nil {
+				q.logger.Fatalf("can't open disk queue segment: %s", err.Error())
+			}
+		}
+
+		end, err := q.readRecord(file, header, event, offset, limit)
+		q.mu.Lock()
+		if err != nil {
+			q.logger.Errorf("disk queue segment %s is corrupted at offset %d, the rest of the segment is skipped: %s", file.Name(), offset, err.Error())
+			q.corruptedMetric.Inc()
+			q.readPos = diskQueuePos{Segment: segment, Offset: limit}
+			q.mu.Unlock()
+			q.events <- event
+			continue
+		}
+
+		event.SeqID = q.nextSeq
+		q.nextSeq++
+		q.pending[event.SeqID] = diskQueuePos{Segment: segment, Offset: end}
+		q.readPos = q.pending[event.SeqID]
+		q.mu.Unlock()
+
+		select {
+		case <-q.stopCh:
+			// the record isn't committed, so it's replayed after the restart
+			q.events <- event
+			return
+		default:
+		}
+
+		if err := event.Root.DecodeBytes(event.Buf); err != nil {
+			q.logger.Errorf("can't decode disk queue record, it's skipped: %s", err.Error())
+			q.Commit(event)
+			continue
+		}
+		q.output.Out(event)
+	}
+}
+
+// readRecord reads the record payload at the offset into the event buffer and returns the record end.
+func (q *diskQueue) readRecord(file *os.File, header []byte, event *Event, offset, limit int64) (int64, error) {
+	if offset+diskQueueHeaderSize > limit {
+		return 0, fmt.Errorf("record header is truncated")
+	}
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return 0, err
+	}
+
+	size := int64(binary.LittleEndian.Uint32(header[0:4]))
+	end := offset + diskQueueHeaderSize + size
+	if end > limit {
+		return 0, fmt.Errorf("record of %d bytes is truncated", size)
+	}
+
+	if int64(cap(event.Buf)) < size {
+		event.Buf = make([]byte, size)
+	}
+	event.Buf = event.Buf[:size]
+	if _, err := file.ReadAt(event.Buf, offset+diskQueueHeaderSize); err != nil {
+		return 0, err
+	}
+	if crc32.Checksum(event.Buf, diskQueueCRCTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return 0, fmt.Errorf("checksum mismatch")
+	}
+
+	event.Size = int(size)
+	event.streamName = DefaultStreamName
+	return end, nil
+}
+
+// maintenance syncs the written segment and saves the position of the committed records.
+func (q *diskQueue) maintenance() {
+	defer q.wg.Done()
+
+	interval := diskQueueMaintenanceInterval
+	if q.config.Fsync == diskQueueFsyncInterval && q.config.FsyncInterval_ > 0 {
+		interval = q.config.FsyncInterval_
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		q.mu.Lock()
+		if q.config.Fsync == diskQueueFsyncInterval {
+			q.sync()
+		}
+		if err := q.saveAck(); err != nil {
+			q.logger.Errorf("can't save disk queue position: %s", err.Error())
+		}
+		q.sizeMetric.Set(float64(q.size))
+		q.mu.Unlock()
+	}
+}
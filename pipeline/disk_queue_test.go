@@ -0,0 +1,257 @@
+package pipeline
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// queueOutput passes the events to the channel and commits them on demand.
+// Out blocks while the channel is full until the output is stopped.
+type queueOutput struct {
+	controller OutputPluginController
+	events     chan *Event
+	stopCh     chan struct{}
+
+	outs         atomic.Int32
+	stopped      atomic.Bool
+	outAfterStop atomic.Bool
+}
+
+func newQueueOutput(size int) *queueOutput {
+	return &queueOutput{
+		events: make(chan *Event, size),
+		stopCh: make(chan struct{}),
+	}
+}
+
+func (o *queueOutput) Start(_ AnyConfig, params *OutputPluginParams) {
+	o.controller = params.Controller
+}
+
+func (o *queueOutput) Stop() {
+	o.stopped.Store(true)
+	close(o.stopCh)
+}
+
+func (o *queueOutput) Out(event *Event) {
+	if o.stopped.Load() {
+		o.outAfterStop.Store(true)
+	}
+	o.outs.Inc()
+	select {
+	case o.events <- event:
+	case <-o.stopCh:
+	}
+}
+
+func (o *queueOutput) RegisterMetrics(_ *metric.Ctl) {}
+
+func startTestDiskQueue(t *testing.T, config *DiskQueueConfig, commits *atomic.Int32) (*diskQueue, *queueOutput) {
+	output := newQueueOutput(1024)
+	return startTestDiskQueueOutput(t, config, commits, output), output
+}
+
+func startTestDiskQueueOutput(t *testing.T, config *DiskQueueConfig, commits *atomic.Int32, output *queueOutput) *diskQueue {
+	if config.MaxSize_ == 0 {
+		config.MaxSize_ = 1 << 20
+	}
+	if config.SegmentSize_ == 0 {
+		config.SegmentSize_ = 1 << 10
+	}
+	if config.Fsync == "" {
+		config.Fsync = diskQueueFsyncNever
+	}
+
+	q := newDiskQueue("test", config, output)
+	q.RegisterMetrics(metric.New("test"))
+	q.Start(nil, &OutputPluginParams{
+		PluginDefaultParams: &PluginDefaultParams{
+			PipelineName:     "test",
+			PipelineSettings: &Settings{Capacity: 1024},
+		},
+		Controller: &batcherTail{commit: func(*Event) { commits.Inc() }},
+		Logger:     zap.NewExample().Sugar(),
+	})
+
+	return q
+}
+
+func outTestEvents(t *testing.T, q *diskQueue, from, to int) {
+	for i := from; i < to; i++ {
+		root, err := insaneJSON.DecodeString(`{"i":` + strconv.Itoa(i) + `}`)
+		require.NoError(t, err)
+		q.Out(&Event{Root: root})
+		insaneJSON.Release(root)
+	}
+}
+
+// receiveTestEvents returns the replayed events and their values.
+func receiveTestEvents(t *testing.T, output *queueOutput, count int) ([]*Event, []int) {
+	events := make([]*Event, 0, count)
+	values := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		select {
+		case event := <-output.events:
+			events = append(events, event)
+			values = append(values, event.Root.Dig("i").AsInt())
+		case <-time.After(time.Second):
+			t.Fatalf("event #%d isn't replayed", i)
+		}
+	}
+	return events, values
+}
+
+func testRange(from, to int) []int {
+	values := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		values = append(values, i)
+	}
+	return values
+}
+
+func TestDiskQueueReplay(t *testing.T) {
+	config := &DiskQueueConfig{Dir: t.TempDir()}
+	commits := atomic.NewInt32(0)
+	q, output := startTestDiskQueue(t, config, commits)
+
+	outTestEvents(t, q, 0, 100)
+	assert.Equal(t, int32(100), commits.Load(), "events are committed once they are written")
+
+	events, values := receiveTestEvents(t, output, 100)
+	assert.Equal(t, testRange(0, 100), values)
+
+	// commit out of order
+	for i := len(events) - 1; i >= 0; i-- {
+		output.controller.Commit(events[i])
+	}
+	q.Stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	assert.Equal(t, 1, len(q.segments), "committed segments are removed")
+}
+
+func TestDiskQueueRestart(t *testing.T) {
+	config := &DiskQueueConfig{Dir: t.TempDir()}
+	commits := atomic.NewInt32(0)
+	q, output := startTestDiskQueue(t, config, commits)
+
+	outTestEvents(t, q, 0, 100)
+	events, _ := receiveTestEvents(t, output, 100)
+	for _, event := range events[:60] {
+		output.controller.Commit(event)
+	}
+	q.Stop()
+
+	q, output = startTestDiskQueue(t, config, commits)
+	outTestEvents(t, q, 100, 110)
+	events, values := receiveTestEvents(t, output, 50)
+	assert.Equal(t, testRange(60, 110), values, "not committed events are replayed")
+	for _, event := range events {
+		output.controller.Commit(event)
+	}
+	q.Stop()
+
+	q, output = startTestDiskQueue(t, config, commits)
+	defer q.Stop()
+	select {
+	case event := <-output.events:
+		t.Fatalf("committed event %s is replayed", event.Root.EncodeToString())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDiskQueueStopReplay(t *testing.T) {
+	config := &DiskQueueConfig{Dir: t.TempDir()}
+	commits := atomic.NewInt32(0)
+	// the output blocks until the event is received or the output is stopped
+	output := newQueueOutput(0)
+	q := startTestDiskQueueOutput(t, config, commits, output)
+	outTestEvents(t, q, 0, 10)
+	require.Eventually(t, func() bool { return output.outs.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("disk queue isn't stopped while the output is blocked")
+	}
+	assert.False(t, output.outAfterStop.Load(), "records aren't replayed after the stop")
+	assert.Equal(t, int32(1), output.outs.Load())
+
+	q, output = startTestDiskQueue(t, config, commits)
+	defer q.Stop()
+	_, values := receiveTestEvents(t, output, 10)
+	assert.Equal(t, testRange(0, 10), values, "the blocked record is replayed after the restart")
+}
+
+func TestDiskQueueMaxSize(t *testing.T) {
+	config := &DiskQueueConfig{Dir: t.TempDir(), MaxSize_: 2048, SegmentSize_: 512}
+	commits := atomic.NewInt32(0)
+	q, output := startTestDiskQueue(t, config, commits)
+	defer q.Stop()
+
+	written := make(chan struct{})
+	go func() {
+		outTestEvents(t, q, 0, 500)
+		close(written)
+	}()
+
+	// the output doesn't commit, so the queue is full
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.size >= config.MaxSize_
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-written:
+		t.Fatal("events are written beyond the max size")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// committed segments free the space
+	for i := 0; i < 500; i++ {
+		events, values := receiveTestEvents(t, output, 1)
+		assert.Equal(t, []int{i}, values)
+		output.controller.Commit(events[0])
+	}
+	<-written
+	assert.Equal(t, int32(500), commits.Load())
+}
+
+func TestDiskQueueCorruption(t *testing.T) {
+	config := &DiskQueueConfig{Dir: t.TempDir(), SegmentSize_: 60}
+	commits := atomic.NewInt32(0)
+	q, _ := startTestDiskQueue(t, config, commits)
+
+	// records are 15 bytes, so there are 4 records in the segment
+	outTestEvents(t, q, 0, 8)
+	q.Stop()
+
+	// break the payload of the second record of the first segment
+	file, err := os.OpenFile(q.segmentPath(0), os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("x"), 15+diskQueueHeaderSize)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	q, output := startTestDiskQueue(t, config, commits)
+	defer q.Stop()
+
+	_, values := receiveTestEvents(t, output, 5)
+	assert.Equal(t, []int{0, 4, 5, 6, 7}, values, "the rest of the corrupted segment is skipped")
+}
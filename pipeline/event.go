@@ -25,6 +25,17 @@ type Event struct {
 	streamName StreamName
 	Size       int // last known event size, it may not be actual
 
+	routeTags []string
+
+	// outputs is the count of the references to the event: the outputs and the children which haven't committed it yet
+	// and the processor while it processes the event with children.
+	outputs atomic.Int32
+	// origin is the event which is copied for the output or the parent of the spawned event,
+	// such events don't belong to the event pool.
+	origin *Event
+	// holdsRef is true if the processor holds the reference to the event until the event is processed.
+	holdsRef bool
+
 	action atomic.Int64
 	next   *Event
 	stream *stream
@@ -103,9 +114,58 @@ func (e *Event) reset(avgEventSize int) {
 	e.next = nil
 	e.action = atomic.Int64{}
 	e.stream = nil
+	e.routeTags = e.routeTags[:0]
+	e.outputs.Store(0)
+	e.holdsRef = false
 	e.kind.Swap(eventKindRegular)
 }
 
+// copyForOutput makes a copy of the event to pass it to one more output.
+func (e *Event) copyForOutput() *Event {
+	c := newEvent()
+	c.Buf = e.Root.Encode(c.Buf)
+	_ = c.Root.DecodeBytes(c.Buf)
+	c.Buf = c.Buf[:0]
+
+	c.SeqID = e.SeqID
+	c.Offset = e.Offset
+	c.SourceID = e.SourceID
+	c.SourceName = e.SourceName
+	c.streamName = e.streamName
+	c.Size = e.Size
+	c.routeTags = append(c.routeTags, e.routeTags...)
+	c.stage = eventStageOutput
+	c.origin = e
+	c.outputs.Store(1)
+
+	return c
+}
+
+// spawn creates the child event from the JSON, the child passes the actions following the current one.
+func (e *Event) spawn(data []byte) (*Event, error) {
+	c := newEvent()
+	if err := c.Root.DecodeBytes(data); err != nil {
+		insaneJSON.Release(c.Root)
+		return nil, err
+	}
+
+	c.SeqID = e.SeqID
+	c.Offset = e.Offset
+	c.SourceID = e.SourceID
+	c.SourceName = e.SourceName
+	c.streamName = e.streamName
+	c.stream = e.stream
+	c.Size = len(data)
+	c.routeTags = append(c.routeTags, e.routeTags...)
+	c.stage = eventStageProcessor
+	c.action.Store(e.action.Load() + 1)
+	c.origin = e
+	c.holdsRef = true
+	c.outputs.Store(1)
+
+	return c, nil
+}
+
 func (e *Event) StreamNameBytes() []byte {
 	return StringToByteUnsafe(string(e.streamName))
 }
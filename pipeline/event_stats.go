@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/metric"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+const (
+	DefaultEventStatsField = "k8s_pod"
+	DefaultEventStatsTopK  = 10
+
+	// eventStatsCapacityFactor is how many counters the sketch keeps per reported producer.
+	// More counters give more accurate top-K at the cost of memory.
+	eventStatsCapacityFactor = 4
+)
+
+var (
+	eventSizeBuckets   = prom.ExponentialBuckets(64, 4, 9) // 64B ... 4MB
+	eventFieldsBuckets = prom.ExponentialBuckets(1, 2, 11) // 1 ... 1024
+)
+
+// eventStats tracks the distributions of event sizes and field counts
+// and keeps the Space-Saving sketch of the producers sending the most bytes.
+type eventStats struct {
+	field     []string
+	fieldName string
+	topK      int
+	capacity  int
+
+	mu        *sync.Mutex
+	producers map[string]*producerStats
+
+	eventSizeMetric   *prom.HistogramVec
+	eventFieldsMetric *prom.HistogramVec
+}
+
+type producerStats struct {
+	Name   string `json:"name"`
+	Bytes  uint64 `json:"bytes"`
+	Events uint64 `json:"events"`
+	// Error is the upper bound of the overestimation of the bytes value.
+	Error uint64 `json:"error"`
+}
+
+func newEventStats(field string, topK int, metricsController *metric.Ctl) *eventStats {
+	if topK <= 0 {
+		topK = DefaultEventStatsTopK
+	}
+	if field == "" {
+		field = DefaultEventStatsField
+	}
+	logger.Infof("event stats enabled, field=%s, top_k=%d", field, topK)
+
+	return &eventStats{
+		field:     cfg.ParseFieldSelector(field),
+		fieldName: field,
+		topK:      topK,
+		capacity:  topK * eventStatsCapacityFactor,
+		mu:        &sync.Mutex{},
+		producers: make(map[string]*producerStats),
+
+		eventSizeMetric:   metricsController.RegisterHistogram("output_event_size", "Size of events on pipeline output", eventSizeBuckets),
+		eventFieldsMetric: metricsController.RegisterHistogram("output_event_fields", "Count of fields in events on pipeline output", eventFieldsBuckets),
+	}
+}
+
+func (s *eventStats) observe(event *Event) {
+	s.eventSizeMetric.WithLabelValues().Observe(float64(event.Size))
+	s.eventFieldsMetric.WithLabelValues().Observe(float64(countFields(event.Root.Node)))
+
+	name := DefaultFieldValue
+	if node := event.Root.Dig(s.field...); node != nil {
+		name = node.AsString()
+	}
+
+	s.mu.Lock()
+	s.add(name, uint64(event.Size))
+	s.mu.Unlock()
+}
+
+// add implements the Space-Saving algorithm:
+// if the sketch is full, the producer with the least bytes is replaced by the new one,
+// which inherits its counter as the possible error.
+func (s *eventStats) add(name string, size uint64) {
+	if p, has := s.producers[name]; has {
+		p.Bytes += size
+		p.Events++
+		return
+	}
+
+	p := &producerStats{Bytes: size, Events: 1}
+	if len(s.producers) >= s.capacity {
+		var smallest *producerStats
+		for _, candidate := range s.producers {
+			if smallest == nil || candidate.Bytes < smallest.Bytes {
+				smallest = candidate
+			}
+		}
+		delete(s.producers, smallest.Name)
+
+		p.Bytes += smallest.Bytes
+		p.Error = smallest.Bytes
+	}
+
+	// the name may point to the event buffer, so copy it
+	p.Name = strings.Clone(name)
+	s.producers[p.Name] = p
+}
+
+// top returns at most topK producers sorted by bytes.
+func (s *eventStats) top() []producerStats {
+	s.mu.Lock()
+	result := make([]producerStats, 0, len(s.producers))
+	for _, p := range s.producers {
+		result = append(result, *p)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes == result[j].Bytes {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Bytes > result[j].Bytes
+	})
+	if len(result) > s.topK {
+		result = result[:s.topK]
+	}
+
+	return result
+}
+
+func (s *eventStats) reset() {
+	s.mu.Lock()
+	s.producers = make(map[string]*producerStats)
+	s.mu.Unlock()
+}
+
+// countFields returns the count of object fields in the node including nested ones.
+func countFields(node *insaneJSON.Node) int {
+	count := 0
+	switch {
+	case node.IsObject():
+		for _, field := range node.AsFields() {
+			count += 1 + countFields(field.AsFieldValue())
+		}
+	case node.IsArray():
+		for _, elem := range node.AsArray() {
+			count += countFields(elem)
+		}
+	}
+
+	return count
+}
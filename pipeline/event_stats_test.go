@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ozontech/file.d/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+func TestCountFields(t *testing.T) {
+	cases := []struct {
+		json     string
+		expected int
+	}{
+		{json: `{}`, expected: 0},
+		{json: `{"a":1,"b":"2"}`, expected: 2},
+		{json: `{"a":{"b":{"c":1}},"d":null}`, expected: 4},
+		{json: `{"a":[{"b":1},{"c":2,"d":3}],"e":[1,2]}`, expected: 5},
+	}
+
+	for _, tc := range cases {
+		root, err := insaneJSON.DecodeString(tc.json)
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.expected, countFields(root.Node), tc.json)
+		insaneJSON.Release(root)
+	}
+}
+
+func TestEventStatsTop(t *testing.T) {
+	s := newEventStats("k8s_pod", 2, metric.New("test_event_stats_top"))
+
+	// heavy producers are tracked exactly since the sketch isn't full
+	for i := 0; i < 100; i++ {
+		s.add("heavy", 1000)
+		s.add("medium", 100)
+	}
+	// a lot of small producers evict each other
+	for i := 0; i < 1000; i++ {
+		s.add(fmt.Sprintf("small_%d", i), 10)
+	}
+
+	top := s.top()
+	require.Equal(t, 2, len(top))
+	assert.Equal(t, producerStats{Name: "heavy", Bytes: 100000, Events: 100}, top[0])
+	assert.Equal(t, producerStats{Name: "medium", Bytes: 10000, Events: 100}, top[1])
+	assert.Equal(t, 8, len(s.producers), "sketch must be bounded")
+
+	s.reset()
+	assert.Equal(t, 0, len(s.top()))
+}
+
+func TestEventStatsObserve(t *testing.T) {
+	s := newEventStats("kubernetes.pod", 10, metric.New("test_event_stats_observe"))
+
+	for _, json := range []string{
+		`{"kubernetes":{"pod":"api"},"message":"hello"}`,
+		`{"kubernetes":{"pod":"api"},"message":"world"}`,
+		`{"message":"no pod"}`,
+	} {
+		event := newEvent()
+		require.NoError(t, event.parseJSON([]byte(json)))
+		event.Size = len(json)
+		s.observe(event)
+	}
+
+	top := s.top()
+	require.Equal(t, 2, len(top))
+	assert.Equal(t, "api", top[0].Name)
+	assert.Equal(t, uint64(2), top[0].Events)
+	assert.Equal(t, DefaultFieldValue, top[1].Name)
+}
+
+func TestServeEventStats(t *testing.T) {
+	p := New("test_serve_event_stats", &Settings{Capacity: 5, Decoder: "json"}, nil)
+
+	rec := httptest.NewRecorder()
+	p.serveEventStats(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 400, rec.Code)
+
+	p = New("test_serve_event_stats", &Settings{Capacity: 5, Decoder: "json", EventStats: true}, nil)
+	p.eventStats.add("api", 100)
+
+	rec = httptest.NewRecorder()
+	p.serveEventStats(rec, httptest.NewRequest("GET", "/?reset=true", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, `{"field":"k8s_pod","producers":[{"name":"api","bytes":100,"events":1,"error":0}]}`, rec.Body.String())
+	assert.Equal(t, 0, len(p.eventStats.top()))
+}
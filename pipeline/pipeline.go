@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 
@@ -37,6 +39,8 @@ const (
 
 	antispamUnbanIterations = 4
 	metricsGenInterval      = time.Hour
+	drainPollInterval       = 10 * time.Millisecond
+	drainLogInterval        = time.Second
 )
 
 type finalizeFn = func(event *Event, notifyInput bool, backEvent bool)
@@ -51,13 +55,16 @@ type InputPluginController interface {
 }
 
 type ActionPluginController interface {
-	Commit(event *Event)    // commit offset of held event and skip further processing
-	Propagate(event *Event) // throw held event back to pipeline
+	Commit(event *Event)                   // commit offset of held event and skip further processing
+	Propagate(event *Event)                // throw held event back to pipeline
+	Spawn(event *Event, data []byte) error // pass the child event made of JSON through the rest of pipeline
 }
 
 type OutputPluginController interface {
 	Commit(event *Event) // notify input plugin that event is successfully processed and save offsets
 	Error(err string)
+	HasFallback() bool     // check if the output has the fallback output
+	Fallback(event *Event) // pass the event which can't be sent to the fallback output instead of committing
 }
 
 type (
@@ -84,6 +91,7 @@ type Pipeline struct {
 	input      InputPlugin
 	inputInfo  *InputPluginInfo
 	antispamer *antispamer
+	eventStats *eventStats // nil if event stats are disabled
 
 	actionInfos  []*ActionPluginStaticInfo
 	Procs        []*processor
@@ -91,8 +99,15 @@ type Pipeline struct {
 	activeProcs  *atomic.Int32
 	actionParams *PluginDefaultParams
 
-	output     OutputPlugin
-	outputInfo *OutputPluginInfo
+	outputs     []OutputPlugin
+	outputInfos []*OutputPluginInfo
+	// outputsInFlight are the counts of events passed to the outputs and not committed yet
+	outputsInFlight []*atomic.Int64
+	// fallbacksInFlight are the counts of events passed to the fallback outputs and not committed yet
+	fallbacksInFlight []*atomic.Int64
+
+	draining atomic.Bool
+	stopCh   chan struct{}
 
 	metricsHolder *metricsHolder
 	metricsCtl    *metric.Ctl
@@ -122,6 +137,7 @@ type Pipeline struct {
 	readOpsEventsSizeMetric    *prometheus.CounterVec
 	wrongEventCRIFormatMetric  *prometheus.CounterVec
 	maxEventSizeExceededMetric *prometheus.CounterVec
+	fallbackEventsMetric       *prometheus.CounterVec
 }
 
 type Settings struct {
@@ -134,6 +150,9 @@ type Settings struct {
 	MaxEventSize        int
 	StreamField         string
 	IsStrict            bool
+	EventStats          bool
+	EventStatsField     string
+	EventStatsTopK      int
 }
 
 // New creates new pipeline. Consider using `SetupHTTPHandlers` next.
@@ -159,6 +178,12 @@ func New(name string, settings *Settings, registry *prometheus.Registry) *Pipeli
 
 		eventLog:   make([]string, 0, 128),
 		eventLogMu: &sync.Mutex{},
+
+		stopCh: make(chan struct{}),
+	}
+
+	if settings.EventStats {
+		pipeline.eventStats = newEventStats(settings.EventStatsField, settings.EventStatsTopK, metricCtl)
 	}
 
 	pipeline.registerMetrics()
@@ -202,6 +227,7 @@ func (p *Pipeline) registerMetrics() {
 	p.readOpsEventsSizeMetric = p.metricsCtl.RegisterCounter("read_ops_count", "Read OPS count")
 	p.wrongEventCRIFormatMetric = p.metricsCtl.RegisterCounter("wrong_event_cri_format", "Wrong event CRI format counter")
 	p.maxEventSizeExceededMetric = p.metricsCtl.RegisterCounter("max_event_size_exceeded", "Max event size exceeded counter")
+	p.fallbackEventsMetric = p.metricsCtl.RegisterCounter("output_fallback_events_count", "Count of events passed to the fallback outputs", "output")
 }
 
 func (p *Pipeline) setDefaultMetrics() {
@@ -211,13 +237,13 @@ func (p *Pipeline) setDefaultMetrics() {
 // SetupHTTPHandlers creates handlers for plugin endpoints and pipeline info.
 // Plugin endpoints can be accessed via
 // URL `/pipelines/<pipeline_name>/<plugin_index_in_config>/<plugin_endpoint>`.
-// Input plugin has the index of zero, output plugin has the last index.
+// Input plugin has the index of zero, outputs have the last indexes in the order of the config.
 // Actions also have the standard endpoints `/info` and `/sample`.
 func (p *Pipeline) SetupHTTPHandlers(mux *http.ServeMux) {
 	if p.input == nil {
 		p.logger.Panicf("input isn't set for pipeline %q", p.Name)
 	}
-	if p.output == nil {
+	if len(p.outputs) == 0 {
 		p.logger.Panicf("output isn't set for pipeline %q", p.Name)
 	}
 
@@ -225,6 +251,7 @@ func (p *Pipeline) SetupHTTPHandlers(mux *http.ServeMux) {
 	mux.HandleFunc(prefix, p.servePipeline)
 	prefixBanList := fmt.Sprintf("/pipelines/%s/ban_list", p.Name)
 	mux.HandleFunc(prefixBanList, p.servePipelineBanList)
+	mux.HandleFunc(prefix+"/event_stats", p.serveEventStats)
 	for hName, handler := range p.inputInfo.PluginStaticInfo.Endpoints {
 		mux.HandleFunc(fmt.Sprintf("%s/0/%s", prefix, hName), handler)
 	}
@@ -237,8 +264,10 @@ func (p *Pipeline) SetupHTTPHandlers(mux *http.ServeMux) {
 		}
 	}
 
-	for hName, handler := range p.outputInfo.PluginStaticInfo.Endpoints {
-		mux.HandleFunc(fmt.Sprintf("%s/%d/%s", prefix, len(p.actionInfos)+1, hName), handler)
+	for i, info := range p.outputInfos {
+		for hName, handler := range info.PluginStaticInfo.Endpoints {
+			mux.HandleFunc(fmt.Sprintf("%s/%d/%s", prefix, len(p.actionInfos)+1+i, hName), handler)
+		}
 	}
 }
 
@@ -246,22 +275,31 @@ func (p *Pipeline) Start() {
 	if p.input == nil {
 		p.logger.Panicf("input isn't set for pipeline %q", p.Name)
 	}
-	if p.output == nil {
+	if len(p.outputs) == 0 {
 		p.logger.Panicf("output isn't set for pipeline %q", p.Name)
 	}
 
 	p.initProcs()
 	p.metricsHolder.start()
 
-	outputParams := &OutputPluginParams{
-		PluginDefaultParams: p.actionParams,
-		Controller:          p,
-		Logger:              p.logger.Named("output " + p.outputInfo.Type),
-	}
-	p.logger.Infof("starting output plugin %q", p.outputInfo.Type)
+	for i, output := range p.outputs {
+		info := p.outputInfos[i]
+		controller := &outputController{pipeline: p, inFlight: p.outputsInFlight[i]}
+		if info.Fallback != nil {
+			controller.fallback = p.startFallback(info, p.fallbacksInFlight[i])
+			controller.fallbackInFlight = p.fallbacksInFlight[i]
+			controller.fallbackEvents = p.fallbackEventsMetric.WithLabelValues(info.Type)
+		}
+		outputParams := &OutputPluginParams{
+			PluginDefaultParams: p.actionParams,
+			Controller:          controller,
+			Logger:              p.logger.Named("output " + info.Type),
+		}
+		p.logger.Infof("starting output plugin %q", info.Type)
 
-	p.output.RegisterMetrics(p.metricsCtl)
-	p.output.Start(p.outputInfo.Config, outputParams)
+		output.RegisterMetrics(p.metricsCtl)
+		output.Start(info.Config, outputParams)
+	}
 
 	p.logger.Infof("stating processors, count=%d", len(p.Procs))
 	for _, processor := range p.Procs {
@@ -290,6 +328,8 @@ func (p *Pipeline) Start() {
 
 func (p *Pipeline) Stop() {
 	p.logger.Infof("stopping pipeline %q, total committed=%d", p.Name, p.outputEvents.Load())
+	// events held by the drain are dropped
+	close(p.stopCh)
 
 	p.logger.Infof("stopping processors count=%d", len(p.Procs))
 	for _, processor := range p.Procs {
@@ -301,8 +341,16 @@ func (p *Pipeline) Stop() {
 	p.logger.Infof("stopping %q input", p.Name)
 	p.input.Stop()
 
-	p.logger.Infof("stopping %q output", p.Name)
-	p.output.Stop()
+	p.logger.Infof("stopping %q outputs count=%d", p.Name, len(p.outputs))
+	for _, output := range p.outputs {
+		output.Stop()
+	}
+	// fallbacks are stopped after the outputs since the outputs pass events to them while stopping
+	for _, info := range p.outputInfos {
+		if info.Fallback != nil {
+			info.Fallback.Plugin.(OutputPlugin).Stop()
+		}
+	}
 
 	p.shouldStop = true
 }
@@ -316,17 +364,48 @@ func (p *Pipeline) GetInput() InputPlugin {
 	return p.input
 }
 
+// SetOutput replaces the outputs of the pipeline with the single output.
 func (p *Pipeline) SetOutput(info *OutputPluginInfo) {
-	p.outputInfo = info
-	p.output = info.Plugin.(OutputPlugin)
+	p.outputInfos = nil
+	p.outputs = nil
+	p.outputsInFlight = nil
+	p.fallbacksInFlight = nil
+	p.AddOutput(info)
+}
+
+// AddOutput adds one more output to the pipeline, events are routed to the outputs matching them.
+func (p *Pipeline) AddOutput(info *OutputPluginInfo) {
+	output := info.Plugin.(OutputPlugin)
+	if info.DiskQueue != nil {
+		output = newDiskQueue(info.Type, info.DiskQueue, output)
+	}
+
+	p.outputInfos = append(p.outputInfos, info)
+	p.outputs = append(p.outputs, output)
+	p.outputsInFlight = append(p.outputsInFlight, atomic.NewInt64(0))
+	p.fallbacksInFlight = append(p.fallbacksInFlight, atomic.NewInt64(0))
 }
 
+// GetOutput returns the first output of the pipeline.
 func (p *Pipeline) GetOutput() OutputPlugin {
-	return p.output
+	if len(p.outputs) == 0 {
+		return nil
+	}
+	return p.outputs[0]
+}
+
+func (p *Pipeline) GetOutputs() []OutputPlugin {
+	return p.outputs
 }
 
 // In decodes message and passes it to event stream.
 func (p *Pipeline) In(sourceID SourceID, sourceName string, offset int64, bytes []byte, isNewSource bool) (seqID uint64) {
+	if p.draining.Load() {
+		// hold the input until the pipeline is stopped, the event isn't committed, so it isn't lost.
+		<-p.stopCh
+		return EventSeqIDError
+	}
+
 	length := len(bytes)
 
 	// don't process mud.
@@ -447,7 +526,81 @@ func (p *Pipeline) streamEvent(event *Event) uint64 {
 }
 
 func (p *Pipeline) Commit(event *Event) {
-	p.finalize(event, true, true)
+	p.release(event, true)
+}
+
+// release drops the reference to the event. Once all the references are dropped,
+// the copy or the child is released and the reference to its origin is dropped.
+func (p *Pipeline) release(event *Event, notifyInput bool) {
+	for {
+		// the event is routed to several outputs or has children, so wait for the rest of them
+		if event.outputs.Dec() > 0 {
+			return
+		}
+		if event.origin == nil {
+			break
+		}
+		origin := event.origin
+		insaneJSON.Release(event.Root)
+		event = origin
+	}
+
+	p.finalize(event, notifyInput, true)
+}
+
+// Drain holds new events and waits until the events in processing are committed.
+// The progress is logged every second. It returns false if the context is done before all the events are committed.
+// The pipeline should be stopped after the drain.
+func (p *Pipeline) Drain(ctx context.Context) bool {
+	p.draining.Store(true)
+
+	poll := time.NewTicker(drainPollInterval)
+	defer poll.Stop()
+	lastLog := time.Now()
+	for {
+		if p.eventPool.inUseEvents.Load() == 0 {
+			p.logger.Infof("pipeline %q is drained", p.Name)
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			p.logger.Errorf("pipeline %q isn't drained: %s", p.Name, p.drainProgress())
+			return false
+		case <-poll.C:
+			if time.Since(lastLog) >= drainLogInterval {
+				p.logger.Infof("draining pipeline %q: %s", p.Name, p.drainProgress())
+				lastLog = time.Now()
+			}
+		}
+	}
+}
+
+func (p *Pipeline) drainProgress() string {
+	progress := fmt.Sprintf("events in processing=%d", p.eventPool.inUseEvents.Load())
+	for i, info := range p.outputInfos {
+		progress += fmt.Sprintf(", output #%d %q=%d", i, info.Type, p.outputsInFlight[i].Load())
+		if info.Fallback != nil {
+			progress += fmt.Sprintf(", fallback %q=%d", info.Fallback.Type, p.fallbacksInFlight[i].Load())
+		}
+	}
+	return progress
+}
+
+// startFallback starts the fallback output of the output.
+func (p *Pipeline) startFallback(info *OutputPluginInfo, inFlight *atomic.Int64) OutputPlugin {
+	fallback := info.Fallback.Plugin.(OutputPlugin)
+	fallbackParams := &OutputPluginParams{
+		PluginDefaultParams: p.actionParams,
+		Controller:          &outputController{pipeline: p, inFlight: inFlight},
+		Logger:              p.logger.Named("output " + info.Type + " fallback " + info.Fallback.Type),
+	}
+	p.logger.Infof("starting fallback output plugin %q of output %q", info.Fallback.Type, info.Type)
+
+	fallback.RegisterMetrics(p.metricsCtl)
+	fallback.Start(info.Fallback.Config, fallbackParams)
+
+	return fallback
 }
 
 func (p *Pipeline) Error(err string) {
@@ -463,6 +616,14 @@ func (p *Pipeline) finalize(event *Event, notifyInput bool, backEvent bool) {
 		return
 	}
 
+	// the processor has processed the child or the event with children, so it drops its reference.
+	// The input is notified even if the event is discarded, since its children may be already delivered.
+	if backEvent && event.holdsRef {
+		event.holdsRef = false
+		p.release(event, true)
+		return
+	}
+
 	if notifyInput {
 		p.input.Commit(event)
 		p.outputEvents.Inc()
@@ -475,6 +636,10 @@ func (p *Pipeline) finalize(event *Event, notifyInput bool, backEvent bool) {
 		if event.Size > p.maxSize {
 			p.maxSize = event.Size
 		}
+
+		if p.eventStats != nil {
+			p.eventStats.observe(event)
+		}
 	}
 
 	// todo: avoid event.stream.commit(event)
@@ -519,10 +684,12 @@ func (p *Pipeline) newProc() *processor {
 	proc := NewProcessor(
 		p.metricsHolder,
 		p.activeProcs,
-		p.output,
+		p.outputs,
 		p.streamer,
 		p.finalize,
 	)
+	proc.outputInfos = p.outputInfos
+	proc.outputsInFlight = p.outputsInFlight
 	for j, info := range p.actionInfos {
 		plugin, _ := info.Factory()
 		proc.AddActionPlugin(&ActionPluginInfo{
@@ -715,6 +882,34 @@ func (p *Pipeline) servePipelineBanList(w http.ResponseWriter, _ *http.Request)
 	_, _ = w.Write([]byte("</p></pre></body></html>"))
 }
 
+// serveEventStats returns the producers sending the most bytes through the pipeline.
+// The sketch is cleared after the response if `reset=true` query param is passed.
+func (p *Pipeline) serveEventStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	if p.eventStats == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeErr(w, "Event stats are disabled, consider setting `event_stats: true` in the pipeline settings.")
+
+		return
+	}
+
+	type Resp struct {
+		Field     string          `json:"field"`
+		Producers []producerStats `json:"producers"`
+	}
+
+	resp, _ := json.Marshal(Resp{
+		Field:     p.eventStats.fieldName,
+		Producers: p.eventStats.top(),
+	})
+	_, _ = w.Write(resp)
+
+	if r.URL.Query().Get("reset") == "true" {
+		p.eventStats.reset()
+	}
+}
+
 // serveActionInfo creates a handlerFunc for the given action.
 // it returns metric values for the given action.
 func (p *Pipeline) serveActionInfo(info ActionPluginStaticInfo) func(http.ResponseWriter, *http.Request) {
@@ -808,3 +1003,39 @@ func writeErr(w io.Writer, err string) {
 	})
 	_, _ = w.Write(respErr)
 }
+
+// outputController counts the events in processing of the output and passes events to its fallback output.
+type outputController struct {
+	pipeline *Pipeline
+	inFlight *atomic.Int64
+
+	// fallback is nil if the output doesn't have the fallback output
+	fallback         OutputPlugin
+	fallbackInFlight *atomic.Int64
+	fallbackEvents   prometheus.Counter
+}
+
+func (c *outputController) Commit(event *Event) {
+	c.inFlight.Dec()
+	c.pipeline.Commit(event)
+}
+
+func (c *outputController) Error(err string) {
+	c.pipeline.Error(err)
+}
+
+func (c *outputController) HasFallback() bool {
+	return c.fallback != nil
+}
+
+// Fallback passes the event to the fallback output, the event is committed once the fallback output commits it.
+func (c *outputController) Fallback(event *Event) {
+	if c.fallback == nil {
+		c.pipeline.logger.Panicf("output doesn't have the fallback output")
+	}
+
+	c.inFlight.Dec()
+	c.fallbackInFlight.Inc()
+	c.fallbackEvents.Inc()
+	c.fallback.Out(event)
+}
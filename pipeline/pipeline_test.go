@@ -1,12 +1,23 @@
 package pipeline_test
 
 import (
+	"context"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin/input/fake"
+	"github.com/ozontech/file.d/plugin/output/devnull"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 )
 
 func getFakeInputInfo() *pipeline.InputPluginInfo {
@@ -59,17 +70,19 @@ func TestInUnparsableMessages(t *testing.T) {
 			Slice(0, pipelineSettings.Capacity)
 
 		for i := 0; i < pipelineSettings.Capacity; i++ {
-			// free1, free2 are []atomic.Bool which underlying v is really uint32
+			// free1, free2 are []atomic.Bool which underlying v is atomic.Uint32 with v uint32
 			// so if v val == uint32(1) event was released.
 			free1idxUint := reflect.
 				Indirect(free1slice.Index(i)).
 				FieldByName("v").
+				FieldByName("v").
 				Uint()
 			require.EqualValues(t, uint32(1), free1idxUint)
 
 			free2idxUint := reflect.
 				Indirect(free2slice.Index(i)).
 				FieldByName("v").
+				FieldByName("v").
 				Uint()
 			require.EqualValues(t, uint32(1), free2idxUint)
 		}
@@ -118,3 +131,260 @@ func TestInInvalidMessages(t *testing.T) {
 		})
 	}
 }
+
+// holdOutput commits events only on demand.
+type holdOutput struct {
+	controller pipeline.OutputPluginController
+	events     chan *pipeline.Event
+}
+
+func (o *holdOutput) Start(_ pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	o.controller = params.Controller
+}
+
+func (o *holdOutput) Stop() {}
+
+func (o *holdOutput) Out(event *pipeline.Event) {
+	o.events <- event
+}
+
+func (o *holdOutput) RegisterMetrics(_ *metric.Ctl) {}
+
+func TestOutputRouting(t *testing.T) {
+	p, input, _ := test.NewPipelineMock(nil, "passive")
+
+	levelIs := func(level string) pipeline.MatchConditions {
+		return pipeline.MatchConditions{{Field: cfg.ParseFieldSelector("level"), Values: []string{level}}}
+	}
+
+	mu := &sync.Mutex{}
+	routed := make(map[string][]string)
+	addOutput := func(name string, conds pipeline.MatchConditions, invert bool) {
+		plugin, _ := devnull.Factory()
+		output := plugin.(*devnull.Plugin)
+		output.SetOutFn(func(e *pipeline.Event) {
+			mu.Lock()
+			routed[name] = append(routed[name], strings.Clone(e.Root.Dig("level").AsString()))
+			mu.Unlock()
+			// outputs receive own copies of the event
+			e.Root.AddField("output").MutateToString(name)
+		})
+		p.AddOutput(&pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: output},
+			MatchConditions:   conds,
+			MatchInvert:       invert,
+		})
+	}
+
+	p.SetOutput(&pipeline.OutputPluginInfo{
+		PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "hold"},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: &holdOutput{events: make(chan *pipeline.Event, 3)}},
+		MatchConditions:   levelIs("debug"),
+		MatchInvert:       true,
+	})
+	hold := p.GetOutput().(*holdOutput)
+	addOutput("errors", levelIs("error"), false)
+	addOutput("all", nil, false)
+
+	commits := atomic.NewInt32(0)
+	input.SetCommitFn(func(*pipeline.Event) {
+		commits.Inc()
+	})
+
+	p.Start()
+	defer p.Stop()
+
+	for _, level := range []string{"error", "debug", "info"} {
+		input.In(0, "test.log", 0, []byte(`{"level":"`+level+`"}`))
+	}
+
+	held := make([]*pipeline.Event, 0)
+	for i := 0; i < 2; i++ {
+		event := <-hold.events
+		assert.Equal(t, "", event.Root.Dig("output").AsString(), "event is changed by another output")
+		held = append(held, event)
+	}
+
+	// the debug event isn't routed to the hold output, so it's committed
+	require.Eventually(t, func() bool { return commits.Load() == 1 }, time.Second, 10*time.Millisecond)
+	for _, event := range held {
+		hold.controller.Commit(event)
+	}
+	require.Eventually(t, func() bool { return commits.Load() == 3 }, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(routed["all"])
+	assert.Equal(t, map[string][]string{
+		"errors": {"error"},
+		"all":    {"debug", "error", "info"},
+	}, routed)
+}
+
+func TestDrain(t *testing.T) {
+	p, input, _ := test.NewPipelineMock(nil, "passive")
+	hold := &holdOutput{events: make(chan *pipeline.Event, 1)}
+	p.SetOutput(&pipeline.OutputPluginInfo{
+		PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "hold"},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: hold},
+	})
+	p.Start()
+
+	input.In(0, "test.log", 0, []byte(`{"a":1}`))
+	event := <-hold.events
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, p.Drain(ctx), "event isn't committed")
+
+	// new events are held until the pipeline is stopped
+	held := make(chan uint64)
+	go func() {
+		held <- p.In(0, "test.log", 1, []byte(`{"a":2}`+"\n"), false)
+	}()
+
+	hold.controller.Commit(event)
+	assert.True(t, p.Drain(context.Background()))
+
+	select {
+	case <-held:
+		t.Fatal("event isn't held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.Stop()
+	assert.Equal(t, pipeline.EventSeqIDError, <-held)
+}
+
+func TestFallback(t *testing.T) {
+	p, input, _ := test.NewPipelineMock(nil, "passive")
+
+	fallback := make(chan string, 1)
+	plugin, _ := devnull.Factory()
+	output := plugin.(*devnull.Plugin)
+	output.SetOutFn(func(e *pipeline.Event) {
+		fallback <- strings.Clone(e.Root.Dig("a").AsString())
+	})
+
+	hold := &holdOutput{events: make(chan *pipeline.Event, 2)}
+	p.SetOutput(&pipeline.OutputPluginInfo{
+		PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "hold"},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: hold},
+		Fallback: &pipeline.OutputPluginInfo{
+			PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "devnull"},
+			PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: output},
+		},
+	})
+
+	commits := atomic.NewInt32(0)
+	input.SetCommitFn(func(*pipeline.Event) {
+		commits.Inc()
+	})
+
+	p.Start()
+	defer p.Stop()
+
+	input.In(0, "test.log", 0, []byte(`{"a":"sent"}`))
+	input.In(0, "test.log", 1, []byte(`{"a":"failed"}`))
+	sent, failed := <-hold.events, <-hold.events
+	if sent.Root.Dig("a").AsString() != "sent" {
+		sent, failed = failed, sent
+	}
+
+	require.True(t, hold.controller.HasFallback())
+	hold.controller.Fallback(failed)
+	assert.Equal(t, "failed", <-fallback)
+	require.Eventually(t, func() bool { return commits.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	hold.controller.Commit(sent)
+	require.Eventually(t, func() bool { return commits.Load() == 2 }, time.Second, 10*time.Millisecond)
+	assert.True(t, p.Drain(context.Background()), "all events are committed")
+}
+
+// spawnAction spawns the child event for every item of the event and discards the event.
+type spawnAction struct {
+	controller pipeline.ActionPluginController
+}
+
+func (a *spawnAction) Start(_ pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	a.controller = params.Controller
+}
+
+func (a *spawnAction) Stop() {}
+
+func (a *spawnAction) Do(event *pipeline.Event) pipeline.ActionResult {
+	for _, item := range event.Root.Dig("items").AsArray() {
+		if err := a.controller.Spawn(event, []byte(`{"item":`+item.EncodeToString()+`}`)); err != nil {
+			panic(err)
+		}
+	}
+	if event.Root.Dig("keep").AsBool() {
+		return pipeline.ActionPass
+	}
+	return pipeline.ActionDiscard
+}
+
+func (a *spawnAction) RegisterMetrics(_ *metric.Ctl) {}
+
+// markAction marks the events passed the action.
+type markAction struct{}
+
+func (a *markAction) Start(_ pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {}
+
+func (a *markAction) Stop() {}
+
+func (a *markAction) Do(event *pipeline.Event) pipeline.ActionResult {
+	event.Root.AddField("marked").MutateToBool(true)
+	return pipeline.ActionPass
+}
+
+func (a *markAction) RegisterMetrics(_ *metric.Ctl) {}
+
+func TestSpawn(t *testing.T) {
+	spawn := test.NewActionPluginStaticInfo(func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		return &spawnAction{}, nil
+	}, nil, pipeline.MatchModeAnd, nil, false)
+	mark := test.NewActionPluginStaticInfo(func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		return &markAction{}, nil
+	}, nil, pipeline.MatchModeAnd, nil, false)
+	p, input, _ := test.NewPipelineMock(append(spawn, mark...), "passive")
+
+	hold := &holdOutput{events: make(chan *pipeline.Event, 3)}
+	p.SetOutput(&pipeline.OutputPluginInfo{
+		PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "hold"},
+		PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: hold},
+	})
+
+	commits := atomic.NewInt32(0)
+	input.SetCommitFn(func(*pipeline.Event) {
+		commits.Inc()
+	})
+
+	p.Start()
+	defer p.Stop()
+
+	input.In(0, "test.log", 0, []byte(`{"items":[1,2]}`))
+	children := []*pipeline.Event{<-hold.events, <-hold.events}
+	got := []string{children[0].Root.EncodeToString(), children[1].Root.EncodeToString()}
+	sort.Strings(got)
+	assert.Equal(t, []string{`{"item":1,"marked":true}`, `{"item":2,"marked":true}`}, got)
+
+	// the discarded event is committed once all the children are committed
+	hold.controller.Commit(children[0])
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(0), commits.Load())
+	hold.controller.Commit(children[1])
+	require.Eventually(t, func() bool { return commits.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// the event passed further is committed along with the children
+	input.In(0, "test.log", 1, []byte(`{"items":[3],"keep":true}`))
+	events := []*pipeline.Event{<-hold.events, <-hold.events}
+	hold.controller.Commit(events[1])
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), commits.Load())
+	hold.controller.Commit(events[0])
+	require.Eventually(t, func() bool { return commits.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	assert.True(t, p.Drain(context.Background()), "all events are committed")
+}
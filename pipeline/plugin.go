@@ -32,6 +32,13 @@ type ActionPlugin interface {
 	RegisterMetrics(ctl *metric.Ctl)
 }
 
+// NextActionWatcher is implemented by the actions which need the event after the next action of the pipeline, e.g. to diff it.
+// AfterNextAction is called once the next action processes the event or skips it, the status is one of the event statuses
+// like `passed` or `not_matched`. It's called before the discarded event is released, so the event mustn't be kept.
+type NextActionWatcher interface {
+	AfterNextAction(event *Event, status string)
+}
+
 type OutputPlugin interface {
 	Start(config AnyConfig, params *OutputPluginParams)
 	Stop()
@@ -107,6 +114,30 @@ type ActionPluginInfo struct {
 type OutputPluginInfo struct {
 	*PluginStaticInfo
 	*PluginRuntimeInfo
+
+	// RouteTagFilter is nil if the output receives all events.
+	RouteTagFilter *RouteTagFilter
+
+	// MatchConditions route events to the output by their fields.
+	// The output receives all events if there are no conditions.
+	MatchConditions MatchConditions
+	MatchMode       MatchMode
+	MatchInvert     bool
+
+	// Fallback receives the events which the output fails to send, it's nil if the output doesn't have the fallback.
+	Fallback *OutputPluginInfo
+
+	// DiskQueue is nil if the events are passed to the output directly.
+	DiskQueue *DiskQueueConfig
+}
+
+// Match returns true if the event should be routed to the output.
+func (i *OutputPluginInfo) Match(event *Event) bool {
+	if !i.RouteTagFilter.Pass(event) {
+		return false
+	}
+
+	return isMatch(i.MatchConditions, i.MatchMode, event) != i.MatchInvert
 }
 
 type AnyPlugin any
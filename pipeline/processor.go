@@ -49,16 +49,19 @@ func allEventStatuses() []eventStatus {
 
 // processor is a goroutine which doing pipeline actions
 type processor struct {
-	id            int
-	streamer      *streamer
-	metricsHolder *metricsHolder
-	output        OutputPlugin
-	finalize      finalizeFn
+	id              int
+	streamer        *streamer
+	metricsHolder   *metricsHolder
+	outputs         []OutputPlugin
+	outputInfos     []*OutputPluginInfo
+	outputsInFlight []*atomic.Int64
+	finalize        finalizeFn
 
 	activeCounter *atomic.Int32
 
 	actions          []ActionPlugin
 	actionInfos      []*ActionPluginStaticInfo
+	nextWatchers     []NextActionWatcher
 	busyActions      []bool
 	busyActionsTotal int
 	actionWatcher    *actionWatcher
@@ -72,7 +75,7 @@ var id = 0
 func NewProcessor(
 	metricsHolder *metricsHolder,
 	activeCounter *atomic.Int32,
-	output OutputPlugin,
+	outputs []OutputPlugin,
 	streamer *streamer,
 	finalizeFn finalizeFn,
 ) *processor {
@@ -80,7 +83,7 @@ func NewProcessor(
 		id:            id,
 		streamer:      streamer,
 		metricsHolder: metricsHolder,
-		output:        output,
+		outputs:       outputs,
 		finalize:      finalizeFn,
 
 		activeCounter: activeCounter,
@@ -149,13 +152,57 @@ func (p *processor) processSequence(event *Event) bool {
 			return false
 		}
 
-		event.stage = eventStageOutput
-		p.output.Out(event)
+		p.out(event)
 	}
 
 	return isSuccess
 }
 
+// out passes the event to the outputs matching it.
+// Every output except the first one receives a copy of the event, since outputs may modify events.
+// The event is committed once all the outputs commit it.
+func (p *processor) out(event *Event) {
+	// held events may be propagated concurrently, so buffers are local
+	var routedBuf [8]int
+	routed := routedBuf[:0]
+	for i, info := range p.outputInfos {
+		if info.Match(event) {
+			routed = append(routed, i)
+		}
+	}
+
+	if len(routed) == 0 {
+		// no output accepts the event, so it's discarded.
+		p.finalize(event, false, true)
+		return
+	}
+
+	event.stage = eventStageOutput
+	// the event with children may be already referenced by them
+	event.outputs.Add(int32(len(routed)))
+	for _, index := range routed {
+		p.outputsInFlight[index].Inc()
+	}
+
+	// copies are made before passing the event to any output, so they aren't affected by output changes.
+	var copiesBuf [8]*Event
+	copies := copiesBuf[:0]
+	for range routed[1:] {
+		copies = append(copies, event.copyForOutput())
+	}
+
+	holdsRef := event.holdsRef
+	p.outputs[routed[0]].Out(event)
+	for i, index := range routed[1:] {
+		p.outputs[index].Out(copies[i])
+	}
+
+	if holdsRef {
+		// the event is processed, so the processor drops its reference
+		p.finalize(event, true, true)
+	}
+}
+
 func (p *processor) processEvent(event *Event) (isSuccess bool, isPassed bool, e *Event) {
 	for {
 		if event.IsUnlockKind() {
@@ -196,12 +243,16 @@ func (p *processor) doActions(event *Event) (isPassed bool) {
 
 		if !isMatch {
 			p.countEvent(event, index, eventStatusNotMatched)
+			p.notifyNextWatcher(index, event, eventStatusNotMatched)
 			continue
 		}
 
 		p.actionWatcher.setEventBefore(index, event)
 
-		switch action.Do(event) {
+		result := action.Do(event)
+		p.notifyNextWatcher(index, event, resultStatus(result))
+
+		switch result {
 		case ActionPass:
 			p.countEvent(event, index, eventStatusPassed)
 			p.tryResetBusy(index)
@@ -233,6 +284,27 @@ func (p *processor) doActions(event *Event) (isPassed bool) {
 	return true
 }
 
+// notifyNextWatcher notifies the previous action if it watches the action with the index.
+func (p *processor) notifyNextWatcher(index int, event *Event, status eventStatus) {
+	if index == 0 || p.nextWatchers[index-1] == nil {
+		return
+	}
+	p.nextWatchers[index-1].AfterNextAction(event, string(status))
+}
+
+func resultStatus(result ActionResult) eventStatus {
+	switch result {
+	case ActionDiscard:
+		return eventStatusDiscarded
+	case ActionCollapse:
+		return eventStatusCollapse
+	case ActionHold:
+		return eventStatusHold
+	default:
+		return eventStatusPassed
+	}
+}
+
 func (p *processor) tryMarkBusy(index int) {
 	if p.busyActions[index] {
 		return
@@ -271,17 +343,18 @@ func (p *processor) isMatch(index int, event *Event) bool {
 	}
 
 	info := p.actionInfos[index]
-	conds := info.MatchConditions
-	mode := info.MatchMode
+	return isMatch(info.MatchConditions, info.MatchMode, event)
+}
 
+func isMatch(conds MatchConditions, mode MatchMode, event *Event) bool {
 	if mode == MatchModeOr || mode == MatchModeOrPrefix {
-		return p.isMatchOr(conds, event, mode == MatchModeOrPrefix)
+		return isMatchOr(conds, event, mode == MatchModeOrPrefix)
 	} else {
-		return p.isMatchAnd(conds, event, mode == MatchModeAndPrefix)
+		return isMatchAnd(conds, event, mode == MatchModeAndPrefix)
 	}
 }
 
-func (p *processor) isMatchOr(conds MatchConditions, event *Event, byPrefix bool) bool {
+func isMatchOr(conds MatchConditions, event *Event, byPrefix bool) bool {
 	for _, cond := range conds {
 		node := event.Root.Dig(cond.Field...)
 		if node == nil {
@@ -305,7 +378,7 @@ func (p *processor) isMatchOr(conds MatchConditions, event *Event, byPrefix bool
 	return false
 }
 
-func (p *processor) isMatchAnd(conds MatchConditions, event *Event, byPrefix bool) bool {
+func isMatchAnd(conds MatchConditions, event *Event, byPrefix bool) bool {
 	for _, cond := range conds {
 		node := event.Root.Dig(cond.Field...)
 		if node == nil {
@@ -341,6 +414,8 @@ func (p *processor) stop() {
 func (p *processor) AddActionPlugin(info *ActionPluginInfo) {
 	p.actions = append(p.actions, info.Plugin.(ActionPlugin))
 	p.actionInfos = append(p.actionInfos, info.ActionPluginStaticInfo)
+	watcher, _ := info.Plugin.(NextActionWatcher)
+	p.nextWatchers = append(p.nextWatchers, watcher)
 	p.busyActions = append(p.busyActions, false)
 }
 
@@ -353,6 +428,25 @@ func (p *processor) Propagate(event *Event) {
 	p.processSequence(event)
 }
 
+// Spawn creates the child event of the event from the JSON and passes the child through the actions
+// following the current one and to the outputs.
+// The event is committed once it and all its children are committed or discarded.
+func (p *processor) Spawn(event *Event, data []byte) error {
+	child, err := event.spawn(data)
+	if err != nil {
+		return err
+	}
+
+	if !event.holdsRef {
+		event.holdsRef = true
+		event.outputs.Inc()
+	}
+	event.outputs.Inc()
+
+	p.processSequence(child)
+	return nil
+}
+
 func (p *processor) RecoverFromPanic() {
 	p.recoverFromPanic()
 }
@@ -0,0 +1,68 @@
+package pipeline
+
+// RouteTagFilter decides whether an output accepts the event by its route tags.
+// Route tags are set on events by the route_tag action.
+type RouteTagFilter struct {
+	// AcceptTags passes only events having at least one of the tags. Empty list passes all events.
+	AcceptTags []string
+	// RejectTags drops events having at least one of the tags. It has priority over AcceptTags.
+	RejectTags []string
+}
+
+// Pass returns true if the output should receive the event.
+func (f *RouteTagFilter) Pass(event *Event) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, tag := range f.RejectTags {
+		if event.HasRouteTag(tag) {
+			return false
+		}
+	}
+
+	if len(f.AcceptTags) == 0 {
+		return true
+	}
+
+	for _, tag := range f.AcceptTags {
+		if event.HasRouteTag(tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsEmpty returns true if the filter passes all events.
+func (f *RouteTagFilter) IsEmpty() bool {
+	return f == nil || len(f.AcceptTags) == 0 && len(f.RejectTags) == 0
+}
+
+// AddRouteTag marks the event with the route tag.
+func (e *Event) AddRouteTag(tag string) {
+	if e.HasRouteTag(tag) {
+		return
+	}
+	e.routeTags = append(e.routeTags, tag)
+}
+
+// HasRouteTag returns true if the event is marked with the route tag.
+func (e *Event) HasRouteTag(tag string) bool {
+	for _, t := range e.routeTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteTags returns route tags of the event.
+func (e *Event) RouteTags() []string {
+	return e.routeTags
+}
+
+// ResetRouteTags removes all route tags of the event.
+func (e *Event) ResetRouteTags() {
+	e.routeTags = e.routeTags[:0]
+}
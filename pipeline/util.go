@@ -1,8 +1,10 @@
 package pipeline
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 	"unsafe"
@@ -146,11 +148,15 @@ const LevelUnknownStr = ""
 
 // ParseLevelAsString converts log level to the string representation according to the RFC-5424.
 func ParseLevelAsString(level string) string {
-	parsed := ParseLevelAsNumber(level)
-	if parsed == LevelUnknown {
+	return ParseLevelAsNumber(level).String()
+}
+
+// String returns the name of the level according to the RFC-5424.
+func (l LogLevel) String() string {
+	if l < LevelEmergency || l > LevelDebug {
 		return LevelUnknownStr
 	}
-	return levelNames[parsed]
+	return levelNames[l]
 }
 
 // CreateNestedField creates nested field by the path.
@@ -165,3 +171,68 @@ func CreateNestedField(root *insaneJSON.Root, path []string) *insaneJSON.Node {
 	}
 	return curr
 }
+
+// AddField returns the field of the path keeping the existing objects of the path.
+// Unlike CreateNestedField, the last field isn't converted to an object
+// and only non-object fields on the path are overridden. For example, []string{"a", "b"} in:
+// { "a": {"c": 1} }, out: { "a": {"c": 1, "b": <returned field>} }
+func AddField(root *insaneJSON.Root, path []string) *insaneJSON.Node {
+	parent := root.Node
+	for _, name := range path[:len(path)-1] {
+		next := parent.Dig(name)
+		if next == nil || !next.IsObject() {
+			next = parent.AddFieldNoAlloc(root, name).MutateToObject()
+		}
+		parent = next
+	}
+	return parent.AddFieldNoAlloc(root, path[len(path)-1])
+}
+
+// NodeValue converts the node to the value of the types which encoding/json decodes into with UseNumber:
+// nil, bool, string, json.Number, []any and map[string]any. The numbers keep the text of the event.
+func NodeValue(node *insaneJSON.Node) any {
+	return nodeValue(node, func(raw string) any {
+		return json.Number(raw)
+	})
+}
+
+// NodeArithmeticValue is like NodeValue, but the numbers are converted to allow the arithmetic:
+// the numbers without the fraction and the exponent are int and the others are float64.
+func NodeArithmeticValue(node *insaneJSON.Node) any {
+	return nodeValue(node, func(raw string) any {
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return int(i)
+		}
+		f, _ := strconv.ParseFloat(raw, 64)
+		return f
+	})
+}
+
+func nodeValue(node *insaneJSON.Node, number func(raw string) any) any {
+	switch {
+	case node.IsNull():
+		return nil
+	case node.IsNumber():
+		return number(node.AsString())
+	case node.IsTrue():
+		return true
+	case node.IsFalse():
+		return false
+	case node.IsArray():
+		elements := node.AsArray()
+		values := make([]any, 0, len(elements))
+		for _, element := range elements {
+			values = append(values, nodeValue(element, number))
+		}
+		return values
+	case node.IsObject():
+		fields := node.AsFields()
+		values := make(map[string]any, len(fields))
+		for _, field := range fields {
+			values[field.AsString()] = nodeValue(field.AsFieldValue(), number)
+		}
+		return values
+	default:
+		return node.AsString()
+	}
+}
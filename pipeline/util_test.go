@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -95,6 +96,53 @@ func TestCreateNestedFieldPositive(t *testing.T) {
 	}
 }
 
+func TestAddField(t *testing.T) {
+	tests := []struct {
+		root string
+		path []string
+		want string
+	}{
+		{root: `{}`, path: []string{"a"}, want: `{"a":"v"}`},
+		{root: `{}`, path: []string{"a", "b"}, want: `{"a":{"b":"v"}}`},
+		{root: `{"a":{"c":1}}`, path: []string{"a", "b"}, want: `{"a":{"c":1,"b":"v"}}`},
+		{root: `{"a":{"b":1}}`, path: []string{"a", "b"}, want: `{"a":{"b":"v"}}`},
+		{root: `{"a":[1]}`, path: []string{"a", "b"}, want: `{"a":{"b":"v"}}`},
+	}
+
+	for _, tt := range tests {
+		root, err := insaneJSON.DecodeString(tt.root)
+		require.NoError(t, err)
+
+		AddField(root, tt.path).MutateToString("v")
+		require.Equal(t, tt.want, root.EncodeToString(), "wrong result for %s and path %v", tt.root, tt.path)
+		insaneJSON.Release(root)
+	}
+}
+
+func TestNodeValue(t *testing.T) {
+	root, err := insaneJSON.DecodeString(`{"s":"v","i":10,"f":1.50,"e":1e3,"b":[true,false,null],"o":{"a":-1}}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(root)
+
+	require.Equal(t, map[string]any{
+		"s": "v",
+		"i": json.Number("10"),
+		"f": json.Number("1.50"),
+		"e": json.Number("1e3"),
+		"b": []any{true, false, nil},
+		"o": map[string]any{"a": json.Number("-1")},
+	}, NodeValue(root.Node))
+
+	require.Equal(t, map[string]any{
+		"s": "v",
+		"i": 10,
+		"f": 1.5,
+		"e": float64(1000),
+		"b": []any{true, false, nil},
+		"o": map[string]any{"a": -1},
+	}, NodeArithmeticValue(root.Node))
+}
+
 func TestLevelParsing(t *testing.T) {
 	testData := []string{"0", "1", "2", "3", "4", "5", "6", "7"}
 	for _, level := range testData {
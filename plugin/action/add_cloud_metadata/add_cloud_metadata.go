@@ -0,0 +1,206 @@
+package add_cloud_metadata
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It adds the cloud instance metadata to the events. The metadata is requested from the instance metadata service
+of AWS EC2, Google Compute Engine or Azure once on the start and is added to every event, like `add_host` but for the cloud context.
+
+The `fields` map the event fields to the metadata keys:
+* `provider` – `aws`, `gcp` or `azure`
+* `instance_id`, `instance_type`, `image_id`, `hostname`, `private_ip`
+* `account_id` – the AWS account ID, the GCP project ID or the Azure subscription ID
+* `region`, `availability_zone` – the region and the zone of the instance, the Azure zone is empty for the instances without the zone
+* `tag:<name>` – the instance tag, it's the custom metadata attribute on GCP;
+the access to the tags in the instance metadata must be allowed on AWS
+
+The missing and the empty values aren't added. AWS is requested with the IMDSv2 session token.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: add_cloud_metadata
+      provider: auto
+      fields:
+        cloud.provider: provider
+        cloud.instance_id: instance_id
+        cloud.region: region
+        cloud.az: availability_zone
+        cloud.team: tag:team
+    ...
+```
+It transforms `{"message":"hello"}` into
+`{"message":"hello","cloud":{"provider":"aws","instance_id":"i-0abc","region":"eu-west-1","az":"eu-west-1a","team":"search"}}`.
+}*/
+
+var (
+	metadataMu = &sync.Mutex{}
+	// metadata is requested once for all the processors of the action.
+	metadata = make(map[*Config]*metadataRef)
+)
+
+type metadataRef struct {
+	values map[string]string
+	refs   int
+}
+
+// defaultFields are used if the fields aren't set.
+var defaultFields = map[string]string{
+	"cloud.provider":          keyProvider,
+	"cloud.instance_id":       keyInstanceID,
+	"cloud.region":            keyRegion,
+	"cloud.availability_zone": keyAvailabilityZone,
+}
+
+type field struct {
+	path  []string
+	value string
+}
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	fields []field
+	// fetched is true if the processor holds the metadata of the action
+	fetched bool
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The cloud provider. `auto` tries AWS, GCP and Azure in order and uses the first available metadata service.
+	Provider string `json:"provider" default:"auto" options:"auto|aws|gcp|azure"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The map of the field selectors to the metadata keys.
+	// > The `cloud.provider`, `cloud.instance_id`, `cloud.region` and `cloud.availability_zone` fields are added if it isn't set.
+	Fields map[string]string `json:"fields"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The timeout of requesting the metadata service of each provider.
+	Timeout  cfg.Duration `json:"timeout" default:"2s" parse:"duration"` // *
+	Timeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > If set, file.d fails to start if the metadata can't be requested,
+	// > otherwise the error is logged and the events are passed as is.
+	FailOnError bool `json:"fail_on_error"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "add_cloud_metadata",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	fields := p.config.Fields
+	if len(fields) == 0 {
+		fields = defaultFields
+	}
+
+	names := make([]string, 0, len(fields))
+	tags := make([]string, 0)
+	for name, key := range fields {
+		if !isKnownKey(key) {
+			p.logger.Fatalf("unknown metadata key %q of field %q", key, name)
+		}
+		if strings.HasPrefix(key, keyTagPrefix) {
+			tags = append(tags, strings.TrimPrefix(key, keyTagPrefix))
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(tags)
+
+	values, err := p.fetch(tags)
+	if err != nil {
+		if p.config.FailOnError {
+			p.logger.Fatalf("can't get cloud metadata: %s", err.Error())
+		}
+		p.logger.Errorf("can't get cloud metadata, events will be passed as is: %s", err.Error())
+		return
+	}
+	p.fetched = true
+
+	for _, name := range names {
+		path := cfg.ParseFieldSelector(name)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in fields")
+		}
+		if value := values[fields[name]]; value != "" {
+			p.fields = append(p.fields, field{path: path, value: value})
+		}
+	}
+}
+
+// fetch requests the metadata once for all the processors of the action.
+func (p *Plugin) fetch(tags []string) (map[string]string, error) {
+	metadataMu.Lock()
+	defer metadataMu.Unlock()
+
+	if ref, has := metadata[p.config]; has {
+		ref.refs++
+		return ref.values, nil
+	}
+
+	values, err := fetchMetadata(p.config.Provider, p.config.Timeout_, tags)
+	if err != nil {
+		return nil, err
+	}
+	p.logger.Infof("cloud metadata of %s instance %s is requested", values[keyProvider], values[keyInstanceID])
+
+	metadata[p.config] = &metadataRef{values: values, refs: 1}
+	return values, nil
+}
+
+// Stop removes the metadata once the last processor of the action is stopped.
+func (p *Plugin) Stop() {
+	if !p.fetched {
+		return
+	}
+
+	metadataMu.Lock()
+	defer metadataMu.Unlock()
+
+	ref := metadata[p.config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(metadata, p.config)
+	}
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	for _, f := range p.fields {
+		pipeline.AddField(event.Root, f.path).MutateToString(f.value)
+	}
+	return pipeline.ActionPass
+}
@@ -0,0 +1,237 @@
+package add_cloud_metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newAWSServer(t *testing.T) *httptest.Server {
+	const token = "secret"
+	values := map[string]string{
+		"/latest/dynamic/instance-identity/document": `{"instanceId":"i-0abc","instanceType":"m5.large","imageId":"ami-1","accountId":"123456789012","region":"eu-west-1","availabilityZone":"eu-west-1a","privateIp":"10.0.0.1"}`,
+		"/latest/meta-data/hostname":                 "ip-10-0-0-1.eu-west-1.compute.internal",
+		"/latest/meta-data/tags/instance/team":       "search",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(token))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		value, has := values[r.URL.Path]
+		if !has {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(value))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newGCPServer(t *testing.T) *httptest.Server {
+	values := map[string]string{
+		"/computeMetadata/v1/instance/id":                      "4520031799277581759",
+		"/computeMetadata/v1/instance/machine-type":            "projects/123/machineTypes/e2-medium",
+		"/computeMetadata/v1/instance/image":                   "projects/debian-cloud/global/images/debian-11",
+		"/computeMetadata/v1/project/project-id":               "my-project",
+		"/computeMetadata/v1/instance/zone":                    "projects/123/zones/us-central1-a",
+		"/computeMetadata/v1/instance/hostname":                "vm.c.my-project.internal",
+		"/computeMetadata/v1/instance/network-interfaces/0/ip": "10.128.0.2",
+		"/computeMetadata/v1/instance/attributes/team":         "search",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, has := values[r.URL.Path]
+		if r.Header.Get("Metadata-Flavor") != "Google" || !has {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(value))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newAzureServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"compute": {
+				"vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+				"vmSize": "Standard_A3",
+				"subscriptionId": "xxxxxxxx-xxxx",
+				"location": "westeurope",
+				"zone": "1",
+				"osProfile": {"computerName": "examplevmname"},
+				"storageProfile": {"imageReference": {"id": "", "sku": "2019-Datacenter"}},
+				"tagsList": [{"name": "env", "value": "prod"}, {"name": "team", "value": "search"}]
+			},
+			"network": {"interface": [{"ipv4": {"ipAddress": [{"privateIpAddress": "10.144.133.132"}]}}]}
+		}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setEndpoints(t *testing.T, aws, gcp, azure string) {
+	prevAWS, prevGCP, prevAzure := awsEndpoint, gcpEndpoint, azureEndpoint
+	awsEndpoint, gcpEndpoint, azureEndpoint = aws, gcp, azure
+	t.Cleanup(func() {
+		awsEndpoint, gcpEndpoint, azureEndpoint = prevAWS, prevGCP, prevAzure
+	})
+}
+
+func TestAddCloudMetadata(t *testing.T) {
+	fields := map[string]string{
+		"cloud.provider": "provider",
+		"cloud.id":       "instance_id",
+		"cloud.type":     "instance_type",
+		"cloud.image":    "image_id",
+		"cloud.account":  "account_id",
+		"cloud.region":   "region",
+		"cloud.az":       "availability_zone",
+		"cloud.host":     "hostname",
+		"cloud.ip":       "private_ip",
+		"cloud.team":     "tag:team",
+		"cloud.missing":  "tag:missing",
+	}
+
+	// the unavailable endpoint
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	cases := []struct {
+		name     string
+		provider string
+		setup    func(t *testing.T)
+		out      string
+	}{
+		{
+			name:     "aws",
+			provider: "aws",
+			setup: func(t *testing.T) {
+				setEndpoints(t, newAWSServer(t).URL, closed.URL, closed.URL)
+			},
+			out: `{"message":"hello","cloud":{"x":1,"account":"123456789012","az":"eu-west-1a","host":"ip-10-0-0-1.eu-west-1.compute.internal","id":"i-0abc","image":"ami-1","ip":"10.0.0.1","provider":"aws","region":"eu-west-1","team":"search","type":"m5.large"}}`,
+		},
+		{
+			name:     "gcp auto",
+			provider: "auto",
+			setup: func(t *testing.T) {
+				setEndpoints(t, closed.URL, newGCPServer(t).URL, closed.URL)
+			},
+			out: `{"message":"hello","cloud":{"x":1,"account":"my-project","az":"us-central1-a","host":"vm.c.my-project.internal","id":"4520031799277581759","image":"debian-11","ip":"10.128.0.2","provider":"gcp","region":"us-central1","team":"search","type":"e2-medium"}}`,
+		},
+		{
+			name:     "azure auto",
+			provider: "auto",
+			setup: func(t *testing.T) {
+				setEndpoints(t, closed.URL, closed.URL, newAzureServer(t).URL)
+			},
+			out: `{"message":"hello","cloud":{"x":1,"account":"xxxxxxxx-xxxx","az":"1","host":"examplevmname","id":"02aab8a4-74ef-476e-8182-f6d2ba4166a6","image":"2019-Datacenter","ip":"10.144.133.132","provider":"azure","region":"westeurope","team":"search","type":"Standard_A3"}}`,
+		},
+		{
+			name:     "unavailable",
+			provider: "auto",
+			setup: func(t *testing.T) {
+				setEndpoints(t, closed.URL, closed.URL, closed.URL)
+			},
+			out: `{"message":"hello","cloud":{"x":1}}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setup(t)
+
+			config := test.NewConfig(&Config{Provider: tc.provider, Fields: fields}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(`{"message":"hello","cloud":{"x":1}}`))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
+
+func TestDefaultFields(t *testing.T) {
+	setEndpoints(t, newAWSServer(t).URL, "", "")
+
+	config := test.NewConfig(&Config{Provider: "aws"}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	outEvent := ""
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvent = e.Root.EncodeToString()
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{}`))
+
+	wg.Wait()
+	p.Stop()
+
+	assert.Equal(t, `{"cloud":{"availability_zone":"eu-west-1a","instance_id":"i-0abc","provider":"aws","region":"eu-west-1"}}`, outEvent)
+	metadataMu.Lock()
+	assert.NotContains(t, metadata, config, "metadata isn't removed once the pipeline is stopped")
+	metadataMu.Unlock()
+}
+
+func TestSharedMetadata(t *testing.T) {
+	setEndpoints(t, newAWSServer(t).URL, "", "")
+
+	config := test.NewConfig(&Config{Provider: "aws"}, nil).(*Config)
+	p := &Plugin{}
+	p.Start(config, &pipeline.ActionPluginParams{Logger: zap.NewExample().Sugar()})
+
+	// the metadata is requested once for the config
+	setEndpoints(t, "", "", "")
+	p2 := &Plugin{}
+	p2.Start(config, &pipeline.ActionPluginParams{Logger: zap.NewExample().Sugar()})
+
+	metadataMu.Lock()
+	require.Contains(t, metadata, config)
+	assert.Equal(t, 2, metadata[config].refs)
+	assert.Equal(t, "i-0abc", metadata[config].values["instance_id"])
+	metadataMu.Unlock()
+
+	// the metadata is removed once the last processor is stopped
+	p.Stop()
+	metadataMu.Lock()
+	assert.Contains(t, metadata, config)
+	metadataMu.Unlock()
+	p2.Stop()
+	metadataMu.Lock()
+	assert.NotContains(t, metadata, config)
+	metadataMu.Unlock()
+}
@@ -0,0 +1,284 @@
+package add_cloud_metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	providerAuto  = "auto"
+	providerAWS   = "aws"
+	providerGCP   = "gcp"
+	providerAzure = "azure"
+
+	keyProvider         = "provider"
+	keyInstanceID       = "instance_id"
+	keyInstanceType     = "instance_type"
+	keyImageID          = "image_id"
+	keyAccountID        = "account_id"
+	keyRegion           = "region"
+	keyAvailabilityZone = "availability_zone"
+	keyHostname         = "hostname"
+	keyPrivateIP        = "private_ip"
+	keyTagPrefix        = "tag:"
+
+	maxResponseSize = 1024 * 1024
+)
+
+// the endpoints are variables to point them to the test servers
+var (
+	awsEndpoint   = "http://169.254.169.254"
+	gcpEndpoint   = "http://metadata.google.internal"
+	azureEndpoint = "http://169.254.169.254"
+)
+
+var errNotFound = errors.New("not found")
+
+var keys = []string{
+	keyProvider, keyInstanceID, keyInstanceType, keyImageID, keyAccountID,
+	keyRegion, keyAvailabilityZone, keyHostname, keyPrivateIP,
+}
+
+func isKnownKey(key string) bool {
+	if strings.HasPrefix(key, keyTagPrefix) {
+		return len(key) > len(keyTagPrefix)
+	}
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// fetcher requests the metadata service of the provider, tags are the names of the instance tags to request.
+type fetcher func(ctx context.Context, client *http.Client, tags []string) (map[string]string, error)
+
+var fetchers = map[string]fetcher{
+	providerAWS:   fetchAWS,
+	providerGCP:   fetchGCP,
+	providerAzure: fetchAzure,
+}
+
+// fetchMetadata requests the metadata of the provider,
+// the auto provider tries AWS, GCP and Azure in order and returns the metadata of the first available one.
+func fetchMetadata(provider string, timeout time.Duration, tags []string) (map[string]string, error) {
+	client := &http.Client{Timeout: timeout}
+	providers := []string{provider}
+	if provider == providerAuto {
+		providers = []string{providerAWS, providerGCP, providerAzure}
+	}
+
+	errs := make([]string, 0, len(providers))
+	for _, name := range providers {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		metadata, err := fetchers[name](ctx, client, tags)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err.Error()))
+			continue
+		}
+		metadata[keyProvider] = name
+		return metadata, nil
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+func request(ctx context.Context, client *http.Client, method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: unexpected status %d", method, url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// fetchAWS requests the EC2 instance metadata service with the IMDSv2 session token.
+// The instance tags are available only if the access to them is allowed in the instance metadata options.
+func fetchAWS(ctx context.Context, client *http.Client, tags []string) (map[string]string, error) {
+	token, err := request(ctx, client, http.MethodPut, awsEndpoint+"/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't get token: %w", err)
+	}
+	headers := map[string]string{"X-aws-ec2-metadata-token": string(token)}
+
+	data, err := request(ctx, client, http.MethodGet, awsEndpoint+"/latest/dynamic/instance-identity/document", headers)
+	if err != nil {
+		return nil, fmt.Errorf("can't get identity document: %w", err)
+	}
+	doc := struct {
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		ImageID          string `json:"imageId"`
+		AccountID        string `json:"accountId"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		PrivateIP        string `json:"privateIp"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("can't parse identity document: %w", err)
+	}
+
+	metadata := map[string]string{
+		keyInstanceID:       doc.InstanceID,
+		keyInstanceType:     doc.InstanceType,
+		keyImageID:          doc.ImageID,
+		keyAccountID:        doc.AccountID,
+		keyRegion:           doc.Region,
+		keyAvailabilityZone: doc.AvailabilityZone,
+		keyPrivateIP:        doc.PrivateIP,
+	}
+
+	hostname, err := request(ctx, client, http.MethodGet, awsEndpoint+"/latest/meta-data/hostname", headers)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("can't get hostname: %w", err)
+	}
+	metadata[keyHostname] = string(hostname)
+
+	for _, tag := range tags {
+		value, err := request(ctx, client, http.MethodGet, awsEndpoint+"/latest/meta-data/tags/instance/"+tag, headers)
+		if err != nil && !errors.Is(err, errNotFound) {
+			return nil, fmt.Errorf("can't get tag %q: %w", tag, err)
+		}
+		metadata[keyTagPrefix+tag] = string(value)
+	}
+
+	return metadata, nil
+}
+
+// fetchGCP requests the GCE metadata server, the instance tags are the custom metadata attributes of the instance.
+func fetchGCP(ctx context.Context, client *http.Client, tags []string) (map[string]string, error) {
+	headers := map[string]string{"Metadata-Flavor": "Google"}
+	paths := map[string]string{
+		keyInstanceID:       "/instance/id",
+		keyInstanceType:     "/instance/machine-type",
+		keyImageID:          "/instance/image",
+		keyAccountID:        "/project/project-id",
+		keyAvailabilityZone: "/instance/zone",
+		keyHostname:         "/instance/hostname",
+		keyPrivateIP:        "/instance/network-interfaces/0/ip",
+	}
+	for _, tag := range tags {
+		paths[keyTagPrefix+tag] = "/instance/attributes/" + tag
+	}
+
+	metadata := make(map[string]string, len(paths)+1)
+	for key, path := range paths {
+		value, err := request(ctx, client, http.MethodGet, gcpEndpoint+"/computeMetadata/v1"+path, headers)
+		if err != nil && !errors.Is(err, errNotFound) {
+			return nil, fmt.Errorf("can't get %s: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+
+	// the values are like projects/123/machineTypes/e2-medium and projects/123/zones/us-central1-a
+	metadata[keyInstanceType] = lastSegment(metadata[keyInstanceType])
+	metadata[keyImageID] = lastSegment(metadata[keyImageID])
+	zone := lastSegment(metadata[keyAvailabilityZone])
+	metadata[keyAvailabilityZone] = zone
+	if pos := strings.LastIndexByte(zone, '-'); pos > 0 {
+		metadata[keyRegion] = zone[:pos]
+	}
+
+	return metadata, nil
+}
+
+// fetchAzure requests the Azure instance metadata service.
+func fetchAzure(ctx context.Context, client *http.Client, tags []string) (map[string]string, error) {
+	headers := map[string]string{"Metadata": "true"}
+	data, err := request(ctx, client, http.MethodGet, azureEndpoint+"/metadata/instance?api-version=2021-02-01", headers)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := struct {
+		Compute struct {
+			VMID           string `json:"vmId"`
+			VMSize         string `json:"vmSize"`
+			SubscriptionID string `json:"subscriptionId"`
+			Location       string `json:"location"`
+			Zone           string `json:"zone"`
+			OSProfile      struct {
+				ComputerName string `json:"computerName"`
+			} `json:"osProfile"`
+			StorageProfile struct {
+				ImageReference struct {
+					ID  string `json:"id"`
+					SKU string `json:"sku"`
+				} `json:"imageReference"`
+			} `json:"storageProfile"`
+			TagsList []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"tagsList"`
+		} `json:"compute"`
+		Network struct {
+			Interface []struct {
+				IPv4 struct {
+					IPAddress []struct {
+						PrivateIPAddress string `json:"privateIpAddress"`
+					} `json:"ipAddress"`
+				} `json:"ipv4"`
+			} `json:"interface"`
+		} `json:"network"`
+	}{}
+	if err := json.Unmarshal(data, &instance); err != nil {
+		return nil, fmt.Errorf("can't parse instance metadata: %w", err)
+	}
+
+	compute := instance.Compute
+	metadata := map[string]string{
+		keyInstanceID:       compute.VMID,
+		keyInstanceType:     compute.VMSize,
+		keyAccountID:        compute.SubscriptionID,
+		keyRegion:           compute.Location,
+		keyAvailabilityZone: compute.Zone,
+		keyHostname:         compute.OSProfile.ComputerName,
+		keyImageID:          compute.StorageProfile.ImageReference.ID,
+	}
+	if metadata[keyImageID] == "" {
+		metadata[keyImageID] = compute.StorageProfile.ImageReference.SKU
+	}
+	if ifaces := instance.Network.Interface; len(ifaces) > 0 && len(ifaces[0].IPv4.IPAddress) > 0 {
+		metadata[keyPrivateIP] = ifaces[0].IPv4.IPAddress[0].PrivateIPAddress
+	}
+
+	for _, tag := range tags {
+		metadata[keyTagPrefix+tag] = ""
+		for _, t := range compute.TagsList {
+			if t.Name == tag {
+				metadata[keyTagPrefix+tag] = t.Value
+				break
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+func lastSegment(s string) string {
+	return s[strings.LastIndexByte(s, '/')+1:]
+}
@@ -1,19 +1,67 @@
 package add_host
 
 import (
+	"net"
 	"os"
+	"sort"
+	"strings"
 
+	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/zap"
 )
 
 /*{ introduction
 It adds field containing hostname to an event.
+
+It may also add the fully qualified domain name, the IP addresses of the host and the static identity fields.
+All the values are resolved once on the start.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: add_host
+      field: host.name
+      fqdn_field: host.fqdn
+      ip_field: host.ip
+      fields:
+        host.datacenter: dc1
+        host.role: ${ROLE}
+    ...
+```
+It transforms `{"message":"hello"}` into
+`{"message":"hello","host":{"name":"web-1","fqdn":"web-1.dc1.example.com","datacenter":"dc1","role":"frontend","ip":["10.0.0.5"]}}`.
 }*/
 
+const (
+	ipVersionAny = "any"
+	ipVersion4   = "ipv4"
+	ipVersion6   = "ipv6"
+)
+
+// the lookups are variables to replace them in the tests
+var (
+	interfaceAddrs = net.InterfaceAddrs
+	lookupCNAME    = net.LookupCNAME
+	lookupHost     = net.LookupHost
+	lookupAddr     = net.LookupAddr
+)
+
+type field struct {
+	path  []string
+	value string
+}
+
 type Plugin struct {
 	config *Config
+	logger *zap.SugaredLogger
+	fields []field
+	ips    []string
 	plugin.NoMetricsPlugin
 }
 
@@ -23,7 +71,33 @@ type Config struct {
 	// > @3@4@5@6
 	// >
 	// > The event field to which put the hostname. Must be a string.
-	Field string `json:"field" default:"host" required:"true"` // *
+	Field  cfg.FieldSelector `json:"field" default:"host" required:"true" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field to which put the fully qualified domain name of the host.
+	// > The name is resolved by the DNS, it's the hostname if it can't be resolved. It isn't added if it's empty.
+	FQDNField  cfg.FieldSelector `json:"fqdn_field" parse:"selector"` // *
+	FQDNField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field to which put the array of the IP addresses of the host interfaces,
+	// > the loopback and the link-local addresses are skipped. It isn't added if it's empty.
+	IPField  cfg.FieldSelector `json:"ip_field" parse:"selector"` // *
+	IPField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The IP addresses to put into `ip_field`.
+	IPVersion string `json:"ip_version" default:"any" options:"any|ipv4|ipv6"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The map of the field selectors to the static values, e.g. the datacenter or the role of the host.
+	// > The environment variables like `${ROLE}` in the values are expanded on the start.
+	Fields map[string]string `json:"fields"` // *
 }
 
 func init() {
@@ -37,17 +111,115 @@ func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 	return &Plugin{}, &Config{}
 }
 
-func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
 	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		p.logger.Errorf("can't get hostname: %s", err.Error())
+	}
+	p.fields = append(p.fields, field{path: p.config.Field_, value: hostname})
+
+	if len(p.config.FQDNField_) > 0 {
+		p.fields = append(p.fields, field{path: p.config.FQDNField_, value: resolveFQDN(hostname)})
+	}
+
+	if len(p.config.IPField_) > 0 {
+		p.ips, err = hostIPs(p.config.IPVersion)
+		if err != nil {
+			p.logger.Errorf("can't get host IP addresses: %s", err.Error())
+		}
+	}
+
+	names := make([]string, 0, len(p.config.Fields))
+	for name := range p.config.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := cfg.ParseFieldSelector(name)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in fields")
+		}
+		p.fields = append(p.fields, field{path: path, value: os.ExpandEnv(p.config.Fields[name])})
+	}
+}
+
+// resolveFQDN returns the canonical name of the host or the name of its address.
+func resolveFQDN(hostname string) string {
+	if cname, err := lookupCNAME(hostname); err == nil {
+		if cname = strings.TrimSuffix(cname, "."); strings.Contains(cname, ".") {
+			return cname
+		}
+	}
+
+	addrs, err := lookupHost(hostname)
+	if err != nil {
+		return hostname
+	}
+	for _, addr := range addrs {
+		names, err := lookupAddr(addr)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if name = strings.TrimSuffix(name, "."); strings.Contains(name, ".") {
+				return name
+			}
+		}
+	}
+	return hostname
+}
+
+// hostIPs returns the addresses of the interfaces, the IPv4 addresses go first.
+func hostIPs(version string) ([]string, error) {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ipv4, ipv6 []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+			continue
+		}
+		if ip.To4() != nil {
+			ipv4 = append(ipv4, ip.String())
+		} else {
+			ipv6 = append(ipv6, ip.String())
+		}
+	}
+
+	switch version {
+	case ipVersion4:
+		return ipv4, nil
+	case ipVersion6:
+		return ipv6, nil
+	default:
+		return append(ipv4, ipv6...), nil
+	}
 }
 
 func (p *Plugin) Stop() {
 }
 
 func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
-	hostname, _ := os.Hostname()
+	for _, f := range p.fields {
+		pipeline.AddField(event.Root, f.path).MutateToString(f.value)
+	}
 
-	event.Root.AddFieldNoAlloc(event.Root, p.config.Field).MutateToString(hostname)
+	if len(p.config.IPField_) > 0 {
+		ips := pipeline.AddField(event.Root, p.config.IPField_).MutateToArray()
+		for _, ip := range p.ips {
+			ips.AddElementNoAlloc(event.Root).MutateToString(ip)
+		}
+	}
 
 	return pipeline.ActionPass
 }
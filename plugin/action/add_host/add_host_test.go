@@ -1,6 +1,7 @@
 package add_host
 
 import (
+	"net"
 	"os"
 	"sync"
 	"testing"
@@ -8,6 +9,7 @@ import (
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestModify(t *testing.T) {
@@ -32,3 +34,59 @@ func TestModify(t *testing.T) {
 	assert.Equal(t, 1, len(outEvents), "wrong out events count")
 	assert.Equal(t, host, outEvents[0].Root.Dig("hostname").AsString(), "wrong field value")
 }
+
+func TestIdentity(t *testing.T) {
+	prevAddrs, prevCNAME, prevHost, prevAddr := interfaceAddrs, lookupCNAME, lookupHost, lookupAddr
+	defer func() {
+		interfaceAddrs, lookupCNAME, lookupHost, lookupAddr = prevAddrs, prevCNAME, prevHost, prevAddr
+	}()
+
+	interfaceAddrs = func() ([]net.Addr, error) {
+		addrs := make([]net.Addr, 0)
+		for _, s := range []string{"127.0.0.1/8", "fe80::1/64", "2001:db8::5/64", "10.0.0.5/24", "::1/128"} {
+			ip, ipNet, err := net.ParseCIDR(s)
+			require.NoError(t, err)
+			ipNet.IP = ip
+			addrs = append(addrs, ipNet)
+		}
+		return addrs, nil
+	}
+	lookupCNAME = func(host string) (string, error) {
+		return host + ".", nil
+	}
+	lookupHost = func(_ string) ([]string, error) {
+		return []string{"10.0.0.5"}, nil
+	}
+	lookupAddr = func(_ string) ([]string, error) {
+		return []string{"web-1.dc1.example.com."}, nil
+	}
+	t.Setenv("ADD_HOST_TEST_ROLE", "frontend")
+
+	config := test.NewConfig(&Config{
+		Field:     "host.name",
+		FQDNField: "host.fqdn",
+		IPField:   "host.ip",
+		Fields:    map[string]string{"host.role": "${ADD_HOST_TEST_ROLE}", "dc": "dc1"},
+	}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	outEvent := ""
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvent = e.Root.EncodeToString()
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"host":{"id":1}}`))
+
+	wg.Wait()
+	p.Stop()
+
+	host, _ := os.Hostname()
+	assert.Equal(t, `{"host":{"id":1,"name":"`+host+`","fqdn":"web-1.dc1.example.com","role":"frontend","ip":["10.0.0.5","2001:db8::5"]},"dc":"dc1"}`, outEvent)
+
+	ips, err := hostIPs(ipVersion6)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::5"}, ips)
+}
@@ -0,0 +1,361 @@
+package aggregate
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It aggregates the events grouped by the `group_by` fields over the tumbling time windows:
+it counts the events and computes the sum, the min, the max and the `percentiles` of the `values` fields.
+The aggregates of the ended window are emitted as the summary events and/or exported as the prometheus metrics.
+
+The events of all the processors of the pipeline are aggregated together, the windows are aligned
+to the processing time. The window ends with the first event after its end, so the summary events are spawned
+from this event, pass the following actions and go to the outputs. The summary events aren't emitted until
+the next event arrives and are lost if the pipeline is stopped.
+
+The summary event has the `marker` field, the group fields, `window_start`, `window_end` and `count`.
+For every value field it has `<name>_sum`, `<name>_min`, `<name>_max` and `<name>_p<percentile>` fields,
+where the name is the field selector with `_` instead of `.`, e.g. `request_time_p99`.
+The group values are strings, the missing group fields are empty strings.
+The missing or non-numeric value fields are skipped. The percentiles are estimated with 1% relative error.
+
+The prometheus metrics are `<metric_name>_events_total` and `<metric_name>_sum_total` counters
+and `<metric_name>_percentile` gauge updated once the window ends. Their labels are the group fields
+with `_` instead of the non-alphanumeric characters, `field` and `percentile`.
+The negative values aren't added to the `<metric_name>_sum_total` counter.
+
+**Example:**
+Counting the requests of the services by status and estimating their durations:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: aggregate
+      group_by: [service, status]
+      values: [request_time]
+      percentiles: ["50", "99"]
+      window: 1m
+      discard: true
+    ...
+```
+The summary event looks like:
+```json
+{
+  "aggregate": "true",
+  "window_start": "2023-05-01T10:20:00Z",
+  "window_end": "2023-05-01T10:21:00Z",
+  "service": "api",
+  "status": "200",
+  "count": 1200,
+  "request_time_sum": 60.5,
+  "request_time_min": 0.01,
+  "request_time_max": 1.3,
+  "request_time_p50": 0.04,
+  "request_time_p99": 0.8
+}
+```
+}*/
+
+const (
+	emitEvents  = "events"
+	emitMetrics = "metrics"
+	emitBoth    = "both"
+)
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.SugaredLogger
+	controller pipeline.ActionPluginController
+	aggregator *aggregator
+
+	groupBy     [][]string
+	values      [][]string
+	valueNames  []string
+	percentiles []float64
+	labels      []string
+
+	keyBuf      []byte
+	groupValues []string
+	valuesBuf   []float64
+	root        *insaneJSON.Root
+	buf         []byte
+
+	metricCtl        *metric.Ctl
+	eventsMetric     *prom.CounterVec
+	sumMetric        *prom.CounterVec
+	percentileMetric *prom.GaugeVec
+	overflowMetric   *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The fields to group the events by.
+	GroupBy []string `json:"group_by" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The numeric fields to aggregate.
+	Values []string `json:"values" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The percentiles of the values to estimate, e.g. `99.9`.
+	Percentiles []string `json:"percentiles" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The duration of the window.
+	Window  cfg.Duration `json:"window" default:"1m" parse:"duration"` // *
+	Window_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > The maximum number of the groups in the window, the events of the new groups aren't aggregated once it's reached.
+	MaxGroups int `json:"max_groups" default:"10000"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How to emit the aggregates.
+	Emit string `json:"emit" default:"events" options:"events|metrics|both"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field added to the summary events with `true` value.
+	Marker  cfg.FieldSelector `json:"marker" default:"aggregate" parse:"selector"` // *
+	Marker_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The prefix of the prometheus metrics.
+	MetricName string `json:"metric_name" default:"aggregate"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Whether to discard the aggregated events, so only the summary events go further.
+	Discard bool `json:"discard"` // *
+}
+
+var (
+	aggregatorsMu = &sync.Mutex{}
+	aggregators   = make(map[*Config]*aggregator)
+)
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "aggregate",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.controller = params.Controller
+	p.root = insaneJSON.Spawn()
+
+	if p.config.Window_ <= 0 {
+		p.logger.Fatalf("window must be positive")
+	}
+	if len(p.config.Marker_) == 0 {
+		p.logger.Fatalf("marker must be set")
+	}
+
+	for _, field := range p.config.GroupBy {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in group_by")
+		}
+		p.groupBy = append(p.groupBy, path)
+		p.labels = append(p.labels, labelName(field))
+	}
+	for _, field := range p.config.Values {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in values")
+		}
+		p.values = append(p.values, path)
+		p.valueNames = append(p.valueNames, strings.Join(path, "_"))
+	}
+	for _, percentile := range p.config.Percentiles {
+		v, err := strconv.ParseFloat(percentile, 64)
+		if err != nil || v < 0 || v > 100 {
+			p.logger.Fatalf("wrong percentile %q, it must be in [0, 100]", percentile)
+		}
+		p.percentiles = append(p.percentiles, v)
+	}
+
+	p.groupValues = make([]string, len(p.groupBy))
+	p.valuesBuf = make([]float64, len(p.values))
+
+	aggregatorsMu.Lock()
+	p.aggregator = aggregators[p.config]
+	if p.aggregator == nil {
+		p.aggregator = newAggregator(p.config.Window_, p.config.MaxGroups, len(p.values))
+		aggregators[p.config] = p.aggregator
+	}
+	aggregatorsMu.Unlock()
+
+	if p.config.Emit != emitEvents {
+		p.registerAggregateMetrics()
+	}
+}
+
+func (p *Plugin) Stop() {
+	insaneJSON.Release(p.root)
+
+	aggregatorsMu.Lock()
+	delete(aggregators, p.config)
+	aggregatorsMu.Unlock()
+}
+
+// RegisterMetrics registers the metrics of the plugin, the metrics of the aggregates depend on the config,
+// so they are registered on the start.
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.metricCtl = ctl
+	p.overflowMetric = ctl.RegisterCounter("aggregate_overflow_total", "Number of events not aggregated due to max_groups limit")
+}
+
+func (p *Plugin) registerAggregateMetrics() {
+	name := p.config.MetricName
+	p.eventsMetric = p.metricCtl.RegisterCounter(name+"_events_total", "Number of aggregated events", p.labels...)
+	fieldLabels := append(append([]string{}, p.labels...), "field")
+	p.sumMetric = p.metricCtl.RegisterCounter(name+"_sum_total", "Sum of aggregated values", fieldLabels...)
+	p.percentileMetric = p.metricCtl.RegisterGauge(name+"_percentile", "Percentiles of aggregated values of the ended window", append(fieldLabels, "percentile")...)
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	p.keyBuf = p.keyBuf[:0]
+	for i, path := range p.groupBy {
+		value := ""
+		if node := event.Root.Dig(path...); node != nil {
+			value = node.AsString()
+		}
+		p.groupValues[i] = value
+		p.keyBuf = append(p.keyBuf, value...)
+		p.keyBuf = append(p.keyBuf, 0)
+	}
+	for i, path := range p.values {
+		p.valuesBuf[i] = math.NaN()
+		node := event.Root.Dig(path...)
+		if node == nil {
+			continue
+		}
+		if v, err := strconv.ParseFloat(node.AsString(), 64); err == nil {
+			p.valuesBuf[i] = v
+		}
+	}
+
+	ended, g := p.aggregator.add(time.Now(), pipeline.ByteToStringUnsafe(p.keyBuf), p.groupValues, p.valuesBuf)
+	if g == nil {
+		p.overflowMetric.WithLabelValues().Inc()
+	}
+	// the labels are the values of the group since the group values of the event point to the event memory
+	if g != nil && p.eventsMetric != nil {
+		p.eventsMetric.WithLabelValues(g.values...).Inc()
+		for i, v := range p.valuesBuf {
+			if !math.IsNaN(v) && v > 0 {
+				p.sumMetric.WithLabelValues(append(g.values[:len(g.values):len(g.values)], p.valueNames[i])...).Add(v)
+			}
+		}
+	}
+
+	if ended != nil {
+		p.emit(event, ended)
+	}
+
+	if p.config.Discard {
+		return pipeline.ActionDiscard
+	}
+	return pipeline.ActionPass
+}
+
+// emit emits the aggregates of the ended window, the summary events are spawned from the event.
+func (p *Plugin) emit(event *pipeline.Event, w *window) {
+	for _, g := range w.sorted() {
+		if p.percentileMetric != nil {
+			p.updatePercentiles(g)
+		}
+		if p.config.Emit == emitMetrics {
+			continue
+		}
+
+		p.buildSummary(w, g)
+		p.buf = p.root.Encode(p.buf[:0])
+		if err := p.controller.Spawn(event, p.buf); err != nil {
+			p.logger.Errorf("can't spawn summary event: %s", err.Error())
+		}
+	}
+}
+
+func (p *Plugin) updatePercentiles(g *group) {
+	labels := make([]string, len(g.values)+2, len(g.values)+3)
+	copy(labels, g.values)
+	for i, s := range g.fields {
+		if s.sketch.count == 0 {
+			continue
+		}
+		labels[len(g.values)] = p.valueNames[i]
+		for j, percentile := range p.percentiles {
+			labels = append(labels[:len(g.values)+1], p.config.Percentiles[j])
+			p.percentileMetric.WithLabelValues(labels...).Set(s.sketch.quantile(percentile / 100))
+		}
+	}
+}
+
+func (p *Plugin) buildSummary(w *window, g *group) {
+	root := p.root
+	_ = root.DecodeString("{}")
+
+	pipeline.AddField(root, p.config.Marker_).MutateToString("true")
+	root.AddFieldNoAlloc(root, "window_start").MutateToString(w.start.UTC().Format(time.RFC3339))
+	root.AddFieldNoAlloc(root, "window_end").MutateToString(w.end.UTC().Format(time.RFC3339))
+	for i, path := range p.groupBy {
+		pipeline.AddField(root, path).MutateToString(g.values[i])
+	}
+	root.AddFieldNoAlloc(root, "count").MutateToInt64(g.count)
+
+	for i, s := range g.fields {
+		if s.sketch.count == 0 {
+			continue
+		}
+		name := p.valueNames[i]
+		root.AddFieldNoAlloc(root, name+"_sum").MutateToFloat(s.sum)
+		root.AddFieldNoAlloc(root, name+"_min").MutateToFloat(s.sketch.min)
+		root.AddFieldNoAlloc(root, name+"_max").MutateToFloat(s.sketch.max)
+		for j, percentile := range p.percentiles {
+			suffix := strings.ReplaceAll(p.config.Percentiles[j], ".", "_")
+			root.AddFieldNoAlloc(root, name+"_p"+suffix).MutateToFloat(s.sketch.quantile(percentile / 100))
+		}
+	}
+}
+
+// labelName converts the field selector to the prometheus label name.
+func labelName(field string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, field)
+}
@@ -0,0 +1,125 @@
+package aggregate
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runPipeline passes the events through the action, the window is ended between the events before and after.
+// The action skips the last event, it marks the end of the events since the discarded events don't reach the output.
+func runPipeline(config *Config, before, after []string) (*Plugin, []string) {
+	test.NewConfig(config, nil)
+	var plugin *Plugin
+	pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		plugin = &Plugin{}
+		return plugin, &Config{}
+	}
+	conds := pipeline.MatchConditions{{Field: []string{"last"}, Values: []string{"true"}}}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, conds, true))
+	wg := &sync.WaitGroup{}
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		if e.Root.Dig("last") != nil {
+			wg.Done()
+			return
+		}
+		outEvents = append(outEvents, e.Root.EncodeToString())
+	})
+
+	send := func(events []string) {
+		wg.Add(1)
+		for _, event := range events {
+			input.In(0, "test.log", 0, []byte(event))
+		}
+		input.In(0, "test.log", 0, []byte(`{"last":"true"}`))
+		wg.Wait()
+	}
+
+	send(before)
+	endWindow(plugin)
+	send(after)
+	p.Stop()
+
+	return plugin, outEvents
+}
+
+// endWindow makes the current window of the plugin ended at the fixed time.
+func endWindow(p *Plugin) {
+	start := time.Date(2023, 5, 1, 10, 20, 0, 0, time.UTC)
+	p.aggregator.mu.Lock()
+	p.aggregator.current.start = start
+	p.aggregator.current.end = start.Add(time.Minute)
+	p.aggregator.mu.Unlock()
+}
+
+func TestAggregator(t *testing.T) {
+	a := newAggregator(time.Minute, 2, 1)
+	start := time.Date(2023, 5, 1, 10, 20, 0, 0, time.UTC)
+
+	ended, g := a.add(start.Add(10*time.Second), "a", []string{"a"}, []float64{1})
+	assert.NotNil(t, g)
+	assert.Nil(t, ended)
+	_, g = a.add(start.Add(20*time.Second), "b", []string{"b"}, []float64{2})
+	assert.NotNil(t, g)
+	_, g = a.add(start.Add(30*time.Second), "c", []string{"c"}, []float64{3})
+	assert.Nil(t, g, "max groups is reached")
+
+	ended, g = a.add(start.Add(70*time.Second), "c", []string{"c"}, []float64{3})
+	assert.Equal(t, []string{"c"}, g.values)
+	require.NotNil(t, ended)
+	assert.Equal(t, start, ended.start)
+	assert.Equal(t, start.Add(time.Minute), ended.end)
+
+	groups := ended.sorted()
+	require.Len(t, groups, 2)
+	assert.Equal(t, []string{"a"}, groups[0].values)
+	assert.Equal(t, int64(1), groups[0].count)
+	assert.Equal(t, 2.0, groups[1].fields[0].sum)
+}
+
+func TestAggregate(t *testing.T) {
+	config := &Config{
+		GroupBy:     []string{"service", "req.status"},
+		Values:      []string{"req.time"},
+		Percentiles: []string{"50", "99.9"},
+		Discard:     true,
+	}
+	before := []string{
+		`{"service":"api","req":{"status":200,"time":0.5}}`,
+		`{"service":"api","req":{"status":200,"time":"1.5"}}`,
+		`{"service":"api","req":{"status":200,"time":"-"}}`,
+		`{"service":"web","req":{"status":500}}`,
+	}
+	_, outEvents := runPipeline(config, before, []string{`{"service":"api"}`})
+
+	// the events are discarded, only the summaries are spawned once the window is ended
+	assert.Equal(t, []string{
+		`{"aggregate":"true","window_start":"2023-05-01T10:20:00Z","window_end":"2023-05-01T10:21:00Z",` +
+			`"service":"api","req":{"status":"200"},"count":3,` +
+			`"req_time_sum":2,"req_time_min":0.5,"req_time_max":1.5,"req_time_p50":0.5,"req_time_p99_9":1.5}`,
+		`{"aggregate":"true","window_start":"2023-05-01T10:20:00Z","window_end":"2023-05-01T10:21:00Z",` +
+			`"service":"web","req":{"status":"500"},"count":1}`,
+	}, outEvents)
+}
+
+func TestAggregateMetrics(t *testing.T) {
+	config := &Config{
+		GroupBy:    []string{"k8s.app"},
+		Values:     []string{"size"},
+		Emit:       "metrics",
+		MetricName: "test_aggregate_metrics",
+	}
+	p, outEvents := runPipeline(config, []string{`{"k8s":{"app":"api"},"size":10}`}, []string{`{"k8s":{"app":"api"},"size":5}`})
+
+	assert.Equal(t, []string{`{"k8s":{"app":"api"},"size":10}`, `{"k8s":{"app":"api"},"size":5}`}, outEvents)
+	assert.Equal(t, 2.0, testutil.ToFloat64(p.eventsMetric.WithLabelValues("api")))
+	assert.Equal(t, 15.0, testutil.ToFloat64(p.sumMetric.WithLabelValues("api", "size")))
+}
@@ -0,0 +1,78 @@
+package aggregate
+
+import (
+	"math"
+	"sort"
+)
+
+// sketchGamma is the ratio of the bounds of the sketch buckets, the quantiles are estimated with 1% relative error.
+const sketchGamma = 1.02
+
+var sketchLogGamma = math.Log(sketchGamma)
+
+// sketch estimates the quantiles of the values with the logarithmic buckets,
+// so the memory depends on the range of the values rather than their count.
+// The values less than or equal to zero are counted as zeros.
+type sketch struct {
+	buckets map[int]int64
+	zeros   int64
+	count   int64
+	min     float64
+	max     float64
+}
+
+func newSketch() *sketch {
+	return &sketch{buckets: make(map[int]int64)}
+}
+
+func (s *sketch) add(v float64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+
+	if v <= 0 {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(v)/sketchLogGamma))]++
+}
+
+// quantile returns the estimation of the q-quantile, q is in [0, 1].
+func (s *sketch) quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+
+	// the nearest rank
+	rank := int64(math.Ceil(q*float64(s.count))) - 1
+	if rank <= 0 {
+		return s.min
+	}
+	if rank >= s.count-1 {
+		return s.max
+	}
+	if rank < s.zeros {
+		return math.Max(s.min, math.Min(0, s.max))
+	}
+	rank -= s.zeros
+
+	indexes := make([]int, 0, len(s.buckets))
+	for index := range s.buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		rank -= s.buckets[index]
+		if rank < 0 {
+			// the middle of the bucket (gamma^(i-1), gamma^i]
+			v := 2 * math.Pow(sketchGamma, float64(index)) / (sketchGamma + 1)
+			return math.Max(s.min, math.Min(s.max, v))
+		}
+	}
+	return s.max
+}
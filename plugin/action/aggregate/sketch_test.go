@@ -0,0 +1,33 @@
+package aggregate
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketch(t *testing.T) {
+	s := newSketch()
+	for i := 10000; i >= 1; i-- {
+		s.add(float64(i))
+	}
+
+	assert.Equal(t, 1.0, s.quantile(0))
+	assert.Equal(t, 10000.0, s.quantile(1))
+	for _, q := range []float64{0.1, 0.5, 0.9, 0.99, 0.999} {
+		exact := 1 + q*9999
+		assert.InDelta(t, exact, s.quantile(q), exact*0.01, "quantile %v", q)
+	}
+}
+
+func TestSketchZeros(t *testing.T) {
+	s := newSketch()
+	for _, v := range []float64{-2, 0, 0, 3} {
+		s.add(v)
+	}
+
+	assert.Equal(t, -2.0, s.quantile(0))
+	assert.Equal(t, 0.0, s.quantile(0.5))
+	assert.True(t, math.Abs(s.quantile(1)-3) < 0.03)
+}
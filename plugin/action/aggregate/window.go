@@ -0,0 +1,102 @@
+package aggregate
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stats are the statistics of the values of the field in the group.
+type stats struct {
+	sum    float64
+	sketch *sketch
+}
+
+// group is the aggregated events with the same values of the group fields.
+type group struct {
+	key    string
+	values []string
+	count  int64
+	fields []*stats
+}
+
+// window is the aggregated events of the time window.
+type window struct {
+	start  time.Time
+	end    time.Time
+	groups map[string]*group
+}
+
+// sorted returns the groups in the stable order.
+func (w *window) sorted() []*group {
+	groups := make([]*group, 0, len(w.groups))
+	for _, g := range w.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].key < groups[j].key
+	})
+	return groups
+}
+
+// aggregator is shared by the processors of the action, so the events of all the processors are aggregated together.
+type aggregator struct {
+	mu        *sync.Mutex
+	duration  time.Duration
+	maxGroups int
+	fields    int
+
+	current *window
+}
+
+func newAggregator(duration time.Duration, maxGroups int, fields int) *aggregator {
+	return &aggregator{
+		mu:        &sync.Mutex{},
+		duration:  duration,
+		maxGroups: maxGroups,
+		fields:    fields,
+	}
+}
+
+// add adds the event to the window of the time, the values are NaN for the missing and non-numeric fields.
+// It returns the previous window if it's ended and the group of the event,
+// the group is nil if it can't be added due to the limit.
+func (a *aggregator) add(now time.Time, key string, groupValues []string, values []float64) (*window, *group) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var ended *window
+	if a.current == nil || !now.Before(a.current.end) {
+		ended = a.current
+		start := now.Truncate(a.duration)
+		a.current = &window{start: start, end: start.Add(a.duration), groups: make(map[string]*group)}
+	}
+
+	g, has := a.current.groups[key]
+	if !has {
+		if len(a.current.groups) >= a.maxGroups {
+			return ended, nil
+		}
+		// the key and the values point to the event memory
+		g = &group{key: strings.Clone(key), values: make([]string, len(groupValues)), fields: make([]*stats, a.fields)}
+		for i, value := range groupValues {
+			g.values[i] = strings.Clone(value)
+		}
+		for i := range g.fields {
+			g.fields[i] = &stats{sketch: newSketch()}
+		}
+		a.current.groups[g.key] = g
+	}
+
+	g.count++
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		g.fields[i].sum += v
+		g.fields[i].sketch.add(v)
+	}
+	return ended, g
+}
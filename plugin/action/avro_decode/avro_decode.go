@@ -0,0 +1,289 @@
+package avro_decode
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozontech/file.d/avro"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It decodes the Avro binary message from the event field and merges the result with the event root or puts it into the `target` field.
+
+The message is decoded by the `schema` if it's set. Otherwise the message is expected in the Confluent wire format:
+the zero magic byte and the schema id followed by the Avro binary data, the schema is requested from the `schema_registry`
+once per id. The union values are written without the type names and the bytes are written as strings.
+
+The source field is removed only if the decoding succeeds, the failed events are counted in the `avro_decode_errors_total` metric.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    input:
+      type: kafka
+      ...
+    actions:
+    - type: avro_decode
+      field: message
+      encoding: raw
+      schema_registry:
+        url: http://schema-registry:8081
+    ...
+```
+}*/
+
+const (
+	encodingBase64 = "base64"
+
+	onErrorDiscard = "discard"
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+
+	schema  *avro.Schema
+	schemas map[int]*avro.Schema
+	client  *http.Client
+
+	buf     []byte
+	jsonBuf []byte
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field with the Avro message.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" required:"true"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The encoding of the field:
+	// > * `base64` – the message is encoded with the standard base64
+	// > * `raw` – the field contains the message bytes as is
+	Encoding string `json:"encoding" default:"base64" options:"base64|raw"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The Avro schema of the messages without the wire format header, the `schema_registry` is used if it's empty.
+	Schema string `json:"schema" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Schema registry settings to get the schemas of the wire format messages.
+	SchemaRegistry SchemaRegistryConfig `json:"schema_registry" child:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the decoded message into, the decoded record is merged with the event root if it's empty.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the message can't be decoded:
+	// > * `keep` passes the event unchanged
+	// > * `discard` discards the event
+	OnError string `json:"on_error" default:"keep" options:"keep|discard"` // *
+}
+
+type SchemaRegistryConfig struct {
+	// > @3@4@5@6
+	// >
+	// > URL of the schema registry, e.g. `http://schema-registry:8081`.
+	URL string `json:"url" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Username of the basic authentication.
+	Username string `json:"username" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Password of the basic authentication.
+	Password string `json:"password" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of the schema registry requests.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"10s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "avro_decode",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if p.config.Schema != "" {
+		schema, err := avro.ParseSchema(p.config.Schema)
+		if err != nil {
+			p.logger.Fatalf("wrong schema: %s", err.Error())
+		}
+		p.schema = schema
+		return
+	}
+
+	if p.config.SchemaRegistry.URL == "" {
+		p.logger.Fatalf("schema or schema_registry url must be set")
+	}
+	p.schemas = make(map[int]*avro.Schema)
+	p.client = &http.Client{Timeout: p.config.SchemaRegistry.RequestTimeout_}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("avro_decode_errors_total", "Number of events avro_decode plugin failed to decode")
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	fieldNode := event.Root.Dig(p.config.Field_...)
+	if fieldNode == nil {
+		return pipeline.ActionPass
+	}
+
+	node, err := p.decode(event, fieldNode.AsBytes())
+	if err != nil {
+		p.logger.Debugf("can't decode avro message: %s", err.Error())
+		if p.errorsMetric != nil {
+			p.errorsMetric.WithLabelValues().Inc()
+		}
+		if p.config.OnError == onErrorDiscard {
+			return pipeline.ActionDiscard
+		}
+		return pipeline.ActionPass
+	}
+
+	fieldNode.Suicide()
+
+	if len(p.config.Target_) == 0 {
+		// place decoded object under root
+		event.Root.MergeWith(node)
+		return pipeline.ActionPass
+	}
+
+	pipeline.AddField(event.Root, p.config.Target_).MutateToNode(node)
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) decode(event *pipeline.Event, data []byte) (*insaneJSON.Node, error) {
+	if p.config.Encoding == encodingBase64 {
+		size := base64.StdEncoding.DecodedLen(len(data))
+		if cap(p.buf) < size {
+			p.buf = make([]byte, size)
+		}
+		n, err := base64.StdEncoding.Decode(p.buf[:size], data)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode base64: %w", err)
+		}
+		data = p.buf[:n]
+	}
+
+	schema := p.schema
+	if schema == nil {
+		// the wire format header: the magic byte and the schema id
+		if len(data) < 5 || data[0] != 0 {
+			return nil, errors.New("wrong wire format header")
+		}
+		var err error
+		schema, err = p.getSchema(int(binary.BigEndian.Uint32(data[1:5])))
+		if err != nil {
+			return nil, err
+		}
+		data = data[5:]
+	}
+
+	var err error
+	p.jsonBuf, data, err = schema.DecodeJSON(p.jsonBuf[:0], data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%d bytes left after decoding", len(data))
+	}
+	return event.SubparseJSON(p.jsonBuf)
+}
+
+// getSchema returns the schema of the id, the schemas are requested from the registry once.
+func (p *Plugin) getSchema(id int) (*avro.Schema, error) {
+	if schema, has := p.schemas[id]; has {
+		return schema, nil
+	}
+
+	c := p.config.SchemaRegistry
+	endpoint := strings.TrimSuffix(c.URL, "/") + "/schemas/ids/" + strconv.Itoa(id)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("can't create request: %w", err)
+	}
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't get schema %d: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read schema %d: %w", id, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("wrong response status of schema %d %s: %s", id, resp.Status, string(b))
+	}
+
+	result := struct {
+		Schema string `json:"schema"`
+	}{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("can't decode schema %d response: %w", id, err)
+	}
+	schema, err := avro.ParseSchema(result.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("wrong schema %d: %w", id, err)
+	}
+
+	p.schemas[id] = schema
+	return schema, nil
+}
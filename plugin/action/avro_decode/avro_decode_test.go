@@ -0,0 +1,133 @@
+package avro_decode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+const testSchema = `{"type":"record","name":"Event","fields":[{"name":"message","type":"string"},{"name":"code","type":["null","int"]}]}`
+
+func TestDecode(t *testing.T) {
+	requests := atomic.NewInt32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		if r.URL.Path != "/schemas/ids/7" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+			return
+		}
+		b, _ := json.Marshal(map[string]string{"schema": testSchema})
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	// message "hi", code 42
+	message := []byte{4, 'h', 'i', 2, 84}
+	wire := append([]byte{0, 0, 0, 0, 7}, message...)
+	encode := base64.StdEncoding.EncodeToString
+
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+		result pipeline.ActionResult
+	}{
+		{
+			name:   "schema",
+			config: &Config{Field: "payload", Schema: testSchema},
+			in:     `{"level":"info","payload":"` + encode(message) + `"}`,
+			out:    `{"level":"info","message":"hi","code":42}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "schema registry",
+			config: &Config{Field: "payload", SchemaRegistry: SchemaRegistryConfig{URL: server.URL}, Target: "event"},
+			in:     `{"payload":"` + encode(wire) + `"}`,
+			out:    `{"event":{"message":"hi","code":42}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "unknown schema",
+			config: &Config{Field: "payload", SchemaRegistry: SchemaRegistryConfig{URL: server.URL}, OnError: "discard"},
+			in:     `{"payload":"` + encode([]byte{0, 0, 0, 0, 8, 0}) + `"}`,
+			result: pipeline.ActionDiscard,
+		},
+		{
+			name:   "short message",
+			config: &Config{Field: "payload", Schema: testSchema},
+			in:     `{"payload":"` + encode(message[:4]) + `"}`,
+			out:    `{"payload":"BGhpAg=="}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "extra bytes",
+			config: &Config{Field: "payload", Schema: testSchema, OnError: "discard"},
+			in:     `{"payload":"` + encode(append(message, 0)) + `"}`,
+			result: pipeline.ActionDiscard,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+		})
+	}
+
+	// the schema is requested once
+	requests.Store(0)
+	config := test.NewConfig(&Config{Field: "payload", SchemaRegistry: SchemaRegistryConfig{URL: server.URL}}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"payload":"`+encode(wire)+`"}`))
+	input.In(0, "test.log", 0, []byte(`{"payload":"`+encode(wire)+`"}`))
+	input.In(0, "test.log", 0, []byte(`{"payload":"`+encode(wire)+`"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	assert.Equal(t, []string{`{"message":"hi","code":42}`, `{"message":"hi","code":42}`, `{"message":"hi","code":42}`}, outEvents)
+	assert.Equal(t, int32(1), requests.Load())
+}
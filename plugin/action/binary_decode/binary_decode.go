@@ -0,0 +1,187 @@
+package binary_decode
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It decodes the MessagePack or CBOR value from the event field and merges the result with the event root or puts it into the `target` field.
+If the decoded value isn't an object and the `target` isn't set, the decoding fails.
+
+The binary strings are written as base64 strings and the map keys of the other types than the string are written as their JSON strings.
+The MessagePack timestamps are written as RFC3339 strings, the other MessagePack extensions are written as base64 strings of their data.
+The CBOR tags are skipped except the bignums which are written as numbers.
+
+The source field is removed only if the decoding succeeds, the failed events are counted in the `binary_decode_errors_total` metric.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: binary_decode
+      field: payload
+      format: cbor
+      target: sensor
+    ...
+```
+It transforms `{"payload":"omR0ZW1w+0A2gAAAAAAAZHVuaXRhQw=="}` into `{"sensor":{"temp":22.5,"unit":"C"}}`.
+}*/
+
+const (
+	formatCBOR = "cbor"
+
+	encodingBase64 = "base64"
+
+	onErrorDiscard = "discard"
+)
+
+var errNotObject = errors.New("decoded value isn't an object")
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	decode func(buf, data []byte, depth int) ([]byte, []byte, error)
+
+	buf     []byte
+	jsonBuf []byte
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field with the binary value.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" required:"true"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The format of the value.
+	Format string `json:"format" default:"msgpack" options:"msgpack|cbor"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The encoding of the field:
+	// > * `base64` – the value is encoded with the standard base64
+	// > * `raw` – the field contains the value bytes as is
+	Encoding string `json:"encoding" default:"base64" options:"base64|raw"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the decoded value into, the decoded object is merged with the event root if it's empty.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the value can't be decoded:
+	// > * `keep` passes the event unchanged
+	// > * `discard` discards the event
+	OnError string `json:"on_error" default:"keep" options:"keep|discard"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "binary_decode",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	p.decode = decodeMsgpack
+	if p.config.Format == formatCBOR {
+		p.decode = decodeCBOR
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("binary_decode_errors_total", "Number of events binary_decode plugin failed to decode")
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	fieldNode := event.Root.Dig(p.config.Field_...)
+	if fieldNode == nil {
+		return pipeline.ActionPass
+	}
+
+	node, err := p.decodeField(event, fieldNode.AsBytes())
+	if err != nil {
+		p.logger.Debugf("can't decode %s value: %s", p.config.Format, err.Error())
+		if p.errorsMetric != nil {
+			p.errorsMetric.WithLabelValues().Inc()
+		}
+		if p.config.OnError == onErrorDiscard {
+			return pipeline.ActionDiscard
+		}
+		return pipeline.ActionPass
+	}
+
+	fieldNode.Suicide()
+
+	if len(p.config.Target_) == 0 {
+		// place decoded object under root
+		event.Root.MergeWith(node)
+		return pipeline.ActionPass
+	}
+
+	pipeline.AddField(event.Root, p.config.Target_).MutateToNode(node)
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) decodeField(event *pipeline.Event, data []byte) (*insaneJSON.Node, error) {
+	if p.config.Encoding == encodingBase64 {
+		size := base64.StdEncoding.DecodedLen(len(data))
+		if cap(p.buf) < size {
+			p.buf = make([]byte, size)
+		}
+		n, err := base64.StdEncoding.Decode(p.buf[:size], data)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode base64: %w", err)
+		}
+		data = p.buf[:n]
+	}
+
+	var err error
+	p.jsonBuf, data, err = p.decode(p.jsonBuf[:0], data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%d bytes left after decoding", len(data))
+	}
+
+	node, err := event.SubparseJSON(p.jsonBuf)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsObject() && len(p.config.Target_) == 0 {
+		return nil, errNotObject
+	}
+	return node, nil
+}
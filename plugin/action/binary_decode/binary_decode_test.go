@@ -0,0 +1,167 @@
+package binary_decode
+
+import (
+	"encoding/base64"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	encode := base64.StdEncoding.EncodeToString
+
+	cases := []struct {
+		name   string
+		config *Config
+		data   []byte
+		out    string
+		result pipeline.ActionResult
+		errors float64
+	}{
+		{
+			name:   "msgpack map",
+			config: &Config{Field: "payload"},
+			// {"a":1,"b":[-1,-200,1.5],"c":nil,"d":true}
+			data:   []byte{0x84, 0xa1, 'a', 0x01, 0xa1, 'b', 0x93, 0xff, 0xd1, 0xff, 0x38, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, 0xa1, 'c', 0xc0, 0xa1, 'd', 0xc3},
+			out:    `{"level":"info","a":1,"b":[-1,-200,1.5],"c":null,"d":true}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "msgpack types",
+			config: &Config{Field: "payload", Target: "data.value"},
+			// {1:bin("hi"),"t":timestamp(1682936400),"s":"a\"b","u":uint64(1<<63)}
+			data: []byte{
+				0x84,
+				0x01, 0xc4, 0x02, 'h', 'i',
+				0xa1, 't', 0xd6, 0xff, 0x64, 0x4f, 0x92, 0x50,
+				0xa1, 's', 0xa3, 'a', '"', 'b',
+				0xa1, 'u', 0xcf, 0x80, 0, 0, 0, 0, 0, 0, 0,
+			},
+			out:    `{"level":"info","data":{"value":{"1":"aGk=","t":"2023-05-01T10:20:00Z","s":"a\"b","u":9223372036854775808}}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "msgpack scalar",
+			config: &Config{Field: "payload", Target: "value"},
+			data:   []byte{0xd2, 0xff, 0xff, 0xff, 0xfe},
+			out:    `{"level":"info","value":-2}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "cbor map",
+			config: &Config{Field: "payload", Format: "cbor"},
+			// {"temp":22.5,"unit":"C","ok":false}
+			data:   []byte{0xa3, 0x64, 't', 'e', 'm', 'p', 0xfb, 0x40, 0x36, 0x80, 0, 0, 0, 0, 0, 0x64, 'u', 'n', 'i', 't', 0x61, 'C', 0x62, 'o', 'k', 0xf4},
+			out:    `{"level":"info","temp":22.5,"unit":"C","ok":false}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "cbor types",
+			config: &Config{Field: "payload", Format: "cbor", Target: "value"},
+			// [-500,h'0102',1.5 as float16,bignum 2^64,tag 1(1682936400),undefined]
+			data: []byte{
+				0x86,
+				0x39, 0x01, 0xf3,
+				0x42, 0x01, 0x02,
+				0xf9, 0x3e, 0x00,
+				0xc2, 0x49, 0x01, 0, 0, 0, 0, 0, 0, 0, 0,
+				0xc1, 0x1a, 0x64, 0x4f, 0x92, 0x50,
+				0xf7,
+			},
+			out:    `{"level":"info","value":[-500,"AQI=",1.5,18446744073709551616,1682936400,null]}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "cbor indefinite",
+			config: &Config{Field: "payload", Format: "cbor"},
+			// {_ "msg": (_ "he", "llo"), 1: [_ 1, 2]}
+			data:   []byte{0xbf, 0x63, 'm', 's', 'g', 0x7f, 0x62, 'h', 'e', 0x63, 'l', 'l', 'o', 0xff, 0x01, 0x9f, 0x01, 0x02, 0xff, 0xff},
+			out:    `{"level":"info","msg":"hello","1":[1,2]}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "not object",
+			config: &Config{Field: "payload", Format: "cbor"},
+			data:   []byte{0x01},
+			out:    `{"level":"info","payload":"AQ=="}`,
+			result: pipeline.ActionPass,
+			errors: 1,
+		},
+		{
+			name:   "short data",
+			config: &Config{Field: "payload", OnError: "discard"},
+			data:   []byte{0x82, 0xa1, 'a'},
+			result: pipeline.ActionDiscard,
+			errors: 1,
+		},
+		{
+			name:   "extra bytes",
+			config: &Config{Field: "payload", Format: "cbor", OnError: "discard"},
+			data:   []byte{0xa0, 0x00},
+			result: pipeline.ActionDiscard,
+			errors: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			var plugin *Plugin
+			pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+				plugin = &Plugin{}
+				return plugin, &Config{}
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(`{"level":"info","payload":"`+encode(tc.data)+`"}`))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+			assert.Equal(t, tc.errors, testutil.ToFloat64(plugin.errorsMetric.WithLabelValues()))
+		})
+	}
+}
+
+func TestDecodeRaw(t *testing.T) {
+	config := test.NewConfig(&Config{Field: "payload", Encoding: "raw"}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	// the message bytes are put into the JSON string as is
+	input.In(0, "test.log", 0, []byte("{\"payload\":\"\x81\xa1k\xa1v\"}"))
+
+	wg.Wait()
+	p.Stop()
+
+	assert.Equal(t, []string{`{"k":"v"}`}, outEvents)
+}
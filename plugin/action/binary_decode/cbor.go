@@ -0,0 +1,281 @@
+package binary_decode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+const (
+	cborUnsigned = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborIndefinite = 31
+	cborBreak      = 0xff
+
+	cborTagPositiveBignum = 2
+	cborTagNegativeBignum = 3
+)
+
+var errCBORBreak = errors.New("unexpected break")
+
+// decodeCBOR appends the JSON of the CBOR item to the buf and returns the rest of the data.
+// The byte strings are written as base64 strings, the tags except the bignums are skipped and the undefined is written as null.
+func decodeCBOR(buf, data []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxDepth {
+		return buf, data, errTooDeep
+	}
+	if len(data) == 0 {
+		return buf, data, errShortData
+	}
+	if data[0] == cborBreak {
+		return buf, data, errCBORBreak
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	if info == cborIndefinite {
+		return decodeCBORIndefinite(buf, data[1:], major, depth)
+	}
+	if major == cborSimple {
+		return decodeCBORSimple(buf, data[1:], info)
+	}
+
+	arg, data, err := readCBORArgument(data[1:], info)
+	if err != nil {
+		return buf, data, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		return strconv.AppendUint(buf, arg, 10), data, nil
+	case cborNegative:
+		if arg < math.MaxInt64 {
+			return strconv.AppendInt(buf, -1-int64(arg), 10), data, nil
+		}
+		v := new(big.Int).SetUint64(arg)
+		return v.Neg(v.Add(v, big.NewInt(1))).Append(buf, 10), data, nil
+	case cborBytes, cborText:
+		if uint64(len(data)) < arg {
+			return buf, data, errShortData
+		}
+		if major == cborBytes {
+			return appendBinary(buf, data[:arg]), data[arg:], nil
+		}
+		return appendString(buf, data[:arg]), data[arg:], nil
+	case cborArray:
+		// each item takes at least one byte
+		if uint64(len(data)) < arg {
+			return buf, data, errShortData
+		}
+		buf = append(buf, '[')
+		for i := uint64(0); i < arg; i++ {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			if buf, data, err = decodeCBOR(buf, data, depth+1); err != nil {
+				return buf, data, err
+			}
+		}
+		return append(buf, ']'), data, nil
+	case cborMap:
+		// each key and value take at least one byte
+		if uint64(len(data)) < 2*arg {
+			return buf, data, errShortData
+		}
+		buf = append(buf, '{')
+		for i := uint64(0); i < arg; i++ {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			if buf, data, err = decodeCBORPair(buf, data, depth); err != nil {
+				return buf, data, err
+			}
+		}
+		return append(buf, '}'), data, nil
+	default:
+		return decodeCBORTag(buf, data, arg, depth)
+	}
+}
+
+func readCBORArgument(data []byte, info byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info <= 27:
+		return readUint(data, 1<<(info-24))
+	default:
+		return 0, data, fmt.Errorf("wrong cbor additional info %d", info)
+	}
+}
+
+func decodeCBORPair(buf, data []byte, depth int) ([]byte, []byte, error) {
+	var err error
+	start := len(buf)
+	if buf, data, err = decodeCBOR(buf, data, depth+1); err != nil {
+		return buf, data, err
+	}
+	buf = append(appendKey(buf, start), ':')
+	return decodeCBOR(buf, data, depth+1)
+}
+
+// decodeCBORTag decodes the tagged item, the bignums are written as numbers and the other tags are skipped.
+func decodeCBORTag(buf, data []byte, tag uint64, depth int) ([]byte, []byte, error) {
+	if tag != cborTagPositiveBignum && tag != cborTagNegativeBignum {
+		return decodeCBOR(buf, data, depth+1)
+	}
+
+	if len(data) == 0 {
+		return buf, data, errShortData
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	if major != cborBytes || info == cborIndefinite {
+		return buf, data, errors.New("wrong cbor bignum")
+	}
+	l, rest, err := readCBORArgument(data[1:], info)
+	if err != nil {
+		return buf, data, err
+	}
+	if uint64(len(rest)) < l {
+		return buf, data, errShortData
+	}
+
+	v := new(big.Int).SetBytes(rest[:l])
+	if tag == cborTagNegativeBignum {
+		v.Neg(v.Add(v, big.NewInt(1)))
+	}
+	return v.Append(buf, 10), rest[l:], nil
+}
+
+// decodeCBORIndefinite decodes the indefinite length item, its chunks or items are ended with the break.
+func decodeCBORIndefinite(buf, data []byte, major byte, depth int) ([]byte, []byte, error) {
+	switch major {
+	case cborBytes, cborText:
+		// the chunks are the definite length strings of the same type
+		var value []byte
+		for {
+			if len(data) == 0 {
+				return buf, data, errShortData
+			}
+			if data[0] == cborBreak {
+				break
+			}
+			chunkMajor, info := data[0]>>5, data[0]&0x1f
+			if chunkMajor != major || info == cborIndefinite {
+				return buf, data, errors.New("wrong cbor string chunk")
+			}
+			l, rest, err := readCBORArgument(data[1:], info)
+			if err != nil {
+				return buf, data, err
+			}
+			if uint64(len(rest)) < l {
+				return buf, data, errShortData
+			}
+			value = append(value, rest[:l]...)
+			data = rest[l:]
+		}
+		if major == cborBytes {
+			return appendBinary(buf, value), data[1:], nil
+		}
+		return appendString(buf, value), data[1:], nil
+	case cborArray, cborMap:
+		open, closing := byte('['), byte(']')
+		if major == cborMap {
+			open, closing = '{', '}'
+		}
+
+		buf = append(buf, open)
+		for i := 0; ; i++ {
+			if len(data) == 0 {
+				return buf, data, errShortData
+			}
+			if data[0] == cborBreak {
+				return append(buf, closing), data[1:], nil
+			}
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+
+			var err error
+			if major == cborMap {
+				buf, data, err = decodeCBORPair(buf, data, depth)
+			} else {
+				buf, data, err = decodeCBOR(buf, data, depth+1)
+			}
+			if err != nil {
+				return buf, data, err
+			}
+		}
+	default:
+		return buf, data, fmt.Errorf("wrong cbor indefinite length of major type %d", major)
+	}
+}
+
+// decodeCBORSimple decodes the simple values and the floats, the unassigned simple values are written as numbers.
+func decodeCBORSimple(buf, data []byte, info byte) ([]byte, []byte, error) {
+	switch info {
+	case 20:
+		return append(buf, "false"...), data, nil
+	case 21:
+		return append(buf, "true"...), data, nil
+	case 22, 23:
+		return append(buf, "null"...), data, nil
+	case 24:
+		if len(data) < 1 {
+			return buf, data, errShortData
+		}
+		return strconv.AppendUint(buf, uint64(data[0]), 10), data[1:], nil
+	case 25:
+		if len(data) < 2 {
+			return buf, data, errShortData
+		}
+		return appendFloat(buf, float16(binary.BigEndian.Uint16(data)), 32), data[2:], nil
+	case 26:
+		if len(data) < 4 {
+			return buf, data, errShortData
+		}
+		return appendFloat(buf, float64(math.Float32frombits(binary.BigEndian.Uint32(data))), 32), data[4:], nil
+	case 27:
+		if len(data) < 8 {
+			return buf, data, errShortData
+		}
+		return appendFloat(buf, math.Float64frombits(binary.BigEndian.Uint64(data)), 64), data[8:], nil
+	default:
+		if info < 20 {
+			return strconv.AppendUint(buf, uint64(info), 10), data, nil
+		}
+		return buf, data, fmt.Errorf("wrong cbor simple value %d", info)
+	}
+}
+
+// float16 converts the IEEE 754 half-precision float.
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	default:
+		return sign * math.Ldexp(frac+1024, exp-25)
+	}
+}
@@ -0,0 +1,86 @@
+package binary_decode
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// maxDepth limits the nesting of the decoded values to protect from the malicious payloads.
+const maxDepth = 512
+
+var (
+	errShortData = errors.New("unexpected end of data")
+	errTooDeep   = errors.New("max nesting depth exceeded")
+)
+
+// appendFloat appends the number, NaN and infinities aren't allowed in JSON, so they are written as null.
+func appendFloat(buf []byte, v float64, bitSize int) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return append(buf, "null"...)
+	}
+	return strconv.AppendFloat(buf, v, 'g', -1, bitSize)
+}
+
+// appendBinary appends the binary data as the base64 string.
+func appendBinary(buf, data []byte) []byte {
+	buf = append(buf, '"')
+	l := len(buf)
+	size := base64.StdEncoding.EncodedLen(len(data))
+	if cap(buf)-l < size+1 {
+		grown := make([]byte, l, 2*cap(buf)+size+1)
+		copy(grown, buf)
+		buf = grown
+	}
+	buf = buf[:l+size]
+	base64.StdEncoding.Encode(buf[l:], data)
+	return append(buf, '"')
+}
+
+// appendKey appends the JSON of the map key decoded at the start of the buf as the string.
+func appendKey(buf []byte, start int) []byte {
+	if buf[start] == '"' {
+		return buf
+	}
+	key := string(buf[start:])
+	return appendString(buf[:start], []byte(key))
+}
+
+const hex = "0123456789abcdef"
+
+// appendString appends the JSON string, the invalid UTF-8 bytes are replaced with the replacement character.
+func appendString(buf, s []byte) []byte {
+	buf = append(buf, '"')
+	for len(s) > 0 {
+		c := s[0]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			s = s[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s)
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[:size]...)
+		}
+		s = s[size:]
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,210 @@
+package binary_decode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// msgpackTimestamp is the extension type of the timestamps.
+const msgpackTimestamp = -1
+
+// decodeMsgpack appends the JSON of the MessagePack value to the buf and returns the rest of the data.
+// The binary and the extension values are written as base64 strings, the timestamps are written as RFC3339 strings.
+func decodeMsgpack(buf, data []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxDepth {
+		return buf, data, errTooDeep
+	}
+	if len(data) == 0 {
+		return buf, data, errShortData
+	}
+
+	b := data[0]
+	data = data[1:]
+	switch {
+	case b <= 0x7f:
+		return strconv.AppendInt(buf, int64(b), 10), data, nil
+	case b >= 0xe0:
+		return strconv.AppendInt(buf, int64(int8(b)), 10), data, nil
+	case b >= 0x80 && b <= 0x8f:
+		return decodeMsgpackMap(buf, data, int(b&0x0f), depth)
+	case b >= 0x90 && b <= 0x9f:
+		return decodeMsgpackArray(buf, data, int(b&0x0f), depth)
+	case b >= 0xa0 && b <= 0xbf:
+		return decodeMsgpackString(buf, data, int(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return append(buf, "null"...), data, nil
+	case 0xc2:
+		return append(buf, "false"...), data, nil
+	case 0xc3:
+		return append(buf, "true"...), data, nil
+	case 0xc4, 0xc5, 0xc6:
+		l, rest, err := readMsgpackLength(data, b-0xc4)
+		if err != nil {
+			return buf, data, err
+		}
+		if len(rest) < l {
+			return buf, data, errShortData
+		}
+		return appendBinary(buf, rest[:l]), rest[l:], nil
+	case 0xc7, 0xc8, 0xc9:
+		l, rest, err := readMsgpackLength(data, b-0xc7)
+		if err != nil {
+			return buf, data, err
+		}
+		return decodeMsgpackExt(buf, rest, l)
+	case 0xca:
+		if len(data) < 4 {
+			return buf, data, errShortData
+		}
+		return appendFloat(buf, float64(math.Float32frombits(binary.BigEndian.Uint32(data))), 32), data[4:], nil
+	case 0xcb:
+		if len(data) < 8 {
+			return buf, data, errShortData
+		}
+		return appendFloat(buf, math.Float64frombits(binary.BigEndian.Uint64(data)), 64), data[8:], nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		size := 1 << (b - 0xcc)
+		v, rest, err := readUint(data, size)
+		if err != nil {
+			return buf, data, err
+		}
+		return strconv.AppendUint(buf, v, 10), rest, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		v, rest, err := readUint(data, size)
+		if err != nil {
+			return buf, data, err
+		}
+		// sign extension of the value of the size
+		shift := 64 - 8*size
+		return strconv.AppendInt(buf, int64(v<<shift)>>shift, 10), rest, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return decodeMsgpackExt(buf, data, 1<<(b-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		l, rest, err := readMsgpackLength(data, b-0xd9)
+		if err != nil {
+			return buf, data, err
+		}
+		return decodeMsgpackString(buf, rest, l)
+	case 0xdc, 0xdd:
+		l, rest, err := readMsgpackLength(data, b-0xdc+1)
+		if err != nil {
+			return buf, data, err
+		}
+		return decodeMsgpackArray(buf, rest, l, depth)
+	case 0xde, 0xdf:
+		l, rest, err := readMsgpackLength(data, b-0xde+1)
+		if err != nil {
+			return buf, data, err
+		}
+		return decodeMsgpackMap(buf, rest, l, depth)
+	default:
+		return buf, data, fmt.Errorf("wrong msgpack type 0x%x", b)
+	}
+}
+
+// readMsgpackLength reads the length of 1, 2 or 4 bytes by the size index 0, 1 or 2.
+func readMsgpackLength(data []byte, sizeIndex byte) (int, []byte, error) {
+	v, rest, err := readUint(data, 1<<sizeIndex)
+	if err != nil {
+		return 0, data, err
+	}
+	return int(v), rest, nil
+}
+
+func readUint(data []byte, size int) (uint64, []byte, error) {
+	if len(data) < size {
+		return 0, data, errShortData
+	}
+	var v uint64
+	for _, b := range data[:size] {
+		v = v<<8 | uint64(b)
+	}
+	return v, data[size:], nil
+}
+
+func decodeMsgpackString(buf, data []byte, l int) ([]byte, []byte, error) {
+	if len(data) < l {
+		return buf, data, errShortData
+	}
+	return appendString(buf, data[:l]), data[l:], nil
+}
+
+func decodeMsgpackArray(buf, data []byte, l int, depth int) ([]byte, []byte, error) {
+	// each item takes at least one byte
+	if len(data) < l {
+		return buf, data, errShortData
+	}
+
+	buf = append(buf, '[')
+	for i := 0; i < l; i++ {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		var err error
+		if buf, data, err = decodeMsgpack(buf, data, depth+1); err != nil {
+			return buf, data, err
+		}
+	}
+	return append(buf, ']'), data, nil
+}
+
+// decodeMsgpackMap decodes the map, the keys of the other types than the string are written as their JSON strings.
+func decodeMsgpackMap(buf, data []byte, l int, depth int) ([]byte, []byte, error) {
+	// each key and value take at least one byte
+	if len(data) < 2*l {
+		return buf, data, errShortData
+	}
+
+	buf = append(buf, '{')
+	for i := 0; i < l; i++ {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+
+		var err error
+		start := len(buf)
+		if buf, data, err = decodeMsgpack(buf, data, depth+1); err != nil {
+			return buf, data, err
+		}
+		buf = append(appendKey(buf, start), ':')
+		if buf, data, err = decodeMsgpack(buf, data, depth+1); err != nil {
+			return buf, data, err
+		}
+	}
+	return append(buf, '}'), data, nil
+}
+
+// decodeMsgpackExt decodes the extension value of the length l following the extension type.
+func decodeMsgpackExt(buf, data []byte, l int) ([]byte, []byte, error) {
+	if len(data) < l+1 {
+		return buf, data, errShortData
+	}
+	kind, value, rest := int8(data[0]), data[1:l+1], data[l+1:]
+	if kind != msgpackTimestamp {
+		return appendBinary(buf, value), rest, nil
+	}
+
+	var t time.Time
+	switch l {
+	case 4:
+		t = time.Unix(int64(binary.BigEndian.Uint32(value)), 0)
+	case 8:
+		v := binary.BigEndian.Uint64(value)
+		t = time.Unix(int64(v&(1<<34-1)), int64(v>>34))
+	case 12:
+		t = time.Unix(int64(binary.BigEndian.Uint64(value[4:])), int64(binary.BigEndian.Uint32(value)))
+	default:
+		return buf, data, fmt.Errorf("wrong msgpack timestamp length %d", l)
+	}
+
+	buf = append(buf, '"')
+	buf = t.UTC().AppendFormat(buf, time.RFC3339Nano)
+	return append(buf, '"'), rest, nil
+}
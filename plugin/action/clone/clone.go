@@ -0,0 +1,137 @@
+package clone
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It duplicates the event, the copy gets the `marker` field and passes the following actions and goes to the outputs
+along with the original event. The original event is passed unchanged and is committed once both events are committed.
+The copy may contain only the `fields` of the original event.
+
+The marker allows to process the copies and the originals differently with the match conditions of the actions
+and the outputs, e.g. to sample the copies archived to S3 while sending the originals to Elasticsearch.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: clone
+      marker: archive
+      fields: [time, level, message]
+    - type: sample
+      match_fields:
+        archive: "true"
+      ...
+    outputs:
+    - type: elasticsearch
+      match_fields:
+        archive: "true"
+      match_invert: true
+      ...
+    - type: s3
+      match_fields:
+        archive: "true"
+      ...
+```
+}*/
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.SugaredLogger
+	controller pipeline.ActionPluginController
+
+	fields [][]string
+	root   *insaneJSON.Root
+	buf    []byte
+
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The field added to the copy.
+	Marker  cfg.FieldSelector `json:"marker" default:"clone" parse:"selector"` // *
+	Marker_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The value of the `marker` field.
+	MarkerValue string `json:"marker_value" default:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field selectors of the fields to copy, the whole event is copied if it's empty.
+	Fields []string `json:"fields" slice:"true"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "clone",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.controller = params.Controller
+	p.root = insaneJSON.Spawn()
+
+	if len(p.config.Marker_) == 0 {
+		p.logger.Fatalf("marker must be set")
+	}
+	for _, field := range p.config.Fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in fields")
+		}
+		p.fields = append(p.fields, path)
+	}
+}
+
+func (p *Plugin) Stop() {
+	insaneJSON.Release(p.root)
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	if len(p.fields) == 0 {
+		p.buf = event.Root.Encode(p.buf[:0])
+		if err := p.root.DecodeBytes(p.buf); err != nil {
+			p.logger.Errorf("can't decode event: %s", err.Error())
+			return pipeline.ActionPass
+		}
+	} else {
+		_ = p.root.DecodeString("{}")
+		for _, path := range p.fields {
+			node := event.Root.Dig(path...)
+			if node == nil {
+				continue
+			}
+			p.buf = node.Encode(p.buf[:0])
+			pipeline.AddField(p.root, path).MutateToJSON(p.root, pipeline.ByteToStringUnsafe(p.buf))
+		}
+	}
+	pipeline.AddField(p.root, p.config.Marker_).MutateToString(p.config.MarkerValue)
+
+	p.buf = p.root.Encode(p.buf[:0])
+	if err := p.controller.Spawn(event, p.buf); err != nil {
+		p.logger.Errorf("can't spawn event: %s", err.Error())
+	}
+
+	return pipeline.ActionPass
+}
@@ -0,0 +1,69 @@
+package clone
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func TestClone(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    []string
+	}{
+		{
+			name:   "whole",
+			config: &Config{},
+			in:     `{"level":"info","message":"hi"}`,
+			out:    []string{`{"level":"info","message":"hi","clone":"true"}`, `{"level":"info","message":"hi"}`},
+		},
+		{
+			name:   "fields",
+			config: &Config{Marker: "meta.copy", MarkerValue: "s3", Fields: []string{"level", "k8s.pod", "missing"}},
+			in:     `{"level":"info","message":"hi","k8s":{"pod":"p-1","node":"n-1"},"meta":{"id":1}}`,
+			out: []string{
+				`{"level":"info","k8s":{"pod":"p-1"},"meta":{"copy":"s3"}}`,
+				`{"level":"info","message":"hi","k8s":{"pod":"p-1","node":"n-1"},"meta":{"id":1}}`,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			commits := atomic.NewInt32(0)
+			input.SetCommitFn(func(_ *pipeline.Event) {
+				commits.Inc()
+				wg.Done()
+			})
+
+			mu := &sync.Mutex{}
+			out := make([]string, 0)
+			output.SetOutFn(func(e *pipeline.Event) {
+				mu.Lock()
+				out = append(out, strings.Clone(e.Root.EncodeToString()))
+				mu.Unlock()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			wg.Wait()
+			p.Stop()
+
+			// the event is committed once along with the copy
+			assert.Equal(t, int32(1), commits.Load())
+			sort.Strings(out)
+			assert.Equal(t, tc.out, out)
+		})
+	}
+}
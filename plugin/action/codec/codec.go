@@ -0,0 +1,248 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It decodes or encodes the values of the event fields with the base64, the URL encoding or hex.
+
+The base64 values are decoded with or without the padding. The decoded values must be valid UTF-8 strings,
+so use the `binary_decode` or the `protobuf_decode` actions for the binary payloads.
+The non-string values are encoded as their JSON, e.g. `42` is encoded into `"NDI="` with base64,
+and the objects and the arrays can't be encoded.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: codec
+      fields: [query, request.args]
+      codec: url
+      mode: decode
+    ...
+```
+It transforms `{"query":"q%3Dfile.d%26page%3D2"}` into `{"query":"q=file.d&page=2"}`.
+}*/
+
+const (
+	codecBase64    = "base64"
+	codecBase64URL = "base64url"
+	codecURL       = "url"
+	codecHex       = "hex"
+
+	modeEncode = "encode"
+
+	onErrorDiscard = "discard"
+)
+
+var (
+	errNotScalar  = errors.New("value is an object or an array")
+	errNotString  = errors.New("value isn't a string")
+	errNotUTF8    = errors.New("decoded value isn't a valid UTF-8 string")
+	errWrongCodec = errors.New("wrong codec")
+)
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	fields [][]string
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The list of the field selectors to process.
+	Fields []string `json:"fields" required:"true" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The codec:
+	// > * `base64` – the standard base64
+	// > * `base64url` – the URL and file name safe base64
+	// > * `url` – the URL query escaping, the spaces are encoded as `+`
+	// > * `hex` – the hex, it's encoded in the lower case
+	Codec string `json:"codec" default:"base64" options:"base64|base64url|url|hex"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Whether to decode or to encode the values.
+	Mode string `json:"mode" default:"decode" options:"decode|encode"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the value can't be processed:
+	// > * `keep` keeps the value unchanged
+	// > * `discard` discards the event
+	OnError string `json:"on_error" default:"keep" options:"keep|discard"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "codec",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	for _, field := range p.config.Fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			logger.Fatalf("empty field in fields")
+		}
+		p.fields = append(p.fields, path)
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("codec_errors_total", "Number of field values codec plugin failed to process")
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	for _, path := range p.fields {
+		node := event.Root.Dig(path...)
+		if node == nil {
+			continue
+		}
+
+		var err error
+		start := len(event.Buf)
+		if p.config.Mode == modeEncode {
+			event.Buf, err = p.encode(event.Buf, node)
+		} else {
+			event.Buf, err = p.decode(event.Buf, node)
+		}
+		if err != nil {
+			event.Buf = event.Buf[:start]
+			p.logger.Debugf("can't %s %s field value: %s", p.config.Mode, p.config.Codec, err.Error())
+			if p.errorsMetric != nil {
+				p.errorsMetric.WithLabelValues().Inc()
+			}
+			if p.config.OnError == onErrorDiscard {
+				return pipeline.ActionDiscard
+			}
+			continue
+		}
+
+		node.MutateToString(pipeline.ByteToStringUnsafe(event.Buf[start:]))
+	}
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) encode(buf []byte, node *insaneJSON.Node) ([]byte, error) {
+	if node.IsObject() || node.IsArray() {
+		return buf, errNotScalar
+	}
+	value := node.AsBytes()
+	if !node.IsString() {
+		value = node.Encode(nil)
+	}
+
+	switch p.config.Codec {
+	case codecBase64:
+		return appendEncoded(buf, value, base64.StdEncoding.EncodedLen(len(value)), base64.StdEncoding.Encode), nil
+	case codecBase64URL:
+		return appendEncoded(buf, value, base64.URLEncoding.EncodedLen(len(value)), base64.URLEncoding.Encode), nil
+	case codecHex:
+		return appendEncoded(buf, value, hex.EncodedLen(len(value)), func(dst, src []byte) { hex.Encode(dst, src) }), nil
+	case codecURL:
+		return append(buf, url.QueryEscape(string(value))...), nil
+	default:
+		return buf, errWrongCodec
+	}
+}
+
+func (p *Plugin) decode(buf []byte, node *insaneJSON.Node) ([]byte, error) {
+	if !node.IsString() {
+		return buf, errNotString
+	}
+	value := node.AsBytes()
+
+	start := len(buf)
+	var err error
+	switch p.config.Codec {
+	case codecBase64:
+		buf, err = appendBase64Decoded(buf, value, base64.RawStdEncoding)
+	case codecBase64URL:
+		buf, err = appendBase64Decoded(buf, value, base64.RawURLEncoding)
+	case codecHex:
+		buf = grow(buf, hex.DecodedLen(len(value)))
+		var n int
+		n, err = hex.Decode(buf[start:], value)
+		buf = buf[:start+n]
+	case codecURL:
+		var s string
+		s, err = url.QueryUnescape(string(value))
+		buf = append(buf, s...)
+	default:
+		err = errWrongCodec
+	}
+	if err != nil {
+		return buf, err
+	}
+
+	if !utf8.Valid(buf[start:]) {
+		return buf, errNotUTF8
+	}
+	return buf, nil
+}
+
+// appendBase64Decoded decodes the value with or without the padding.
+func appendBase64Decoded(buf, value []byte, encoding *base64.Encoding) ([]byte, error) {
+	for len(value) > 0 && value[len(value)-1] == '=' {
+		value = value[:len(value)-1]
+	}
+
+	start := len(buf)
+	buf = grow(buf, encoding.DecodedLen(len(value)))
+	n, err := encoding.Decode(buf[start:], value)
+	return buf[:start+n], err
+}
+
+func appendEncoded(buf, value []byte, size int, encode func(dst, src []byte)) []byte {
+	start := len(buf)
+	buf = grow(buf, size)
+	encode(buf[start:], value)
+	return buf
+}
+
+// grow extends the buf by the size bytes.
+func grow(buf []byte, size int) []byte {
+	l := len(buf)
+	if cap(buf)-l < size {
+		grown := make([]byte, l, 2*cap(buf)+size)
+		copy(grown, buf)
+		buf = grown
+	}
+	return buf[:l+size]
+}
@@ -0,0 +1,131 @@
+package codec
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+		result pipeline.ActionResult
+		errors float64
+	}{
+		{
+			name:   "base64 decode",
+			config: &Config{Fields: []string{"a", "b.c", "d"}},
+			in:     `{"a":"aGVsbG8=","b":{"c":"d29ybGQ"}}`,
+			out:    `{"a":"hello","b":{"c":"world"}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "base64 encode",
+			config: &Config{Fields: []string{"a", "n"}, Mode: "encode"},
+			in:     `{"a":"hello","n":42}`,
+			out:    `{"a":"aGVsbG8=","n":"NDI="}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "base64url",
+			config: &Config{Fields: []string{"a"}, Codec: "base64url"},
+			in:     `{"a":"Pz8_"}`,
+			out:    `{"a":"???"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "url decode",
+			config: &Config{Fields: []string{"query"}, Codec: "url"},
+			in:     `{"query":"q%3Dfile.d%26page%3D2+x"}`,
+			out:    `{"query":"q=file.d&page=2 x"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "url encode",
+			config: &Config{Fields: []string{"query"}, Codec: "url", Mode: "encode"},
+			in:     `{"query":"a b&c=\"d\""}`,
+			out:    `{"query":"a+b%26c%3D%22d%22"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "hex",
+			config: &Config{Fields: []string{"a", "b"}, Codec: "hex"},
+			in:     `{"a":"6869","b":"4A534F4E"}`,
+			out:    `{"a":"hi","b":"JSON"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "hex encode",
+			config: &Config{Fields: []string{"a"}, Codec: "hex", Mode: "encode"},
+			in:     `{"a":"hi"}`,
+			out:    `{"a":"6869"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "keep on error",
+			config: &Config{Fields: []string{"a", "b", "c", "d"}, Codec: "hex"},
+			in:     `{"a":"zz","b":"ff","c":1,"d":"6869"}`,
+			out:    `{"a":"zz","b":"ff","c":1,"d":"hi"}`,
+			result: pipeline.ActionPass,
+			errors: 3,
+		},
+		{
+			name:   "encode object",
+			config: &Config{Fields: []string{"a"}, Mode: "encode", OnError: "discard"},
+			in:     `{"a":{"b":1}}`,
+			result: pipeline.ActionDiscard,
+			errors: 1,
+		},
+		{
+			name:   "discard on error",
+			config: &Config{Fields: []string{"a"}, OnError: "discard"},
+			in:     `{"a":"a%b"}`,
+			result: pipeline.ActionDiscard,
+			errors: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			var plugin *Plugin
+			pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+				plugin = &Plugin{}
+				return plugin, &Config{}
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+			assert.Equal(t, tc.errors, testutil.ToFloat64(plugin.errorsMetric.WithLabelValues()))
+		})
+	}
+}
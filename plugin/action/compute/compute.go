@@ -0,0 +1,160 @@
+package compute
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It computes the numeric fields with the arithmetic formulas of the other fields,
+e.g. the durations from the timestamps or the sizes in the other units.
+
+The formulas consist of the numbers, the fields, the operators `+`, `-`, `*`, `/`, `%`, the parentheses
+and the functions `abs(x)`, `ceil(x)`, `floor(x)`, `round(x)` or `round(x, places)`, `min(x, ...)` and `max(x, ...)`.
+The fields are the selectors like `request.time`, the selectors with the other characters are quoted
+with the backticks, e.g. `` `k8s.labels.app\.size` ``.
+The fields are the numbers or the strings with the numbers.
+
+If the formula can't be computed because the field is missing or isn't a number or it's divided by zero,
+the field is left unchanged or set according to `on_missing`.
+All the formulas see the original event. The integer results are written as the integers.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: compute
+      fields:
+        duration_ms: (end - start) * 1000
+        response.size_kb: round(response.size / 1024, 2)
+    ...
+```
+The event:
+```json
+{"start":1682936400.25,"end":1682936400.5,"response":{"size":"4000"}}
+```
+becomes:
+```json
+{"start":1682936400.25,"end":1682936400.5,"response":{"size":"4000","size_kb":3.91},"duration_ms":250}
+```
+}*/
+
+const (
+	onMissingSkip = "skip"
+	onMissingNull = "null"
+	onMissingZero = "zero"
+)
+
+type formula struct {
+	field []string
+	x     operand
+}
+
+type Plugin struct {
+	config   *Config
+	logger   *zap.SugaredLogger
+	formulas []formula
+	results  []float64
+	computed []bool
+
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The map of the field selectors to the formulas to compute them.
+	Fields map[string]string `json:"fields" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the formula can't be computed:
+	// > * `skip` leaves the field unchanged
+	// > * `null` sets the field to `null`
+	// > * `zero` sets the field to `0`
+	OnMissing string `json:"on_missing" default:"skip" options:"skip|null|zero"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "compute",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if len(p.config.Fields) == 0 {
+		p.logger.Fatalf("no fields to compute")
+	}
+
+	names := make([]string, 0, len(p.config.Fields))
+	for name := range p.config.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := cfg.ParseFieldSelector(name)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in fields")
+		}
+		x, err := parseFormula(p.config.Fields[name])
+		if err != nil {
+			p.logger.Fatalf("can't parse formula of field %q: %s", name, err.Error())
+		}
+		p.formulas = append(p.formulas, formula{field: path, x: x})
+	}
+	p.results = make([]float64, len(p.formulas))
+	p.computed = make([]bool, len(p.formulas))
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	for i, f := range p.formulas {
+		v, ok := f.x.eval(event.Root)
+		p.results[i] = v
+		p.computed[i] = ok && !math.IsNaN(v) && !math.IsInf(v, 0)
+	}
+
+	for i, f := range p.formulas {
+		if !p.computed[i] {
+			switch p.config.OnMissing {
+			case onMissingNull:
+				pipeline.AddField(event.Root, f.field).MutateToNull()
+			case onMissingZero:
+				pipeline.AddField(event.Root, f.field).MutateToInt(0)
+			}
+			continue
+		}
+
+		node := pipeline.AddField(event.Root, f.field)
+		v := p.results[i]
+		// the integers are exact in float64 up to 2^53
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			node.MutateToInt64(int64(v))
+		} else {
+			node.MutateToFloat(v)
+		}
+	}
+
+	return pipeline.ActionPass
+}
@@ -0,0 +1,97 @@
+package compute
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompute(t *testing.T) {
+	cases := []struct {
+		name      string
+		fields    map[string]string
+		onMissing string
+		in        string
+		out       string
+	}{
+		{
+			name:   "arithmetic",
+			fields: map[string]string{"duration_ms": "(end - start) * 1000", "x": "-2 * 3 + 10 % 4 / 2 - -1"},
+			in:     `{"start":1682936400.25,"end":"1682936400.5"}`,
+			out:    `{"start":1682936400.25,"end":"1682936400.5","duration_ms":250,"x":-4}`,
+		},
+		{
+			name: "functions",
+			fields: map[string]string{
+				"resp.size_kb": "round(resp.size / 1024, 2)",
+				"resp.bounded": "max(min(resp.size, 3000), 100)",
+				"abs":          "abs(floor(-1.5)) + ceil(0.1) + round(2.5)",
+			},
+			in:  `{"resp":{"size":4000}}`,
+			out: `{"resp":{"size":4000,"bounded":3000,"size_kb":3.91},"abs":6}`,
+		},
+		{
+			name:   "quoted field",
+			fields: map[string]string{"sum": "`labels.app\\.size` + 1e1"},
+			in:     `{"labels":{"app.size":"5"}}`,
+			out:    `{"labels":{"app.size":"5"},"sum":15}`,
+		},
+		{
+			name:   "original event",
+			fields: map[string]string{"a": "b * 2", "b": "a * 2"},
+			in:     `{"a":1,"b":10}`,
+			out:    `{"a":20,"b":2}`,
+		},
+		{
+			name:   "skip",
+			fields: map[string]string{"a": "missing + 1", "b": "x / 0", "c": "s * 2", "x": "x + 1"},
+			in:     `{"x":1,"s":"str","c":"old"}`,
+			out:    `{"x":2,"s":"str","c":"old"}`,
+		},
+		{
+			name:      "null",
+			fields:    map[string]string{"a.b": "missing + 1", "c": "obj % 0"},
+			onMissing: "null",
+			in:        `{"obj":{}}`,
+			out:       `{"obj":{},"a":{"b":null},"c":null}`,
+		},
+		{
+			name:      "zero",
+			fields:    map[string]string{"a": "missing + 1"},
+			onMissing: "zero",
+			in:        `{}`,
+			out:       `{"a":0}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{Fields: tc.fields, OnMissing: tc.onMissing}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
+
+func TestParseFormulaErrors(t *testing.T) {
+	for _, s := range []string{"", "a +", "(a", "a b", "foo(a)", "round()", "round(a, 1, 2)", "1.2.3", "`a", "a..b", "a # b"} {
+		_, err := parseFormula(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,330 @@
+package compute
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ozontech/file.d/cfg"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+// operand is the compiled part of the formula.
+// eval returns false if the value can't be computed, e.g. the field is missing or it's divided by zero.
+type operand interface {
+	eval(root *insaneJSON.Root) (float64, bool)
+}
+
+type number float64
+
+func (n number) eval(_ *insaneJSON.Root) (float64, bool) {
+	return float64(n), true
+}
+
+type field []string
+
+func (f field) eval(root *insaneJSON.Root) (float64, bool) {
+	node := root.Dig(f...)
+	if node == nil || !(node.IsNumber() || node.IsString()) {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(node.AsString()), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+type neg struct {
+	x operand
+}
+
+func (n neg) eval(root *insaneJSON.Root) (float64, bool) {
+	v, ok := n.x.eval(root)
+	return -v, ok
+}
+
+type binary struct {
+	op   byte
+	l, r operand
+}
+
+func (b binary) eval(root *insaneJSON.Root) (float64, bool) {
+	l, ok := b.l.eval(root)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.r.eval(root)
+	if !ok {
+		return 0, false
+	}
+
+	switch b.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	case '/':
+		return l / r, r != 0
+	default:
+		return math.Mod(l, r), r != 0
+	}
+}
+
+type call struct {
+	fn   *function
+	args []operand
+}
+
+func (c call) eval(root *insaneJSON.Root) (float64, bool) {
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		v, ok := arg.eval(root)
+		if !ok {
+			return 0, false
+		}
+		args[i] = v
+	}
+	return c.fn.eval(args), true
+}
+
+type function struct {
+	minArgs int
+	maxArgs int
+	eval    func(args []float64) float64
+}
+
+var functions = map[string]*function{
+	"abs":   {minArgs: 1, maxArgs: 1, eval: func(args []float64) float64 { return math.Abs(args[0]) }},
+	"ceil":  {minArgs: 1, maxArgs: 1, eval: func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"floor": {minArgs: 1, maxArgs: 1, eval: func(args []float64) float64 { return math.Floor(args[0]) }},
+	"round": {minArgs: 1, maxArgs: 2, eval: round},
+	"min":   {minArgs: 1, maxArgs: -1, eval: minOf},
+	"max":   {minArgs: 1, maxArgs: -1, eval: maxOf},
+}
+
+// round rounds the value to the number of the decimal places, zero by default.
+func round(args []float64) float64 {
+	if len(args) == 1 {
+		return math.Round(args[0])
+	}
+	scale := math.Pow(10, math.Trunc(args[1]))
+	return math.Round(args[0]*scale) / scale
+}
+
+func minOf(args []float64) float64 {
+	result := args[0]
+	for _, v := range args[1:] {
+		result = math.Min(result, v)
+	}
+	return result
+}
+
+func maxOf(args []float64) float64 {
+	result := args[0]
+	for _, v := range args[1:] {
+		result = math.Max(result, v)
+	}
+	return result
+}
+
+// parser parses the formula with the recursive descent:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = unary { ("*" | "/" | "%") unary }
+//	unary  = "-" unary | atom
+//	atom   = number | field | name "(" expr { "," expr } ")" | "(" expr ")"
+//	field  = name { "." name } | "`" selector "`"
+type parser struct {
+	s   string
+	pos int
+}
+
+func parseFormula(s string) (operand, error) {
+	p := &parser{s: s}
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos])
+	}
+	return x, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// next skips the spaces and returns the next char or zero at the end.
+func (p *parser) next() byte {
+	p.skipSpaces()
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *parser) expr() (operand, error) {
+	l, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == '+' || op == '-'; op = p.next() {
+		p.pos++
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) term() (operand, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == '*' || op == '/' || op == '%'; op = p.next() {
+		p.pos++
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) unary() (operand, error) {
+	if p.next() == '-' {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return neg{x: x}, nil
+	}
+	return p.atom()
+}
+
+func (p *parser) atom() (operand, error) {
+	c := p.next()
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	case c == '(':
+		p.pos++
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ')' {
+			return nil, p.errorf("expected ')'")
+		}
+		p.pos++
+		return x, nil
+	case c == '`':
+		end := strings.IndexByte(p.s[p.pos+1:], '`')
+		if end < 0 {
+			return nil, p.errorf("unclosed '`'")
+		}
+		path := cfg.ParseFieldSelector(p.s[p.pos+1 : p.pos+1+end])
+		if len(path) == 0 {
+			return nil, p.errorf("empty field")
+		}
+		p.pos += end + 2
+		return field(path), nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.number()
+	case isNameChar(c):
+		return p.name()
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *parser) number() (operand, error) {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		isExp := (c == '+' || c == '-') && (p.s[p.pos-1] == 'e' || p.s[p.pos-1] == 'E')
+		if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || isExp) {
+			break
+		}
+		p.pos++
+	}
+	text := p.s[start:p.pos]
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("wrong number %q", text)
+	}
+	return number(v), nil
+}
+
+func (p *parser) name() (operand, error) {
+	start := p.pos
+	for p.pos < len(p.s) && (isNameChar(p.s[p.pos]) || p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] == '.') {
+		p.pos++
+	}
+	name := p.s[start:p.pos]
+
+	if p.next() != '(' {
+		path := strings.Split(name, ".")
+		for _, part := range path {
+			if part == "" {
+				p.pos = start
+				return nil, p.errorf("wrong field %q", name)
+			}
+		}
+		return field(path), nil
+	}
+
+	fn, has := functions[name]
+	if !has {
+		p.pos = start
+		return nil, p.errorf("unknown function %q", name)
+	}
+	p.pos++
+
+	var args []operand
+	if p.next() != ')' {
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.next() != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.next() != ')' {
+		return nil, p.errorf("expected ')'")
+	}
+	p.pos++
+
+	if len(args) < fn.minArgs || fn.maxArgs >= 0 && len(args) > fn.maxArgs {
+		return nil, errors.New("wrong number of arguments of " + name)
+	}
+	return call{fn: fn, args: args}, nil
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -1,20 +1,56 @@
 package convert_date
 
 import (
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
 )
 
 /*{ introduction
 It converts field date/time data to different format.
+
+The dates without the timezone are parsed in the `source_timezone` and are converted to the `target_timezone`
+before formatting. The epoch timestamps may be fractional, e.g. `1682936400.25` seconds or `1682936400250.5` milliseconds.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: convert_date
+      field: ts
+      source_formats: [timestampmilli, "2006-01-02 15:04:05"]
+      source_timezone: Europe/Moscow
+      target_format: rfc3339
+      target_timezone: UTC
+    ...
+```
+It transforms `{"ts":"2023-05-01 13:20:00"}` into `{"ts":"2023-05-01T10:20:00Z"}`.
 }*/
 
+// epochUnits are the units of the epoch timestamp formats.
+var epochUnits = map[string]time.Duration{
+	"timestamp":      time.Second,
+	"timestampmilli": time.Millisecond,
+	"timestampmicro": time.Microsecond,
+	"timestampnano":  time.Nanosecond,
+}
+
 type Plugin struct {
 	config *Config
+
+	sourceLocation *time.Location
+	targetLocation *time.Location
+
 	plugin.NoMetricsPlugin
 }
 
@@ -29,16 +65,27 @@ type Config struct {
 
 	// > @3@4@5@6
 	// >
-	// > List of date formats to parse a field. Available list items should be one of `ansic|unixdate|rubydate|rfc822|rfc822z|rfc850|rfc1123|rfc1123z|rfc3339|rfc3339nano|kitchen|stamp|stampmilli|stampmicro|stampnano`.
+	// > List of date formats to parse a field. Available list items should be one of `ansic|unixdate|rubydate|rfc822|rfc822z|rfc850|rfc1123|rfc1123z|rfc3339|rfc3339nano|kitchen|stamp|stampmilli|stampmicro|stampnano`
+	// > or the epoch `timestamp|timestampmilli|timestampmicro|timestampnano`.
 	SourceFormats  []string `json:"source_formats" default:"rfc3339nano,rfc3339"` // *
 	SourceFormats_ []string
 
 	// > @3@4@5@6
 	// >
-	// > Date format to convert to.
+	// > Date format to convert to, the epoch `timestamp|timestampmilli|timestampmicro|timestampnano` are written as integers.
 	TargetFormat  string `json:"target_format" default:"timestamp"` // *
 	TargetFormat_ string
 
+	// > @3@4@5@6
+	// >
+	// > The timezone of the dates without the timezone, e.g. `Europe/Moscow`.
+	SourceTimezone string `json:"source_timezone" default:"UTC"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The timezone to convert the dates to, the timezone of the parsed date is kept if it's empty.
+	TargetTimezone string `json:"target_timezone"` // *
+
 	// > @3@4@5@6
 	// >
 	// > Remove field if conversion fails.
@@ -60,19 +107,99 @@ func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams
 	p.config = config.(*Config)
 
 	for _, formatName := range p.config.SourceFormats {
-		format, err := pipeline.ParseFormatName(formatName)
+		p.config.SourceFormats_ = append(p.config.SourceFormats_, parseFormat(formatName))
+	}
+	p.config.TargetFormat_ = parseFormat(p.config.TargetFormat)
+
+	var err error
+	p.sourceLocation, err = time.LoadLocation(p.config.SourceTimezone)
+	if err != nil {
+		logger.Fatalf("can't load source_timezone %q: %s", p.config.SourceTimezone, err.Error())
+	}
+	if p.config.TargetTimezone != "" {
+		p.targetLocation, err = time.LoadLocation(p.config.TargetTimezone)
 		if err != nil {
-			format = formatName
+			logger.Fatalf("can't load target_timezone %q: %s", p.config.TargetTimezone, err.Error())
+		}
+	}
+}
+
+// parseFormat returns the layout of the format name, the epoch and custom formats are returned as is.
+func parseFormat(formatName string) string {
+	if _, ok := epochUnits[formatName]; ok {
+		return formatName
+	}
+	format, err := pipeline.ParseFormatName(formatName)
+	if err != nil {
+		return formatName
+	}
+	return format
+}
+
+// parseEpoch parses the integer or fractional epoch timestamp of the unit.
+// The decimal fraction is parsed exactly up to the nanoseconds, the other notations are parsed as floats.
+func parseEpoch(value string, unit time.Duration) (time.Time, error) {
+	integer, fraction, hasFraction := strings.Cut(value, ".")
+	ts, err := strconv.ParseInt(integer, 10, 64)
+	if err == nil && !hasFraction {
+		return time.Unix(0, ts*int64(unit)), nil
+	}
+	if err == nil && isDigits(fraction) {
+		if len(fraction) > 9 {
+			fraction = fraction[:9]
+		}
+		nanos, _ := strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 64)
+		nanos = nanos * int64(unit) / int64(time.Second)
+		if strings.HasPrefix(integer, "-") {
+			nanos = -nanos
 		}
-		p.config.SourceFormats_ = append(p.config.SourceFormats_, format)
+		return time.Unix(0, ts*int64(unit)+nanos), nil
 	}
 
-	format, err := pipeline.ParseFormatName(p.config.TargetFormat)
+	f, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		format = p.config.TargetFormat
+		return time.Time{}, err
 	}
+	seconds, frac := math.Modf(f * float64(unit) / float64(time.Second))
+	return time.Unix(int64(seconds), int64(frac*float64(time.Second))), nil
+}
 
-	p.config.TargetFormat_ = format
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Plugin) parse(format, value string) (time.Time, error) {
+	if unit, ok := epochUnits[format]; ok {
+		return parseEpoch(value, unit)
+	}
+	return time.ParseInLocation(format, value, p.sourceLocation)
+}
+
+func (p *Plugin) convert(node *insaneJSON.Node, t time.Time) {
+	if p.targetLocation != nil {
+		t = t.In(p.targetLocation)
+	}
+
+	switch p.config.TargetFormat_ {
+	case "timestamp":
+		node.MutateToInt(int(t.Unix()))
+	case "timestampmilli":
+		node.MutateToInt(int(t.UnixMilli()))
+	case "timestampmicro":
+		node.MutateToInt(int(t.UnixMicro()))
+	case "timestampnano":
+		node.MutateToInt(int(t.UnixNano()))
+	default:
+		node.MutateToString(t.Format(p.config.TargetFormat_))
+	}
 }
 
 func (p *Plugin) Stop() {
@@ -87,13 +214,9 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	if isValidType {
 		date := dateNode.AsString()
 		for _, format := range p.config.SourceFormats_ {
-			t, err := time.Parse(format, date)
+			t, err := p.parse(format, date)
 			if err == nil {
-				if p.config.TargetFormat_ == "timestamp" {
-					dateNode.MutateToInt(int(t.Unix()))
-				} else {
-					dateNode.MutateToString(t.Format(p.config.TargetFormat_))
-				}
+				p.convert(dateNode, t)
 
 				return pipeline.ActionPass // successful conversion
 			}
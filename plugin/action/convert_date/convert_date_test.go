@@ -76,3 +76,75 @@ func TestConvertFail(t *testing.T) {
 	assert.Equal(t, 1, len(outEvents), "wrong out events count")
 	assert.Equal(t, `{}`, outEvents[0].Root.EncodeToString(), "wrong out event")
 }
+
+func TestConvertTimezoneAndEpoch(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+	}{
+		{
+			name:   "fractional seconds",
+			config: &Config{SourceFormats: []string{"rfc3339", "timestamp"}, TargetFormat: "timestampmilli"},
+			in:     `{"time":1682936400.25}`,
+			out:    `{"time":1682936400250}`,
+		},
+		{
+			name:   "fractional millis",
+			config: &Config{SourceFormats: []string{"timestampmilli"}, TargetFormat: "timestampnano"},
+			in:     `{"time":"1682936400250.5"}`,
+			out:    `{"time":1682936400250500000}`,
+		},
+		{
+			name:   "millis to rfc3339",
+			config: &Config{SourceFormats: []string{"timestampmilli"}, TargetFormat: "rfc3339nano", TargetTimezone: "UTC"},
+			in:     `{"time":1682936400250}`,
+			out:    `{"time":"2023-05-01T10:20:00.25Z"}`,
+		},
+		{
+			name: "source timezone",
+			config: &Config{
+				SourceFormats:  []string{"2006-01-02 15:04:05"},
+				TargetFormat:   "rfc3339",
+				SourceTimezone: "Europe/Moscow",
+				TargetTimezone: "UTC",
+			},
+			in:  `{"time":"2023-05-01 13:20:00"}`,
+			out: `{"time":"2023-05-01T10:20:00Z"}`,
+		},
+		{
+			name:   "target timezone",
+			config: &Config{SourceFormats: []string{"rfc3339"}, TargetFormat: "2006-01-02 15:04:05", TargetTimezone: "Asia/Tokyo"},
+			in:     `{"time":"2023-05-01T10:20:00Z"}`,
+			out:    `{"time":"2023-05-01 19:20:00"}`,
+		},
+		{
+			name:   "parsed timezone kept",
+			config: &Config{SourceFormats: []string{"rfc3339"}, TargetFormat: "rfc3339"},
+			in:     `{"time":"2023-05-01T13:20:00+03:00"}`,
+			out:    `{"time":"2023-05-01T13:20:00+03:00"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
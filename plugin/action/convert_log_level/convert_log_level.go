@@ -16,11 +16,13 @@ const (
 
 /*{ introduction
 It converts the log level field according RFC-5424.
+The custom levels, e.g. the levels of the other loggers or the numeric levels, can be converted with the `mapping`.
 }*/
 
 type Plugin struct {
-	config *Config
-	logger *zap.SugaredLogger
+	config  *Config
+	logger  *zap.SugaredLogger
+	mapping map[string]pipeline.LogLevel
 	plugin.NoMetricsPlugin
 }
 
@@ -71,6 +73,19 @@ type Config struct {
 	// > This can happen when the level is unknown. For example:
 	// > `{ "level": "my_error_level" }`
 	RemoveOnFail bool `json:"remove_on_fail" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The custom levels mapped to the RFC-5424 levels, it's checked before the RFC-5424 levels.
+	// > The keys are compared in lower case and trimmed, the values are the RFC-5424 level names or numbers. For example:
+	// > ```yaml
+	// > mapping:
+	// >   FATAL: critical
+	// >   trace: debug
+	// >   "10": debug
+	// >   "30": info
+	// > ```
+	Mapping map[string]string `json:"mapping"` // *
 }
 
 func init() {
@@ -89,6 +104,29 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginP
 	p.logger = params.Logger
 
 	p.config.Style = strings.ToLower(strings.TrimSpace(p.config.Style))
+
+	p.mapping = make(map[string]pipeline.LogLevel, len(p.config.Mapping))
+	for from, to := range p.config.Mapping {
+		level := pipeline.ParseLevelAsNumber(to)
+		if level == pipeline.LevelUnknown {
+			p.logger.Fatalf("unknown level %q of the %q mapping", to, from)
+		}
+		p.mapping[normalizeLevel(from)] = level
+	}
+}
+
+func normalizeLevel(level string) string {
+	return strings.ToLower(strings.TrimSpace(level))
+}
+
+// parse returns the level of the custom mapping or the RFC-5424 one.
+func (p *Plugin) parse(level string) pipeline.LogLevel {
+	if len(p.mapping) != 0 {
+		if mapped, ok := p.mapping[normalizeLevel(level)]; ok {
+			return mapped
+		}
+	}
+	return pipeline.ParseLevelAsNumber(level)
 }
 
 func (p *Plugin) Stop() {
@@ -112,17 +150,12 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 		level = p.config.DefaultLevel
 	}
 
-	var fail bool
-	if p.config.Style == "string" {
-		parsedLevel := pipeline.ParseLevelAsString(level)
-		fail = parsedLevel == pipeline.LevelUnknownStr
-		if !fail {
-			node.MutateToString(parsedLevel)
-		}
-	} else {
-		parsedLevel := pipeline.ParseLevelAsNumber(level)
-		fail = parsedLevel == pipeline.LevelUnknown
-		if !fail {
+	parsedLevel := p.parse(level)
+	fail := parsedLevel == pipeline.LevelUnknown
+	if !fail {
+		if p.config.Style == "string" {
+			node.MutateToString(parsedLevel.String())
+		} else {
 			node.MutateToInt(int(parsedLevel))
 		}
 	}
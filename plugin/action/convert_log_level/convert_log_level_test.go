@@ -220,6 +220,27 @@ func TestDo(t *testing.T) {
 			In:  []string{`{"info":{"level":{"a":{}}}}`},
 			Out: []string{`{"info":{"level":{"a":{"b":{"c":{"value":1}}}}}}`},
 		},
+		{
+			Name: "custom mapping",
+			Config: Config{
+				Field:   "level",
+				Style:   "string",
+				Mapping: map[string]string{"FATAL": "critical", "trace": "7", "30": "info", "info": "notice"},
+			},
+			In:  []string{`{"level":"fatal"}`, `{"level":" TRACE "}`, `{"level":30}`, `{"level":"info"}`, `{"level":"warn"}`},
+			Out: []string{`{"level":"critical"}`, `{"level":"debug"}`, `{"level":"informational"}`, `{"level":"notice"}`, `{"level":"warning"}`},
+		},
+		{
+			Name: "custom mapping with number style and default",
+			Config: Config{
+				Field:        "level",
+				Style:        "number",
+				DefaultLevel: "trace",
+				Mapping:      map[string]string{"trace": "debug"},
+			},
+			In:  []string{`{}`, `{"level":"TRACE"}`},
+			Out: []string{`{"level":7}`, `{"level":7}`},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -0,0 +1,284 @@
+package convert_type
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It converts the values of the fields to the types: `int`, `float`, `bool` or `string`.
+The strict outputs like Clickhouse or Postgres may reject the events with the field types
+different from the table columns while the applications aren't so strict.
+
+The conversion rules:
+* `int`: the numbers and the strings with the integers or the floats with zero fraction, e.g. `"42"` or `1e3`; `true` and `false` are `1` and `0`.
+* `float`: the numbers and the strings with the numbers; `true` and `false` are `1` and `0`.
+* `bool`: `true`, `false` and the numbers and the strings `1`, `0`, `t`, `f`, `true`, `false` in any case.
+* `string`: the strings and the numbers as is, the booleans are `"true"` and `"false"`, the objects and the arrays are encoded to JSON.
+
+The `null` values can't be converted. The missing fields are skipped.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: convert_type
+      fields:
+        status: int
+        request_time: float
+        cached: bool
+        user.id: string
+      on_error: default
+      defaults:
+        status: "0"
+    ...
+```
+The event:
+```json
+{"status":"200","request_time":"0.015","cached":"1","user":{"id":42}}
+```
+becomes:
+```json
+{"status":200,"request_time":0.015,"cached":true,"user":{"id":"42"}}
+```
+}*/
+
+const (
+	typeInt    = "int"
+	typeFloat  = "float"
+	typeBool   = "bool"
+	typeString = "string"
+
+	onErrorKeep    = "keep"
+	onErrorNull    = "null"
+	onErrorDiscard = "discard"
+	onErrorDefault = "default"
+)
+
+type field struct {
+	name string
+	path []string
+	typ  string
+	// def is the default value of the field with the type
+	def string
+}
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	fields []field
+	buf    []byte
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The map of the field selectors to the types to convert the fields to: `int`, `float`, `bool` or `string`.
+	Fields map[string]string `json:"fields" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the field can't be converted:
+	// > * `keep` leaves the field as is
+	// > * `null` sets the field to `null`
+	// > * `discard` discards the event
+	// > * `default` sets the field to the value from `defaults`
+	OnError string `json:"on_error" default:"keep" options:"keep|null|discard|default"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The map of the field selectors to the default values used with `on_error: default`.
+	// > The default values are converted to the types of the fields, the zero values of the types are used for the missing fields.
+	Defaults map[string]string `json:"defaults"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "convert_type",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if len(p.config.Fields) == 0 {
+		p.logger.Fatalf("no fields to convert")
+	}
+
+	names := make([]string, 0, len(p.config.Fields))
+	for name := range p.config.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := cfg.ParseFieldSelector(name)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in fields")
+		}
+
+		typ := p.config.Fields[name]
+		def, ok := "", false
+		switch typ {
+		case typeInt:
+			def, ok = "0", true
+		case typeFloat:
+			def, ok = "0", true
+		case typeBool:
+			def, ok = "false", true
+		case typeString:
+			def, ok = "", true
+		}
+		if !ok {
+			p.logger.Fatalf("wrong type %q of field %q, it must be one of int, float, bool or string", typ, name)
+		}
+
+		if value, has := p.config.Defaults[name]; has {
+			def, ok = convertString(value, typ)
+			if !ok {
+				p.logger.Fatalf("can't convert default value %q of field %q to %s", value, name, typ)
+			}
+		}
+		p.fields = append(p.fields, field{name: name, path: path, typ: typ, def: def})
+	}
+
+	for name := range p.config.Defaults {
+		if _, has := p.config.Fields[name]; !has {
+			p.logger.Fatalf("default value of field %q which isn't in fields", name)
+		}
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("convert_type_errors_total", "Number of fields failed to convert", "field")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	for i := range p.fields {
+		f := &p.fields[i]
+		node := event.Root.Dig(f.path...)
+		if node == nil {
+			continue
+		}
+		if p.convert(event.Root, node, f.typ) {
+			continue
+		}
+
+		p.errorsMetric.WithLabelValues(f.name).Inc()
+		switch p.config.OnError {
+		case onErrorNull:
+			node.MutateToNull()
+		case onErrorDiscard:
+			return pipeline.ActionDiscard
+		case onErrorDefault:
+			setValue(node, f.def, f.typ)
+		}
+	}
+
+	return pipeline.ActionPass
+}
+
+// convert converts the node to the type, it returns false and leaves the node unchanged if it's impossible.
+func (p *Plugin) convert(root *insaneJSON.Root, node *insaneJSON.Node, typ string) bool {
+	switch {
+	case node.IsNull():
+		return false
+	case node.IsObject() || node.IsArray():
+		if typ != typeString {
+			return false
+		}
+		p.buf = node.Encode(p.buf[:0])
+		node.MutateToBytesCopy(root, p.buf)
+		return true
+	}
+
+	value, ok := convertString(node.AsString(), typ)
+	if !ok {
+		return false
+	}
+	setValue(node, value, typ)
+	return true
+}
+
+// convertString converts the string representation of the scalar value to the string representation of the type.
+func convertString(value string, typ string) (string, bool) {
+	switch typ {
+	case typeInt:
+		switch value {
+		case "true":
+			return "1", true
+		case "false":
+			return "0", true
+		}
+		value = strings.TrimSpace(value)
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), true
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return "", false
+		}
+		return strconv.FormatInt(int64(f), 10), true
+	case typeFloat:
+		switch value {
+		case "true":
+			return "1", true
+		case "false":
+			return "0", true
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	case typeBool:
+		b, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(value)))
+		if err != nil {
+			return "", false
+		}
+		return strconv.FormatBool(b), true
+	default:
+		return value, true
+	}
+}
+
+// setValue sets the node to the value converted by convertString.
+func setValue(node *insaneJSON.Node, value string, typ string) {
+	switch typ {
+	case typeInt:
+		i, _ := strconv.ParseInt(value, 10, 64)
+		node.MutateToInt64(i)
+	case typeFloat:
+		f, _ := strconv.ParseFloat(value, 64)
+		node.MutateToFloat(f)
+	case typeBool:
+		node.MutateToBool(value == "true")
+	default:
+		node.MutateToString(value)
+	}
+}
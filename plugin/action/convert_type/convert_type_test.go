@@ -0,0 +1,98 @@
+package convert_type
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertType(t *testing.T) {
+	fields := map[string]string{
+		"int":    "int",
+		"float":  "float",
+		"bool":   "bool",
+		"string": "string",
+	}
+	cases := []struct {
+		name     string
+		onError  string
+		defaults map[string]string
+		in       string
+		out      string
+		result   pipeline.ActionResult
+	}{
+		{
+			name: "strings",
+			in:   `{"int":" 42","float":"0.015","bool":"TRUE","string":"s"}`,
+			out:  `{"int":42,"float":0.015,"bool":true,"string":"s"}`,
+		},
+		{
+			name: "other types",
+			in:   `{"int":1e3,"float":true,"bool":0,"string":{"a":[1,"b"]}}`,
+			out:  `{"int":1000,"float":1,"bool":false,"string":"{\"a\":[1,\"b\"]}"}`,
+		},
+		{
+			name: "scalars to string",
+			in:   `{"string":1.5,"other":"x"}`,
+			out:  `{"string":"1.5","other":"x"}`,
+		},
+		{
+			name: "keep",
+			in:   `{"int":1.5,"float":"-","bool":"yes","string":null}`,
+			out:  `{"int":1.5,"float":"-","bool":"yes","string":null}`,
+		},
+		{
+			name:    "null",
+			onError: "null",
+			in:      `{"int":"1.5","float":[1],"bool":2}`,
+			out:     `{"int":null,"float":null,"bool":null}`,
+		},
+		{
+			name:     "default",
+			onError:  "default",
+			defaults: map[string]string{"int": "-1"},
+			in:       `{"int":"x","float":"x","bool":"x","string":null}`,
+			out:      `{"int":-1,"float":0,"bool":false,"string":""}`,
+		},
+		{
+			name:    "discard",
+			onError: "discard",
+			in:      `{"int":"1","float":"x"}`,
+			result:  pipeline.ActionDiscard,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{Fields: fields, OnError: tc.onError, Defaults: tc.defaults}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+		})
+	}
+}
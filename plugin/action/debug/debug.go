@@ -1,21 +1,96 @@
 package debug
 
 import (
+	"sync"
+
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
 )
 
 /*{ introduction
 It logs event to stdout. Useful for debugging.
+
+To debug the production pipelines without flooding the logs, only one of `sample` events may be dumped
+and the dumps may be written to the file which is rotated by the size.
+
+In the `diff` mode the action dumps the changes made to the event by the next action instead of the event,
+the added fields are prefixed with `+`, the removed ones with `-` and the changed ones with `~`.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: debug
+      sample: 1000
+      file: /var/log/file.d/debug.log
+      diff: true
+    - type: modify
+      level: '${severity}'
+    ...
+```
+The dump of the event `{"severity":"warn","message":"slow query"}` is:
+```
+diff of event after next action (passed):
++ level: "warn"
+```
 }*/
 
+var (
+	filesMu = &sync.Mutex{}
+	// files are the dump files which are shared by the processors of the action.
+	files = make(map[*Config]*dumpFile)
+)
+
 type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	file   *dumpFile
+
+	counter uint64
+	// pending is the event sampled in the diff mode and its encoding before the next action.
+	pending *pipeline.Event
+	before  []byte
+	buf     []byte
 	plugin.NoMetricsPlugin
 }
 
-type Config map[string]any
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > One of `sample` events is dumped, the events are counted on each processor separately. `1` dumps all events.
+	Sample int `json:"sample" default:"1"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The file to write the dumps to. The dumps are logged if it's empty.
+	File string `json:"file"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Max size of the dump file, e.g. `100 MiB`. Once it's exceeded, the file is rotated
+	// > and the previous files are renamed to `<file>.1`, `<file>.2` and so on.
+	MaxFileSize  string `json:"max_file_size" default:"100 MiB" parse:"data_unit"` // *
+	MaxFileSize_ uint64
+
+	// > @3@4@5@6
+	// >
+	// > The number of the rotated files to keep.
+	MaxFiles int `json:"max_files" default:"3"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the changes made to the event by the next action are dumped instead of the event.
+	// > Nothing is dumped if the action is the last one.
+	Diff bool `json:"diff"` // *
+}
 
 func init() {
 	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
@@ -28,15 +103,116 @@ func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 	return &Plugin{}, &Config{}
 }
 
-func (p *Plugin) Start(_ pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if p.config.Sample < 1 {
+		p.logger.Fatalf("sample must be greater than 0, got %d", p.config.Sample)
+	}
+	if p.config.MaxFiles < 0 {
+		p.logger.Fatalf("max_files can't be negative")
+	}
+
+	if p.config.File != "" {
+		var err error
+		p.file, err = acquireFile(p.config)
+		if err != nil {
+			p.logger.Fatalf("can't open dump file: %s", err.Error())
+		}
+	}
+}
+
+// acquireFile opens the dump file once for all the processors of the action.
+func acquireFile(config *Config) (*dumpFile, error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	if f, has := files[config]; has {
+		f.refs++
+		return f, nil
+	}
+
+	f, err := openDumpFile(config.File, int64(config.MaxFileSize_), config.MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	f.refs++
+	files[config] = f
+	return f, nil
+}
+
+// releaseFile closes the dump file once all the processors of the action are stopped.
+func releaseFile(config *Config) error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	f := files[config]
+	f.refs--
+	if f.refs > 0 {
+		return nil
+	}
+	delete(files, config)
+	return f.close()
 }
 
 func (p *Plugin) Stop() {
+	if p.file == nil {
+		return
+	}
+	if err := releaseFile(p.config); err != nil {
+		p.logger.Errorf("can't close dump file: %s", err.Error())
+	}
 }
 
 func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
-	buf, _ := event.Encode(nil)
-	logger.Infof("%s", buf)
+	p.pending = nil
+
+	p.counter++
+	if p.counter%uint64(p.config.Sample) != 0 {
+		return pipeline.ActionPass
+	}
+
+	if p.config.Diff {
+		p.pending = event
+		p.before = event.Root.Encode(p.before[:0])
+		return pipeline.ActionPass
+	}
+
+	p.buf, _ = event.Encode(p.buf[:0])
+	p.dump(p.buf)
 
 	return pipeline.ActionPass
 }
+
+// AfterNextAction dumps the changes made by the next action to the event sampled in the diff mode.
+func (p *Plugin) AfterNextAction(event *pipeline.Event, status string) {
+	if p.pending != event {
+		return
+	}
+	p.pending = nil
+
+	before, err := insaneJSON.DecodeBytes(p.before)
+	if err != nil {
+		p.logger.Errorf("can't decode event before next action: %s", err.Error())
+		return
+	}
+	defer insaneJSON.Release(before)
+
+	p.buf = append(p.buf[:0], "diff of event after next action ("...)
+	p.buf = append(p.buf, status...)
+	p.buf = append(p.buf, "):"...)
+	p.buf = appendDiff(p.buf, before.Node, event.Root.Node)
+	p.dump(p.buf)
+}
+
+func (p *Plugin) dump(data []byte) {
+	if p.file == nil {
+		logger.Infof("%s", data)
+		return
+	}
+
+	if err := p.file.write(data); err != nil {
+		p.logger.Errorf("can't write dump: %s", err.Error())
+	}
+}
@@ -0,0 +1,96 @@
+package debug
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+// renamePlugin moves the severity to the level.
+type renamePlugin struct {
+	plugin.NoMetricsPlugin
+}
+
+func (p *renamePlugin) Start(_ pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {}
+
+func (p *renamePlugin) Stop() {}
+
+func (p *renamePlugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	severity := event.Root.Dig("severity")
+	event.Root.AddFieldNoAlloc(event.Root, "level").MutateToString(severity.AsString())
+	severity.Suicide()
+	event.Root.Dig("meta", "n").MutateToInt(2)
+	return pipeline.ActionPass
+}
+
+func TestDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug.log")
+	config := test.NewConfig(&Config{Sample: 2, File: path, Diff: true}, nil)
+
+	actions := test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false)
+	actions = append(actions, test.NewActionPluginStaticInfo(func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		return &renamePlugin{}, nil
+	}, nil, pipeline.MatchModeAnd, nil, false)...)
+
+	p, input, output := test.NewPipelineMock(actions)
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	output.SetOutFn(func(e *pipeline.Event) {
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"severity":"warn","meta":{"n":1}}`))
+	input.In(0, "test.log", 0, []byte(`{"severity":"error","meta":{"n":1,"x":{}}}`))
+	wg.Wait()
+	p.Stop()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `diff of event after next action (passed):
+- severity: "error"
+~ meta.n: 1 -> 2
++ level: "error"
+`, string(data))
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug.log")
+	f, err := openDumpFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, s := range []string{"aaaa", "bbbb", "cccc", "dddd", "eeee", "ffff", "gggg", "hhhh"} {
+		require.NoError(t, f.write([]byte(s)))
+	}
+	require.NoError(t, f.close())
+
+	// every file fits two dumps, the oldest ones are removed
+	files := map[string]string{path: "gggg\nhhhh\n", path + ".1": "eeee\nffff\n", path + ".2": "cccc\ndddd\n"}
+	for name, content := range files {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data), name)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAppendDiff(t *testing.T) {
+	before, err := insaneJSON.DecodeString(`{"a":1,"b":{"c":[1,2],"d.e":"x"},"f":{}}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(before)
+	after, err := insaneJSON.DecodeString(`{"a":1,"b":{"c":[2,1],"d.e":"x"},"f":{"g":null}}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(after)
+
+	diff := string(appendDiff(nil, before.Node, after.Node))
+	assert.Equal(t, []string{"", "~ b.c: [1,2] -> [2,1]", "- f: {}", "+ f.g: null"}, strings.Split(diff, "\n"))
+}
@@ -0,0 +1,156 @@
+package debug
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+// dumpFile writes the dumps line by line and rotates the file once it exceeds the max size.
+type dumpFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	// refs is the number of the processors using the file.
+	refs int
+}
+
+func openDumpFile(path string, maxSize int64, maxFiles int) (*dumpFile, error) {
+	f := &dumpFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(os.O_APPEND); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *dumpFile) open(flag int) error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|flag, 0o644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = stat.Size()
+	return nil
+}
+
+func (f *dumpFile) write(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(data))+1 > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return fmt.Errorf("can't rotate file: %w", err)
+		}
+	}
+
+	n, err := f.file.Write(append(data, '\n'))
+	f.size += int64(n)
+	return err
+}
+
+// rotate renames the file to <path>.1 shifting the previous rotated files and opens the new file.
+func (f *dumpFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if f.maxFiles > 0 {
+		for i := f.maxFiles - 1; i > 0; i-- {
+			err := os.Rename(rotatedName(f.path, i), rotatedName(f.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.path, rotatedName(f.path, 1)); err != nil {
+			return err
+		}
+	}
+
+	return f.open(os.O_TRUNC)
+}
+
+func (f *dumpFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+func rotatedName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// appendDiff appends the lines of the added, the removed and the changed leaf fields.
+// The arrays are compared as the whole values.
+func appendDiff(buf []byte, before, after *insaneJSON.Node) []byte {
+	beforeFields := flatten(nil, "", before)
+	afterFields := flatten(nil, "", after)
+
+	afterValues := make(map[string]string, len(afterFields))
+	for _, f := range afterFields {
+		afterValues[f.path] = f.value
+	}
+	beforeValues := make(map[string]string, len(beforeFields))
+	for _, f := range beforeFields {
+		beforeValues[f.path] = f.value
+	}
+
+	for _, f := range beforeFields {
+		value, has := afterValues[f.path]
+		switch {
+		case !has:
+			buf = appendLine(buf, "- ", f.path, f.value)
+		case value != f.value:
+			buf = appendLine(buf, "~ ", f.path, f.value+" -> "+value)
+		}
+	}
+	for _, f := range afterFields {
+		if _, has := beforeValues[f.path]; !has {
+			buf = appendLine(buf, "+ ", f.path, f.value)
+		}
+	}
+	return buf
+}
+
+type leaf struct {
+	path  string
+	value string
+}
+
+// flatten collects the leaf fields with the dot separated paths, the empty nested objects are the leaves.
+func flatten(leaves []leaf, path string, node *insaneJSON.Node) []leaf {
+	if node.IsObject() && (len(node.AsFields()) > 0 || path == "") {
+		for _, field := range node.AsFields() {
+			name := field.AsString()
+			if strings.Contains(name, ".") {
+				name = `"` + name + `"`
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			leaves = flatten(leaves, name, field.AsFieldValue())
+		}
+		return leaves
+	}
+	return append(leaves, leaf{path: path, value: node.EncodeToString()})
+}
+
+func appendLine(buf []byte, prefix, path, value string) []byte {
+	buf = append(buf, '\n')
+	buf = append(buf, prefix...)
+	buf = append(buf, path...)
+	buf = append(buf, ": "...)
+	return append(buf, value...)
+}
@@ -0,0 +1,315 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It decompresses the gzip, zlib, raw deflate or zstd value of the event field.
+The decompressed value is written to the `target` field or replaces the source value if the `target` is empty.
+If the `decode_json` is set, the decompressed value is decoded as JSON and the decoded object is merged with the event root if the `target` is empty.
+
+The `auto` format detects gzip, zlib and zstd by the magic bytes, the raw deflate has no header so it must be set explicitly.
+The decompressed value must be a valid UTF-8 string and mustn't exceed the `max_size`, it protects from the decompression bombs.
+The failed events are counted in the `decompress_errors_total` metric.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: decompress
+      field: payload
+      format: gzip
+      decode_json: true
+    ...
+```
+It transforms `{"payload":"H4sIAAAAAAACA6tWykktS81RslLKzEvLV6oFAN/kj+AQAAAA"}` into `{"level":"info"}`.
+}*/
+
+const (
+	formatAuto    = "auto"
+	formatGzip    = "gzip"
+	formatZlib    = "zlib"
+	formatDeflate = "deflate"
+	formatZstd    = "zstd"
+
+	encodingBase64 = "base64"
+
+	onErrorDiscard = "discard"
+)
+
+var (
+	errUnknownFormat = errors.New("unknown compression format")
+	errTooLarge      = errors.New("decompressed value exceeds max size")
+	errNotUTF8       = errors.New("decompressed value isn't a valid UTF-8 string")
+	errNotObject     = errors.New("decoded value isn't an object")
+)
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+
+	reader *bytes.Reader
+	gzip   *gzip.Reader
+	zlib   io.ReadCloser
+	flate  io.ReadCloser
+	zstd   *zstd.Decoder
+
+	buf []byte
+	out []byte
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field with the compressed value.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" required:"true"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The encoding of the field:
+	// > * `base64` – the value is encoded with the standard base64
+	// > * `raw` – the field contains the compressed bytes as is
+	Encoding string `json:"encoding" default:"base64" options:"base64|raw"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The compression format, `auto` detects gzip, zlib and zstd.
+	Format string `json:"format" default:"auto" options:"auto|gzip|zlib|deflate|zstd"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The max size of the decompressed value, e.g. `1 MiB`.
+	MaxSize  string `json:"max_size" default:"1 MiB" parse:"data_unit"` // *
+	MaxSize_ uint64
+
+	// > @3@4@5@6
+	// >
+	// > If set, the decompressed value is decoded as JSON.
+	DecodeJSON bool `json:"decode_json"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the decompressed value into, the source field is removed if it's set.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the value can't be decompressed:
+	// > * `keep` passes the event unchanged
+	// > * `discard` discards the event
+	OnError string `json:"on_error" default:"keep" options:"keep|discard"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "decompress",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if p.config.MaxSize_ == 0 {
+		logger.Fatalf("max_size must be greater than zero")
+	}
+
+	p.reader = bytes.NewReader(nil)
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("decompress_errors_total", "Number of events decompress plugin failed to decompress")
+}
+
+func (p *Plugin) Stop() {
+	if p.zstd != nil {
+		p.zstd.Close()
+	}
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	fieldNode := event.Root.Dig(p.config.Field_...)
+	if fieldNode == nil {
+		return pipeline.ActionPass
+	}
+
+	err := p.decompressField(event, fieldNode)
+	if err != nil {
+		p.logger.Debugf("can't decompress field value: %s", err.Error())
+		if p.errorsMetric != nil {
+			p.errorsMetric.WithLabelValues().Inc()
+		}
+		if p.config.OnError == onErrorDiscard {
+			return pipeline.ActionDiscard
+		}
+	}
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) decompressField(event *pipeline.Event, fieldNode *insaneJSON.Node) error {
+	data := fieldNode.AsBytes()
+	if p.config.Encoding == encodingBase64 {
+		size := base64.StdEncoding.DecodedLen(len(data))
+		if cap(p.buf) < size {
+			p.buf = make([]byte, size)
+		}
+		n, err := base64.StdEncoding.Decode(p.buf[:size], data)
+		if err != nil {
+			return fmt.Errorf("can't decode base64: %w", err)
+		}
+		data = p.buf[:n]
+	}
+
+	var err error
+	p.out, err = p.decompress(p.out[:0], data)
+	if err != nil {
+		return err
+	}
+
+	if !p.config.DecodeJSON {
+		if !utf8.Valid(p.out) {
+			return errNotUTF8
+		}
+		if len(p.config.Target_) == 0 {
+			fieldNode.MutateToBytesCopy(event.Root, p.out)
+			return nil
+		}
+		fieldNode.Suicide()
+		pipeline.AddField(event.Root, p.config.Target_).MutateToBytesCopy(event.Root, p.out)
+		return nil
+	}
+
+	node, err := event.SubparseJSON(p.out)
+	if err != nil {
+		return err
+	}
+	if !node.IsObject() && len(p.config.Target_) == 0 {
+		return errNotObject
+	}
+
+	fieldNode.Suicide()
+	if len(p.config.Target_) == 0 {
+		// place decoded object under root
+		event.Root.MergeWith(node)
+		return nil
+	}
+	pipeline.AddField(event.Root, p.config.Target_).MutateToNode(node)
+	return nil
+}
+
+// decompress appends the decompressed data to the buf.
+func (p *Plugin) decompress(buf, data []byte) ([]byte, error) {
+	format := p.config.Format
+	if format == formatAuto {
+		format = detectFormat(data)
+	}
+
+	p.reader.Reset(data)
+	var r io.Reader
+	var err error
+	switch format {
+	case formatGzip:
+		if p.gzip == nil {
+			p.gzip, err = gzip.NewReader(p.reader)
+		} else {
+			err = p.gzip.Reset(p.reader)
+		}
+		r = p.gzip
+	case formatZlib:
+		if p.zlib == nil {
+			p.zlib, err = zlib.NewReader(p.reader)
+		} else {
+			err = p.zlib.(zlib.Resetter).Reset(p.reader, nil)
+		}
+		r = p.zlib
+	case formatDeflate:
+		if p.flate == nil {
+			p.flate = flate.NewReader(p.reader)
+		} else {
+			err = p.flate.(flate.Resetter).Reset(p.reader, nil)
+		}
+		r = p.flate
+	case formatZstd:
+		if p.zstd == nil {
+			p.zstd, err = zstd.NewReader(p.reader, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(p.config.MaxSize_+1))
+		} else {
+			err = p.zstd.Reset(p.reader)
+		}
+		r = p.zstd
+	default:
+		return buf, errUnknownFormat
+	}
+	if err != nil {
+		return buf, err
+	}
+
+	return readAll(buf, io.LimitReader(r, int64(p.config.MaxSize_)+1), int(p.config.MaxSize_))
+}
+
+// detectFormat detects the compression format by the magic bytes.
+func detectFormat(data []byte) string {
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		return formatGzip
+	case len(data) >= 4 && data[0] == 0x28 && data[1] == 0xb5 && data[2] == 0x2f && data[3] == 0xfd:
+		return formatZstd
+	case len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		return formatZlib
+	default:
+		return ""
+	}
+}
+
+// readAll appends the data of the reader to the buf, the data mustn't exceed the max size.
+func readAll(buf []byte, r io.Reader, maxSize int) ([]byte, error) {
+	start := len(buf)
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if len(buf)-start > maxSize {
+			return buf, errTooLarge
+		}
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
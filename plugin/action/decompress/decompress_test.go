@@ -0,0 +1,181 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, format, data string) string {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	var err error
+	switch format {
+	case formatGzip:
+		w = gzip.NewWriter(buf)
+	case formatZlib:
+		w = zlib.NewWriter(buf)
+	case formatDeflate:
+		w, err = flate.NewWriter(buf, flate.DefaultCompression)
+	case formatZstd:
+		w, err = zstd.NewWriter(buf)
+	}
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDecompress(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+		result pipeline.ActionResult
+		errors float64
+	}{
+		{
+			name:   "gzip",
+			config: &Config{Field: "payload"},
+			in:     `{"payload":"` + compress(t, formatGzip, "hello\n") + `"}`,
+			out:    `{"payload":"hello\n"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "zlib",
+			config: &Config{Field: "payload", Target: "data.message"},
+			in:     `{"payload":"` + compress(t, formatZlib, "hello") + `"}`,
+			out:    `{"data":{"message":"hello"}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "deflate",
+			config: &Config{Field: "payload", Format: "deflate"},
+			in:     `{"payload":"` + compress(t, formatDeflate, "hello") + `"}`,
+			out:    `{"payload":"hello"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "zstd json",
+			config: &Config{Field: "payload", DecodeJSON: true},
+			in:     `{"ts":1,"payload":"` + compress(t, formatZstd, `{"level":"info","tags":["a"]}`) + `"}`,
+			out:    `{"ts":1,"level":"info","tags":["a"]}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "json target",
+			config: &Config{Field: "payload", DecodeJSON: true, Target: "data"},
+			in:     `{"payload":"` + compress(t, formatGzip, `[1,2]`) + `"}`,
+			out:    `{"data":[1,2]}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "json not object",
+			config: &Config{Field: "payload", DecodeJSON: true},
+			in:     `{"payload":"` + compress(t, formatGzip, `[1,2]`) + `"}`,
+			out:    `{"payload":"` + compress(t, formatGzip, `[1,2]`) + `"}`,
+			result: pipeline.ActionPass,
+			errors: 1,
+		},
+		{
+			name:   "too large",
+			config: &Config{Field: "payload", MaxSize: "1 KiB", OnError: "discard"},
+			in:     `{"payload":"` + compress(t, formatZstd, strings.Repeat("a", 1025)) + `"}`,
+			result: pipeline.ActionDiscard,
+			errors: 1,
+		},
+		{
+			name:   "max size",
+			config: &Config{Field: "payload", MaxSize: "1 KiB"},
+			in:     `{"payload":"` + compress(t, formatGzip, strings.Repeat("a", 1024)) + `"}`,
+			out:    `{"payload":"` + strings.Repeat("a", 1024) + `"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "unknown format",
+			config: &Config{Field: "payload", OnError: "discard"},
+			in:     `{"payload":"aGVsbG8="}`,
+			result: pipeline.ActionDiscard,
+			errors: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			var plugin *Plugin
+			pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+				plugin = &Plugin{}
+				return plugin, &Config{}
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+			assert.Equal(t, tc.errors, testutil.ToFloat64(plugin.errorsMetric.WithLabelValues()))
+		})
+	}
+}
+
+func TestDecompressReuse(t *testing.T) {
+	config := test.NewConfig(&Config{Field: "payload"}, nil)
+	formats := []string{formatGzip, formatZstd, formatZlib, formatGzip, formatZstd, formatZlib}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(formats))
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	expected := make([]string, 0)
+	for _, format := range formats {
+		input.In(0, "test.log", 0, []byte(`{"payload":"`+compress(t, format, format)+`"}`))
+		expected = append(expected, `{"payload":"`+format+`"}`)
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	assert.Equal(t, expected, outEvents)
+}
@@ -0,0 +1,73 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	fingerprint uint64
+	seenAt      time.Time
+}
+
+// cache holds the fingerprints seen within the ttl.
+// The entries are ordered by the time they're seen first, so the oldest ones are evicted
+// both when they're expired and when the cache is full.
+type cache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+
+	entries map[uint64]*list.Element
+	order   *list.List
+}
+
+func newCache(ttl time.Duration, maxEntries int) *cache {
+	return &cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[uint64]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// seen returns true if the fingerprint was seen within the ttl, otherwise it remembers the fingerprint.
+func (c *cache) seen(fingerprint uint64, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired(now)
+
+	if _, ok := c.entries[fingerprint]; ok {
+		return true
+	}
+
+	if c.order.Len() >= c.maxEntries {
+		c.remove(c.order.Front())
+	}
+	c.entries[fingerprint] = c.order.PushBack(&entry{fingerprint: fingerprint, seenAt: now})
+	return false
+}
+
+func (c *cache) evictExpired(now time.Time) {
+	for {
+		oldest := c.order.Front()
+		if oldest == nil || now.Sub(oldest.Value.(*entry).seenAt) < c.ttl {
+			return
+		}
+		c.remove(oldest)
+	}
+}
+
+func (c *cache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*entry).fingerprint)
+}
+
+func (c *cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
@@ -0,0 +1,146 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+/*{ introduction
+It discards the events which have the same values of the `fields` as an event seen within the `window`.
+It helps to get rid of the duplicates produced by the retries of the upstream services.
+
+The fingerprints of the events are shared by all processors of the pipeline. When there are more than `max_entries`
+fingerprints, the oldest ones are forgotten, every fingerprint takes about 100 bytes of memory.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: dedup
+      fields: [request_id, message]
+      window: 5m
+    ...
+```
+}*/
+
+var (
+	caches   = map[*Config]*cacheRef{}
+	cachesMu = &sync.Mutex{}
+)
+
+type cacheRef struct {
+	cache *cache
+	refs  int
+}
+
+type Plugin struct {
+	config *Config
+	cache  *cache
+
+	fields [][]string
+	buf    []byte
+
+	discardedMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event fields to compute the fingerprint of. The missing fields are taken into account too.
+	Fields []string `json:"fields" required:"true" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The events with the same fingerprint are discarded within this window after the first one.
+	Window  cfg.Duration `json:"window" default:"1m" parse:"duration"` // *
+	Window_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > The maximum number of the fingerprints to hold in memory.
+	MaxEntries int `json:"max_entries" default:"1000000"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "dedup",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+
+	if len(p.config.Fields) == 0 {
+		params.Logger.Fatalf("fields must be set")
+	}
+	p.fields = make([][]string, 0, len(p.config.Fields))
+	for _, field := range p.config.Fields {
+		p.fields = append(p.fields, cfg.ParseFieldSelector(field))
+	}
+
+	// the config is shared by the processors, so it identifies the cache of the action.
+	cachesMu.Lock()
+	ref, ok := caches[p.config]
+	if !ok {
+		ref = &cacheRef{cache: newCache(p.config.Window_, p.config.MaxEntries)}
+		caches[p.config] = ref
+	}
+	ref.refs++
+	p.cache = ref.cache
+	cachesMu.Unlock()
+}
+
+func (p *Plugin) Stop() {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	ref := caches[p.config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(caches, p.config)
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.discardedMetric = ctl.RegisterCounter("dedup_discarded_total", "Number of duplicate events discarded by dedup plugin")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	if p.cache.seen(p.fingerprint(event), time.Now()) {
+		p.discardedMetric.WithLabelValues().Inc()
+		return pipeline.ActionDiscard
+	}
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) fingerprint(event *pipeline.Event) uint64 {
+	p.buf = p.buf[:0]
+	for _, field := range p.fields {
+		node := event.Root.Dig(field...)
+		if node == nil {
+			// the missing field differs from any encoded value.
+			p.buf = append(p.buf, 0)
+		} else {
+			p.buf = node.Encode(p.buf)
+		}
+		// the separator makes the fingerprint of ["ab", "c"] differ from ["a", "bc"].
+		p.buf = append(p.buf, 0xFF)
+	}
+	return xxhash.Sum64(p.buf)
+}
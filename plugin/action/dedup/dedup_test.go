@@ -0,0 +1,63 @@
+package dedup
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	c := newCache(time.Minute, 2)
+	now := time.Now()
+
+	assert.False(t, c.seen(1, now))
+	assert.True(t, c.seen(1, now.Add(time.Second)))
+	assert.False(t, c.seen(2, now.Add(time.Second)))
+
+	// the oldest fingerprint is evicted when the cache is full.
+	assert.False(t, c.seen(3, now.Add(2*time.Second)))
+	assert.Equal(t, 2, c.len())
+	assert.False(t, c.seen(1, now.Add(3*time.Second)))
+
+	// the window starts from the first event, the duplicates don't prolong it.
+	assert.False(t, c.seen(4, now.Add(time.Hour)))
+	assert.Equal(t, 1, c.len())
+}
+
+func TestDo(t *testing.T) {
+	config := test.NewConfig(&Config{Fields: []string{"request.id", "message"}}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"request":{"id":1},"message":"a"}`))
+	input.In(0, "test.log", 0, []byte(`{"request":{"id":1},"message":"a","retry":1}`))
+	input.In(0, "test.log", 0, []byte(`{"request":{"id":1},"message":"b"}`))
+	input.In(0, "test.log", 0, []byte(`{"message":"a"}`))
+	input.In(0, "test.log", 0, []byte(`{"message":"a"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	cachesMu.Lock()
+	assert.Empty(t, caches, "cache is removed once the processors are stopped")
+	cachesMu.Unlock()
+
+	require.Equal(t, 3, len(outEvents))
+	assert.Equal(t, []string{
+		`{"request":{"id":1},"message":"a"}`,
+		`{"request":{"id":1},"message":"b"}`,
+		`{"message":"a"}`,
+	}, outEvents)
+}
@@ -1,9 +1,14 @@
 package discard
 
 import (
+	"regexp"
+	"sort"
+
+	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/zap"
 )
 
 /*{ introduction
@@ -20,13 +25,73 @@ pipelines:
         level: /info|debug/
     ...
 ```
+
+The event may be also discarded by its own conditions which are checked after `match_fields`:
+the size of the event, the missing fields and the regexps of the field values.
+Without the conditions all the matched events are discarded.
+
+**An example for discarding the huge events and the events without the message or the service:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: discard
+      event_size_above: 1 MiB
+      field_missing: [message, service]
+      field_matches:
+        message: /^\s*$/
+      conditions_mode: or
+    ...
+```
 }*/
 
+const (
+	modeAnd = "and"
+	modeOr  = "or"
+)
+
+type valueMatcher struct {
+	field []string
+	re    *regexp.Regexp
+}
+
 type Plugin struct {
+	config   *Config
+	logger   *zap.SugaredLogger
+	missing  [][]string
+	matchers []valueMatcher
+	// conditions is the number of the configured conditions.
+	conditions int
 	plugin.NoMetricsPlugin
 }
 
-type Config struct{}
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event is discarded if its size in bytes as it was read by the input exceeds the value, e.g. `1 MiB`.
+	// > Zero means no condition.
+	EventSizeAbove  string `json:"event_size_above" default:"0 b" parse:"data_unit"` // *
+	EventSizeAbove_ uint64
+
+	// > @3@4@5@6
+	// >
+	// > The list of the field selectors, every missing field is the condition.
+	FieldMissing []string `json:"field_missing" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The map of the field selectors to the regexps like `/^debug$/`, every field which value matches the regexp is the condition.
+	// > The missing fields don't match.
+	FieldMatches map[string]string `json:"field_matches"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How the conditions are combined: `and` discards the event if all of them are met, `or` – if any of them is met.
+	ConditionsMode string `json:"conditions_mode" default:"and" options:"and|or"` // *
+}
 
 func init() {
 	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
@@ -39,12 +104,76 @@ func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 	return &Plugin{}, &Config{}
 }
 
-func (p *Plugin) Start(_ pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config, _ = config.(*Config)
+	if p.config == nil {
+		p.config = &Config{}
+	}
+	p.logger = params.Logger
+
+	for _, field := range p.config.FieldMissing {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in field_missing")
+		}
+		p.missing = append(p.missing, path)
+	}
+
+	fields := make([]string, 0, len(p.config.FieldMatches))
+	for field := range p.config.FieldMatches {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in field_matches")
+		}
+		re, err := cfg.CompileRegex(p.config.FieldMatches[field])
+		if err != nil {
+			p.logger.Fatalf("can't compile regexp of field %s: %s", field, err.Error())
+		}
+		p.matchers = append(p.matchers, valueMatcher{field: path, re: re})
+	}
+
+	p.conditions = len(p.missing) + len(p.matchers)
+	if p.config.EventSizeAbove_ > 0 {
+		p.conditions++
+	}
 }
 
 func (p *Plugin) Stop() {
 }
 
-func (p *Plugin) Do(_ *pipeline.Event) pipeline.ActionResult {
-	return pipeline.ActionDiscard
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	if p.conditions == 0 || p.isMatch(event) {
+		return pipeline.ActionDiscard
+	}
+	return pipeline.ActionPass
+}
+
+// isMatch checks the conditions of the event in the order of their cost.
+func (p *Plugin) isMatch(event *pipeline.Event) bool {
+	isOr := p.config.ConditionsMode == modeOr
+
+	if p.config.EventSizeAbove_ > 0 {
+		if (uint64(event.Size) > p.config.EventSizeAbove_) == isOr {
+			return isOr
+		}
+	}
+
+	for _, field := range p.missing {
+		if (event.Root.Dig(field...) == nil) == isOr {
+			return isOr
+		}
+	}
+
+	for _, m := range p.matchers {
+		node := event.Root.Dig(m.field...)
+		if (node != nil && m.re.MatchString(node.AsString())) == isOr {
+			return isOr
+		}
+	}
+
+	return !isOr
 }
@@ -182,3 +182,73 @@ func TestDiscardMatchInvert(t *testing.T) {
 	assert.Equal(t, 3, len(outEvents), "wrong out events count")
 	assert.Equal(t, `{"field2":"value2"}`, outEvents[0].Root.EncodeToString(), "wrong event json")
 }
+
+func TestConditions(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  *Config
+		in      string
+		discard bool
+	}{
+		{
+			name:    "size",
+			config:  &Config{EventSizeAbove: "16 b"},
+			in:      `{"message":"long message"}`,
+			discard: true,
+		},
+		{
+			name:   "small size",
+			config: &Config{EventSizeAbove: "1 KiB"},
+			in:     `{"message":"long message"}`,
+		},
+		{
+			name:    "missing and matches",
+			config:  &Config{FieldMissing: []string{"service", "k8s.pod"}, FieldMatches: map[string]string{"message": `/^\s*$/`}},
+			in:      `{"message":"  "}`,
+			discard: true,
+		},
+		{
+			name:   "not all conditions",
+			config: &Config{FieldMissing: []string{"service"}, FieldMatches: map[string]string{"message": `/^\s*$/`, "level": "/debug/"}},
+			in:     `{"message":""}`,
+		},
+		{
+			name:    "or",
+			config:  &Config{FieldMissing: []string{"service"}, FieldMatches: map[string]string{"level": "/debug/"}, ConditionsMode: "or"},
+			in:      `{"service":"api","level":"debug"}`,
+			discard: true,
+		},
+		{
+			name:   "or not met",
+			config: &Config{EventSizeAbove: "1 KiB", FieldMissing: []string{"service"}, FieldMatches: map[string]string{"level": "/debug/"}, ConditionsMode: "or"},
+			in:     `{"service":"api","level":"info"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			// the action skips the last event, so the discarded event is processed once the last one is got
+			conds := pipeline.MatchConditions{{Field: []string{"last"}, Values: []string{"true"}}}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, conds, true))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			discarded := true
+			output.SetOutFn(func(e *pipeline.Event) {
+				if e.Root.Dig("last") != nil {
+					wg.Done()
+					return
+				}
+				discarded = false
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{"last":"true"}`))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.discard, discarded)
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It encrypts the values of the event fields with AES-GCM or decrypts them back.
+
+The JSON of the value is encrypted, so the objects, the arrays and the numbers are restored with their types on the decryption.
+The encrypted value is the base64 string of the random nonce followed by the ciphertext,
+it's prefixed with the key ID and the colon like `k1:<base64>` if the `key_id` is set.
+On the decryption the key is chosen by the key ID of the value, so the old keys can be kept in the `keys` after the key rotation.
+
+The keys are the base64 strings of 16, 24 or 32 bytes selecting AES-128, AES-192 or AES-256.
+Keep them in Vault using the `vault(path/to/secret, key)` syntax of the config.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: encrypt
+      fields: [user.email, card]
+      key: vault(secret/prod/file_d, aes_key)
+      key_id: k2
+    ...
+```
+It transforms `{"card":"4111111111111111"}` into `{"card":"k2:<base64 of the nonce and the ciphertext>"}`.
+}*/
+
+const (
+	modeDecrypt = "decrypt"
+
+	onErrorDiscard = "discard"
+
+	keyIDSeparator = ':'
+)
+
+var (
+	errNotString  = errors.New("encrypted value isn't a string")
+	errUnknownKey = errors.New("unknown key id")
+	errShortValue = errors.New("encrypted value is too short")
+)
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	fields [][]string
+
+	aead  cipher.AEAD
+	aeads map[string]cipher.AEAD
+
+	buf []byte
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The list of the field selectors to encrypt or decrypt.
+	Fields []string `json:"fields" required:"true" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Whether to encrypt or to decrypt the values.
+	Mode string `json:"mode" default:"encrypt" options:"encrypt|decrypt"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The base64 key to encrypt the values and to decrypt the values without the key ID or with the `key_id`.
+	Key string `json:"key" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The ID of the `key` to prefix the encrypted values with.
+	KeyID string `json:"key_id"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The additional base64 keys by their IDs to decrypt the values encrypted with the previous keys.
+	Keys map[string]string `json:"keys"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the value can't be encrypted or decrypted:
+	// > * `keep` keeps the value unchanged
+	// > * `discard` discards the event
+	OnError string `json:"on_error" default:"keep" options:"keep|discard"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "encrypt",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	for _, field := range p.config.Fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			logger.Fatalf("empty field in fields")
+		}
+		p.fields = append(p.fields, path)
+	}
+
+	var err error
+	p.aead, err = newAEAD(p.config.Key)
+	if err != nil {
+		logger.Fatalf("can't create cipher of key: %s", err.Error())
+	}
+	if bytes.IndexByte([]byte(p.config.KeyID), keyIDSeparator) != -1 {
+		logger.Fatalf("key_id %q mustn't contain %q", p.config.KeyID, keyIDSeparator)
+	}
+
+	p.aeads = make(map[string]cipher.AEAD, len(p.config.Keys)+1)
+	for id, key := range p.config.Keys {
+		p.aeads[id], err = newAEAD(key)
+		if err != nil {
+			logger.Fatalf("can't create cipher of key %q: %s", id, err.Error())
+		}
+	}
+	p.aeads[""] = p.aead
+	p.aeads[p.config.KeyID] = p.aead
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("encrypt_errors_total", "Number of field values encrypt plugin failed to process")
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	for _, path := range p.fields {
+		node := event.Root.Dig(path...)
+		if node == nil {
+			continue
+		}
+
+		var err error
+		if p.config.Mode == modeDecrypt {
+			err = p.decrypt(event, node)
+		} else {
+			err = p.encrypt(event, node)
+		}
+		if err != nil {
+			p.logger.Debugf("can't %s field value: %s", p.config.Mode, err.Error())
+			if p.errorsMetric != nil {
+				p.errorsMetric.WithLabelValues().Inc()
+			}
+			if p.config.OnError == onErrorDiscard {
+				return pipeline.ActionDiscard
+			}
+		}
+	}
+
+	return pipeline.ActionPass
+}
+
+// encrypt replaces the value with the key ID and the base64 of the nonce and the ciphertext.
+func (p *Plugin) encrypt(event *pipeline.Event, node *insaneJSON.Node) error {
+	nonceSize := p.aead.NonceSize()
+	p.buf = append(p.buf[:0], make([]byte, nonceSize)...)
+	if _, err := rand.Read(p.buf); err != nil {
+		return fmt.Errorf("can't generate nonce: %w", err)
+	}
+
+	// the plain text is placed after the nonce and is encrypted in place
+	p.buf = node.Encode(p.buf)
+	p.buf = p.aead.Seal(p.buf[:nonceSize], p.buf[:nonceSize], p.buf[nonceSize:], nil)
+
+	start := len(event.Buf)
+	if p.config.KeyID != "" {
+		event.Buf = append(event.Buf, p.config.KeyID...)
+		event.Buf = append(event.Buf, keyIDSeparator)
+	}
+	l := len(event.Buf)
+	size := base64.StdEncoding.EncodedLen(len(p.buf))
+	event.Buf = append(event.Buf, make([]byte, size)...)
+	base64.StdEncoding.Encode(event.Buf[l:], p.buf)
+
+	node.MutateToString(pipeline.ByteToStringUnsafe(event.Buf[start:]))
+	return nil
+}
+
+func (p *Plugin) decrypt(event *pipeline.Event, node *insaneJSON.Node) error {
+	if !node.IsString() {
+		return errNotString
+	}
+	value := node.AsBytes()
+
+	keyID := ""
+	if pos := bytes.IndexByte(value, keyIDSeparator); pos != -1 {
+		keyID, value = string(value[:pos]), value[pos+1:]
+	}
+	aead, ok := p.aeads[keyID]
+	if !ok {
+		return fmt.Errorf("%w %q", errUnknownKey, keyID)
+	}
+
+	size := base64.StdEncoding.DecodedLen(len(value))
+	if cap(p.buf) < size {
+		p.buf = make([]byte, size)
+	}
+	n, err := base64.StdEncoding.Decode(p.buf[:size], value)
+	if err != nil {
+		return fmt.Errorf("can't decode base64: %w", err)
+	}
+	if n < aead.NonceSize()+aead.Overhead() {
+		return errShortValue
+	}
+
+	nonce, ciphertext := p.buf[:aead.NonceSize()], p.buf[aead.NonceSize():n]
+	plaintext, err := aead.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := event.SubparseJSON(plaintext)
+	if err != nil {
+		return err
+	}
+	node.MutateToNode(decoded)
+	return nil
+}
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode base64: %w", err)
+	}
+	block, err := aes.NewCipher(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,98 @@
+package encrypt
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testKey    = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testOldKey = "ZmVkY2JhOTg3NjU0MzIxMA=="
+)
+
+// runPipeline passes the events through the action and waits for the passed ones,
+// the output events are mapped by the index of the input event.
+// It returns any processor of the action to check the metrics shared by the processors.
+func runPipeline(config *Config, in []string, passed int) (*Plugin, map[int64]string) {
+	test.NewConfig(config, nil)
+	var plugin *Plugin
+	pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		plugin = &Plugin{}
+		return plugin, &Config{}
+	}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(passed)
+
+	outEvents := make(map[int64]string)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents[e.Offset] = e.Root.EncodeToString()
+		wg.Done()
+	})
+
+	for i, event := range in {
+		input.In(0, "test.log", int64(i), []byte(event))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	return plugin, outEvents
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	fields := []string{"card", "user.email", "user.info", "count"}
+
+	in := `{"card":"4111111111111111","user":{"email":"a@b.c","info":{"age":30,"tags":["x"]}},"count":5,"level":"info"}`
+	_, outEvents := runPipeline(&Config{Fields: fields, Key: testKey, KeyID: "k2"}, []string{in, in}, 2)
+	encrypted := outEvents[0]
+	assert.NotContains(t, encrypted, "4111111111111111")
+	assert.NotContains(t, encrypted, "a@b.c")
+	assert.NotContains(t, encrypted, "tags")
+	assert.Contains(t, encrypted, `"card":"k2:`)
+	assert.Contains(t, encrypted, `"level":"info"`)
+
+	// the nonce is random
+	assert.NotEqual(t, encrypted, outEvents[1])
+
+	decrypter, outEvents := runPipeline(&Config{Fields: fields, Key: testKey, KeyID: "k2", Mode: "decrypt"}, []string{encrypted}, 1)
+	assert.Equal(t, in, outEvents[0])
+	assert.Equal(t, float64(0), testutil.ToFloat64(decrypter.errorsMetric.WithLabelValues()))
+}
+
+func TestDecryptKeys(t *testing.T) {
+	_, outEvents := runPipeline(&Config{Fields: []string{"a"}, Key: testOldKey, KeyID: "k1"}, []string{`{"a":"old"}`}, 1)
+	byOldKey := outEvents[0]
+	_, outEvents = runPipeline(&Config{Fields: []string{"a"}, Key: testKey}, []string{`{"a":"new"}`}, 1)
+	withoutID := outEvents[0]
+	assert.NotContains(t, strings.TrimPrefix(withoutID, `{"a":`), ":")
+
+	// the ciphertext is authenticated
+	pos := len(`{"a":"k1:`) + 5
+	c := byte('A')
+	if byOldKey[pos] == c {
+		c = 'B'
+	}
+	tampered := byOldKey[:pos] + string(c) + byOldKey[pos+1:]
+
+	// the valid event is the last one, so the discarded events are processed once it's got
+	in := []string{byOldKey, withoutID, tampered, `{"a":"k3:AAAA"}`, `{"a":"AAAA"}`, `{"a":"k1:%%%"}`, `{"a":1}`, byOldKey}
+	config := &Config{
+		Fields:  []string{"a"},
+		Mode:    "decrypt",
+		Key:     testKey,
+		KeyID:   "k2",
+		Keys:    map[string]string{"k1": testOldKey},
+		OnError: "discard",
+	}
+	decrypter, outEvents := runPipeline(config, in, 3)
+
+	assert.Equal(t, map[int64]string{0: `{"a":"old"}`, 1: `{"a":"new"}`, 7: `{"a":"old"}`}, outEvents)
+	assert.Equal(t, float64(5), testutil.ToFloat64(decrypter.errorsMetric.WithLabelValues()))
+}
@@ -0,0 +1,239 @@
+package enrich
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/lookup"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It looks up the value of the `field` or the `key` built from the event fields in the lookup provider
+and adds the found value to the event.
+The fields of the object values, e.g. the columns of csv file, are merged into the `target` object,
+other values are put to the `target` field. The event isn't changed if the key isn't found.
+
+The provider files are loaded once per pipeline and reloaded once they are changed,
+see [lookup providers](/lookup/readme.md) for the details.
+
+**Example:**
+Mapping the container images to the teams with `teams.csv`:
+```
+image,team,chat
+registry/payments,billing,#billing-oncall
+registry/orders,shop,#shop-oncall
+```
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: enrich
+      field: k8s_container_image
+      target: owner
+      provider:
+        type: csv
+        path: /etc/file.d/teams.csv
+    ...
+```
+The event `{"k8s_container_image":"registry/payments"}` becomes
+`{"k8s_container_image":"registry/payments","owner":{"team":"billing","chat":"#billing-oncall"}}`.
+
+Attaching the metadata of the deployments maintained by other systems in redis hashes:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: enrich
+      key: ${k8s_namespace}/${k8s_pod_label_app}
+      target: deployment
+      provider:
+        type: redis
+        endpoint: redis:6379
+        key_prefix: "deployments:"
+        redis_value: hash
+        cache_ttl: 30s
+    ...
+```
+}*/
+
+type Plugin struct {
+	config   *Config
+	logger   *zap.SugaredLogger
+	provider lookup.Provider
+
+	keyOps []cfg.SubstitutionOp
+	keyBuf []byte
+	fields map[string]bool
+	names  []string
+
+	notFoundMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field with the key to look up.
+	Field  cfg.FieldSelector `json:"field" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The template of the key to look up with `${field.path}` placeholders, it's used instead of the `field`.
+	// > The event isn't changed if some of the fields are missing.
+	Key string `json:"key"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The object to merge the fields of the found object into or the field to put the other found values to.
+	// > The fields are merged into the event root by default.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The fields of the found object to add, all the fields are added if it's empty.
+	Fields []string `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The lookup provider, see [lookup providers](/lookup/readme.md).
+	Provider lookup.Config `json:"provider" child:"true"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "enrich",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	switch {
+	case p.config.Key != "":
+		var err error
+		p.keyOps, err = cfg.ParseSubstitution(p.config.Key)
+		if err != nil {
+			p.logger.Fatalf("can't parse key: %s", err.Error())
+		}
+	case len(p.config.Field_) == 0:
+		p.logger.Fatalf("field or key must be set")
+	}
+
+	if len(p.config.Fields) > 0 {
+		p.fields = cfg.ListToMap(p.config.Fields)
+	}
+
+	var err error
+	p.provider, err = lookup.New(&p.config.Provider, p.logger)
+	if err != nil {
+		p.logger.Fatalf("can't create lookup provider: %s", err.Error())
+	}
+}
+
+func (p *Plugin) Stop() {
+	p.provider.Stop()
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.notFoundMetric = ctl.RegisterCounter("enrich_not_found_total", "Number of keys not found by enrich plugin")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	key, ok := p.buildKey(event.Root)
+	if !ok {
+		return pipeline.ActionPass
+	}
+
+	value, ok := p.provider.Lookup(key)
+	if !ok {
+		p.notFoundMetric.WithLabelValues().Inc()
+		return pipeline.ActionPass
+	}
+
+	object, isObject := value.(map[string]any)
+	if !isObject {
+		if len(p.config.Target_) == 0 {
+			p.logger.Errorf("can't put non-object value of key %q to the event root, set the target", key)
+			return pipeline.ActionPass
+		}
+		p.put(event.Root, pipeline.CreateNestedField(event.Root, p.config.Target_), value)
+		return pipeline.ActionPass
+	}
+
+	target := event.Root.Dig(p.config.Target_...)
+	if target == nil || !target.IsObject() {
+		target = pipeline.CreateNestedField(event.Root, p.config.Target_)
+	}
+
+	// the fields are sorted to keep the order of the event fields stable
+	p.names = p.names[:0]
+	for name := range object {
+		if p.fields == nil || p.fields[name] {
+			p.names = append(p.names, name)
+		}
+	}
+	sort.Strings(p.names)
+	for _, name := range p.names {
+		p.put(event.Root, target.AddFieldNoAlloc(event.Root, name), object[name])
+	}
+
+	return pipeline.ActionPass
+}
+
+// buildKey returns false if the key fields are missing.
+func (p *Plugin) buildKey(root *insaneJSON.Root) (string, bool) {
+	if p.keyOps == nil {
+		node := root.Dig(p.config.Field_...)
+		if node == nil {
+			return "", false
+		}
+		return node.AsString(), true
+	}
+
+	p.keyBuf = p.keyBuf[:0]
+	for _, op := range p.keyOps {
+		if op.Kind == cfg.SubstitutionOpKindRaw {
+			p.keyBuf = append(p.keyBuf, op.Data[0]...)
+			continue
+		}
+		node := root.Dig(op.Data...)
+		if node == nil {
+			return "", false
+		}
+		p.keyBuf = append(p.keyBuf, node.AsString()...)
+	}
+	return pipeline.ByteToStringUnsafe(p.keyBuf), true
+}
+
+// put mutates the node to the value, the strings are referenced since the provider values are immutable.
+func (p *Plugin) put(root *insaneJSON.Root, node *insaneJSON.Node, value any) {
+	if s, ok := value.(string); ok {
+		node.MutateToString(s)
+		return
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		p.logger.Errorf("can't encode value: %s", err.Error())
+		return
+	}
+	node.MutateToJSON(root, string(data))
+}
@@ -0,0 +1,161 @@
+package enrich
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/lookup"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runPipeline passes the events through the action and returns the output events.
+func runPipeline(config *Config, in []string) []string {
+	test.NewConfig(config, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(in))
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	for _, event := range in {
+		input.In(0, "test.log", 0, []byte(event))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	return outEvents
+}
+
+func writeFile(t *testing.T, name string, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	return path
+}
+
+func TestEnrichCSV(t *testing.T) {
+	path := writeFile(t, "teams.csv", "image,team,chat\nregistry/payments,billing,#billing\nregistry/orders,shop,#shop\n")
+
+	cases := []struct {
+		name   string
+		target string
+		fields []string
+		in     string
+		out    string
+	}{
+		{
+			name:   "target",
+			target: "owner",
+			in:     `{"image":"registry/payments"}`,
+			out:    `{"image":"registry/payments","owner":{"chat":"#billing","team":"billing"}}`,
+		},
+		{
+			name: "root",
+			in:   `{"image":"registry/orders","team":"unknown"}`,
+			out:  `{"image":"registry/orders","team":"shop","chat":"#shop"}`,
+		},
+		{
+			name:   "fields",
+			target: "owner",
+			fields: []string{"team"},
+			in:     `{"image":"registry/orders","owner":{"id":1}}`,
+			out:    `{"image":"registry/orders","owner":{"id":1,"team":"shop"}}`,
+		},
+		{
+			name: "not_found",
+			in:   `{"image":"registry/unknown"}`,
+			out:  `{"image":"registry/unknown"}`,
+		},
+		{
+			name: "no_field",
+			in:   `{"message":"registry/orders"}`,
+			out:  `{"message":"registry/orders"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{
+				Field:    "image",
+				Target:   cfg.FieldSelector(tc.target),
+				Fields:   tc.fields,
+				Provider: lookup.Config{Type: lookup.TypeCSV, Path: path},
+			}
+			assert.Equal(t, []string{tc.out}, runPipeline(config, []string{tc.in}))
+		})
+	}
+}
+
+func TestEnrichJSON(t *testing.T) {
+	path := writeFile(t, "hosts.json", `{"web-1":{"dc":"eu","rack":12,"tags":["a","b"]},"web-2":"standby"}`)
+
+	config := &Config{
+		Field:    "host",
+		Target:   "inventory",
+		Provider: lookup.Config{Type: lookup.TypeJSON, Path: path},
+	}
+
+	outEvents := runPipeline(config, []string{`{"host":"web-1"}`, `{"host":"web-2"}`})
+
+	assert.Equal(t, []string{
+		`{"host":"web-1","inventory":{"dc":"eu","rack":12,"tags":["a","b"]}}`,
+		`{"host":"web-2","inventory":"standby"}`,
+	}, outEvents)
+}
+
+func TestEnrichRedisKey(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.HSet("deployments:prod/payments", "team", "billing", "version", "1.2.0")
+
+	config := test.NewConfig(&Config{
+		Key:    "${ns}/${app}",
+		Target: "deployment",
+		Provider: lookup.Config{
+			Type:       lookup.TypeRedis,
+			Endpoint:   s.Addr(),
+			KeyPrefix:  "deployments:",
+			RedisValue: lookup.RedisValueHash,
+		},
+	}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(6)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	for i := 0; i < 2; i++ {
+		input.In(0, "test.log", 0, []byte(`{"ns":"prod","app":"payments"}`))
+		input.In(0, "test.log", 0, []byte(`{"ns":"prod","app":"orders"}`))
+		input.In(0, "test.log", 0, []byte(`{"ns":"prod"}`))
+	}
+	wg.Wait()
+
+	// the values are cached
+	s.Del("deployments:prod/payments")
+	wg.Add(1)
+	input.In(0, "test.log", 0, []byte(`{"ns":"prod","app":"payments"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	found := `{"ns":"prod","app":"payments","deployment":{"team":"billing","version":"1.2.0"}}`
+	assert.Equal(t, []string{
+		found, `{"ns":"prod","app":"orders"}`, `{"ns":"prod"}`,
+		found, `{"ns":"prod","app":"orders"}`, `{"ns":"prod"}`,
+		found,
+	}, outEvents)
+}
@@ -0,0 +1,243 @@
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	exprlang "github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/vm"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It evaluates the [expr](https://expr-lang.org/docs/language-definition) expressions over the event fields
+to discard the events and to compute the fields.
+The expressions are compiled once on the start, so they are much faster than the scripts
+and can't do anything but compute the values.
+
+The top level fields of the event are the variables of the expressions, the nested fields are accessed as
+`k8s.labels.app` or `k8s.labels["app.kubernetes.io/name"]`. The missing fields are `nil`,
+the fields which may be missing are accessed with `?.` and `??`, e.g. `k8s?.labels?.app ?? "unknown"`.
+The field values are converted to the strings, the numbers, the booleans, the maps and the arrays.
+
+The event is discarded if `discard_if` is `true`, otherwise the `set` expressions are evaluated
+and their results are put to the fields. All the expressions see the original event.
+If the expression fails, e.g. it compares the string with the number, the error is logged
+and the event is passed further unchanged.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: expr
+      discard_if: 'status < 400 && path startsWith "/health"'
+      set:
+        level_num: 'level == "error" ? 3 : level == "warn" ? 4 : 6'
+        http.slow: '(duration_ms ?? 0) > 1000'
+        user: 'lower(user ?? "anonymous")'
+    ...
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+
+	discardIf *vm.Program
+	computed  []computed
+	// names are the top level fields used in the expressions
+	names []string
+
+	vm      vm.VM
+	env     map[string]any
+	results []any
+
+	errorsMetric *prom.CounterVec
+}
+
+type computed struct {
+	field   []string
+	program *vm.Program
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The boolean expression, the event is discarded if it's `true`.
+	DiscardIf string `json:"discard_if"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The map of the field selectors to the expressions which results are put to the fields.
+	Set map[string]string `json:"set"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "expr",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.env = make(map[string]any)
+
+	if p.config.DiscardIf == "" && len(p.config.Set) == 0 {
+		p.logger.Fatalf("discard_if or set must be set")
+	}
+
+	names := make(map[string]bool)
+	if p.config.DiscardIf != "" {
+		var err error
+		p.discardIf, err = compile(p.config.DiscardIf, names, exprlang.AsBool())
+		if err != nil {
+			p.logger.Fatalf("can't compile discard_if: %s", err.Error())
+		}
+	}
+
+	// the fields are set in the stable order
+	fields := make([]string, 0, len(p.config.Set))
+	for field := range p.config.Set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in set")
+		}
+		program, err := compile(p.config.Set[field], names)
+		if err != nil {
+			p.logger.Fatalf("can't compile expression of field %s: %s", field, err.Error())
+		}
+		p.computed = append(p.computed, computed{field: path, program: program})
+	}
+	p.results = make([]any, len(p.computed))
+
+	for name := range names {
+		p.names = append(p.names, name)
+	}
+}
+
+// compile compiles the expression and collects the top level fields it uses.
+func compile(input string, names map[string]bool, ops ...exprlang.Option) (*vm.Program, error) {
+	ops = append(ops, exprlang.AllowUndefinedVariables(), exprlang.Patch(&identifiers{names: names}))
+	return exprlang.Compile(input, ops...)
+}
+
+// identifiers collects the names of the variables.
+type identifiers struct {
+	names map[string]bool
+}
+
+func (v *identifiers) Visit(node *ast.Node) {
+	if n, ok := (*node).(*ast.IdentifierNode); ok {
+		v.names[n.Value] = true
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("expr_errors_total", "Number of failed expression evaluations")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	// only the fields used in the expressions are converted
+	for _, name := range p.names {
+		node := event.Root.Dig(name)
+		if node == nil {
+			delete(p.env, name)
+			continue
+		}
+		p.env[name] = pipeline.NodeArithmeticValue(node)
+	}
+
+	if p.discardIf != nil {
+		discard, err := p.vm.Run(p.discardIf, p.env)
+		if err != nil {
+			p.fail("discard_if", err)
+			return pipeline.ActionPass
+		}
+		if discard == true {
+			return pipeline.ActionDiscard
+		}
+	}
+
+	for i, c := range p.computed {
+		result, err := p.vm.Run(c.program, p.env)
+		if err != nil {
+			p.fail(strings.Join(c.field, "."), err)
+			return pipeline.ActionPass
+		}
+		p.results[i] = result
+	}
+
+	for i, c := range p.computed {
+		if err := set(event.Root, pipeline.AddField(event.Root, c.field), p.results[i]); err != nil {
+			p.fail(strings.Join(c.field, "."), err)
+		}
+		p.results[i] = nil
+	}
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) fail(name string, err error) {
+	p.errorsMetric.WithLabelValues().Inc()
+	p.logger.Errorf("can't evaluate expression of %s: %s", name, err.Error())
+}
+
+var errNotFinite = errors.New("result isn't finite number")
+
+// set mutates the node to the result, the strings are copied since they may point to the event fields.
+func set(root *insaneJSON.Root, node *insaneJSON.Node, result any) error {
+	switch v := result.(type) {
+	case nil:
+		node.MutateToNull()
+	case bool:
+		node.MutateToBool(v)
+	case string:
+		node.MutateToString(strings.Clone(v))
+	case int:
+		node.MutateToInt(v)
+	case int64:
+		node.MutateToInt64(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			node.MutateToNull()
+			return errNotFinite
+		}
+		node.MutateToFloat(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			node.MutateToNull()
+			return fmt.Errorf("can't encode result: %w", err)
+		}
+		node.MutateToJSON(root, string(data))
+	}
+	return nil
+}
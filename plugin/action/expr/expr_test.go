@@ -0,0 +1,80 @@
+package expr
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpr(t *testing.T) {
+	config := test.NewConfig(&Config{
+		DiscardIf: `status < 400 && path startsWith "/health"`,
+		Set: map[string]string{
+			"level_num":   `level == "error" ? 3 : level == "warn" ? 4 : 6`,
+			"http.slow":   `(duration_ms ?? 0) > 1000`,
+			"http.bucket": `status - status % 100`,
+			"user":        `lower(user ?? "anonymous")`,
+			"app":         `(k8s?.labels ?? {})["app.kubernetes.io/name"]`,
+			"tags":        `map(filter(items, {.n > 1}), {.tag})`,
+		},
+	}, nil)
+
+	cases := []struct {
+		name   string
+		in     string
+		out    string
+		result pipeline.ActionResult
+	}{
+		{
+			name:   "discard",
+			in:     `{"status":200,"path":"/health/ready"}`,
+			result: pipeline.ActionDiscard,
+		},
+		{
+			name: "set",
+			in:   `{"status":503,"path":"/health","level":"error","duration_ms":1500.5,"user":"Bob","http":{"method":"GET"},"k8s":{"labels":{"app.kubernetes.io/name":"api"}},"items":[{"n":1,"tag":"a"},{"n":2,"tag":"b"}]}`,
+			out:  `{"status":503,"path":"/health","level":"error","duration_ms":1500.5,"user":"bob","http":{"method":"GET","bucket":500,"slow":true},"k8s":{"labels":{"app.kubernetes.io/name":"api"}},"items":[{"n":1,"tag":"a"},{"n":2,"tag":"b"}],"app":"api","level_num":3,"tags":["b"]}`,
+		},
+		{
+			name: "missing_fields",
+			in:   `{"status":200,"path":"/api","items":[]}`,
+			out:  `{"status":200,"path":"/api","items":[],"app":null,"http":{"bucket":200,"slow":false},"level_num":6,"tags":[],"user":"anonymous"}`,
+		},
+		{
+			name: "error",
+			in:   `{"status":"ok","path":"/api","items":[]}`,
+			out:  `{"status":"ok","path":"/api","items":[]}`,
+		},
+	}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	for _, tc := range cases {
+		if tc.result != pipeline.ActionDiscard {
+			wg.Add(1)
+		}
+	}
+
+	outEvents := make(map[int64]string)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents[e.Offset] = e.Root.EncodeToString()
+		wg.Done()
+	})
+
+	for i, tc := range cases {
+		input.In(0, "test.log", int64(i), []byte(tc.in))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	for i, tc := range cases {
+		out, ok := outEvents[int64(i)]
+		assert.Equal(t, tc.result == pipeline.ActionDiscard, !ok, "wrong discard of %s", tc.name)
+		if ok {
+			assert.Equal(t, tc.out, out, "wrong out event of %s", tc.name)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+)
+
+/*{ introduction
+It computes the hash of the values of the `fields` and puts it into the `target` field.
+The hash is stable across the restarts and the hosts, so it can be used as the Elasticsearch `_id`,
+the ClickHouse deduplication token or the key of the `dedup` action.
+
+The hash depends on the order of the `fields`. The missing fields are taken into account too,
+so `{"a":1}` and `{"a":1,"b":null}` have different hashes. The values are hashed as their JSON.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: fingerprint
+      fields: [service, request_id, message]
+      algorithm: sha256
+      target: _id
+    ...
+```
+}*/
+
+const (
+	algorithmSHA256  = "sha256"
+	algorithmMurmur3 = "murmur3"
+
+	formatBase64 = "base64"
+)
+
+type Plugin struct {
+	config *Config
+	fields [][]string
+
+	buf  []byte
+	hash []byte
+
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event fields to compute the hash of.
+	Fields []string `json:"fields" required:"true" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the hash into.
+	Target  cfg.FieldSelector `json:"target" parse:"selector" default:"fingerprint"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The hash algorithm:
+	// > * `xxhash` – 64-bit xxHash
+	// > * `sha256` – SHA-256, use it if the hash collisions can be caused on purpose
+	// > * `murmur3` – 32-bit MurmurHash3 x86_32 with the zero seed
+	Algorithm string `json:"algorithm" default:"xxhash" options:"xxhash|sha256|murmur3"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The format of the hash, the big-endian bytes of the hash are written as `hex` or `base64` string.
+	Format string `json:"format" default:"hex" options:"hex|base64"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "fingerprint",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+
+	if len(p.config.Fields) == 0 {
+		params.Logger.Fatalf("fields must be set")
+	}
+	p.fields = make([][]string, 0, len(p.config.Fields))
+	for _, field := range p.config.Fields {
+		p.fields = append(p.fields, cfg.ParseFieldSelector(field))
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	p.buf = p.buf[:0]
+	for _, field := range p.fields {
+		node := event.Root.Dig(field...)
+		if node == nil {
+			// the missing field differs from any encoded value.
+			p.buf = append(p.buf, 0)
+		} else {
+			p.buf = node.Encode(p.buf)
+		}
+		// the separator makes the hash of ["ab", "c"] differ from ["a", "bc"].
+		p.buf = append(p.buf, 0xFF)
+	}
+
+	p.hash = p.hash[:0]
+	switch p.config.Algorithm {
+	case algorithmSHA256:
+		sum := sha256.Sum256(p.buf)
+		p.hash = append(p.hash, sum[:]...)
+	case algorithmMurmur3:
+		p.hash = binary.BigEndian.AppendUint32(p.hash, murmur3(p.buf))
+	default:
+		p.hash = binary.BigEndian.AppendUint64(p.hash, xxhash.Sum64(p.buf))
+	}
+
+	start := len(event.Buf)
+	if p.config.Format == formatBase64 {
+		event.Buf = append(event.Buf, make([]byte, base64.StdEncoding.EncodedLen(len(p.hash)))...)
+		base64.StdEncoding.Encode(event.Buf[start:], p.hash)
+	} else {
+		event.Buf = append(event.Buf, make([]byte, hex.EncodedLen(len(p.hash)))...)
+		hex.Encode(event.Buf[start:], p.hash)
+	}
+
+	pipeline.AddField(event.Root, p.config.Target_).MutateToString(pipeline.ByteToStringUnsafe(event.Buf[start:]))
+	return pipeline.ActionPass
+}
@@ -0,0 +1,105 @@
+package fingerprint
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+func TestFingerprint(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+	}{
+		{
+			name:   "sha256",
+			config: &Config{Fields: []string{"a", "b"}, Algorithm: "sha256"},
+			in:     `{"a":"x","b":1}`,
+			out:    `{"a":"x","b":1,"fingerprint":"4f7131ea9f174e506dbec6c525446642106c7ed85a46c267e55f2169ced07648"}`,
+		},
+		{
+			name:   "sha256 base64 missing field",
+			config: &Config{Fields: []string{"a", "b"}, Algorithm: "sha256", Format: "base64", Target: "meta.id"},
+			in:     `{"a":"x","meta":{"host":"h"}}`,
+			out:    `{"a":"x","meta":{"host":"h","id":"+yrGRbHUXRL4TE8fn0R0y4Z+DKxXELstgTwu03x+7vw="}}`,
+		},
+		{
+			name:   "existing target",
+			config: &Config{Fields: []string{"a", "b"}, Algorithm: "sha256", Target: "id"},
+			in:     `{"id":"old","a":"x","b":1}`,
+			out:    `{"id":"4f7131ea9f174e506dbec6c525446642106c7ed85a46c267e55f2169ced07648","a":"x","b":1}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, []string{tc.out}, runPipeline(tc.config, []string{tc.in}))
+		})
+	}
+}
+
+func TestFingerprintStable(t *testing.T) {
+	for _, algorithm := range []string{"xxhash", "sha256", "murmur3"} {
+		config := &Config{Fields: []string{"a", "b"}, Algorithm: algorithm, Target: "id"}
+		outEvents := runPipeline(config, []string{
+			`{"a":"x","b":{"c":1},"d":1}`, `{"d":2,"b":{"c":1},"a":"x"}`,
+			`{"a":"ab","b":"c"}`, `{"a":"a","b":"bc"}`,
+			`{"a":1}`, `{"a":1,"b":null}`,
+			`{"a":1}`, `{"a":"1"}`,
+		})
+		hashes := make([]string, 0, len(outEvents))
+		for _, out := range outEvents {
+			root, err := insaneJSON.DecodeString(out)
+			require.NoError(t, err)
+			hashes = append(hashes, string(root.Dig("id").AsBytes()))
+			insaneJSON.Release(root)
+		}
+
+		assert.Equal(t, hashes[0], hashes[1], algorithm)
+		assert.NotEqual(t, hashes[2], hashes[3], algorithm)
+		assert.NotEqual(t, hashes[4], hashes[5], algorithm)
+		assert.NotEqual(t, hashes[6], hashes[7], algorithm)
+	}
+}
+
+func TestMurmur3(t *testing.T) {
+	cases := map[string]uint32{
+		"":              0,
+		"a":             0x3c2569b2,
+		"abcd":          0x43ed676a,
+		"hello":         0x248bfa47,
+		"Hello, world!": 0xc0363e43,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, murmur3([]byte(in)), in)
+	}
+}
+
+// runPipeline passes the events through the action and returns the output events.
+func runPipeline(config *Config, in []string) []string {
+	test.NewConfig(config, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(in))
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	for _, event := range in {
+		input.In(0, "test.log", 0, []byte(event))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	return outEvents
+}
@@ -0,0 +1,52 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	murmur3C1 = 0xcc9e2d51
+	murmur3C2 = 0x1b873593
+)
+
+// murmur3 returns the MurmurHash3 x86_32 of the data with the zero seed.
+func murmur3(data []byte) uint32 {
+	h := uint32(0)
+	l := len(data)
+
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= murmur3C1
+		k = bits.RotateLeft32(k, 15)
+		k *= murmur3C2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	k := uint32(0)
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= murmur3C1
+		k = bits.RotateLeft32(k, 15)
+		k *= murmur3C2
+		h ^= k
+	}
+
+	h ^= uint32(l)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
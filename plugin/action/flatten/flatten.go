@@ -1,15 +1,22 @@
 package flatten
 
 import (
+	"strconv"
+
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
 )
 
 /*{ introduction
 It extracts the object keys and adds them into the root with some prefix. If the provided field isn't an object, an event will be skipped.
 
+The nested objects are flattened up to `max_depth` levels, their keys are joined with the `separator`.
+The arrays are kept as they are, flattened with the indexes as the keys or encoded to JSON strings according to `arrays`.
+The empty objects and arrays are kept as they are.
+
 **Example:**
 ```yaml
 pipelines:
@@ -21,11 +28,40 @@ pipelines:
       prefix: pet_
     ...
 ```
-It transforms `{"animal":{"type":"cat","paws":4}}` into `{"pet_type":"b","pet_paws":"4"}`.
+It transforms `{"animal":{"type":"cat","paws":4}}` into `{"pet_type":"cat","pet_paws":4}`.
+
+The nested k8s annotations:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: flatten
+      field: k8s
+      prefix: k8s_
+      max_depth: -1
+      arrays: json
+    ...
+```
+It transforms `{"k8s":{"pod":"p-1","annotations":{"team":"a","ports":[80,443]}}}`
+into `{"k8s_pod":"p-1","k8s_annotations_team":"a","k8s_annotations_ports":"[80,443]"}`.
 }*/
 
+const (
+	arraysKeep  = "keep"
+	arraysIndex = "index"
+	arraysJSON  = "json"
+)
+
+type leaf struct {
+	key   string
+	value *insaneJSON.Node
+}
+
 type Plugin struct {
 	config *Config
+	key    []byte
+	leaves []leaf
 	plugin.NoMetricsPlugin
 }
 
@@ -42,6 +78,25 @@ type Config struct {
 	// >
 	// > Which prefix to use for extracted fields.
 	Prefix string `json:"prefix" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > How many levels of the nested objects to flatten, a negative value means no limit.
+	// > The objects deeper than the limit are kept as they are.
+	MaxDepth int `json:"max_depth" default:"1"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The separator of the keys of the nested objects.
+	Separator string `json:"separator" default:"_"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How to flatten the arrays:
+	// > * `keep` keeps the arrays as they are
+	// > * `index` flattens the arrays like the objects with the element indexes as the keys, e.g. `ports_0`
+	// > * `json` encodes the arrays to JSON strings
+	Arrays string `json:"arrays" default:"keep" options:"keep|index|json"` // *
 }
 
 func init() {
@@ -69,18 +124,58 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 		return pipeline.ActionPass
 	}
 
+	p.key = append(p.key[:0], p.config.Prefix...)
+	p.leaves = p.leaves[:0]
+	p.collect(event, node, 1)
+
 	node.Suicide()
 
-	fields := node.AsFields()
-	for _, field := range fields {
-		l := len(event.Buf)
-		event.Buf = append(event.Buf, p.config.Prefix...)
-		event.Buf = append(event.Buf, field.AsString()...)
-		field.MutateToField(pipeline.ByteToStringUnsafe(event.Buf[l:]))
+	// place flattened fields under root
+	for _, l := range p.leaves {
+		event.Root.AddFieldNoAlloc(event.Root, l.key).MutateToNode(l.value)
 	}
 
-	// place decoded object under root
-	event.Root.MergeWith(node)
-
 	return pipeline.ActionPass
 }
+
+// collect collects the flattened fields of the object or the array, the keys are prefixed with p.key.
+func (p *Plugin) collect(event *pipeline.Event, node *insaneJSON.Node, depth int) {
+	prefix := len(p.key)
+
+	if node.IsArray() {
+		for i, element := range node.AsArray() {
+			p.key = strconv.AppendInt(p.key[:prefix], int64(i), 10)
+			p.add(event, element, depth)
+		}
+		p.key = p.key[:prefix]
+		return
+	}
+
+	for _, field := range node.AsFields() {
+		p.key = append(p.key[:prefix], field.AsString()...)
+		p.add(event, field.AsFieldValue(), depth)
+	}
+	p.key = p.key[:prefix]
+}
+
+// add adds the value with p.key or flattens it if it's the non-empty object or array within max_depth.
+func (p *Plugin) add(event *pipeline.Event, value *insaneJSON.Node, depth int) {
+	withinDepth := p.config.MaxDepth < 0 || depth < p.config.MaxDepth
+	flatten := value.IsObject() && len(value.AsFields()) > 0 ||
+		value.IsArray() && p.config.Arrays == arraysIndex && len(value.AsArray()) > 0
+	if flatten && withinDepth {
+		p.key = append(p.key, p.config.Separator...)
+		p.collect(event, value, depth+1)
+		return
+	}
+
+	if value.IsArray() && p.config.Arrays == arraysJSON {
+		l := len(event.Buf)
+		event.Buf = value.Encode(event.Buf)
+		value.MutateToString(pipeline.ByteToStringUnsafe(event.Buf[l:]))
+	}
+
+	l := len(event.Buf)
+	event.Buf = append(event.Buf, p.key...)
+	p.leaves = append(p.leaves, leaf{key: pipeline.ByteToStringUnsafe(event.Buf[l:]), value: value})
+}
@@ -43,3 +43,59 @@ func TestFlatten(t *testing.T) {
 	assert.Equal(t, 1, len(dumpedEvents), "wrong out events count")
 	assert.Equal(t, `{"flat_a":"b","flat_c":"d"}`, dumpedEvents[0].Root.EncodeToString(), "wrong out events count")
 }
+
+func TestFlattenNested(t *testing.T) {
+	in := `{"k8s":{"pod":"p-1","annotations":{"team":"a","ports":[80,{"tls":true}],"empty":{}}},"level":"info"}`
+	cases := []struct {
+		name   string
+		config *Config
+		out    string
+	}{
+		{
+			name:   "one level",
+			config: &Config{Field: "k8s"},
+			out:    `{"level":"info","pod":"p-1","annotations":{"team":"a","ports":[80,{"tls":true}],"empty":{}}}`,
+		},
+		{
+			name:   "no limit",
+			config: &Config{Field: "k8s", Prefix: "k8s.", MaxDepth: -1, Separator: "."},
+			out:    `{"level":"info","k8s.pod":"p-1","k8s.annotations.team":"a","k8s.annotations.ports":[80,{"tls":true}],"k8s.annotations.empty":{}}`,
+		},
+		{
+			name:   "index",
+			config: &Config{Field: "k8s", MaxDepth: -1, Arrays: "index"},
+			out:    `{"level":"info","pod":"p-1","annotations_team":"a","annotations_ports_0":80,"annotations_ports_1_tls":true,"annotations_empty":{}}`,
+		},
+		{
+			name:   "index depth",
+			config: &Config{Field: "k8s", MaxDepth: 3, Arrays: "index"},
+			out:    `{"level":"info","pod":"p-1","annotations_team":"a","annotations_ports_0":80,"annotations_ports_1":{"tls":true},"annotations_empty":{}}`,
+		},
+		{
+			name:   "json",
+			config: &Config{Field: "k8s", MaxDepth: 2, Arrays: "json"},
+			out:    `{"level":"info","pod":"p-1","annotations_team":"a","annotations_ports":"[80,{\"tls\":true}]","annotations_empty":{}}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, map[string]int{"gomaxprocs": 1})
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
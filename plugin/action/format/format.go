@@ -0,0 +1,382 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It renders the [Go template](https://pkg.go.dev/text/template) over the event fields and puts the result
+to the field, e.g. to build the human-readable message or the routing key.
+
+The top level fields of the event are accessed as `{{ .level }}`, the nested fields as `{{ .k8s.pod }}`.
+The missing top level fields are empty strings, the nested fields which may be missing are accessed
+with `{{ get "k8s.labels.app" }}` since the missing nested field is `<no value>` and the field of the missing object
+is the error. The numbers are rendered as they are in the event, the objects and the arrays are rendered with `toJSON`.
+
+There are the helpers in addition to the [builtin functions](https://pkg.go.dev/text/template#hdr-Functions):
+* `get "selector"` returns the field of the selector or the empty string if it's missing
+* `default "value" .field` returns the value if the field is empty: the empty string, `null`, `false`, empty object or array
+* `lower .field`, `upper .field`, `trim .field`
+* `substr start end .field` returns the characters from start to end, end is the length of the string if it's negative
+* `replace "old" "new" .field` replaces all the occurrences of the old string
+* `join ", " .field` joins the array elements with the separator
+* `toString .field` converts the field to the string, the objects and the arrays are encoded to JSON
+* `toJSON .field` encodes the field to JSON
+
+If the template fails, the error is logged and the event is passed unchanged.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: format
+      field: message
+      template: '{{ upper .method }} {{ .path }} {{ .status }} ({{ get "user.name" | default "anonymous" }})'
+    - type: format
+      field: routing_key
+      template: '{{ .service | lower }}.{{ substr 0 1 .status }}xx'
+    ...
+```
+The event:
+```json
+{"method":"get","path":"/api","status":404,"service":"API"}
+```
+becomes:
+```json
+{"method":"get","path":"/api","status":404,"service":"API","message":"GET /api 404 (anonymous)","routing_key":"api.4xx"}
+```
+}*/
+
+type Plugin struct {
+	config   *Config
+	logger   *zap.SugaredLogger
+	template *template.Template
+	// names are the top level fields used in the template, all the fields are used if it's nil
+	names []string
+
+	event *pipeline.Event
+	data  map[string]any
+	buf   *bytes.Buffer
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The field to put the result to.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" required:"true"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The template to render.
+	Template string `json:"template" required:"true"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "format",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.data = make(map[string]any)
+	p.buf = &bytes.Buffer{}
+
+	if len(p.config.Field_) == 0 {
+		p.logger.Fatalf("field must be set")
+	}
+
+	var err error
+	p.template, err = template.New("format").Funcs(p.funcs()).Parse(p.config.Template)
+	if err != nil {
+		p.logger.Fatalf("can't parse template: %s", err.Error())
+	}
+
+	names := make(map[string]bool)
+	if collectNames(p.template.Root, names) {
+		for name := range names {
+			p.names = append(p.names, name)
+		}
+		if p.names == nil {
+			p.names = []string{}
+		}
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("format_errors_total", "Number of failed template executions")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	p.event = event
+	defer func() {
+		p.event = nil
+	}()
+
+	for name := range p.data {
+		delete(p.data, name)
+	}
+	if p.names == nil {
+		for _, field := range event.Root.AsFields() {
+			p.data[field.AsString()] = pipeline.NodeValue(field.AsFieldValue())
+		}
+	} else {
+		for _, name := range p.names {
+			var value any = ""
+			if node := event.Root.Dig(name); node != nil {
+				value = pipeline.NodeValue(node)
+			}
+			p.data[name] = value
+		}
+	}
+
+	p.buf.Reset()
+	if err := p.template.Execute(p.buf, p.data); err != nil {
+		p.errorsMetric.WithLabelValues().Inc()
+		p.logger.Errorf("can't execute template: %s", err.Error())
+		return pipeline.ActionPass
+	}
+
+	pipeline.AddField(event.Root, p.config.Field_).MutateToBytesCopy(event.Root, p.buf.Bytes())
+
+	return pipeline.ActionPass
+}
+
+// collectNames collects the top level fields used in the template,
+// it returns false if the template uses the whole event, e.g. `{{ . }}` or `{{ range $k, $v := . }}`.
+func collectNames(node parse.Node, names map[string]bool) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *parse.ListNode:
+		if n == nil {
+			return true
+		}
+		for _, child := range n.Nodes {
+			if !collectNames(child, names) {
+				return false
+			}
+		}
+		return true
+	case *parse.ActionNode:
+		return collectNames(n.Pipe, names)
+	case *parse.IfNode:
+		return collectNames(n.Pipe, names) && collectNames(n.List, names) && collectNames(n.ElseList, names)
+	case *parse.RangeNode:
+		return collectNames(n.Pipe, names) && collectRoot(n.List, names) && collectNames(n.ElseList, names)
+	case *parse.WithNode:
+		return collectNames(n.Pipe, names) && collectRoot(n.List, names) && collectNames(n.ElseList, names)
+	case *parse.TemplateNode:
+		return collectNames(n.Pipe, names)
+	case *parse.PipeNode:
+		if n == nil {
+			return true
+		}
+		for _, cmd := range n.Cmds {
+			if !collectNames(cmd, names) {
+				return false
+			}
+		}
+		return true
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if !collectNames(arg, names) {
+				return false
+			}
+		}
+		return true
+	case *parse.ChainNode:
+		return collectNames(n.Node, names)
+	case *parse.FieldNode:
+		names[n.Ident[0]] = true
+		return true
+	case *parse.VariableNode:
+		// $.field is the top level field, $ is the whole event
+		if n.Ident[0] == "$" {
+			if len(n.Ident) == 1 {
+				return false
+			}
+			names[n.Ident[1]] = true
+		}
+		return true
+	case *parse.DotNode:
+		return false
+	default:
+		return true
+	}
+}
+
+// collectRoot collects the fields of the root variable inside the range and the with where the dot isn't the event.
+// The whole event is used if there are the nested ranges or withs or the templates since it's hard to track the dot.
+func collectRoot(node parse.Node, names map[string]bool) bool {
+	ok := true
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode, *parse.WithNode, *parse.TemplateNode:
+			ok = false
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.VariableNode:
+			if n.Ident[0] == "$" {
+				if len(n.Ident) == 1 {
+					ok = false
+					return
+				}
+				names[n.Ident[1]] = true
+			}
+		}
+	}
+	walk(node)
+	return ok
+}
+
+func (p *Plugin) funcs() template.FuncMap {
+	return template.FuncMap{
+		"get": func(selector string) any {
+			if p.event == nil {
+				return ""
+			}
+			node := p.event.Root.Dig(cfg.ParseFieldSelector(selector)...)
+			if node == nil {
+				return ""
+			}
+			return pipeline.NodeValue(node)
+		},
+		"default": func(def any, value any) any {
+			if isEmpty(value) {
+				return def
+			}
+			return value
+		},
+		"lower": func(value any) string {
+			return strings.ToLower(toString(value))
+		},
+		"upper": func(value any) string {
+			return strings.ToUpper(toString(value))
+		},
+		"trim": func(value any) string {
+			return strings.TrimSpace(toString(value))
+		},
+		"substr": substr,
+		"replace": func(old, new string, value any) string {
+			return strings.ReplaceAll(toString(value), old, new)
+		},
+		"join": func(sep string, value any) string {
+			values, ok := value.([]any)
+			if !ok {
+				return toString(value)
+			}
+			parts := make([]string, len(values))
+			for i, v := range values {
+				parts[i] = toString(v)
+			}
+			return strings.Join(parts, sep)
+		},
+		"toString": toString,
+		"toJSON": func(value any) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+}
+
+// substr returns the characters of the string from start to end, end is the length of the string if it's negative.
+func substr(start, end int, value any) string {
+	runes := []rune(toString(value))
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start >= end {
+		return ""
+	}
+	return string(runes[start:end])
+}
+
+func isEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return string(v)
+	case []any, map[string]any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,112 @@
+package format
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		field    string
+		template string
+		in       string
+		out      string
+	}{
+		{
+			name:     "message",
+			field:    "message",
+			template: `{{ upper .method }} {{ .path }} {{ .status }} ({{ get "user.name" | default "anonymous" }})`,
+			in:       `{"method":"get","path":"/api","status":404}`,
+			out:      `{"method":"get","path":"/api","status":404,"message":"GET /api 404 (anonymous)"}`,
+		},
+		{
+			name:     "routing key",
+			field:    "meta.key",
+			template: `{{ .service | lower }}.{{ substr 0 1 .status }}xx.{{ .missing }}`,
+			in:       `{"service":"API","status":503,"meta":{"id":1}}`,
+			out:      `{"service":"API","status":503,"meta":{"id":1,"key":"api.5xx."}}`,
+		},
+		{
+			name:     "helpers",
+			field:    "out",
+			template: `{{ join "," .tags }}|{{ replace "-" "_" (trim .name) }}|{{ toJSON .obj }}|{{ .obj.a }}|{{ substr 2 -1 "привет" }}|{{ default 1 .flag }}`,
+			in:       `{"tags":["a",1.50,true],"name":" a-b ","obj":{"a":[1]},"flag":false}`,
+			out:      `{"tags":["a",1.50,true],"name":" a-b ","obj":{"a":[1]},"flag":false,"out":"a,1.50,true|a_b|{\"a\":[1]}|[1]|ивет|1"}`,
+		},
+		{
+			name:     "range",
+			field:    "out",
+			template: `{{ range .items }}{{ .id }}@{{ $.host }};{{ end }}`,
+			in:       `{"items":[{"id":1},{"id":2}],"host":"h"}`,
+			out:      `{"items":[{"id":1},{"id":2}],"host":"h","out":"1@h;2@h;"}`,
+		},
+		{
+			name:     "whole event",
+			field:    "out",
+			template: `{{ range $k, $v := . }}{{ $k }}={{ $v }} {{ end }}`,
+			in:       `{"b":"x","a":1}`,
+			out:      `{"b":"x","a":1,"out":"a=1 b=x "}`,
+		},
+		{
+			name:     "error",
+			field:    "out",
+			template: `{{ .a.b.c }}`,
+			in:       `{"a":"str"}`,
+			out:      `{"a":"str"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{Field: cfg.FieldSelector(tc.field), Template: tc.template}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
+
+func TestCollectNames(t *testing.T) {
+	cases := []struct {
+		template string
+		names    []string
+	}{
+		{template: `{{ .a.b }} {{ if .c }}{{ $.d }}{{ else }}{{ .e }}{{ end }}`, names: []string{"a", "c", "d", "e"}},
+		{template: `{{ with .a }}{{ .x }}{{ $.b }}{{ end }}`, names: []string{"a", "b"}},
+		{template: `{{ get "a.b" | lower }}`, names: []string{}},
+		{template: `{{ . }}`, names: nil},
+		{template: `{{ range .a }}{{ range . }}{{ end }}{{ end }}`, names: nil},
+	}
+	for _, tc := range cases {
+		config := test.NewConfig(&Config{Field: "out", Template: tc.template}, nil)
+		p := &Plugin{}
+		p.RegisterMetrics(metric.New("test"))
+		p.Start(config, &pipeline.ActionPluginParams{Logger: zap.NewExample().Sugar()})
+
+		if tc.names == nil {
+			assert.Nil(t, p.names, tc.template)
+		} else {
+			assert.ElementsMatch(t, tc.names, p.names, tc.template)
+		}
+	}
+}
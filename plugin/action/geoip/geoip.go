@@ -0,0 +1,387 @@
+package geoip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/lookup"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It looks up the IP address of the `field` in MaxMind GeoIP2/GeoLite2 databases and adds the location
+and the autonomous system of the address to the `target` object:
+```json
+{
+  "client_ip": "81.2.69.142",
+  "geo": {
+    "country_code": "GB",
+    "country_name": "United Kingdom",
+    "continent_code": "EU",
+    "region_name": "England",
+    "city_name": "London",
+    "postal_code": "SE1",
+    "timezone": "Europe/London",
+    "location": {"lat": 51.5142, "lon": -0.0931},
+    "asn": 20712,
+    "as_org": "Andrews & Arnold Ltd"
+  }
+}
+```
+The fields missing in the databases are skipped. The event isn't changed if the address isn't found.
+
+The database files are loaded once per pipeline and reloaded once they are changed.
+The lookup results are cached by the processors, the cached results expire after `reload_interval`,
+so the reloaded database is used in time.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: geoip
+      field: client_ip
+      city_database: /usr/share/GeoIP/GeoLite2-City.mmdb
+      asn_database: /usr/share/GeoIP/GeoLite2-ASN.mmdb
+    ...
+```
+}*/
+
+const (
+	fieldCountryCode   = "country_code"
+	fieldCountryName   = "country_name"
+	fieldContinentCode = "continent_code"
+	fieldRegionName    = "region_name"
+	fieldCityName      = "city_name"
+	fieldPostalCode    = "postal_code"
+	fieldTimezone      = "timezone"
+	fieldLocation      = "location"
+	fieldLat           = "lat"
+	fieldLon           = "lon"
+	fieldASN           = "asn"
+	fieldASOrg         = "as_org"
+)
+
+// the provider configs are built once per action, so the processors share the loaded databases.
+var (
+	providerConfigs   = map[*Config]*providerConfigsRef{}
+	providerConfigsMu = &sync.Mutex{}
+)
+
+// newProvider is replaced by the tests.
+var newProvider = lookup.New
+
+type providerConfigsRef struct {
+	configs [2]*lookup.Config
+	refs    int
+}
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+
+	city lookup.Provider
+	asn  lookup.Provider
+
+	cache *lookup.Cache
+
+	notFoundMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field with the IP address to look up.
+	Field  cfg.FieldSelector `json:"field" required:"true" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The object to put the found fields to.
+	Target  cfg.FieldSelector `json:"target" default:"geo" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Path to GeoIP2/GeoLite2 City or Country database.
+	CityDatabase string `json:"city_database"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path to GeoIP2/GeoLite2 ASN database.
+	ASNDatabase string `json:"asn_database"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The language of the country, region and city names.
+	Language string `json:"language" default:"en"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How often to check the modification time of the database files, the files are reloaded if they're changed.
+	ReloadInterval  cfg.Duration `json:"reload_interval" default:"1m" parse:"duration"` // *
+	ReloadInterval_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many lookup results each processor caches, zero disables caching.
+	CacheSize int `json:"cache_size" default:"10000"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "geoip",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if p.config.CityDatabase == "" && p.config.ASNDatabase == "" {
+		p.logger.Fatalf("city_database or asn_database must be set")
+	}
+
+	configs := getProviderConfigs(p.config)
+	var err error
+	if configs[0] != nil {
+		p.city, err = newProvider(configs[0], p.logger)
+		if err != nil {
+			p.logger.Fatalf("can't load city database: %s", err.Error())
+		}
+	}
+	if configs[1] != nil {
+		p.asn, err = newProvider(configs[1], p.logger)
+		if err != nil {
+			p.logger.Fatalf("can't load asn database: %s", err.Error())
+		}
+	}
+
+	p.cache = lookup.NewCache(p.config.CacheSize, p.config.ReloadInterval_)
+}
+
+func getProviderConfigs(config *Config) [2]*lookup.Config {
+	providerConfigsMu.Lock()
+	defer providerConfigsMu.Unlock()
+
+	if ref, ok := providerConfigs[config]; ok {
+		ref.refs++
+		return ref.configs
+	}
+
+	newConfig := func(path string) *lookup.Config {
+		if path == "" {
+			return nil
+		}
+		return &lookup.Config{
+			Type:            lookup.TypeMMDB,
+			Path:            path,
+			ReloadInterval_: config.ReloadInterval_,
+		}
+	}
+	configs := [2]*lookup.Config{newConfig(config.CityDatabase), newConfig(config.ASNDatabase)}
+	providerConfigs[config] = &providerConfigsRef{configs: configs, refs: 1}
+
+	return configs
+}
+
+// releaseProviderConfigs removes the provider configs once the last processor of the action is stopped.
+func releaseProviderConfigs(config *Config) {
+	providerConfigsMu.Lock()
+	defer providerConfigsMu.Unlock()
+
+	ref := providerConfigs[config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(providerConfigs, config)
+	}
+}
+
+func (p *Plugin) Stop() {
+	if p.city != nil {
+		p.city.Stop()
+	}
+	if p.asn != nil {
+		p.asn.Stop()
+	}
+	releaseProviderConfigs(p.config)
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.notFoundMetric = ctl.RegisterCounter("geoip_not_found_total", "Number of IP addresses not found by geoip plugin")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	node := event.Root.Dig(p.config.Field_...)
+	if node == nil {
+		return pipeline.ActionPass
+	}
+	ip := node.AsString()
+	if ip == "" {
+		return pipeline.ActionPass
+	}
+
+	now := time.Now()
+	var info *geoInfo
+	if cached, ok := p.cache.Get(ip, now); ok {
+		info = cached.(*geoInfo)
+	} else {
+		info = p.lookup(ip)
+		p.cache.Set(ip, info, now)
+	}
+	if info == nil {
+		p.notFoundMetric.WithLabelValues().Inc()
+		return pipeline.ActionPass
+	}
+
+	target := event.Root.Dig(p.config.Target_...)
+	if target == nil || !target.IsObject() {
+		target = pipeline.CreateNestedField(event.Root, p.config.Target_)
+	}
+	info.put(event.Root, target)
+
+	return pipeline.ActionPass
+}
+
+// lookup returns nil if the address isn't found in any database.
+func (p *Plugin) lookup(ip string) *geoInfo {
+	info := &geoInfo{}
+	found := false
+
+	if p.city != nil {
+		if record, ok := p.city.Lookup(ip); ok {
+			found = info.fillCity(record, p.config.Language) || found
+		}
+	}
+	if p.asn != nil {
+		if record, ok := p.asn.Lookup(ip); ok {
+			found = info.fillASN(record) || found
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return info
+}
+
+// geoInfo holds the found fields, the empty ones are skipped.
+type geoInfo struct {
+	countryCode   string
+	countryName   string
+	continentCode string
+	regionName    string
+	cityName      string
+	postalCode    string
+	timezone      string
+
+	hasLocation bool
+	lat         float64
+	lon         float64
+
+	hasASN bool
+	asn    int64
+	asOrg  string
+}
+
+func (g *geoInfo) fillCity(record any, language string) bool {
+	g.countryCode = getString(record, "country", "iso_code")
+	g.countryName = getString(record, "country", "names", language)
+	g.continentCode = getString(record, "continent", "code")
+	g.cityName = getString(record, "city", "names", language)
+	g.postalCode = getString(record, "postal", "code")
+	g.timezone = getString(record, "location", "time_zone")
+
+	// the first subdivision is the largest one
+	if subdivisions, ok := dig(record, "subdivisions").([]any); ok && len(subdivisions) > 0 {
+		g.regionName = getString(subdivisions[0], "names", language)
+	}
+
+	lat, latOK := getNumber(record, "location", "latitude")
+	lon, lonOK := getNumber(record, "location", "longitude")
+	if latOK && lonOK {
+		g.hasLocation = true
+		g.lat, g.lon = lat, lon
+	}
+
+	return g.countryCode != "" || g.cityName != "" || g.hasLocation
+}
+
+func (g *geoInfo) fillASN(record any) bool {
+	if asn, ok := getNumber(record, "autonomous_system_number"); ok {
+		g.hasASN = true
+		g.asn = int64(asn)
+	}
+	g.asOrg = getString(record, "autonomous_system_organization")
+
+	return g.hasASN || g.asOrg != ""
+}
+
+func (g *geoInfo) put(root *insaneJSON.Root, target *insaneJSON.Node) {
+	putString(root, target, fieldCountryCode, g.countryCode)
+	putString(root, target, fieldCountryName, g.countryName)
+	putString(root, target, fieldContinentCode, g.continentCode)
+	putString(root, target, fieldRegionName, g.regionName)
+	putString(root, target, fieldCityName, g.cityName)
+	putString(root, target, fieldPostalCode, g.postalCode)
+	putString(root, target, fieldTimezone, g.timezone)
+	if g.hasLocation {
+		location := target.AddFieldNoAlloc(root, fieldLocation).MutateToObject()
+		location.AddFieldNoAlloc(root, fieldLat).MutateToFloat(g.lat)
+		location.AddFieldNoAlloc(root, fieldLon).MutateToFloat(g.lon)
+	}
+	if g.hasASN {
+		target.AddFieldNoAlloc(root, fieldASN).MutateToInt64(g.asn)
+	}
+	putString(root, target, fieldASOrg, g.asOrg)
+}
+
+func putString(root *insaneJSON.Root, target *insaneJSON.Node, name string, value string) {
+	if value == "" {
+		return
+	}
+	target.AddFieldNoAlloc(root, name).MutateToString(value)
+}
+
+func dig(record any, path ...string) any {
+	for _, name := range path {
+		m, ok := record.(map[string]any)
+		if !ok {
+			return nil
+		}
+		record = m[name]
+	}
+	return record
+}
+
+func getString(record any, path ...string) string {
+	s, _ := dig(record, path...).(string)
+	return s
+}
+
+func getNumber(record any, path ...string) (float64, bool) {
+	switch v := dig(record, path...).(type) {
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
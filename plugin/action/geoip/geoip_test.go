@@ -0,0 +1,141 @@
+package geoip
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/lookup"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeProvider struct {
+	records map[string]any
+	lookups int
+}
+
+func (f *fakeProvider) Lookup(key string) (any, bool) {
+	f.lookups++
+	record, ok := f.records[key]
+	return record, ok
+}
+
+func (f *fakeProvider) Stop() {
+}
+
+// runPipeline passes the events through the action with the fake databases and returns the output events.
+func runPipeline(config *Config, city, asn *fakeProvider, in []string) []string {
+	newProvider = func(c *lookup.Config, _ *zap.SugaredLogger) (lookup.Provider, error) {
+		if c.Path == config.CityDatabase {
+			return city, nil
+		}
+		return asn, nil
+	}
+	defer func() { newProvider = lookup.New }()
+
+	test.NewConfig(config, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(in))
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	for _, event := range in {
+		input.In(0, "test.log", 0, []byte(event))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	return outEvents
+}
+
+func TestGeoIP(t *testing.T) {
+	city := &fakeProvider{records: map[string]any{
+		"81.2.69.142": map[string]any{
+			"city":         map[string]any{"names": map[string]any{"en": "London", "ru": "Лондон"}},
+			"continent":    map[string]any{"code": "EU"},
+			"country":      map[string]any{"iso_code": "GB", "names": map[string]any{"en": "United Kingdom"}},
+			"location":     map[string]any{"latitude": 51.5142, "longitude": -0.0931, "time_zone": "Europe/London"},
+			"postal":       map[string]any{"code": "SE1"},
+			"subdivisions": []any{map[string]any{"names": map[string]any{"en": "England"}}},
+		},
+		"1.1.1.1": map[string]any{"country": map[string]any{"iso_code": "AU"}},
+	}}
+	asn := &fakeProvider{records: map[string]any{
+		"81.2.69.142": map[string]any{
+			"autonomous_system_number":       uint64(20712),
+			"autonomous_system_organization": "Andrews & Arnold Ltd",
+		},
+	}}
+	config := &Config{Field: "ip", CityDatabase: "city.mmdb", ASNDatabase: "asn.mmdb"}
+
+	outEvents := runPipeline(config, city, asn, []string{
+		`{"ip":"81.2.69.142"}`,
+		`{"ip":"1.1.1.1","geo":{"source":"edge"}}`,
+		`{"ip":"10.0.0.1"}`,
+		`{"message":"81.2.69.142"}`,
+	})
+
+	assert.Equal(t, []string{
+		`{"ip":"81.2.69.142","geo":{"country_code":"GB","country_name":"United Kingdom","continent_code":"EU",` +
+			`"region_name":"England","city_name":"London","postal_code":"SE1","timezone":"Europe/London",` +
+			`"location":{"lat":51.5142,"lon":-0.0931},"asn":20712,"as_org":"Andrews & Arnold Ltd"}}`,
+		// the partial record is merged with the existing target
+		`{"ip":"1.1.1.1","geo":{"source":"edge","country_code":"AU"}}`,
+		// the address isn't found
+		`{"ip":"10.0.0.1"}`,
+		// the field is missing
+		`{"message":"81.2.69.142"}`,
+	}, outEvents)
+}
+
+func TestGeoIPLanguage(t *testing.T) {
+	city := &fakeProvider{records: map[string]any{
+		"81.2.69.142": map[string]any{
+			"city": map[string]any{"names": map[string]any{"en": "London", "ru": "Лондон"}},
+		},
+	}}
+	config := &Config{Field: "ip", CityDatabase: "city.mmdb", Language: "ru"}
+
+	outEvents := runPipeline(config, city, nil, []string{`{"ip":"81.2.69.142"}`})
+
+	assert.Equal(t, []string{`{"ip":"81.2.69.142","geo":{"city_name":"Лондон"}}`}, outEvents)
+}
+
+func TestGeoIPCache(t *testing.T) {
+	asn := &fakeProvider{records: map[string]any{
+		"1.1.1.1": map[string]any{"autonomous_system_number": uint64(13335)},
+	}}
+	config := &Config{Field: "ip", ASNDatabase: "asn.mmdb"}
+
+	in := make([]string, 0)
+	expected := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		in = append(in, `{"ip":"1.1.1.1"}`, `{"ip":"8.8.8.8"}`)
+		expected = append(expected, `{"ip":"1.1.1.1","geo":{"asn":13335}}`, `{"ip":"8.8.8.8"}`)
+	}
+	outEvents := runPipeline(config, nil, asn, in)
+
+	assert.Equal(t, expected, outEvents)
+	// the missing addresses are cached too
+	assert.Equal(t, 2, asn.lookups)
+}
+
+func TestConfigDefaults(t *testing.T) {
+	config := &Config{Field: "client.ip", CityDatabase: "city.mmdb"}
+	test.NewConfig(config, nil)
+
+	assert.Equal(t, cfg.ParseFieldSelector("client.ip"), config.Field_)
+	assert.Equal(t, "en", config.Language)
+	assert.Equal(t, time.Minute, config.ReloadInterval_)
+	assert.Equal(t, 10000, config.CacheSize)
+}
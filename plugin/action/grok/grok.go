@@ -0,0 +1,188 @@
+package grok
+
+import (
+	"strconv"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It parses an unstructured string from the event field by grok patterns and merges the captures with the event root.
+The patterns are tried in order, the first matched one is used. The field is removed if it's parsed successfully,
+otherwise the event isn't changed.
+
+The pattern references are `%{NAME}`, `%{NAME:field}` and `%{NAME:field:type}`.
+Only the named references are captured, the field may be a nested path like `client.ip` or `[client][ip]`.
+The type is `string`, `int` or `float`, the values which can't be converted are stored as strings.
+
+The library of the built-in patterns is a subset of the logstash one adapted to re2 syntax, e.g.
+`COMMONAPACHELOG`, `COMBINEDAPACHELOG`, `SYSLOGLINE`, `SYSLOGBASE`, `TIMESTAMP_ISO8601`, `HTTPDATE`, `IPORHOST`,
+`URI`, `UUID`, `LOGLEVEL`, `NUMBER`, `WORD`, `NOTSPACE`, `DATA`, `GREEDYDATA`.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: grok
+      field: message
+      patterns:
+      - '%{COMMONAPACHELOG}'
+      - '%{IPORHOST:client.ip} %{WORD:method} %{URIPATHPARAM:path} %{NUMBER:duration:float}'
+    ...
+```
+
+The original event:
+```json
+{
+  "message": "10.0.0.1 GET /index.html 0.043"
+}
+```
+
+The resulting event:
+```json
+{
+  "client": {
+    "ip": "10.0.0.1"
+  },
+  "method": "GET",
+  "path": "/index.html",
+  "duration": 0.043
+}
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+
+	groks []*grok
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field to parse. Must be a string.
+	Field  cfg.FieldSelector `json:"field" default:"message" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The grok patterns to match. They're tried in order until the first match.
+	Patterns []string `json:"patterns" required:"true" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The custom patterns `name => pattern`. They override the built-in and the file patterns with the same names.
+	PatternDefinitions map[string]string `json:"pattern_definitions"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The files with the custom patterns in the logstash format: `NAME pattern` per line, `#` starts a comment.
+	PatternsFiles []string `json:"patterns_files" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The object to put the captured fields to. The captured fields are merged with the event root by default.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > If set, the parsed field isn't removed.
+	KeepField bool `json:"keep_field" default:"false"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "grok",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	c, err := newCompiler(p.config.PatternDefinitions, p.config.PatternsFiles)
+	if err != nil {
+		p.logger.Fatalf("can't load grok patterns: %s", err.Error())
+	}
+
+	p.groks = make([]*grok, 0, len(p.config.Patterns))
+	for _, pattern := range p.config.Patterns {
+		g, err := c.compile(pattern)
+		if err != nil {
+			p.logger.Fatalf("can't compile grok pattern: %s", err.Error())
+		}
+		for _, capture := range g.captures {
+			if capture != nil {
+				capture.path = append(append([]string(nil), p.config.Target_...), capture.path...)
+			}
+		}
+		p.groks = append(p.groks, g)
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	jsonNode := event.Root.Dig(p.config.Field_...)
+	if jsonNode == nil {
+		return pipeline.ActionPass
+	}
+
+	value := jsonNode.AsBytes()
+	for _, g := range p.groks {
+		sm := g.re.FindSubmatch(value)
+		if sm == nil {
+			continue
+		}
+
+		if !p.config.KeepField {
+			jsonNode.Suicide()
+		}
+		for i, capture := range g.captures {
+			if capture == nil || sm[i] == nil {
+				continue
+			}
+			setCapture(event.Root, capture, sm[i])
+		}
+		return pipeline.ActionPass
+	}
+
+	return pipeline.ActionPass
+}
+
+func setCapture(root *insaneJSON.Root, capture *capture, value []byte) {
+	last := len(capture.path) - 1
+	node := pipeline.CreateNestedField(root, capture.path[:last]).AddFieldNoAlloc(root, capture.path[last])
+
+	switch capture.typ {
+	case typeInt:
+		if n, err := strconv.ParseInt(pipeline.ByteToStringUnsafe(value), 10, 64); err == nil {
+			node.MutateToInt64(n)
+			return
+		}
+	case typeFloat:
+		if f, err := strconv.ParseFloat(pipeline.ByteToStringUnsafe(value), 64); err == nil {
+			node.MutateToFloat(f)
+			return
+		}
+	}
+	node.MutateToBytesCopy(root, value)
+}
@@ -0,0 +1,112 @@
+package grok
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile(t *testing.T) {
+	cases := []struct {
+		name     string
+		pattern  string
+		data     string
+		expected map[string]string
+	}{
+		{
+			name:    "common_apache_log",
+			pattern: "%{COMMONAPACHELOG}",
+			data:    `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			expected: map[string]string{
+				"clientip": "127.0.0.1", "ident": "-", "auth": "frank", "timestamp": "10/Oct/2000:13:55:36 -0700",
+				"verb": "GET", "request": "/apache_pb.gif", "httpversion": "1.0", "response": "200", "bytes": "2326",
+			},
+		},
+		{
+			name:    "syslog_line",
+			pattern: "%{SYSLOGLINE}",
+			data:    `Feb  5 17:32:18 10.0.0.99 sshd[4721]: Accepted publickey for root`,
+			expected: map[string]string{
+				"timestamp": "Feb  5 17:32:18", "logsource": "10.0.0.99", "program": "sshd", "pid": "4721",
+				"message": "Accepted publickey for root",
+			},
+		},
+		{
+			name:    "iso8601_and_level",
+			pattern: `%{TIMESTAMP_ISO8601:ts} \[%{LOGLEVEL:level}\] %{GREEDYDATA:msg}`,
+			data:    `2022-06-01T12:30:45.123Z [WARN] disk is almost full`,
+			expected: map[string]string{
+				"ts": "2022-06-01T12:30:45.123Z", "level": "WARN", "msg": "disk is almost full",
+			},
+		},
+	}
+
+	c, err := newCompiler(nil, nil)
+	require.NoError(t, err)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := c.compile(tc.pattern)
+			require.NoError(t, err)
+
+			sm := g.re.FindSubmatch([]byte(tc.data))
+			require.NotNil(t, sm)
+
+			result := make(map[string]string)
+			for i, capture := range g.captures {
+				if capture != nil && sm[i] != nil {
+					result[capture.path[len(capture.path)-1]] = string(sm[i])
+				}
+			}
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	c, err := newCompiler(map[string]string{"LOOP": "%{LOOP}"}, nil)
+	require.NoError(t, err)
+
+	for _, pattern := range []string{"%{UNKNOWN}", "%{LOOP}", "%{INT:a:bool}", "%{DATA:a}("} {
+		_, err := c.compile(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestDo(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "patterns")
+	require.NoError(t, os.WriteFile(file, []byte("# custom patterns\nMETHOD GET|POST\n"), 0o600))
+
+	config := test.NewConfig(&Config{
+		Patterns: []string{
+			"%{COMMONAPACHELOG}",
+			"%{IPORHOST:client.ip} %{METHOD:[http][method]} %{URIPATHPARAM:path} %{NUMBER:duration:float} %{INT:size:int} %{ID:id:int}",
+		},
+		PatternDefinitions: map[string]string{"ID": `\w+`},
+		PatternsFiles:      []string{file},
+	}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"message":"10.0.0.1 POST /api?a=1 0.043 512 x1","host":"a"}`))
+	input.In(0, "test.log", 0, []byte(`{"message":"not matched"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	require.Equal(t, 2, len(outEvents))
+	assert.Equal(t, `{"host":"a","client":{"ip":"10.0.0.1"},"http":{"method":"POST"},"path":"/api?a=1","duration":0.043,"size":512,"id":"x1"}`, outEvents[0])
+	assert.Equal(t, `{"message":"not matched"}`, outEvents[1])
+}
@@ -0,0 +1,237 @@
+package grok
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ozontech/file.d/cfg"
+)
+
+// builtinPatterns is a subset of the logstash pattern library adapted to re2 syntax,
+// so the patterns don't use lookarounds and atomic groups.
+var builtinPatterns = map[string]string{
+	"USERNAME":       `[a-zA-Z0-9._-]+`,
+	"USER":           `%{USERNAME}`,
+	"EMAILLOCALPART": `[a-zA-Z0-9!#$%&'*+/=?^_{|}~-]+(?:\.[a-zA-Z0-9!#$%&'*+/=?^_{|}~-]+)*`,
+	"EMAILADDRESS":   `%{EMAILLOCALPART}@%{HOSTNAME}`,
+	"INT":            `[+-]?[0-9]+`,
+	"BASE10NUM":      `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":         `%{BASE10NUM}`,
+	"BASE16NUM":      `[+-]?(?:0x)?[0-9A-Fa-f]+`,
+	"POSINT":         `\b[1-9][0-9]*\b`,
+	"NONNEGINT":      `\b[0-9]+\b`,
+	"WORD":           `\b\w+\b`,
+	"NOTSPACE":       `\S+`,
+	"SPACE":          `\s*`,
+	"DATA":           `.*?`,
+	"GREEDYDATA":     `.*`,
+	"QUOTEDSTRING":   `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"QS":             `%{QUOTEDSTRING}`,
+	"UUID":           `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":            `(?:[A-Fa-f0-9]{2}[:-]){5}[A-Fa-f0-9]{2}|(?:[A-Fa-f0-9]{4}\.){2}[A-Fa-f0-9]{4}`,
+
+	"IPV4":     `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IPV6":     `(?:[0-9A-Fa-f]{0,4}:){2,7}(?:[0-9A-Fa-f]{1,4}|%{IPV4})?(?:%[0-9A-Za-z]+)?`,
+	"IP":       `%{IPV6}|%{IPV4}`,
+	"HOSTNAME": `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST": `%{IP}|%{HOSTNAME}`,
+	"HOSTPORT": `%{IPORHOST}:%{POSINT}`,
+
+	"UNIXPATH":     `(?:/[\w%!$@:.,+~-]*)+`,
+	"WINPATH":      `(?:[A-Za-z]+:|\\)(?:\\[^\\?*]*)+`,
+	"PATH":         `%{UNIXPATH}|%{WINPATH}`,
+	"URIPROTO":     `[A-Za-z][A-Za-z0-9+.-]+`,
+	"URIHOST":      `%{IPORHOST}(?::%{POSINT})?`,
+	"URIPATH":      `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_-]*)+`,
+	"URIPARAM":     `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\[\]<>-]*`,
+	"URIPATHPARAM": `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":          `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?(?:%{URIHOST})?(?:%{URIPATHPARAM})?`,
+
+	"MONTH":             `\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|Jun(?:e)?|Jul(?:y)?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b`,
+	"MONTHNUM":          `0?[1-9]|1[0-2]`,
+	"MONTHDAY":          `0[1-9]|[12][0-9]|3[01]|[1-9]`,
+	"DAY":               `Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `2[0123]|[01]?[0-9]`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"DATE":              `%{DATE_US}|%{DATE_EU}`,
+	"DATESTAMP":         `%{DATE}[- ]%{TIME}`,
+	"TZ":                `[APMCE][SD]T|UTC`,
+	"ISO8601_TIMEZONE":  `Z|[+-]%{HOUR}(?::?%{MINUTE})`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?(?:%{ISO8601_TIMEZONE})?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+
+	"LOGLEVEL": `[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo(?:rmation)?|INFO(?:RMATION)?|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|EMERG(?:ENCY)?|[Ee]merg(?:ency)?`,
+
+	"PROG":           `[\x21-\x5a\x5c\x5e-\x7e]+`,
+	"SYSLOGPROG":     `%{PROG:program}(?:\[%{POSINT:pid}\])?`,
+	"SYSLOGHOST":     `%{IPORHOST}`,
+	"SYSLOGFACILITY": `<%{NONNEGINT:facility}.%{NONNEGINT:priority}>`,
+	"SYSLOGBASE":     `%{SYSLOGTIMESTAMP:timestamp} (?:%{SYSLOGFACILITY} )?%{SYSLOGHOST:logsource} %{SYSLOGPROG}:`,
+	"SYSLOGLINE":     `%{SYSLOGBASE} %{GREEDYDATA:message}`,
+
+	"HTTPDUSER":         `%{EMAILADDRESS}|%{USER}`,
+	"COMMONAPACHELOG":   `%{IPORHOST:clientip} %{HTTPDUSER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" %{NUMBER:response} (?:%{NUMBER:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+}
+
+const (
+	typeString = "string"
+	typeInt    = "int"
+	typeFloat  = "float"
+
+	// maxDepth limits the nesting of the patterns to detect the recursive definitions.
+	maxDepth = 64
+)
+
+// reference matches `%{NAME}`, `%{NAME:field}` and `%{NAME:field:type}`.
+var reference = regexp.MustCompile(`%\{(\w+)(?::([^:}]+))?(?::(\w+))?\}`)
+
+type capture struct {
+	path []string
+	typ  string
+}
+
+type grok struct {
+	re *regexp.Regexp
+	// captures are indexed by the regexp group index.
+	captures []*capture
+}
+
+type compiler struct {
+	patterns map[string]string
+	captures []*capture
+}
+
+func newCompiler(definitions map[string]string, files []string) (*compiler, error) {
+	c := &compiler{patterns: make(map[string]string, len(builtinPatterns)+len(definitions))}
+	for name, pattern := range builtinPatterns {
+		c.patterns[name] = pattern
+	}
+	for _, file := range files {
+		if err := c.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	for name, pattern := range definitions {
+		c.patterns[name] = pattern
+	}
+	return c, nil
+}
+
+// loadFile reads the patterns in the logstash format: `NAME pattern` per line, `#` starts a comment.
+func (c *compiler) loadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("can't open patterns file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		pos := strings.IndexAny(s, " \t")
+		if pos == -1 {
+			return fmt.Errorf("wrong pattern at %s:%d: no pattern after name", file, line)
+		}
+		c.patterns[s[:pos]] = strings.TrimSpace(s[pos:])
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("can't read patterns file: %w", err)
+	}
+	return nil
+}
+
+func (c *compiler) compile(pattern string) (*grok, error) {
+	c.captures = c.captures[:0]
+	expanded, err := c.expand(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("can't compile pattern %q: %w", pattern, err)
+	}
+
+	g := &grok{re: re, captures: make([]*capture, re.NumSubexp()+1)}
+	for i, name := range re.SubexpNames() {
+		if !strings.HasPrefix(name, "grok") {
+			continue
+		}
+		idx, err := strconv.Atoi(name[len("grok"):])
+		if err != nil || idx >= len(c.captures) {
+			continue
+		}
+		g.captures[i] = c.captures[idx]
+	}
+	return g, nil
+}
+
+func (c *compiler) expand(pattern string, depth int) (string, error) {
+	if depth > maxDepth {
+		return "", fmt.Errorf("pattern %q is nested too deep, it may be recursive", pattern)
+	}
+
+	var expandErr error
+	result := reference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if expandErr != nil {
+			return ""
+		}
+		m := reference.FindStringSubmatch(ref)
+		name, field, typ := m[1], m[2], m[3]
+
+		definition, ok := c.patterns[name]
+		if !ok {
+			expandErr = fmt.Errorf("unknown pattern %q", name)
+			return ""
+		}
+		sub, err := c.expand(definition, depth+1)
+		if err != nil {
+			expandErr = err
+			return ""
+		}
+		if field == "" {
+			return "(?:" + sub + ")"
+		}
+
+		switch typ {
+		case "", typeString:
+			typ = typeString
+		case typeInt, typeFloat:
+		default:
+			expandErr = fmt.Errorf("unknown type %q of field %q", typ, field)
+			return ""
+		}
+
+		group := fmt.Sprintf("grok%d", len(c.captures))
+		c.captures = append(c.captures, &capture{path: parseField(field), typ: typ})
+		return "(?P<" + group + ">" + sub + ")"
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return result, nil
+}
+
+// parseField supports both file.d selectors `client.ip` and logstash references `[client][ip]`.
+func parseField(field string) []string {
+	if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+		return strings.Split(field[1:len(field)-1], "][")
+	}
+	return cfg.ParseFieldSelector(field)
+}
@@ -0,0 +1,109 @@
+package http_lookup
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/lookup"
+)
+
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+// client sends the requests with the lookup HTTP client, caches the responses in the lookup cache
+// and stops sending the requests once the endpoint fails too many times in a row.
+// It's shared by the processors of the action.
+type client struct {
+	http    *lookup.HTTPClient
+	cache   *lookup.Cache
+	extract func(body []byte) (*response, error)
+	method  string
+
+	breakerMu       sync.Mutex
+	maxFailures     int
+	breakerTimeout  time.Duration
+	failures        int
+	openUntil       time.Time
+	halfOpenRunning bool
+}
+
+func newClient(config *Config, extract func(body []byte) (*response, error)) *client {
+	return &client{
+		http:           lookup.NewHTTPClient(config.Headers, config.Timeout_),
+		cache:          lookup.NewCache(config.CacheSize, config.CacheTTL_),
+		extract:        extract,
+		method:         config.Method,
+		maxFailures:    config.BreakerFailures,
+		breakerTimeout: config.BreakerTimeout_,
+	}
+}
+
+// do returns the cached or the received response of the request.
+// The key identifies the request, it's the url and the body, it may point to a reused buffer.
+func (c *client) do(key string, url []byte, body []byte, now time.Time) (*response, error) {
+	if cached, ok := c.cache.Get(key, now); ok {
+		return cached.(*response), nil
+	}
+
+	if !c.allow(now) {
+		return nil, errBreakerOpen
+	}
+	respBody, found, err := c.http.Do(c.method, string(url), body)
+	c.report(err == nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &response{}
+	if found {
+		if resp, err = c.extract(respBody); err != nil {
+			return nil, err
+		}
+	}
+
+	c.cache.Set(key, resp, now)
+	return resp, nil
+}
+
+// allow returns false if the breaker is open.
+// Once the breaker timeout is passed, the single request is allowed to check the endpoint.
+func (c *client) allow(now time.Time) bool {
+	if c.maxFailures <= 0 {
+		return true
+	}
+
+	c.breakerMu.Lock()
+	defer c.breakerMu.Unlock()
+
+	if c.failures < c.maxFailures {
+		return true
+	}
+	if now.Before(c.openUntil) || c.halfOpenRunning {
+		return false
+	}
+	c.halfOpenRunning = true
+	return true
+}
+
+func (c *client) report(ok bool, now time.Time) {
+	if c.maxFailures <= 0 {
+		return
+	}
+
+	c.breakerMu.Lock()
+	defer c.breakerMu.Unlock()
+
+	c.halfOpenRunning = false
+	if ok {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.failures >= c.maxFailures {
+		c.openUntil = now.Add(c.breakerTimeout)
+	}
+}
+
+func (c *client) stop() {
+	c.http.Close()
+}
@@ -0,0 +1,316 @@
+package http_lookup
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It requests an HTTP endpoint with the values of the event fields and merges the fields of the JSON response into the event.
+The `url` and the `body` are templates with `${field.path}` placeholders, the event isn't changed
+if some of the fields are missing. `404 Not Found` response means there is nothing to merge.
+
+The responses are cached by all the processors of the pipeline for `cache_ttl`, including the not found ones.
+Once the endpoint fails `breaker_failures` times in a row, the requests aren't sent for `breaker_timeout`,
+then the single request checks if the endpoint is back. The events pass unchanged while the endpoint fails.
+
+**Example:**
+Attaching the owners of the services from the service catalog:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: http_lookup
+      url: http://catalog/api/services/${service}?env=${env}
+      fields: [owner.team, owner.chat]
+      target: catalog
+    ...
+```
+The catalog responds `{"name":"payments","owner":{"team":"billing","chat":"#billing-oncall"}}`, so the event
+```json
+{"service":"payments","env":"prod"}
+```
+becomes
+```json
+{"service":"payments","env":"prod","catalog":{"team":"billing","chat":"#billing-oncall"}}
+```
+}*/
+
+var (
+	clients   = map[*Config]*clientRef{}
+	clientsMu = &sync.Mutex{}
+)
+
+type clientRef struct {
+	client *client
+	refs   int
+}
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	client *client
+
+	urlOps  []cfg.SubstitutionOp
+	bodyOps []cfg.SubstitutionOp
+	fields  [][]string
+
+	urlBuf  []byte
+	bodyBuf []byte
+	keyBuf  []byte
+
+	errorsMetric *prom.CounterVec
+}
+
+// responseField is a field of the response to merge into the event.
+type responseField struct {
+	name string
+	json string
+}
+
+// response holds the fields to merge, there are no fields if the key isn't found.
+type response struct {
+	fields []responseField
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The template of the request URL. The field values are URL-escaped.
+	URL string `json:"url" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The method of the requests.
+	Method string `json:"method" default:"GET" options:"GET|POST"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The template of the JSON request body. The field values are escaped as JSON strings,
+	// > e.g. `{"service":"${service}"}`. The body isn't sent if it's empty.
+	Body string `json:"body"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Headers of the requests.
+	Headers map[string]string `json:"headers"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The fields of the response to merge into the event, they're put with the last names of the paths.
+	// > All the fields of the response are merged if it's empty.
+	Fields []string `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The object to merge the response fields into. The fields are merged into the event root by default.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of the requests.
+	Timeout  cfg.Duration `json:"timeout" default:"1s" parse:"duration"` // *
+	Timeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many responses to cache, zero disables caching.
+	CacheSize int `json:"cache_size" default:"10000"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How long to cache the responses, zero means the cached responses don't expire.
+	CacheTTL  cfg.Duration `json:"cache_ttl" default:"5m" parse:"duration"` // *
+	CacheTTL_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many failed requests in a row open the circuit breaker, zero disables the breaker.
+	BreakerFailures int `json:"breaker_failures" default:"5"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How long the circuit breaker stays open.
+	BreakerTimeout  cfg.Duration `json:"breaker_timeout" default:"30s" parse:"duration"` // *
+	BreakerTimeout_ time.Duration
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "http_lookup",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	var err error
+	p.urlOps, err = cfg.ParseSubstitution(p.config.URL)
+	if err != nil {
+		p.logger.Fatalf("can't parse url: %s", err.Error())
+	}
+	if p.config.Body != "" {
+		if p.config.Method == http.MethodGet {
+			p.logger.Fatalf("body can't be sent with GET method")
+		}
+		p.bodyOps, err = cfg.ParseSubstitution(p.config.Body)
+		if err != nil {
+			p.logger.Fatalf("can't parse body: %s", err.Error())
+		}
+	}
+	for _, field := range p.config.Fields {
+		p.fields = append(p.fields, cfg.ParseFieldSelector(field))
+	}
+
+	// the config is shared by the processors, so it identifies the client of the action.
+	clientsMu.Lock()
+	ref, ok := clients[p.config]
+	if !ok {
+		ref = &clientRef{client: newClient(p.config, p.extract)}
+		clients[p.config] = ref
+	}
+	ref.refs++
+	p.client = ref.client
+	clientsMu.Unlock()
+}
+
+func (p *Plugin) Stop() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	ref := clients[p.config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(clients, p.config)
+		ref.client.stop()
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("http_lookup_errors_total", "Number of failed requests of http_lookup plugin")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	var ok bool
+	p.urlBuf, ok = render(p.urlBuf[:0], p.urlOps, event.Root, appendURLEscaped)
+	if !ok {
+		return pipeline.ActionPass
+	}
+	var body []byte
+	if p.bodyOps != nil {
+		p.bodyBuf, ok = render(p.bodyBuf[:0], p.bodyOps, event.Root, appendJSONEscaped)
+		if !ok {
+			return pipeline.ActionPass
+		}
+		body = p.bodyBuf
+	}
+
+	p.keyBuf = append(p.keyBuf[:0], p.urlBuf...)
+	p.keyBuf = append(p.keyBuf, '\n')
+	p.keyBuf = append(p.keyBuf, body...)
+
+	resp, err := p.client.do(pipeline.ByteToStringUnsafe(p.keyBuf), p.urlBuf, body, time.Now())
+	if err != nil {
+		p.errorsMetric.WithLabelValues().Inc()
+		p.logger.Errorf("can't request %s: %s", p.urlBuf, err.Error())
+		return pipeline.ActionPass
+	}
+	if len(resp.fields) == 0 {
+		return pipeline.ActionPass
+	}
+
+	target := event.Root.Dig(p.config.Target_...)
+	if target == nil || !target.IsObject() {
+		target = pipeline.CreateNestedField(event.Root, p.config.Target_)
+	}
+	for _, field := range resp.fields {
+		target.AddFieldNoAlloc(event.Root, field.name).MutateToJSON(event.Root, field.json)
+	}
+
+	return pipeline.ActionPass
+}
+
+// extract gets the fields to merge from the response body.
+func (p *Plugin) extract(body []byte) (*response, error) {
+	root, err := insaneJSON.DecodeBytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode response: %w", err)
+	}
+	defer insaneJSON.Release(root)
+
+	if !root.IsObject() {
+		return nil, fmt.Errorf("response isn't an object: %s", body)
+	}
+
+	resp := &response{}
+	if len(p.fields) == 0 {
+		for _, field := range root.AsFields() {
+			resp.fields = append(resp.fields, responseField{
+				// the name points to the released root
+				name: strings.Clone(field.AsString()),
+				json: field.AsFieldValue().EncodeToString(),
+			})
+		}
+		return resp, nil
+	}
+
+	for _, path := range p.fields {
+		node := root.Dig(path...)
+		if node == nil {
+			continue
+		}
+		resp.fields = append(resp.fields, responseField{
+			name: path[len(path)-1],
+			json: node.EncodeToString(),
+		})
+	}
+	return resp, nil
+}
+
+func appendURLEscaped(buf []byte, s string) []byte {
+	return append(buf, url.QueryEscape(s)...)
+}
+
+func appendJSONEscaped(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c == '\r':
+			buf = append(buf, '\\', 'r')
+		case c == '\t':
+			buf = append(buf, '\\', 't')
+		case c < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
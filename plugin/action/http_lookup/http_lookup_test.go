@@ -0,0 +1,149 @@
+package http_lookup
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// runPipeline passes the events through the action and returns the output events.
+func runPipeline(config *Config, in []string) []string {
+	test.NewConfig(config, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(in))
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	for _, event := range in {
+		input.In(0, "test.log", 0, []byte(event))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	return outEvents
+}
+
+func TestHTTPLookup(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/services/payments" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, "prod env", r.URL.Query().Get("env"))
+		_, _ = w.Write([]byte(`{"name":"payments","owner":{"team":"billing","chat":"#billing"},"tier":1}`))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name   string
+		fields []string
+		target string
+		out    string
+	}{
+		{
+			name: "all_fields",
+			out:  `{"service":"payments","env":"prod env","name":"payments","owner":{"team":"billing","chat":"#billing"},"tier":1}`,
+		},
+		{
+			name:   "selected_fields",
+			fields: []string{"owner.team", "tier", "missing"},
+			target: "catalog",
+			out:    `{"service":"payments","env":"prod env","catalog":{"team":"billing","tier":1}}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests.Store(0)
+			config := &Config{
+				URL:    server.URL + "/services/${service}?env=${env}",
+				Fields: tc.fields,
+				Target: cfg.FieldSelector(tc.target),
+			}
+
+			in := make([]string, 0)
+			expected := make([]string, 0)
+			for i := 0; i < 3; i++ {
+				in = append(in, `{"service":"payments","env":"prod env"}`, `{"service":"orders","env":"prod env"}`, `{"service":"payments"}`)
+				expected = append(expected, tc.out, `{"service":"orders","env":"prod env"}`, `{"service":"payments"}`)
+			}
+
+			assert.Equal(t, expected, runPipeline(config, in))
+			// the responses are cached including the not found ones
+			assert.Equal(t, int64(2), requests.Load())
+		})
+	}
+}
+
+func TestHTTPLookupBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"message":"say \"hi\"\n","ctx":"{\"a\":1}"}`, string(body))
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	config := &Config{
+		URL:    server.URL,
+		Method: http.MethodPost,
+		Body:   `{"message":"${message}","ctx":"${ctx}"}`,
+	}
+
+	outEvents := runPipeline(config, []string{`{"message":"say \"hi\"\n","ctx":{"a":1}}`})
+
+	assert.Equal(t, []string{`{"message":"say \"hi\"\n","ctx":{"a":1},"ok":true}`}, outEvents)
+}
+
+func TestHTTPLookupBreaker(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	config := &Config{URL: server.URL + "/${id}", BreakerFailures: 2, BreakerTimeout: "1m"}
+
+	in := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		in = append(in, `{"id":"1"}`)
+	}
+	assert.Equal(t, in, runPipeline(config, in))
+	assert.Equal(t, int64(2), requests.Load())
+}
+
+func TestClientBreaker(t *testing.T) {
+	config := test.NewConfig(&Config{URL: "http://localhost", BreakerFailures: 2, BreakerTimeout: "1m"}, nil).(*Config)
+	c := newClient(config, nil)
+	defer c.stop()
+
+	now := time.Now()
+	c.report(false, now)
+	assert.True(t, c.allow(now))
+	c.report(false, now)
+	assert.False(t, c.allow(now))
+
+	// the single request checks the endpoint once the breaker timeout is passed
+	now = now.Add(2 * time.Minute)
+	assert.True(t, c.allow(now))
+	assert.False(t, c.allow(now))
+	c.report(true, now)
+	assert.True(t, c.allow(now))
+}
@@ -0,0 +1,28 @@
+package http_lookup
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+// render appends the substitution to the buf, the field values are escaped by the escape func.
+// It returns false if some field is missing in the event.
+func render(buf []byte, ops []cfg.SubstitutionOp, root *insaneJSON.Root, escape func([]byte, string) []byte) ([]byte, bool) {
+	for _, op := range ops {
+		if op.Kind == cfg.SubstitutionOpKindRaw {
+			buf = append(buf, op.Data[0]...)
+			continue
+		}
+
+		node := root.Dig(op.Data...)
+		if node == nil {
+			return buf, false
+		}
+		value := node.AsString()
+		if node.IsObject() || node.IsArray() {
+			value = node.EncodeToString()
+		}
+		buf = escape(buf, value)
+	}
+	return buf, true
+}
@@ -2,6 +2,7 @@ package join
 
 import (
 	"regexp"
+	"time"
 
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
@@ -32,6 +33,10 @@ pipelines:
         stream: stderr // apply only for events which was written to stderr to save CPU time
     ...
 ```
+
+Joining holds the first event of the sequence till the sequence ends. The idle stream is flushed by the `event_timeout` of the pipeline,
+and `max_join_duration`, `max_lines` and `max_event_size` with `split_on_max_size` limit the sequences of the slow streams:
+once the limit is reached, the joined part is passed further and the rest of the sequence is joined into the next event.
 }*/
 
 /*{ understanding
@@ -70,6 +75,8 @@ type Plugin struct {
 	isJoining    bool
 	initial      *pipeline.Event
 	buff         []byte
+	lines        int
+	startTime    time.Time
 	maxEventSize int
 	negate       bool
 
@@ -107,6 +114,26 @@ type Config struct {
 	// >
 	// > Negate match logic for Continue (lets you implement negative lookahead while joining lines)
 	Negate bool `json:"negate" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the joined part is passed further once the resulted event exceeds `max_event_size`
+	// > and the rest of the sequence is joined into the next event instead of being truncated.
+	SplitOnMaxSize bool `json:"split_on_max_size" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Max duration of joining, e.g. `5s`. The partial event is passed further on the next event of the stream
+	// > once the duration since the start of the sequence is exceeded, and the rest of the sequence is joined into the next event.
+	// > Zero means no limit.
+	MaxJoinDuration  cfg.Duration `json:"max_join_duration" default:"0s" parse:"duration"` // *
+	MaxJoinDuration_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Max number of the events joined into one event on the stream. Once it's reached, the partial event is passed further
+	// > and the rest of the sequence is joined into the next event. Zero means no limit.
+	MaxLines int `json:"max_lines" default:"0"` // *
 }
 
 func init() {
@@ -124,6 +151,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginP
 	p.controller = params.Controller
 	p.config = config.(*Config)
 	p.isJoining = false
+	p.lines = 0
 	p.buff = make([]byte, 0, params.PipelineSettings.AvgEventSize)
 	p.maxEventSize = p.config.MaxEventSize
 	p.negate = p.config.Negate
@@ -176,10 +204,7 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 			p.flush()
 		}
 
-		p.initial = event
-		p.isJoining = true
-		p.buff = append(p.buff[:0], value...)
-		return pipeline.ActionHold
+		return p.hold(event, value)
 	}
 
 	if p.isJoining {
@@ -188,9 +213,15 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 			nextOK = !nextOK
 		}
 		if nextOK {
+			if p.isLimitReached(value) {
+				p.flush()
+				return p.hold(event, value)
+			}
+
 			if p.maxEventSize == 0 || len(p.buff) < p.maxEventSize {
 				p.buff = append(p.buff, value...)
 			}
+			p.lines++
 			return pipeline.ActionCollapse
 		}
 	}
@@ -200,3 +231,26 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	}
 	return pipeline.ActionPass
 }
+
+// hold starts joining the sequence with the event.
+func (p *Plugin) hold(event *pipeline.Event, value string) pipeline.ActionResult {
+	p.initial = event
+	p.isJoining = true
+	p.buff = append(p.buff[:0], value...)
+	p.lines = 1
+	if p.config.MaxJoinDuration_ > 0 {
+		p.startTime = time.Now()
+	}
+	return pipeline.ActionHold
+}
+
+// isLimitReached checks if the joined event must be passed further before joining the value.
+func (p *Plugin) isLimitReached(value string) bool {
+	if p.config.MaxLines > 0 && p.lines >= p.config.MaxLines {
+		return true
+	}
+	if p.config.SplitOnMaxSize && p.maxEventSize > 0 && len(p.buff)+len(value) > p.maxEventSize {
+		return true
+	}
+	return p.config.MaxJoinDuration_ > 0 && time.Since(p.startTime) >= p.config.MaxJoinDuration_
+}
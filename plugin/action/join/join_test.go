@@ -3,6 +3,7 @@ package join
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -306,3 +307,70 @@ func TestJoinAfterNilNode(t *testing.T) {
 		})
 	}
 }
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		sleep  time.Duration
+		out    []string
+	}{
+		{
+			name:   "no limits",
+			config: &Config{},
+			out:    []string{"start 1 2 3 4 "},
+		},
+		{
+			name:   "max lines",
+			config: &Config{MaxLines: 2},
+			out:    []string{"start 1 ", "2 3 ", "4 "},
+		},
+		{
+			name:   "truncate",
+			config: &Config{MaxEventSize: 8},
+			out:    []string{"start 1 "},
+		},
+		{
+			name:   "split on max size",
+			config: &Config{MaxEventSize: 8, SplitOnMaxSize: true},
+			out:    []string{"start 1 ", "2 3 4 "},
+		},
+		{
+			name:   "max join duration",
+			config: &Config{MaxJoinDuration: "10ms"},
+			sleep:  20 * time.Millisecond,
+			out:    []string{"start ", "1 ", "2 ", "3 ", "4 "},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Field = "log"
+			tc.config.Start = "/^start/"
+			tc.config.Continue = "/^[0-9]/"
+			test.NewConfig(tc.config, nil)
+
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, tc.config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			// the last line isn't joined, it's passed once the joined lines are passed
+			wg.Add(len(tc.out) + 1)
+
+			outEvents := make([]string, 0)
+			output.SetOutFn(func(e *pipeline.Event) {
+				if log := string(e.Root.Dig("log").AsBytes()); log != "end" {
+					outEvents = append(outEvents, log)
+				}
+				wg.Done()
+			})
+
+			for i, line := range []string{"start ", "1 ", "2 ", "3 ", "4 ", "end"} {
+				input.In(0, "test.log", int64(i), []byte(fmt.Sprintf(`{"log":%q}`, line)))
+				time.Sleep(tc.sleep)
+			}
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvents)
+		})
+	}
+}
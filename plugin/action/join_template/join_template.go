@@ -1,6 +1,10 @@
 package join_template
 
 import (
+	"os"
+	"time"
+
+	"github.com/ghodss/yaml"
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/logger"
@@ -28,18 +32,53 @@ pipelines:
         stream: stderr // apply only for events which was written to stderr to save CPU time
     ...
 ```
+
+The built-in templates are `go_panic`, `python_traceback`, `java_exception`, `node_error` and `rust_panic`.
+The user-defined templates are set in the config or in the file shared by the pipelines:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: join_template
+      template: ruby_error
+      templates:
+        ruby_error:
+          start: '/^\S+\.rb:[0-9]+:in /'
+          continue: '/^\s+from /'
+    ...
+```
 }*/
 
-type joinTemplates map[string]struct {
+type joinTemplate struct {
 	startRePat    string
 	continueRePat string
+	negate        bool
 }
 
+type joinTemplates map[string]joinTemplate
+
 var templates = joinTemplates{
 	"go_panic": {
 		startRePat:    "/^(panic:)|(http: panic serving)/",
 		continueRePat: "/(^\\s*$)|(goroutine [0-9]+ \\[)|(\\.go:[0-9]+)|(created by .*\\/?.*\\.)|(^\\[signal)|(panic.+[0-9]x[0-9,a-f]+)|(panic:)|([A-Za-z_]+[A-Za-z0-9_]*\\)?\\.[A-Za-z0-9_]+\\(.*\\))/",
 	},
+	"python_traceback": {
+		startRePat:    `/^Traceback \(most recent call last\):/`,
+		continueRePat: `/(^\s+)|(^\s*$)|(^[A-Za-z_][\w.]*(Error|Exception|Warning|Exit|Interrupt|Iteration)\b)|(^During handling of the above exception)|(^The above exception was the direct cause)/`,
+	},
+	"java_exception": {
+		startRePat:    `/(^([\w$]+\.)+[\w$]*(Exception|Error|Throwable)(: |\s*$))|(^Exception in thread ")/`,
+		continueRePat: `/(^\s+at )|(^\s+\.\.\. [0-9]+ (more|common frames omitted))|(^Caused by: )|(^\s+Suppressed: )/`,
+	},
+	"node_error": {
+		startRePat:    `/^(Uncaught )?([A-Z]\w*)?(Error|Exception)( \[\w+\])?(: |\s*$)/`,
+		continueRePat: `/(^\s+at )|(^\s+\.\.\. [0-9]+ (more|lines matching cause stack trace))/`,
+	},
+	"rust_panic": {
+		startRePat:    `/^thread '.*' panicked at /`,
+		continueRePat: `/(^note: )|(^stack backtrace:)|(^\s+[0-9]+: )|(^\s+at )/`,
+	},
 }
 
 type Plugin struct {
@@ -65,8 +104,49 @@ type Config struct {
 
 	// > @3@4@5@6
 	// >
-	// > The name of the template. Available templates: `go_panic`.
+	// > If set, the joined part is passed further once the resulted event exceeds `max_event_size`
+	// > and the rest of the sequence is joined into the next event instead of being truncated.
+	SplitOnMaxSize bool `json:"split_on_max_size" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Max duration of joining, e.g. `5s`. The partial event is passed further on the next event of the stream
+	// > once the duration since the start of the sequence is exceeded. Zero means no limit.
+	MaxJoinDuration  cfg.Duration `json:"max_join_duration" default:"0s" parse:"duration"` // *
+	MaxJoinDuration_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Max number of the events joined into one event on the stream. Zero means no limit.
+	MaxLines int `json:"max_lines" default:"0"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The name of the template. Available templates: `go_panic`, `python_traceback`, `java_exception`, `node_error`, `rust_panic`
+	// > and the ones from `templates` and `templates_file`.
 	Template string `json:"template" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The user-defined templates, the map of the template names to the objects:
+	// > * `start` – the regexp which starts the join sequence
+	// > * `continue` – the regexp which continues the join sequence
+	// > * `negate` – if set, the sequence is continued by the events which don't match `continue`
+	// >
+	// > They take precedence over the templates from `templates_file` and the built-in ones with the same names.
+	Templates map[string]TemplateConfig `json:"templates"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The path to the YAML or JSON file with the map of the user-defined templates in the `templates` format.
+	// > The templates take precedence over the built-in ones with the same names.
+	TemplatesFile string `json:"templates_file"` // *
+}
+
+type TemplateConfig struct {
+	Start    string `json:"start"`
+	Continue string `json:"continue"`
+	Negate   bool   `json:"negate"`
 }
 
 func init() {
@@ -84,7 +164,10 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginP
 	p.config = config.(*Config)
 
 	templateName := p.config.Template
-	template, ok := templates[templateName]
+	template, ok, err := p.findTemplate(templateName)
+	if err != nil {
+		logger.Fatalf("can't load join templates from file \"%s\": %s", p.config.TemplatesFile, err.Error())
+	}
 	if !ok {
 		logger.Fatalf("join template \"%s\" not found", templateName)
 	}
@@ -99,15 +182,47 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginP
 	}
 
 	jConfig := &join.Config{
-		Field_:       p.config.Field_,
-		MaxEventSize: p.config.MaxEventSize,
-		Start_:       startRe,
-		Continue_:    continueRe,
+		Field_:           p.config.Field_,
+		MaxEventSize:     p.config.MaxEventSize,
+		SplitOnMaxSize:   p.config.SplitOnMaxSize,
+		MaxJoinDuration_: p.config.MaxJoinDuration_,
+		MaxLines:         p.config.MaxLines,
+		Start_:           startRe,
+		Continue_:        continueRe,
+		Negate:           template.negate,
 	}
 	p.jp = &join.Plugin{}
 	p.jp.Start(jConfig, params)
 }
 
+// findTemplate looks for the template in the config, in the templates file and in the built-in templates in order.
+func (p *Plugin) findTemplate(name string) (joinTemplate, bool, error) {
+	if t, ok := p.config.Templates[name]; ok {
+		return newTemplate(t), true, nil
+	}
+
+	if p.config.TemplatesFile != "" {
+		data, err := os.ReadFile(p.config.TemplatesFile)
+		if err != nil {
+			return joinTemplate{}, false, err
+		}
+		fileTemplates := make(map[string]TemplateConfig)
+		if err := yaml.Unmarshal(data, &fileTemplates); err != nil {
+			return joinTemplate{}, false, err
+		}
+		if t, ok := fileTemplates[name]; ok {
+			return newTemplate(t), true, nil
+		}
+	}
+
+	t, ok := templates[name]
+	return t, ok, nil
+}
+
+func newTemplate(t TemplateConfig) joinTemplate {
+	return joinTemplate{startRePat: t.Start, continueRePat: t.Continue, negate: t.Negate}
+}
+
 func (p *Plugin) Stop() {
 	p.jp.Stop()
 }
@@ -2,7 +2,10 @@ package join_template
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -551,3 +554,110 @@ func TestJoinAfterNilNode(t *testing.T) {
 		})
 	}
 }
+
+// joinLines passes the lines through the plugin and returns the events got by the output.
+// The last event has no field, so it ends the joined sequence and marks the end of the events.
+func joinLines(config *Config, lines []string) []string {
+	test.NewConfig(config, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		node := e.Root.Dig("log")
+		if node == nil {
+			wg.Done()
+			return
+		}
+		outEvents = append(outEvents, string(node.AsBytes()))
+	})
+
+	for i, line := range lines {
+		input.In(0, "test.log", int64(i), []byte(fmt.Sprintf(`{"log":%q}`, line)))
+	}
+	input.In(0, "test.log", int64(len(lines)), []byte(`{}`))
+
+	wg.Wait()
+	p.Stop()
+
+	return outEvents
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	cases := []struct {
+		template string
+		lines    []string
+	}{
+		{
+			template: "python_traceback",
+			lines: []string{
+				"Traceback (most recent call last):\n",
+				"  File \"app.py\", line 3, in <module>\n",
+				"    main()\n",
+				"ValueError: bad value\n",
+			},
+		},
+		{
+			template: "java_exception",
+			lines: []string{
+				"java.lang.IllegalStateException: boom\n",
+				"\tat com.example.App.run(App.java:10)\n",
+				"\t... 3 more\n",
+				"Caused by: java.io.IOException: closed\n",
+				"\tat com.example.Io.read(Io.java:5)\n",
+			},
+		},
+		{
+			template: "node_error",
+			lines: []string{
+				"TypeError: Cannot read properties of undefined (reading 'x')\n",
+				"    at Object.<anonymous> (/app/index.js:1:3)\n",
+				"    at node:internal/main/run_main_module:23:47\n",
+			},
+		},
+		{
+			template: "rust_panic",
+			lines: []string{
+				"thread 'main' panicked at 'explicit panic', src/main.rs:2:5\n",
+				"stack backtrace:\n",
+				"   0: rust_begin_unwind\n",
+				"             at /rustc/library/std/src/panicking.rs:597:5\n",
+				"note: Some details are omitted, run with `RUST_BACKTRACE=full` for a verbose backtrace.\n",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.template, func(t *testing.T) {
+			out := joinLines(&Config{Field: "log", Template: tc.template}, append([]string{"before\n"}, tc.lines...))
+			assert.Equal(t, []string{"before\n", strings.Join(tc.lines, "")}, out)
+		})
+	}
+}
+
+func TestUserTemplates(t *testing.T) {
+	lines := []string{"BEGIN\n", "  1\n", "  2\n", "BEGIN\n", "  3\n"}
+
+	path := filepath.Join(t.TempDir(), "templates.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+indented:
+  start: '/^BEGIN/'
+  continue: '/^\s/'
+go_panic:
+  start: '/^BEGIN/'
+  continue: '/^BEGIN/'
+  negate: true
+`), 0o644))
+
+	out := joinLines(&Config{Field: "log", Template: "indented", TemplatesFile: path}, lines)
+	assert.Equal(t, []string{"BEGIN\n  1\n  2\n", "BEGIN\n  3\n"}, out)
+
+	// the file template overrides the built-in one, the sequence is continued by any line except the start
+	out = joinLines(&Config{Field: "log", Template: "go_panic", TemplatesFile: path}, append(lines, "end\n"))
+	assert.Equal(t, []string{"BEGIN\n  1\n  2\n", "BEGIN\n  3\nend\n"}, out)
+
+	// the config template overrides the file one
+	templates := map[string]TemplateConfig{"indented": {Start: "/^BEGIN/", Continue: "/1/"}}
+	out = joinLines(&Config{Field: "log", Template: "indented", Templates: templates, TemplatesFile: path}, lines)
+	assert.Equal(t, []string{"BEGIN\n  1\n", "  2\n", "BEGIN\n", "  3\n"}, out)
+}
@@ -0,0 +1,171 @@
+package js
+
+import (
+	"math"
+	"strings"
+
+	"github.com/dop251/goja"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+// object exposes the JSON object of the event to the script, the changes are made right in the event.
+type object struct {
+	p    *Plugin
+	node *insaneJSON.Node
+}
+
+func (o *object) Get(key string) goja.Value {
+	node := o.node.Dig(key)
+	if node == nil {
+		return nil
+	}
+	return o.p.toValue(node)
+}
+
+func (o *object) Set(key string, val goja.Value) bool {
+	if goja.IsUndefined(val) {
+		o.node.Dig(key).Suicide()
+		return true
+	}
+
+	// the value is encoded before the node is changed since it may be the part of the node
+	data, isJSON := o.p.encode(val)
+	if data == "" {
+		return false
+	}
+	o.p.mutate(o.node.AddFieldNoAlloc(o.p.root, key), val, data, isJSON)
+	return true
+}
+
+func (o *object) Has(key string) bool {
+	return o.node.Dig(key) != nil
+}
+
+func (o *object) Delete(key string) bool {
+	o.node.Dig(key).Suicide()
+	return true
+}
+
+func (o *object) Keys() []string {
+	fields := o.node.AsFields()
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, strings.Clone(field.AsString()))
+	}
+	return keys
+}
+
+// array exposes the JSON array of the event to the script, the changes are made right in the event.
+type array struct {
+	p    *Plugin
+	node *insaneJSON.Node
+}
+
+func (a *array) Len() int {
+	return len(a.node.AsArray())
+}
+
+func (a *array) Get(idx int) goja.Value {
+	elements := a.node.AsArray()
+	if idx < 0 || idx >= len(elements) {
+		return nil
+	}
+	return a.p.toValue(elements[idx])
+}
+
+func (a *array) Set(idx int, val goja.Value) bool {
+	if idx < 0 {
+		return false
+	}
+
+	data, isJSON := a.p.encode(val)
+	if data == "" {
+		data, isJSON = "null", true
+	}
+	if idx >= a.Len() {
+		a.SetLen(idx + 1)
+	}
+	a.p.mutate(a.node.AsArray()[idx], val, data, isJSON)
+	return true
+}
+
+func (a *array) SetLen(n int) bool {
+	if n < 0 {
+		return false
+	}
+
+	elements := a.node.AsArray()
+	for i := len(elements) - 1; i >= n; i-- {
+		elements[i].Suicide()
+	}
+	for i := len(elements); i < n; i++ {
+		a.node.AddElementNoAlloc(a.p.root).MutateToNull()
+	}
+	return true
+}
+
+// toValue converts the JSON node to the script value, the strings are copied
+// since the script may keep them after the event is released.
+func (p *Plugin) toValue(node *insaneJSON.Node) goja.Value {
+	switch {
+	case node.IsNull():
+		return goja.Null()
+	case node.IsString():
+		return p.vm.ToValue(strings.Clone(node.AsString()))
+	case node.IsNumber():
+		return p.vm.ToValue(node.AsFloat())
+	case node.IsTrue():
+		return p.vm.ToValue(true)
+	case node.IsFalse():
+		return p.vm.ToValue(false)
+	case node.IsArray():
+		return p.vm.NewDynamicArray(&array{p: p, node: node})
+	case node.IsObject():
+		return p.vm.NewDynamicObject(&object{p: p, node: node})
+	default:
+		return p.vm.ToValue(strings.Clone(node.AsString()))
+	}
+}
+
+// encode returns the JSON of the objects and the string representation of the other values,
+// it returns the empty string if the value can't be encoded, e.g. it's a function.
+func (p *Plugin) encode(val goja.Value) (string, bool) {
+	if val == nil || goja.IsNull(val) || goja.IsUndefined(val) {
+		return "null", true
+	}
+	if _, isObject := val.(*goja.Object); !isObject {
+		return val.String(), false
+	}
+	if _, isFunc := goja.AssertFunction(val); isFunc {
+		return "", false
+	}
+
+	data, err := p.stringify(goja.Undefined(), val)
+	if err != nil || goja.IsUndefined(data) {
+		return "", false
+	}
+	return data.String(), true
+}
+
+// mutate sets the node to the value encoded by encode.
+func (p *Plugin) mutate(node *insaneJSON.Node, val goja.Value, data string, isJSON bool) {
+	if isJSON {
+		node.MutateToJSON(p.root, data)
+		return
+	}
+
+	switch v := val.Export().(type) {
+	case bool:
+		node.MutateToBool(v)
+	case int64:
+		node.MutateToInt64(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			node.MutateToNull()
+			return
+		}
+		node.MutateToFloat(v)
+	default:
+		node.MutateToString(data)
+	}
+}
@@ -0,0 +1,70 @@
+package js
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/ozontech/file.d/pipeline"
+)
+
+// maxCachedRegexps limits the cache of the compiled regexps, the scripts usually use the constant patterns.
+const maxCachedRegexps = 256
+
+// parseTime parses the value with the layout and returns the unix time in milliseconds or null if it can't be parsed.
+// The layout is the name of the predefined format, e.g. `rfc3339`, or the go time layout.
+func (p *Plugin) parseTime(value string, layout string) goja.Value {
+	t, err := time.Parse(timeLayout(layout), value)
+	if err != nil {
+		return goja.Null()
+	}
+	return p.vm.ToValue(t.UnixMilli())
+}
+
+// formatTime formats the unix time in milliseconds with the layout in UTC.
+func (p *Plugin) formatTime(ms int64, layout string) string {
+	return time.UnixMilli(ms).UTC().Format(timeLayout(layout))
+}
+
+func timeLayout(layout string) string {
+	if format, err := pipeline.ParseFormatName(layout); err == nil {
+		return format
+	}
+	return layout
+}
+
+// regexMatch returns the match of the RE2 pattern and its groups or null if the value doesn't match.
+func (p *Plugin) regexMatch(pattern string, value string) goja.Value {
+	re := p.regexp(pattern)
+	match := re.FindStringSubmatch(value)
+	if match == nil {
+		return goja.Null()
+	}
+
+	values := make([]any, len(match))
+	for i, s := range match {
+		values[i] = s
+	}
+	return p.vm.NewArray(values...)
+}
+
+// regexReplace replaces the matches of the RE2 pattern, the replacement may refer the groups as `$1` or `${name}`.
+func (p *Plugin) regexReplace(pattern string, value string, replacement string) string {
+	return p.regexp(pattern).ReplaceAllString(value, replacement)
+}
+
+// regexp returns the compiled pattern, it throws the error to the script if the pattern is invalid.
+func (p *Plugin) regexp(pattern string) *regexp.Regexp {
+	if re, has := p.regexps[pattern]; has {
+		return re
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		panic(p.vm.NewGoError(err))
+	}
+	if len(p.regexps) < maxCachedRegexps {
+		p.regexps[pattern] = re
+	}
+	return re
+}
@@ -0,0 +1,283 @@
+package js
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It processes the events with the JavaScript (ECMAScript 5.1 and most of ES6) script
+run by the embedded [goja](https://github.com/dop251/goja) interpreter.
+
+The script is compiled once per pipeline, every processor runs it in its own interpreter.
+The script must define the global `function` which is called for every event with the event object.
+The event object is mutable, the changes of its fields are made right in the event.
+The event is discarded if the function returns `false`.
+The event object and its nested objects and arrays must not be used after the function returns.
+
+The helpers available to the script:
+* `parseTime(value, layout)` returns the unix time in milliseconds or `null` if the value can't be parsed,
+the `layout` is the name of the predefined format, e.g. `rfc3339`, or the go time layout
+* `formatTime(ms, layout)` formats the unix time in milliseconds in UTC
+* `regexMatch(pattern, value)` returns the array of the match and its groups or `null` if the value doesn't match,
+the `pattern` is the [RE2](https://github.com/google/re2/wiki/Syntax) regexp which is compiled once
+* `regexReplace(pattern, value, replacement)` replaces the matches, the groups are referred as `$1` or `${name}`
+
+The execution of the function is limited by `timeout` for every event.
+If the function fails or exceeds the limit, the error is logged and the event is passed further
+with the changes made before the failure.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: js
+      script: |
+        function process(event) {
+          if (event.level === "debug") {
+            return false;
+          }
+          event.ts = parseTime(event.time, "rfc3339");
+          var m = regexMatch("user=(\\w+)", event.message);
+          if (m !== null) {
+            event.user = { name: m[1] };
+          }
+          delete event.time;
+        }
+    ...
+```
+}*/
+
+var errTimeoutExceeded = errors.New("timeout is exceeded")
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+
+	vm        *goja.Runtime
+	process   goja.Callable
+	stringify goja.Callable
+	root      *insaneJSON.Root
+	regexps   map[string]*regexp.Regexp
+
+	timerMu  sync.Mutex
+	timer    *time.Timer
+	deadline time.Time
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The JavaScript script, either `script` or `script_file` must be set.
+	Script string `json:"script"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The path to the file with the JavaScript script.
+	ScriptFile string `json:"script_file"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The name of the global function which is called for every event.
+	Function string `json:"function" default:"process"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The maximum time of the function execution for the event, `0` disables the limit.
+	Timeout  cfg.Duration `json:"timeout" default:"100ms" parse:"duration"` // *
+	Timeout_ time.Duration
+}
+
+var (
+	programsMu = &sync.Mutex{}
+	// programs are the compiled scripts which are shared by the processors of the action.
+	programs = make(map[*Config]*programRef)
+)
+
+type programRef struct {
+	program *goja.Program
+	refs    int
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "js",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.regexps = make(map[string]*regexp.Regexp)
+
+	program, err := compile(p.config)
+	if err != nil {
+		p.logger.Fatalf("can't compile js script: %s", err.Error())
+	}
+
+	p.vm = goja.New()
+	p.timer = time.AfterFunc(time.Hour, p.interrupt)
+	p.timer.Stop()
+
+	for name, fn := range map[string]any{
+		"parseTime":    p.parseTime,
+		"formatTime":   p.formatTime,
+		"regexMatch":   p.regexMatch,
+		"regexReplace": p.regexReplace,
+	} {
+		if err := p.vm.Set(name, fn); err != nil {
+			p.logger.Fatalf("can't set js helper %s: %s", name, err.Error())
+		}
+	}
+
+	var ok bool
+	p.stringify, ok = goja.AssertFunction(p.vm.Get("JSON").ToObject(p.vm).Get("stringify"))
+	if !ok {
+		p.logger.Fatalf("can't find JSON.stringify")
+	}
+
+	// the top level of the script defines the functions, it's run once with the same limit
+	p.startTimer()
+	_, err = p.vm.RunProgram(program)
+	p.stopTimer()
+	if err != nil {
+		p.logger.Fatalf("can't run js script: %s", err.Error())
+	}
+
+	p.process, ok = goja.AssertFunction(p.vm.Get(p.config.Function))
+	if !ok {
+		p.logger.Fatalf("js script doesn't define function %q", p.config.Function)
+	}
+}
+
+// compile compiles the script once for all the processors of the action.
+func compile(config *Config) (*goja.Program, error) {
+	programsMu.Lock()
+	defer programsMu.Unlock()
+
+	if ref, has := programs[config]; has {
+		ref.refs++
+		return ref.program, nil
+	}
+
+	name, script := "<script>", config.Script
+	switch {
+	case config.Script != "" && config.ScriptFile != "":
+		return nil, errors.New("script and script_file can't be set both")
+	case config.ScriptFile != "":
+		data, err := os.ReadFile(config.ScriptFile)
+		if err != nil {
+			return nil, err
+		}
+		name, script = config.ScriptFile, string(data)
+	case config.Script == "":
+		return nil, errors.New("script or script_file must be set")
+	}
+
+	program, err := goja.Compile(name, script, false)
+	if err != nil {
+		return nil, err
+	}
+
+	programs[config] = &programRef{program: program, refs: 1}
+	return program, nil
+}
+
+// release removes the compiled script once the last processor of the action is stopped.
+func release(config *Config) {
+	programsMu.Lock()
+	defer programsMu.Unlock()
+
+	ref := programs[config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(programs, config)
+	}
+}
+
+func (p *Plugin) Stop() {
+	p.timer.Stop()
+	release(p.config)
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("js_errors_total", "Number of failed or interrupted js script runs")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	p.root = event.Root
+	eventObject := p.vm.NewDynamicObject(&object{p: p, node: event.Root.Node})
+
+	p.startTimer()
+	result, err := p.process(goja.Undefined(), eventObject)
+	p.stopTimer()
+	p.root = nil
+
+	if err != nil {
+		p.errorsMetric.WithLabelValues().Inc()
+		p.logger.Errorf("js script failed: %s", err.Error())
+		return pipeline.ActionPass
+	}
+
+	if result != nil && result.Export() == false {
+		return pipeline.ActionDiscard
+	}
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) startTimer() {
+	if p.config.Timeout_ <= 0 {
+		return
+	}
+
+	p.timerMu.Lock()
+	p.deadline = time.Now().Add(p.config.Timeout_)
+	p.timerMu.Unlock()
+	p.timer.Reset(p.config.Timeout_)
+}
+
+// stopTimer stops the timer, the script can't be interrupted once it returns.
+func (p *Plugin) stopTimer() {
+	if p.config.Timeout_ <= 0 {
+		return
+	}
+
+	p.timer.Stop()
+	p.timerMu.Lock()
+	p.deadline = time.Time{}
+	p.timerMu.Unlock()
+	p.vm.ClearInterrupt()
+}
+
+// interrupt is called by the timer, it skips the late calls of the timer started for the previous events.
+func (p *Plugin) interrupt() {
+	p.timerMu.Lock()
+	defer p.timerMu.Unlock()
+
+	if !p.deadline.IsZero() && !time.Now().Before(p.deadline) {
+		p.vm.Interrupt(errTimeoutExceeded)
+	}
+}
@@ -0,0 +1,136 @@
+package js
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJS(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		in     string
+		out    string
+		result pipeline.ActionResult
+	}{
+		{
+			name:   "fields",
+			script: `function process(e) { e.level = e.level.toUpperCase(); e.size *= 2; e.ok = true; e.none = null; }`,
+			in:     `{"level":"info","size":1.5}`,
+			out:    `{"level":"INFO","size":3,"ok":true,"none":null}`,
+		},
+		{
+			name:   "nested",
+			script: `function process(e) { e.k8s.labels = {app: e.app, tags: ["a", 1]}; e.k8s.pod += "-x"; e.copy = e.k8s; }`,
+			in:     `{"app":"payments","k8s":{"pod":"p-1"}}`,
+			out:    `{"app":"payments","k8s":{"pod":"p-1-x","labels":{"app":"payments","tags":["a",1]}},"copy":{"pod":"p-1-x","labels":{"app":"payments","tags":["a",1]}}}`,
+		},
+		{
+			name:   "arrays",
+			script: `function process(e) { e.items.push(3); e.items[0] = "x"; e.items[5] = true; e.count = e.items.length; e.tags.length = 1; }`,
+			in:     `{"items":[1,2],"tags":["a","b"]}`,
+			out:    `{"items":["x",2,3,null,null,true],"tags":["a"],"count":6}`,
+		},
+		{
+			name:   "delete",
+			script: `function process(e) { delete e.debug; delete e.missing; delete e.req.body; e.keys = Object.keys(e.req).join(","); }`,
+			in:     `{"debug":"x","req":{"body":"y","id":1,"ip":"::1"}}`,
+			out:    `{"req":{"ip":"::1","id":1},"keys":"ip,id"}`,
+		},
+		{
+			name:   "discard",
+			script: `function process(e) { return e.level !== "debug"; }`,
+			in:     `{"level":"debug"}`,
+			result: pipeline.ActionDiscard,
+		},
+		{
+			name:   "error",
+			script: `function process(e) { e.a = 1; throw new Error("boom"); }`,
+			in:     `{}`,
+			out:    `{"a":1}`,
+		},
+		{
+			name: "time",
+			script: `function process(e) {
+				e.ts = parseTime(e.time, "rfc3339");
+				e.bad = parseTime("x", "rfc3339");
+				e.formatted = formatTime(e.ts, "2006-01-02 15:04:05");
+			}`,
+			in:  `{"time":"2023-05-01T10:20:30+03:00"}`,
+			out: `{"time":"2023-05-01T10:20:30+03:00","ts":1682925630000,"bad":null,"formatted":"2023-05-01 07:20:30"}`,
+		},
+		{
+			name: "regex",
+			script: `function process(e) {
+				var m = regexMatch("user=(\\w+)", e.message);
+				e.user = m[1];
+				e.none = regexMatch("id=(\\d+)", e.message);
+				e.masked = regexReplace("token=\\w+", e.message, "token=***");
+			}`,
+			in:  `{"message":"user=bob token=abc"}`,
+			out: `{"message":"user=bob token=abc","user":"bob","none":null,"masked":"user=bob token=***"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{Script: tc.script}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+		})
+	}
+}
+
+func TestJSTimeout(t *testing.T) {
+	config := test.NewConfig(&Config{
+		Script:  `function process(e) { if (e.loop) { for (;;) {} } e.ok = true; }`,
+		Timeout: "20ms",
+	}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(4)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"loop":true}`))
+	input.In(0, "test.log", 0, []byte(`{}`))
+	input.In(0, "test.log", 0, []byte(`{}`))
+	input.In(0, "test.log", 0, []byte(`{}`))
+
+	wg.Wait()
+	p.Stop()
+
+	// the interpreter is usable after the interruption
+	assert.Equal(t, []string{`{"loop":true}`, `{"ok":true}`, `{"ok":true}`, `{"ok":true}`}, outEvents)
+}
@@ -1,17 +1,50 @@
 package json_decode
 
 import (
+	"errors"
+
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
 )
 
 /*{ introduction
-It decodes a JSON string from the event field and merges the result with the event root.
-If the decoded JSON isn't an object, the event will be skipped.
+It decodes a JSON string from the event field and merges the result with the event root or puts it into the `target` field.
+If the decoded JSON isn't an object and the `target` isn't set, the decoding fails.
+
+The source field is removed only if the decoding succeeds. If it fails, the event is passed unchanged,
+discarded or tagged with the error in the `error_field` according to `on_error`.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: json_decode
+      field: log
+      target: payload
+      max_depth: 10
+      on_error: tag
+    ...
+```
+It transforms `{"log":"{\"a\":1}"}` into `{"payload":{"a":1}}`
+and `{"log":"{\"a\":"}` into `{"log":"{\"a\":","json_decode_error":"..."}`.
 }*/
 
+const (
+	onErrorKeep    = "keep"
+	onErrorDiscard = "discard"
+	onErrorTag     = "tag"
+)
+
+var (
+	errNotObject = errors.New("decoded JSON isn't an object")
+	errTooDeep   = errors.New("decoded JSON exceeds max depth")
+)
+
 type Plugin struct {
 	config *Config
 	plugin.NoMetricsPlugin
@@ -30,6 +63,37 @@ type Config struct {
 	// >
 	// > A prefix to add to decoded object keys.
 	Prefix string `json:"prefix" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the decoded JSON into, the decoded object is merged with the event root if it's empty.
+	// > The decoded object is merged with the existing object of the field.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The max nesting depth of the decoded JSON, e.g. `{"a":{"b":1}}` has the depth 2. It isn't limited if it's zero.
+	MaxDepth int `json:"max_depth"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the source field is kept after the successful decoding.
+	KeepOrigin bool `json:"keep_origin"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the decoding fails:
+	// > * `keep` passes the event unchanged
+	// > * `discard` discards the event
+	// > * `tag` adds the error to the `error_field`
+	OnError string `json:"on_error" default:"keep" options:"keep|discard|tag"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to add the decoding error to if `on_error` is `tag`.
+	ErrorField  cfg.FieldSelector `json:"error_field" default:"json_decode_error" parse:"selector"` // *
+	ErrorField_ []string
 }
 
 func init() {
@@ -56,18 +120,22 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 		return pipeline.ActionPass
 	}
 
-	node, err := event.SubparseJSON(jsonNode.AsBytes())
+	node, err := p.decode(event, jsonNode)
 	if err != nil {
+		switch p.config.OnError {
+		case onErrorDiscard:
+			return pipeline.ActionDiscard
+		case onErrorTag:
+			pipeline.AddField(event.Root, p.config.ErrorField_).MutateToString(err.Error())
+		}
 		return pipeline.ActionPass
 	}
 
-	if !node.IsObject() {
-		return pipeline.ActionPass
+	if !p.config.KeepOrigin {
+		jsonNode.Suicide()
 	}
 
-	jsonNode.Suicide()
-
-	if p.config.Prefix != "" {
+	if p.config.Prefix != "" && node.IsObject() {
 		fields := node.AsFields()
 		for _, field := range fields {
 			l := len(event.Buf)
@@ -77,8 +145,61 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 		}
 	}
 
-	// place decoded object under root
-	event.Root.MergeWith(node)
+	if len(p.config.Target_) == 0 {
+		// place decoded object under root
+		event.Root.MergeWith(node)
+		return pipeline.ActionPass
+	}
+
+	target := pipeline.AddField(event.Root, p.config.Target_)
+	if target.IsObject() && node.IsObject() {
+		target.MergeWith(node)
+	} else {
+		target.MutateToNode(node)
+	}
 
 	return pipeline.ActionPass
 }
+
+func (p *Plugin) decode(event *pipeline.Event, jsonNode *insaneJSON.Node) (*insaneJSON.Node, error) {
+	node, err := event.SubparseJSON(jsonNode.AsBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if !node.IsObject() && len(p.config.Target_) == 0 {
+		return nil, errNotObject
+	}
+
+	if p.config.MaxDepth > 0 && exceedsDepth(node, p.config.MaxDepth) {
+		return nil, errTooDeep
+	}
+
+	return node, nil
+}
+
+// exceedsDepth checks if the nesting depth of the objects and the arrays of the node is greater than the max depth.
+func exceedsDepth(node *insaneJSON.Node, maxDepth int) bool {
+	var children []*insaneJSON.Node
+	switch {
+	case node.IsObject():
+		children = node.AsFields()
+	case node.IsArray():
+		children = node.AsArray()
+	default:
+		return false
+	}
+
+	if maxDepth == 0 {
+		return true
+	}
+	for _, child := range children {
+		if node.IsObject() {
+			child = child.AsFieldValue()
+		}
+		if exceedsDepth(child, maxDepth-1) {
+			return true
+		}
+	}
+	return false
+}
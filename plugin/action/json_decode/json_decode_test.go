@@ -42,3 +42,93 @@ func TestDecode(t *testing.T) {
 	assert.Equal(t, 1, len(outEvents), "wrong out events count")
 	assert.Equal(t, `{"prefix.field2":"value2","prefix.field3":"value3"}`, outEvents[0].Root.EncodeToString(), "wrong out event")
 }
+
+func TestDecodePolicies(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+		result pipeline.ActionResult
+	}{
+		{
+			name:   "target",
+			config: &Config{Field: "log", Target: "payload.decoded"},
+			in:     `{"log":"{\"a\":1,\"b\":[1,2]}","payload":{"id":1}}`,
+			out:    `{"payload":{"id":1,"decoded":{"a":1,"b":[1,2]}}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "target array",
+			config: &Config{Field: "log", Target: "log", Prefix: "p_"},
+			in:     `{"log":"[1,{\"a\":2}]"}`,
+			out:    `{"log":[1,{"a":2}]}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "keep origin",
+			config: &Config{Field: "log", KeepOrigin: true},
+			in:     `{"log":"{\"a\":1}"}`,
+			out:    `{"log":"{\"a\":1}","a":1}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "invalid keep",
+			config: &Config{Field: "log"},
+			in:     `{"log":"{\"a\":"}`,
+			out:    `{"log":"{\"a\":"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "not object discard",
+			config: &Config{Field: "log", OnError: "discard"},
+			in:     `{"log":"[1,2]"}`,
+			result: pipeline.ActionDiscard,
+		},
+		{
+			name:   "max depth tag",
+			config: &Config{Field: "log", MaxDepth: 2, OnError: "tag", ErrorField: "meta.error"},
+			in:     `{"log":"{\"a\":{\"b\":{\"c\":1}}}"}`,
+			out:    `{"log":"{\"a\":{\"b\":{\"c\":1}}}","meta":{"error":"decoded JSON exceeds max depth"}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "max depth",
+			config: &Config{Field: "log", MaxDepth: 2},
+			in:     `{"log":"{\"a\":{\"b\":1},\"c\":[1]}"}`,
+			out:    `{"a":{"b":1},"c":[1]}`,
+			result: pipeline.ActionPass,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+		})
+	}
+}
@@ -1,18 +1,42 @@
 package keep_fields
 
 import (
+	"strconv"
+
+	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
 )
 
 /*{ introduction
 It keeps the list of the event fields and removes others.
+
+The fields are the selectors like `request.headers.host`, the dots in the field names are escaped
+like `k8s_label_app\.kubernetes\.io`. The `*` matches any field of the object or any element of the array,
+e.g. `kubernetes.labels.*` keeps all the labels. The objects on the path to the kept fields are kept with only these fields.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: keep_fields
+      fields: [message, kubernetes.labels.*, items.*.id]
+    ...
+```
+It transforms `{"message":"hi","kubernetes":{"labels":{"app":"a"},"pod":"p"},"items":[{"id":1,"secret":"x"}],"level":"info"}`
+into `{"message":"hi","kubernetes":{"labels":{"app":"a"}},"items":[{"id":1}]}`.
 }*/
 
 type Plugin struct {
-	config    *Config
-	fieldsBuf []string
+	config *Config
+	fields [][]string
+	// matched is the stack of the indexes of the fields matching the path of the node
+	matched []int
 	plugin.NoMetricsPlugin
 }
 
@@ -21,7 +45,7 @@ type Plugin struct {
 type Config struct {
 	// > @3@4@5@6
 	// >
-	// > The list of the fields to keep.
+	// > The list of the field selectors to keep, `*` matches any field.
 	Fields []string `json:"fields"` // *
 }
 
@@ -38,35 +62,75 @@ func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 
 func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
 	p.config = config.(*Config)
+
+	for _, field := range p.config.Fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			logger.Panicf("empty field in fields")
+		}
+		p.fields = append(p.fields, path)
+	}
 }
 
 func (p *Plugin) Stop() {
 }
 
 func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
-	p.fieldsBuf = p.fieldsBuf[:0]
-
 	if !event.Root.IsObject() {
 		return pipeline.ActionPass
 	}
 
-	for _, node := range event.Root.AsFields() {
-		eventField := node.AsString()
-		isInList := false
-		for _, pluginField := range p.config.Fields {
-			if pluginField == eventField {
-				isInList = true
+	p.matched = p.matched[:0]
+	for i := range p.fields {
+		p.matched = append(p.matched, i)
+	}
+	p.keep(event.Root.Node, 0, 0)
+
+	return pipeline.ActionPass
+}
+
+// keep removes the fields or the elements of the node which don't match the fields p.matched[start:] at the depth.
+// The node is iterated backwards since the removal moves the last field to the place of the removed one.
+func (p *Plugin) keep(node *insaneJSON.Node, start int, depth int) {
+	var fields []*insaneJSON.Node
+	if node.IsObject() {
+		fields = node.AsFields()
+	} else {
+		fields = node.AsArray()
+	}
+	end := len(p.matched)
+
+	for i := len(fields) - 1; i >= 0; i-- {
+		var name string
+		var value *insaneJSON.Node
+		if node.IsObject() {
+			name = fields[i].AsString()
+			value = fields[i].AsFieldValue()
+		} else {
+			name = strconv.Itoa(i)
+			value = fields[i]
+		}
+
+		whole := false
+		for _, index := range p.matched[start:end] {
+			path := p.fields[index]
+			if path[depth] != name && path[depth] != "*" {
+				continue
+			}
+			if len(path) == depth+1 {
+				whole = true
 				break
 			}
+			p.matched = append(p.matched, index)
 		}
-		if !isInList {
-			p.fieldsBuf = append(p.fieldsBuf, eventField)
-		}
-	}
 
-	for _, field := range p.fieldsBuf {
-		event.Root.Dig(field).Suicide()
+		nested := len(p.matched) > end
+		if nested && !whole && (value.IsObject() || value.IsArray()) {
+			p.keep(value, end, depth+1)
+		} else if !whole {
+			// the removed node is dug to actualize its index since the removal of its fields breaks it
+			node.Dig(name).Suicide()
+		}
+		p.matched = p.matched[:end]
 	}
-
-	return pipeline.ActionPass
 }
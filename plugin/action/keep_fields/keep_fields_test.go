@@ -33,3 +33,42 @@ func TestKeepFields(t *testing.T) {
 	assert.Equal(t, `{"field_2":"value_2"}`, outEvents[1].Root.EncodeToString(), "wrong event")
 	assert.Equal(t, `{}`, outEvents[2].Root.EncodeToString(), "wrong event")
 }
+
+func TestKeepNestedFields(t *testing.T) {
+	in := `{"message":"hi","kubernetes":{"labels":{"app":"a","team":"b"},"pod":"p"},"items":[{"id":1,"secret":"x"},{"id":2},"s"],"level":"info","a.b":1}`
+	cases := []struct {
+		fields []string
+		out    string
+	}{
+		{
+			fields: []string{"message", "kubernetes.labels.*", "items.*.id"},
+			out:    `{"message":"hi","kubernetes":{"labels":{"app":"a","team":"b"}},"items":[{"id":1},{"id":2}]}`,
+		},
+		{
+			fields: []string{"kubernetes.labels.team", "items.1", `a\.b`, "message.x"},
+			out:    `{"a.b":1,"kubernetes":{"labels":{"team":"b"}},"items":[{"id":2}]}`,
+		},
+		{
+			fields: []string{"*.pod", "*"},
+			out:    in,
+		},
+	}
+	for _, tc := range cases {
+		p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, &Config{Fields: tc.fields}, pipeline.MatchModeAnd, nil, false))
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		outEvent := ""
+		output.SetOutFn(func(e *pipeline.Event) {
+			outEvent = e.Root.EncodeToString()
+			wg.Done()
+		})
+
+		input.In(0, "test.log", 0, []byte(in))
+
+		wg.Wait()
+		p.Stop()
+
+		assert.Equal(t, tc.out, outEvent, tc.fields)
+	}
+}
@@ -0,0 +1,70 @@
+package lua
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	errInstructionsExceeded = errors.New("instructions limit is exceeded")
+	errTimeoutExceeded      = errors.New("timeout is exceeded")
+
+	closedCh = func() chan struct{} {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}()
+)
+
+// timeCheckInterval is how many instructions are executed between the checks of the time.
+const timeCheckInterval = 1024
+
+// budget limits the execution of the script for a single event.
+// It's a context of the Lua state, the state checks the context before every instruction,
+// so the instructions are counted without the timers and the goroutines.
+type budget struct {
+	maxInstructions int
+	timeout         time.Duration
+
+	instructions int
+	deadline     time.Time
+	err          error
+}
+
+// reset starts the budget of the next event.
+func (b *budget) reset(now time.Time) {
+	b.instructions = 0
+	b.deadline = now.Add(b.timeout)
+	b.err = nil
+}
+
+func (b *budget) Deadline() (time.Time, bool) {
+	return b.deadline, b.timeout > 0
+}
+
+func (b *budget) Done() <-chan struct{} {
+	if b.err != nil {
+		return closedCh
+	}
+
+	b.instructions++
+	if b.maxInstructions > 0 && b.instructions > b.maxInstructions {
+		b.err = errInstructionsExceeded
+		return closedCh
+	}
+	if b.timeout > 0 && b.instructions%timeCheckInterval == 0 && time.Now().After(b.deadline) {
+		b.err = errTimeoutExceeded
+		return closedCh
+	}
+
+	// the nil channel is never ready, so the instruction is executed
+	return nil
+}
+
+func (b *budget) Err() error {
+	return b.err
+}
+
+func (b *budget) Value(_ any) any {
+	return nil
+}
@@ -0,0 +1,157 @@
+package lua
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	insaneJSON "github.com/vitkovskii/insane-json"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// maxDepth limits the nesting of the tables to prevent the infinite recursion on the cyclic tables.
+const maxDepth = 64
+
+var errTooDeep = errors.New("table is nested too deep or has cycles")
+
+// toLua converts the JSON node to the Lua value, the objects and the arrays are converted to the tables.
+// The strings are copied since the script may keep them after the event is released.
+func toLua(l *glua.LState, node *insaneJSON.Node) glua.LValue {
+	switch {
+	case node == nil || node.IsNull():
+		return glua.LNil
+	case node.IsString():
+		return glua.LString(strings.Clone(node.AsString()))
+	case node.IsNumber():
+		return glua.LNumber(node.AsFloat())
+	case node.IsTrue():
+		return glua.LTrue
+	case node.IsFalse():
+		return glua.LFalse
+	case node.IsArray():
+		elements := node.AsArray()
+		table := l.CreateTable(len(elements), 0)
+		for _, element := range elements {
+			table.Append(toLua(l, element))
+		}
+		return table
+	case node.IsObject():
+		fields := node.AsFields()
+		table := l.CreateTable(0, len(fields))
+		for _, field := range fields {
+			table.RawSetString(strings.Clone(field.AsString()), toLua(l, field.AsFieldValue()))
+		}
+		return table
+	default:
+		return glua.LString(strings.Clone(node.AsString()))
+	}
+}
+
+// appendJSON appends the Lua value encoded as JSON.
+// The tables with the sequence of the elements from 1 are arrays, the other tables are objects with sorted fields.
+func appendJSON(buf []byte, value glua.LValue, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return buf, errTooDeep
+	}
+
+	switch v := value.(type) {
+	case *glua.LNilType:
+		return append(buf, "null"...), nil
+	case glua.LBool:
+		return strconv.AppendBool(buf, bool(v)), nil
+	case glua.LNumber:
+		return appendNumber(buf, float64(v)), nil
+	case glua.LString:
+		return appendString(buf, string(v)), nil
+	case *glua.LTable:
+		return appendTable(buf, v, depth)
+	default:
+		return appendString(buf, value.String()), nil
+	}
+}
+
+func appendTable(buf []byte, table *glua.LTable, depth int) ([]byte, error) {
+	var err error
+	n := table.MaxN()
+	if n > 0 && n == countKeys(table) {
+		buf = append(buf, '[')
+		for i := 1; i <= n; i++ {
+			if i > 1 {
+				buf = append(buf, ',')
+			}
+			if buf, err = appendJSON(buf, table.RawGetInt(i), depth+1); err != nil {
+				return buf, err
+			}
+		}
+		return append(buf, ']'), nil
+	}
+
+	keys := make([]string, 0)
+	table.ForEach(func(key glua.LValue, _ glua.LValue) {
+		keys = append(keys, key.String())
+	})
+	sort.Strings(keys)
+
+	buf = append(buf, '{')
+	for i, key := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendString(buf, key)
+		buf = append(buf, ':')
+		value := table.RawGetString(key)
+		if value == glua.LNil {
+			// the numeric keys of the sparse arrays
+			if num, err := strconv.ParseFloat(key, 64); err == nil {
+				value = table.RawGet(glua.LNumber(num))
+			}
+		}
+		if buf, err = appendJSON(buf, value, depth+1); err != nil {
+			return buf, err
+		}
+	}
+	return append(buf, '}'), nil
+}
+
+func countKeys(table *glua.LTable) int {
+	count := 0
+	table.ForEach(func(_ glua.LValue, _ glua.LValue) {
+		count++
+	})
+	return count
+}
+
+func appendNumber(buf []byte, v float64) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return append(buf, "null"...)
+	}
+	if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+		return strconv.AppendInt(buf, int64(v), 10)
+	}
+	return strconv.AppendFloat(buf, v, 'f', -1, 64)
+}
+
+func appendString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c == '\r':
+			buf = append(buf, '\\', 'r')
+		case c == '\t':
+			buf = append(buf, '\\', 't')
+		case c < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '"')
+}
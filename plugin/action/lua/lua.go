@@ -0,0 +1,385 @@
+package lua
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	glua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It processes the events with the [Lua 5.1](https://www.lua.org/manual/5.1/) script
+run by the embedded [gopher-lua](https://github.com/yuin/gopher-lua) interpreter.
+
+The script is compiled once per pipeline, every processor runs it in its own interpreter.
+The script must define the global `function` which is called for every event without arguments,
+the event is accessed with the global functions:
+* `get(path)` returns the value of the field, the objects and the arrays are returned as tables, `nil` if the field is missing
+* `set(path, value)` sets the field creating the missing objects of the path,
+the tables with the sequence of the elements from 1 are set as arrays, other tables are set as objects
+* `delete(path)` removes the field
+* `discard()` discards the event once the function returns
+* `spawn(table)` creates the new event from the table, it passes the following actions once the function returns,
+the event is committed once it and all spawned events are committed
+
+The `path` is a field selector, e.g. `k8s.labels.app`.
+Only the `base`, `table`, `string` and `math` libraries are available, the files can't be loaded.
+
+The execution of the function is limited by `max_instructions` and `timeout` for every event.
+If the function fails or exceeds the limits, the error is logged and the event is passed further
+with the changes made before the failure, the spawned events are dropped.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: lua
+      script: |
+        function process()
+          local status = get("status")
+          if status == nil then
+            discard()
+            return
+          end
+          set("http.is_error", status >= 500)
+          delete("debug")
+          for _, item in ipairs(get("items") or {}) do
+            spawn({item = item, request_id = get("request_id")})
+          end
+        end
+    ...
+```
+}*/
+
+var errEmptyPath = errors.New("path is empty")
+
+// maxCachedPaths limits the cache of the parsed paths, the scripts usually use the constant paths.
+const maxCachedPaths = 1024
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.SugaredLogger
+	controller pipeline.ActionPluginController
+
+	state   *glua.LState
+	process glua.LValue
+	budget  budget
+	paths   map[string][]string
+
+	event   *pipeline.Event
+	discard bool
+	// spawnBuf holds the JSON of the events to spawn, spawnEnds are their ends in it
+	spawnBuf  []byte
+	spawnEnds []int
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The Lua script, either `script` or `script_file` must be set.
+	Script string `json:"script"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The path to the file with the Lua script.
+	ScriptFile string `json:"script_file"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The name of the global function which is called for every event.
+	Function string `json:"function" default:"process"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The maximum number of the Lua instructions executed for the event, `0` disables the limit.
+	MaxInstructions int `json:"max_instructions" default:"100000"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The maximum time of the function execution for the event, `0` disables the limit.
+	// > The time is checked once per 1024 instructions, so the calls of the slow library functions may exceed it.
+	Timeout  cfg.Duration `json:"timeout" default:"100ms" parse:"duration"` // *
+	Timeout_ time.Duration
+}
+
+var (
+	protosMu = &sync.Mutex{}
+	// protos are the compiled scripts which are shared by the processors of the action.
+	protos = make(map[*Config]*protoRef)
+)
+
+type protoRef struct {
+	proto *glua.FunctionProto
+	refs  int
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "lua",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.controller = params.Controller
+	p.paths = make(map[string][]string)
+
+	proto, err := compile(p.config)
+	if err != nil {
+		p.logger.Fatalf("can't compile lua script: %s", err.Error())
+	}
+
+	p.budget = budget{maxInstructions: p.config.MaxInstructions, timeout: p.config.Timeout_}
+	p.state = p.newState()
+
+	// the top level of the script defines the functions, it's run once with the same limits
+	p.budget.reset(time.Now())
+	p.state.Push(p.state.NewFunctionFromProto(proto))
+	if err := p.state.PCall(0, 0, nil); err != nil {
+		p.logger.Fatalf("can't run lua script: %s", err.Error())
+	}
+
+	p.process = p.state.GetGlobal(p.config.Function)
+	if p.process.Type() != glua.LTFunction {
+		p.logger.Fatalf("lua script doesn't define function %q", p.config.Function)
+	}
+}
+
+// compile compiles the script once for all the processors of the action.
+func compile(config *Config) (*glua.FunctionProto, error) {
+	protosMu.Lock()
+	defer protosMu.Unlock()
+
+	if ref, has := protos[config]; has {
+		ref.refs++
+		return ref.proto, nil
+	}
+
+	name, script := "<script>", config.Script
+	switch {
+	case config.Script != "" && config.ScriptFile != "":
+		return nil, errors.New("script and script_file can't be set both")
+	case config.ScriptFile != "":
+		data, err := os.ReadFile(config.ScriptFile)
+		if err != nil {
+			return nil, err
+		}
+		name, script = config.ScriptFile, string(data)
+	case config.Script == "":
+		return nil, errors.New("script or script_file must be set")
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(script), name)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := glua.Compile(chunk, name)
+	if err != nil {
+		return nil, err
+	}
+
+	protos[config] = &protoRef{proto: proto, refs: 1}
+	return proto, nil
+}
+
+// release removes the compiled script once the last processor of the action is stopped.
+func release(config *Config) {
+	protosMu.Lock()
+	defer protosMu.Unlock()
+
+	ref := protos[config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(protos, config)
+	}
+}
+
+// newState creates the interpreter without the access to the files and the os.
+func (p *Plugin) newState() *glua.LState {
+	l := glua.NewState(glua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		fn   glua.LGFunction
+	}{
+		{glua.BaseLibName, glua.OpenBase},
+		{glua.TabLibName, glua.OpenTable},
+		{glua.StringLibName, glua.OpenString},
+		{glua.MathLibName, glua.OpenMath},
+	} {
+		l.Push(l.NewFunction(lib.fn))
+		l.Push(glua.LString(lib.name))
+		l.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		l.SetGlobal(name, glua.LNil)
+	}
+
+	l.SetGlobal("get", l.NewFunction(p.luaGet))
+	l.SetGlobal("set", l.NewFunction(p.luaSet))
+	l.SetGlobal("delete", l.NewFunction(p.luaDelete))
+	l.SetGlobal("discard", l.NewFunction(p.luaDiscard))
+	l.SetGlobal("spawn", l.NewFunction(p.luaSpawn))
+
+	l.SetContext(&p.budget)
+	return l
+}
+
+func (p *Plugin) Stop() {
+	p.state.Close()
+	release(p.config)
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("lua_errors_total", "Number of failed or interrupted lua script runs")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	p.event = event
+	p.discard = false
+	p.spawnBuf = p.spawnBuf[:0]
+	p.spawnEnds = p.spawnEnds[:0]
+
+	p.budget.reset(time.Now())
+	err := p.state.CallByParam(glua.P{Fn: p.process, NRet: 0, Protect: true})
+	p.event = nil
+	if err != nil {
+		p.errorsMetric.WithLabelValues().Inc()
+		p.logger.Errorf("lua script failed: %s", err.Error())
+		return pipeline.ActionPass
+	}
+
+	start := 0
+	for _, end := range p.spawnEnds {
+		if err := p.controller.Spawn(event, p.spawnBuf[start:end]); err != nil {
+			p.logger.Errorf("can't spawn event: %s", err.Error())
+		}
+		start = end
+	}
+
+	if p.discard {
+		return pipeline.ActionDiscard
+	}
+	return pipeline.ActionPass
+}
+
+// path returns the parsed field selector.
+func (p *Plugin) path(l *glua.LState, n int) []string {
+	selector := l.CheckString(n)
+	if path, has := p.paths[selector]; has {
+		return path
+	}
+
+	path := cfg.ParseFieldSelector(selector)
+	if len(p.paths) < maxCachedPaths {
+		p.paths[selector] = path
+	}
+	return path
+}
+
+func (p *Plugin) luaGet(l *glua.LState) int {
+	l.Push(toLua(l, p.event.Root.Dig(p.path(l, 1)...)))
+	return 1
+}
+
+func (p *Plugin) luaSet(l *glua.LState) int {
+	path := p.path(l, 1)
+	if len(path) == 0 {
+		l.RaiseError(errEmptyPath.Error())
+		return 0
+	}
+	value := l.CheckAny(2)
+
+	// the existing objects of the path are kept, the missing ones and other values are replaced with objects
+	root := p.event.Root
+	parent := root.Node
+	for _, name := range path[:len(path)-1] {
+		next := parent.Dig(name)
+		if next == nil || !next.IsObject() {
+			next = parent.AddFieldNoAlloc(root, name).MutateToObject()
+		}
+		parent = next
+	}
+	node := parent.AddFieldNoAlloc(root, path[len(path)-1])
+
+	switch v := value.(type) {
+	case *glua.LNilType:
+		node.MutateToNull()
+	case glua.LBool:
+		node.MutateToBool(bool(v))
+	case glua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			node.MutateToInt(int(f))
+		} else {
+			node.MutateToFloat(f)
+		}
+	case glua.LString:
+		node.MutateToString(string(v))
+	case *glua.LTable:
+		data, err := appendJSON(nil, v, 0)
+		if err != nil {
+			l.RaiseError(err.Error())
+			return 0
+		}
+		node.MutateToJSON(root, string(data))
+	default:
+		l.ArgError(2, fmt.Sprintf("can't set value of type %s", value.Type().String()))
+	}
+	return 0
+}
+
+func (p *Plugin) luaDelete(l *glua.LState) int {
+	path := p.path(l, 1)
+	if len(path) == 0 {
+		l.RaiseError(errEmptyPath.Error())
+		return 0
+	}
+	p.event.Root.Dig(path...).Suicide()
+	return 0
+}
+
+func (p *Plugin) luaDiscard(_ *glua.LState) int {
+	p.discard = true
+	return 0
+}
+
+func (p *Plugin) luaSpawn(l *glua.LState) int {
+	table := l.CheckTable(1)
+
+	start := len(p.spawnBuf)
+	var err error
+	p.spawnBuf, err = appendJSON(p.spawnBuf, table, 0)
+	if err != nil {
+		p.spawnBuf = p.spawnBuf[:start]
+		l.RaiseError(err.Error())
+		return 0
+	}
+
+	// the events are spawned once the function returns
+	p.spawnEnds = append(p.spawnEnds, len(p.spawnBuf))
+	return 0
+}
@@ -0,0 +1,185 @@
+package lua
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLua(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		in     string
+		out    string
+		result pipeline.ActionResult
+	}{
+		{
+			name:   "get_set",
+			script: `function process() set("level", string.upper(get("level"))) set("size", get("size") * 2) end`,
+			in:     `{"level":"info","size":1.5}`,
+			out:    `{"level":"INFO","size":3}`,
+		},
+		{
+			name:   "set_nested",
+			script: `function process() set("k8s.labels.app", get("app")) set("k8s.node", nil) set("ok", true) end`,
+			in:     `{"app":"payments","k8s":{"pod":"p-1"}}`,
+			out:    `{"app":"payments","k8s":{"pod":"p-1","labels":{"app":"payments"},"node":null},"ok":true}`,
+		},
+		{
+			name:   "set_table",
+			script: `function process() local t = get("req") t.tags = {"a", "b"} t.empty = {} set("req", t) end`,
+			in:     `{"req":{"id":1}}`,
+			out:    `{"req":{"empty":{},"id":1,"tags":["a","b"]}}`,
+		},
+		{
+			name:   "delete",
+			script: `function process() delete("debug") delete("missing") delete("req.body") end`,
+			in:     `{"debug":"x","req":{"body":"y","id":1}}`,
+			out:    `{"req":{"id":1}}`,
+		},
+		{
+			name:   "discard",
+			script: `function process() if get("level") == "debug" then discard() end end`,
+			in:     `{"level":"debug"}`,
+			result: pipeline.ActionDiscard,
+		},
+		{
+			name:   "error",
+			script: `function process() set("a", 1) error("boom") end`,
+			in:     `{}`,
+			out:    `{"a":1}`,
+		},
+		{
+			name:   "files",
+			script: `function process() set("ok", io == nil and os == nil and require == nil and dofile == nil) end`,
+			in:     `{}`,
+			out:    `{"ok":true}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{Script: tc.script}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+		})
+	}
+}
+
+func TestLuaSpawn(t *testing.T) {
+	config := test.NewConfig(&Config{Script: `
+		function process()
+			for i, item in ipairs(get("items")) do
+				spawn({id = get("id"), item = item, n = i})
+			end
+			if get("fail") then
+				error("boom")
+			end
+			discard()
+		end
+	`}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"id":"r1","items":[{"sku":"x"},"y"]}`))
+	input.In(0, "test.log", 0, []byte(`{"id":"r2","items":[1,2],"fail":true}`))
+
+	wg.Wait()
+	p.Stop()
+
+	// the spawned events are passed instead of the discarded one,
+	// the events aren't spawned if the function fails
+	assert.Equal(t, []string{
+		`{"id":"r1","item":{"sku":"x"},"n":1}`,
+		`{"id":"r1","item":"y","n":2}`,
+		`{"id":"r2","items":[1,2],"fail":true}`,
+	}, outEvents)
+}
+
+func TestLuaLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		err    error
+	}{
+		{
+			name:   "instructions",
+			config: &Config{MaxInstructions: 1000, Timeout: "1m"},
+			err:    errInstructionsExceeded,
+		},
+		{
+			name:   "timeout",
+			config: &Config{MaxInstructions: 1 << 40, Timeout: "10ms"},
+			err:    errTimeoutExceeded,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Script = `function process() if get("loop") then while true do end end set("ok", true) end`
+			config := test.NewConfig(tc.config, nil)
+			var plugin *Plugin
+			pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+				plugin = &Plugin{}
+				return plugin, &Config{}
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvents := make([]string, 0)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents = append(outEvents, e.Root.EncodeToString())
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(`{"loop":true}`))
+			wg.Wait()
+			assert.Equal(t, tc.err, plugin.budget.Err())
+
+			// the limits are reset for every event
+			wg.Add(3)
+			for i := 0; i < 3; i++ {
+				input.In(0, "test.log", 0, []byte(`{}`))
+			}
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, []string{`{"loop":true}`, `{"ok":true}`, `{"ok":true}`, `{"ok":true}`}, outEvents)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"unicode/utf8"
 
+	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
@@ -31,6 +32,38 @@ pipelines:
     ...
 ```
 
+The built-in masks may be selected by `type` instead of writing the regular expressions, the matches of some of them are validated
+before masking to reduce the false positives:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: mask
+      masks:
+      - type: card
+      - type: email
+      - type: jwt
+        replace_word: "<jwt>"
+    ...
+```
+
+By default the masks are applied to all the values of the event. To prevent the false positives, e.g. in the IDs,
+and to save CPU on the wide events, the masking may be restricted to `fields` and their nested values:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: mask
+      fields: [message, request.body]
+      ignore_fields: [request.body.trace_id]
+      masks:
+      - re: '\b\d{16}\b'
+        groups: [0]
+    ...
+```
+
 }*/
 
 const (
@@ -42,7 +75,11 @@ type Plugin struct {
 	sourceBuf  []byte
 	maskBuf    []byte
 	valueNodes []*insaneJSON.Node
-	logger     *zap.SugaredLogger
+	fields     [][]string
+	ignored    [][]string
+	// ignoredNodes are the nodes of the ignored fields of the current event.
+	ignoredNodes []*insaneJSON.Node
+	logger       *zap.SugaredLogger
 
 	//  plugin metrics
 
@@ -57,6 +94,17 @@ type Config struct {
 	// > List of masks.
 	Masks []Mask `json:"masks"` // *
 
+	// > @3@4@5@6
+	// >
+	// > The list of the field selectors to mask, the nested values of the fields are masked too.
+	// > All the values of the event are masked if it's empty.
+	Fields []string `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The list of the field selectors not to mask, the nested values of the fields aren't masked too.
+	IgnoreFields []string `json:"ignore_fields" slice:"true"` // *
+
 	// > @3@4@5@6
 	// >
 	// > If any mask has been applied then `mask_applied_field` will be set to `mask_applied_value` in the event.
@@ -70,14 +118,26 @@ type Config struct {
 type Mask struct {
 	// > @3@4@5@6
 	// >
-	// > Regular expression for masking.
-	Re  string `json:"re" default:"" required:"true"` // *
+	// > The built-in mask to use instead of `re`:
+	// > * `card` – the card numbers, the matches are masked only if they pass the Luhn check
+	// > * `email` – the emails
+	// > * `phone` – the phone numbers like `+7 (999) 123-45-67`
+	// > * `iban` – the IBANs, the matches are masked only if they pass the MOD 97-10 check
+	// > * `jwt` – the JSON web tokens
+	// > * `ip` – the IPv4 and IPv6 addresses
+	Type string `json:"type" default:"" options:"|card|email|phone|iban|jwt|ip"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Regular expression for masking. Required if `type` isn't set.
+	Re  string `json:"re" default:""` // *
 	Re_ *regexp.Regexp
 
 	// > @3@4@5@6
 	// >
 	// > Groups are numbers of masking groups in expression, zero for mask all expression.
-	Groups []int `json:"groups" required:"true"` // *
+	// > Required if `type` isn't set, the whole match is masked for `type` by default.
+	Groups []int `json:"groups"` // *
 
 	// > @3@4@5@6
 	// >
@@ -88,6 +148,9 @@ type Mask struct {
 	// >
 	// > ReplaceWord, if set, is used instead of asterisks for masking patterns that are of the same length or longer.
 	ReplaceWord string `json:"replace_word"` // *
+
+	// validate checks the match of the preset before masking.
+	validate func(match []byte) bool
 }
 
 func init() {
@@ -109,6 +172,12 @@ func compileMasks(masks []Mask, logger *zap.SugaredLogger) []Mask {
 }
 
 func compileMask(m Mask, logger *zap.SugaredLogger) Mask {
+	if m.Type != "" {
+		m = applyPreset(m, logger)
+	} else if m.Re == "" {
+		logger.Fatal("re or type must be set")
+	}
+
 	logger.Infof("compiling, re=%s, groups=%v", m.Re, m.Groups)
 	re, err := regexp.Compile(m.Re)
 	if err != nil {
@@ -119,6 +188,23 @@ func compileMask(m Mask, logger *zap.SugaredLogger) Mask {
 	return m
 }
 
+func applyPreset(m Mask, logger *zap.SugaredLogger) Mask {
+	preset, ok := presets[m.Type]
+	if !ok {
+		logger.Fatalf("unknown mask type=%s", m.Type)
+	}
+	if m.Re != "" {
+		logger.Fatalf("re and type can't be set both, type=%s", m.Type)
+	}
+
+	m.Re = preset.re
+	m.validate = preset.validate
+	if len(m.Groups) == 0 {
+		m.Groups = []int{0}
+	}
+	return m
+}
+
 func isGroupsUnique(groups []int) bool {
 	uniqueGrp := make(map[int]struct{}, len(groups))
 	var exists struct{}
@@ -140,6 +226,11 @@ func verifyGroupNumbers(groups []int, totalGroups int, logger *zap.SugaredLogger
 		logger.Fatalf("groups numbers must be unique, groups numbers=%v", groups)
 	}
 
+	// the whole match is masked, the expression may have no groups
+	if len(groups) == 1 && groups[0] == 0 {
+		return groups
+	}
+
 	if len(groups) > totalGroups {
 		logger.Fatalf("there are many groups, groups=%d, totalGroups=%d", len(groups), totalGroups)
 	}
@@ -166,6 +257,20 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginP
 	p.valueNodes = make([]*insaneJSON.Node, 0)
 	p.logger = params.Logger
 	p.config.Masks = compileMasks(p.config.Masks, p.logger)
+	p.fields = parseFieldSelectors(p.config.Fields, "fields", p.logger)
+	p.ignored = parseFieldSelectors(p.config.IgnoreFields, "ignore_fields", p.logger)
+}
+
+func parseFieldSelectors(selectors []string, name string, logger *zap.SugaredLogger) [][]string {
+	paths := make([][]string, 0, len(selectors))
+	for _, selector := range selectors {
+		path := cfg.ParseFieldSelector(selector)
+		if len(path) == 0 {
+			logger.Fatalf("empty field in %s", name)
+		}
+		paths = append(paths, path)
+	}
+	return paths
 }
 
 func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
@@ -205,6 +310,9 @@ func (p *Plugin) maskSection(mask *Mask, dst, src []byte, begin, end int) ([]byt
 // mask value returns masked value and bool answer was buf masked at all.
 func (p *Plugin) maskValue(mask *Mask, value, buf []byte) ([]byte, bool) {
 	indexes := mask.Re_.FindAllSubmatchIndex(value, -1)
+	if mask.validate != nil {
+		indexes = filterValid(mask, value, indexes)
+	}
 	if len(indexes) == 0 {
 		return value, false
 	}
@@ -227,17 +335,35 @@ func (p *Plugin) maskValue(mask *Mask, value, buf []byte) ([]byte, bool) {
 	return value, true
 }
 
-func getValueNodeList(currentNode *insaneJSON.Node, valueNodes []*insaneJSON.Node) []*insaneJSON.Node {
+// filterValid leaves only the matches which pass the validation of the mask.
+func filterValid(mask *Mask, value []byte, indexes [][]int) [][]int {
+	valid := indexes[:0]
+	for _, index := range indexes {
+		if mask.validate(value[index[0]:index[1]]) {
+			valid = append(valid, index)
+		}
+	}
+	return valid
+}
+
+// getValueNodeList collects the leaf values of the node skipping the ignored nodes.
+func getValueNodeList(currentNode *insaneJSON.Node, valueNodes, ignored []*insaneJSON.Node) []*insaneJSON.Node {
+	for _, n := range ignored {
+		if n == currentNode {
+			return valueNodes
+		}
+	}
+
 	switch {
 	case currentNode.IsField():
-		valueNodes = getValueNodeList(currentNode.AsFieldValue(), valueNodes)
+		valueNodes = getValueNodeList(currentNode.AsFieldValue(), valueNodes, ignored)
 	case currentNode.IsArray():
 		for _, n := range currentNode.AsArray() {
-			valueNodes = getValueNodeList(n, valueNodes)
+			valueNodes = getValueNodeList(n, valueNodes, ignored)
 		}
 	case currentNode.IsObject():
 		for _, n := range currentNode.AsFields() {
-			valueNodes = getValueNodeList(n, valueNodes)
+			valueNodes = getValueNodeList(n, valueNodes, ignored)
 		}
 	default:
 		valueNodes = append(valueNodes, currentNode)
@@ -245,6 +371,27 @@ func getValueNodeList(currentNode *insaneJSON.Node, valueNodes []*insaneJSON.Nod
 	return valueNodes
 }
 
+// collectValueNodes collects the leaf values of the fields to mask.
+func (p *Plugin) collectValueNodes(root *insaneJSON.Node) {
+	p.valueNodes = p.valueNodes[:0]
+	p.ignoredNodes = p.ignoredNodes[:0]
+	for _, path := range p.ignored {
+		if node := root.Dig(path...); node != nil {
+			p.ignoredNodes = append(p.ignoredNodes, node)
+		}
+	}
+
+	if len(p.fields) == 0 {
+		p.valueNodes = getValueNodeList(root, p.valueNodes, p.ignoredNodes)
+		return
+	}
+	for _, path := range p.fields {
+		if node := root.Dig(path...); node != nil {
+			p.valueNodes = getValueNodeList(node, p.valueNodes, p.ignoredNodes)
+		}
+	}
+}
+
 func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	root := event.Root.Node
 
@@ -252,8 +399,7 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	maskApplied := false
 	locApplied := false
 
-	p.valueNodes = p.valueNodes[:0]
-	p.valueNodes = getValueNodeList(root, p.valueNodes)
+	p.collectValueNodes(root)
 	for _, v := range p.valueNodes {
 		value := v.AsBytes()
 		p.sourceBuf = append(p.sourceBuf[:0], value...)
@@ -187,6 +187,126 @@ func TestMaskAddExtraField(t *testing.T) {
 	assert.Equal(t, expOutput, event.Root.EncodeToString())
 }
 
+func TestFields(t *testing.T) {
+	in := `{"card":"5408-7430-0756-2004","request":{"body":{"card":"5408-7430-0756-2004","id":"5408-7430-0756-2004"}},"id":"5408-7430-0756-2004"}`
+	cases := []struct {
+		name         string
+		fields       []string
+		ignoreFields []string
+		expected     string
+	}{
+		{
+			name:     "all",
+			expected: `{"card":"****-****-****-****","request":{"body":{"card":"****-****-****-****","id":"****-****-****-****"}},"id":"****-****-****-****"}`,
+		},
+		{
+			name:     "fields",
+			fields:   []string{"card", "request.body", "missing"},
+			expected: `{"card":"****-****-****-****","request":{"body":{"card":"****-****-****-****","id":"****-****-****-****"}},"id":"5408-7430-0756-2004"}`,
+		},
+		{
+			name:         "ignore fields",
+			ignoreFields: []string{"id", "request.body.id"},
+			expected:     `{"card":"****-****-****-****","request":{"body":{"card":"****-****-****-****","id":"5408-7430-0756-2004"}},"id":"5408-7430-0756-2004"}`,
+		},
+		{
+			name:         "fields and ignore fields",
+			fields:       []string{"request"},
+			ignoreFields: []string{"request.body.id"},
+			expected:     `{"card":"5408-7430-0756-2004","request":{"body":{"card":"****-****-****-****","id":"5408-7430-0756-2004"}},"id":"5408-7430-0756-2004"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{
+				Fields:       tc.fields,
+				IgnoreFields: tc.ignoreFields,
+				Masks: []Mask{
+					{Re: kDefaultCardRegExp, Groups: []int{1, 2, 3, 4}},
+				},
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.expected, outEvent)
+		})
+	}
+}
+
+func TestPresets(t *testing.T) {
+	cases := []struct {
+		maskType string
+		input    string
+		expected string
+	}{
+		{
+			maskType: "card",
+			input:    `{"m":"paid by 4111 1111 1111 1111, order 4111111111111112"}`,
+			expected: `{"m":"paid by *******************, order 4111111111111112"}`,
+		},
+		{
+			maskType: "email",
+			input:    `{"m":"sent to john.doe+1@mail.example.com"}`,
+			expected: `{"m":"sent to ***************************"}`,
+		},
+		{
+			maskType: "phone",
+			input:    `{"m":"call +7 (999) 123-45-67"}`,
+			expected: `{"m":"call ******************"}`,
+		},
+		{
+			maskType: "iban",
+			input:    `{"m":"GB82 WEST 1234 5698 7654 32 and GB82WEST12345698765433"}`,
+			expected: `{"m":"*************************** and GB82WEST12345698765433"}`,
+		},
+		{
+			maskType: "jwt",
+			input:    `{"m":"token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig_123-x"}`,
+			expected: `{"m":"token **********************************************"}`,
+		},
+		{
+			maskType: "ip",
+			input:    `{"m":"from 10.0.0.1 and fe80::1:2, version 1.2.3.400 at 12:30:45"}`,
+			expected: `{"m":"from ******** and *********, version 1.2.3.400 at 12:30:45"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.maskType, func(t *testing.T) {
+			config := &Config{
+				Masks: []Mask{{Type: tc.maskType}},
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.input))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.expected, outEvent)
+		})
+	}
+}
+
 func TestGroupNumbers(t *testing.T) {
 	suits := []struct {
 		name     string
@@ -391,7 +511,7 @@ func TestGetValueNodeList(t *testing.T) {
 			root, err := insaneJSON.DecodeString(s.input)
 			assert.NoError(t, err, "error on parsing test json")
 			nodes := make([]*insaneJSON.Node, 0)
-			nodes = getValueNodeList(root.Node, nodes)
+			nodes = getValueNodeList(root.Node, nodes, nil)
 			assert.Equal(t, len(nodes), len(s.expected), s.comment)
 			for i := range nodes {
 				assert.Equal(t, s.expected[i], nodes[i].AsString(), s.comment)
@@ -0,0 +1,99 @@
+package mask
+
+import (
+	"net"
+)
+
+const (
+	presetCard  = "card"
+	presetEmail = "email"
+	presetPhone = "phone"
+	presetIBAN  = "iban"
+	presetJWT   = "jwt"
+	presetIP    = "ip"
+)
+
+// preset is the built-in mask, the matches are masked only if they pass the validation.
+type preset struct {
+	re       string
+	validate func(match []byte) bool
+}
+
+var presets = map[string]preset{
+	presetCard: {
+		re:       `\b(?:\d[ \-]?){12,18}\d\b`,
+		validate: isLuhnValid,
+	},
+	presetEmail: {
+		re: `[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`,
+	},
+	presetPhone: {
+		re: `(?:\+\d{1,3}[ \-.]?)?(?:\(\d{3}\)|\b\d{3})[ \-.]?\d{3}[ \-.]?\d{2}[ \-.]?\d{2}\b`,
+	},
+	presetIBAN: {
+		re:       `\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`,
+		validate: isIBANValid,
+	},
+	presetJWT: {
+		re: `\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`,
+	},
+	presetIP: {
+		re:       `\b(?:\d{1,3}\.){3}\d{1,3}\b|\b[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{0,4}){2,7}`,
+		validate: isIPValid,
+	},
+}
+
+// isLuhnValid checks the card number by the Luhn algorithm, the separators are skipped.
+func isLuhnValid(match []byte) bool {
+	sum := 0
+	digits := 0
+	for i := len(match) - 1; i >= 0; i-- {
+		c := match[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// isIBANValid checks the IBAN by the ISO 13616 MOD 97-10 checksum, the spaces are skipped.
+func isIBANValid(match []byte) bool {
+	iban := make([]byte, 0, len(match))
+	for _, c := range match {
+		if c != ' ' {
+			iban = append(iban, c)
+		}
+	}
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	// the country code and the check digits are moved to the end
+	iban = append(iban[4:], iban[:4]...)
+	remainder := 0
+	for _, c := range iban {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+func isIPValid(match []byte) bool {
+	return net.ParseIP(string(match)) != nil
+}
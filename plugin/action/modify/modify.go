@@ -12,6 +12,15 @@ import (
 It modifies the content for a field. It works only with strings.
 You can provide an unlimited number of config parameters. Each parameter handled as `cfg.FieldSelector`:`cfg.Substitution`.
 
+The substituted field values may be transformed by the chain of the functions separated by `|`, e.g. `${user.email|trim|lower|sha256}`.
+The function arguments are separated by `:`. The functions:
+* `lower`, `upper`, `trim`
+* `substr:start` or `substr:start:end` returns the characters from start to end
+* `replace:old:new` replaces all the occurrences of the old string
+* `default:value` returns the value if the field is missing or empty
+* `sha256`, `md5` return the hex encoded hash
+* `base64` returns the base64 encoded value
+
 **Example:**
 ```yaml
 pipelines:
@@ -35,6 +44,18 @@ The resulting event could look like:
     "value": 666
   }
 ```
+
+Building the short routing key and hiding the email:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: modify
+      routing_key: ${service|lower|replace:_:-}.${trace_id|substr:0:8}
+      email_hash: ${user.email|trim|lower|sha256}
+    ...
+```
 }*/
 
 type Plugin struct {
@@ -42,6 +63,8 @@ type Plugin struct {
 	logger *zap.SugaredLogger
 	ops    map[string][]cfg.SubstitutionOp
 	buf    []byte
+	// filterBufs are the buffers of the substitution filters
+	filterBufs [2][]byte
 	plugin.NoMetricsPlugin
 }
 
@@ -88,7 +111,11 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 			case cfg.SubstitutionOpKindRaw:
 				p.buf = append(p.buf, op.Data[0]...)
 			case cfg.SubstitutionOpKindField:
-				p.buf = append(p.buf, event.Root.Dig(op.Data...).AsBytes()...)
+				value := event.Root.Dig(op.Data...).AsBytes()
+				if len(op.Filters) > 0 {
+					value = op.ApplyFilters(value, &p.filterBufs)
+				}
+				p.buf = append(p.buf, value...)
 			default:
 				p.logger.Panicf("unknown substitution kind %d", op.Kind)
 			}
@@ -30,3 +30,31 @@ func TestModify(t *testing.T) {
 	assert.Equal(t, "new_value", outEvents[0].Root.Dig("new_field").AsString(), "wrong field value")
 	assert.Equal(t, "existing_value", outEvents[0].Root.Dig("substitution_field").AsString(), "wrong field value")
 }
+
+func TestModifyFilters(t *testing.T) {
+	config := test.NewConfig(&Config{
+		"routing_key": "${service|lower|replace:_:-}.${trace_id|substr:0:8}",
+		"email_hash":  "${user.email|trim|lower|md5}",
+		"user_name":   "${user.name|default:anonymous}",
+	}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	outFields := make(map[string]string)
+	output.SetOutFn(func(e *pipeline.Event) {
+		for _, field := range []string{"routing_key", "email_hash", "user_name"} {
+			outFields[field] = string(e.Root.Dig(field).AsBytes())
+		}
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"service":"Billing_API","trace_id":"0123456789abcdef","user":{"email":" A@B.C "}}`))
+
+	wg.Wait()
+	p.Stop()
+
+	assert.Equal(t, "billing-api.01234567", outFields["routing_key"])
+	assert.Equal(t, "5d60d4e28066df254d5452f92c910092", outFields["email_hash"])
+	assert.Equal(t, "anonymous", outFields["user_name"])
+}
@@ -0,0 +1,128 @@
+package parse_cef
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+)
+
+/*{ introduction
+It parses a security log in CEF or LEEF format from the event field and merges the result with the event root.
+The field is removed if it's parsed successfully, otherwise the event isn't changed.
+
+The message may have a prefix before the `CEF:`/`LEEF:` marker, e.g. syslog header.
+
+Header fields are stored with these names:
+* CEF: `cef_version`, `device_vendor`, `device_product`, `device_version`, `signature_id`, `name`, `severity`
+* LEEF: `leef_version`, `device_vendor`, `device_product`, `device_version`, `event_id`
+
+Extension attributes are stored as is. CEF escaping (`\|`, `\\`, `\=`, `\n`, `\r`) is handled.
+LEEF 2.0 custom delimiter (a character or its hex code like `x09`) is supported.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: parse_cef
+      field: message
+    ...
+```
+
+The original event:
+```json
+{
+  "message": "CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 msg=Detected a threat\\=worm"
+}
+```
+
+The resulting event:
+```json
+{
+  "cef_version": "0",
+  "device_vendor": "Security",
+  "device_product": "threatmanager",
+  "device_version": "1.0",
+  "signature_id": "100",
+  "name": "worm successfully stopped",
+  "severity": "10",
+  "src": "10.0.0.1",
+  "dst": "2.1.2.2",
+  "msg": "Detected a threat=worm"
+}
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	parser *parser
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field to parse. Must be a string.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" required:"true"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Format of the messages. `auto` detects the format by the `CEF:`/`LEEF:` marker.
+	Format string `json:"format" default:"auto" options:"auto|cef|leef"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A prefix to add to parsed keys.
+	Prefix string `json:"prefix" default:""` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "parse_cef",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.parser = newParser(p.config.Format)
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	jsonNode := event.Root.Dig(p.config.Field_...)
+	if jsonNode == nil {
+		return pipeline.ActionPass
+	}
+
+	fields, err := p.parser.parse(jsonNode.AsBytes())
+	if err != nil {
+		return pipeline.ActionPass
+	}
+
+	jsonNode.Suicide()
+
+	var bl int
+	for _, f := range fields {
+		bl = len(event.Buf)
+
+		event.Buf = append(event.Buf, p.config.Prefix...)
+		event.Buf = append(event.Buf, f.key...)
+
+		key := pipeline.ByteToStringUnsafe(event.Buf[bl:len(event.Buf)])
+		event.Root.AddFieldNoAlloc(event.Root, key).MutateToBytesCopy(event.Root, f.value)
+	}
+
+	return pipeline.ActionPass
+}
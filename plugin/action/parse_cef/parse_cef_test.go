@@ -0,0 +1,136 @@
+package parse_cef
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		format   string
+		data     string
+		expected []string
+		err      error
+	}{
+		{
+			name:   "cef",
+			format: formatAuto,
+			data:   `CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232`,
+			expected: []string{
+				"cef_version=0", "device_vendor=Security", "device_product=threatmanager", "device_version=1.0",
+				"signature_id=100", "name=worm successfully stopped", "severity=10",
+				"src=10.0.0.1", "dst=2.1.2.2", "spt=1232",
+			},
+		},
+		{
+			name:   "cef_escaping",
+			format: formatCEF,
+			data:   `<134>Feb 14 19:04:54 host CEF:0|Vendor\|Inc|Prod\\uct|1|sig|detected a\|b|5|msg=line1\nline2 with spaces request=http://x/?a=b act=a\=b  `,
+			expected: []string{
+				"cef_version=0", "device_vendor=Vendor|Inc", `device_product=Prod\uct`, "device_version=1",
+				"signature_id=sig", "name=detected a|b", "severity=5",
+				"msg=line1\nline2 with spaces", "request=http://x/?a=b", "act=a=b",
+			},
+		},
+		{
+			name:   "cef_empty_extension",
+			format: formatAuto,
+			data:   `CEF:1|V|P|1|sig|name|Low|`,
+			expected: []string{
+				"cef_version=1", "device_vendor=V", "device_product=P", "device_version=1",
+				"signature_id=sig", "name=name", "severity=Low",
+			},
+		},
+		{
+			name:   "cef_bad_header",
+			format: formatAuto,
+			data:   `CEF:0|Security|threatmanager`,
+			err:    errBadHeader,
+		},
+		{
+			name:   "leef1",
+			format: formatAuto,
+			data:   "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5\tmsg=it's a message",
+			expected: []string{
+				"leef_version=1.0", "device_vendor=Microsoft", "device_product=MSExchange", "device_version=4.0 SP1", "event_id=15345",
+				"src=192.0.2.0", "dst=172.50.123.1", "sev=5", "msg=it's a message",
+			},
+		},
+		{
+			name:   "leef2_char_delimiter",
+			format: formatLEEF,
+			data:   "LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5",
+			expected: []string{
+				"leef_version=2.0", "device_vendor=Lancope", "device_product=StealthWatch", "device_version=1.0", "event_id=41",
+				"src=10.0.1.8", "dst=10.0.0.5", "sev=5",
+			},
+		},
+		{
+			name:   "leef2_hex_delimiter",
+			format: formatAuto,
+			data:   "LEEF:2.0|Lancope|StealthWatch|1.0|41|0x7c|src=10.0.1.8|dst=10.0.0.5",
+			expected: []string{
+				"leef_version=2.0", "device_vendor=Lancope", "device_product=StealthWatch", "device_version=1.0", "event_id=41",
+				"src=10.0.1.8", "dst=10.0.0.5",
+			},
+		},
+		{
+			name:   "leef2_bad_delimiter",
+			format: formatAuto,
+			data:   "LEEF:2.0|Lancope|StealthWatch|1.0|41|zz|src=10.0.1.8",
+			err:    errBadDelim,
+		},
+		{
+			name:   "wrong_format",
+			format: formatCEF,
+			data:   "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0",
+			err:    errNoMarker,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, err := newParser(tc.format).parse([]byte(tc.data))
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			result := make([]string, 0, len(fields))
+			for _, f := range fields {
+				result = append(result, string(f.key)+"="+string(f.value))
+			}
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	config := test.NewConfig(&Config{Field: "message", Prefix: "cef."}, nil)
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"message":"CEF:0|Security|threatmanager|1.0|100|worm stopped|10|src=10.0.0.1 msg=Detected a threat\\=worm","host":"a"}`))
+	input.In(0, "test.log", 0, []byte(`{"message":"not a cef"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	require.Equal(t, 2, len(outEvents))
+	assert.Equal(t, `{"host":"a","cef.cef_version":"0","cef.device_vendor":"Security","cef.device_product":"threatmanager","cef.device_version":"1.0","cef.signature_id":"100","cef.name":"worm stopped","cef.severity":"10","cef.src":"10.0.0.1","cef.msg":"Detected a threat=worm"}`, outEvents[0])
+	assert.Equal(t, `{"message":"not a cef"}`, outEvents[1])
+}
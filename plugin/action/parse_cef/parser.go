@@ -0,0 +1,257 @@
+package parse_cef
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+const (
+	formatAuto = "auto"
+	formatCEF  = "cef"
+	formatLEEF = "leef"
+)
+
+var (
+	cefMarker  = []byte("CEF:")
+	leefMarker = []byte("LEEF:")
+
+	cefHeader  = []string{"cef_version", "device_vendor", "device_product", "device_version", "signature_id", "name", "severity"}
+	leefHeader = []string{"leef_version", "device_vendor", "device_product", "device_version", "event_id"}
+
+	errNoMarker  = errors.New("no CEF or LEEF marker found")
+	errBadHeader = errors.New("not enough header fields")
+	errBadDelim  = errors.New("wrong LEEF delimiter")
+)
+
+type field struct {
+	key   []byte
+	value []byte
+}
+
+// parser splits CEF and LEEF messages into fields.
+// Fields refer to the parsed data or to the internal buffer, so they are valid until the next parse call.
+type parser struct {
+	format string
+
+	fields []field
+	buf    []byte
+}
+
+func newParser(format string) *parser {
+	return &parser{
+		format: format,
+		fields: make([]field, 0, 32),
+		buf:    make([]byte, 0, 1024),
+	}
+}
+
+func (p *parser) parse(data []byte) ([]field, error) {
+	p.fields = p.fields[:0]
+	p.buf = p.buf[:0]
+
+	format, pos := p.detect(data)
+	if pos < 0 {
+		return nil, errNoMarker
+	}
+
+	switch format {
+	case formatCEF:
+		return p.parseCEF(data[pos+len(cefMarker):])
+	default:
+		return p.parseLEEF(data[pos+len(leefMarker):])
+	}
+}
+
+// detect returns the format of the data and the position of its marker.
+// Messages may have a prefix, e.g. syslog header, so the marker is searched all over the data.
+func (p *parser) detect(data []byte) (string, int) {
+	cef, leef := -1, -1
+	if p.format != formatLEEF {
+		cef = bytes.Index(data, cefMarker)
+	}
+	if p.format != formatCEF {
+		leef = bytes.Index(data, leefMarker)
+	}
+
+	if cef >= 0 && (leef < 0 || cef < leef) {
+		return formatCEF, cef
+	}
+	return formatLEEF, leef
+}
+
+// parseCEF parses `Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension`.
+func (p *parser) parseCEF(data []byte) ([]field, error) {
+	ext, err := p.parseHeader(data, cefHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	p.parseCEFExtension(ext)
+
+	return p.fields, nil
+}
+
+// parseLEEF parses `Version|Vendor|Product|Version|EventID|Extension` for LEEF 1.0
+// and `Version|Vendor|Product|Version|EventID|Delimiter|Extension` for LEEF 2.0.
+func (p *parser) parseLEEF(data []byte) ([]field, error) {
+	ext, err := p.parseHeader(data, leefHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	delim := byte('\t')
+	if bytes.HasPrefix(p.fields[0].value, []byte("2.")) {
+		pos := bytes.IndexByte(ext, '|')
+		if pos < 0 {
+			return nil, errBadHeader
+		}
+		delim, err = parseDelimiter(ext[:pos])
+		if err != nil {
+			return nil, err
+		}
+		ext = ext[pos+1:]
+	}
+
+	for len(ext) > 0 {
+		attr := ext
+		pos := bytes.IndexByte(ext, delim)
+		if pos >= 0 {
+			attr, ext = ext[:pos], ext[pos+1:]
+		} else {
+			ext = nil
+		}
+
+		eq := bytes.IndexByte(attr, '=')
+		if eq <= 0 {
+			continue
+		}
+		p.fields = append(p.fields, field{key: bytes.TrimSpace(attr[:eq]), value: attr[eq+1:]})
+	}
+
+	return p.fields, nil
+}
+
+// parseHeader adds pipe separated header fields and returns the rest of the data.
+func (p *parser) parseHeader(data []byte, names []string) ([]byte, error) {
+	for _, name := range names {
+		end := -1
+		for i := 0; i < len(data); i++ {
+			if data[i] == '\\' {
+				i++
+				continue
+			}
+			if data[i] == '|' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, errBadHeader
+		}
+
+		p.fields = append(p.fields, field{key: []byte(name), value: p.unescape(data[:end])})
+		data = data[end+1:]
+	}
+
+	return data, nil
+}
+
+// parseCEFExtension parses space separated `key=value` pairs.
+// Values may contain spaces, so a value lasts until the next key.
+func (p *parser) parseCEFExtension(data []byte) {
+	valueStart := -1
+	var key []byte
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\\' {
+			i++
+			continue
+		}
+		if data[i] != '=' {
+			continue
+		}
+
+		keyStart := bytes.LastIndexByte(data[:i], ' ') + 1
+		if keyStart == i || !isCEFKey(data[keyStart:i]) {
+			continue
+		}
+		if valueStart >= 0 {
+			p.addCEFExtension(key, data[valueStart:keyStart])
+		}
+		key = data[keyStart:i]
+		valueStart = i + 1
+	}
+
+	if valueStart >= 0 {
+		p.addCEFExtension(key, data[valueStart:])
+	}
+}
+
+func (p *parser) addCEFExtension(key, value []byte) {
+	p.fields = append(p.fields, field{key: key, value: p.unescape(bytes.TrimRight(value, " "))})
+}
+
+// unescape handles `\\`, `\|`, `\=`, `\n` and `\r` sequences.
+// It returns the value itself if there is nothing to unescape.
+func (p *parser) unescape(value []byte) []byte {
+	if bytes.IndexByte(value, '\\') < 0 {
+		return value
+	}
+
+	start := len(p.buf)
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' && i+1 < len(value) {
+			i++
+			c = value[i]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case '\\', '|', '=':
+			default:
+				p.buf = append(p.buf, '\\')
+			}
+		}
+		p.buf = append(p.buf, c)
+	}
+
+	return p.buf[start:]
+}
+
+func isCEFKey(key []byte) bool {
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '.', c == '-', c == '[', c == ']':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseDelimiter parses LEEF 2.0 delimiter which is a character or its hex code, e.g. `^` or `x09`.
+func parseDelimiter(delim []byte) (byte, error) {
+	switch {
+	case len(delim) == 0:
+		return '\t', nil
+	case len(delim) == 1:
+		return delim[0], nil
+	}
+
+	hex := string(delim)
+	if hex[0] == '0' {
+		hex = hex[1:]
+	}
+	if hex[0] != 'x' && hex[0] != 'X' {
+		return 0, errBadDelim
+	}
+	code, err := strconv.ParseUint(hex[1:], 16, 8)
+	if err != nil {
+		return 0, errBadDelim
+	}
+
+	return byte(code), nil
+}
@@ -0,0 +1,203 @@
+package parse_csv
+
+import (
+	"strconv"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It parses a CSV/TSV row from the event field and merges the values with the event root.
+The field is removed if it's parsed successfully, otherwise the event isn't changed.
+
+The values are named by `columns`, the values without the column names are named `column1`, `column2` and so on.
+Quoted values may contain delimiters, the quote inside them is escaped by doubling it.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: parse_csv
+      field: message
+      delimiter: ";"
+      columns: [user, action, duration]
+      infer_types: true
+    ...
+```
+
+The original event:
+```json
+{
+  "message": "bob;\"login; then logout\";0.5"
+}
+```
+
+The resulting event:
+```json
+{
+  "user": "bob",
+  "action": "login; then logout",
+  "duration": 0.5
+}
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	parser *parser
+
+	names []string
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field to parse. Must be a string.
+	Field  cfg.FieldSelector `json:"field" default:"message" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The character separating the values. Use `\t` for TSV.
+	Delimiter string `json:"delimiter" default:","` // *
+
+	// > @3@4@5@6
+	// >
+	// > The character quoting the values.
+	Quote string `json:"quote" default:"\""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The names of the columns.
+	Columns []string `json:"columns" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A prefix to add to the column names.
+	Prefix string `json:"prefix" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the values `true`/`false` and the numbers are stored as JSON booleans and numbers,
+	// > otherwise all values are stored as strings.
+	InferTypes bool `json:"infer_types" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the rows with the count of the values different from the count of `columns` aren't parsed.
+	// > Otherwise the missing values are skipped and the extra values are named by their positions.
+	Strict bool `json:"strict" default:"false"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "parse_csv",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	delimiter := p.config.Delimiter
+	if delimiter == `\t` {
+		delimiter = "\t"
+	}
+	if len(delimiter) != 1 {
+		p.logger.Fatalf("delimiter must be a single character, got %q", p.config.Delimiter)
+	}
+	if len(p.config.Quote) != 1 {
+		p.logger.Fatalf("quote must be a single character, got %q", p.config.Quote)
+	}
+	if delimiter[0] == p.config.Quote[0] {
+		p.logger.Fatalf("delimiter and quote must be different")
+	}
+	p.parser = newParser(delimiter[0], p.config.Quote[0])
+
+	p.names = make([]string, 0, len(p.config.Columns))
+	for _, column := range p.config.Columns {
+		p.names = append(p.names, p.config.Prefix+column)
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	jsonNode := event.Root.Dig(p.config.Field_...)
+	if jsonNode == nil {
+		return pipeline.ActionPass
+	}
+
+	values, err := p.parser.parse(jsonNode.AsBytes())
+	if err != nil {
+		return pipeline.ActionPass
+	}
+	if p.config.Strict && len(values) != len(p.config.Columns) {
+		return pipeline.ActionPass
+	}
+
+	jsonNode.Suicide()
+
+	for i, value := range values {
+		node := event.Root.AddFieldNoAlloc(event.Root, p.name(i))
+		p.setValue(event.Root, node, value)
+	}
+
+	return pipeline.ActionPass
+}
+
+// name returns the name of the i-th column, the names of the extra columns are generated once and cached.
+func (p *Plugin) name(i int) string {
+	for len(p.names) <= i {
+		p.names = append(p.names, p.config.Prefix+"column"+strconv.Itoa(len(p.names)+1))
+	}
+	return p.names[i]
+}
+
+func (p *Plugin) setValue(root *insaneJSON.Root, node *insaneJSON.Node, value []byte) {
+	if !p.config.InferTypes || len(value) == 0 {
+		node.MutateToBytesCopy(root, value)
+		return
+	}
+
+	s := pipeline.ByteToStringUnsafe(value)
+	switch s {
+	case "true":
+		node.MutateToBool(true)
+		return
+	case "false":
+		node.MutateToBool(false)
+		return
+	}
+	// ParseFloat accepts NaN and Inf, they aren't valid JSON numbers.
+	if c := s[0]; c != '-' && (c < '0' || c > '9') {
+		node.MutateToBytesCopy(root, value)
+		return
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		node.MutateToInt64(n)
+		return
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		node.MutateToFloat(f)
+		return
+	}
+	node.MutateToBytesCopy(root, value)
+}
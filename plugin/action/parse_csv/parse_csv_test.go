@@ -0,0 +1,131 @@
+package parse_csv
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name      string
+		delimiter byte
+		data      string
+		expected  []string
+		err       error
+	}{
+		{
+			name:      "simple",
+			delimiter: ',',
+			data:      "a,b,,c\n",
+			expected:  []string{"a", "b", "", "c"},
+		},
+		{
+			name:      "quoted",
+			delimiter: ',',
+			data:      `"a,b","say ""hi""",c,""`,
+			expected:  []string{"a,b", `say "hi"`, "c", ""},
+		},
+		{
+			name:      "tsv",
+			delimiter: '\t',
+			data:      "a\tb c\t\"d\te\"\r\n",
+			expected:  []string{"a", "b c", "d\te"},
+		},
+		{
+			name:      "empty",
+			delimiter: ',',
+			data:      "",
+			expected:  []string{""},
+		},
+		{
+			name:      "unclosed_quote",
+			delimiter: ',',
+			data:      `a,"b`,
+			err:       errUnclosedQuote,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := newParser(tc.delimiter, '"').parse([]byte(tc.data))
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			result := make([]string, 0, len(values))
+			for _, v := range values {
+				result = append(result, string(v))
+			}
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		in       string
+		expected string
+	}{
+		{
+			name:     "columns",
+			config:   &Config{Columns: []string{"user", "action", "duration"}, Delimiter: ";", InferTypes: true},
+			in:       `{"message":"bob;\"login; logout\";0.5","host":"a"}`,
+			expected: `{"host":"a","user":"bob","action":"login; logout","duration":0.5}`,
+		},
+		{
+			name:     "auto_names",
+			config:   &Config{Columns: []string{"user"}, Prefix: "csv."},
+			in:       `{"message":"bob,true,1"}`,
+			expected: `{"csv.user":"bob","csv.column2":"true","csv.column3":"1"}`,
+		},
+		{
+			name:     "lenient_missing",
+			config:   &Config{Columns: []string{"user", "action", "duration"}},
+			in:       `{"message":"bob,login"}`,
+			expected: `{"user":"bob","action":"login"}`,
+		},
+		{
+			name:     "strict",
+			config:   &Config{Columns: []string{"user", "action", "duration"}, Strict: true},
+			in:       `{"message":"bob,login"}`,
+			expected: `{"message":"bob,login"}`,
+		},
+		{
+			name:     "tsv",
+			config:   &Config{Columns: []string{"a", "b"}, Delimiter: `\t`},
+			in:       `{"message":"1\t2"}`,
+			expected: `{"a":"1","b":"2"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.expected, outEvent)
+		})
+	}
+}
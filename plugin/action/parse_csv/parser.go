@@ -0,0 +1,88 @@
+package parse_csv
+
+import (
+	"errors"
+)
+
+var errUnclosedQuote = errors.New("unclosed quoted value")
+
+// parser splits a CSV row into values.
+// Quoted values may contain delimiters, the quote is escaped by doubling it like in RFC 4180.
+// Values refer to the parsed data or to the internal buffer, so they are valid until the next parse call.
+type parser struct {
+	delimiter byte
+	quote     byte
+
+	values [][]byte
+	buf    []byte
+}
+
+func newParser(delimiter, quote byte) *parser {
+	return &parser{
+		delimiter: delimiter,
+		quote:     quote,
+		values:    make([][]byte, 0, 16),
+		buf:       make([]byte, 0, 1024),
+	}
+}
+
+func (p *parser) parse(data []byte) ([][]byte, error) {
+	p.values = p.values[:0]
+	p.buf = p.buf[:0]
+	// the buffer must not be reallocated while the values refer to it.
+	if cap(p.buf) < len(data) {
+		p.buf = make([]byte, 0, len(data))
+	}
+
+	// a trailing line break isn't a part of the last value.
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+		if n := len(data); n > 0 && data[n-1] == '\r' {
+			data = data[:n-1]
+		}
+	}
+
+	i := 0
+	for {
+		if i < len(data) && data[i] == p.quote {
+			value, next, err := p.unquote(data, i+1)
+			if err != nil {
+				return nil, err
+			}
+			p.values = append(p.values, value)
+			i = next
+			// the garbage between the closing quote and the delimiter is ignored.
+			for i < len(data) && data[i] != p.delimiter {
+				i++
+			}
+		} else {
+			start := i
+			for i < len(data) && data[i] != p.delimiter {
+				i++
+			}
+			p.values = append(p.values, data[start:i])
+		}
+
+		if i >= len(data) {
+			return p.values, nil
+		}
+		i++
+	}
+}
+
+// unquote returns the value of the quoted string starting at the pos and the position after the closing quote.
+func (p *parser) unquote(data []byte, pos int) ([]byte, int, error) {
+	start := len(p.buf)
+	for i := pos; i < len(data); i++ {
+		if data[i] == p.quote {
+			if i+1 < len(data) && data[i+1] == p.quote {
+				p.buf = append(p.buf, p.quote)
+				i++
+				continue
+			}
+			return p.buf[start:], i + 1, nil
+		}
+		p.buf = append(p.buf, data[i])
+	}
+	return nil, 0, errUnclosedQuote
+}
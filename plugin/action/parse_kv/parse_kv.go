@@ -0,0 +1,171 @@
+package parse_kv
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It extracts `key=value` or `key:value` pairs from free text of the event field and puts them to the `target` object.
+The text which isn't a pair is skipped, the event field isn't changed.
+
+The values quoted with `"` or `'` may contain the pair delimiters, the quotes are removed.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: parse_kv
+      field: message
+      target: kv
+      value_delimiters: "=:"
+      trim_value: ",;"
+      exclude_keys: [password]
+    ...
+```
+
+The original event:
+```json
+{
+  "message": "login failed user=bob, ip:10.0.0.1; reason=\"wrong password\" password=123"
+}
+```
+
+The resulting event:
+```json
+{
+  "message": "login failed user=bob, ip:10.0.0.1; reason=\"wrong password\" password=123",
+  "kv": {
+    "user": "bob",
+    "ip": "10.0.0.1",
+    "reason": "wrong password"
+  }
+}
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	parser *parser
+
+	includeKeys map[string]bool
+	excludeKeys map[string]bool
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field to extract the pairs from. Must be a string.
+	Field  cfg.FieldSelector `json:"field" default:"message" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The object to put the pairs to. The pairs are merged with the event root by default.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The characters separating the pairs, any of them splits the text.
+	PairDelimiters string `json:"pair_delimiters" default:" "` // *
+
+	// > @3@4@5@6
+	// >
+	// > The characters separating the key and the value, the first of them in the pair is used.
+	ValueDelimiters string `json:"value_delimiters" default:"="` // *
+
+	// > @3@4@5@6
+	// >
+	// > The characters to trim from the both ends of the keys.
+	TrimKey string `json:"trim_key" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The characters to trim from the both ends of the values.
+	TrimValue string `json:"trim_value" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, only the pairs with these keys are extracted.
+	IncludeKeys []string `json:"include_keys" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The pairs with these keys aren't extracted.
+	ExcludeKeys []string `json:"exclude_keys" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A prefix to add to the keys.
+	Prefix string `json:"prefix" default:""` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "parse_kv",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if p.config.PairDelimiters == "" || p.config.ValueDelimiters == "" {
+		p.logger.Fatalf("pair_delimiters and value_delimiters must be set")
+	}
+	p.parser = newParser(p.config.PairDelimiters, p.config.ValueDelimiters, p.config.TrimKey, p.config.TrimValue)
+
+	if len(p.config.IncludeKeys) > 0 {
+		p.includeKeys = cfg.ListToMap(p.config.IncludeKeys)
+	}
+	p.excludeKeys = cfg.ListToMap(p.config.ExcludeKeys)
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	jsonNode := event.Root.Dig(p.config.Field_...)
+	if jsonNode == nil {
+		return pipeline.ActionPass
+	}
+
+	pairs := p.parser.parse(jsonNode.AsBytes())
+	if len(pairs) == 0 {
+		return pipeline.ActionPass
+	}
+
+	target := pipeline.CreateNestedField(event.Root, p.config.Target_)
+	var bl int
+	for _, pair := range pairs {
+		key := pipeline.ByteToStringUnsafe(pair.key)
+		if p.includeKeys != nil && !p.includeKeys[key] || p.excludeKeys[key] {
+			continue
+		}
+
+		bl = len(event.Buf)
+
+		event.Buf = append(event.Buf, p.config.Prefix...)
+		event.Buf = append(event.Buf, pair.key...)
+
+		key = pipeline.ByteToStringUnsafe(event.Buf[bl:len(event.Buf)])
+		target.AddFieldNoAlloc(event.Root, key).MutateToBytesCopy(event.Root, pair.value)
+	}
+
+	return pipeline.ActionPass
+}
@@ -0,0 +1,94 @@
+package parse_kv
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		parser   *parser
+		data     string
+		expected []string
+	}{
+		{
+			name:     "simple",
+			parser:   newParser(" ", "=", "", ""),
+			data:     `text a=1 b= c=x=y =z d`,
+			expected: []string{"a=1", "b=", "c=x=y"},
+		},
+		{
+			name:     "quoted",
+			parser:   newParser(" ", "=", "", ""),
+			data:     `a="1 2" b='3' c="unclosed d=4`,
+			expected: []string{"a=1 2", "b=3", `c="unclosed`, "d=4"},
+		},
+		{
+			name:     "delimiters_and_trim",
+			parser:   newParser("&;", ":=", "[] ", " ,"),
+			data:     `[a]: 1 ,; b=2&&c:3`,
+			expected: []string{"a=1", "b=2", "c=3"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pairs := tc.parser.parse([]byte(tc.data))
+
+			result := make([]string, 0, len(pairs))
+			for _, p := range pairs {
+				result = append(result, string(p.key)+"="+string(p.value))
+			}
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		in       string
+		expected string
+	}{
+		{
+			name:     "example",
+			config:   &Config{Target: "kv", ValueDelimiters: "=:", TrimValue: ",;", ExcludeKeys: []string{"password"}},
+			in:       `{"message":"login failed user=bob, ip:10.0.0.1; reason='wrong password' password=123"}`,
+			expected: `{"message":"login failed user=bob, ip:10.0.0.1; reason='wrong password' password=123","kv":{"user":"bob","ip":"10.0.0.1","reason":"wrong password"}}`,
+		},
+		{
+			name:     "include_and_prefix",
+			config:   &Config{IncludeKeys: []string{"a"}, Prefix: "kv_"},
+			in:       `{"message":"a=1 b=2"}`,
+			expected: `{"message":"a=1 b=2","kv_a":"1"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.expected, outEvent)
+		})
+	}
+}
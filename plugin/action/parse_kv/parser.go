@@ -0,0 +1,85 @@
+package parse_kv
+
+import (
+	"bytes"
+	"strings"
+)
+
+type pair struct {
+	key   []byte
+	value []byte
+}
+
+// parser extracts the key-value pairs from free text, the text which isn't a pair is skipped.
+// Pairs refer to the parsed data, so they are valid until the data is changed.
+type parser struct {
+	pairDelimiters  string
+	valueDelimiters string
+	trimKey         string
+	trimValue       string
+
+	pairs []pair
+}
+
+func newParser(pairDelimiters, valueDelimiters, trimKey, trimValue string) *parser {
+	return &parser{
+		pairDelimiters:  pairDelimiters,
+		valueDelimiters: valueDelimiters,
+		trimKey:         trimKey,
+		trimValue:       trimValue,
+		pairs:           make([]pair, 0, 16),
+	}
+}
+
+func (p *parser) parse(data []byte) []pair {
+	p.pairs = p.pairs[:0]
+
+	i := 0
+	for i < len(data) {
+		for i < len(data) && p.isPairDelimiter(data[i]) {
+			i++
+		}
+
+		start := i
+		for i < len(data) && !p.isPairDelimiter(data[i]) && !p.isValueDelimiter(data[i]) {
+			i++
+		}
+		if i == len(data) || !p.isValueDelimiter(data[i]) {
+			continue
+		}
+		key := data[start:i]
+		i++
+
+		var value []byte
+		if i < len(data) && (data[i] == '"' || data[i] == '\'') {
+			end := bytes.IndexByte(data[i+1:], data[i])
+			if end >= 0 {
+				value = data[i+1 : i+1+end]
+				i += end + 2
+			}
+		}
+		if value == nil {
+			start = i
+			for i < len(data) && !p.isPairDelimiter(data[i]) {
+				i++
+			}
+			value = data[start:i]
+		}
+
+		key = bytes.Trim(key, p.trimKey)
+		if len(key) == 0 {
+			continue
+		}
+		p.pairs = append(p.pairs, pair{key: key, value: bytes.Trim(value, p.trimValue)})
+	}
+
+	return p.pairs
+}
+
+func (p *parser) isPairDelimiter(c byte) bool {
+	return strings.IndexByte(p.pairDelimiters, c) >= 0
+}
+
+func (p *parser) isValueDelimiter(c byte) bool {
+	return strings.IndexByte(p.valueDelimiters, c) >= 0
+}
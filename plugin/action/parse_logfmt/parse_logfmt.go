@@ -0,0 +1,160 @@
+package parse_logfmt
+
+import (
+	"strconv"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+/*{ introduction
+It parses a logfmt string like `key=value key2="quoted value"` from the event field and merges the result with the event root.
+The field is removed if it's parsed successfully, otherwise the event isn't changed.
+
+Quoted values are unescaped and stored as strings. If `infer_types` is set, the unquoted values
+`true`/`false`, `null` and the numbers are stored as JSON booleans, nulls and numbers, the bare keys are stored as `true`.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: parse_logfmt
+      field: message
+      prefix: log.
+      infer_types: true
+    ...
+```
+
+The original event:
+```json
+{
+  "message": "level=info msg=\"request done\" status=200 duration=0.043 cached"
+}
+```
+
+The resulting event:
+```json
+{
+  "log.level": "info",
+  "log.msg": "request done",
+  "log.status": 200,
+  "log.duration": 0.043,
+  "log.cached": true
+}
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	parser *parser
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field to parse. Must be a string.
+	Field  cfg.FieldSelector `json:"field" default:"message" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > A prefix to add to parsed keys.
+	Prefix string `json:"prefix" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the types of the unquoted values are inferred, otherwise all values are stored as strings.
+	InferTypes bool `json:"infer_types" default:"false"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "parse_logfmt",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.parser = newParser()
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	jsonNode := event.Root.Dig(p.config.Field_...)
+	if jsonNode == nil {
+		return pipeline.ActionPass
+	}
+
+	pairs, err := p.parser.parse(jsonNode.AsBytes())
+	if err != nil {
+		return pipeline.ActionPass
+	}
+
+	jsonNode.Suicide()
+
+	var bl int
+	for _, pair := range pairs {
+		bl = len(event.Buf)
+
+		event.Buf = append(event.Buf, p.config.Prefix...)
+		event.Buf = append(event.Buf, pair.key...)
+
+		key := pipeline.ByteToStringUnsafe(event.Buf[bl:len(event.Buf)])
+		p.setValue(event.Root, event.Root.AddFieldNoAlloc(event.Root, key), pair)
+	}
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) setValue(root *insaneJSON.Root, node *insaneJSON.Node, pair pair) {
+	if !p.config.InferTypes || pair.quoted {
+		node.MutateToBytesCopy(root, pair.value)
+		return
+	}
+	if pair.bare {
+		node.MutateToBool(true)
+		return
+	}
+
+	value := pipeline.ByteToStringUnsafe(pair.value)
+	switch value {
+	case "true":
+		node.MutateToBool(true)
+		return
+	case "false":
+		node.MutateToBool(false)
+		return
+	case "null":
+		node.MutateToNull()
+		return
+	}
+	// ParseFloat accepts NaN and Inf, they aren't valid JSON numbers.
+	if c := value[0]; c != '-' && (c < '0' || c > '9') {
+		node.MutateToBytesCopy(root, pair.value)
+		return
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		node.MutateToInt64(n)
+		return
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		node.MutateToFloat(f)
+		return
+	}
+	node.MutateToBytesCopy(root, pair.value)
+}
@@ -0,0 +1,118 @@
+package parse_logfmt
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		expected []string
+		err      error
+	}{
+		{
+			name:     "simple",
+			data:     `level=info status=200`,
+			expected: []string{"level=info", "status=200"},
+		},
+		{
+			name:     "quoted",
+			data:     `msg="request \"done\"\tok" path="" ts=2022-01-01T00:00:00Z`,
+			expected: []string{"msg=\"request \"done\"\tok\"", `path=""`, "ts=2022-01-01T00:00:00Z"},
+		},
+		{
+			name:     "bare_and_empty",
+			data:     `  cached empty= level=debug `,
+			expected: []string{"cached", "empty=", "level=debug"},
+		},
+		{
+			name:     "garbage",
+			data:     `=x "y" a=b`,
+			expected: []string{"a=b"},
+		},
+		{
+			name: "unclosed_quote",
+			data: `msg="not closed`,
+			err:  errUnclosedQuote,
+		},
+		{
+			name: "empty",
+			data: `   `,
+			err:  errNoPairs,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pairs, err := newParser().parse([]byte(tc.data))
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			result := make([]string, 0, len(pairs))
+			for _, p := range pairs {
+				switch {
+				case p.bare:
+					result = append(result, string(p.key))
+				case p.quoted:
+					result = append(result, string(p.key)+`="`+string(p.value)+`"`)
+				default:
+					result = append(result, string(p.key)+"="+string(p.value))
+				}
+			}
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	cases := []struct {
+		name       string
+		inferTypes bool
+		expected   string
+	}{
+		{
+			name:       "infer_types",
+			inferTypes: true,
+			expected:   `{"host":"a","log.level":"info","log.msg":"done","log.status":200,"log.duration":0.043,"log.ok":true,"log.code":"007x","log.nan":"NaN","log.quoted":"1","log.cached":true}`,
+		},
+		{
+			name:     "strings",
+			expected: `{"host":"a","log.level":"info","log.msg":"done","log.status":"200","log.duration":"0.043","log.ok":"true","log.code":"007x","log.nan":"NaN","log.quoted":"1","log.cached":""}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{Prefix: "log.", InferTypes: tc.inferTypes}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(2)
+
+			outEvents := make([]string, 0)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents = append(outEvents, e.Root.EncodeToString())
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(`{"message":"level=info msg=\"done\" status=200 duration=0.043 ok=true code=007x nan=NaN quoted=\"1\" cached","host":"a"}`))
+			input.In(0, "test.log", 0, []byte(`{"message":"   "}`))
+
+			wg.Wait()
+			p.Stop()
+
+			require.Equal(t, 2, len(outEvents))
+			assert.Equal(t, tc.expected, outEvents[0])
+			assert.Equal(t, `{"message":"   "}`, outEvents[1])
+		})
+	}
+}
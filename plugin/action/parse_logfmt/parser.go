@@ -0,0 +1,131 @@
+package parse_logfmt
+
+import (
+	"errors"
+)
+
+var (
+	errNoPairs       = errors.New("no key-value pairs found")
+	errUnclosedQuote = errors.New("unclosed quoted value")
+)
+
+type pair struct {
+	key   []byte
+	value []byte
+	// quoted values are always strings.
+	quoted bool
+	// bare keys don't have a value at all, e.g. `debug` in `level=info debug`.
+	bare bool
+}
+
+// parser splits logfmt messages into pairs.
+// Pairs refer to the parsed data or to the internal buffer, so they are valid until the next parse call.
+type parser struct {
+	pairs []pair
+	buf   []byte
+}
+
+func newParser() *parser {
+	return &parser{
+		pairs: make([]pair, 0, 16),
+		buf:   make([]byte, 0, 1024),
+	}
+}
+
+func (p *parser) parse(data []byte) ([]pair, error) {
+	p.pairs = p.pairs[:0]
+	p.buf = p.buf[:0]
+	// the buffer must not be reallocated while the pairs refer to it.
+	if cap(p.buf) < len(data) {
+		p.buf = make([]byte, 0, len(data))
+	}
+
+	i := 0
+	for i < len(data) {
+		for i < len(data) && isSpace(data[i]) {
+			i++
+		}
+		if i == len(data) {
+			break
+		}
+
+		start := i
+		for i < len(data) && data[i] != '=' && !isSpace(data[i]) && data[i] != '"' {
+			i++
+		}
+		key := data[start:i]
+		if len(key) == 0 {
+			// garbage like a stray quote or `=`, skip until the next space.
+			for i < len(data) && !isSpace(data[i]) {
+				i++
+			}
+			continue
+		}
+
+		if i == len(data) || data[i] != '=' {
+			if i < len(data) && data[i] == '"' {
+				for i < len(data) && !isSpace(data[i]) {
+					i++
+				}
+				continue
+			}
+			p.pairs = append(p.pairs, pair{key: key, bare: true})
+			continue
+		}
+		i++
+
+		if i < len(data) && data[i] == '"' {
+			value, next, err := p.unquote(data, i+1)
+			if err != nil {
+				return nil, err
+			}
+			p.pairs = append(p.pairs, pair{key: key, value: value, quoted: true})
+			i = next
+			continue
+		}
+
+		start = i
+		for i < len(data) && !isSpace(data[i]) {
+			i++
+		}
+		p.pairs = append(p.pairs, pair{key: key, value: data[start:i]})
+	}
+
+	if len(p.pairs) == 0 {
+		return nil, errNoPairs
+	}
+	return p.pairs, nil
+}
+
+// unquote returns the value of the quoted string starting at the pos and the position after the closing quote.
+func (p *parser) unquote(data []byte, pos int) ([]byte, int, error) {
+	start := len(p.buf)
+	for i := pos; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '"':
+			return p.buf[start:], i + 1, nil
+		case '\\':
+			if i+1 == len(data) {
+				return nil, 0, errUnclosedQuote
+			}
+			i++
+			switch data[i] {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			default:
+				c = data[i]
+			}
+		}
+		p.buf = append(p.buf, c)
+	}
+	return nil, 0, errUnclosedQuote
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -2,23 +2,65 @@ package parse_re2
 
 import (
 	"regexp"
+	"strconv"
 
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
-	"github.com/ozontech/file.d/plugin"
+	prom "github.com/prometheus/client_golang/prometheus"
 	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
 )
 
 /*{ introduction
 It parses string from the event field using re2 expression with named subgroups and merges the result with the event root.
+
+The expressions of the `re2` and the `re2_list` are tried in order, the first matched one is used.
+The subgroups are written to the `fields` if they are set and converted to the `types`,
+the events the field of which isn't matched by any expression are counted in the `parse_re2_failures_total` metric.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: parse_re2
+      field: log
+      re2_list:
+        - '^(?P<method>[A-Z]+) (?P<path>\S+) (?P<status>\d{3}) (?P<duration>[\d.]+)$'
+        - '^(?P<method>[A-Z]+) (?P<path>\S+)$'
+      fields:
+        method: request.method
+        path: request.path
+      types:
+        status: int
+        duration: float
+    ...
+```
+It transforms `{"log":"GET /api 200 0.25"}` into `{"request":{"method":"GET","path":"/api"},"status":200,"duration":0.25}`.
 }*/
 
 type Plugin struct {
 	config *Config
+	logger *zap.SugaredLogger
+
+	patterns []*pattern
+
+	failuresMetric *prom.CounterVec
+}
+
+// pattern is the expression along with the targets of its named subgroups.
+type pattern struct {
+	re     *regexp.Regexp
+	groups []*group
+}
 
-	re *regexp.Regexp
-	plugin.NoMetricsPlugin
+type group struct {
+	index int
+	path  []string
+	kind  string
 }
 
 // ! config-params
@@ -33,12 +75,29 @@ type Config struct {
 	// > @3@4@5@6
 	// >
 	// > Re2 expression to use for parsing.
-	Re2 string `json:"re2" default:"" required:"true"` // *
+	Re2 string `json:"re2" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Re2 expressions tried in order after the `re2`, at least one of the `re2` and the `re2_list` must be set.
+	Re2List []string `json:"re2_list" slice:"true"` // *
 
 	// > @3@4@5@6
 	// >
 	// > A prefix to add to decoded object keys.
 	Prefix string `json:"prefix" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The map of the subgroup names to the field selectors to write them to, e.g. `pod: k8s.pod`.
+	// > The `prefix` isn't added to these fields.
+	Fields map[string]string `json:"fields"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The map of the subgroup names to their types, must be one of `int|float|bool|string`.
+	// > The values that can't be converted are written as strings.
+	Types map[string]string `json:"types"` // *
 }
 
 func init() {
@@ -52,10 +111,53 @@ func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 	return &Plugin{}, &Config{}
 }
 
-func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
 	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	expressions := p.config.Re2List
+	if p.config.Re2 != "" {
+		expressions = append([]string{p.config.Re2}, expressions...)
+	}
+	if len(expressions) == 0 {
+		p.logger.Fatalf("re2 or re2_list must be set")
+	}
+
+	for name, kind := range p.config.Types {
+		switch kind {
+		case "int", "float", "bool", "string":
+		default:
+			p.logger.Fatalf("wrong type %q of %q subgroup, must be one of int|float|bool|string", kind, name)
+		}
+	}
+
+	for _, expression := range expressions {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			p.logger.Fatalf("can't compile re2 %q: %s", expression, err.Error())
+		}
+
+		pt := &pattern{re: re}
+		for i, name := range re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+
+			path := []string{p.config.Prefix + name}
+			if field, has := p.config.Fields[name]; has {
+				path = cfg.ParseFieldSelector(field)
+				if len(path) == 0 {
+					p.logger.Fatalf("empty field of %q subgroup", name)
+				}
+			}
+			pt.groups = append(pt.groups, &group{index: i, path: path, kind: p.config.Types[name]})
+		}
+		p.patterns = append(p.patterns, pt)
+	}
+}
 
-	p.re = regexp.MustCompile(p.config.Re2)
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.failuresMetric = ctl.RegisterCounter("parse_re2_failures_total", "Number of events not matched by parse_re2 expressions")
 }
 
 func (p *Plugin) Stop() {
@@ -67,34 +169,45 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 		return pipeline.ActionPass
 	}
 
-	sm := p.re.FindSubmatch(jsonNode.AsBytes())
+	value := jsonNode.AsBytes()
+	for _, pt := range p.patterns {
+		sm := pt.re.FindSubmatch(value)
+		if len(sm) == 0 {
+			continue
+		}
 
-	if len(sm) == 0 {
+		jsonNode.Suicide()
+		for _, g := range pt.groups {
+			setValue(pipeline.AddField(event.Root, g.path), sm[g.index], g.kind)
+		}
 		return pipeline.ActionPass
 	}
 
-	jsonNode.Suicide()
-
-	root := insaneJSON.Spawn()
+	if p.failuresMetric != nil {
+		p.failuresMetric.WithLabelValues().Inc()
+	}
+	return pipeline.ActionPass
+}
 
-	fields := p.re.SubexpNames()
-	var bl int
-	for i := 1; i < len(fields); i++ {
-		if fields[i] == "" {
-			continue
+// setValue writes the value of the subgroup converted to the kind, the value is kept as the string if it can't be converted.
+func setValue(node *insaneJSON.Node, value []byte, kind string) {
+	s := pipeline.ByteToStringUnsafe(value)
+	switch kind {
+	case "int":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			node.MutateToInt64(i)
+			return
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			node.MutateToFloat(f)
+			return
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(s); err == nil {
+			node.MutateToBool(b)
+			return
 		}
-
-		bl = len(event.Buf)
-
-		event.Buf = append(event.Buf, p.config.Prefix...)
-		event.Buf = append(event.Buf, fields[i]...)
-
-		root.AddFieldNoAlloc(root, pipeline.ByteToStringUnsafe(event.Buf[bl:len(event.Buf)])).MutateToBytes(sm[i])
 	}
-
-	event.Root.MergeWith(root.Node)
-
-	insaneJSON.Release(root)
-
-	return pipeline.ActionPass
+	node.MutateToBytes(value)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,3 +47,63 @@ func TestDecode(t *testing.T) {
 	assert.Equal(t, 1, len(outEvents), "wrong out events count")
 	assert.Equal(t, `{"prefix.date":"2021-06-22 16:24:27 GMT","prefix.pid":"7291","prefix.pid_message_number":"2-1","prefix.client":"test_client","prefix.db":"test_db","prefix.user":"test_user","prefix.message":"listening on IPv4 address \"0.0.0.0\", port 5432"}`, outEvents[0].Root.EncodeToString(), "wrong out event")
 }
+
+func TestDecodeList(t *testing.T) {
+	config := test.NewConfig(&Config{
+		Field: "log",
+		Re2List: []string{
+			`^(?P<method>[A-Z]+) (?P<path>\S+) (?P<status>\d{3}) (?P<duration>[\d.]+) (?P<cached>\w+)$`,
+			`^(?P<method>[A-Z]+) (?P<path>\S+)$`,
+		},
+		Fields: map[string]string{"method": "request.method", "path": "request.path"},
+		Types:  map[string]string{"status": "int", "duration": "float", "cached": "bool"},
+	}, nil)
+
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{
+			in:  `{"log":"GET /api 200 0.25 true","request":{"id":1}}`,
+			out: `{"request":{"id":1,"method":"GET","path":"/api"},"status":200,"duration":0.25,"cached":true}`,
+		},
+		{
+			in:  `{"log":"POST /upload 201 1.5 maybe"}`,
+			out: `{"request":{"method":"POST","path":"/upload"},"status":201,"duration":1.5,"cached":"maybe"}`,
+		},
+		{
+			in:  `{"log":"DELETE /api"}`,
+			out: `{"request":{"method":"DELETE","path":"/api"}}`,
+		},
+		{
+			in:  `{"log":"not matched"}`,
+			out: `{"log":"not matched"}`,
+		},
+	}
+	var plugin *Plugin
+	pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		plugin = &Plugin{}
+		return plugin, &Config{}
+	}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(cases))
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	for i, tc := range cases {
+		input.In(0, "test.log", int64(i), []byte(tc.in))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	for i, tc := range cases {
+		assert.Equal(t, tc.out, outEvents[i])
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(plugin.failuresMetric))
+}
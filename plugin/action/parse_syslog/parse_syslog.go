@@ -0,0 +1,166 @@
+package parse_syslog
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+/*{ introduction
+It parses the RFC3164 or RFC5424 syslog header of the event field and puts the header fields into the event root.
+The field is replaced with the message text after the header. If the header can't be parsed, the event isn't changed.
+
+Header fields are stored with these names:
+* `priority`, `facility`, `severity` – the numbers of the `<PRI>`
+* `timestamp` – the timestamp as is, use the `set_time` or the `convert_date` actions to parse it
+* `hostname`, `app_name`, `proc_id`, `msg_id`
+* `structured_data` – the object of the RFC5424 structured data elements, e.g. `{"exampleSDID@32473":{"iut":"3"}}`
+
+The missing and the nil (`-`) header fields aren't stored. The RFC3164 tag like `sshd[42]:` is stored as the `app_name` and the `proc_id`,
+the RFC3164 messages may have no priority and the hostname, and may have the RFC3339 timestamp.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: parse_syslog
+      field: message
+    ...
+```
+
+The original event:
+```json
+{
+  "message": "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut=\"3\" eventSource=\"Application\"] An application event"
+}
+```
+
+The resulting event:
+```json
+{
+  "message": "An application event",
+  "priority": 165,
+  "facility": 20,
+  "severity": 5,
+  "timestamp": "2003-10-11T22:14:15.003Z",
+  "hostname": "mymachine.example.com",
+  "app_name": "evntslog",
+  "msg_id": "ID47",
+  "structured_data": {
+    "exampleSDID@32473": {
+      "iut": "3",
+      "eventSource": "Application"
+    }
+  }
+}
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	parser *parser
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field to parse. Must be a string.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" default:"message"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Format of the header. `auto` detects RFC5424 by the version after the priority.
+	Format string `json:"format" default:"auto" options:"auto|rfc3164|rfc5424"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A prefix to add to the header field names.
+	Prefix string `json:"prefix" default:""` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "parse_syslog",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.parser = newParser(p.config.Format)
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	node := event.Root.Dig(p.config.Field_...)
+	if node == nil {
+		return pipeline.ActionPass
+	}
+
+	m, err := p.parser.parse(node.AsBytes())
+	if err != nil {
+		return pipeline.ActionPass
+	}
+
+	root := event.Root
+	if m.priority >= 0 {
+		p.addField(event, "priority").MutateToInt(m.priority)
+		p.addField(event, "facility").MutateToInt(m.priority / 8)
+		p.addField(event, "severity").MutateToInt(m.priority % 8)
+	}
+
+	values := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "timestamp", value: m.timestamp},
+		{name: "hostname", value: m.hostname},
+		{name: "app_name", value: m.appName},
+		{name: "proc_id", value: m.procID},
+		{name: "msg_id", value: m.msgID},
+	}
+	for _, v := range values {
+		if v.value != nil {
+			p.addField(event, v.name).MutateToBytesCopy(root, v.value)
+		}
+	}
+
+	if len(m.sd) > 0 {
+		sd := p.addField(event, "structured_data").MutateToObject()
+		for _, element := range m.sd {
+			elementNode := sd.AddFieldNoAlloc(root, string(element.id)).MutateToObject()
+			for _, param := range element.params {
+				elementNode.AddFieldNoAlloc(root, string(param.name)).MutateToBytesCopy(root, param.value)
+			}
+		}
+	}
+
+	node.MutateToBytesCopy(root, m.msg)
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) addField(event *pipeline.Event, name string) *insaneJSON.Node {
+	if p.config.Prefix == "" {
+		return event.Root.AddFieldNoAlloc(event.Root, name)
+	}
+
+	l := len(event.Buf)
+	event.Buf = append(event.Buf, p.config.Prefix...)
+	event.Buf = append(event.Buf, name...)
+	return event.Root.AddFieldNoAlloc(event.Root, pipeline.ByteToStringUnsafe(event.Buf[l:]))
+}
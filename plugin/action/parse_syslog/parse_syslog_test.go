@@ -0,0 +1,107 @@
+package parse_syslog
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+	}{
+		{
+			name:   "rfc5424",
+			config: &Config{},
+			in:     `{"message":"<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut=\"3\" eventSource=\"Application\"] An application event"}`,
+			out:    `{"message":"An application event","priority":165,"facility":20,"severity":5,"timestamp":"2003-10-11T22:14:15.003Z","hostname":"mymachine.example.com","app_name":"evntslog","msg_id":"ID47","structured_data":{"exampleSDID@32473":{"iut":"3","eventSource":"Application"}}}`,
+		},
+		{
+			name:   "rfc5424 nil values",
+			config: &Config{Format: "rfc5424", Prefix: "syslog_"},
+			in:     `{"message":"<34>1 - - su - - - \ufeff'su root' failed"}`,
+			out:    `{"message":"'su root' failed","syslog_priority":34,"syslog_facility":4,"syslog_severity":2,"syslog_app_name":"su"}`,
+		},
+		{
+			name:   "rfc5424 several elements",
+			config: &Config{Field: "raw"},
+			in:     `{"raw":"<165>1 2003-10-11T22:14:15Z host app 42 - [a@1 k=\"x \\\"y\\\" \\] \\\\z\"][b@1][c@1 n=\"\"]"}`,
+			out:    `{"raw":"","priority":165,"facility":20,"severity":5,"timestamp":"2003-10-11T22:14:15Z","hostname":"host","app_name":"app","proc_id":"42","structured_data":{"a@1":{"k":"x \"y\" ] \\z"},"b@1":{},"c@1":{"n":""}}}`,
+		},
+		{
+			name:   "rfc3164",
+			config: &Config{},
+			in:     `{"message":"<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8"}`,
+			out:    `{"message":"'su root' failed for lonvick on /dev/pts/8","priority":34,"facility":4,"severity":2,"timestamp":"Oct 11 22:14:15","hostname":"mymachine","app_name":"su","proc_id":"230"}`,
+		},
+		{
+			name:   "rfc3164 without hostname",
+			config: &Config{},
+			in:     `{"message":"<13>Feb  5 17:32:18 sshd: session opened"}`,
+			out:    `{"message":"session opened","priority":13,"facility":1,"severity":5,"timestamp":"Feb  5 17:32:18","app_name":"sshd"}`,
+		},
+		{
+			name:   "rfc3164 without priority and tag",
+			config: &Config{Format: "rfc3164"},
+			in:     `{"message":"2023-05-01T10:20:00+03:00 10.0.0.99 Use the BFG!"}`,
+			out:    `{"message":"Use the BFG!","timestamp":"2023-05-01T10:20:00+03:00","hostname":"10.0.0.99"}`,
+		},
+		{
+			name:   "rfc3164 priority only",
+			config: &Config{},
+			in:     `{"message":"<13>hello"}`,
+			out:    `{"message":"hello","priority":13,"facility":1,"severity":5}`,
+		},
+		{
+			name:   "not syslog",
+			config: &Config{},
+			in:     `{"message":"just a message"}`,
+			out:    `{"message":"just a message"}`,
+		},
+		{
+			name:   "bad priority",
+			config: &Config{},
+			in:     `{"message":"<192>Oct 11 22:14:15 host app: m"}`,
+			out:    `{"message":"<192>Oct 11 22:14:15 host app: m"}`,
+		},
+		{
+			name:   "bad structured data",
+			config: &Config{},
+			in:     `{"message":"<165>1 - - - - - [id k=v] message"}`,
+			out:    `{"message":"<165>1 - - - - - [id k=v] message"}`,
+		},
+		{
+			name:   "rfc5424 without priority",
+			config: &Config{Format: "rfc5424"},
+			in:     `{"message":"1 - - - - - - message"}`,
+			out:    `{"message":"1 - - - - - - message"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package parse_syslog
+
+import (
+	"bytes"
+	"errors"
+)
+
+const (
+	formatAuto    = "auto"
+	formatRFC3164 = "rfc3164"
+	formatRFC5424 = "rfc5424"
+
+	nilValue = '-'
+
+	// maxPriority is the priority of the debug messages of the local7 facility.
+	maxPriority = 191
+)
+
+var (
+	errBadPriority       = errors.New("bad priority")
+	errBadHeader         = errors.New("bad header")
+	errBadStructuredData = errors.New("bad structured data")
+
+	bom = []byte("\xef\xbb\xbf")
+)
+
+var months = [][]byte{
+	[]byte("Jan"), []byte("Feb"), []byte("Mar"), []byte("Apr"), []byte("May"), []byte("Jun"),
+	[]byte("Jul"), []byte("Aug"), []byte("Sep"), []byte("Oct"), []byte("Nov"), []byte("Dec"),
+}
+
+type sdParam struct {
+	name  []byte
+	value []byte
+}
+
+type sdElement struct {
+	id     []byte
+	params []sdParam
+}
+
+// message is the parsed syslog message, the missing header fields are nil and the priority is -1.
+type message struct {
+	priority  int
+	version   []byte
+	timestamp []byte
+	hostname  []byte
+	appName   []byte
+	procID    []byte
+	msgID     []byte
+	sd        []sdElement
+	msg       []byte
+}
+
+type parser struct {
+	format  string
+	message message
+	// value is the buffer of the unescaped structured data param values.
+	value []byte
+}
+
+func newParser(format string) *parser {
+	return &parser{format: format}
+}
+
+func (p *parser) parse(data []byte) (*message, error) {
+	m := &p.message
+	sd := m.sd[:0]
+	*m = message{priority: -1, sd: sd}
+	p.value = p.value[:0]
+
+	data, err := p.parsePriority(data)
+	if err != nil {
+		return nil, err
+	}
+
+	format := p.format
+	if format == formatAuto {
+		format = formatRFC3164
+		// the version of RFC5424 follows the priority
+		if m.priority >= 0 && len(data) > 1 && data[0] >= '1' && data[0] <= '9' && data[1] == ' ' {
+			format = formatRFC5424
+		}
+	}
+
+	if format == formatRFC5424 {
+		err = p.parseRFC5424(data)
+	} else {
+		err = p.parseRFC3164(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parsePriority parses `<PRI>`, it's required for RFC5424 only.
+func (p *parser) parsePriority(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != '<' {
+		if p.format == formatRFC5424 {
+			return data, errBadPriority
+		}
+		return data, nil
+	}
+
+	priority := 0
+	i := 1
+	for ; i < len(data) && i <= 4 && data[i] >= '0' && data[i] <= '9'; i++ {
+		priority = priority*10 + int(data[i]-'0')
+	}
+	if i == 1 || i == len(data) || data[i] != '>' || priority > maxPriority {
+		return data, errBadPriority
+	}
+
+	p.message.priority = priority
+	return data[i+1:], nil
+}
+
+// parseRFC5424 parses `VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]`.
+func (p *parser) parseRFC5424(data []byte) error {
+	m := &p.message
+	fields := []*[]byte{&m.version, &m.timestamp, &m.hostname, &m.appName, &m.procID, &m.msgID}
+	for _, field := range fields {
+		pos := bytes.IndexByte(data, ' ')
+		if pos <= 0 {
+			return errBadHeader
+		}
+		if pos != 1 || data[0] != nilValue {
+			*field = data[:pos]
+		}
+		data = data[pos+1:]
+	}
+	if m.version == nil || m.version[0] < '1' || m.version[0] > '9' {
+		return errBadHeader
+	}
+
+	data, err := p.parseStructuredData(data)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > 0 {
+		if data[0] != ' ' {
+			return errBadStructuredData
+		}
+		m.msg = bytes.TrimPrefix(data[1:], bom)
+	}
+	return nil
+}
+
+// parseStructuredData parses `-` or the elements like `[id name="value" ...]`, `"`, `\` and `]` are escaped in the values.
+func (p *parser) parseStructuredData(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == nilValue {
+		return data[1:], nil
+	}
+	if len(data) == 0 || data[0] != '[' {
+		return data, errBadStructuredData
+	}
+
+	for len(data) > 0 && data[0] == '[' {
+		pos := bytes.IndexAny(data, " ]")
+		if pos <= 1 {
+			return data, errBadStructuredData
+		}
+		element := sdElement{id: data[1:pos]}
+		data = data[pos:]
+
+		for len(data) > 0 && data[0] == ' ' {
+			eq := bytes.IndexByte(data, '=')
+			if eq <= 1 || eq+1 >= len(data) || data[eq+1] != '"' {
+				return data, errBadStructuredData
+			}
+			name := data[1:eq]
+			value, rest, err := p.parseParamValue(data[eq+2:])
+			if err != nil {
+				return data, err
+			}
+			element.params = append(element.params, sdParam{name: name, value: value})
+			data = rest
+		}
+
+		if len(data) == 0 || data[0] != ']' {
+			return data, errBadStructuredData
+		}
+		data = data[1:]
+		p.message.sd = append(p.message.sd, element)
+	}
+	return data, nil
+}
+
+// parseParamValue unescapes the value till the closing quote and returns the rest of the data after it.
+func (p *parser) parseParamValue(data []byte) ([]byte, []byte, error) {
+	start := len(p.value)
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '"':
+			return p.value[start:], data[i+1:], nil
+		case '\\':
+			if i+1 < len(data) && (data[i+1] == '"' || data[i+1] == '\\' || data[i+1] == ']') {
+				i++
+				c = data[i]
+			}
+			p.value = append(p.value, c)
+		default:
+			p.value = append(p.value, c)
+		}
+	}
+	return nil, data, errBadStructuredData
+}
+
+// parseRFC3164 parses `TIMESTAMP HOSTNAME TAG[PID]: MSG`, the parts of the header may be missing.
+// The timestamp is `Mmm dd hh:mm:ss` or RFC3339 one.
+func (p *parser) parseRFC3164(data []byte) error {
+	m := &p.message
+	data, m.timestamp = cutTimestamp(data)
+	if m.timestamp != nil {
+		data = bytes.TrimLeft(data, " ")
+	} else if m.priority < 0 {
+		return errBadHeader
+	}
+
+	if token, rest, ok := cutToken(data); ok && !isTag(token) {
+		if _, _, ok := cutToken(rest); ok {
+			m.hostname = token
+			data = rest
+		}
+	}
+
+	if token, rest, ok := cutToken(data); ok && isTag(token) {
+		tag := token[:len(token)-1]
+		if pos := bytes.IndexByte(tag, '['); pos > 0 && tag[len(tag)-1] == ']' {
+			m.procID = tag[pos+1 : len(tag)-1]
+			tag = tag[:pos]
+		}
+		if len(tag) > 0 {
+			m.appName = tag
+		}
+		data = rest
+	}
+
+	m.msg = data
+	return nil
+}
+
+// cutTimestamp cuts the timestamp and returns the rest of the data and the timestamp.
+func cutTimestamp(data []byte) ([]byte, []byte) {
+	const stampLen = len("Jan _2 15:04:05")
+	if len(data) >= stampLen && isMonth(data[:3]) && data[3] == ' ' &&
+		data[6] == ' ' && data[9] == ':' && data[12] == ':' {
+		return data[stampLen:], data[:stampLen]
+	}
+
+	// RFC3339 timestamp like 2006-01-02T15:04:05Z07:00
+	if len(data) > 19 && data[4] == '-' && data[10] == 'T' && data[0] >= '0' && data[0] <= '9' {
+		pos := bytes.IndexByte(data, ' ')
+		if pos < 0 {
+			pos = len(data)
+		}
+		return data[pos:], data[:pos]
+	}
+	return data, nil
+}
+
+func isMonth(data []byte) bool {
+	for _, month := range months {
+		if bytes.Equal(data, month) {
+			return true
+		}
+	}
+	return false
+}
+
+// cutToken cuts the token till the space, the token must be followed by the space.
+func cutToken(data []byte) ([]byte, []byte, bool) {
+	pos := bytes.IndexByte(data, ' ')
+	if pos <= 0 {
+		return nil, data, false
+	}
+	return data[:pos], data[pos+1:], true
+}
+
+// isTag checks if the token is the tag like `sshd:` or `sshd[42]:`.
+func isTag(token []byte) bool {
+	return len(token) > 1 && token[len(token)-1] == ':'
+}
@@ -0,0 +1,190 @@
+package parse_xml
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+/*{ introduction
+It decodes an XML document from the event field into the nested objects and merges the result with the event root.
+The field is removed if it's decoded successfully, otherwise the event isn't changed.
+
+The elements are converted this way:
+* the element with neither attributes nor children becomes a string of its text
+* the attributes become the fields named `attr_prefix` + the attribute name
+* the children become the fields named by their names, the repeated children are folded into an array
+* the text of the element with attributes or children becomes the `text_key` field
+
+The namespace prefixes are dropped from the names.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: parse_xml
+      field: message
+    ...
+```
+
+The original event:
+```json
+{
+  "message": "<Event><System><EventID>4624</EventID><Level>0</Level></System><EventData><Data Name=\"TargetUserName\">bob</Data><Data Name=\"LogonType\">3</Data></EventData></Event>"
+}
+```
+
+The resulting event:
+```json
+{
+  "Event": {
+    "System": {
+      "EventID": "4624",
+      "Level": "0"
+    },
+    "EventData": {
+      "Data": [
+        {"@Name": "TargetUserName", "#text": "bob"},
+        {"@Name": "LogonType", "#text": "3"}
+      ]
+    }
+  }
+}
+```
+}*/
+
+type Plugin struct {
+	config     *Config
+	forceArray map[string]bool
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field to decode. Must be a string.
+	Field  cfg.FieldSelector `json:"field" default:"message" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The object to put the decoded root element to. The root element is merged with the event root by default.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > A prefix to add to the attribute names.
+	AttrPrefix string `json:"attr_prefix" default:"@"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field name of the text of the elements with attributes or children.
+	TextKey string `json:"text_key" default:"#text"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The names of the elements which are always folded into an array even if there is the single one.
+	ForceArray []string `json:"force_array" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the decoded field isn't removed.
+	KeepField bool `json:"keep_field" default:"false"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "parse_xml",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.forceArray = cfg.ListToMap(p.config.ForceArray)
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	jsonNode := event.Root.Dig(p.config.Field_...)
+	if jsonNode == nil {
+		return pipeline.ActionPass
+	}
+
+	root, err := parse(jsonNode.AsBytes())
+	if err != nil {
+		return pipeline.ActionPass
+	}
+
+	if !p.config.KeepField {
+		jsonNode.Suicide()
+	}
+
+	target := pipeline.CreateNestedField(event.Root, p.config.Target_)
+	p.putChildren(event.Root, target, []*element{root})
+
+	return pipeline.ActionPass
+}
+
+// putChildren adds the elements to the object, the elements with the same name are folded into an array.
+func (p *Plugin) putChildren(root *insaneJSON.Root, node *insaneJSON.Node, children []*element) {
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+
+		var same []*element
+		for j := i + 1; j < len(children); j++ {
+			if children[j] != nil && children[j].name == child.name {
+				if same == nil {
+					same = []*element{child}
+				}
+				same = append(same, children[j])
+				children[j] = nil
+			}
+		}
+
+		field := node.AddFieldNoAlloc(root, child.name)
+		if same == nil && !p.forceArray[child.name] {
+			p.put(root, field, child)
+			continue
+		}
+		if same == nil {
+			same = []*element{child}
+		}
+
+		field.MutateToArray()
+		for _, e := range same {
+			p.put(root, field.AddElementNoAlloc(root), e)
+		}
+	}
+}
+
+func (p *Plugin) put(root *insaneJSON.Root, node *insaneJSON.Node, e *element) {
+	if len(e.attrs) == 0 && len(e.children) == 0 {
+		node.MutateToBytesCopy(root, e.text)
+		return
+	}
+
+	node.MutateToObject()
+	for _, attr := range e.attrs {
+		node.AddFieldNoAlloc(root, p.config.AttrPrefix+attr.Name.Local).MutateToBytesCopy(root, pipeline.StringToByteUnsafe(attr.Value))
+	}
+	p.putChildren(root, node, e.children)
+	if len(e.text) > 0 {
+		node.AddFieldNoAlloc(root, p.config.TextKey).MutateToBytesCopy(root, e.text)
+	}
+}
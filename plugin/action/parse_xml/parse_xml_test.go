@@ -0,0 +1,80 @@
+package parse_xml
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"not_xml":    "not xml",
+		"unclosed":   "<a><b></b>",
+		"mismatched": "<a></b>",
+		"many_roots": "<a/><b/>",
+	} {
+		_, err := parse([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestDo(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		in       string
+		expected string
+	}{
+		{
+			name:     "windows_event",
+			config:   &Config{},
+			in:       `{"message":"<?xml version=\"1.0\" encoding=\"UTF-16\"?><Event xmlns=\"http://schemas.microsoft.com/win/2004/08/events/event\"><System><Provider Name=\"Security\"/><EventID>4624</EventID></System><EventData><Data Name=\"User\">bob</Data><Data Name=\"LogonType\">3</Data></EventData></Event>","host":"a"}`,
+			expected: `{"host":"a","Event":{"System":{"Provider":{"@Name":"Security"},"EventID":"4624"},"EventData":{"Data":[{"@Name":"User","#text":"bob"},{"@Name":"LogonType","#text":"3"}]}}}`,
+		},
+		{
+			name:     "target_and_force_array",
+			config:   &Config{Target: "xml", AttrPrefix: "-", TextKey: "value", ForceArray: []string{"item"}},
+			in:       `{"message":"<soap:Envelope xmlns:soap=\"http://www.w3.org/2003/05/soap-envelope\"><soap:Body id=\"1\">text <item>a</item></soap:Body></soap:Envelope>"}`,
+			expected: `{"xml":{"Envelope":{"Body":{"-id":"1","item":["a"],"value":"text"}}}}`,
+		},
+		{
+			name:     "keep_field",
+			config:   &Config{KeepField: true},
+			in:       `{"message":"<a>x</a>"}`,
+			expected: `{"message":"<a>x</a>","a":"x"}`,
+		},
+		{
+			name:     "not_xml",
+			config:   &Config{},
+			in:       `{"message":"<a><b></a>"}`,
+			expected: `{"message":"<a><b></a>"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			require.NotEmpty(t, outEvent)
+			assert.Equal(t, tc.expected, outEvent)
+		})
+	}
+}
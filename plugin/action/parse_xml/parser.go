@@ -0,0 +1,86 @@
+package parse_xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// maxDepth limits the nesting of the elements.
+const maxDepth = 128
+
+var (
+	errNoRoot   = errors.New("no root element found")
+	errTooDeep  = errors.New("elements are nested too deep")
+	errManyRoot = errors.New("more than one root element found")
+)
+
+type element struct {
+	name     string
+	attrs    []xml.Attr
+	children []*element
+	text     []byte
+}
+
+// parse decodes the XML document into the tree of the elements.
+// The namespaces are dropped from the names, the namespace declarations are skipped.
+func parse(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// the data is already decoded to UTF-8 by the JSON decoder, so the declared charset is ignored.
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var root *element
+	stack := make([]*element, 0, 16)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) == maxDepth {
+				return nil, errTooDeep
+			}
+
+			e := &element{name: t.Name.Local}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				e.attrs = append(e.attrs, xml.Attr{Name: xml.Name{Local: attr.Name.Local}, Value: attr.Value})
+			}
+
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, errManyRoot
+				}
+				root = e
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			e.text = bytes.TrimSpace(e.text)
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				e := stack[len(stack)-1]
+				e.text = append(e.text, t...)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errNoRoot
+	}
+	return root, nil
+}
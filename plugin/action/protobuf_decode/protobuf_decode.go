@@ -0,0 +1,197 @@
+package protobuf_decode
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/protoschema"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+/*{ introduction
+It decodes the protobuf message from the event field and merges the result with the event root or puts it into the `target` field.
+The message is described by the file descriptor set made by `protoc --include_imports --descriptor_set_out`.
+
+The message is converted to JSON according to the protobuf JSON mapping, e.g. the 64-bit integers are written as strings
+and the bytes are written as base64 strings. The source field is removed only if the decoding succeeds,
+the failed events are counted in the `protobuf_decode_errors_total` metric.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: protobuf_decode
+      field: payload
+      proto_descriptor_set: /etc/file.d/events.desc
+      proto_message: events.v1.Event
+      target: event
+    ...
+```
+}*/
+
+const (
+	encodingBase64 = "base64"
+
+	onErrorDiscard = "discard"
+)
+
+type Plugin struct {
+	config  *Config
+	logger  *zap.SugaredLogger
+	message *dynamicpb.Message
+	marshal protojson.MarshalOptions
+
+	buf []byte
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field with the protobuf message.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" required:"true"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The encoding of the field:
+	// > * `base64` – the message is encoded with the standard base64
+	// > * `raw` – the field contains the message bytes as is
+	Encoding string `json:"encoding" default:"base64" options:"base64|raw"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path to the file descriptor set of the protobuf schema made by `protoc --include_imports --descriptor_set_out`.
+	ProtoDescriptorSet string `json:"proto_descriptor_set" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The full name of the protobuf message, e.g. `events.v1.Event`.
+	ProtoMessage string `json:"proto_message" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the decoded message into, the decoded message is merged with the event root if it's empty.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > If set, the field names of the proto file are used instead of the lower camel case JSON names.
+	UseProtoNames bool `json:"use_proto_names"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the fields with the default values are written too.
+	EmitDefaults bool `json:"emit_defaults"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the message can't be decoded:
+	// > * `keep` passes the event unchanged
+	// > * `discard` discards the event
+	OnError string `json:"on_error" default:"keep" options:"keep|discard"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "protobuf_decode",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	desc, err := protoschema.LoadMessage(p.config.ProtoDescriptorSet, p.config.ProtoMessage)
+	if err != nil {
+		p.logger.Fatalf("can't load proto message: %s", err.Error())
+	}
+	p.message = dynamicpb.NewMessage(desc)
+	p.marshal = protojson.MarshalOptions{
+		UseProtoNames:   p.config.UseProtoNames,
+		EmitUnpopulated: p.config.EmitDefaults,
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("protobuf_decode_errors_total", "Number of events protobuf_decode plugin failed to decode")
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	fieldNode := event.Root.Dig(p.config.Field_...)
+	if fieldNode == nil {
+		return pipeline.ActionPass
+	}
+
+	node, err := p.decode(event, fieldNode.AsBytes())
+	if err != nil {
+		p.logger.Debugf("can't decode protobuf message: %s", err.Error())
+		if p.errorsMetric != nil {
+			p.errorsMetric.WithLabelValues().Inc()
+		}
+		if p.config.OnError == onErrorDiscard {
+			return pipeline.ActionDiscard
+		}
+		return pipeline.ActionPass
+	}
+
+	fieldNode.Suicide()
+
+	if len(p.config.Target_) == 0 {
+		// place decoded object under root
+		event.Root.MergeWith(node)
+		return pipeline.ActionPass
+	}
+
+	pipeline.AddField(event.Root, p.config.Target_).MutateToNode(node)
+
+	return pipeline.ActionPass
+}
+
+func (p *Plugin) decode(event *pipeline.Event, data []byte) (*insaneJSON.Node, error) {
+	if p.config.Encoding == encodingBase64 {
+		size := base64.StdEncoding.DecodedLen(len(data))
+		if cap(p.buf) < size {
+			p.buf = make([]byte, size)
+		}
+		n, err := base64.StdEncoding.Decode(p.buf[:size], data)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode base64: %w", err)
+		}
+		data = p.buf[:n]
+	}
+
+	p.message.Reset()
+	if err := proto.Unmarshal(data, p.message); err != nil {
+		return nil, err
+	}
+
+	json, err := p.marshal.Marshal(p.message)
+	if err != nil {
+		return nil, err
+	}
+	return event.SubparseJSON(json)
+}
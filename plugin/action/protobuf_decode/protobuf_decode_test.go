@@ -0,0 +1,140 @@
+package protobuf_decode
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func writeDescriptorSet(t *testing.T) string {
+	field := func(name, jsonName string, number int32, kind descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{Name: proto.String(name), JsonName: proto.String(jsonName), Number: proto.Int32(number), Type: kind.Enum(), Label: label.Enum()}
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("events.proto"),
+		Package: proto.String("events"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("user_id", "userId", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+				field("code", "code", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional),
+				field("tags", "tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated),
+			},
+		}},
+	}}}
+	b, err := proto.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "events.desc")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+	return path
+}
+
+func TestDecode(t *testing.T) {
+	var message []byte
+	message = protowire.AppendTag(message, 1, protowire.BytesType)
+	message = protowire.AppendString(message, "u-1")
+	message = protowire.AppendTag(message, 2, protowire.VarintType)
+	message = protowire.AppendVarint(message, 42)
+	message = protowire.AppendTag(message, 3, protowire.BytesType)
+	message = protowire.AppendString(message, "a")
+	message = protowire.AppendTag(message, 3, protowire.BytesType)
+	message = protowire.AppendString(message, "b")
+	encoded := base64.StdEncoding.EncodeToString(message)
+
+	path := writeDescriptorSet(t)
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+		result pipeline.ActionResult
+	}{
+		{
+			name:   "merge",
+			config: &Config{Field: "payload", ProtoDescriptorSet: path, ProtoMessage: "events.Event"},
+			in:     `{"level":"info","payload":"` + encoded + `"}`,
+			out:    `{"level":"info","userId":"u-1","code":42,"tags":["a","b"]}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "target and proto names",
+			config: &Config{Field: "payload", ProtoDescriptorSet: path, ProtoMessage: "events.Event", Target: "event.data", UseProtoNames: true},
+			in:     `{"payload":"` + encoded + `"}`,
+			out:    `{"event":{"data":{"user_id":"u-1","code":42,"tags":["a","b"]}}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "emit defaults",
+			config: &Config{Field: "payload", ProtoDescriptorSet: path, ProtoMessage: "events.Event", Target: "event", EmitDefaults: true},
+			in:     `{"payload":""}`,
+			out:    `{"event":{"userId":"","code":0,"tags":[]}}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "wrong base64",
+			config: &Config{Field: "payload", ProtoDescriptorSet: path, ProtoMessage: "events.Event"},
+			in:     `{"payload":"%%%"}`,
+			out:    `{"payload":"%%%"}`,
+			result: pipeline.ActionPass,
+		},
+		{
+			name:   "wrong message",
+			config: &Config{Field: "payload", ProtoDescriptorSet: path, ProtoMessage: "events.Event", OnError: "discard"},
+			in:     `{"payload":"` + base64.StdEncoding.EncodeToString([]byte{0x0a, 0x10}) + `"}`,
+			result: pipeline.ActionDiscard,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			var plugin *Plugin
+			pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+				plugin = &Plugin{}
+				return plugin, &Config{}
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			assert.Equal(t, tc.result == pipeline.ActionPass, ok, "wrong discard")
+			if ok {
+				assert.Equal(t, tc.out, out)
+			}
+			if tc.result == pipeline.ActionDiscard {
+				assert.Equal(t, float64(1), testutil.ToFloat64(plugin.errorsMetric))
+			}
+		})
+	}
+}
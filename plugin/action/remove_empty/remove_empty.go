@@ -0,0 +1,150 @@
+package remove_empty
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It removes the fields with the empty values: the empty strings, `null`, the empty objects and the empty arrays,
+to shrink the events before indexing.
+
+If `recursive` is set, the nested objects including the objects inside the arrays are cleaned too
+and the objects which become empty are removed. The array elements aren't removed.
+The order of the remaining fields may change.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: remove_empty
+      recursive: true
+    ...
+```
+The event:
+```json
+{"message":"hi","user":"","tags":[],"k8s":{"labels":{},"pod":null},"items":[{"id":null}],"count":0}
+```
+becomes:
+```json
+{"message":"hi","count":0,"items":[{}]}
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	fields [][]string
+	// nodes is the stack of the fields of the cleaned objects since the removal changes the fields
+	nodes []*insaneJSON.Node
+
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The fields to check, the whole event is checked if it's empty.
+	Fields []string `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Whether to clean the nested objects.
+	Recursive bool `json:"recursive"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "remove_empty",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	for _, field := range p.config.Fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in fields")
+		}
+		p.fields = append(p.fields, path)
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	if len(p.fields) == 0 {
+		p.clean(event.Root.Node)
+		return pipeline.ActionPass
+	}
+
+	for _, path := range p.fields {
+		node := event.Root.Dig(path...)
+		if node == nil {
+			continue
+		}
+		if p.config.Recursive {
+			p.clean(node)
+		}
+		if isEmpty(node) {
+			event.Root.Dig(path...).Suicide()
+		}
+	}
+
+	return pipeline.ActionPass
+}
+
+// clean removes the empty fields of the object, the nested objects are cleaned if it's recursive.
+func (p *Plugin) clean(node *insaneJSON.Node) {
+	switch {
+	case node.IsArray():
+		for _, element := range node.AsArray() {
+			p.clean(element)
+		}
+	case node.IsObject():
+		start := len(p.nodes)
+		p.nodes = append(p.nodes, node.AsFields()...)
+		for _, field := range p.nodes[start:] {
+			value := field.AsFieldValue()
+			if p.config.Recursive {
+				p.clean(value)
+			}
+			if isEmpty(value) {
+				// the value is dug to actualize its index since the removal of its fields breaks it
+				node.Dig(field.AsString()).Suicide()
+			}
+		}
+		p.nodes = p.nodes[:start]
+	}
+}
+
+func isEmpty(node *insaneJSON.Node) bool {
+	switch {
+	case node.IsNull():
+		return true
+	case node.IsString():
+		return node.AsString() == ""
+	case node.IsObject():
+		return len(node.AsFields()) == 0
+	case node.IsArray():
+		return len(node.AsArray()) == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+package remove_empty
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveEmpty(t *testing.T) {
+	in := `{"message":"hi","user":"","tags":[],"k8s":{"labels":{},"pod":null},"items":[{"id":null},""],"count":0,"ok":false}`
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+	}{
+		{
+			name:   "top level",
+			config: &Config{},
+			in:     in,
+			out:    `{"message":"hi","ok":false,"count":0,"k8s":{"labels":{},"pod":null},"items":[{"id":null},""]}`,
+		},
+		{
+			name:   "recursive",
+			config: &Config{Recursive: true},
+			in:     in,
+			out:    `{"message":"hi","ok":false,"count":0,"items":[{},""]}`,
+		},
+		{
+			name:   "fields",
+			config: &Config{Fields: []string{"k8s.labels", "user", "items", "missing"}},
+			in:     in,
+			out:    `{"message":"hi","ok":false,"tags":[],"k8s":{"pod":null},"items":[{"id":null},""],"count":0}`,
+		},
+		{
+			name:   "recursive fields",
+			config: &Config{Fields: []string{"k8s", "items"}, Recursive: true},
+			in:     in,
+			out:    `{"message":"hi","user":"","tags":[],"ok":false,"items":[{},""],"count":0}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
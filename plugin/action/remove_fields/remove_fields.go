@@ -1,19 +1,36 @@
 package remove_fields
 
 import (
+	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
 )
 
 /*{ introduction
 It removes the list of the event fields and keeps others.
+
+The fields are the selectors like `request.headers.authorization`, the dots in the field names are escaped
+like `k8s_label_app\.kubernetes\.io`. The `*` matches any field of the object or any element of the array,
+e.g. `kubernetes.labels.*` removes all the labels and `items.*.secret` removes the field of all the items.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: remove_fields
+      fields: [request.headers.authorization, kubernetes.annotations.*]
+    ...
+```
 }*/
 
 type Plugin struct {
-	config    *Config
-	fieldsBuf []string
+	config *Config
+	fields [][]string
 	plugin.NoMetricsPlugin
 }
 
@@ -22,7 +39,7 @@ type Plugin struct {
 type Config struct {
 	// > @3@4@5@6
 	// >
-	// > The list of the fields to remove.
+	// > The list of the field selectors to remove, `*` matches any field.
 	Fields []string `json:"fields"` // *
 }
 
@@ -42,21 +59,60 @@ func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams
 	if p.config == nil {
 		logger.Panicf("config is nil for the remove fields plugin")
 	}
+
+	for _, field := range p.config.Fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			logger.Panicf("empty field in fields")
+		}
+		p.fields = append(p.fields, path)
+	}
 }
 
 func (p *Plugin) Stop() {
 }
 
 func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
-	p.fieldsBuf = p.fieldsBuf[:0]
-
 	if !event.Root.IsObject() {
 		return pipeline.ActionPass
 	}
 
-	for _, field := range p.config.Fields {
-		event.Root.Dig(field).Suicide()
+	for _, path := range p.fields {
+		p.remove(event.Root.Node, path)
 	}
 
 	return pipeline.ActionPass
 }
+
+// remove removes the fields of the node matching the path, `*` matches any field or element.
+// The fields are dug right before the removal to actualize their indexes since the removal of the nested fields breaks them.
+func (p *Plugin) remove(node *insaneJSON.Node, path []string) {
+	name, last := path[0], len(path) == 1
+	if name != "*" {
+		child := node.Dig(name)
+		if child == nil {
+			return
+		}
+		if last {
+			child.Suicide()
+		} else {
+			p.remove(child, path[1:])
+		}
+		return
+	}
+
+	switch {
+	case last && node.IsObject():
+		node.MutateToObject()
+	case last && node.IsArray():
+		node.MutateToArray()
+	case node.IsObject():
+		for _, field := range node.AsFields() {
+			p.remove(field.AsFieldValue(), path[1:])
+		}
+	case node.IsArray():
+		for _, element := range node.AsArray() {
+			p.remove(element, path[1:])
+		}
+	}
+}
@@ -32,3 +32,42 @@ func TestRemoveFields(t *testing.T) {
 	assert.Equal(t, `{"b":"c"}`, outEvents[1].Root.EncodeToString(), "wrong event")
 	assert.Equal(t, `{"field_3":"value_3","a":"b"}`, outEvents[2].Root.EncodeToString(), "wrong event")
 }
+
+func TestRemoveNestedFields(t *testing.T) {
+	in := `{"message":"hi","request":{"headers":{"authorization":"secret","host":"h"}},"kubernetes":{"labels":{"a":"1","b":"2"},"pod":"p"},"items":[{"id":1,"secret":"x"},{"id":2}],"tags":["a","b"],"a.b":1}`
+	cases := []struct {
+		fields []string
+		out    string
+	}{
+		{
+			fields: []string{"request.headers.authorization", "kubernetes.labels.*", "missing.field", "message.x"},
+			out:    `{"message":"hi","request":{"headers":{"host":"h"}},"kubernetes":{"labels":{},"pod":"p"},"items":[{"id":1,"secret":"x"},{"id":2}],"tags":["a","b"],"a.b":1}`,
+		},
+		{
+			fields: []string{"items.*.secret", "tags.*", `a\.b`},
+			out:    `{"message":"hi","request":{"headers":{"authorization":"secret","host":"h"}},"kubernetes":{"labels":{"a":"1","b":"2"},"pod":"p"},"items":[{"id":1},{"id":2}],"tags":[]}`,
+		},
+		{
+			fields: []string{"*.labels", "items.1", "kubernetes"},
+			out:    `{"message":"hi","request":{"headers":{"authorization":"secret","host":"h"}},"a.b":1,"items":[{"id":1,"secret":"x"}],"tags":["a","b"]}`,
+		},
+	}
+	for _, tc := range cases {
+		p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, &Config{Fields: tc.fields}, pipeline.MatchModeAnd, nil, false))
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		outEvent := ""
+		output.SetOutFn(func(e *pipeline.Event) {
+			outEvent = e.Root.EncodeToString()
+			wg.Done()
+		})
+
+		input.In(0, "test.log", 0, []byte(in))
+
+		wg.Wait()
+		p.Stop()
+
+		assert.Equal(t, tc.out, outEvent, tc.fields)
+	}
+}
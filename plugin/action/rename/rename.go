@@ -1,10 +1,19 @@
 package rename
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
 )
 
 /*{ introduction
@@ -12,6 +21,13 @@ It renames the fields of the event. You can provide an unlimited number of confi
 When `override` is set to `false`, the field won't be renamed in the case of field name collision.
 Sequence of rename operations isn't guaranteed. Use different actions for prioritization.
 
+The `regex` parameter renames the top level fields matching the regular expressions, the targets may contain
+the capture groups like `$1` or `${name}`. The expressions are checked in the lexicographical order, the first matching one is used.
+The `case` parameter normalizes the keys of the event including the nested ones to `snake` (`request_id`),
+`camel` (`requestId`) or `lower` (`requestid`) case.
+The fields are renamed first, then the regular expressions are applied, then the case is normalized.
+The fields named `override`, `regex` or `case` are renamed with the `_` prefix, e.g. `_case: kind`.
+
 **Example:**
 ```yaml
 pipelines:
@@ -33,12 +49,46 @@ The resulting event could look like:
     }
   },
 ```
+
+Unifying the field names of the different producers:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: rename
+      regex:
+        "^x-(.+)$": header_$1
+        "^(?:msg|text)$": message
+      case: snake
+    ...
+```
+It transforms `{"x-Request-ID":"1","msg":"hi","userInfo":{"firstName":"a"}}`
+into `{"header_request_id":"1","message":"hi","user_info":{"first_name":"a"}}`.
 }*/
 
+const (
+	caseSnake = "snake"
+	caseCamel = "camel"
+	caseLower = "lower"
+)
+
+type pattern struct {
+	re     *regexp.Regexp
+	target string
+}
+
 type Plugin struct {
 	paths          [][]string
 	names          []string
 	preserveFields bool
+
+	patterns []pattern
+	keyCase  func(string) string
+	// fields is the stack of the fields of the renamed objects since the renaming changes the fields
+	fields []*insaneJSON.Node
+	buf    []byte
+
 	plugin.NoMetricsPlugin
 }
 
@@ -55,7 +105,7 @@ func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 	return &Plugin{}, &Config{}
 }
 
-func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
 	sharedConfig := *config.(*Config)
 	localConfig := make(map[string]any, len(sharedConfig)) // clone shared config to be able to modify it
 	for k, v := range sharedConfig {
@@ -65,6 +115,30 @@ func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams
 	p.preserveFields = localConfig["override"] == nil || !localConfig["override"].(bool)
 
 	delete(localConfig, "override")
+
+	if regex, has := localConfig["regex"]; has {
+		delete(localConfig, "regex")
+		patterns, err := parsePatterns(regex)
+		if err != nil {
+			params.Logger.Fatalf("wrong regex: %s", err.Error())
+		}
+		p.patterns = patterns
+	}
+
+	if keyCase, has := localConfig["case"]; has {
+		delete(localConfig, "case")
+		switch keyCase {
+		case caseSnake:
+			p.keyCase = toSnake
+		case caseCamel:
+			p.keyCase = toCamel
+		case caseLower:
+			p.keyCase = strings.ToLower
+		default:
+			params.Logger.Fatalf("wrong case %v, it must be one of snake, camel or lower", keyCase)
+		}
+	}
+
 	m := cfg.UnescapeMap(localConfig)
 
 	for path, name := range m {
@@ -94,5 +168,157 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 		event.Root.AddFieldNoAlloc(event.Root, p.names[index]).MutateToNode(node)
 	}
 
+	if len(p.patterns) > 0 {
+		p.renameByPatterns(event.Root.Node)
+	}
+	if p.keyCase != nil {
+		p.normalizeCase(event.Root.Node)
+	}
+
 	return pipeline.ActionPass
 }
+
+func (p *Plugin) renameByPatterns(node *insaneJSON.Node) {
+	start := len(p.fields)
+	p.fields = append(p.fields, node.AsFields()...)
+	for _, field := range p.fields[start:] {
+		name := field.AsString()
+		for _, pt := range p.patterns {
+			match := pt.re.FindStringSubmatchIndex(name)
+			if match == nil {
+				continue
+			}
+			p.buf = pt.re.ExpandString(p.buf[:0], pt.target, name, match)
+			p.renameField(node, field, string(p.buf))
+			break
+		}
+	}
+	p.fields = p.fields[:start]
+}
+
+// normalizeCase normalizes the keys of the objects including the objects inside the arrays.
+func (p *Plugin) normalizeCase(node *insaneJSON.Node) {
+	switch {
+	case node.IsArray():
+		for _, element := range node.AsArray() {
+			p.normalizeCase(element)
+		}
+	case node.IsObject():
+		start := len(p.fields)
+		p.fields = append(p.fields, node.AsFields()...)
+		for _, field := range p.fields[start:] {
+			p.normalizeCase(field.AsFieldValue())
+			p.renameField(node, field, p.keyCase(field.AsString()))
+		}
+		p.fields = p.fields[:start]
+	}
+}
+
+// renameField renames the field of the object, the existing field with the name is replaced if it's allowed.
+func (p *Plugin) renameField(object *insaneJSON.Node, field *insaneJSON.Node, name string) {
+	current := field.AsString()
+	if name == current || name == "" {
+		return
+	}
+	// the field may be already replaced by the other renamed field
+	if object.Dig(current) != field.AsFieldValue() {
+		return
+	}
+
+	if existing := object.Dig(name); existing != nil {
+		if p.preserveFields {
+			return
+		}
+		existing.Suicide()
+	}
+	field.MutateToField(name)
+}
+
+// parsePatterns parses the map of the regular expressions to the targets.
+func parsePatterns(regex any) ([]pattern, error) {
+	targets := make(map[string]string)
+	switch m := regex.(type) {
+	case map[string]string:
+		targets = m
+	case map[string]any:
+		for expr, target := range m {
+			s, ok := target.(string)
+			if !ok {
+				return nil, fmt.Errorf("target of %q isn't a string", expr)
+			}
+			targets[expr] = s
+		}
+	default:
+		return nil, errors.New("regex must be a map of the regular expressions to the targets")
+	}
+
+	exprs := make([]string, 0, len(targets))
+	for expr := range targets {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+
+	patterns := make([]pattern, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern{re: re, target: targets[expr]})
+	}
+	return patterns, nil
+}
+
+// words splits the key to the words by the non-alphanumeric characters and the case changes,
+// e.g. `HTTPRequest-id` is `HTTP`, `Request` and `id`.
+func words(key string) []string {
+	runes := []rune(key)
+	result := make([]string, 0, 4)
+	start := -1
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				result = append(result, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			continue
+		}
+
+		prev := runes[i-1]
+		lowerToUpper := unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev))
+		acronymEnd := unicode.IsUpper(r) && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd {
+			result = append(result, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start >= 0 {
+		result = append(result, string(runes[start:]))
+	}
+	return result
+}
+
+func toSnake(key string) string {
+	ws := words(key)
+	for i, w := range ws {
+		ws[i] = strings.ToLower(w)
+	}
+	return strings.Join(ws, "_")
+}
+
+func toCamel(key string) string {
+	ws := words(key)
+	for i, w := range ws {
+		w = strings.ToLower(w)
+		if i > 0 {
+			r, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(r)) + w[size:]
+		}
+		ws[i] = w
+	}
+	return strings.Join(ws, "")
+}
@@ -49,3 +49,71 @@ func TestRename(t *testing.T) {
 	assert.Nil(t, outEvents[3].Root.Dig("field_4", "field_5"), "field isn't nil")
 	assert.Nil(t, outEvents[4].Root.Dig("k8s_node_label_topology\\.kubernetes\\.io/zone"), "field isn't nil")
 }
+
+func TestRenameRegexAndCase(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+	}{
+		{
+			name: "regex",
+			config: &Config{
+				"regex": map[string]any{`^x-(.+)$`: "header_$1", `^(?:msg|text)$`: "message", `^(?P<kind>[a-z]+)_id$`: "${kind}ID"},
+			},
+			in:  `{"x-Request-ID":"1","msg":"hi","user_id":2,"k8s":{"x-a":1}}`,
+			out: `{"header_Request-ID":"1","message":"hi","userID":2,"k8s":{"x-a":1}}`,
+		},
+		{
+			name:   "collision preserved",
+			config: &Config{"regex": map[string]any{`^(?:msg|text)$`: "message"}},
+			in:     `{"msg":"a","text":"b","message":"c"}`,
+			out:    `{"msg":"a","text":"b","message":"c"}`,
+		},
+		{
+			name:   "collision overridden",
+			config: &Config{"regex": map[string]any{`^(?:msg|text)$`: "message"}, "override": true},
+			in:     `{"msg":"a","text":"b","level":"info"}`,
+			out:    `{"level":"info","message":"b"}`,
+		},
+		{
+			name:   "snake",
+			config: &Config{"case": "snake", "_case": "kind"},
+			in:     `{"case":"c","userInfo":{"firstName":"a","HTTPServer":1,"items":[{"item-ID":1}]},"k8s.pod.Name":"p","already_snake":1}`,
+			out:    `{"already_snake":1,"user_info":{"first_name":"a","http_server":1,"items":[{"item_id":1}]},"k8s_pod_name":"p","kind":"c"}`,
+		},
+		{
+			name:   "camel",
+			config: &Config{"case": "camel"},
+			in:     `{"user_info":{"first-name":"a"},"HTTPServer":1,"x2y":2}`,
+			out:    `{"userInfo":{"firstName":"a"},"httpServer":1,"x2y":2}`,
+		},
+		{
+			name:   "lower",
+			config: &Config{"case": "lower"},
+			in:     `{"User":{"FirstName":"a"}}`,
+			out:    `{"user":{"firstname":"a"}}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, tc.config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package resolve_dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It resolves the IP address of the `field` to the host name or the host name to the IP address
+and puts the result to the `target` field. The event isn't changed if the value can't be resolved.
+
+The results are cached by all the processors of the pipeline: the resolved values for `cache_ttl`
+and the values which can't be resolved for `negative_cache_ttl`. The failed lookups, e.g. timed out, aren't cached.
+The number of the concurrent lookups is limited by `max_concurrency`,
+the event waits for a free slot no longer than `timeout`.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: resolve_dns
+      field: client_ip
+      target: client_host
+    ...
+```
+The resulting event:
+```json
+{
+  "client_ip": "8.8.8.8",
+  "client_host": "dns.google"
+}
+```
+}*/
+
+const (
+	modeReverse = "reverse"
+	modeForward = "forward"
+)
+
+var (
+	resolvers   = map[*Config]*resolverRef{}
+	resolversMu = &sync.Mutex{}
+)
+
+type resolverRef struct {
+	resolver *resolver
+	refs     int
+}
+
+type Plugin struct {
+	config   *Config
+	logger   *zap.SugaredLogger
+	resolver *resolver
+
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The event field with the value to resolve.
+	Field  cfg.FieldSelector `json:"field" required:"true" parse:"selector"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field to put the resolved value to.
+	Target  cfg.FieldSelector `json:"target" required:"true" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The direction of the lookup:
+	// > * `reverse` – the IP address is resolved to the host name
+	// > * `forward` – the host name is resolved to the first IP address
+	Mode string `json:"mode" default:"reverse" options:"reverse|forward"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How long to cache the resolved values.
+	CacheTTL  cfg.Duration `json:"cache_ttl" default:"5m" parse:"duration"` // *
+	CacheTTL_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How long to cache the values which can't be resolved.
+	NegativeCacheTTL  cfg.Duration `json:"negative_cache_ttl" default:"1m" parse:"duration"` // *
+	NegativeCacheTTL_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many values to cache, zero disables caching.
+	CacheSize int `json:"cache_size" default:"10000"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The maximum number of the concurrent lookups of all the processors.
+	MaxConcurrency int `json:"max_concurrency" default:"16"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of the lookup including waiting for a free slot.
+	Timeout  cfg.Duration `json:"timeout" default:"1s" parse:"duration"` // *
+	Timeout_ time.Duration
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "resolve_dns",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if p.config.MaxConcurrency <= 0 {
+		p.logger.Fatalf("max_concurrency must be positive")
+	}
+
+	var lookup lookupFunc
+	switch p.config.Mode {
+	case modeReverse:
+		lookup = net.DefaultResolver.LookupAddr
+	case modeForward:
+		lookup = func(ctx context.Context, host string) ([]string, error) {
+			return net.DefaultResolver.LookupHost(ctx, host)
+		}
+	default:
+		p.logger.Fatalf("unknown mode %q", p.config.Mode)
+	}
+
+	// the config is shared by the processors, so it identifies the resolver of the action.
+	resolversMu.Lock()
+	ref, ok := resolvers[p.config]
+	if !ok {
+		ref = &resolverRef{resolver: newResolver(p.config, lookup)}
+		resolvers[p.config] = ref
+	}
+	ref.refs++
+	p.resolver = ref.resolver
+	resolversMu.Unlock()
+}
+
+func (p *Plugin) Stop() {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+
+	ref := resolvers[p.config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(resolvers, p.config)
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.errorsMetric = ctl.RegisterCounter("resolve_dns_errors_total", "Number of failed lookups of resolve_dns plugin")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	node := event.Root.Dig(p.config.Field_...)
+	if node == nil {
+		return pipeline.ActionPass
+	}
+	key := node.AsString()
+	if key == "" {
+		return pipeline.ActionPass
+	}
+
+	value, found, err := p.resolver.resolve(key, time.Now())
+	if err != nil {
+		p.errorsMetric.WithLabelValues().Inc()
+		p.logger.Errorf("can't resolve %q: %s", key, err.Error())
+		return pipeline.ActionPass
+	}
+	if !found {
+		return pipeline.ActionPass
+	}
+
+	pipeline.CreateNestedField(event.Root, p.config.Target_).MutateToString(value)
+
+	return pipeline.ActionPass
+}
@@ -0,0 +1,146 @@
+package resolve_dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDNS struct {
+	mu      sync.Mutex
+	names   map[string][]string
+	lookups int
+	// the lookup waits for the channel to be closed if it's set
+	block chan struct{}
+}
+
+func (f *fakeDNS) lookup(_ context.Context, key string) ([]string, error) {
+	f.mu.Lock()
+	f.lookups++
+	f.mu.Unlock()
+
+	if f.block != nil {
+		<-f.block
+	}
+	if key == "timeout" {
+		return nil, &net.DNSError{Err: "timeout", Name: key, IsTimeout: true}
+	}
+	names, ok := f.names[key]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: key, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func TestResolveDNS(t *testing.T) {
+	dns := &fakeDNS{names: map[string][]string{
+		"8.8.8.8": {"dns.google."},
+		"1.1.1.1": {"one.one.one.one.", "1dot1dot1dot1.cloudflare-dns.com."},
+	}}
+	config := test.NewConfig(&Config{Field: "ip", Target: "host.name"}, nil).(*Config)
+	// the processors use the resolver of the config, so the fake one is used
+	resolversMu.Lock()
+	resolvers[config] = &resolverRef{resolver: newResolver(config, dns.lookup)}
+	resolversMu.Unlock()
+
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+
+	outEvents := make([]string, 0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents = append(outEvents, e.Root.EncodeToString())
+		wg.Done()
+	})
+
+	in := []string{`{"ip":"8.8.8.8"}`, `{"ip":"1.1.1.1"}`, `{"ip":"10.0.0.1"}`, `{"ip":"timeout"}`, `{"message":"8.8.8.8"}`}
+	send := func() {
+		wg.Add(len(in))
+		for _, event := range in {
+			input.In(0, "test.log", 0, []byte(event))
+		}
+		wg.Wait()
+	}
+
+	send()
+	assert.Equal(t, 4, dns.lookups)
+
+	// the resolved and not found values are cached, the failed lookups are retried
+	send()
+	assert.Equal(t, 5, dns.lookups)
+
+	p.Stop()
+
+	out := []string{
+		`{"ip":"8.8.8.8","host":{"name":"dns.google"}}`,
+		`{"ip":"1.1.1.1","host":{"name":"one.one.one.one"}}`,
+		`{"ip":"10.0.0.1"}`,
+		`{"ip":"timeout"}`,
+		`{"message":"8.8.8.8"}`,
+	}
+	assert.Equal(t, append(out, out...), outEvents)
+
+	resolversMu.Lock()
+	assert.NotContains(t, resolvers, config, "resolver isn't removed once the processors are stopped")
+	resolversMu.Unlock()
+}
+
+func TestResolverTTL(t *testing.T) {
+	dns := &fakeDNS{names: map[string][]string{"8.8.8.8": {"dns.google."}}}
+	config := &Config{Field: "ip", Target: "host", CacheTTL: "10m", NegativeCacheTTL: "1m"}
+	test.NewConfig(config, nil)
+	r := newResolver(config, dns.lookup)
+
+	now := time.Now()
+	for _, key := range []string{"8.8.8.8", "10.0.0.1"} {
+		_, _, err := r.resolve(key, now)
+		require.NoError(t, err)
+	}
+
+	// the negative entry expires first
+	now = now.Add(2 * time.Minute)
+	for _, key := range []string{"8.8.8.8", "10.0.0.1"} {
+		_, _, err := r.resolve(key, now)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, dns.lookups)
+
+	now = now.Add(10 * time.Minute)
+	value, found, err := r.resolve("8.8.8.8", now)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "dns.google", value)
+	assert.Equal(t, 4, dns.lookups)
+}
+
+func TestResolverConcurrency(t *testing.T) {
+	dns := &fakeDNS{names: map[string][]string{"8.8.8.8": {"dns.google."}}, block: make(chan struct{})}
+	config := &Config{Field: "ip", Target: "host", MaxConcurrency: 1, Timeout: "100ms"}
+	test.NewConfig(config, nil)
+	r := newResolver(config, dns.lookup)
+
+	done := make(chan struct{})
+	go func() {
+		_, _, _ = r.resolve("8.8.8.8", time.Now())
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		dns.mu.Lock()
+		defer dns.mu.Unlock()
+		return dns.lookups == 1
+	}, time.Second, time.Millisecond)
+
+	// the only slot is taken by the blocked lookup
+	_, _, err := r.resolve("8.8.8.8", time.Now())
+	assert.True(t, errors.Is(err, errNoSlot))
+
+	close(dns.block)
+	<-done
+}
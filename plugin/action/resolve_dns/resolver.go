@@ -0,0 +1,129 @@
+package resolve_dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lookupFunc resolves the key to the names or addresses.
+type lookupFunc func(ctx context.Context, key string) ([]string, error)
+
+var errNoSlot = errors.New("too many concurrent lookups")
+
+type cacheEntry struct {
+	value   string
+	found   bool
+	expires time.Time
+}
+
+// resolver resolves the keys and caches the results, it's shared by the processors of the action.
+// The number of the concurrent lookups is limited, the successful and the failed lookups are cached separately.
+type resolver struct {
+	lookup      lookupFunc
+	timeout     time.Duration
+	ttl         time.Duration
+	negativeTTL time.Duration
+	slots       chan struct{}
+
+	mu      sync.Mutex
+	genSize int
+	current map[string]cacheEntry
+	prev    map[string]cacheEntry
+}
+
+func newResolver(config *Config, lookup lookupFunc) *resolver {
+	genSize := config.CacheSize / 2
+	if config.CacheSize > 0 && genSize == 0 {
+		genSize = 1
+	}
+	return &resolver{
+		lookup:      lookup,
+		timeout:     config.Timeout_,
+		ttl:         config.CacheTTL_,
+		negativeTTL: config.NegativeCacheTTL_,
+		slots:       make(chan struct{}, config.MaxConcurrency),
+		genSize:     genSize,
+		current:     make(map[string]cacheEntry),
+		prev:        make(map[string]cacheEntry),
+	}
+}
+
+// resolve returns the first resolved value and false if the key can't be resolved.
+// The errors other than "not found" are returned to report them, they aren't cached to retry the lookup later.
+func (r *resolver) resolve(key string, now time.Time) (string, bool, error) {
+	if entry, ok := r.get(key, now); ok {
+		return entry.value, entry.found, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	select {
+	case r.slots <- struct{}{}:
+	case <-ctx.Done():
+		return "", false, errNoSlot
+	}
+	values, err := r.lookup(ctx, key)
+	<-r.slots
+
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil && len(values) > 0:
+		value := strings.TrimSuffix(values[0], ".")
+		r.set(strings.Clone(key), cacheEntry{value: value, found: true, expires: now.Add(r.ttl)})
+		return value, true, nil
+	case err == nil, errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		r.set(strings.Clone(key), cacheEntry{expires: now.Add(r.negativeTTL)})
+		return "", false, nil
+	default:
+		return "", false, err
+	}
+}
+
+func (r *resolver) get(key string, now time.Time) (cacheEntry, bool) {
+	if r.genSize == 0 {
+		return cacheEntry{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.current[key]
+	if !ok {
+		entry, ok = r.prev[key]
+		if ok {
+			delete(r.prev, key)
+			// the key may point to the event buffer
+			r.add(strings.Clone(key), entry)
+		}
+	}
+	if !ok || now.After(entry.expires) {
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (r *resolver) set(key string, entry cacheEntry) {
+	if r.genSize == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(key, entry)
+}
+
+// add puts the entry to the current generation, the full one becomes the previous generation.
+func (r *resolver) add(key string, entry cacheEntry) {
+	if _, ok := r.current[key]; !ok && len(r.current) >= r.genSize {
+		r.prev = r.current
+		r.current = make(map[string]cacheEntry, r.genSize)
+	}
+	r.current[key] = entry
+}
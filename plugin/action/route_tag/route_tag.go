@@ -0,0 +1,82 @@
+package route_tag
+
+import (
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+)
+
+/*{ introduction
+It marks an event with a route tag. It is used in a combination with `match_fields`/`match_mode` parameters
+and `accept_tags`/`reject_tags` parameters of the output to control which events the output receives.
+Route tags aren't a part of the event body.
+
+Output parameters:
+* `accept_tags` – the output receives only events marked with at least one of the tags
+* `reject_tags` – the output doesn't receive events marked with any of the tags, it has priority over `accept_tags`
+
+Events not passed to the output are discarded.
+
+**An example for sending only audit logs:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: route_tag
+      tag: audit
+      match_fields:
+        logger: /audit/
+    ...
+    output:
+      type: kafka
+      accept_tags: [audit]
+      ...
+```
+}*/
+
+type Plugin struct {
+	config *Config
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The route tag to mark the event with.
+	Tag string `json:"tag" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the previously set route tags of the event are removed.
+	Replace bool `json:"replace" default:"false"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "route_tag",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	if p.config.Replace {
+		event.ResetRouteTags()
+	}
+	event.AddRouteTag(p.config.Tag)
+
+	return pipeline.ActionPass
+}
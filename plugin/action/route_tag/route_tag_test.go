@@ -0,0 +1,100 @@
+package route_tag
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func TestRouteTag(t *testing.T) {
+	config := test.NewConfig(&Config{Tag: "audit"}, nil)
+	conds := pipeline.MatchConditions{
+		{
+			Field:  cfg.ParseFieldSelector("logger"),
+			Values: []string{"audit"},
+		},
+	}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, conds, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	tagged := atomic.NewInt32(0)
+	output.SetOutFn(func(e *pipeline.Event) {
+		if e.HasRouteTag("audit") {
+			tagged.Inc()
+		}
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"logger":"audit"}`))
+	input.In(0, "test.log", 0, []byte(`{"logger":"http"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	assert.Equal(t, int32(1), tagged.Load(), "wrong tagged events count")
+}
+
+func TestOutputRouteTagFilter(t *testing.T) {
+	cases := []struct {
+		name     string
+		filter   *pipeline.RouteTagFilter
+		in       []string
+		expected []string
+	}{
+		{
+			name:     "accept",
+			filter:   &pipeline.RouteTagFilter{AcceptTags: []string{"audit"}},
+			in:       []string{"http", "audit"},
+			expected: []string{"audit"},
+		},
+		{
+			name:     "reject",
+			filter:   &pipeline.RouteTagFilter{RejectTags: []string{"audit"}},
+			in:       []string{"audit", "http"},
+			expected: []string{"http"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{Tag: "audit"}, nil)
+			conds := pipeline.MatchConditions{
+				{
+					Field:  cfg.ParseFieldSelector("logger"),
+					Values: []string{"audit"},
+				},
+			}
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, conds, false), "passive")
+			p.SetOutput(&pipeline.OutputPluginInfo{
+				PluginStaticInfo:  &pipeline.PluginStaticInfo{Type: "devnull"},
+				PluginRuntimeInfo: &pipeline.PluginRuntimeInfo{Plugin: output},
+				RouteTagFilter:    tc.filter,
+			})
+
+			wg := &sync.WaitGroup{}
+			wg.Add(len(tc.expected))
+			outLoggers := make([]string, 0)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outLoggers = append(outLoggers, e.Root.Dig("logger").AsString())
+				wg.Done()
+			})
+
+			p.Start()
+			// the accepted event goes last, so the rejected one is already processed when it's received.
+			for _, logger := range tc.in {
+				input.In(0, "test.log", 0, []byte(`{"logger":"`+logger+`"}`))
+			}
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.expected, outLoggers, "wrong out events")
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package router
+
+import (
+	exprlang "github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/vm"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It evaluates the ordered routing rules and marks the event with the route tags of the matched rules.
+The outputs receive the events by the route tags with the `accept_tags`/`reject_tags` parameters,
+so all the routing logic of the pipeline is in one place.
+
+The rule conditions are the [expr](https://expr-lang.org/docs/language-definition) boolean expressions
+like in the `expr` action: the top level fields are the variables, the nested fields are accessed as `k8s.labels.app`
+and the missing fields are `nil`. The `_size` variable is the size of the event in bytes as it was read by the input.
+If the condition fails, e.g. it compares the string with the number, the rule doesn't match.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: router
+      rules:
+      - if: 'level == "error"'
+        route: alerts
+      - if: '_size > 1048576'
+        route: s3-archive
+      default_route: main
+    ...
+    outputs:
+    - type: kafka
+      accept_tags: [alerts]
+      ...
+    - type: s3
+      accept_tags: [s3-archive]
+      ...
+    - type: elasticsearch
+      accept_tags: [main]
+      ...
+```
+}*/
+
+const (
+	modeFirst = "first"
+	modeAll   = "all"
+
+	sizeVariable = "_size"
+)
+
+type rule struct {
+	condition *vm.Program
+	route     string
+}
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	rules  []rule
+	// names are the top level fields used in the conditions
+	names []string
+
+	vm  vm.VM
+	env map[string]any
+
+	routedMetric *prom.CounterVec
+	errorsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The ordered list of the rules. It's a list of objects:
+	// > * `if` – the boolean expression of the condition
+	// > * `route` – the route tag to mark the event with if the condition is `true`
+	Rules []RuleConfig `json:"rules" required:"true" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How the rules are applied:
+	// > * `first` – the event gets the route of the first matched rule
+	// > * `all` – the event gets the routes of all the matched rules
+	Mode string `json:"mode" default:"first" options:"first|all"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The route tag to mark the event with if no rule matches. The event isn't marked if it's empty.
+	DefaultRoute string `json:"default_route"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the route into, the routes are joined with the comma in the `all` mode.
+	// > The route isn't put into the event if it's empty.
+	RouteField  cfg.FieldSelector `json:"route_field" parse:"selector"` // *
+	RouteField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > If set, the previously set route tags of the event are removed.
+	Replace bool `json:"replace" default:"false"` // *
+}
+
+type RuleConfig struct {
+	If    string `json:"if"`
+	Route string `json:"route"`
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "router",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.env = make(map[string]any)
+
+	if len(p.config.Rules) == 0 {
+		p.logger.Fatalf("no rules")
+	}
+
+	names := make(map[string]bool)
+	for i, r := range p.config.Rules {
+		if r.If == "" || r.Route == "" {
+			p.logger.Fatalf("rule %d must have if and route", i)
+		}
+		condition, err := exprlang.Compile(r.If, exprlang.AsBool(), exprlang.AllowUndefinedVariables(), exprlang.Patch(&identifiers{names: names}))
+		if err != nil {
+			p.logger.Fatalf("can't compile condition of rule %d: %s", i, err.Error())
+		}
+		p.rules = append(p.rules, rule{condition: condition, route: r.Route})
+	}
+
+	for name := range names {
+		if name != sizeVariable {
+			p.names = append(p.names, name)
+		}
+	}
+}
+
+// identifiers collects the names of the variables.
+type identifiers struct {
+	names map[string]bool
+}
+
+func (v *identifiers) Visit(node *ast.Node) {
+	if n, ok := (*node).(*ast.IdentifierNode); ok {
+		v.names[n.Value] = true
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.routedMetric = ctl.RegisterCounter("router_routed_total", "Number of events marked with the route", "route")
+	p.errorsMetric = ctl.RegisterCounter("router_errors_total", "Number of failed rule condition evaluations")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	// only the fields used in the conditions are converted
+	for _, name := range p.names {
+		node := event.Root.Dig(name)
+		if node == nil {
+			delete(p.env, name)
+			continue
+		}
+		p.env[name] = pipeline.NodeArithmeticValue(node)
+	}
+	p.env[sizeVariable] = event.Size
+
+	if p.config.Replace {
+		event.ResetRouteTags()
+	}
+
+	routed := 0
+	start := len(event.Buf)
+	for i := range p.rules {
+		r := &p.rules[i]
+		matched, err := p.vm.Run(r.condition, p.env)
+		if err != nil {
+			if p.errorsMetric != nil {
+				p.errorsMetric.WithLabelValues().Inc()
+			}
+			p.logger.Errorf("can't evaluate condition of route %s: %s", r.route, err.Error())
+			continue
+		}
+		if matched != true {
+			continue
+		}
+
+		p.route(event, r.route, start)
+		routed++
+		if p.config.Mode == modeFirst {
+			break
+		}
+	}
+
+	if routed == 0 && p.config.DefaultRoute != "" {
+		p.route(event, p.config.DefaultRoute, start)
+	}
+
+	if len(event.Buf) > start && len(p.config.RouteField_) > 0 {
+		pipeline.AddField(event.Root, p.config.RouteField_).MutateToString(pipeline.ByteToStringUnsafe(event.Buf[start:]))
+	}
+
+	return pipeline.ActionPass
+}
+
+// route marks the event with the route and appends it to the value of the route field built in the event buffer from the start.
+func (p *Plugin) route(event *pipeline.Event, route string, start int) {
+	event.AddRouteTag(route)
+	if p.routedMetric != nil {
+		p.routedMetric.WithLabelValues(route).Inc()
+	}
+
+	if len(p.config.RouteField_) == 0 {
+		return
+	}
+	if len(event.Buf) > start {
+		event.Buf = append(event.Buf, ',')
+	}
+	event.Buf = append(event.Buf, route...)
+}
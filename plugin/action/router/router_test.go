@@ -0,0 +1,135 @@
+package router
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin/action/route_tag"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// runPipeline passes the event with the route tags through the action, the tags are set by route_tag actions.
+// It returns the output event and its route tags.
+func runPipeline(config *Config, in string, tags []string) (string, []string) {
+	actions := make([]*pipeline.ActionPluginStaticInfo, 0)
+	for _, tag := range tags {
+		routeTag := fd.DefaultPluginRegistry.GetActionByType("route_tag")
+		tagConfig := test.NewConfig(&route_tag.Config{Tag: tag}, nil)
+		actions = append(actions, test.NewActionPluginStaticInfo(routeTag.Factory, tagConfig, pipeline.MatchModeAnd, nil, false)...)
+	}
+	test.NewConfig(config, nil)
+	actions = append(actions, test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false)...)
+
+	p, input, output := test.NewPipelineMock(actions)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	outEvent := ""
+	var routes []string
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvent = e.Root.EncodeToString()
+		routes = append([]string(nil), e.RouteTags()...)
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(in))
+
+	wg.Wait()
+	p.Stop()
+
+	return outEvent, routes
+}
+
+func TestRouter(t *testing.T) {
+	rules := []RuleConfig{
+		{If: `level == "error"`, Route: "alerts"},
+		{If: `_size > 40`, Route: "archive"},
+		{If: `k8s?.namespace in ["payments", "billing"]`, Route: "finance"},
+		{If: `status >= 500`, Route: "errors"},
+	}
+
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		tags   []string
+		routes []string
+		out    string
+	}{
+		{
+			name:   "first",
+			config: &Config{Rules: rules, RouteField: "route"},
+			in:     `{"level":"error","k8s":{"namespace":"payments"}}`,
+			tags:   []string{"prev"},
+			routes: []string{"prev", "alerts"},
+			out:    `{"level":"error","k8s":{"namespace":"payments"},"route":"alerts"}`,
+		},
+		{
+			name:   "all",
+			config: &Config{Rules: rules, Mode: "all", RouteField: "meta.route", Replace: true},
+			in:     `{"level":"error","k8s":{"namespace":"payments"}}`,
+			tags:   []string{"prev"},
+			routes: []string{"alerts", "archive", "finance"},
+			out:    `{"level":"error","k8s":{"namespace":"payments"},"meta":{"route":"alerts,archive,finance"}}`,
+		},
+		{
+			name:   "default",
+			config: &Config{Rules: rules, DefaultRoute: "main", RouteField: "route"},
+			in:     `{"level":"info"}`,
+			routes: []string{"main"},
+			out:    `{"level":"info","route":"main"}`,
+		},
+		{
+			name:   "no route",
+			config: &Config{Rules: rules},
+			in:     `{"level":"info"}`,
+			out:    `{"level":"info"}`,
+		},
+		{
+			name:   "failed condition",
+			config: &Config{Rules: rules, DefaultRoute: "main"},
+			in:     `{"status":"ok"}`,
+			routes: []string{"main"},
+			out:    `{"status":"ok"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, routes := runPipeline(tc.config, tc.in, tc.tags)
+			assert.Equal(t, tc.out, out)
+			assert.Equal(t, tc.routes, routes)
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	config := test.NewConfig(&Config{Rules: []RuleConfig{{If: `status >= 500`, Route: "errors"}}, DefaultRoute: "main"}, nil)
+	// the processors share the metrics of the pipeline, so any of them is enough to check the metrics
+	var plugin *Plugin
+	pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		plugin = &Plugin{}
+		return plugin, &Config{}
+	}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+
+	output.SetOutFn(func(e *pipeline.Event) {
+		wg.Done()
+	})
+
+	input.In(0, "test.log", 0, []byte(`{"status":503}`))
+	input.In(0, "test.log", 0, []byte(`{"status":200}`))
+	input.In(0, "test.log", 0, []byte(`{"status":"ok"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(plugin.routedMetric.WithLabelValues("errors")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(plugin.routedMetric.WithLabelValues("main")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(plugin.errorsMetric.WithLabelValues()))
+}
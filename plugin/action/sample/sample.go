@@ -0,0 +1,190 @@
+package sample
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It passes one of `rate` events and discards the rest. It's used in a combination with `match_fields`/`match_mode`
+parameters to tame the floods of the noisy events without losing all of them.
+
+The events matching the `rules` are sampled with the rates of the first matched rule, the rest events are sampled with `rate`.
+
+**An example for keeping 1% of debug logs and 10% of info logs of the noisy service:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: sample
+      match_fields:
+        service: noisy
+      rate: 1
+      rules:
+        - rate: 100
+          conditions:
+            level: debug
+        - rate: 10
+          conditions:
+            level: info
+    ...
+```
+}*/
+
+const (
+	modeRandom = "random"
+	modeCount  = "count"
+	modeHash   = "hash"
+)
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+
+	rules    []*rule
+	fallback *rule
+	rand     *rand.Rand
+
+	discardedMetric *prom.CounterVec
+}
+
+type rule struct {
+	fields [][]string
+	values []string
+	rate   uint64
+	// counter is used in the count mode.
+	counter uint64
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > One of `rate` events is passed. `1` passes all events.
+	Rate int `json:"rate" default:"1"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How the events to pass are chosen:
+	// > * `random` – every event is passed with the probability of `1/rate`
+	// > * `count` – every `rate`-th event is passed, the events are counted on each processor separately
+	// > * `hash` – the event is passed if the hash of `key_field` value is divisible by `rate`,
+	// > so the events with the same key are either all passed or all discarded, e.g. the events of the same trace
+	Mode string `json:"mode" default:"random" options:"random|count|hash"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field to hash in the `hash` mode.
+	KeyField  cfg.FieldSelector `json:"key_field" parse:"selector"` // *
+	KeyField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Rules to override the `rate` for the different groups of the events. It's a list of objects.
+	// > * `rate` – the value which will override the `rate`, if `conditions` are met.
+	// > * `conditions` – the map of `event field name => event field value`. The conditions are checked using `AND` operator.
+	Rules []RuleConfig `json:"rules" default:"" slice:"true"` // *
+}
+
+type RuleConfig struct {
+	Rate       int               `json:"rate"`
+	Conditions map[string]string `json:"conditions"`
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "sample",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	if p.config.Mode == modeHash && len(p.config.KeyField_) == 0 {
+		p.logger.Fatalf("key_field must be set in the hash mode")
+	}
+
+	p.fallback = p.newRule(p.config.Rate, nil)
+	p.rules = make([]*rule, 0, len(p.config.Rules))
+	for _, r := range p.config.Rules {
+		p.rules = append(p.rules, p.newRule(r.Rate, r.Conditions))
+	}
+}
+
+func (p *Plugin) newRule(rate int, conditions map[string]string) *rule {
+	if rate < 1 {
+		p.logger.Fatalf("rate must be greater than 0, got %d", rate)
+	}
+
+	r := &rule{rate: uint64(rate)}
+	for field, value := range conditions {
+		r.fields = append(r.fields, cfg.ParseFieldSelector(field))
+		r.values = append(r.values, value)
+	}
+	return r
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.discardedMetric = ctl.RegisterCounter("sample_discarded_total", "Number of events discarded by sample plugin")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	r := p.fallback
+	for _, candidate := range p.rules {
+		if candidate.isMatch(event) {
+			r = candidate
+			break
+		}
+	}
+
+	if r.rate == 1 || p.isSampled(event, r) {
+		return pipeline.ActionPass
+	}
+
+	p.discardedMetric.WithLabelValues().Inc()
+	return pipeline.ActionDiscard
+}
+
+func (p *Plugin) isSampled(event *pipeline.Event, r *rule) bool {
+	switch p.config.Mode {
+	case modeCount:
+		r.counter++
+		return r.counter%r.rate == 0
+	case modeHash:
+		key := event.Root.Dig(p.config.KeyField_...).AsBytes()
+		return xxhash.Sum64(key)%r.rate == 0
+	default:
+		return p.rand.Uint64()%r.rate == 0
+	}
+}
+
+// isMatch checks if event has the same field values as given in conditions.
+func (r *rule) isMatch(event *pipeline.Event) bool {
+	for i, field := range r.fields {
+		if event.Root.Dig(field...).AsString() != r.values[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,73 @@
+package sample
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// countPassed passes the event n times through the action and returns how many times it's passed.
+// The discarded events don't reach the output, so the last event is skipped by the action
+// and marks the end of the events.
+func countPassed(config *Config, event string, n int) int {
+	test.NewConfig(config, nil)
+	conds := pipeline.MatchConditions{{Field: []string{"last"}, Values: []string{"true"}}}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, conds, true))
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	passed := 0
+	output.SetOutFn(func(e *pipeline.Event) {
+		if e.Root.Dig("last") != nil {
+			wg.Done()
+			return
+		}
+		passed++
+	})
+
+	for i := 0; i < n; i++ {
+		input.In(0, "test.log", 0, []byte(event))
+	}
+	input.In(0, "test.log", 0, []byte(`{"last":"true"}`))
+
+	wg.Wait()
+	p.Stop()
+
+	return passed
+}
+
+func TestCountMode(t *testing.T) {
+	config := &Config{
+		Rate: 2,
+		Mode: modeCount,
+		Rules: []RuleConfig{
+			{Rate: 1, Conditions: map[string]string{"error.kind": "fatal"}},
+			{Rate: 10, Conditions: map[string]string{"level": "debug"}},
+		},
+	}
+
+	assert.Equal(t, 10, countPassed(config, `{"level":"debug"}`, 100))
+	assert.Equal(t, 50, countPassed(config, `{"level":"info"}`, 100))
+	assert.Equal(t, 100, countPassed(config, `{"level":"debug","error":{"kind":"fatal"}}`, 100))
+}
+
+func TestHashMode(t *testing.T) {
+	config := &Config{Rate: 4, Mode: modeHash, KeyField: "trace_id"}
+
+	total := 0
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		passed := countPassed(config, `{"trace_id":"`+id+`"}`, 10)
+		// the events with the same key are either all passed or all discarded.
+		assert.Contains(t, []int{0, 10}, passed)
+		total += passed
+	}
+	assert.Less(t, total, 80)
+}
+
+func TestRandomMode(t *testing.T) {
+	passed := countPassed(&Config{Rate: 10}, `{}`, 10000)
+	assert.InDelta(t, 1000, passed, 200)
+}
@@ -1,8 +1,11 @@
 package set_time
 
 import (
+	"math"
+	"strconv"
 	"time"
 
+	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
@@ -10,10 +13,42 @@ import (
 
 /*{ introduction
 It adds time field to the event.
+
+If the `source` is set, the time is parsed from the source field instead of the current time.
+The `source_formats` are tried in order, the times without the timezone are parsed in the `source_timezone`.
+The parsed time is written in UTC with the `format`. If the time can't be parsed or the source field is missing,
+the event is passed unchanged, the current time is set or the event is discarded according to `on_error`.
+
+**Example:**
+Normalizing the timestamps of the different producers:
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: set_time
+      source: ts
+      source_formats: [rfc3339nano, timestampmilli, "2006-01-02 15:04:05"]
+      source_timezone: Europe/Moscow
+      field: time
+      format: rfc3339nano
+      override: true
+      on_error: now
+    ...
+```
+It transforms `{"ts":"2023-05-01 13:20:00"}` into `{"ts":"2023-05-01 13:20:00","time":"2023-05-01T10:20:00Z"}`.
 }*/
 
+const (
+	onErrorKeep    = "keep"
+	onErrorNow     = "now"
+	onErrorDiscard = "discard"
+)
+
 type Plugin struct {
-	config *Config
+	config   *Config
+	parsers  []func(value string) (time.Time, error)
+	location *time.Location
 	plugin.NoMetricsPlugin
 }
 
@@ -38,6 +73,31 @@ type Config struct {
 	// >
 	// > Override field if exists.
 	Override bool `json:"override" default:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to parse the time from, the current time is used if it's empty.
+	Source  cfg.FieldSelector `json:"source" parse:"selector"` // *
+	Source_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The formats to parse the `source` field tried in order, `rfc3339nano` is used if it's empty.
+	// > The formats are the same as the `format` ones, the `timestamp` may have the fraction of the seconds.
+	SourceFormats []string `json:"source_formats" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The timezone of the `source` times without the timezone, e.g. `Europe/Moscow`.
+	SourceTimezone string `json:"source_timezone" default:"UTC"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do if the `source` time can't be parsed:
+	// > * `keep` passes the event unchanged
+	// > * `now` sets the current time
+	// > * `discard` discards the event
+	OnError string `json:"on_error" default:"keep" options:"keep|now|discard"` // *
 }
 
 func init() {
@@ -51,7 +111,7 @@ func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 	return &Plugin{}, &Config{}
 }
 
-func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams) {
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
 	p.config = config.(*Config)
 
 	format, err := pipeline.ParseFormatName(p.config.Format)
@@ -61,6 +121,64 @@ func (p *Plugin) Start(config pipeline.AnyConfig, _ *pipeline.ActionPluginParams
 	}
 
 	p.config.Format_ = format
+
+	if len(p.config.Source_) == 0 {
+		return
+	}
+
+	p.location, err = time.LoadLocation(p.config.SourceTimezone)
+	if err != nil {
+		params.Logger.Fatalf("can't load source_timezone %q: %s", p.config.SourceTimezone, err.Error())
+	}
+
+	formats := p.config.SourceFormats
+	if len(formats) == 0 {
+		formats = []string{"rfc3339nano"}
+	}
+	for _, format := range formats {
+		p.parsers = append(p.parsers, p.parser(format))
+	}
+}
+
+// parser returns the function parsing the time of the format.
+func (p *Plugin) parser(format string) func(value string) (time.Time, error) {
+	switch format {
+	case "timestamp":
+		return func(value string) (time.Time, error) {
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			integer, fraction := math.Modf(seconds)
+			return time.Unix(int64(integer), int64(fraction*float64(time.Second))), nil
+		}
+	case "timestampmilli":
+		return timestampParser(time.Millisecond)
+	case "timestampmicro":
+		return timestampParser(time.Microsecond)
+	case "timestampnano":
+		return timestampParser(time.Nanosecond)
+	}
+
+	layout, err := pipeline.ParseFormatName(format)
+	if err != nil {
+		// to support custom formats
+		layout = format
+	}
+	return func(value string) (time.Time, error) {
+		return time.ParseInLocation(layout, value, p.location)
+	}
+}
+
+// timestampParser returns the function parsing the integer timestamp of the unit.
+func timestampParser(unit time.Duration) func(value string) (time.Time, error) {
+	return func(value string) (time.Time, error) {
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, ts*int64(unit)), nil
+	}
 }
 
 func (p *Plugin) Stop() {
@@ -70,7 +188,42 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	return p.do(event, time.Now())
 }
 
-func (p *Plugin) do(event *pipeline.Event, t time.Time) pipeline.ActionResult {
+func (p *Plugin) do(event *pipeline.Event, now time.Time) pipeline.ActionResult {
+	if len(p.config.Source_) == 0 {
+		return p.set(event, now)
+	}
+
+	if t, ok := p.parse(event); ok {
+		return p.set(event, t.UTC())
+	}
+
+	switch p.config.OnError {
+	case onErrorNow:
+		return p.set(event, now)
+	case onErrorDiscard:
+		return pipeline.ActionDiscard
+	default:
+		return pipeline.ActionPass
+	}
+}
+
+// parse parses the time of the source field with the first suitable format.
+func (p *Plugin) parse(event *pipeline.Event) (time.Time, bool) {
+	node := event.Root.Dig(p.config.Source_...)
+	if node == nil || !(node.IsString() || node.IsNumber()) {
+		return time.Time{}, false
+	}
+
+	value := node.AsString()
+	for _, parse := range p.parsers {
+		if t, err := parse(value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (p *Plugin) set(event *pipeline.Event, t time.Time) pipeline.ActionResult {
 	dateNode := event.Root.Dig(p.config.Field)
 	if dateNode != nil && !p.config.Override {
 		return pipeline.ActionPass
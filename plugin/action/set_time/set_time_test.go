@@ -107,6 +107,89 @@ func TestPlugin_Do(t *testing.T) {
 			ExpResult: pipeline.ActionPass,
 			ExpRoot:   fmt.Sprintf(`{"a":{"b":{"c":123}},"a.b.c":%d}`, now.UnixMilli()),
 		},
+		{
+			Name: "source rfc3339",
+			Config: &Config{
+				Format:   "rfc3339nano",
+				Field:    "time",
+				Override: true,
+				Source:   "ts",
+			},
+			Root: `{"ts":"2023-05-01T13:20:00.5+03:00"}`,
+
+			ExpResult: pipeline.ActionPass,
+			ExpRoot:   `{"ts":"2023-05-01T13:20:00.5+03:00","time":"2023-05-01T10:20:00.5Z"}`,
+		},
+		{
+			Name: "source formats in order",
+			Config: &Config{
+				Format:        "timestampmilli",
+				Field:         "time",
+				Override:      true,
+				Source:        "meta.ts",
+				SourceFormats: []string{"rfc3339", "timestampmilli", "timestamp"},
+			},
+			Root: `{"meta":{"ts":1682936400.25}}`,
+
+			ExpResult: pipeline.ActionPass,
+			ExpRoot:   `{"meta":{"ts":1682936400.25},"time":1682936400250}`,
+		},
+		{
+			Name: "source timezone",
+			Config: &Config{
+				Format:         "rfc3339",
+				Field:          "ts",
+				Override:       true,
+				Source:         "ts",
+				SourceFormats:  []string{"rfc3339", "2006-01-02 15:04:05"},
+				SourceTimezone: "Europe/Moscow",
+			},
+			Root: `{"ts":"2023-05-01 13:20:00"}`,
+
+			ExpResult: pipeline.ActionPass,
+			ExpRoot:   `{"ts":"2023-05-01T10:20:00Z"}`,
+		},
+		{
+			Name: "source error keep",
+			Config: &Config{
+				Format:   "rfc3339",
+				Field:    "time",
+				Override: true,
+				Source:   "ts",
+			},
+			Root: `{"ts":"yesterday"}`,
+
+			ExpResult: pipeline.ActionPass,
+			ExpRoot:   `{"ts":"yesterday"}`,
+		},
+		{
+			Name: "source error now",
+			Config: &Config{
+				Format:   "timestamp",
+				Field:    "time",
+				Override: true,
+				Source:   "ts",
+				OnError:  "now",
+			},
+			Root: `{}`,
+
+			ExpResult: pipeline.ActionPass,
+			ExpRoot:   fmt.Sprintf(`{"time":%d}`, now.Unix()),
+		},
+		{
+			Name: "source error discard",
+			Config: &Config{
+				Format:   "timestamp",
+				Field:    "time",
+				Override: true,
+				Source:   "ts",
+				OnError:  "discard",
+			},
+			Root: `{"ts":{"seconds":1}}`,
+
+			ExpResult: pipeline.ActionDiscard,
+			ExpRoot:   `{"ts":{"seconds":1}}`,
+		},
 	}
 
 	root := insaneJSON.Spawn()
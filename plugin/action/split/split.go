@@ -0,0 +1,159 @@
+package split
+
+import (
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It splits the array `field` into the separate events, one event per the array element.
+The new events pass the following actions and go to the outputs instead of the original event,
+the original event is committed once all the new events are committed, so the offsets of the input
+advance only when all of them are delivered. The event with the empty array is discarded.
+The events without the field or with the field which isn't an array are passed unchanged.
+
+The element is put to the `target` field of the new event, or to the `field` if the `target` is empty.
+The new events get the other fields of the original event if `parent_fields` is `copy`.
+If `parent_fields` is `drop` and the `target` is empty, the fields of the object elements become the new event
+and other elements are put to the field named as the last element of the `field` path.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: split
+      field: records
+      target: record
+    ...
+```
+The event `{"service":"api","records":[{"id":1},{"id":2}]}` is split into
+`{"service":"api","record":{"id":1}}` and `{"service":"api","record":{"id":2}}`.
+}*/
+
+const (
+	parentFieldsCopy = "copy"
+	parentFieldsDrop = "drop"
+)
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.SugaredLogger
+	controller pipeline.ActionPluginController
+
+	// elementsBuf holds the JSON of the array elements, elementsEnds are their ends in it
+	elementsBuf  []byte
+	elementsEnds []int
+	dataBuf      []byte
+	// root is the event built from the scratch if the parent fields are dropped
+	root *insaneJSON.Root
+
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The array field to split.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" required:"true"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The field of the new event to put the element to, the element replaces the array if it's empty.
+	Target  cfg.FieldSelector `json:"target" parse:"selector"` // *
+	Target_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Whether to copy the other fields of the original event to the new events.
+	ParentFields string `json:"parent_fields" default:"copy" options:"copy|drop"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "split",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+	p.controller = params.Controller
+
+	if p.config.ParentFields == parentFieldsDrop {
+		p.root = insaneJSON.Spawn()
+	}
+}
+
+func (p *Plugin) Stop() {
+	if p.root != nil {
+		insaneJSON.Release(p.root)
+	}
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	node := event.Root.Dig(p.config.Field_...)
+	if node == nil || !node.IsArray() {
+		return pipeline.ActionPass
+	}
+
+	// the elements are encoded before the array is replaced
+	p.elementsBuf = p.elementsBuf[:0]
+	p.elementsEnds = p.elementsEnds[:0]
+	for _, element := range node.AsArray() {
+		p.elementsBuf = element.Encode(p.elementsBuf)
+		p.elementsEnds = append(p.elementsEnds, len(p.elementsBuf))
+	}
+
+	root, target, elementIsEvent := p.prepare(event.Root, node)
+
+	start := 0
+	for _, end := range p.elementsEnds {
+		element := p.elementsBuf[start:end]
+		start = end
+
+		data := element
+		if !elementIsEvent || element[0] != '{' {
+			target.MutateToJSON(root, pipeline.ByteToStringUnsafe(element))
+			p.dataBuf = root.Encode(p.dataBuf[:0])
+			data = p.dataBuf
+		}
+
+		if err := p.controller.Spawn(event, data); err != nil {
+			p.logger.Errorf("can't spawn event: %s", err.Error())
+		}
+	}
+
+	return pipeline.ActionDiscard
+}
+
+// prepare returns the root of the new events and the field to put the elements to.
+// The original event is changed since it's discarded.
+func (p *Plugin) prepare(eventRoot *insaneJSON.Root, node *insaneJSON.Node) (*insaneJSON.Root, *insaneJSON.Node, bool) {
+	if p.config.ParentFields == parentFieldsCopy {
+		if len(p.config.Target_) == 0 {
+			return eventRoot, node, false
+		}
+		node.Suicide()
+		return eventRoot, pipeline.AddField(eventRoot, p.config.Target_), false
+	}
+
+	_ = p.root.DecodeString("{}")
+	if len(p.config.Target_) == 0 {
+		return p.root, pipeline.AddField(p.root, p.config.Field_[len(p.config.Field_)-1:]), true
+	}
+	return p.root, pipeline.AddField(p.root, p.config.Target_), false
+}
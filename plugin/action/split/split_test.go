@@ -0,0 +1,96 @@
+package split
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		name         string
+		target       string
+		parentFields string
+		in           []string
+		out          []string
+		// committed is the count of the events committed to the input, the discarded events aren't committed
+		committed int
+	}{
+		{
+			name: "copy",
+			in:   []string{`{"service":"api","records":[{"id":1},"x",null]}`},
+			out:  []string{`{"service":"api","records":{"id":1}}`, `{"service":"api","records":"x"}`, `{"service":"api","records":null}`},
+		},
+		{
+			name:   "copy_target",
+			target: "data.record",
+			in:     []string{`{"service":"api","records":[{"id":1},{"id":2}],"data":{"v":1}}`},
+			out:    []string{`{"service":"api","data":{"v":1,"record":{"id":1}}}`, `{"service":"api","data":{"v":1,"record":{"id":2}}}`},
+		},
+		{
+			name:         "drop",
+			parentFields: "drop",
+			in:           []string{`{"service":"api","records":[{"id":1},2]}`},
+			out:          []string{`{"id":1}`, `{"records":2}`},
+		},
+		{
+			name:         "drop_target",
+			parentFields: "drop",
+			target:       "record",
+			in:           []string{`{"service":"api","records":[{"id":1},2]}`},
+			out:          []string{`{"record":{"id":1}}`, `{"record":2}`},
+		},
+		{
+			name: "not_array",
+			in:   []string{`{"records":{"id":1}}`, `{"service":"api"}`, `{"records":[]}`},
+			out:  []string{`{"records":{"id":1}}`, `{"service":"api"}`},
+			// the event with the empty array is discarded
+			committed: 2,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(&Config{
+				Field:        "records",
+				Target:       cfg.FieldSelector(tc.target),
+				ParentFields: tc.parentFields,
+			}, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+
+			if tc.committed == 0 {
+				tc.committed = len(tc.in)
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(tc.committed)
+			commits := atomic.NewInt32(0)
+			input.SetCommitFn(func(_ *pipeline.Event) {
+				commits.Inc()
+				wg.Done()
+			})
+
+			mu := &sync.Mutex{}
+			out := make([]string, 0)
+			output.SetOutFn(func(e *pipeline.Event) {
+				mu.Lock()
+				out = append(out, strings.Clone(e.Root.EncodeToString()))
+				mu.Unlock()
+			})
+
+			for i, in := range tc.in {
+				input.In(0, "test.log", int64(i), []byte(in))
+			}
+			wg.Wait()
+			p.Stop()
+
+			// the original event is committed once, after all the new events
+			assert.Equal(t, int32(tc.committed), commits.Load())
+			assert.Equal(t, tc.out, out)
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 type complexLimit struct {
 	value int64
 	kind  string
+	burst int64 // the capacity of the token bucket, the value is used if it's not set
 }
 
 type rule struct {
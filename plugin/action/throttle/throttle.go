@@ -2,14 +2,16 @@ package throttle
 
 import (
 	"context"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
-	"github.com/ozontech/file.d/plugin"
+	prom "github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
@@ -20,11 +22,23 @@ var (
 	limiters                           = map[string]map[string]limiter{} // todo: cleanup this map?
 	limitersMu                         = &sync.RWMutex{}
 	redisLimiterSynchronizationStarted = map[string]struct{}{}
+
+	// token buckets are shared across pipeline too, protected by limitersMu
+	tokenBucketTables = map[string]*tokenBucketsRef{}
 )
 
+// tokenBucketsRef counts the processors using the token buckets of the pipeline,
+// the buckets are removed once the last of them is stopped.
+type tokenBucketsRef struct {
+	buckets *tokenBuckets
+	refs    int
+}
+
 const (
 	redisBackend    = "redis"
 	inMemoryBackend = "memory"
+
+	algorithmTokenBucket = "token_bucket"
 )
 
 // interface with only necessary functions of the original redis.Client
@@ -42,6 +56,27 @@ type limiter interface {
 
 /*{ introduction
 It discards the events if pipeline throughput gets higher than a configured threshold.
+
+The `window` algorithm counts the events in the fixed time buckets, so a spike at the start of the bucket
+exhausts the limit for the whole bucket. The `token_bucket` algorithm refills the limit continuously
+at the rate of the limit per `bucket_interval` and passes the spikes up to the `burst`.
+The token buckets of the least recently used keys are evicted once there are more than `max_keys` keys.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: throttle
+      algorithm: token_bucket
+      throttle_field: k8s_pod
+      default_limit: 100
+      bucket_interval: 1s
+      burst: 1000
+      max_keys: 10000
+    ...
+```
 }*/
 
 type Plugin struct {
@@ -53,9 +88,13 @@ type Plugin struct {
 	format      string
 	redisClient redisClient
 
-	limiterBuf []byte
-	rules      []*rule
-	plugin.NoMetricsPlugin
+	limiterBuf   []byte
+	rules        []*rule
+	tokenBuckets *tokenBuckets
+	// ruleLabels are the metric labels of the rules, the default rule is the last one.
+	ruleLabels []string
+
+	throttledMetric *prom.CounterVec
 }
 
 // ! config-params
@@ -114,12 +153,31 @@ type Config struct {
 	BucketInterval  cfg.Duration `json:"bucket_interval" parse:"duration" default:"1m"` // *
 	BucketInterval_ time.Duration
 
+	// > @3@4@5@6
+	// >
+	// > The limiting algorithm:
+	// > * `window` – the limit is checked in the fixed time buckets
+	// > * `token_bucket` – the limit per `bucket_interval` is refilled continuously up to the `burst`,
+	// > it's supported by the `memory` backend only and doesn't use the `time_field`
+	Algorithm string `json:"algorithm" default:"window" options:"window|token_bucket"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The capacity of the token buckets, the `default_limit` is used if it's not set.
+	Burst int64 `json:"burst"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The max number of the keys of the token buckets, the least recently used keys are evicted.
+	MaxKeys int `json:"max_keys" default:"100000"` // *
+
 	// > @3@4@5@6
 	// >
 	// > Rules to override the `default_limit` for different group of event. It's a list of objects.
 	// > Each object has the `limit` and `conditions` fields.
 	// > * `limit` – the value which will override the `default_limit`, if `conditions` are met.
 	// > * `limit_kind` – the type of a limit: `count` - number of messages, `size` - total size from all messages
+	// > * `burst` – the capacity of the token buckets, the `limit` is used if it's not set
 	// > * `conditions` – the map of `event field name => event field value`. The conditions are checked using `AND` operator.
 	Rules []RuleConfig `json:"rules" default:"" slice:"true"` // *
 }
@@ -156,6 +214,7 @@ type RedisBackendConfig struct {
 type RuleConfig struct {
 	Limit      int64             `json:"limit"`
 	LimitKind  string            `json:"limit_kind" default:"count" options:"count|size"`
+	Burst      int64             `json:"burst"`
 	Conditions map[string]string `json:"conditions"`
 }
 
@@ -229,11 +288,37 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginP
 		limitersMu.Unlock()
 	}
 
+	if p.config.Algorithm == algorithmTokenBucket {
+		if p.config.LimiterBackend != inMemoryBackend {
+			p.logger.Fatalf("token_bucket algorithm is supported by memory backend only")
+		}
+
+		limitersMu.Lock()
+		ref, has := tokenBucketTables[p.pipeline]
+		if !has {
+			ref = &tokenBucketsRef{buckets: newTokenBuckets(p.config.MaxKeys)}
+			tokenBucketTables[p.pipeline] = ref
+		}
+		ref.refs++
+		p.tokenBuckets = ref.buckets
+		limitersMu.Unlock()
+	}
+
 	for i, r := range p.config.Rules {
-		p.rules = append(p.rules, NewRule(r.Conditions, complexLimit{r.Limit, r.LimitKind}, i))
+		p.rules = append(p.rules, NewRule(r.Conditions, complexLimit{r.Limit, r.LimitKind, r.Burst}, i))
+	}
+
+	p.rules = append(p.rules, NewRule(map[string]string{}, complexLimit{p.config.DefaultLimit, p.config.LimitKind, p.config.Burst}, len(p.config.Rules)))
+
+	p.ruleLabels = make([]string, 0, len(p.rules))
+	for i := range p.config.Rules {
+		p.ruleLabels = append(p.ruleLabels, strconv.Itoa(i))
 	}
+	p.ruleLabels = append(p.ruleLabels, "default")
+}
 
-	p.rules = append(p.rules, NewRule(map[string]string{}, complexLimit{p.config.DefaultLimit, p.config.LimitKind}, len(p.config.Rules)))
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.throttledMetric = ctl.RegisterCounter("throttle_throttled_events_total", "Number of events discarded by throttle plugin", "rule")
 }
 
 // runSync runs synchronization with redis.
@@ -289,6 +374,16 @@ func (p *Plugin) getNewLimiter(throttleField, limiterKey string, rule *rule) lim
 // Stop ends plugin activity.
 func (p *Plugin) Stop() {
 	p.cancel()
+
+	if p.tokenBuckets != nil {
+		limitersMu.Lock()
+		ref := tokenBucketTables[p.pipeline]
+		ref.refs--
+		if ref.refs == 0 {
+			delete(tokenBucketTables, p.pipeline)
+		}
+		limitersMu.Unlock()
+	}
 }
 
 func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
@@ -298,6 +393,7 @@ func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
 	return pipeline.ActionDiscard
 }
 
+// isAllowed checks the limit of the first matched rule and counts the throttled events of the key.
 func (p *Plugin) isAllowed(event *pipeline.Event) bool {
 	ts := time.Now()
 
@@ -319,7 +415,7 @@ func (p *Plugin) isAllowed(event *pipeline.Event) bool {
 		}
 	}
 
-	for _, rule := range p.rules {
+	for i, rule := range p.rules {
 		if !rule.isMatch(event) {
 			continue
 		}
@@ -328,6 +424,14 @@ func (p *Plugin) isAllowed(event *pipeline.Event) bool {
 		p.limiterBuf = append(p.limiterBuf, throttleKey...)
 		limiterKey := pipeline.ByteToStringUnsafe(p.limiterBuf)
 
+		if p.tokenBuckets != nil {
+			cost := int64(1)
+			if rule.limit.kind == "size" {
+				cost = int64(event.Size)
+			}
+			return p.countThrottled(i, p.tokenBuckets.allow(limiterKey, time.Now(), rule.limit, p.config.BucketInterval_, cost))
+		}
+
 		limitersMu.RLock()
 		limiter, has := limiters[p.pipeline][limiterKey]
 		limitersMu.RUnlock()
@@ -351,8 +455,17 @@ func (p *Plugin) isAllowed(event *pipeline.Event) bool {
 			limitersMu.Unlock()
 		}
 
-		return limiter.isAllowed(event, ts)
+		return p.countThrottled(i, limiter.isAllowed(event, ts))
 	}
 
 	return true
 }
+
+// countThrottled counts the throttled events by the rules, the throttle keys aren't used as the labels
+// since their number is unbounded.
+func (p *Plugin) countThrottled(ruleIndex int, allowed bool) bool {
+	if !allowed && p.throttledMetric != nil {
+		p.throttledMetric.WithLabelValues(p.ruleLabels[ruleIndex]).Inc()
+	}
+	return allowed
+}
@@ -0,0 +1,89 @@
+package throttle
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills the tokens continuously at the rate of the limit per interval up to the burst,
+// so the short spikes up to the burst are passed while the average throughput stays within the limit.
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// allow takes the cost from the bucket if there are enough tokens.
+func (b *tokenBucket) allow(now time.Time, rate float64, burst float64, cost float64) bool {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	if b.tokens < cost {
+		return false
+	}
+	b.tokens -= cost
+	return true
+}
+
+// tokenBuckets is the table of the token buckets of the keys,
+// the least recently used buckets are evicted once the table exceeds the max keys.
+type tokenBuckets struct {
+	mu      *sync.Mutex
+	maxKeys int
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+func newTokenBuckets(maxKeys int) *tokenBuckets {
+	return &tokenBuckets{
+		mu:      &sync.Mutex{},
+		maxKeys: maxKeys,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// allow checks the bucket of the key, the evicted keys start with the full bucket.
+func (t *tokenBuckets) allow(key string, now time.Time, limit complexLimit, interval time.Duration, cost int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	element, has := t.buckets[key]
+	if has {
+		t.lru.MoveToFront(element)
+	} else {
+		// the key points to the limiter buffer
+		element = t.lru.PushFront(&tokenBucket{key: string([]byte(key))})
+		t.buckets[element.Value.(*tokenBucket).key] = element
+		for t.maxKeys > 0 && t.lru.Len() > t.maxKeys {
+			oldest := t.lru.Back()
+			t.lru.Remove(oldest)
+			delete(t.buckets, oldest.Value.(*tokenBucket).key)
+		}
+	}
+
+	burst := limit.burst
+	if burst <= 0 {
+		burst = limit.value
+	}
+	rate := float64(limit.value) / interval.Seconds()
+	return element.Value.(*tokenBucket).allow(now, rate, float64(burst), float64(cost))
+}
+
+// len returns the number of the keys in the table.
+func (t *tokenBuckets) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lru.Len()
+}
@@ -0,0 +1,138 @@
+package throttle
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTokenBucketBurst(t *testing.T) {
+	buckets := newTokenBuckets(10)
+	limit := complexLimit{value: 2, kind: "count", burst: 5}
+	now := time.Now()
+
+	// the burst is passed at once
+	for i := 0; i < 5; i++ {
+		assert.True(t, buckets.allow("a", now, limit, time.Second, 1), "event %d of the burst isn't allowed", i)
+	}
+	assert.False(t, buckets.allow("a", now, limit, time.Second, 1), "event above the burst is allowed")
+
+	// 2 tokens per second are refilled
+	now = now.Add(time.Second)
+	assert.True(t, buckets.allow("a", now, limit, time.Second, 1))
+	assert.True(t, buckets.allow("a", now, limit, time.Second, 1))
+	assert.False(t, buckets.allow("a", now, limit, time.Second, 1))
+
+	// the tokens don't exceed the burst
+	now = now.Add(time.Hour)
+	assert.True(t, buckets.allow("a", now, limit, time.Second, 5))
+	assert.False(t, buckets.allow("a", now, limit, time.Second, 1))
+
+	// the limit is the burst if it isn't set
+	limit = complexLimit{value: 3, kind: "count"}
+	assert.True(t, buckets.allow("b", now, limit, time.Second, 3))
+	assert.False(t, buckets.allow("b", now, limit, time.Second, 1))
+}
+
+func TestTokenBucketEviction(t *testing.T) {
+	buckets := newTokenBuckets(2)
+	limit := complexLimit{value: 1, kind: "count"}
+	now := time.Now()
+
+	assert.True(t, buckets.allow("a", now, limit, time.Minute, 1))
+	assert.True(t, buckets.allow("b", now, limit, time.Minute, 1))
+	assert.False(t, buckets.allow("a", now, limit, time.Minute, 1))
+
+	// "b" is the least recently used key
+	assert.True(t, buckets.allow("c", now, limit, time.Minute, 1))
+	assert.Equal(t, 2, buckets.len())
+	assert.False(t, buckets.allow("a", now, limit, time.Minute, 1))
+	assert.False(t, buckets.allow("c", now, limit, time.Minute, 1))
+
+	// the evicted key starts with the full bucket
+	assert.True(t, buckets.allow("b", now, limit, time.Minute, 1))
+	assert.Equal(t, 2, buckets.len())
+}
+
+func TestTokenBucketThrottledMetric(t *testing.T) {
+	config := &Config{
+		Algorithm:      algorithmTokenBucket,
+		Rules:          []RuleConfig{{Limit: 1, Conditions: map[string]string{"k8s_ns": "ns_1"}}},
+		DefaultLimit:   1,
+		ThrottleField:  "k8s_pod",
+		BucketInterval: "1m",
+	}
+	test.NewConfig(config, nil)
+
+	var plugin *Plugin
+	pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		plugin = &Plugin{}
+		return plugin, &Config{}
+	}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	// the last event is passed after the throttled ones
+	wg.Add(4)
+
+	output.SetOutFn(func(e *pipeline.Event) {
+		wg.Done()
+	})
+
+	events := []string{
+		`{"k8s_ns":"ns_1","k8s_pod":"pod_1"}`,
+		`{"k8s_ns":"ns_1","k8s_pod":"pod_1"}`,
+		`{"k8s_ns":"ns_1","k8s_pod":"pod_2"}`,
+		`{"k8s_ns":"ns_1","k8s_pod":"pod_2"}`,
+		`{"k8s_ns":"ns_2","k8s_pod":"pod_3"}`,
+		`{"k8s_ns":"ns_2","k8s_pod":"pod_3"}`,
+		`{"k8s_ns":"ns_2","k8s_pod":"pod_4"}`,
+	}
+	for _, e := range events {
+		input.In(0, "test.log", 0, []byte(e))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	// the events of the different pods are counted by the rule
+	assert.Equal(t, float64(2), testutil.ToFloat64(plugin.throttledMetric.WithLabelValues("0")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(plugin.throttledMetric.WithLabelValues("default")))
+}
+
+func TestTokenBucketRelease(t *testing.T) {
+	config := &Config{
+		Algorithm:      algorithmTokenBucket,
+		DefaultLimit:   1,
+		BucketInterval: "1m",
+	}
+	test.NewConfig(config, nil)
+
+	start := func() *Plugin {
+		p := &Plugin{}
+		p.RegisterMetrics(metric.New("test"))
+		p.Start(config, &pipeline.ActionPluginParams{
+			PluginDefaultParams: &pipeline.PluginDefaultParams{PipelineName: "token_bucket_release"},
+			Logger:              zap.NewExample().Sugar(),
+		})
+		return p
+	}
+	first, second := start(), start()
+	assert.Same(t, first.tokenBuckets, second.tokenBuckets, "buckets are shared by the processors of the pipeline")
+
+	first.Stop()
+	limitersMu.RLock()
+	assert.Contains(t, tokenBucketTables, "token_bucket_release")
+	limitersMu.RUnlock()
+
+	second.Stop()
+	limitersMu.RLock()
+	assert.NotContains(t, tokenBucketTables, "token_bucket_release", "buckets are removed after the last processor is stopped")
+	limitersMu.RUnlock()
+}
@@ -0,0 +1,170 @@
+package trace_context
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+const (
+	traceIDLen = 32
+	spanIDLen  = 16
+)
+
+var (
+	// traceparentRe matches the W3C traceparent `version-trace_id-parent_id-flags`.
+	traceparentRe = regexp.MustCompile(`(?i)\b([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})\b`)
+
+	// defaultPatterns match the common key-value notations like `trace_id=...`, `"traceId":"..."` and `X-B3-SpanId: ...`.
+	nameReplacer = strings.NewReplacer("-", "", "_", "")
+
+	defaultPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(?:x-b3-)?trace[_-]?id["']?\s*[:=]\s*["']?(?P<trace_id>[0-9a-f]{32}|[0-9a-f]{16})\b`),
+		regexp.MustCompile(`(?i)\b(?:x-b3-)?span[_-]?id["']?\s*[:=]\s*["']?(?P<span_id>[0-9a-f]{16})\b`),
+	}
+)
+
+// traceContext is the extracted context, the missing ids are nil.
+type traceContext struct {
+	traceID []byte
+	spanID  []byte
+	flags   []byte
+}
+
+type extractor struct {
+	patterns []*regexp.Regexp
+	ctx      traceContext
+	buf      []byte
+}
+
+// extract finds the trace context in the object of the headers or in the text.
+func (e *extractor) extract(node *insaneJSON.Node) *traceContext {
+	e.ctx = traceContext{}
+	e.buf = e.buf[:0]
+
+	if node.IsObject() {
+		e.extractFields(node)
+	} else {
+		e.extractText(node.AsBytes())
+	}
+
+	if e.ctx.traceID == nil && e.ctx.spanID == nil {
+		return nil
+	}
+	return &e.ctx
+}
+
+// extractFields looks for the traceparent, the trace id and the span id fields in any case and with any separators.
+func (e *extractor) extractFields(node *insaneJSON.Node) {
+	for _, field := range node.AsFields() {
+		value := field.AsFieldValue()
+		if value.IsObject() || value.IsArray() {
+			continue
+		}
+
+		switch normalizeName(field.AsString()) {
+		case "traceparent":
+			e.extractTraceparent(value.AsBytes())
+		case "traceid", "xb3traceid":
+			if e.ctx.traceID == nil && isID(value.AsBytes(), traceIDLen) {
+				e.ctx.traceID = e.lower(value.AsBytes())
+			}
+		case "spanid", "xb3spanid":
+			if e.ctx.spanID == nil && isID(value.AsBytes(), spanIDLen) {
+				e.ctx.spanID = e.lower(value.AsBytes())
+			}
+		}
+	}
+}
+
+// extractText tries the traceparent, then the patterns and the ids found first win.
+func (e *extractor) extractText(data []byte) {
+	if e.extractTraceparent(data) {
+		return
+	}
+
+	for _, re := range e.patterns {
+		m := re.FindSubmatchIndex(data)
+		if m == nil {
+			continue
+		}
+		for i, name := range re.SubexpNames() {
+			if m[2*i] < 0 {
+				continue
+			}
+			value := data[m[2*i]:m[2*i+1]]
+			switch name {
+			case "trace_id":
+				if e.ctx.traceID == nil && isID(value, traceIDLen) {
+					e.ctx.traceID = e.lower(value)
+				}
+			case "span_id":
+				if e.ctx.spanID == nil && isID(value, spanIDLen) {
+					e.ctx.spanID = e.lower(value)
+				}
+			}
+		}
+		if e.ctx.traceID != nil && e.ctx.spanID != nil {
+			return
+		}
+	}
+}
+
+// extractTraceparent extracts the context of the first valid traceparent, the ids and the flags are set all together.
+func (e *extractor) extractTraceparent(data []byte) bool {
+	for _, m := range traceparentRe.FindAllSubmatchIndex(data, -1) {
+		version := data[m[2]:m[3]]
+		traceID := data[m[4]:m[5]]
+		spanID := data[m[6]:m[7]]
+		// the ff version is invalid, the ids must be non-zero
+		if bytes.EqualFold(version, []byte("ff")) || isZero(traceID) || isZero(spanID) {
+			continue
+		}
+
+		e.ctx.traceID = e.lower(traceID)
+		e.ctx.spanID = e.lower(spanID)
+		e.ctx.flags = e.lower(data[m[8]:m[9]])
+		return true
+	}
+	return false
+}
+
+// lower copies the hex id to the buffer in the lower case.
+func (e *extractor) lower(data []byte) []byte {
+	start := len(e.buf)
+	for _, c := range data {
+		if c >= 'A' && c <= 'F' {
+			c += 'a' - 'A'
+		}
+		e.buf = append(e.buf, c)
+	}
+	return e.buf[start:]
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(nameReplacer.Replace(name))
+}
+
+// isID checks the id is the non-zero hex of the length, the trace id may be 64-bit as well.
+func isID(data []byte, length int) bool {
+	if len(data) != length && (length != traceIDLen || len(data) != spanIDLen) {
+		return false
+	}
+	for _, c := range data {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return !isZero(data)
+}
+
+func isZero(data []byte) bool {
+	for _, c := range data {
+		if c != '0' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package trace_context
+
+import (
+	"regexp"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It extracts the trace ID and the span ID from the event field and puts them into the top-level fields
+to correlate the logs with the traces, e.g. with the derived fields of Grafana and Tempo.
+
+The field may be:
+* the string with the W3C `traceparent` like `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`
+* the string with the key-value notations like `trace_id=...`, `traceId: ...`, `"span_id":"..."` or `X-B3-TraceId: ...`
+* the object of the headers with the `traceparent`, `trace_id`, `span_id`, `X-B3-TraceId` and `X-B3-SpanId` fields in any case
+
+The W3C `traceparent` takes precedence over the key-value notations. The trace IDs are 32 or 16 hex digits, the span IDs are 16 hex digits,
+the zero IDs are ignored. The IDs are stored in the lower case. If nothing is found, the event isn't changed.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: trace_context
+      field: message
+    ...
+```
+It transforms `{"message":"request done traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}` into
+`{"message":"request done traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}`.
+}*/
+
+type Plugin struct {
+	config    *Config
+	logger    *zap.SugaredLogger
+	extractor *extractor
+	plugin.NoMetricsPlugin
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The field to extract the trace context from.
+	Field  cfg.FieldSelector `json:"field" parse:"selector" default:"message"` // *
+	Field_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the trace ID into.
+	TraceIDField  cfg.FieldSelector `json:"trace_id_field" parse:"selector" default:"trace_id"` // *
+	TraceIDField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the span ID into.
+	SpanIDField  cfg.FieldSelector `json:"span_id_field" parse:"selector" default:"span_id"` // *
+	SpanIDField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the trace flags of the `traceparent` into, the flags aren't stored if it's empty.
+	TraceFlagsField  cfg.FieldSelector `json:"trace_flags_field" parse:"selector"` // *
+	TraceFlagsField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The RE2 regular expressions with the `trace_id` and the `span_id` named groups to extract the IDs from the text.
+	// > They're tried before the default key-value notations, e.g. `\[(?P<trace_id>[0-9a-f]{32}),(?P<span_id>[0-9a-f]{16})\]`.
+	Patterns []string `json:"patterns" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the existing trace ID and span ID fields are overwritten, otherwise the events with the trace ID field aren't changed.
+	Overwrite bool `json:"overwrite"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "trace_context",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if len(p.config.TraceIDField_) == 0 || len(p.config.SpanIDField_) == 0 {
+		p.logger.Fatalf("trace_id_field and span_id_field can't be empty")
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(p.config.Patterns)+len(defaultPatterns))
+	for _, expression := range p.config.Patterns {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			p.logger.Fatalf("can't compile pattern %q: %s", expression, err.Error())
+		}
+		if re.SubexpIndex("trace_id") < 0 && re.SubexpIndex("span_id") < 0 {
+			p.logger.Fatalf("pattern %q has neither trace_id nor span_id group", expression)
+		}
+		patterns = append(patterns, re)
+	}
+	patterns = append(patterns, defaultPatterns...)
+
+	p.extractor = &extractor{patterns: patterns}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	if !p.config.Overwrite && event.Root.Dig(p.config.TraceIDField_...) != nil {
+		return pipeline.ActionPass
+	}
+
+	node := event.Root.Dig(p.config.Field_...)
+	if node == nil {
+		return pipeline.ActionPass
+	}
+
+	ctx := p.extractor.extract(node)
+	if ctx == nil {
+		return pipeline.ActionPass
+	}
+
+	root := event.Root
+	if ctx.traceID != nil {
+		pipeline.AddField(root, p.config.TraceIDField_).MutateToBytesCopy(root, ctx.traceID)
+	}
+	if ctx.spanID != nil {
+		pipeline.AddField(root, p.config.SpanIDField_).MutateToBytesCopy(root, ctx.spanID)
+	}
+	if ctx.flags != nil && len(p.config.TraceFlagsField_) > 0 {
+		pipeline.AddField(root, p.config.TraceFlagsField_).MutateToBytesCopy(root, ctx.flags)
+	}
+
+	return pipeline.ActionPass
+}
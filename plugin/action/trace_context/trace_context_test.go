@@ -0,0 +1,107 @@
+package trace_context
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtract(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+	}{
+		{
+			name:   "traceparent",
+			config: &Config{TraceFlagsField: "trace_flags"},
+			in:     `{"message":"done traceparent=00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}`,
+			out:    `{"message":"done traceparent=00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","trace_flags":"01"}`,
+		},
+		{
+			name:   "invalid traceparent",
+			config: &Config{},
+			in:     `{"message":"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 00-00000000000000000000000000000000-00f067aa0ba902b7-01 trace_id=a3ce929d0e0e4736"}`,
+			out:    `{"message":"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 00-00000000000000000000000000000000-00f067aa0ba902b7-01 trace_id=a3ce929d0e0e4736","trace_id":"a3ce929d0e0e4736"}`,
+		},
+		{
+			name:   "key-value",
+			config: &Config{},
+			in:     `{"message":"{\"traceId\": \"4bf92f3577b34da6a3ce929d0e0e4736\", \"spanId\":\"00f067aa0ba902b7\"}"}`,
+			out:    `{"message":"{\"traceId\": \"4bf92f3577b34da6a3ce929d0e0e4736\", \"spanId\":\"00f067aa0ba902b7\"}","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}`,
+		},
+		{
+			name:   "b3",
+			config: &Config{TraceIDField: "trace.id", SpanIDField: "trace.span"},
+			in:     `{"message":"X-B3-TraceId: 80f198ee56343ba864fe8b2a57d3eff7 X-B3-SpanId: E457B5A2E4D86BD1"}`,
+			out:    `{"message":"X-B3-TraceId: 80f198ee56343ba864fe8b2a57d3eff7 X-B3-SpanId: E457B5A2E4D86BD1","trace":{"id":"80f198ee56343ba864fe8b2a57d3eff7","span":"e457b5a2e4d86bd1"}}`,
+		},
+		{
+			name:   "bad length",
+			config: &Config{},
+			in:     `{"message":"trace_id=4bf92f3577b34da6a3ce span_id=00f067aa"}`,
+			out:    `{"message":"trace_id=4bf92f3577b34da6a3ce span_id=00f067aa"}`,
+		},
+		{
+			name:   "headers",
+			config: &Config{Field: "headers"},
+			in:     `{"headers":{"Content-Type":"text/plain","X-B3-SpanId":"00f067aa0ba902b7","X-B3-TraceId":"4bf92f3577b34da6a3ce929d0e0e4736"}}`,
+			out:    `{"headers":{"Content-Type":"text/plain","X-B3-SpanId":"00f067aa0ba902b7","X-B3-TraceId":"4bf92f3577b34da6a3ce929d0e0e4736"},"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}`,
+		},
+		{
+			name:   "traceparent header",
+			config: &Config{Field: "headers"},
+			in:     `{"headers":{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}`,
+			out:    `{"headers":{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}`,
+		},
+		{
+			name:   "pattern",
+			config: &Config{Patterns: []string{`\[(?P<trace_id>[0-9a-f]{32}),(?P<span_id>[0-9a-f]{16})\]`}},
+			in:     `{"message":"[4bf92f3577b34da6a3ce929d0e0e4736,00f067aa0ba902b7] INFO done"}`,
+			out:    `{"message":"[4bf92f3577b34da6a3ce929d0e0e4736,00f067aa0ba902b7] INFO done","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}`,
+		},
+		{
+			name:   "existing",
+			config: &Config{},
+			in:     `{"message":"trace_id=4bf92f3577b34da6a3ce929d0e0e4736","trace_id":"x"}`,
+			out:    `{"message":"trace_id=4bf92f3577b34da6a3ce929d0e0e4736","trace_id":"x"}`,
+		},
+		{
+			name:   "overwrite",
+			config: &Config{Overwrite: true},
+			in:     `{"message":"trace_id=4bf92f3577b34da6a3ce929d0e0e4736","trace_id":"x"}`,
+			out:    `{"message":"trace_id=4bf92f3577b34da6a3ce929d0e0e4736","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"}`,
+		},
+		{
+			name:   "nothing",
+			config: &Config{},
+			in:     `{"message":"hello"}`,
+			out:    `{"message":"hello"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			outEvent := ""
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvent = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+
+			wg.Wait()
+			p.Stop()
+
+			assert.Equal(t, tc.out, outEvent)
+		})
+	}
+}
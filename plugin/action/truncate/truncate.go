@@ -0,0 +1,244 @@
+package truncate
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It truncates the string fields longer than `max_field_size` bytes and guards the size of the whole event,
+so the megabyte stack traces don't break Elasticsearch or Clickhouse.
+
+The truncated values end with the `suffix` and the event gets the `truncated_field` with `true` value.
+The values are truncated on the UTF-8 characters boundaries, the size of the truncated value with the suffix
+doesn't exceed `max_field_size`. The non-string fields aren't truncated.
+
+If `max_event_size` is set, the encoded event size is checked after the fields are truncated.
+The events above the limit are discarded or trimmed according to `oversize`: the longest string fields
+of the event are truncated until the event fits the limit, if it's impossible the event is discarded.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: truncate
+      fields: [message, stack_trace]
+      max_field_size: 16384
+      max_event_size: 65536
+      oversize: trim
+    ...
+```
+}*/
+
+const (
+	oversizeDiscard = "discard"
+	oversizeTrim    = "trim"
+
+	// trimAttempts is the number of the attempts to trim the event since the escaping makes the encoded size inexact
+	trimAttempts = 3
+)
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	fields [][]string
+
+	buf     []byte
+	strings []*insaneJSON.Node
+
+	truncatedMetric *prom.CounterVec
+	trimmedMetric   *prom.CounterVec
+	discardedMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The fields to truncate.
+	Fields []string `json:"fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The maximum size of the fields in bytes.
+	MaxFieldSize int `json:"max_field_size" default:"1024"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The suffix of the truncated values.
+	Suffix string `json:"suffix" default:"..."` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field set to `true` if the event is truncated.
+	TruncatedField  cfg.FieldSelector `json:"truncated_field" default:"truncated" parse:"selector"` // *
+	TruncatedField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The maximum size of the encoded event in bytes, zero means no limit.
+	MaxEventSize int `json:"max_event_size"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do with the events above `max_event_size`:
+	// > * `discard` discards the event
+	// > * `trim` truncates the longest string fields of the event
+	Oversize string `json:"oversize" default:"discard" options:"discard|trim"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "truncate",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	if len(p.config.Fields) == 0 && p.config.MaxEventSize <= 0 {
+		p.logger.Fatalf("fields or max_event_size must be set")
+	}
+	if len(p.config.Fields) > 0 && p.config.MaxFieldSize <= len(p.config.Suffix) {
+		p.logger.Fatalf("max_field_size must be greater than the suffix size")
+	}
+	if len(p.config.TruncatedField_) == 0 {
+		p.logger.Fatalf("truncated_field must be set")
+	}
+
+	for _, field := range p.config.Fields {
+		path := cfg.ParseFieldSelector(field)
+		if len(path) == 0 {
+			p.logger.Fatalf("empty field in fields")
+		}
+		p.fields = append(p.fields, path)
+	}
+}
+
+func (p *Plugin) Stop() {
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.truncatedMetric = ctl.RegisterCounter("truncate_fields_total", "Number of fields truncated by truncate plugin")
+	p.trimmedMetric = ctl.RegisterCounter("truncate_trimmed_total", "Number of events above max_event_size trimmed by truncate plugin")
+	p.discardedMetric = ctl.RegisterCounter("truncate_discarded_total", "Number of events above max_event_size discarded by truncate plugin")
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	for _, path := range p.fields {
+		node := event.Root.Dig(path...)
+		if node == nil || !node.IsString() {
+			continue
+		}
+		value := node.AsString()
+		if len(value) <= p.config.MaxFieldSize {
+			continue
+		}
+
+		node.MutateToString(p.truncate(value, p.config.MaxFieldSize))
+		p.markTruncated(event.Root)
+		p.truncatedMetric.WithLabelValues().Inc()
+	}
+
+	if p.config.MaxEventSize <= 0 || p.size(event.Root) <= p.config.MaxEventSize {
+		return pipeline.ActionPass
+	}
+
+	if p.config.Oversize == oversizeTrim && p.trim(event.Root) {
+		p.trimmedMetric.WithLabelValues().Inc()
+		return pipeline.ActionPass
+	}
+
+	p.discardedMetric.WithLabelValues().Inc()
+	return pipeline.ActionDiscard
+}
+
+// trim truncates the longest strings of the event until it fits max_event_size, it returns false if it's impossible.
+func (p *Plugin) trim(root *insaneJSON.Root) bool {
+	flag := p.markTruncated(root)
+
+	for i := 0; i < trimAttempts; i++ {
+		excess := p.size(root) - p.config.MaxEventSize
+		if excess <= 0 {
+			return true
+		}
+
+		p.strings = collectStrings(root.Node, flag, p.strings[:0])
+		sort.SliceStable(p.strings, func(i, j int) bool {
+			return len(p.strings[i].AsString()) > len(p.strings[j].AsString())
+		})
+
+		for _, node := range p.strings {
+			if excess <= 0 {
+				break
+			}
+			value := node.AsString()
+			if len(value) <= len(p.config.Suffix) {
+				break
+			}
+
+			size := len(value) - excess
+			if size < len(p.config.Suffix) {
+				size = len(p.config.Suffix)
+			}
+			truncated := p.truncate(value, size)
+			excess -= len(value) - len(truncated)
+			node.MutateToString(truncated)
+		}
+	}
+
+	return p.size(root) <= p.config.MaxEventSize
+}
+
+// truncate truncates the value with the suffix to the size.
+func (p *Plugin) truncate(value string, size int) string {
+	size -= len(p.config.Suffix)
+	for size > 0 && !utf8.RuneStart(value[size]) {
+		size--
+	}
+	return value[:size] + p.config.Suffix
+}
+
+func (p *Plugin) markTruncated(root *insaneJSON.Root) *insaneJSON.Node {
+	return pipeline.AddField(root, p.config.TruncatedField_).MutateToBool(true)
+}
+
+func (p *Plugin) size(root *insaneJSON.Root) int {
+	p.buf = root.Encode(p.buf[:0])
+	return len(p.buf)
+}
+
+// collectStrings appends the string values of the node except the skipped one.
+func collectStrings(node *insaneJSON.Node, skip *insaneJSON.Node, strings []*insaneJSON.Node) []*insaneJSON.Node {
+	switch {
+	case node == skip:
+	case node.IsObject():
+		for _, field := range node.AsFields() {
+			strings = collectStrings(field.AsFieldValue(), skip, strings)
+		}
+	case node.IsArray():
+		for _, element := range node.AsArray() {
+			strings = collectStrings(element, skip, strings)
+		}
+	case node.IsString():
+		strings = append(strings, node)
+	}
+	return strings
+}
@@ -0,0 +1,94 @@
+package truncate
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncate(t *testing.T) {
+	long := strings.Repeat("a", 40)
+	cases := []struct {
+		name   string
+		config *Config
+		in     string
+		out    string
+		result pipeline.ActionResult
+	}{
+		{
+			name:   "fields",
+			config: &Config{Fields: []string{"message", "error.stack", "num", "short"}, MaxFieldSize: 10},
+			in:     `{"message":"` + long + `","error":{"stack":"ab\nпривет"},"num":12345678901234,"short":"ok"}`,
+			out:    `{"message":"aaaaaaa...","error":{"stack":"ab\nпр..."},"num":12345678901234,"short":"ok","truncated":true}`,
+		},
+		{
+			name:   "custom flag",
+			config: &Config{Fields: []string{"message"}, MaxFieldSize: 5, Suffix: "~", TruncatedField: "meta.cut"},
+			in:     `{"message":"abcdefg","meta":{"id":1}}`,
+			out:    `{"message":"abcd~","meta":{"id":1,"cut":true}}`,
+		},
+		{
+			name:   "small event",
+			config: &Config{MaxEventSize: 100},
+			in:     `{"message":"` + long + `"}`,
+			out:    `{"message":"` + long + `"}`,
+		},
+		{
+			name:   "discard",
+			config: &Config{MaxEventSize: 40},
+			in:     `{"message":"` + long + `"}`,
+			result: pipeline.ActionDiscard,
+		},
+		{
+			name:   "trim",
+			config: &Config{MaxEventSize: 70, Oversize: "trim"},
+			in:     `{"a":"` + long + `","b":"` + long[:20] + `","c":1}`,
+			out:    `{"a":"aaaaaaaaa...","b":"aaaaaaaaaaaaaaaaaaaa","c":1,"truncated":true}`,
+		},
+		{
+			name:   "trim impossible",
+			config: &Config{MaxEventSize: 30, Oversize: "trim"},
+			in:     `{"a":"` + long + `","b":[1,2,3,4,5,6,7,8,9]}`,
+			result: pipeline.ActionDiscard,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := test.NewConfig(tc.config, nil)
+			p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(factory, config, pipeline.MatchModeAnd, nil, false))
+			// the empty event is passed after the case event, so the discarded event is processed once it's got
+			passed := 2
+			if tc.result == pipeline.ActionDiscard {
+				passed = 1
+			}
+			wg := &sync.WaitGroup{}
+			wg.Add(passed)
+
+			outEvents := make(map[int64]string)
+			output.SetOutFn(func(e *pipeline.Event) {
+				outEvents[e.Offset] = e.Root.EncodeToString()
+				wg.Done()
+			})
+
+			input.In(0, "test.log", 0, []byte(tc.in))
+			input.In(0, "test.log", 1, []byte(`{}`))
+
+			wg.Wait()
+			p.Stop()
+
+			out, ok := outEvents[0]
+			if tc.result == pipeline.ActionDiscard {
+				assert.False(t, ok, "event isn't discarded")
+				return
+			}
+			assert.Equal(t, tc.out, out)
+			if tc.config.MaxEventSize > 0 {
+				assert.LessOrEqual(t, len(out), tc.config.MaxEventSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package validate_schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const schemaURL = "file:///validate_schema.json"
+
+// violation is the failed keyword of the value at the JSON pointer path.
+type violation struct {
+	path    string
+	keyword string
+	message string
+}
+
+func (v violation) String() string {
+	return fmt.Sprintf("%q: %s: %s", v.path, v.keyword, v.message)
+}
+
+// compileSchema compiles the JSON Schema of the data, the remote references aren't loaded.
+func compileSchema(data []byte) (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	c.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("can't load %s: remote references aren't supported", url)
+	}
+
+	if err := c.AddResource(schemaURL, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("can't parse schema: %w", err)
+	}
+	return c.Compile(schemaURL)
+}
+
+// violations returns the failed keywords of the validation error up to the limit.
+// The properties are validated in random order, so the violations are sorted by the path.
+func violations(err error, limit int) []violation {
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []violation{{keyword: "error", message: err.Error()}}
+	}
+
+	result := make([]violation, 0)
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			result = append(result, violation{
+				path:    e.InstanceLocation,
+				keyword: keywordOf(e.KeywordLocation),
+				message: e.Message,
+			})
+			return
+		}
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+	}
+	collect(validationErr)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].path < result[j].path
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// keywordOf returns the last keyword of the keyword location like `/properties/level/enum`.
+func keywordOf(location string) string {
+	keyword := location[strings.LastIndexByte(location, '/')+1:]
+	if keyword == "" {
+		return "false"
+	}
+	return keyword
+}
@@ -0,0 +1,231 @@
+package validate_schema
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It validates the events against the JSON Schema draft 2020-12 and handles the invalid events by the `on_invalid` policy.
+The invalid events can be marked with the route tag and sent to the dead letter output with the `accept_tags` of the output.
+
+The schemas are compiled and checked by [jsonschema](https://github.com/santhosh-tekuri/jsonschema).
+The schema must be self-contained: the remote references aren't loaded and the schemas with them are rejected.
+The `format` and the other annotations aren't asserted. The `pattern` is the RE2 regular expression.
+
+The failed keywords are counted in the `validate_schema_violations_total` metric with the `keyword` label.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    actions:
+    - type: validate_schema
+      schema: |
+        {
+          "type": "object",
+          "required": ["service", "level"],
+          "properties": {
+            "level": {"enum": ["debug", "info", "warn", "error"]},
+            "duration_ms": {"type": "integer", "minimum": 0}
+          }
+        }
+      on_invalid: route
+      route_tag: invalid
+    ...
+    outputs:
+    - type: elasticsearch
+      reject_tags: [invalid]
+      ...
+    - type: kafka
+      accept_tags: [invalid]
+      topics: [ingestion-dlq]
+      ...
+```
+It transforms `{"service":"api","level":"fatal"}` into `{"service":"api","level":"fatal","schema_errors":["\"/level\": enum: value must be one of \"debug\", \"info\", \"warn\", \"error\""]}` and marks it with the `invalid` tag.
+}*/
+
+const (
+	onInvalidDiscard = "discard"
+	onInvalidRoute   = "route"
+)
+
+var (
+	schemasMu = &sync.Mutex{}
+	// schemas are the compiled schemas which are shared by the processors of the action.
+	schemas = make(map[*Config]*schemaRef)
+)
+
+type schemaRef struct {
+	schema *jsonschema.Schema
+	refs   int
+}
+
+type Plugin struct {
+	config *Config
+	logger *zap.SugaredLogger
+	schema *jsonschema.Schema
+
+	invalidMetric    *prom.CounterVec
+	violationsMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The JSON Schema, either `schema` or `schema_file` must be set.
+	Schema string `json:"schema"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The path to the file with the JSON Schema.
+	SchemaFile string `json:"schema_file"` // *
+
+	// > @3@4@5@6
+	// >
+	// > What to do with the invalid events:
+	// > * `tag` adds the violations to the `error_field` and passes the event
+	// > * `route` adds the violations to the `error_field` and marks the event with the `route_tag`
+	// > * `discard` discards the event
+	OnInvalid string `json:"on_invalid" default:"tag" options:"tag|route|discard"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The field to put the array of the violations into.
+	ErrorField  cfg.FieldSelector `json:"error_field" default:"schema_errors" parse:"selector"` // *
+	ErrorField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The route tag to mark the invalid events with if `on_invalid` is `route`.
+	RouteTag string `json:"route_tag" default:"schema_invalid"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The max number of the violations to collect for the event.
+	MaxErrors int `json:"max_errors" default:"10"` // *
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterAction(&pipeline.PluginStaticInfo{
+		Type:    "validate_schema",
+		Factory: factory,
+	})
+}
+
+func factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.ActionPluginParams) {
+	p.config = config.(*Config)
+	p.logger = params.Logger
+
+	var err error
+	p.schema, err = compile(p.config)
+	if err != nil {
+		p.logger.Fatalf("can't compile json schema: %s", err.Error())
+	}
+
+	if p.config.MaxErrors <= 0 {
+		p.logger.Fatalf("max_errors must be greater than zero")
+	}
+}
+
+// compile compiles the schema once for all the processors of the action.
+func compile(config *Config) (*jsonschema.Schema, error) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	if ref, has := schemas[config]; has {
+		ref.refs++
+		return ref.schema, nil
+	}
+
+	data := []byte(config.Schema)
+	switch {
+	case config.Schema != "" && config.SchemaFile != "":
+		return nil, errors.New("schema and schema_file can't be set both")
+	case config.SchemaFile != "":
+		var err error
+		data, err = os.ReadFile(config.SchemaFile)
+		if err != nil {
+			return nil, err
+		}
+	case config.Schema == "":
+		return nil, errors.New("schema or schema_file must be set")
+	}
+
+	s, err := compileSchema(data)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas[config] = &schemaRef{schema: s, refs: 1}
+	return s, nil
+}
+
+// release removes the schema once the last processor of the action is stopped.
+func release(config *Config) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	ref := schemas[config]
+	ref.refs--
+	if ref.refs == 0 {
+		delete(schemas, config)
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.invalidMetric = ctl.RegisterCounter("validate_schema_invalid_total", "Number of events failed JSON Schema validation")
+	p.violationsMetric = ctl.RegisterCounter("validate_schema_violations_total", "Number of JSON Schema violations by keyword", "keyword")
+}
+
+func (p *Plugin) Stop() {
+	release(p.config)
+}
+
+func (p *Plugin) Do(event *pipeline.Event) pipeline.ActionResult {
+	err := p.schema.Validate(pipeline.NodeValue(event.Root.Node))
+	if err == nil {
+		return pipeline.ActionPass
+	}
+	eventViolations := violations(err, p.config.MaxErrors)
+
+	if p.invalidMetric != nil {
+		p.invalidMetric.WithLabelValues().Inc()
+	}
+	for _, violation := range eventViolations {
+		p.logger.Debugf("event doesn't match json schema: %s", violation.String())
+		if p.violationsMetric != nil {
+			p.violationsMetric.WithLabelValues(violation.keyword).Inc()
+		}
+	}
+
+	if p.config.OnInvalid == onInvalidDiscard {
+		return pipeline.ActionDiscard
+	}
+
+	errorsNode := pipeline.AddField(event.Root, p.config.ErrorField_).MutateToArray()
+	for _, violation := range eventViolations {
+		errorsNode.AddElementNoAlloc(event.Root).MutateToString(violation.String())
+	}
+	if p.config.OnInvalid == onInvalidRoute {
+		event.AddRouteTag(p.config.RouteTag)
+	}
+
+	return pipeline.ActionPass
+}
@@ -0,0 +1,237 @@
+package validate_schema
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+const testSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["service", "level"],
+	"properties": {
+		"service": {"type": "string", "minLength": 1, "pattern": "^[a-z-]+$"},
+		"level": {"enum": ["debug", "info", "warn", "error"]},
+		"duration_ms": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+		"user": {"$ref": "#/$defs/user"}
+	},
+	"patternProperties": {"^x_": {"type": "string"}},
+	"additionalProperties": false,
+	"$defs": {
+		"user": {
+			"type": "object",
+			"properties": {"id": {"type": ["integer", "string"]}, "manager": {"$ref": "#/$defs/user"}},
+			"required": ["id"]
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       string
+		out      string
+		keywords map[string]float64
+	}{
+		{
+			name: "valid",
+			in:   `{"service":"api","level":"info","duration_ms":5,"tags":["a","b"],"x_trace":"t","user":{"id":1,"manager":{"id":"m"}}}`,
+			out:  `{"service":"api","level":"info","duration_ms":5,"tags":["a","b"],"x_trace":"t","user":{"id":1,"manager":{"id":"m"}}}`,
+		},
+		{
+			name:     "enum and type",
+			in:       `{"service":"api","level":"fatal","duration_ms":1.5}`,
+			out:      `{"service":"api","level":"fatal","duration_ms":1.5,"schema_errors":["\"/duration_ms\": type: expected integer, but got number","\"/level\": enum: value must be one of \"debug\", \"info\", \"warn\", \"error\""]}`,
+			keywords: map[string]float64{"enum": 1, "type": 1},
+		},
+		{
+			name:     "required and additional",
+			in:       `{"level":"info","x_trace":1,"other":true}`,
+			out:      `{"level":"info","x_trace":1,"other":true,"schema_errors":["\"\": required: missing properties: 'service'","\"\": additionalProperties: additionalProperties 'other' not allowed","\"/x_trace\": type: expected string, but got number"]}`,
+			keywords: map[string]float64{"required": 1, "type": 1, "additionalProperties": 1},
+		},
+		{
+			name:     "nested ref and array",
+			in:       `{"service":"Api","level":"info","tags":["a","a"],"user":{"manager":{"id":true}}}`,
+			out:      `{"service":"Api","level":"info","tags":["a","a"],"user":{"manager":{"id":true}},"schema_errors":["\"/service\": pattern: does not match pattern '^[a-z-]+$'","\"/tags\": uniqueItems: items at index 0 and 1 are equal","\"/user\": required: missing properties: 'id'","\"/user/manager/id\": type: expected integer or string, but got boolean"]}`,
+			keywords: map[string]float64{"pattern": 1, "uniqueItems": 1, "required": 1, "type": 1},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, outEvents := runPipeline(&Config{Schema: testSchema}, []string{tc.in}, 1)
+			assert.Equal(t, tc.out, outEvents[0].json)
+
+			for keyword, count := range tc.keywords {
+				assert.Equal(t, count, testutil.ToFloat64(p.violationsMetric.WithLabelValues(keyword)), keyword)
+			}
+			invalid := float64(0)
+			if len(tc.keywords) > 0 {
+				invalid = 1
+			}
+			assert.Equal(t, invalid, testutil.ToFloat64(p.invalidMetric.WithLabelValues()))
+		})
+	}
+}
+
+func TestOnInvalid(t *testing.T) {
+	in := `{"level":"info"}`
+
+	_, outEvents := runPipeline(&Config{Schema: testSchema, OnInvalid: "discard"}, []string{in, `{"service":"api","level":"info"}`}, 1)
+	assert.NotContains(t, outEvents, int64(0), "invalid event isn't discarded")
+	assert.Equal(t, `{"service":"api","level":"info"}`, outEvents[1].json)
+
+	config := &Config{Schema: testSchema, OnInvalid: "route", RouteTag: "dlq", ErrorField: "meta.errors"}
+	_, outEvents = runPipeline(config, []string{in, `{"service":"api","level":"info"}`}, 2)
+	assert.Equal(t, `{"level":"info","meta":{"errors":["\"\": required: missing properties: 'service'"]}}`, outEvents[0].json)
+	assert.Equal(t, []string{"dlq"}, outEvents[0].routes)
+	assert.Empty(t, outEvents[1].routes)
+}
+
+func TestSchemaFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"object","properties":{"a":{"const":{"b":[1,2]}}}}`), 0o644))
+
+	_, outEvents := runPipeline(&Config{SchemaFile: path, OnInvalid: "discard"}, []string{`{"a":{"b":[2,1]}}`, `{"a":{"b":[1.0,2]}}`}, 1)
+	assert.NotContains(t, outEvents, int64(0), "invalid event isn't discarded")
+	assert.Contains(t, outEvents, int64(1), "valid event is discarded")
+}
+
+func TestKeywords(t *testing.T) {
+	cases := []struct {
+		schema  string
+		valid   []string
+		invalid []string
+	}{
+		{
+			schema:  `{"type":"number","exclusiveMinimum":0,"maximum":10,"multipleOf":0.5}`,
+			valid:   []string{`10`, `0.5`},
+			invalid: []string{`0`, `10.5`, `0.7`, `"s"`},
+		},
+		{
+			schema:  `{"maxLength":2,"minLength":1}`,
+			valid:   []string{`"ab"`, `"яя"`, `5`},
+			invalid: []string{`""`, `"abc"`},
+		},
+		{
+			schema:  `{"prefixItems":[{"type":"string"}],"items":{"type":"integer"},"contains":{"const":1},"maxContains":1}`,
+			valid:   []string{`["a",1,2]`, `["a",1]`},
+			invalid: []string{`[1,1]`, `["a",2]`, `["a",1,1]`, `["a","b",1]`},
+		},
+		{
+			schema:  `{"minProperties":1,"maxProperties":2,"propertyNames":{"maxLength":3},"dependentRequired":{"a":["b"]},"dependentSchemas":{"c":{"required":["d"]}}}`,
+			valid:   []string{`{"a":1,"b":2}`, `{"x":1}`, `{"c":1,"d":2}`},
+			invalid: []string{`{}`, `{"x":1,"y":2,"z":3}`, `{"long":1}`, `{"a":1}`, `{"c":1}`},
+		},
+		{
+			schema:  `{"anyOf":[{"type":"string"},{"type":"integer"}],"not":{"const":"x"}}`,
+			valid:   []string{`"a"`, `1`},
+			invalid: []string{`"x"`, `1.5`, `null`},
+		},
+		{
+			schema:  `{"oneOf":[{"type":"integer"},{"minimum":2}]}`,
+			valid:   []string{`1`, `2.5`},
+			invalid: []string{`3`, `0.5`},
+		},
+		{
+			schema:  `{"if":{"properties":{"kind":{"const":"http"}}},"then":{"required":["status"]},"else":{"required":["code"]}}`,
+			valid:   []string{`{"kind":"http","status":200}`, `{"kind":"grpc","code":0}`},
+			invalid: []string{`{"kind":"http"}`, `{"kind":"grpc","status":200}`},
+		},
+		{
+			schema:  `{"$defs":{"node":{"type":"object","properties":{"next":{"$ref":"#/$defs/node"},"v":{"type":"integer"}}}},"$ref":"#/$defs/node"}`,
+			valid:   []string{`{"v":1,"next":{"v":2,"next":{}}}`},
+			invalid: []string{`{"next":{"next":{"v":"x"}}}`, `[]`},
+		},
+		{
+			schema:  `{"properties":{"a":true},"unevaluatedProperties":false}`,
+			valid:   []string{`{"a":1}`, `{}`},
+			invalid: []string{`{"a":1,"b":2}`},
+		},
+		{
+			schema:  `{"type":["null","boolean"]}`,
+			valid:   []string{`null`, `true`, `false`},
+			invalid: []string{`0`, `"true"`},
+		},
+	}
+	for _, tc := range cases {
+		s, err := compileSchema([]byte(tc.schema))
+		require.NoError(t, err, tc.schema)
+
+		for _, in := range tc.valid {
+			assert.NoError(t, s.Validate(pipeline.NodeValue(decode(t, in))), "%s must be valid for %s", in, tc.schema)
+		}
+		for _, in := range tc.invalid {
+			assert.Error(t, s.Validate(pipeline.NodeValue(decode(t, in))), "%s must be invalid for %s", in, tc.schema)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	schemas := []string{
+		`[]`,
+		`{"type":"float"}`,
+		`{"$ref":"other.json#/a"}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"pattern":"("}`,
+		`{"minLength":-1}`,
+		`{"multipleOf":0}`,
+		`{"properties":{"a":1}}`,
+	}
+	for _, s := range schemas {
+		_, err := compileSchema([]byte(s))
+		assert.Error(t, err, s)
+	}
+}
+
+type outEvent struct {
+	json   string
+	routes []string
+}
+
+// runPipeline passes the events through the action and waits for the passed ones,
+// the output events are mapped by the index of the input event.
+// It returns any processor of the action to check the metrics shared by the processors.
+func runPipeline(config *Config, in []string, passed int) (*Plugin, map[int64]outEvent) {
+	test.NewConfig(config, nil)
+	var plugin *Plugin
+	pluginFactory := func() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+		plugin = &Plugin{}
+		return plugin, &Config{}
+	}
+	p, input, output := test.NewPipelineMock(test.NewActionPluginStaticInfo(pluginFactory, config, pipeline.MatchModeAnd, nil, false))
+	wg := &sync.WaitGroup{}
+	wg.Add(passed)
+
+	outEvents := make(map[int64]outEvent)
+	output.SetOutFn(func(e *pipeline.Event) {
+		outEvents[e.Offset] = outEvent{json: e.Root.EncodeToString(), routes: append([]string(nil), e.RouteTags()...)}
+		wg.Done()
+	})
+
+	for i, event := range in {
+		input.In(0, "test.log", int64(i), []byte(event))
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	return plugin, outEvents
+}
+
+func decode(t *testing.T, in string) *insaneJSON.Node {
+	root, err := insaneJSON.DecodeString(in)
+	require.NoError(t, err)
+	t.Cleanup(func() { insaneJSON.Release(root) })
+	return root.Node
+}
@@ -84,6 +84,24 @@ type Config struct {
 	// > * *`newest`* - set offset to the newest message
 	// > * *`oldest`* - set offset to the oldest message
 	Offset string `json:"offset" default:"newest" options:"oldest|newest"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The strategy of assigning the partitions to the consumers of the group.
+	// > * *`round_robin`* - distribute the partitions one by one
+	// > * *`range`* - assign the ranges of the partitions of the topics
+	// > * *`sticky`* - keep the partitions of the consumers through the rebalances as much as possible
+	// >
+	// > Rebalances use the eager protocol: `sarama` doesn't implement the incremental cooperative one,
+	// > so the `sticky` strategy is the way to keep the partitions of the consumers.
+	RebalanceStrategy string `json:"rebalance_strategy" default:"round_robin" options:"round_robin|range|sticky"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The static member ID of the consumer in the group, it must be unique in the group.
+	// > The partitions of the restarted consumer aren't reassigned if it comes back within the session timeout.
+	// > Kafka 2.3 or newer is required if it's set.
+	InstanceID string `json:"instance_id" default:""` // *
 }
 
 func init() {
@@ -152,11 +170,38 @@ func (p *Plugin) Commit(event *pipeline.Event) {
 }
 
 func (p *Plugin) newConsumerGroup() sarama.ConsumerGroup {
+	config := p.newSaramaConfig()
+
+	consumerGroup, err := sarama.NewConsumerGroup(p.config.Brokers, p.config.ConsumerGroup, config)
+	if err != nil {
+		p.logger.Fatalf("can't create kafka consumer: %s", err.Error())
+	}
+
+	return consumerGroup
+}
+
+func (p *Plugin) newSaramaConfig() *sarama.Config {
 	config := sarama.NewConfig()
-	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
 	config.Version = sarama.V0_10_2_0
 	config.ChannelBufferSize = p.config.ChannelBufferSize
 
+	switch p.config.RebalanceStrategy {
+	case "round_robin":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRoundRobin}
+	case "range":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRange}
+	case "sticky":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategySticky}
+	default:
+		p.logger.Fatalf("unexpected value of the rebalance_strategy field: %s", p.config.RebalanceStrategy)
+	}
+
+	if p.config.InstanceID != "" {
+		// static membership is supported since JoinGroup v5
+		config.Version = sarama.V2_3_0_0
+		config.Consumer.Group.InstanceId = p.config.InstanceID
+	}
+
 	switch p.config.Offset {
 	case "oldest":
 		config.Consumer.Offsets.Initial = sarama.OffsetOldest
@@ -166,12 +211,7 @@ func (p *Plugin) newConsumerGroup() sarama.ConsumerGroup {
 		p.logger.Fatalf("unexpected value of the offset field: %s", p.config.Offset)
 	}
 
-	consumerGroup, err := sarama.NewConsumerGroup(p.config.Brokers, p.config.ConsumerGroup, config)
-	if err != nil {
-		p.logger.Fatalf("can't create kafka consumer: %s", err.Error())
-	}
-
-	return consumerGroup
+	return config
 }
 
 func (p *Plugin) Setup(session sarama.ConsumerGroupSession) error {
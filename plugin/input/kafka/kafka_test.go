@@ -3,7 +3,11 @@ package kafka
 import (
 	"testing"
 
+	"github.com/Shopify/sarama"
+	"github.com/ozontech/file.d/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func TestAssembleSourceID(t *testing.T) {
@@ -17,3 +21,41 @@ func TestAssembleSourceID(t *testing.T) {
 	assert.Equal(t, index, newIndex, "values aren't equal")
 	assert.Equal(t, partition, newPartition, "values aren't equal")
 }
+
+func TestSaramaConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		strategy string
+		instance string
+		version  sarama.KafkaVersion
+	}{
+		{
+			name:     "default",
+			config:   &Config{Brokers: []string{"kafka:9092"}, Topics: []string{"logs"}},
+			strategy: sarama.RoundRobinBalanceStrategyName,
+			version:  sarama.V0_10_2_0,
+		},
+		{
+			name:     "static_membership",
+			config:   &Config{Brokers: []string{"kafka:9092"}, Topics: []string{"logs"}, RebalanceStrategy: "sticky", InstanceID: "file-d-1"},
+			strategy: sarama.StickyBalanceStrategyName,
+			instance: "file-d-1",
+			version:  sarama.V2_3_0_0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			test.NewConfig(tc.config, nil)
+			p := &Plugin{config: tc.config, logger: zap.NewExample().Sugar()}
+
+			config := p.newSaramaConfig()
+			require.NoError(t, config.Validate())
+			require.Len(t, config.Consumer.Group.Rebalance.GroupStrategies, 1)
+			assert.Equal(t, tc.strategy, config.Consumer.Group.Rebalance.GroupStrategies[0].Name())
+			assert.Equal(t, tc.instance, config.Consumer.Group.InstanceId)
+			assert.Equal(t, tc.version, config.Version)
+		})
+	}
+}
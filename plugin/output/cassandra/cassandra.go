@@ -0,0 +1,460 @@
+package cassandra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/tls"
+	"github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It writes events to a Cassandra or ScyllaDB table using [gocql](https://github.com/gocql/gocql).
+
+Every event is inserted as a row with the prepared statement `INSERT INTO <table> (<columns>) VALUES (?, ...)`,
+a value of a column is taken from the event field with the same name.
+Missing fields are inserted as `null`.
+
+Rows are grouped by the partition key of the table and every group is sent as an unlogged batch
+to the nodes owning the partition (token-aware routing).
+Inserts are idempotent, so failed batches are retried on any available node.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: cassandra
+      hosts: ["cassandra-0:9042", "cassandra-1:9042"]
+      table: logs.events
+      consistency: local_quorum
+      columns:
+        - name: service
+          type: text
+        - name: ts
+          type: timestamp
+        - name: message
+          type: text
+```
+}*/
+
+const (
+	outPluginType = "cassandra"
+)
+
+var errWrongType = errors.New("wrong field type")
+
+// session is the part of gocql.Session used by the plugin.
+type session interface {
+	NewBatch(typ gocql.BatchType) *gocql.Batch
+	ExecuteBatch(batch *gocql.Batch) error
+	KeyspaceMetadata(keyspace string) (*gocql.KeyspaceMetadata, error)
+	Close()
+}
+
+type Plugin struct {
+	config       *Config
+	logger       *zap.SugaredLogger
+	avgEventSize int
+	batcher      *pipeline.Batcher
+	controller   pipeline.OutputPluginController
+
+	session     session
+	query       string
+	consistency gocql.Consistency
+	pkIndexes   []int
+
+	// plugin metrics
+
+	sendErrorMetric      *prometheus.CounterVec
+	discardedEventMetric *prometheus.CounterVec
+	writtenEventMetric   *prometheus.CounterVec
+}
+
+type ConfigColumn struct {
+	Name       string `json:"name" required:"true"`
+	ColumnType string `json:"type" required:"true" options:"text|int|bigint|double|boolean|timestamp|blob"`
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Contact points of the cluster. Format: `host:port`.
+	Hosts []string `json:"hosts" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The target table with the keyspace. Format: `keyspace.table`.
+	Table string `json:"table" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Columns of the table. Each column has a name and a type:
+	// > * `text` – strings; other values are inserted as JSON
+	// > * `int`, `bigint`, `double`, `boolean` – numbers and booleans
+	// > * `timestamp` – unix time in seconds or RFC3339 string
+	// > * `blob` – string bytes
+	Columns []ConfigColumn `json:"columns" required:"true" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Consistency level of writes.
+	Consistency string `json:"consistency" default:"local_quorum" options:"any|one|two|three|quorum|all|local_quorum|each_quorum|local_one"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Username for PasswordAuthenticator.
+	Username string `json:"username"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Password for PasswordAuthenticator.
+	Password string `json:"password"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA file. TLS is used if it's set.
+	CACert string `json:"ca_cert"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of connecting and requests.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"5s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Retries of writing the batch, file.d crashes after all of them fail
+	// > unless the output has the [fallback output](/docs/configuring.md#fallback-output).
+	Retry int `json:"retry" default:"10"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Retention between retries.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > A minimum size of events in a batch to send.
+	// > If both batch_size and batch_size_bytes are set, they will work together.
+	BatchSizeBytes  cfg.Expression `json:"batch_size_bytes" default:"0" parse:"expression"` // *
+	BatchSizeBytes_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.avgEventSize = params.PipelineSettings.AvgEventSize
+	p.config = config.(*Config)
+
+	if len(p.config.Hosts) == 0 {
+		p.logger.Fatal("'hosts' can't be empty")
+	}
+	if len(p.config.Columns) == 0 {
+		p.logger.Fatal("'columns' can't be empty")
+	}
+	if p.config.Retry < 1 {
+		p.logger.Fatal("'retry' can't be <1")
+	}
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+
+	cluster, err := p.newCluster()
+	if err != nil {
+		p.logger.Fatalf("can't init cassandra output: %s", err.Error())
+	}
+	session, err := cluster.CreateSession()
+	if err != nil {
+		p.logger.Fatalf("can't connect to cassandra: %s", err.Error())
+	}
+	p.session = session
+	p.init()
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		MaintenanceFn:  p.maintenance,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		BatchSizeBytes: p.config.BatchSizeBytes_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) newCluster() (*gocql.ClusterConfig, error) {
+	cluster := gocql.NewCluster(p.config.Hosts...)
+	cluster.Timeout = p.config.RequestTimeout_
+	cluster.ConnectTimeout = p.config.RequestTimeout_
+	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+	if p.config.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: p.config.Username,
+			Password: p.config.Password,
+		}
+	}
+	if p.config.CACert != "" {
+		b := tls.NewConfigBuilder()
+		if err := b.AppendCARoot(p.config.CACert); err != nil {
+			return nil, fmt.Errorf("can't append CA root: %w", err)
+		}
+		cluster.SslOpts = &gocql.SslOptions{Config: b.Build(), EnableHostVerification: true}
+	}
+
+	return cluster, nil
+}
+
+func (p *Plugin) init() {
+	names := make([]string, 0, len(p.config.Columns))
+	for _, column := range p.config.Columns {
+		names = append(names, column.Name)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	p.query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", p.config.Table, strings.Join(names, ", "), placeholders)
+
+	p.consistency = gocql.ParseConsistency(p.config.Consistency)
+
+	// the rows are grouped by the partition key only if all its columns are inserted
+	keyspace, table, _ := strings.Cut(p.config.Table, ".")
+	meta, err := p.session.KeyspaceMetadata(keyspace)
+	if err != nil || meta.Tables[table] == nil {
+		p.logger.Warnf("rows aren't grouped by the partition key, can't get the metadata of %s: %v", p.config.Table, err)
+		return
+	}
+	for _, column := range meta.Tables[table].PartitionKey {
+		index := -1
+		for i, name := range names {
+			if name == column.Name {
+				index = i
+			}
+		}
+		if index == -1 {
+			p.logger.Warnf("rows aren't grouped by the partition key, column %q isn't inserted", column.Name)
+			p.pkIndexes = nil
+			return
+		}
+		p.pkIndexes = append(p.pkIndexes, index)
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_cassandra_send_error", "Total Cassandra send errors")
+	p.discardedEventMetric = ctl.RegisterCounter("output_cassandra_event_discarded", "Total events discarded because of wrong field types")
+	p.writtenEventMetric = ctl.RegisterCounter("output_cassandra_event_written", "Total events written to Cassandra")
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+	p.session.Close()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{groups: make(map[string][][]any)}
+	}
+	data := (*workerData).(*data)
+
+	rows := make([][]any, 0, len(batch.Events))
+	for _, event := range batch.Events {
+		values, err := p.makeValues(event.Root)
+		if err != nil {
+			p.discardedEventMetric.WithLabelValues().Inc()
+			p.logger.Errorf("event is discarded: %s", err.Error())
+			continue
+		}
+		rows = append(rows, values)
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	written := len(rows)
+	for attempt := 1; ; attempt++ {
+		var err error
+		rows, err = p.write(data, rows)
+		if err == nil {
+			break
+		}
+
+		p.sendErrorMetric.WithLabelValues().Inc()
+		if attempt >= p.config.Retry {
+			if p.batcher.Fallback(batch) {
+				p.logger.Errorf("can't write batch into %s after %d attempts, batch of %d events is passed to the fallback output: %s", p.config.Table, attempt, len(batch.Events), err.Error())
+				return
+			}
+			p.logger.Fatalf("can't write batch into %s after %d attempts: %s", p.config.Table, attempt, err.Error())
+		}
+		p.logger.Errorf("can't write batch into %s: %s", p.config.Table, err.Error())
+		time.Sleep(p.config.Retention_)
+	}
+
+	p.writtenEventMetric.WithLabelValues().Add(float64(written))
+}
+
+// data is a state of the worker.
+type data struct {
+	groups map[string][][]any
+	keyBuf []byte
+}
+
+// write inserts the rows grouped by the partition key and returns the rows which aren't written because of the error.
+func (p *Plugin) write(data *data, rows [][]any) ([][]any, error) {
+	for key := range data.groups {
+		delete(data.groups, key)
+	}
+	for _, values := range rows {
+		data.keyBuf = data.keyBuf[:0]
+		for _, index := range p.pkIndexes {
+			data.keyBuf = fmt.Appendf(data.keyBuf, "%v\x00", values[index])
+		}
+		data.groups[string(data.keyBuf)] = append(data.groups[string(data.keyBuf)], values)
+	}
+
+	failed := make([][]any, 0)
+	var lastErr error
+	for _, group := range data.groups {
+		batch := p.session.NewBatch(gocql.UnloggedBatch)
+		batch.SetConsistency(p.consistency)
+		for _, values := range group {
+			batch.Query(p.query, values...)
+		}
+
+		if err := p.session.ExecuteBatch(batch); err != nil {
+			lastErr = err
+			failed = append(failed, group...)
+		}
+	}
+
+	return failed, lastErr
+}
+
+func (p *Plugin) maintenance(_ *pipeline.WorkerData) {}
+
+// makeValues converts event fields to the values of the column types.
+func (p *Plugin) makeValues(root *insaneJSON.Root) ([]any, error) {
+	values := make([]any, 0, len(p.config.Columns))
+	for _, column := range p.config.Columns {
+		node := root.Dig(column.Name)
+		if node == nil || node.IsNull() {
+			values = append(values, nil)
+			continue
+		}
+
+		value, err := convert(node, column.ColumnType)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert column %q: %w", column.Name, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func convert(node *insaneJSON.Node, columnType string) (any, error) {
+	switch columnType {
+	case "text":
+		if node.IsString() {
+			return node.AsString(), nil
+		}
+		return node.EncodeToString(), nil
+	case "blob":
+		if !node.IsString() {
+			return nil, errWrongType
+		}
+		return []byte(node.AsString()), nil
+	case "int":
+		if !node.IsNumber() {
+			return nil, errWrongType
+		}
+		v := node.AsInt64()
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("%w: %d overflows int", errWrongType, v)
+		}
+		return int32(v), nil
+	case "bigint":
+		if !node.IsNumber() {
+			return nil, errWrongType
+		}
+		return node.AsInt64(), nil
+	case "double":
+		if !node.IsNumber() {
+			return nil, errWrongType
+		}
+		return node.AsFloat(), nil
+	case "boolean":
+		switch {
+		case node.IsTrue():
+			return true, nil
+		case node.IsFalse():
+			return false, nil
+		default:
+			return nil, errWrongType
+		}
+	case "timestamp":
+		switch {
+		case node.IsNumber():
+			return time.Unix(node.AsInt64(), 0), nil
+		case node.IsString():
+			ts, err := time.Parse(time.RFC3339Nano, node.AsString())
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", errWrongType, err.Error())
+			}
+			return ts, nil
+		default:
+			return nil, errWrongType
+		}
+	default:
+		return nil, fmt.Errorf("unknown column type %q", columnType)
+	}
+}
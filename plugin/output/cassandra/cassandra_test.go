@@ -0,0 +1,198 @@
+package cassandra
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+// fakeSession records the rows of the batches instead of sending them.
+type fakeSession struct {
+	mu           sync.Mutex
+	partitionKey []string
+	batches      [][][]any
+	failBatches  int
+}
+
+func (s *fakeSession) NewBatch(typ gocql.BatchType) *gocql.Batch {
+	return &gocql.Batch{Type: typ}
+}
+
+func (s *fakeSession) ExecuteBatch(batch *gocql.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if batch.Type != gocql.UnloggedBatch {
+		return errors.New("batch isn't unlogged")
+	}
+	if s.failBatches > 0 {
+		s.failBatches--
+		return errors.New("write timeout")
+	}
+
+	rows := make([][]any, 0, len(batch.Entries))
+	for _, entry := range batch.Entries {
+		rows = append(rows, entry.Args)
+	}
+	s.batches = append(s.batches, rows)
+	return nil
+}
+
+func (s *fakeSession) KeyspaceMetadata(keyspace string) (*gocql.KeyspaceMetadata, error) {
+	if keyspace != "ks" || s.partitionKey == nil {
+		return nil, errors.New("keyspace doesn't exist")
+	}
+
+	table := &gocql.TableMetadata{Keyspace: keyspace, Name: "logs"}
+	for _, name := range s.partitionKey {
+		table.PartitionKey = append(table.PartitionKey, &gocql.ColumnMetadata{Name: name})
+	}
+	return &gocql.KeyspaceMetadata{Name: keyspace, Tables: map[string]*gocql.TableMetadata{"logs": table}}, nil
+}
+
+func (s *fakeSession) Close() {}
+
+func newTestPlugin(config *Config, session *fakeSession) *Plugin {
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1, "capacity": 64})
+	p := &Plugin{
+		config:  config,
+		logger:  zap.NewExample().Sugar(),
+		session: session,
+	}
+	p.RegisterMetrics(metric.New("test"))
+	p.init()
+	return p
+}
+
+func newTestBatch(t *testing.T, events ...string) *pipeline.Batch {
+	batch := &pipeline.Batch{}
+	for _, e := range events {
+		root, err := insaneJSON.DecodeString(e)
+		require.NoError(t, err)
+		t.Cleanup(func() { insaneJSON.Release(root) })
+		batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+	}
+	return batch
+}
+
+func TestConvert(t *testing.T) {
+	root, err := insaneJSON.DecodeString(`{"s":"abc","obj":{"a":1},"i":-5,"f":1.5,"t":true,"ts":"2022-01-02T03:04:05Z","big":3000000000}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(root)
+
+	cases := []struct {
+		field    string
+		typ      string
+		expected any
+		err      bool
+	}{
+		{field: "s", typ: "text", expected: "abc"},
+		{field: "obj", typ: "text", expected: `{"a":1}`},
+		{field: "s", typ: "blob", expected: []byte("abc")},
+		{field: "i", typ: "int", expected: int32(-5)},
+		{field: "big", typ: "int", err: true},
+		{field: "big", typ: "bigint", expected: int64(3000000000)},
+		{field: "f", typ: "double", expected: 1.5},
+		{field: "t", typ: "boolean", expected: true},
+		{field: "s", typ: "boolean", err: true},
+		{field: "i", typ: "timestamp", expected: time.Unix(-5, 0)},
+		{field: "ts", typ: "timestamp", expected: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{field: "s", typ: "timestamp", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.field+"_"+tc.typ, func(t *testing.T) {
+			value, err := convert(root.Dig(tc.field), tc.typ)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestGroupByPartitionKey(t *testing.T) {
+	session := &fakeSession{partitionKey: []string{"service"}}
+	p := newTestPlugin(&Config{
+		Hosts: []string{"127.0.0.1:9042"},
+		Table: "ks.logs",
+		Columns: []ConfigColumn{
+			{Name: "service", ColumnType: "text"},
+			{Name: "level", ColumnType: "int"},
+		},
+	}, session)
+	assert.Equal(t, "INSERT INTO ks.logs (service, level) VALUES (?, ?)", p.query)
+	assert.Equal(t, []int{0}, p.pkIndexes)
+
+	data := pipeline.WorkerData(nil)
+	p.out(&data, newTestBatch(t,
+		`{"service":"api","level":3}`,
+		`{"service":"search","level":4}`,
+		`{"service":"api"}`,
+		`{"service":"bad","level":"x"}`,
+	))
+
+	sort.Slice(session.batches, func(i, j int) bool {
+		return session.batches[i][0][0].(string) < session.batches[j][0][0].(string)
+	})
+	assert.Equal(t, [][][]any{
+		{{"api", int32(3)}, {"api", nil}},
+		{{"search", int32(4)}},
+	}, session.batches)
+	assert.Equal(t, float64(3), testutil.ToFloat64(p.writtenEventMetric.WithLabelValues()))
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.discardedEventMetric.WithLabelValues()))
+}
+
+func TestNoMetadata(t *testing.T) {
+	session := &fakeSession{}
+	p := newTestPlugin(&Config{
+		Hosts:   []string{"127.0.0.1:9042"},
+		Table:   "ks.logs",
+		Columns: []ConfigColumn{{Name: "message", ColumnType: "text"}},
+	}, session)
+
+	// the rows are sent in a single batch if the partition key is unknown
+	data := pipeline.WorkerData(nil)
+	p.out(&data, newTestBatch(t, `{"message":"a"}`, `{"message":"b"}`))
+
+	assert.Equal(t, [][][]any{{{"a"}, {"b"}}}, session.batches)
+}
+
+func TestRetry(t *testing.T) {
+	session := &fakeSession{partitionKey: []string{"message"}, failBatches: 1}
+	p := newTestPlugin(&Config{
+		Hosts:     []string{"127.0.0.1:9042"},
+		Table:     "ks.logs",
+		Columns:   []ConfigColumn{{Name: "message", ColumnType: "text"}},
+		Retention: "1ms",
+	}, session)
+
+	data := pipeline.WorkerData(nil)
+	p.out(&data, newTestBatch(t, `{"message":"a"}`, `{"message":"b"}`))
+
+	// only the failed group is resent
+	require.Equal(t, 2, len(session.batches))
+	rows := make([]any, 0)
+	for _, batch := range session.batches {
+		for _, row := range batch {
+			rows = append(rows, row[0])
+		}
+	}
+	assert.ElementsMatch(t, []any{"a", "b"}, rows)
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.sendErrorMetric.WithLabelValues()))
+	assert.Equal(t, float64(2), testutil.ToFloat64(p.writtenEventMetric.WithLabelValues()))
+}
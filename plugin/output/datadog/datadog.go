@@ -0,0 +1,391 @@
+package datadog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It sends events to the [Datadog logs intake API v2](https://docs.datadoghq.com/api/latest/logs/#send-logs).
+
+Events are sent as is with `ddsource`, `ddtags`, `service` and `hostname` attributes added.
+Attributes which are already present in the event aren't overwritten.
+
+Datadog limits are enforced: a request contains at most 1000 events and 5MB of data,
+events larger than 1MB are dropped.
+Requests rejected with `429` status code are retried after the time from `X-RateLimit-Reset` header.
+Other `4xx` responses aren't retried, the events are dropped.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: datadog
+      api_key: "<DD_API_KEY>"
+      service_field: k8s_label_app
+      source: file.d
+      tags: ["env:prod"]
+      tags_fields: ["k8s_namespace", "k8s_pod"]
+```
+}*/
+
+const (
+	outPluginType = "datadog"
+
+	maxBatchEvents = 1000
+	maxBatchBytes  = 5 * 1024 * 1024
+	maxEventBytes  = 1024 * 1024
+
+	rateLimitResetHeader = "X-RateLimit-Reset"
+)
+
+var errNotRetryable = errors.New("not retryable response")
+
+type Plugin struct {
+	config       *Config
+	client       *http.Client
+	logger       *zap.SugaredLogger
+	avgEventSize int
+	batcher      *pipeline.Batcher
+	controller   pipeline.OutputPluginController
+
+	tagsFields [][]string
+
+	// plugin metrics
+
+	sendErrorMetric     *prometheus.CounterVec
+	droppedEventsMetric *prometheus.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Logs intake endpoint. Change it according to your Datadog site.
+	Endpoint string `json:"endpoint" default:"https://http-intake.logs.datadoghq.com/api/v2/logs"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Datadog API key.
+	APIKey string `json:"api_key" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A service name of events.
+	Service string `json:"service" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the service name. `service` is used if the field isn't found.
+	ServiceField  cfg.FieldSelector `json:"service_field" parse:"selector"` // *
+	ServiceField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > A source of events, e.g. `nginx`.
+	Source string `json:"source" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the source. `source` is used if the field isn't found.
+	SourceField  cfg.FieldSelector `json:"source_field" parse:"selector"` // *
+	SourceField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the hostname.
+	HostnameField  cfg.FieldSelector `json:"hostname_field" parse:"selector"` // *
+	HostnameField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Static tags of events in `key:value` format.
+	Tags []string `json:"tags"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Event fields to add as tags. The last key of the field path is used as the tag name.
+	TagsFields []string `json:"tags_fields"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Client timeout of requests.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"10s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Retention between retries of failed requests.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch. Batches are split into requests of at most 1000 events.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > A minimum size of events in a batch to send.
+	// > If both batch_size and batch_size_bytes are set, they will work together.
+	BatchSizeBytes  cfg.Expression `json:"batch_size_bytes" default:"0" parse:"expression"` // *
+	BatchSizeBytes_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+type data struct {
+	outBuf    []byte
+	eventBuf  []byte
+	encodeBuf []byte
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.avgEventSize = params.PipelineSettings.AvgEventSize
+	p.config = config.(*Config)
+
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+
+	p.init()
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		MaintenanceFn:  p.maintenance,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		BatchSizeBytes: p.config.BatchSizeBytes_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) init() {
+	p.tagsFields = make([][]string, 0, len(p.config.TagsFields))
+	for _, field := range p.config.TagsFields {
+		p.tagsFields = append(p.tagsFields, cfg.ParseFieldSelector(field))
+	}
+
+	p.client = &http.Client{
+		Timeout: p.config.RequestTimeout_,
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_datadog_send_error", "Total Datadog send errors")
+	p.droppedEventsMetric = ctl.RegisterCounter("output_datadog_dropped_events", "Total events dropped by Datadog output")
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{
+			outBuf: make([]byte, 0, p.config.BatchSize_*p.avgEventSize),
+		}
+	}
+
+	data := (*workerData).(*data)
+	// handle too much memory consumption
+	if cap(data.outBuf) > maxBatchBytes+maxEventBytes {
+		data.outBuf = make([]byte, 0, p.config.BatchSize_*p.avgEventSize)
+	}
+
+	data.outBuf = append(data.outBuf[:0], '[')
+	data.encodeBuf = data.encodeBuf[:0]
+	count := 0
+	for _, event := range batch.Events {
+		data.encodeBuf = p.formatEvent(data.encodeBuf, event.Root)
+		data.eventBuf = event.Root.Encode(data.eventBuf[:0])
+		if len(data.eventBuf) > maxEventBytes {
+			p.droppedEventsMetric.WithLabelValues().Inc()
+			p.logger.Errorf("event of %d bytes exceeds Datadog limit and is dropped", len(data.eventBuf))
+			continue
+		}
+
+		// 2 bytes are reserved for the separator and the closing bracket
+		if count == maxBatchEvents || count > 0 && len(data.outBuf)+len(data.eventBuf)+2 > maxBatchBytes {
+			p.send(append(data.outBuf, ']'), count)
+			data.outBuf = append(data.outBuf[:0], '[')
+			count = 0
+		}
+
+		if count > 0 {
+			data.outBuf = append(data.outBuf, ',')
+		}
+		data.outBuf = append(data.outBuf, data.eventBuf...)
+		count++
+	}
+
+	if count > 0 {
+		p.send(append(data.outBuf, ']'), count)
+	}
+}
+
+func (p *Plugin) maintenance(_ *pipeline.WorkerData) {}
+
+// formatEvent adds Datadog reserved attributes to the event, encodeBuf is used to store tags.
+func (p *Plugin) formatEvent(encodeBuf []byte, root *insaneJSON.Root) []byte {
+	p.addAttr(root, "ddsource", p.fieldOrDefault(root, p.config.SourceField_, p.config.Source))
+	p.addAttr(root, "service", p.fieldOrDefault(root, p.config.ServiceField_, p.config.Service))
+	p.addAttr(root, "hostname", p.fieldOrDefault(root, p.config.HostnameField_, ""))
+
+	l := len(encodeBuf)
+	for _, tag := range p.config.Tags {
+		encodeBuf = appendTag(encodeBuf, l, tag)
+	}
+	for _, field := range p.tagsFields {
+		node := root.Dig(field...)
+		if node == nil {
+			continue
+		}
+		encodeBuf = appendTag(encodeBuf, l, field[len(field)-1])
+		encodeBuf = append(encodeBuf, ':')
+		encodeBuf = append(encodeBuf, node.AsString()...)
+	}
+	p.addAttr(root, "ddtags", pipeline.ByteToStringUnsafe(encodeBuf[l:]))
+
+	return encodeBuf
+}
+
+// addAttr adds the attribute if the value isn't empty and the event doesn't have such a field.
+func (p *Plugin) addAttr(root *insaneJSON.Root, name, value string) {
+	if value == "" || root.Dig(name) != nil {
+		return
+	}
+	root.AddFieldNoAlloc(root, name).MutateToString(value)
+}
+
+func (p *Plugin) fieldOrDefault(root *insaneJSON.Root, field []string, def string) string {
+	if len(field) == 0 {
+		return def
+	}
+	node := root.Dig(field...)
+	if node == nil {
+		return def
+	}
+	return node.AsString()
+}
+
+func appendTag(buf []byte, start int, tag string) []byte {
+	if len(buf) > start {
+		buf = append(buf, ',')
+	}
+	return append(buf, tag...)
+}
+
+// send sends the body until success or not retryable error.
+func (p *Plugin) send(body []byte, count int) {
+	for {
+		retryAfter, err := p.request(body)
+		if err == nil {
+			return
+		}
+
+		p.sendErrorMetric.WithLabelValues().Inc()
+		if errors.Is(err, errNotRetryable) {
+			p.droppedEventsMetric.WithLabelValues().Add(float64(count))
+			p.logger.Errorf("can't send data to Datadog, %d events are dropped: %s", count, err.Error())
+			return
+		}
+
+		if retryAfter == 0 {
+			retryAfter = p.config.Retention_
+		}
+		p.logger.Errorf("can't send data to Datadog, next attempt in %s: %s", retryAfter.String(), err.Error())
+		time.Sleep(retryAfter)
+	}
+}
+
+// request returns the time to wait before the next attempt if Datadog asks for it.
+func (p *Plugin) request(body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("can't create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", p.config.APIKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("can't send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("can't read response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return parseRateLimitReset(resp.Header.Get(rateLimitResetHeader)), fmt.Errorf("rate limited: %s", resp.Status)
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= http.StatusInternalServerError:
+		return 0, fmt.Errorf("bad response: %s: %s", resp.Status, respBody)
+	default:
+		return 0, fmt.Errorf("%w: %s: %s", errNotRetryable, resp.Status, respBody)
+	}
+}
+
+// parseRateLimitReset parses the number of seconds until the rate limit is reset.
+func parseRateLimitReset(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
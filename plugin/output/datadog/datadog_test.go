@@ -0,0 +1,166 @@
+package datadog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+func newTestPlugin(config *Config) *Plugin {
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1, "capacity": 64})
+	p := &Plugin{
+		config:       config,
+		logger:       zap.NewExample().Sugar(),
+		avgEventSize: 64,
+	}
+	p.RegisterMetrics(metric.New("test"))
+	p.init()
+	return p
+}
+
+func newTestBatch(t *testing.T, events ...string) *pipeline.Batch {
+	batch := &pipeline.Batch{}
+	for _, e := range events {
+		root, err := insaneJSON.DecodeString(e)
+		require.NoError(t, err)
+		t.Cleanup(func() { insaneJSON.Release(root) })
+		batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+	}
+	return batch
+}
+
+func TestFormat(t *testing.T) {
+	var body []byte
+	var apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("DD-API-KEY")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(&Config{
+		Endpoint:      server.URL,
+		APIKey:        "key",
+		Service:       "default",
+		ServiceField:  "k8s.app",
+		Source:        "file.d",
+		HostnameField: "host",
+		Tags:          []string{"env:prod"},
+		TagsFields:    []string{"k8s.pod", "missing"},
+	})
+
+	data := pipeline.WorkerData(nil)
+	p.out(&data, newTestBatch(t,
+		`{"message":"a","host":"h1","k8s":{"app":"api","pod":"api-1"}}`,
+		`{"message":"b","service":"own","ddsource":"own"}`,
+	))
+
+	assert.Equal(t, "key", apiKey)
+	assert.Equal(t,
+		`[{"message":"a","host":"h1","k8s":{"app":"api","pod":"api-1"},"ddsource":"file.d","service":"api","hostname":"h1","ddtags":"env:prod,pod:api-1"},`+
+			`{"message":"b","service":"own","ddsource":"own","ddtags":"env:prod"}]`,
+		string(body))
+}
+
+func TestLimits(t *testing.T) {
+	mu := sync.Mutex{}
+	var counts []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.LessOrEqual(t, len(body), maxBatchBytes)
+
+		var events []json.RawMessage
+		require.NoError(t, json.Unmarshal(body, &events))
+		mu.Lock()
+		counts = append(counts, len(events))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(&Config{Endpoint: server.URL, APIKey: "key"})
+
+	events := make([]string, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		events = append(events, fmt.Sprintf(`{"i":%d}`, i))
+	}
+	data := pipeline.WorkerData(nil)
+	p.out(&data, newTestBatch(t, events...))
+	assert.Equal(t, []int{1000, 1000, 500}, counts)
+
+	counts = nil
+	bigValue := strings.Repeat("a", 700*1024)
+	p.out(&data, newTestBatch(t,
+		`{"a":"`+bigValue+`"}`,
+		`{"b":"`+bigValue+`"}`,
+		`{"too_big":"`+strings.Repeat("a", maxEventBytes)+`"}`,
+		`{"c":"`+bigValue+`"}`,
+		`{"d":"`+bigValue+`"}`,
+		`{"e":"`+bigValue+`"}`,
+		`{"f":"`+bigValue+`"}`,
+		`{"g":"`+bigValue+`"}`,
+		`{"h":"`+bigValue+`"}`,
+	))
+	assert.Equal(t, []int{7, 1}, counts)
+}
+
+func TestRetry(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		requests int
+	}{
+		{
+			name:     "rate_limit",
+			statuses: []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusAccepted},
+			requests: 3,
+		},
+		{
+			name:     "not_retryable",
+			statuses: []int{http.StatusForbidden, http.StatusAccepted},
+			requests: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(rateLimitResetHeader, "0.01")
+				w.WriteHeader(tc.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			p := newTestPlugin(&Config{Endpoint: server.URL, APIKey: "key", Retention: "10ms"})
+
+			data := pipeline.WorkerData(nil)
+			start := time.Now()
+			p.out(&data, newTestBatch(t, `{"a":1}`))
+
+			assert.Equal(t, tc.requests, requests)
+			assert.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
+
+func TestParseRateLimitReset(t *testing.T) {
+	assert.Equal(t, 2*time.Second, parseRateLimitReset("2"))
+	assert.Equal(t, 500*time.Millisecond, parseRateLimitReset("0.5"))
+	assert.Equal(t, time.Duration(0), parseRateLimitReset(""))
+	assert.Equal(t, time.Duration(0), parseRateLimitReset("-1"))
+}
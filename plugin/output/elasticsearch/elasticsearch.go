@@ -1,11 +1,15 @@
 package elasticsearch
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -24,12 +28,20 @@ import (
 /*{ introduction
 It sends events into Elasticsearch. It uses `_bulk` API to send events in batches.
 If a network error occurs, the batch will infinitely try to be delivered to the random endpoint.
+
+The statuses of the bulk items are checked one by one:
+* items rejected with `429` or `503` statuses are retried with an exponential backoff from `retention` up to `max_retention`
+* items rejected with other statuses, e.g. `400` on mapping conflicts, are written to `dead_letter_index` if it's set, otherwise they are dropped
+
+The items are counted by `output_elasticsearch_bulk_items` metric with the `status` label.
 }*/
 
 const (
 	outPluginType     = "elasticsearch"
 	NDJSONContentType = "application/x-ndjson"
 	retryDelay        = time.Second
+
+	compressionGzip = "gzip"
 )
 
 var (
@@ -54,6 +66,7 @@ type Plugin struct {
 
 	sendErrorMetric      *prometheus.CounterVec
 	indexingErrorsMetric *prometheus.CounterVec
+	bulkItemsMetric      *prometheus.CounterVec
 }
 
 // ! config-params
@@ -76,13 +89,34 @@ type Config struct {
 
 	// > @3@4@5@6
 	// >
-	// > Base64-encoded token for authorization; if set, overrides username/password.
+	// > Base64-encoded token for authorization; if set, overrides username/password and bearer_token.
 	APIKey string `json:"api_key"` // *
 
+	// > @3@4@5@6
+	// >
+	// > Token for `Bearer` authentication, e.g. the service account token; if set, overrides username/password.
+	BearerToken string `json:"bearer_token"` // *
+
 	// > @3@4@5@6
 	// > Path or content of a PEM-encoded CA file.
 	CACert string `json:"ca_cert"` // *
 
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded client certificate for the mutual TLS authentication.
+	// > It must be set along with `client_key`.
+	ClientCert string `json:"client_cert"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded private key of the `client_cert`.
+	ClientKey string `json:"client_key"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Compression of the bulk request body.
+	Compression string `json:"compression" default:"none" options:"none|gzip"` // *
+
 	// > @3@4@5@6
 	// >
 	// > It defines the pattern of elasticsearch index name. Use `%` character as a placeholder. Use `index_values` to define values for the replacement.
@@ -104,6 +138,24 @@ type Config struct {
 	// > > Check out [func Parse doc](https://golang.org/pkg/time/#Parse) for details.
 	TimeFormat string `json:"time_format" default:"2006-01-02"` // *
 
+	// > @3@4@5@6
+	// >
+	// > The ingest pipeline to preprocess the documents, it's passed as the `pipeline` parameter of the bulk requests.
+	IngestPipeline string `json:"ingest_pipeline"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field used as the `routing` of the document. The default routing is used if the field isn't found.
+	RoutingField  cfg.FieldSelector `json:"routing_field" parse:"selector"` // *
+	RoutingField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field used as the `_id` of the document. Elasticsearch generates the id if the field isn't found.
+	// > > With `batch_op_type=create` the events with existing ids are rejected with `409` status.
+	IDField  cfg.FieldSelector `json:"id_field" parse:"selector"` // *
+	IDField_ []string
+
 	// > @3@4@5@6
 	// >
 	// > It defines how much time to wait for the connection.
@@ -140,10 +192,41 @@ type Config struct {
 	// > Operation type to be used in batch requests. It can be `index` or `create`. Default is `index`.
 	// > > Check out [_bulk API doc](https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html) for details.
 	BatchOpType string `json:"batch_op_type" default:"index" options:"index|create"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Initial retention between retries of the items rejected with `429` or `503` statuses, it's doubled after each attempt.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Maximal retention between retries of the rejected items.
+	MaxRetention  cfg.Duration `json:"max_retention" default:"1m" parse:"duration"` // *
+	MaxRetention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > The index for the events rejected with non-retryable statuses, e.g. because of mapping conflicts.
+	// > The document contains the `error` of the item and the original `event` as a string.
+	// > The rejected events are dropped if it's empty.
+	DeadLetterIndex string `json:"dead_letter_index"` // *
 }
 
 type data struct {
-	outBuf []byte
+	outBuf  []byte
+	gzipBuf *bytes.Buffer
+	gzip    *gzip.Writer
+	docs    []bulkDoc
+	retry   []bulkDoc
+	// deadLetter is reused to make the documents of the dead letter index
+	deadLetter *insaneJSON.Root
+}
+
+// bulkDoc is the event to send, it's written to the dead letter index if the index error isn't empty.
+type bulkDoc struct {
+	event      *pipeline.Event
+	indexError string
 }
 
 func init() {
@@ -174,8 +257,13 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 			endpoint = endpoint[:len(endpoint)-1]
 		}
 
+		bulkURL := endpoint + "/_bulk?_source=false"
+		if p.config.IngestPipeline != "" {
+			bulkURL += "&pipeline=" + url.QueryEscape(p.config.IngestPipeline)
+		}
+
 		uri := &fasthttp.URI{}
-		if err := uri.Parse(nil, []byte(endpoint+"/_bulk?_source=false")); err != nil {
+		if err := uri.Parse(nil, []byte(bulkURL)); err != nil {
 			logger.Fatalf("can't parse ES endpoint %s: %s", endpoint, err.Error())
 		}
 
@@ -187,11 +275,17 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		WriteTimeout: p.config.ConnectionTimeout_ * 2,
 	}
 
-	if p.config.CACert != "" {
+	if p.config.CACert != "" || p.config.ClientCert != "" || p.config.ClientKey != "" {
 		b := tls.NewConfigBuilder()
-		err := b.AppendCARoot(p.config.CACert)
-		if err != nil {
-			p.logger.Fatalf("can't append CA root: %s", err.Error())
+		if p.config.CACert != "" {
+			if err := b.AppendCARoot(p.config.CACert); err != nil {
+				p.logger.Fatalf("can't append CA root: %s", err.Error())
+			}
+		}
+		if p.config.ClientCert != "" || p.config.ClientKey != "" {
+			if err := b.AppendX509KeyPair(p.config.ClientCert, p.config.ClientKey); err != nil {
+				p.logger.Fatalf("can't append client certificate: %s", err.Error())
+			}
 		}
 
 		p.client.TLSConfig = b.Build()
@@ -233,12 +327,14 @@ func (p *Plugin) Out(event *pipeline.Event) {
 func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
 	p.sendErrorMetric = ctl.RegisterCounter("output_elasticsearch_send_error", "Total elasticsearch send errors")
 	p.indexingErrorsMetric = ctl.RegisterCounter("output_elasticsearch_index_error", "Number of elasticsearch indexing errors")
+	p.bulkItemsMetric = ctl.RegisterCounter("output_elasticsearch_bulk_items", "Number of elasticsearch bulk items by status code", "status")
 }
 
 func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 	if *workerData == nil {
 		*workerData = &data{
-			outBuf: make([]byte, 0, p.config.BatchSize_*p.avgEventSize),
+			outBuf:     make([]byte, 0, p.config.BatchSize_*p.avgEventSize),
+			deadLetter: insaneJSON.Spawn(),
 		}
 	}
 
@@ -248,22 +344,45 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 		data.outBuf = make([]byte, 0, p.config.BatchSize_*p.avgEventSize)
 	}
 
-	data.outBuf = data.outBuf[:0]
+	data.docs = data.docs[:0]
 	for _, event := range batch.Events {
-		data.outBuf = p.appendEvent(data.outBuf, event)
+		data.docs = append(data.docs, bulkDoc{event: event})
 	}
 
-	for {
-		if err := p.send(data.outBuf); err != nil {
+	retention := p.config.Retention_
+	for len(data.docs) > 0 {
+		data.outBuf = data.outBuf[:0]
+		for _, doc := range data.docs {
+			data.outBuf = p.appendDoc(data.outBuf, doc, data.deadLetter)
+		}
+		body := data.outBuf
+		if p.config.Compression == compressionGzip {
+			body = p.compress(data, body)
+		}
+
+		retry, err := p.send(body, data.docs, data.retry[:0])
+		if err != nil {
 			p.sendErrorMetric.WithLabelValues().Inc()
 			p.logger.Errorf("can't send to the elastic, will try other endpoint: %s", err.Error())
-		} else {
+			continue
+		}
+
+		data.docs, data.retry = retry, data.docs
+		if len(data.docs) == 0 {
 			break
 		}
+
+		p.logger.Errorf("%d items are rejected by the elastic, next attempt in %s", len(data.docs), retention.String())
+		time.Sleep(retention)
+		retention *= 2
+		if retention > p.config.MaxRetention_ {
+			retention = p.config.MaxRetention_
+		}
 	}
 }
 
-func (p *Plugin) send(body []byte) error {
+// send sends the bulk request of the docs and appends the docs which should be sent again to the retry.
+func (p *Plugin) send(body []byte, docs []bulkDoc, retry []bulkDoc) ([]bulkDoc, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
@@ -274,44 +393,97 @@ func (p *Plugin) send(body []byte) error {
 	req.SetBodyRaw(body)
 	req.Header.SetMethod(fasthttp.MethodPost)
 	req.Header.SetContentType(NDJSONContentType)
+	if p.config.Compression == compressionGzip {
+		req.Header.Set(fasthttp.HeaderContentEncoding, compressionGzip)
+	}
 	p.setAuthHeader(req)
 
 	if err := p.client.DoTimeout(req, resp, p.config.ConnectionTimeout_); err != nil {
 		time.Sleep(retryDelay)
-		return fmt.Errorf("can't send batch to %s: %s", endpoint.String(), err.Error())
+		return retry, fmt.Errorf("can't send batch to %s: %s", endpoint.String(), err.Error())
 	}
 
 	respContent := resp.Body()
 
 	if statusCode := resp.Header.StatusCode(); statusCode < http.StatusOK || statusCode > http.StatusAccepted {
 		time.Sleep(retryDelay)
-		return fmt.Errorf("response status from %s isn't OK: status=%d, body=%s", endpoint.String(), statusCode, string(respContent))
+		return retry, fmt.Errorf("response status from %s isn't OK: status=%d, body=%s", endpoint.String(), statusCode, string(respContent))
 	}
 
 	root, err := insaneJSON.DecodeBytes(respContent)
 	if err != nil {
-		return fmt.Errorf("wrong response from %s: %s", endpoint.String(), err.Error())
+		return retry, fmt.Errorf("wrong response from %s: %s", endpoint.String(), err.Error())
 	}
 	defer insaneJSON.Release(root)
 
-	if root.Dig("errors").AsBool() {
-		errors := 0
-		for _, node := range root.Dig("items").AsArray() {
-			errNode := node.Dig("index", "error")
-			if errNode != nil {
-				errors += 1
-				p.logger.Errorf("indexing error: %s", errNode.EncodeToString())
-			}
+	items := root.Dig("items").AsArray()
+	if len(items) != len(docs) {
+		return retry, fmt.Errorf("wrong response from %s: %d items for %d documents", endpoint.String(), len(items), len(docs))
+	}
+
+	dropped := 0
+	for i, item := range items {
+		status := item.Dig(p.config.BatchOpType, "status").AsInt()
+		p.bulkItemsMetric.WithLabelValues(strconv.Itoa(status)).Inc()
+		if status >= http.StatusOK && status < http.StatusMultipleChoices {
+			continue
 		}
+		if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+			retry = append(retry, docs[i])
+			continue
+		}
+
+		errNode := item.Dig(p.config.BatchOpType, "error")
+		p.indexingErrorsMetric.WithLabelValues().Inc()
+		p.logger.Errorf("indexing error: %s", errNode.EncodeToString())
 
-		if errors != 0 {
-			p.indexingErrorsMetric.WithLabelValues().Add(float64(errors))
+		// the events rejected by the dead letter index are dropped to avoid the loop
+		if p.config.DeadLetterIndex != "" && docs[i].indexError == "" {
+			retry = append(retry, bulkDoc{event: docs[i].event, indexError: errNode.EncodeToString()})
+			continue
 		}
+		dropped++
+	}
 
+	if dropped != 0 {
 		p.controller.Error("some events from batch aren't written")
 	}
 
-	return nil
+	return retry, nil
+}
+
+func (p *Plugin) compress(data *data, body []byte) []byte {
+	if data.gzip == nil {
+		data.gzipBuf = &bytes.Buffer{}
+		data.gzip = gzip.NewWriter(data.gzipBuf)
+	}
+
+	data.gzipBuf.Reset()
+	data.gzip.Reset(data.gzipBuf)
+	// writing to the bytes.Buffer never fails.
+	_, _ = data.gzip.Write(body)
+	_ = data.gzip.Close()
+
+	return data.gzipBuf.Bytes()
+}
+
+// appendDoc appends the event or its dead letter document if the doc has the index error.
+func (p *Plugin) appendDoc(outBuf []byte, doc bulkDoc, deadLetter *insaneJSON.Root) []byte {
+	if doc.indexError == "" {
+		return p.appendEvent(outBuf, doc.event)
+	}
+
+	outBuf = append(outBuf, p.headerPrefix...)
+	outBuf = append(outBuf, p.config.DeadLetterIndex...)
+	outBuf = append(outBuf, "\"}}\n"...)
+
+	_ = deadLetter.DecodeString("{}")
+	deadLetter.AddField("error").MutateToJSON(deadLetter, doc.indexError)
+	deadLetter.AddField("event").MutateToString(doc.event.Root.EncodeToString())
+	outBuf = deadLetter.Encode(outBuf)
+	outBuf = append(outBuf, '\n')
+
+	return outBuf
 }
 
 func (p *Plugin) appendEvent(outBuf []byte, event *pipeline.Event) []byte {
@@ -351,10 +523,36 @@ func (p *Plugin) appendIndexName(outBuf []byte, event *pipeline.Event) []byte {
 			outBuf = append(outBuf, value...)
 		}
 	}
-	outBuf = append(outBuf, "\"}}"...)
+	outBuf = append(outBuf, '"')
+	outBuf = appendMetaField(outBuf, "_id", event.Root, p.config.IDField_)
+	outBuf = appendMetaField(outBuf, "routing", event.Root, p.config.RoutingField_)
+	outBuf = append(outBuf, "}}"...)
 	return outBuf
 }
 
+// appendMetaField appends the field of the bulk action if the event field is the string or the number.
+func appendMetaField(outBuf []byte, name string, root *insaneJSON.Root, field []string) []byte {
+	if len(field) == 0 {
+		return outBuf
+	}
+
+	node := root.Dig(field...)
+	if node == nil || node.IsObject() || node.IsArray() || node.IsNull() {
+		return outBuf
+	}
+
+	outBuf = append(outBuf, ",\""...)
+	outBuf = append(outBuf, name...)
+	outBuf = append(outBuf, "\":"...)
+	if node.IsString() {
+		return node.Encode(outBuf)
+	}
+
+	outBuf = append(outBuf, '"')
+	outBuf = node.Encode(outBuf)
+	return append(outBuf, '"')
+}
+
 func (p *Plugin) maintenance(_ *pipeline.WorkerData) {
 	p.mu.Lock()
 	p.time = time.Now().Format(p.config.TimeFormat)
@@ -365,6 +563,9 @@ func (p *Plugin) getAuthHeader() []byte {
 	if p.config.APIKey != "" {
 		return []byte("ApiKey " + p.config.APIKey)
 	}
+	if p.config.BearerToken != "" {
+		return []byte("Bearer " + p.config.BearerToken)
+	}
 	if p.config.Username != "" && p.config.Password != "" {
 		credentials := []byte(p.config.Username + ":" + p.config.Password)
 		buf := make([]byte, base64.StdEncoding.EncodedLen(len(credentials)))
@@ -1,7 +1,11 @@
 package elasticsearch
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,6 +14,7 @@ import (
 
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/test"
 )
@@ -94,6 +99,53 @@ func TestAppendEventWithCreateOpType(t *testing.T) {
 	assert.Equal(t, expected, string(result), "wrong request content")
 }
 
+func TestAppendEventWithMetaFields(t *testing.T) {
+	cases := []struct {
+		name     string
+		event    string
+		expected string
+	}{
+		{
+			name:     "string",
+			event:    `{"id":"a\"b","meta":{"user":"user_1"}}`,
+			expected: `{"index":{"_index":"test","_id":"a\"b","routing":"user_1"}}`,
+		},
+		{
+			name:     "number",
+			event:    `{"id":15,"meta":{"user":20}}`,
+			expected: `{"index":{"_index":"test","_id":"15","routing":"20"}}`,
+		},
+		{
+			name:     "not_found",
+			event:    `{"meta":{"user":{"name":"user_1"}}}`,
+			expected: `{"index":{"_index":"test"}}`,
+		},
+	}
+
+	config := &Config{
+		Endpoints:    []string{"test"},
+		IndexFormat:  "test",
+		IDField:      "id",
+		RoutingField: "meta.user",
+		BatchSize:    "1",
+	}
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1})
+
+	p := &Plugin{}
+	p.Start(config, test.NewEmptyOutputPluginParams())
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := insaneJSON.DecodeString(tc.event)
+			require.NoError(t, err)
+			defer insaneJSON.Release(root)
+
+			result := p.appendIndexName(nil, &pipeline.Event{Root: root})
+			assert.Equal(t, tc.expected, string(result))
+		})
+	}
+}
+
 func TestConfig(t *testing.T) {
 	p := &Plugin{}
 	config := &Config{
@@ -126,3 +178,205 @@ func TestConfig(t *testing.T) {
 		assert.Equal(t, results[i], p.endpoints[i].String())
 	}
 }
+
+func TestConfigIngestPipeline(t *testing.T) {
+	p := &Plugin{}
+	config := &Config{
+		Endpoints:      []string{"http://endpoint:9000"},
+		IngestPipeline: "logs pipeline",
+		BatchSize:      "1",
+	}
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1})
+
+	p.Start(config, test.NewEmptyOutputPluginParams())
+
+	require.Len(t, p.endpoints, 1)
+	assert.Equal(t, "http://endpoint:9000/_bulk?_source=false&pipeline=logs+pipeline", p.endpoints[0].String())
+}
+
+// errorsController counts the errors of the output.
+type errorsController struct {
+	errors int
+}
+
+func (c *errorsController) Commit(*pipeline.Event)   {}
+func (c *errorsController) Error(string)             { c.errors++ }
+func (c *errorsController) HasFallback() bool        { return false }
+func (c *errorsController) Fallback(*pipeline.Event) {}
+
+func TestBulkItemsRetry(t *testing.T) {
+	rejected := `{"errors":true,"items":[` +
+		`{"index":{"status":201}},` +
+		`{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}},` +
+		`{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`
+	batch := `{"index":{"_index":"test"}}` + "\n" + `{"i":0}` + "\n" +
+		`{"index":{"_index":"test"}}` + "\n" + `{"i":1}` + "\n" +
+		`{"index":{"_index":"test"}}` + "\n" + `{"i":2}` + "\n"
+
+	cases := []struct {
+		name            string
+		deadLetterIndex string
+		responses       []string
+		requests        []string
+		errors          int
+	}{
+		{
+			name: "drop",
+			responses: []string{
+				rejected,
+				`{"errors":false,"items":[{"index":{"status":201}}]}`,
+			},
+			requests: []string{
+				batch,
+				`{"index":{"_index":"test"}}` + "\n" + `{"i":1}` + "\n",
+			},
+			errors: 1,
+		},
+		{
+			name:            "dead_letter_index",
+			deadLetterIndex: "dead",
+			responses: []string{
+				rejected,
+				`{"errors":false,"items":[{"index":{"status":201}},{"index":{"status":201}}]}`,
+			},
+			requests: []string{
+				batch,
+				`{"index":{"_index":"test"}}` + "\n" + `{"i":1}` + "\n" +
+					`{"index":{"_index":"dead"}}` + "\n" + `{"error":{"type":"mapper_parsing_exception"},"event":"{\"i\":2}"}` + "\n",
+			},
+			errors: 0,
+		},
+		{
+			name:            "dead_letter_index_rejected",
+			deadLetterIndex: "dead",
+			responses: []string{
+				rejected,
+				`{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400,"error":{}}}]}`,
+			},
+			requests: []string{
+				batch,
+				`{"index":{"_index":"test"}}` + "\n" + `{"i":1}` + "\n" +
+					`{"index":{"_index":"dead"}}` + "\n" + `{"error":{"type":"mapper_parsing_exception"},"event":"{\"i\":2}"}` + "\n",
+			},
+			errors: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make([]string, 0)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				requests = append(requests, string(body))
+				_, _ = w.Write([]byte(tc.responses[len(requests)-1]))
+			}))
+			defer server.Close()
+
+			config := &Config{
+				Endpoints:       []string{server.URL},
+				IndexFormat:     "test",
+				Retention:       "1ms",
+				DeadLetterIndex: tc.deadLetterIndex,
+				BatchSize:       "1",
+			}
+			test.NewConfig(config, map[string]int{"gomaxprocs": 1})
+
+			controller := &errorsController{}
+			params := test.NewEmptyOutputPluginParams()
+			params.Controller = controller
+
+			p := &Plugin{}
+			p.RegisterMetrics(metric.New("test"))
+			p.Start(config, params)
+			defer p.Stop()
+
+			batch := &pipeline.Batch{}
+			for i := 0; i < 3; i++ {
+				root, err := insaneJSON.DecodeString(fmt.Sprintf(`{"i":%d}`, i))
+				require.NoError(t, err)
+				defer insaneJSON.Release(root)
+				batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+			}
+
+			var workerData pipeline.WorkerData
+			p.out(&workerData, batch)
+
+			assert.Equal(t, tc.requests, requests)
+			assert.Equal(t, tc.errors, controller.errors)
+		})
+	}
+}
+
+func TestAuthHeader(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		expected string
+	}{
+		{
+			name:     "none",
+			config:   &Config{},
+			expected: "",
+		},
+		{
+			name:     "basic",
+			config:   &Config{Username: "user", Password: "pass"},
+			expected: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name:     "bearer_token",
+			config:   &Config{Username: "user", Password: "pass", BearerToken: "token"},
+			expected: "Bearer token",
+		},
+		{
+			name:     "api_key",
+			config:   &Config{BearerToken: "token", APIKey: "key"},
+			expected: "ApiKey key",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Plugin{config: tc.config}
+			assert.Equal(t, tc.expected, string(p.getAuthHeader()))
+		})
+	}
+}
+
+func TestGzipCompression(t *testing.T) {
+	var body, encoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		body = string(content)
+		_, _ = w.Write([]byte(`{"errors":false,"items":[{"index":{"status":201}}]}`))
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Endpoints:   []string{server.URL},
+		IndexFormat: "test",
+		Compression: "gzip",
+		BatchSize:   "1",
+	}
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1})
+
+	p := &Plugin{}
+	p.RegisterMetrics(metric.New("test"))
+	p.Start(config, test.NewEmptyOutputPluginParams())
+	defer p.Stop()
+
+	root, err := insaneJSON.DecodeString(`{"i":0}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(root)
+
+	var workerData pipeline.WorkerData
+	p.out(&workerData, &pipeline.Batch{Events: []*pipeline.Event{{Root: root}}})
+
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, `{"index":{"_index":"test"}}`+"\n"+`{"i":0}`+"\n", body)
+}
@@ -6,16 +6,19 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/lineformat"
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/longpanic"
 	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 )
@@ -45,6 +48,13 @@ type Plugin struct {
 
 	SealUpCallback func(string)
 
+	formatter *lineformat.Formatter
+
+	// size is the size of the current file, it's used to seal up the file by max_file_size.
+	size        atomic.Int64
+	sealUpCh    chan struct{}
+	retentionMu sync.Mutex
+
 	mu *sync.RWMutex
 	plugin.NoMetricsPlugin
 }
@@ -93,6 +103,24 @@ type Config struct {
 	// > File mode for log files
 	FileMode  cfg.Base8 `json:"file_mode" default:"0666" parse:"base8"` // *
 	FileMode_ int64
+
+	// > Max size of the file, e.g. `100 MiB`. The file is sealed up once it's exceeded without waiting for the retention interval.
+	// > Zero means the file is sealed up by the retention interval only.
+	MaxFileSize  string `json:"max_file_size" default:"0 b" parse:"data_unit"` // *
+	MaxFileSize_ uint64
+
+	// > Compression of the sealed up files, the compressed files get `.gz` or `.zst` extension.
+	Compression string `json:"compression" default:"none" options:"none|gzip|zstd"` // *
+
+	// > Max count of the sealed up files in the target dir, the oldest ones are removed. Zero means no limit.
+	MaxFiles int `json:"max_files" default:"0"` // *
+
+	// > Max age of the sealed up files, the older ones are removed. Zero means no limit.
+	MaxFileAge  cfg.Duration `json:"max_file_age" default:"0s" parse:"duration"` // *
+	MaxFileAge_ time.Duration
+
+	// > Format of the lines: `json`, `raw` field, `template` or `csv` columns, see lineformat package.
+	Format lineformat.Config `json:"format" child:"true"` // *
 }
 
 func init() {
@@ -117,6 +145,12 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 	p.fileName = file[0 : len(file)-len(p.fileExtension)]
 	p.tsFileName = "%s" + "-" + p.fileName
 
+	formatter, err := lineformat.New(&p.config.Format)
+	if err != nil {
+		p.logger.Fatalf("can't create formatter: %s", err.Error())
+	}
+	p.formatter = formatter
+
 	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
 		PipelineName:   params.PipelineName,
 		OutputType:     outPluginType,
@@ -129,6 +163,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 	})
 
 	p.mu = &sync.RWMutex{}
+	p.sealUpCh = make(chan struct{}, 1)
 	ctx, cancel := context.WithCancel(context.Background())
 	p.cancel = cancel
 
@@ -179,7 +214,9 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 	outBuf := data.outBuf[:0]
 
 	for _, event := range batch.Events {
-		outBuf, _ = event.Encode(outBuf)
+		l := len(outBuf)
+		outBuf = p.formatter.Append(outBuf, event.Root)
+		event.Size = len(outBuf) - l
 		outBuf = append(outBuf, byte('\n'))
 	}
 	data.outBuf = outBuf
@@ -193,6 +230,9 @@ func (p *Plugin) fileSealUpTicker(ctx context.Context) {
 		select {
 		case <-timer.C:
 			p.sealUp()
+		case <-p.sealUpCh:
+			timer.Stop()
+			p.sealUp()
 		case <-ctx.Done():
 			timer.Stop()
 			return
@@ -216,6 +256,15 @@ func (p *Plugin) write(data []byte) {
 	if _, err := p.file.Write(data); err != nil {
 		p.logger.Fatalf("could not write into the file: %s, error: %s", p.file.Name(), err.Error())
 	}
+
+	size := p.size.Add(int64(len(data)))
+	if p.config.MaxFileSize_ > 0 && uint64(size) >= p.config.MaxFileSize_ {
+		// the file is sealed up by the ticker goroutine, the pending request is enough.
+		select {
+		case p.sealUpCh <- struct{}{}:
+		default:
+		}
+	}
 }
 
 func (p *Plugin) createNew() {
@@ -235,7 +284,12 @@ func (p *Plugin) createNew() {
 	if err != nil {
 		p.logger.Panicf("could not open or create file: %s, error: %s", f, err.Error())
 	}
+	info, err := file.Stat()
+	if err != nil {
+		p.logger.Panicf("could not get info about file: %s, error: %s", f, err.Error())
+	}
 	p.file = file
+	p.size.Store(info.Size())
 }
 
 // sealUp manages current file: renames, closes, and creates new.
@@ -260,8 +314,8 @@ func (p *Plugin) sealUp() {
 		p.logger.Panicf("could not close file: %s, error: %s", oldFile.Name(), err.Error())
 	}
 	logger.Infof("sealing file, newFileName=%s", newFileName)
-	if p.SealUpCallback != nil {
-		longpanic.Go(func() { p.SealUpCallback(newFileName) })
+	if p.SealUpCallback != nil || p.isCompressionEnabled() || p.isRetentionEnabled() {
+		longpanic.Go(func() { p.processSealedFile(newFileName) })
 	}
 }
 
@@ -279,6 +333,16 @@ func (p *Plugin) getStartIdx() int {
 	if err != nil {
 		p.logger.Panic(err.Error())
 	}
+	// the compressed files keep the index of the sealed up ones.
+	for _, ext := range compressionExtensions {
+		compressed, err := filepath.Glob(pattern + ext)
+		if err != nil {
+			p.logger.Panic(err.Error())
+		}
+		for _, v := range compressed {
+			matches = append(matches, strings.TrimSuffix(v, ext))
+		}
+	}
 	idx := -1
 	for _, v := range matches {
 		file := filepath.Base(v)
@@ -0,0 +1,182 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+var compressionExtensions = map[string]string{
+	compressionGzip: ".gz",
+	compressionZstd: ".zst",
+}
+
+// sealedFile is the sealed up file which can be compressed, the compressed and not compressed files have the same index.
+type sealedFile struct {
+	idx   int
+	paths []string
+}
+
+func (p *Plugin) isCompressionEnabled() bool {
+	_, ok := compressionExtensions[p.config.Compression]
+	return ok
+}
+
+func (p *Plugin) isRetentionEnabled() bool {
+	return p.config.MaxFiles > 0 || p.config.MaxFileAge_ > 0
+}
+
+// processSealedFile compresses the sealed up file, removes the expired files and passes the file to the callback.
+func (p *Plugin) processSealedFile(fileName string) {
+	if p.isCompressionEnabled() {
+		compressedName, err := p.compressFile(fileName)
+		if err != nil {
+			p.logger.Errorf("could not compress file: %s, error: %s", fileName, err.Error())
+		} else {
+			fileName = compressedName
+		}
+	}
+
+	if p.isRetentionEnabled() {
+		p.removeExpiredFiles(time.Now())
+	}
+
+	if p.SealUpCallback != nil {
+		p.SealUpCallback(fileName)
+	}
+}
+
+// compressFile compresses the file and removes the original one.
+func (p *Plugin) compressFile(fileName string) (string, error) {
+	compressedName := fileName + compressionExtensions[p.config.Compression]
+
+	src, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(compressedName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(p.config.FileMode_))
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	var w io.WriteCloser
+	if p.config.Compression == compressionZstd {
+		w, err = zstd.NewWriter(dst)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		w = gzip.NewWriter(dst)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Remove(fileName); err != nil {
+		return "", fmt.Errorf("could not remove compressed file: %w", err)
+	}
+	return compressedName, nil
+}
+
+// removeExpiredFiles removes the oldest sealed up files over max_files and the ones older than max_file_age.
+func (p *Plugin) removeExpiredFiles(now time.Time) {
+	p.retentionMu.Lock()
+	defer p.retentionMu.Unlock()
+
+	files := p.getSealedFiles()
+	for i, f := range files {
+		expired := p.config.MaxFiles > 0 && i < len(files)-p.config.MaxFiles
+		if !expired && p.config.MaxFileAge_ > 0 {
+			info, err := os.Stat(f.paths[0])
+			expired = err == nil && info.ModTime().Before(now.Add(-p.config.MaxFileAge_))
+		}
+		if !expired {
+			continue
+		}
+
+		for _, path := range f.paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				p.logger.Errorf("could not remove expired file: %s, error: %s", path, err.Error())
+				continue
+			}
+			p.logger.Infof("expired file is removed: %s", path)
+		}
+	}
+}
+
+// getSealedFiles returns the sealed up files of the target dir ordered by the index.
+func (p *Plugin) getSealedFiles() []sealedFile {
+	pattern := fmt.Sprintf("%s%s%s*%s*", p.targetDir, p.fileName, fileNameSeparator, p.fileExtension)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		p.logger.Errorf("can't glob: pattern=%s, err=%s", pattern, err.Error())
+		return nil
+	}
+
+	byIdx := make(map[int]*sealedFile)
+	for _, m := range matches {
+		idx, ok := p.sealedFileIdx(filepath.Base(m))
+		if !ok {
+			continue
+		}
+		if f, ok := byIdx[idx]; ok {
+			f.paths = append(f.paths, m)
+			continue
+		}
+		byIdx[idx] = &sealedFile{idx: idx, paths: []string{m}}
+	}
+
+	files := make([]sealedFile, 0, len(byIdx))
+	for _, f := range byIdx {
+		files = append(files, *f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].idx < files[j].idx
+	})
+	return files
+}
+
+// sealedFileIdx parses the index of the sealed up file name like `log_1_01-02-2009_15:04.log[.gz]`.
+func (p *Plugin) sealedFileIdx(name string) (int, bool) {
+	for _, ext := range compressionExtensions {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if !strings.HasSuffix(name, p.fileExtension) {
+		return 0, false
+	}
+
+	rest := strings.TrimPrefix(name, p.fileName+fileNameSeparator)
+	end := strings.Index(rest, fileNameSeparator)
+	if len(rest) == len(name) || end == -1 {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(rest[:end])
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+	return idx, true
+}
@@ -0,0 +1,122 @@
+package file
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ozontech/file.d/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRotationPlugin(t *testing.T, config *Config) *Plugin {
+	dir := t.TempDir() + "/"
+	config.TargetFile = dir + "log.log"
+	config.Layout = "01"
+	config.FileMode_ = 0o666
+
+	p := &Plugin{
+		config:        config,
+		logger:        logger.Instance,
+		mu:            &sync.RWMutex{},
+		sealUpCh:      make(chan struct{}, 1),
+		targetDir:     dir,
+		fileExtension: ".log",
+		fileName:      "log",
+	}
+	p.createNew()
+	t.Cleanup(func() { _ = p.file.Close() })
+	return p
+}
+
+func TestSealUpByMaxFileSize(t *testing.T) {
+	p := newRotationPlugin(t, &Config{MaxFileSize_: 10})
+
+	p.write([]byte("12345"))
+	assert.Len(t, p.sealUpCh, 0, "max size isn't reached")
+
+	p.write([]byte("67890"))
+	assert.Len(t, p.sealUpCh, 1, "max size is reached")
+	p.write([]byte("abc"))
+	assert.Len(t, p.sealUpCh, 1, "the only request is pending")
+
+	<-p.sealUpCh
+	p.sealUp()
+	assert.EqualValues(t, 0, p.size.Load(), "new file is empty")
+}
+
+func TestCompressSealedFile(t *testing.T) {
+	for _, compression := range []string{compressionGzip, compressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			p := newRotationPlugin(t, &Config{Compression: compression})
+			fileName := filepath.Join(p.targetDir, "log_0_01.log")
+			require.NoError(t, os.WriteFile(fileName, []byte("some data\n"), 0o666))
+
+			sealed := make(chan string, 1)
+			p.SealUpCallback = func(name string) { sealed <- name }
+			p.processSealedFile(fileName)
+
+			compressedName := <-sealed
+			assert.Equal(t, fileName+compressionExtensions[compression], compressedName)
+			assert.NoFileExists(t, fileName)
+
+			f, err := os.Open(compressedName)
+			require.NoError(t, err)
+			defer f.Close()
+
+			var r io.Reader
+			if compression == compressionGzip {
+				r, err = gzip.NewReader(f)
+			} else {
+				r, err = zstd.NewReader(f)
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "some data\n", string(data))
+		})
+	}
+}
+
+func TestRemoveExpiredFiles(t *testing.T) {
+	p := newRotationPlugin(t, &Config{MaxFiles: 3, MaxFileAge_: time.Hour})
+
+	now := time.Now()
+	files := map[string]time.Duration{
+		"log_0_01.log":        3 * time.Hour,
+		"log_1_01.log.gz":     2 * time.Hour,
+		"log_2_01.log.gz":     time.Minute,
+		"log_3_01.log":        time.Minute,
+		"log_10_01.log.zst":   time.Minute,
+		"log_11_01.log":       0,
+		"log_11_01.log.gz":    0,
+		"another_0_01.log":    3 * time.Hour,
+		"log_broken_01.log":   3 * time.Hour,
+		"log_12_01.log.other": 3 * time.Hour,
+	}
+	for name, age := range files {
+		path := filepath.Join(p.targetDir, name)
+		require.NoError(t, os.WriteFile(path, nil, 0o666))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+
+	p.removeExpiredFiles(now)
+
+	matches, err := filepath.Glob(filepath.Join(p.targetDir, "*"))
+	require.NoError(t, err)
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	assert.ElementsMatch(t, []string{
+		"log_3_01.log", "log_10_01.log.zst", "log_11_01.log", "log_11_01.log.gz",
+		"another_0_01.log", "log_broken_01.log", "log_12_01.log.other",
+		filepath.Base(p.file.Name()),
+	}, names)
+}
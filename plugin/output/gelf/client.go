@@ -2,24 +2,43 @@ package gelf
 
 import (
 	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"net"
 	"time"
 )
 
-const transportTCP string = "tcp"
+const (
+	networkUDP = "udp"
+	networkTCP = "tcp"
+	networkTLS = "tls"
+
+	// chunkHeaderSize is a size of the chunk header: magic bytes, message id, sequence number and sequence count.
+	chunkHeaderSize = 12
+	// maxChunks is a maximum number of chunks of a message, Graylog discards the messages with more chunks.
+	maxChunks = 128
+)
+
+var (
+	chunkMagicBytes = []byte{0x1e, 0x0f}
+
+	errTooManyChunks = errors.New("too many chunks")
+)
 
 type client struct {
 	conn    net.Conn
 	timeout time.Duration
 }
 
-func newClient(address string, connTimeout, writeTimeout time.Duration, useTLS bool, tlsConfig *tls.Config) (c *client, err error) {
+func newClient(network, address string, connTimeout, writeTimeout time.Duration, tlsConfig *tls.Config) (c *client, err error) {
 	c = &client{timeout: writeTimeout}
 
-	if useTLS {
-		c.conn, err = tls.DialWithDialer(&net.Dialer{Timeout: connTimeout}, transportTCP, address, tlsConfig)
-	} else {
-		c.conn, err = net.DialTimeout(transportTCP, address, connTimeout)
+	switch network {
+	case networkTLS:
+		c.conn, err = tls.DialWithDialer(&net.Dialer{Timeout: connTimeout}, networkTCP, address, tlsConfig)
+	default:
+		c.conn, err = net.DialTimeout(network, address, connTimeout)
 	}
 
 	return c, err
@@ -32,6 +51,38 @@ func (g *client) send(data []byte) (int, error) {
 	return g.conn.Write(data)
 }
 
+// sendChunked sends the message as a single datagram if it fits the chunk size,
+// otherwise it splits the message into the GELF chunks, chunkBuf is used to build them.
+func (g *client) sendChunked(chunkBuf, message []byte, chunkSize int, messageID uint64) ([]byte, error) {
+	if len(message) <= chunkSize {
+		_, err := g.send(message)
+		return chunkBuf, err
+	}
+
+	dataSize := chunkSize - chunkHeaderSize
+	count := (len(message) + dataSize - 1) / dataSize
+	if count > maxChunks {
+		return chunkBuf, fmt.Errorf("%w: size=%d, chunks=%d, max chunks=%d", errTooManyChunks, len(message), count, maxChunks)
+	}
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * dataSize
+		if end > len(message) {
+			end = len(message)
+		}
+
+		chunkBuf = append(chunkBuf[:0], chunkMagicBytes...)
+		chunkBuf = binary.BigEndian.AppendUint64(chunkBuf, messageID)
+		chunkBuf = append(chunkBuf, byte(i), byte(count))
+		chunkBuf = append(chunkBuf, message[i*dataSize:end]...)
+		if _, err := g.send(chunkBuf); err != nil {
+			return chunkBuf, err
+		}
+	}
+
+	return chunkBuf, nil
+}
+
 func (g *client) close() error {
 	return g.conn.Close()
 }
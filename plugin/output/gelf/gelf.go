@@ -1,7 +1,14 @@
 package gelf
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	cryptoTLS "crypto/tls"
+	"errors"
+	"io"
+	"math/rand"
 	"strings"
 	"time"
 
@@ -9,16 +16,21 @@ import (
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/tls"
 	prom "github.com/prometheus/client_golang/prometheus"
 	insaneJSON "github.com/vitkovskii/insane-json"
 	"go.uber.org/zap"
 )
 
 /*{ introduction
-It sends event batches to the GELF endpoint. Transport level protocol TCP or UDP is configurable.
-> It doesn't support UDP chunking. So don't use UDP if event size may be greater than 8192.
+It sends event batches to the GELF endpoint. Transport level protocol TCP, TLS or UDP is configurable.
 
-GELF messages are separated by null byte. Each message is a JSON with the following fields:
+For TCP and TLS GELF messages are separated by null byte.
+For UDP every message is sent in a separate datagram, it can be compressed with gzip or zlib.
+The messages larger than `chunk_size` are split into [chunks](https://go2docs.graylog.org/current/getting_in_log_data/gelf.html#GELFviaUDP),
+the messages requiring more than 128 chunks are dropped.
+
+Each message is a JSON with the following fields:
 * `version` *`string=1.1`*
 * `host` *`string`*
 * `short_message` *`string`*
@@ -35,6 +47,9 @@ Allowed characters in field names are letters, numbers, underscores, dashes, and
 
 const (
 	outPluginType = "gelf"
+
+	compressionGzip = "gzip"
+	compressionZlib = "zlib"
 )
 
 type Plugin struct {
@@ -43,6 +58,7 @@ type Plugin struct {
 	avgEventSize int
 	batcher      *pipeline.Batcher
 	controller   pipeline.OutputPluginController
+	tlsConfig    *cryptoTLS.Config
 
 	// plugin metrics
 
@@ -57,6 +73,27 @@ type Config struct {
 	// > An address of gelf endpoint. Format: `HOST:PORT`. E.g. `localhost:12201`.
 	Endpoint string `json:"endpoint" required:"true"` // *
 
+	// > @3@4@5@6
+	// >
+	// > Transport level protocol.
+	Network string `json:"network" default:"tcp" options:"tcp|tls|udp"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA file. Used only if `network` is `tls`.
+	CACert string `json:"ca_cert" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > A maximum size of UDP datagrams including the chunk header.
+	// > Set it to `1420` if the messages are sent over the WAN.
+	ChunkSize int `json:"chunk_size" default:"8192"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Compression of UDP messages.
+	Compression string `json:"compression" default:"none" options:"none|gzip|zlib"` // *
+
 	// > @3@4@5@6
 	// >
 	// > The plugin reconnects to endpoint periodically using this interval. It is useful if an endpoint is a load balancer.
@@ -158,7 +195,17 @@ type Config struct {
 type data struct {
 	outBuf    []byte
 	encodeBuf []byte
+	ends      []int
+	chunkBuf  []byte
 	gelf      *client
+
+	compressBuf *bytes.Buffer
+	compressor  compressor
+}
+
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
 }
 
 func init() {
@@ -190,6 +237,18 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 	p.config.timestampFieldFormat = format
 	p.config.levelField = pipeline.ByteToStringUnsafe(p.formatExtraField(nil, p.config.LevelField))
 
+	if p.config.Network == networkUDP && p.config.ChunkSize <= chunkHeaderSize {
+		p.logger.Fatalf("chunk_size must be greater than %d", chunkHeaderSize)
+	}
+
+	if p.config.Network == networkTLS && p.config.CACert != "" {
+		b := tls.NewConfigBuilder()
+		if err := b.AppendCARoot(p.config.CACert); err != nil {
+			p.logger.Fatalf("can't append CA root: %s", err.Error())
+		}
+		p.tlsConfig = b.Build()
+	}
+
 	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
 		PipelineName:        params.PipelineName,
 		OutputType:          outPluginType,
@@ -223,6 +282,7 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 		*workerData = &data{
 			outBuf:    make([]byte, 0, p.config.BatchSize_*p.avgEventSize),
 			encodeBuf: make([]byte, 0),
+			ends:      make([]int, 0, p.config.BatchSize_),
 		}
 	}
 
@@ -234,19 +294,24 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 
 	outBuf := data.outBuf[:0]
 	encodeBuf := data.encodeBuf[:0]
+	ends := data.ends[:0]
 	for _, event := range batch.Events {
 		encodeBuf = p.formatEvent(encodeBuf, event)
 		outBuf, _ = event.Encode(outBuf)
-		outBuf = append(outBuf, byte(0))
+		if p.config.Network != networkUDP {
+			outBuf = append(outBuf, byte(0))
+		}
+		ends = append(ends, len(outBuf))
 	}
 	data.outBuf = outBuf
 	data.encodeBuf = encodeBuf
+	data.ends = ends
 
 	for {
 		if data.gelf == nil {
 			p.logger.Infof("connecting to gelf address=%s", p.config.Endpoint)
 
-			gelf, err := newClient(p.config.Endpoint, p.config.ConnectionTimeout_, p.config.WriteTimeout_, false, nil)
+			gelf, err := newClient(p.config.Network, p.config.Endpoint, p.config.ConnectionTimeout_, p.config.WriteTimeout_, p.tlsConfig)
 			if err != nil {
 				p.sendErrorMetric.WithLabelValues().Inc()
 				p.logger.Errorf("can't connect to gelf endpoint address=%s: %s", p.config.Endpoint, err.Error())
@@ -256,7 +321,7 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 			data.gelf = gelf
 		}
 
-		_, err := data.gelf.send(outBuf)
+		err := p.send(data, outBuf, ends)
 		if err != nil {
 			p.sendErrorMetric.WithLabelValues().Inc()
 			p.logger.Errorf("can't send data to gelf address=%s, err: %s", p.config.Endpoint, err.Error())
@@ -270,6 +335,57 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 	}
 }
 
+// send writes the whole buffer for stream transports and a datagram or chunks per message for UDP.
+// The messages which can't be chunked are dropped.
+func (p *Plugin) send(data *data, outBuf []byte, ends []int) error {
+	if p.config.Network != networkUDP {
+		_, err := data.gelf.send(outBuf)
+		return err
+	}
+
+	start := 0
+	for _, end := range ends {
+		message := p.compress(data, outBuf[start:end])
+		start = end
+
+		var err error
+		data.chunkBuf, err = data.gelf.sendChunked(data.chunkBuf, message, p.config.ChunkSize, rand.Uint64())
+		if errors.Is(err, errTooManyChunks) {
+			p.sendErrorMetric.WithLabelValues().Inc()
+			p.logger.Errorf("can't send message to gelf address=%s, message is dropped: %s", p.config.Endpoint, err.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress returns the message compressed by the configured compression.
+func (p *Plugin) compress(data *data, message []byte) []byte {
+	if p.config.Compression != compressionGzip && p.config.Compression != compressionZlib {
+		return message
+	}
+
+	if data.compressor == nil {
+		data.compressBuf = &bytes.Buffer{}
+		if p.config.Compression == compressionGzip {
+			data.compressor = gzip.NewWriter(data.compressBuf)
+		} else {
+			data.compressor = zlib.NewWriter(data.compressBuf)
+		}
+	}
+
+	data.compressBuf.Reset()
+	data.compressor.Reset(data.compressBuf)
+	// writing to the bytes.Buffer never fails.
+	_, _ = data.compressor.Write(message)
+	_ = data.compressor.Close()
+
+	return data.compressBuf.Bytes()
+}
+
 func (p *Plugin) maintenance(workerData *pipeline.WorkerData) {
 	if *workerData == nil {
 		return
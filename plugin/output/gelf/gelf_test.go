@@ -1,14 +1,20 @@
 package gelf
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"io"
+	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	insaneJSON "github.com/vitkovskii/insane-json"
 )
 
@@ -129,3 +135,68 @@ func TestFormatEvent(t *testing.T) {
 		assert.Equal(t, expected, resultJSON, "wrong formatted event")
 	}
 }
+
+func TestSendUDPChunked(t *testing.T) {
+	conn, err := net.ListenPacket(networkUDP, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	c, err := newClient(networkUDP, conn.LocalAddr().String(), time.Second, time.Second, nil)
+	require.NoError(t, err)
+	defer c.close()
+
+	plugin := Plugin{config: &Config{Network: networkUDP, ChunkSize: 64, Compression: compressionGzip}}
+	small := []byte(`{"short_message":"a"}`)
+	large := []byte(`{"short_message":"` + strings.Repeat("stack trace line\n", 100) + `"}`)
+	outBuf := append(append([]byte{}, small...), large...)
+
+	err = plugin.send(&data{gelf: c}, outBuf, []int{len(small), len(outBuf)})
+	require.NoError(t, err)
+
+	readDatagram := func() []byte {
+		buf := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		return buf[:n]
+	}
+	decompress := func(b []byte) []byte {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		require.NoError(t, err)
+		result, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return result
+	}
+
+	assert.Equal(t, small, decompress(readDatagram()), "small message isn't chunked")
+
+	var message []byte
+	var messageID []byte
+	for i, count := 0, 1; i < count; i++ {
+		chunk := readDatagram()
+		require.LessOrEqual(t, len(chunk), 64)
+		require.Equal(t, chunkMagicBytes, chunk[:2])
+		if messageID == nil {
+			messageID = chunk[2:10]
+		}
+		assert.Equal(t, messageID, chunk[2:10])
+		assert.Equal(t, byte(i), chunk[10])
+		count = int(chunk[11])
+		message = append(message, chunk[chunkHeaderSize:]...)
+	}
+	assert.Equal(t, large, decompress(message))
+}
+
+func TestSendChunkedTooManyChunks(t *testing.T) {
+	conn, err := net.ListenPacket(networkUDP, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	c, err := newClient(networkUDP, conn.LocalAddr().String(), time.Second, time.Second, nil)
+	require.NoError(t, err)
+	defer c.close()
+
+	message := make([]byte, (64-chunkHeaderSize)*maxChunks+1)
+	_, err = c.sendChunked(nil, message, 64, 1)
+	assert.ErrorIs(t, err, errTooManyChunks)
+}
@@ -0,0 +1,487 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/tls"
+	"github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It sends event batches to an arbitrary HTTP endpoint.
+
+The request body is made of the batch according to the `format`:
+* `ndjson` – events separated by the new line
+* `json_array` – JSON array of events
+* `template` – `body_template` filled with event fields for every event, results are separated by `template_separator`
+
+**An example of Slack-like webhook:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: http
+      endpoint: "https://hooks.example.org/services/T000/B000"
+      format: template
+      body_template: '{"text": "${service}: ${message}"}'
+      batch_size: 1
+      headers:
+        X-Source: file.d
+```
+
+Failed requests are retried with an exponential backoff starting from `retention` up to `max_retention`.
+Responses with `4xx` status codes except `408` and `429` aren't retried.
+If all `retry` attempts fail, the batch is passed to the [fallback output](/docs/configuring.md#fallback-output)
+or dropped if the output doesn't have it.
+}*/
+
+const (
+	outPluginType = "http"
+
+	formatNDJSON    = "ndjson"
+	formatJSONArray = "json_array"
+	formatTemplate  = "template"
+
+	compressionGzip = "gzip"
+)
+
+var errNotRetryable = errors.New("not retryable response")
+
+type Plugin struct {
+	config       *Config
+	client       *http.Client
+	logger       *zap.SugaredLogger
+	avgEventSize int
+	batcher      *pipeline.Batcher
+	controller   pipeline.OutputPluginController
+
+	authHeader  string
+	contentType string
+	templateOps []cfg.SubstitutionOp
+	successCode map[int]bool
+
+	// plugin metrics
+
+	sendErrorMetric     *prometheus.CounterVec
+	droppedEventsMetric *prometheus.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > A full URI of the endpoint. Format: `https://127.0.0.1:8080/webhook`.
+	Endpoint string `json:"endpoint" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > HTTP method of requests.
+	Method string `json:"method" default:"POST" options:"POST|PUT|PATCH"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Format of the request body.
+	Format string `json:"format" default:"ndjson" options:"ndjson|json_array|template"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Body template used by `template` format. Use `${field}` to insert event field values.
+	// > String values are inserted JSON-escaped without quotes, other values are inserted as JSON.
+	// > Use `$$` to insert `$` character.
+	BodyTemplate string `json:"body_template" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Separator of filled templates in the request body.
+	TemplateSeparator string `json:"template_separator" default:"\n"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Value of `Content-Type` header. It's chosen by the `format` if empty.
+	ContentType string `json:"content_type" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Additional headers of requests.
+	Headers map[string]string `json:"headers"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Username for HTTP Basic Authentication.
+	Username string `json:"username"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Password for HTTP Basic Authentication.
+	Password string `json:"password"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Token for `Bearer` authentication; if set, overrides username/password.
+	BearerToken string `json:"bearer_token"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA file.
+	CACert string `json:"ca_cert"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Compression of the request body.
+	Compression string `json:"compression" default:"none" options:"none|gzip"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Status codes of successful responses. Any `2xx` code is successful if empty.
+	SuccessCodes []int `json:"success_codes"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Client timeout of requests.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"5s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many times to retry the request. Zero means retrying until success.
+	Retry int `json:"retry" default:"0"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Initial retention between retries, it's doubled after each attempt.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Maximal retention between retries.
+	MaxRetention  cfg.Duration `json:"max_retention" default:"1m" parse:"duration"` // *
+	MaxRetention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > A minimum size of events in a batch to send.
+	// > If both batch_size and batch_size_bytes are set, they will work together.
+	BatchSizeBytes  cfg.Expression `json:"batch_size_bytes" default:"0" parse:"expression"` // *
+	BatchSizeBytes_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+type data struct {
+	outBuf  []byte
+	gzipBuf *bytes.Buffer
+	gzip    *gzip.Writer
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.avgEventSize = params.PipelineSettings.AvgEventSize
+	p.config = config.(*Config)
+
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+	if p.config.MaxRetention_ < p.config.Retention_ {
+		p.logger.Fatal("'max_retention' can't be less than 'retention'")
+	}
+
+	if p.config.Format == formatTemplate {
+		if p.config.BodyTemplate == "" {
+			p.logger.Fatal("'body_template' must be set for template format")
+		}
+		ops, err := cfg.ParseSubstitution(p.config.BodyTemplate)
+		if err != nil {
+			p.logger.Fatalf("can't parse body template: %s", err.Error())
+		}
+		p.templateOps = ops
+	}
+
+	p.successCode = make(map[int]bool, len(p.config.SuccessCodes))
+	for _, code := range p.config.SuccessCodes {
+		p.successCode[code] = true
+	}
+
+	p.contentType = p.getContentType()
+	p.authHeader = p.getAuthHeader()
+	p.client = p.newClient()
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		MaintenanceFn:  p.maintenance,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		BatchSizeBytes: p.config.BatchSizeBytes_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_http_send_error", "Total HTTP send errors")
+	p.droppedEventsMetric = ctl.RegisterCounter("output_http_dropped_events", "Total events dropped after all retries")
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{
+			outBuf: make([]byte, 0, p.config.BatchSize_*p.avgEventSize),
+		}
+	}
+
+	data := (*workerData).(*data)
+	// handle too much memory consumption
+	if cap(data.outBuf) > p.config.BatchSize_*p.avgEventSize {
+		data.outBuf = make([]byte, 0, p.config.BatchSize_*p.avgEventSize)
+	}
+
+	data.outBuf = p.makeBody(data.outBuf[:0], batch.Events)
+	body := data.outBuf
+	if p.config.Compression == compressionGzip {
+		body = p.compress(data, body)
+	}
+
+	retention := p.config.Retention_
+	for attempt := 1; ; attempt++ {
+		err := p.send(body)
+		if err == nil {
+			break
+		}
+
+		p.sendErrorMetric.WithLabelValues().Inc()
+		if errors.Is(err, errNotRetryable) || p.config.Retry > 0 && attempt >= p.config.Retry {
+			if p.batcher.Fallback(batch) {
+				p.logger.Errorf("can't send data to address=%s, batch of %d events is passed to the fallback output: %s", p.config.Endpoint, len(batch.Events), err.Error())
+				break
+			}
+			p.droppedEventsMetric.WithLabelValues().Add(float64(len(batch.Events)))
+			p.logger.Errorf("can't send data to address=%s, batch of %d events is dropped: %s", p.config.Endpoint, len(batch.Events), err.Error())
+			break
+		}
+
+		p.logger.Errorf("can't send data to address=%s, next attempt in %s: %s", p.config.Endpoint, retention.String(), err.Error())
+		time.Sleep(retention)
+		retention *= 2
+		if retention > p.config.MaxRetention_ {
+			retention = p.config.MaxRetention_
+		}
+	}
+}
+
+func (p *Plugin) maintenance(_ *pipeline.WorkerData) {}
+
+// makeBody appends the request body made of events to the buf.
+func (p *Plugin) makeBody(buf []byte, events []*pipeline.Event) []byte {
+	switch p.config.Format {
+	case formatJSONArray:
+		buf = append(buf, '[')
+		for i, event := range events {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = event.Root.Encode(buf)
+		}
+		buf = append(buf, ']')
+	case formatTemplate:
+		for i, event := range events {
+			if i > 0 {
+				buf = append(buf, p.config.TemplateSeparator...)
+			}
+			buf = p.fillTemplate(buf, event.Root)
+		}
+	default:
+		for _, event := range events {
+			buf = event.Root.Encode(buf)
+			buf = append(buf, '\n')
+		}
+	}
+
+	return buf
+}
+
+func (p *Plugin) fillTemplate(buf []byte, root *insaneJSON.Root) []byte {
+	for _, op := range p.templateOps {
+		switch op.Kind {
+		case cfg.SubstitutionOpKindRaw:
+			buf = append(buf, op.Data[0]...)
+		case cfg.SubstitutionOpKindField:
+			node := root.Dig(op.Data...)
+			if node == nil {
+				continue
+			}
+			if node.IsString() {
+				// encoded string is quoted, so quotes are cut off.
+				l := len(buf)
+				buf = node.Encode(buf)
+				buf = append(buf[:l], buf[l+1:len(buf)-1]...)
+				continue
+			}
+			buf = node.Encode(buf)
+		default:
+			p.logger.Panicf("unknown substitution kind %d", op.Kind)
+		}
+	}
+	return buf
+}
+
+func (p *Plugin) compress(data *data, body []byte) []byte {
+	if data.gzip == nil {
+		data.gzipBuf = &bytes.Buffer{}
+		data.gzip = gzip.NewWriter(data.gzipBuf)
+	}
+
+	data.gzipBuf.Reset()
+	data.gzip.Reset(data.gzipBuf)
+	// writing to the bytes.Buffer never fails.
+	_, _ = data.gzip.Write(body)
+	_ = data.gzip.Close()
+
+	return data.gzipBuf.Bytes()
+}
+
+func (p *Plugin) newClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.config.CACert != "" {
+		b := tls.NewConfigBuilder()
+		err := b.AppendCARoot(p.config.CACert)
+		if err != nil {
+			p.logger.Fatalf("can't append CA root: %s", err.Error())
+		}
+		transport.TLSClientConfig = b.Build()
+	}
+
+	return &http.Client{
+		Timeout:   p.config.RequestTimeout_,
+		Transport: transport,
+	}
+}
+
+func (p *Plugin) send(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), p.config.Method, p.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("can't create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", p.contentType)
+	if p.config.Compression == compressionGzip {
+		req.Header.Set("Content-Encoding", compressionGzip)
+	}
+	if p.authHeader != "" {
+		req.Header.Set("Authorization", p.authHeader)
+	}
+	for name, value := range p.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("can't send request: %w", err)
+	}
+	defer resp.Body.Close()
+	// read the body to reuse the connection.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if p.isSuccess(resp.StatusCode) {
+		return nil
+	}
+	if isRetryable(resp.StatusCode) {
+		return fmt.Errorf("bad response: %s", resp.Status)
+	}
+	return fmt.Errorf("%w: %s", errNotRetryable, resp.Status)
+}
+
+func (p *Plugin) isSuccess(code int) bool {
+	if len(p.successCode) == 0 {
+		return code >= http.StatusOK && code < http.StatusMultipleChoices
+	}
+	return p.successCode[code]
+}
+
+func isRetryable(code int) bool {
+	if code == http.StatusRequestTimeout || code == http.StatusTooManyRequests {
+		return true
+	}
+	return code < http.StatusBadRequest || code >= http.StatusInternalServerError
+}
+
+func (p *Plugin) getContentType() string {
+	if p.config.ContentType != "" {
+		return p.config.ContentType
+	}
+
+	switch p.config.Format {
+	case formatJSONArray:
+		return "application/json"
+	case formatTemplate:
+		return "text/plain"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+func (p *Plugin) getAuthHeader() string {
+	if p.config.BearerToken != "" {
+		return "Bearer " + p.config.BearerToken
+	}
+	if p.config.Username != "" && p.config.Password != "" {
+		credentials := []byte(p.config.Username + ":" + p.config.Password)
+		return "Basic " + base64.StdEncoding.EncodeToString(credentials)
+	}
+	return ""
+}
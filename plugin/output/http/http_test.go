@@ -0,0 +1,213 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+func newTestBatch(t *testing.T, events ...string) *pipeline.Batch {
+	batch := &pipeline.Batch{}
+	for _, e := range events {
+		root, err := insaneJSON.DecodeString(e)
+		require.NoError(t, err)
+		t.Cleanup(func() { insaneJSON.Release(root) })
+		batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+	}
+	return batch
+}
+
+func newTestPlugin(t *testing.T, config *Config) *Plugin {
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1, "capacity": 64})
+	p := &Plugin{
+		config: config,
+		logger: zap.NewExample().Sugar(),
+	}
+	ctl := metric.New("test")
+	p.RegisterMetrics(ctl)
+
+	if config.Format == formatTemplate {
+		ops, err := cfg.ParseSubstitution(config.BodyTemplate)
+		require.NoError(t, err)
+		p.templateOps = ops
+	}
+	p.successCode = map[int]bool{}
+	for _, code := range config.SuccessCodes {
+		p.successCode[code] = true
+	}
+	p.contentType = p.getContentType()
+	p.authHeader = p.getAuthHeader()
+	p.client = p.newClient()
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{Controller: noFallbackController{}})
+	return p
+}
+
+// noFallbackController is the controller of the output without the fallback output.
+type noFallbackController struct{}
+
+func (noFallbackController) Commit(*pipeline.Event)   {}
+func (noFallbackController) Error(string)             {}
+func (noFallbackController) HasFallback() bool        { return false }
+func (noFallbackController) Fallback(*pipeline.Event) {}
+
+func TestFormats(t *testing.T) {
+	events := []string{`{"service":"a","message":"hello \"world\""}`, `{"service":"b","level":3}`}
+
+	cases := []struct {
+		name        string
+		config      *Config
+		contentType string
+		expected    string
+	}{
+		{
+			name:        "ndjson",
+			config:      &Config{},
+			contentType: "application/x-ndjson",
+			expected:    `{"service":"a","message":"hello \"world\""}` + "\n" + `{"service":"b","level":3}` + "\n",
+		},
+		{
+			name:        "json_array",
+			config:      &Config{Format: formatJSONArray},
+			contentType: "application/json",
+			expected:    `[{"service":"a","message":"hello \"world\""},{"service":"b","level":3}]`,
+		},
+		{
+			name:        "template",
+			config:      &Config{Format: formatTemplate, BodyTemplate: `{"text":"${service}: ${message}","level":${level}}`},
+			contentType: "text/plain",
+			expected:    `{"text":"a: hello \"world\"","level":}` + "\n" + `{"text":"b: ","level":3}`,
+		},
+		{
+			name:        "custom_content_type",
+			config:      &Config{Format: formatTemplate, BodyTemplate: "${service}", TemplateSeparator: ",", ContentType: "text/csv"},
+			contentType: "text/csv",
+			expected:    "a,b",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body []byte
+			var contentType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer server.Close()
+
+			tc.config.Endpoint = server.URL
+			p := newTestPlugin(t, tc.config)
+
+			data := pipeline.WorkerData(nil)
+			p.out(&data, newTestBatch(t, events...))
+
+			assert.Equal(t, tc.expected, string(body))
+			assert.Equal(t, tc.contentType, contentType)
+		})
+	}
+}
+
+func TestRequest(t *testing.T) {
+	var (
+		method, auth, encoding, custom string
+		body                           []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		auth = r.Header.Get("Authorization")
+		encoding = r.Header.Get("Content-Encoding")
+		custom = r.Header.Get("X-Custom")
+
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, _ = io.ReadAll(reader)
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(t, &Config{
+		Endpoint:    server.URL,
+		Method:      http.MethodPut,
+		Compression: compressionGzip,
+		BearerToken: "token",
+		Headers:     map[string]string{"X-Custom": "value"},
+	})
+
+	data := pipeline.WorkerData(nil)
+	for i := 0; i < 2; i++ {
+		p.out(&data, newTestBatch(t, `{"a":1}`))
+
+		assert.Equal(t, http.MethodPut, method)
+		assert.Equal(t, "Bearer token", auth)
+		assert.Equal(t, compressionGzip, encoding)
+		assert.Equal(t, "value", custom)
+		assert.Equal(t, "{\"a\":1}\n", string(body))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	cases := []struct {
+		name         string
+		statuses     []int
+		successCodes []int
+		retry        int
+		requests     int
+	}{
+		{
+			name:     "retry_until_success",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			requests: 3,
+		},
+		{
+			name:     "not_retryable",
+			statuses: []int{http.StatusBadRequest, http.StatusOK},
+			requests: 1,
+		},
+		{
+			name:     "retries_exhausted",
+			statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			retry:    2,
+			requests: 2,
+		},
+		{
+			name:         "success_codes",
+			statuses:     []int{http.StatusOK, http.StatusAccepted},
+			successCodes: []int{http.StatusAccepted},
+			requests:     2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			p := newTestPlugin(t, &Config{
+				Endpoint:     server.URL,
+				SuccessCodes: tc.successCodes,
+				Retry:        tc.retry,
+				Retention:    "1ms",
+				MaxRetention: "2ms",
+			})
+
+			data := pipeline.WorkerData(nil)
+			p.out(&data, newTestBatch(t, `{"a":1}`))
+
+			assert.Equal(t, tc.requests, requests)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+// flakyProducer fails to deliver the first message of every attempt until failures are over.
+type flakyProducer struct {
+	// the transactional methods aren't used
+	sarama.SyncProducer
+
+	failures  int
+	attempts  [][]string
+	delivered []string
+}
+
+func (f *flakyProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, f.SendMessages([]*sarama.ProducerMessage{msg})
+}
+
+func (f *flakyProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	attempt := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		attempt = append(attempt, string(msg.Value.(sarama.ByteEncoder)))
+	}
+	f.attempts = append(f.attempts, attempt)
+
+	if f.failures == 0 {
+		f.delivered = append(f.delivered, attempt...)
+		return nil
+	}
+	f.failures--
+
+	f.delivered = append(f.delivered, attempt[1:]...)
+	return sarama.ProducerErrors{{Msg: msgs[0], Err: errors.New("leader not available")}}
+}
+
+func (f *flakyProducer) Close() error {
+	return nil
+}
+
+func newTestBatch(t *testing.T, events ...string) *pipeline.Batch {
+	batch := &pipeline.Batch{}
+	for _, e := range events {
+		root, err := insaneJSON.DecodeString(e)
+		require.NoError(t, err)
+		t.Cleanup(func() { insaneJSON.Release(root) })
+		batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+	}
+	return batch
+}
+
+func TestResendUndelivered(t *testing.T) {
+	producer := &flakyProducer{failures: 2}
+	p := &Plugin{
+		logger: zap.NewExample().Sugar(),
+		config: &Config{
+			DefaultTopic: "logs",
+			BatchSize_:   4,
+			Retention_:   time.Millisecond,
+		},
+		avgEventSize: 16,
+		producer:     producer,
+	}
+	p.RegisterMetrics(metric.New("test"))
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t, `{"a":1}`, `{"a":2}`, `{"a":3}`))
+
+	assert.Equal(t, [][]string{
+		{`{"a":1}`, `{"a":2}`, `{"a":3}`},
+		{`{"a":1}`},
+		{`{"a":1}`},
+	}, producer.attempts)
+	assert.Equal(t, []string{`{"a":2}`, `{"a":3}`, `{"a":1}`}, producer.delivered)
+
+	// messages of the worker aren't messed up by the resending
+	producer.attempts = nil
+	p.out(&workerData, newTestBatch(t, `{"b":1}`, `{"b":2}`, `{"b":3}`))
+	assert.Equal(t, [][]string{{`{"b":1}`, `{"b":2}`, `{"b":3}`}}, producer.attempts)
+}
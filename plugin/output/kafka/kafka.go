@@ -2,7 +2,10 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -10,12 +13,48 @@ import (
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/tls"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
 /*{ introduction
 It sends the event batches to kafka brokers using `sarama` lib.
+
+Events are committed to the input plugin only after the brokers have confirmed the write according to `required_acks`.
+Messages which weren't delivered are resent until success, so the input doesn't move its offsets
+while the events may still be lost in the producer queue.
+
+Set `idempotent` to make sure the resent messages aren't duplicated in the topic partitions,
+it requires `required_acks` to be `all`.
+
+The topic of each event can be built from the event fields with `topic_format` and `topic_values`,
+the messages with the same `key_field` value are written to the same partition.
+
+With `avro` and `protobuf` encoding the events are serialized by the schema of
+[Confluent Schema Registry](https://docs.confluent.io/platform/current/schema-registry/fundamentals/serdes-develop/index.html#wire-format),
+the messages are prefixed with the schema id. The events which don't match the schema are dropped.
+
+If `transactional_id` is set, each batch is written in a kafka transaction. For the pipelines reading from the kafka input
+set `transaction_consumer_group` to the consumer group of the input and `transaction_consumer_topics` to its `topics`,
+so the offsets of the read events are committed in the same transaction.
+The consumers of the topics with `isolation.level=read_committed` get every event exactly once.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: kafka
+      brokers: [kafka:9092]
+      default_topic: logs
+      topic_format: logs-%-%
+      topic_values: [tenant, service]
+      key_field: trace_id
+      headers_fields: [tenant]
+```
 }*/
 
 const (
@@ -25,6 +64,9 @@ const (
 type data struct {
 	messages []*sarama.ProducerMessage
 	outBuf   sarama.ByteEncoder
+	topicBuf []byte
+	txn      sarama.SyncProducer
+	txnID    string
 }
 
 type Plugin struct {
@@ -36,9 +78,21 @@ type Plugin struct {
 	producer sarama.SyncProducer
 	batcher  *pipeline.Batcher
 
+	// saramaConfig is used by the transactional producers of the workers instead of the producer.
+	saramaConfig *sarama.Config
+	txnCounter   atomic.Int32
+	txnMu        sync.Mutex
+	txnProducers map[string]sarama.SyncProducer
+
+	topicValues   [][]string
+	headersFields [][]string
+	headersKeys   [][]byte
+	encoder       messageEncoder
+
 	// plugin metrics
 
-	sendErrorMetric *prometheus.CounterVec
+	sendErrorMetric   *prometheus.CounterVec
+	encodeErrorMetric *prometheus.CounterVec
 }
 
 // ! config-params
@@ -64,6 +118,157 @@ type Config struct {
 	// > Which event field to use as topic name. It works only if `should_use_topic_field` is set.
 	TopicField string `json:"topic_field" default:"topic"` // *
 
+	// > @3@4@5@6
+	// >
+	// > It defines the pattern of the topic name, it overrides `use_topic_field`. Use `%` character as a placeholder.
+	// > Use `topic_values` to define values for the replacement.
+	// > E.g. if `topic_format="logs-%"` and `topic_values="tenant"` and event is `{"tenant"="shop"}`
+	// > then the topic for that event will be `logs-shop`.
+	// > The characters which aren't allowed in the topic names are replaced with `_`.
+	TopicFormat string `json:"topic_format" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > A list of event fields which will be used for replacement `topic_format`.
+	TopicValues []string `json:"topic_values" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field which value is used as the message key. The messages with the same key are written to the same partition.
+	// > If it isn't set, the messages are distributed among the partitions by round-robin.
+	KeyField  cfg.FieldSelector `json:"key_field" parse:"selector"` // *
+	KeyField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Event fields to add as the message headers. The last key of the field path is used as the header name.
+	HeadersFields []string `json:"headers_fields" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Encoding of the message values:
+	// > * `json` – the events as is
+	// > * `avro` – Avro binary encoding by the schema of `schema_registry`
+	// > * `protobuf` – Protobuf encoding by `schema_registry.proto_descriptor_set`, the schema id is got from `schema_registry`
+	Encoding string `json:"encoding" default:"json" options:"json|avro|protobuf"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Schema registry settings of `avro` and `protobuf` encoding.
+	SchemaRegistry SchemaRegistryConfig `json:"schema_registry" child:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Level of acknowledgement the brokers must give to consider the write successful.
+	// > * `none` – don't wait for the acknowledgement, events can be lost
+	// > * `leader` – wait for the partition leader to write the events
+	// > * `all` – wait for all in-sync replicas to write the events
+	RequiredAcks string `json:"required_acks" default:"leader" options:"none|leader|all"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How long the brokers wait for the `required_acks`.
+	AckTimeout  cfg.Duration `json:"ack_timeout" default:"10s" parse:"duration"` // *
+	AckTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > If set, the producer writes every message exactly once to the partition even if it's resent.
+	// > It requires `required_acks` to be `all` and `version` to be at least `0.11.0`.
+	Idempotent bool `json:"idempotent" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the batches are written in the kafka transactions. Each worker uses its own transactional id `<transactional_id>-<worker index>`,
+	// > so it must be unique among the file.d instances writing to the same cluster.
+	// > It requires `required_acks` to be `all` and `version` to be at least `0.11.0`.
+	TransactionalID string `json:"transactional_id" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The maximum duration of the transaction, the broker aborts the transactions which aren't committed in time.
+	TransactionTimeout  cfg.Duration `json:"transaction_timeout" default:"1m" parse:"duration"` // *
+	TransactionTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > The consumer group of the kafka input which offsets are committed in the transactions.
+	// > It works only if `transactional_id` is set and the events are read by the kafka input.
+	TransactionConsumerGroup string `json:"transaction_consumer_group" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The `topics` of the kafka input in the same order, the kafka input identifies the topics of the events by their indexes.
+	// > It must be set along with `transaction_consumer_group`.
+	TransactionConsumerTopics []string `json:"transaction_consumer_topics" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Compression codec of the messages. `zstd` requires `version` to be at least `2.1.0`.
+	Compression string `json:"compression" default:"none" options:"none|gzip|snappy|lz4|zstd"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Version of the kafka protocol to use, e.g. `2.8.0`. It must not be greater than the brokers version.
+	Version string `json:"version" default:"1.0.0"` // *
+
+	// > @3@4@5@6
+	// >
+	// > SASL mechanism of the authentication:
+	// > * `none` – authentication is disabled
+	// > * `plain` – `sasl_username` and `sasl_password` are sent as is, so use it along with TLS
+	// > * `scram-sha-256`, `scram-sha-512` – SCRAM authentication with `sasl_username` and `sasl_password`
+	// > * `oauthbearer` – the token is got from `sasl_oauth_token_url` by OAuth 2.0 client credentials flow,
+	// > `sasl_username` and `sasl_password` are used as the client id and secret
+	SaslMechanism string `json:"sasl_mechanism" default:"none" options:"none|plain|scram-sha-256|scram-sha-512|oauthbearer"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Username of SASL authentication.
+	SaslUsername string `json:"sasl_username" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Password of SASL authentication.
+	SaslPassword string `json:"sasl_password" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > A token endpoint of OAuth 2.0 server for `oauthbearer` mechanism.
+	SaslOAuthTokenURL string `json:"sasl_oauth_token_url" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Scopes of OAuth 2.0 tokens for `oauthbearer` mechanism.
+	SaslOAuthScopes []string `json:"sasl_oauth_scopes"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the connections to the brokers are secured by TLS.
+	TLSEnabled bool `json:"tls_enabled" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA file.
+	CACert string `json:"ca_cert" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded client certificate for the mutual TLS authentication.
+	// > It must be set along with `client_key`.
+	ClientCert string `json:"client_cert" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded private key of the `client_cert`.
+	ClientKey string `json:"client_key" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Retention between attempts to resend messages which weren't delivered.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
 	// > @3@4@5@6
 	// >
 	// > How many workers will be instantiated to send batches.
@@ -109,7 +314,46 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 
 	p.logger.Infof("workers count=%d, batch size=%d", p.config.WorkersCount_, p.config.BatchSize_)
 
-	p.producer = p.newProducer()
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+
+	if strings.Count(p.config.TopicFormat, "%") != len(p.config.TopicValues) {
+		p.logger.Fatal("count of placeholders and values isn't match, check topic_format/topic_values config params")
+	}
+	p.topicValues = make([][]string, 0, len(p.config.TopicValues))
+	for _, value := range p.config.TopicValues {
+		p.topicValues = append(p.topicValues, cfg.ParseFieldSelector(value))
+	}
+
+	p.headersFields = make([][]string, 0, len(p.config.HeadersFields))
+	p.headersKeys = make([][]byte, 0, len(p.config.HeadersFields))
+	for _, field := range p.config.HeadersFields {
+		selector := cfg.ParseFieldSelector(field)
+		if len(selector) == 0 {
+			p.logger.Fatalf("wrong headers field %q", field)
+		}
+		p.headersFields = append(p.headersFields, selector)
+		p.headersKeys = append(p.headersKeys, []byte(selector[len(selector)-1]))
+	}
+
+	if p.config.Encoding != encodingJSON {
+		encoder, err := newMessageEncoder(p.config.Encoding, p.config.DefaultTopic, &p.config.SchemaRegistry)
+		if err != nil {
+			p.logger.Fatalf("can't create %s encoder: %s", p.config.Encoding, err.Error())
+		}
+		p.encoder = encoder
+	}
+
+	if p.config.TransactionConsumerGroup != "" && len(p.config.TransactionConsumerTopics) == 0 {
+		p.logger.Fatal("transaction_consumer_topics must be set along with transaction_consumer_group")
+	}
+
+	if p.config.TransactionalID != "" {
+		p.saramaConfig = p.newTxnConfig()
+	} else {
+		p.producer = p.newProducer()
+	}
 	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
 		PipelineName:   params.PipelineName,
 		OutputType:     outPluginType,
@@ -130,6 +374,7 @@ func (p *Plugin) Out(event *pipeline.Event) {
 
 func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
 	p.sendErrorMetric = ctl.RegisterCounter("output_kafka_send_errors", "Total Kafka send errors")
+	p.encodeErrorMetric = ctl.RegisterCounter("output_kafka_encode_errors", "Total events which can't be encoded by the schema")
 }
 
 func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
@@ -141,6 +386,10 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 	}
 
 	data := (*workerData).(*data)
+	if p.saramaConfig != nil && data.txn == nil {
+		data.txnID = fmt.Sprintf("%s-%d", p.config.TransactionalID, p.txnCounter.Inc()-1)
+		data.txn = p.newTxnProducer(data.txnID)
+	}
 	// handle to much memory consumption
 	if cap(data.outBuf) > p.config.BatchSize_*p.avgEventSize {
 		data.outBuf = make(sarama.ByteEncoder, 0, p.config.BatchSize_*p.avgEventSize)
@@ -148,58 +397,269 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 
 	outBuf := data.outBuf[:0]
 	start := 0
-	for i, event := range batch.Events {
-		outBuf, start = event.Encode(outBuf)
-
-		topic := p.config.DefaultTopic
-		if p.config.UseTopicField {
-			fieldValue := event.Root.Dig(p.config.TopicField).AsString()
-			if fieldValue != "" {
-				topic = pipeline.CloneString(fieldValue)
+	count := 0
+	for _, event := range batch.Events {
+		if p.encoder == nil {
+			outBuf, start = event.Encode(outBuf)
+		} else {
+			var err error
+			start = len(outBuf)
+			outBuf, err = p.encoder.encode(outBuf, event.Root)
+			if err != nil {
+				p.encodeErrorMetric.WithLabelValues().Inc()
+				p.logger.Errorf("can't encode event by %s schema, event is dropped: %s", p.config.Encoding, err.Error())
+				outBuf = outBuf[:start]
+				continue
+			}
+		}
+
+		if data.messages[count] == nil {
+			data.messages[count] = &sarama.ProducerMessage{}
+		}
+		message := data.messages[count]
+		count++
+		message.Value = outBuf[start:]
+		message.Topic = p.getTopic(data, event)
+
+		// the key and headers values are copied to the buffer since the messages are reused by the worker.
+		message.Key = nil
+		if len(p.config.KeyField_) > 0 {
+			if node := event.Root.Dig(p.config.KeyField_...); node != nil {
+				start = len(outBuf)
+				outBuf = append(outBuf, node.AsString()...)
+				message.Key = outBuf[start:]
 			}
 		}
 
-		if data.messages[i] == nil {
-			data.messages[i] = &sarama.ProducerMessage{}
+		message.Headers = message.Headers[:0]
+		for j, field := range p.headersFields {
+			node := event.Root.Dig(field...)
+			if node == nil {
+				continue
+			}
+			start = len(outBuf)
+			outBuf = append(outBuf, node.AsString()...)
+			message.Headers = append(message.Headers, sarama.RecordHeader{Key: p.headersKeys[j], Value: outBuf[start:]})
 		}
-		data.messages[i].Value = outBuf[start:]
-		data.messages[i].Topic = topic
 	}
 
 	data.outBuf = outBuf
 
-	err := p.producer.SendMessages(data.messages[:len(batch.Events)])
-	if err != nil {
-		errs := err.(sarama.ProducerErrors)
-		for _, e := range errs {
-			p.logger.Errorf("can't write batch: %s", e.Err.Error())
+	if data.txn != nil {
+		p.sendTransaction(data, batch, data.messages[:count])
+		return
+	}
+
+	if count > 0 {
+		p.send(data.messages[:count])
+	}
+}
+
+func (p *Plugin) getTopic(data *data, event *pipeline.Event) string {
+	if p.config.TopicFormat != "" {
+		data.topicBuf = p.appendTopic(data.topicBuf[:0], event)
+		return string(data.topicBuf)
+	}
+
+	if p.config.UseTopicField {
+		fieldValue := event.Root.Dig(p.config.TopicField).AsString()
+		if fieldValue != "" {
+			return pipeline.CloneString(fieldValue)
 		}
+	}
+	return p.config.DefaultTopic
+}
+
+func (p *Plugin) appendTopic(buf []byte, event *pipeline.Event) []byte {
+	replacements := 0
+	for _, c := range pipeline.StringToByteUnsafe(p.config.TopicFormat) {
+		if c != '%' {
+			buf = append(buf, c)
+			continue
+		}
+
+		value := p.topicValues[replacements]
+		replacements++
+
+		node := event.Root.Dig(value...)
+		if node == nil {
+			buf = append(buf, pipeline.DefaultFieldValue...)
+			continue
+		}
+		buf = appendTopicName(buf, node.AsString())
+	}
+
+	return buf
+}
+
+// appendTopicName appends the value replacing the characters which aren't allowed in the topic names.
+func appendTopicName(buf []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isNumber := c >= '0' && c <= '9'
+		if !isLetter && !isNumber && c != '.' && c != '_' && c != '-' {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// send blocks until all messages are delivered,
+// so the batcher commits the events only after the brokers confirm the write.
+func (p *Plugin) send(messages []*sarama.ProducerMessage) {
+	for {
+		err := p.producer.SendMessages(messages)
+		if err == nil {
+			return
+		}
+
+		var errs sarama.ProducerErrors
+		if !errors.As(err, &errs) {
+			p.sendErrorMetric.WithLabelValues().Add(float64(len(messages)))
+			p.logger.Errorf("can't write batch, next attempt in %s: %s", p.config.Retention_.String(), err.Error())
+			time.Sleep(p.config.Retention_)
+			continue
+		}
+
 		p.sendErrorMetric.WithLabelValues().Add(float64(len(errs)))
-		p.controller.Error("some events from batch were not written")
+		p.logger.Errorf("can't write %d messages of batch, next attempt in %s: %s", len(errs), p.config.Retention_.String(), errs[0].Err.Error())
+
+		// only undelivered messages are resent, the buffer of the batch messages is reused by the worker
+		messages = make([]*sarama.ProducerMessage, 0, len(errs))
+		for _, e := range errs {
+			messages = append(messages, e.Msg)
+		}
+		time.Sleep(p.config.Retention_)
 	}
 }
 
 func (p *Plugin) Stop() {
 	p.batcher.Stop()
+	if p.saramaConfig != nil {
+		p.txnMu.Lock()
+		ids := make([]string, 0, len(p.txnProducers))
+		for id := range p.txnProducers {
+			ids = append(ids, id)
+		}
+		p.txnMu.Unlock()
+		for _, id := range ids {
+			p.closeTxnProducer(id)
+		}
+		return
+	}
 	if err := p.producer.Close(); err != nil {
 		p.logger.Error("can't stop kafka producer: %s", err)
 	}
 }
 
+func (p *Plugin) newTxnConfig() *sarama.Config {
+	config, err := p.newSaramaConfig()
+	if err != nil {
+		p.logger.Fatalf("can't create transactional producer config: %s", err.Error())
+	}
+	p.txnProducers = make(map[string]sarama.SyncProducer)
+
+	p.logger.Infof("transactional producers use brokers %q", strings.Join(p.config.Brokers, ","))
+	return config
+}
+
 func (p *Plugin) newProducer() sarama.SyncProducer {
+	config, err := p.newSaramaConfig()
+	if err != nil {
+		p.logger.Fatalf("can't create producer config: %s", err.Error())
+	}
+
+	producer, err := sarama.NewSyncProducer(p.config.Brokers, config)
+	if err != nil {
+		p.logger.Fatalf("can't create producer: %s", err.Error())
+	}
+
+	p.logger.Infof("producer created with brokers %q", strings.Join(p.config.Brokers, ","))
+	return producer
+}
+
+func (p *Plugin) newSaramaConfig() (*sarama.Config, error) {
 	config := sarama.NewConfig()
 	config.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	if len(p.config.KeyField_) > 0 {
+		config.Producer.Partitioner = sarama.NewHashPartitioner
+	}
 	config.Producer.Flush.Messages = p.config.BatchSize_
 	// kafka plugin itself cares for flush frequency, but we are using batcher so disable it.
 	config.Producer.Flush.Frequency = time.Millisecond
 	config.Producer.Return.Errors = true
 	config.Producer.Return.Successes = true
+	config.Producer.Timeout = p.config.AckTimeout_
 
-	producer, err := sarama.NewSyncProducer(p.config.Brokers, config)
+	version, err := sarama.ParseKafkaVersion(p.config.Version)
 	if err != nil {
-		p.logger.Fatalf("can't create producer: %s", err.Error())
+		return nil, err
+	}
+	config.Version = version
+
+	switch p.config.RequiredAcks {
+	case "none":
+		config.Producer.RequiredAcks = sarama.NoResponse
+	case "leader":
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	case "all":
+		config.Producer.RequiredAcks = sarama.WaitForAll
 	}
 
-	p.logger.Infof("producer created with brokers %q", strings.Join(p.config.Brokers, ","))
-	return producer
+	if p.config.TransactionalID != "" {
+		if config.Producer.RequiredAcks != sarama.WaitForAll {
+			return nil, errors.New("transactions require required_acks to be all")
+		}
+		if !version.IsAtLeast(sarama.V0_11_0_0) {
+			return nil, errors.New("transactions require version to be at least 0.11.0")
+		}
+		// the transactional id is set by the workers
+		config.Producer.Idempotent = true
+		config.Producer.Transaction.Timeout = p.config.TransactionTimeout_
+		config.Net.MaxOpenRequests = 1
+	}
+
+	if p.config.Idempotent {
+		config.Producer.Idempotent = true
+		// the order of the retried messages is guaranteed only for the single in-flight request.
+		config.Net.MaxOpenRequests = 1
+	}
+
+	switch p.config.Compression {
+	case "gzip":
+		config.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		config.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		config.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		config.Producer.Compression = sarama.CompressionZSTD
+	}
+
+	if err := setSASL(config, p.config); err != nil {
+		return nil, err
+	}
+
+	if p.config.TLSEnabled {
+		b := tls.NewConfigBuilder()
+		if p.config.CACert != "" {
+			if err := b.AppendCARoot(p.config.CACert); err != nil {
+				return nil, fmt.Errorf("can't append CA root: %w", err)
+			}
+		}
+		if p.config.ClientCert != "" || p.config.ClientKey != "" {
+			if err := b.AppendX509KeyPair(p.config.ClientCert, p.config.ClientKey); err != nil {
+				return nil, fmt.Errorf("can't append client certificate: %w", err)
+			}
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = b.Build()
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type recordingProducer struct {
+	// the transactional methods aren't used
+	sarama.SyncProducer
+
+	messages []sarama.ProducerMessage
+}
+
+func (r *recordingProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, r.SendMessages([]*sarama.ProducerMessage{msg})
+}
+
+func (r *recordingProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	for _, msg := range msgs {
+		m := *msg
+		m.Headers = append([]sarama.RecordHeader(nil), msg.Headers...)
+		r.messages = append(r.messages, m)
+	}
+	return nil
+}
+
+func (r *recordingProducer) Close() error {
+	return nil
+}
+
+func TestMessageFields(t *testing.T) {
+	producer := &recordingProducer{}
+	p := &Plugin{
+		logger: zap.NewExample().Sugar(),
+		config: &Config{
+			DefaultTopic: "logs",
+			TopicFormat:  "logs-%-%",
+			BatchSize_:   4,
+			KeyField_:    []string{"trace", "id"},
+		},
+		avgEventSize:  16,
+		producer:      producer,
+		topicValues:   [][]string{cfg.ParseFieldSelector("tenant"), cfg.ParseFieldSelector("k8s.app")},
+		headersFields: [][]string{{"tenant"}, {"k8s", "app"}},
+		headersKeys:   [][]byte{[]byte("tenant"), []byte("app")},
+	}
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t,
+		`{"tenant":"shop","k8s":{"app":"api/v1"},"trace":{"id":"abc"}}`,
+		`{"tenant":"bank"}`,
+	))
+
+	assert.Len(t, producer.messages, 2)
+
+	first := producer.messages[0]
+	assert.Equal(t, "logs-shop-api_v1", first.Topic)
+	assert.Equal(t, sarama.ByteEncoder("abc"), first.Key)
+	assert.Equal(t, []sarama.RecordHeader{
+		{Key: []byte("tenant"), Value: []byte("shop")},
+		{Key: []byte("app"), Value: []byte("api/v1")},
+	}, first.Headers)
+
+	second := producer.messages[1]
+	assert.Equal(t, "logs-bank-"+pipeline.DefaultFieldValue, second.Topic)
+	assert.Nil(t, second.Key)
+	assert.Equal(t, []sarama.RecordHeader{{Key: []byte("tenant"), Value: []byte("bank")}}, second.Headers)
+}
@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	saslNone        = "none"
+	saslPlain       = "plain"
+	saslScramSHA256 = "scram-sha-256"
+	saslScramSHA512 = "scram-sha-512"
+	saslOAuthBearer = "oauthbearer"
+)
+
+// setSASL sets up the SASL authentication of the producer by the plugin config.
+func setSASL(config *sarama.Config, c *Config) error {
+	if c.SaslMechanism == saslNone {
+		return nil
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.User = c.SaslUsername
+	config.Net.SASL.Password = c.SaslPassword
+
+	switch c.SaslMechanism {
+	case saslPlain:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case saslScramSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA256}
+		}
+	case saslScramSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA512}
+		}
+	case saslOAuthBearer:
+		if c.SaslOAuthTokenURL == "" {
+			return errors.New("sasl_oauth_token_url isn't set")
+		}
+		config.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		config.Net.SASL.TokenProvider = newOAuthTokenProvider(c)
+	default:
+		return fmt.Errorf("unknown sasl mechanism %q", c.SaslMechanism)
+	}
+
+	return nil
+}
+
+// oauthTokenProvider gets the tokens by the OAuth 2.0 client credentials flow, the tokens are reused until they expire.
+type oauthTokenProvider struct {
+	tokenSource oauth2.TokenSource
+}
+
+func newOAuthTokenProvider(c *Config) *oauthTokenProvider {
+	credentials := &clientcredentials.Config{
+		ClientID:     c.SaslUsername,
+		ClientSecret: c.SaslPassword,
+		TokenURL:     c.SaslOAuthTokenURL,
+		Scopes:       c.SaslOAuthScopes,
+	}
+	return &oauthTokenProvider{tokenSource: credentials.TokenSource(context.Background())}
+}
+
+func (p *oauthTokenProvider) Token() (*sarama.AccessToken, error) {
+	token, err := p.tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("can't get oauth token: %w", err)
+	}
+	return &sarama.AccessToken{Token: token.AccessToken}, nil
+}
+
+// scramClient adapts the SCRAM client of xdg-go/scram to sarama, it implements RFC 5802 and RFC 7677.
+type scramClient struct {
+	hash scram.HashGeneratorFcn
+	// nonce is generated randomly if it's empty, it's fixed in the tests only
+	nonce string
+
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(username, password, authzID string) error {
+	client, err := c.hash.NewClient(username, password, authzID)
+	if err != nil {
+		return fmt.Errorf("can't create scram client: %w", err)
+	}
+	if c.nonce != "" {
+		client = client.WithNonceGenerator(func() string { return c.nonce })
+	}
+
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
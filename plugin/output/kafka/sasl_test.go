@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xdg-go/scram"
+)
+
+// TestScramClient checks the conversation examples of RFC 5802 and RFC 7677.
+func TestScramClient(t *testing.T) {
+	for name, tc := range map[string]struct {
+		hash        scram.HashGeneratorFcn
+		nonce       string
+		clientFirst string
+		serverFirst string
+		clientFinal string
+		serverFinal string
+	}{
+		"sha-1": {
+			hash:        scram.SHA1,
+			nonce:       "fyko+d2lbbFgONRv9qkxdawL",
+			clientFirst: "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+			serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+		"sha-256": {
+			hash:        scram.SHA256,
+			nonce:       "rOprNGfwEbeRWgbNEkqO",
+			clientFirst: "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+			serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := &scramClient{hash: tc.hash, nonce: tc.nonce}
+			require.NoError(t, c.Begin("user", "pencil", ""))
+
+			msg, err := c.Step("")
+			require.NoError(t, err)
+			assert.Equal(t, tc.clientFirst, msg)
+
+			msg, err = c.Step(tc.serverFirst)
+			require.NoError(t, err)
+			assert.Equal(t, tc.clientFinal, msg)
+			assert.False(t, c.Done())
+
+			_, err = c.Step(tc.serverFinal)
+			require.NoError(t, err)
+			assert.True(t, c.Done())
+			assert.True(t, c.conversation.Valid())
+		})
+	}
+}
+
+func TestScramClientErrors(t *testing.T) {
+	c := &scramClient{hash: scram.SHA256, nonce: "rOprNGfwEbeRWgbNEkqO"}
+	require.NoError(t, c.Begin("user", "pencil", ""))
+	_, _ = c.Step("")
+
+	_, err := c.Step("r=another,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.Error(t, err, "server nonce must start with the client one")
+
+	require.NoError(t, c.Begin("user", "pencil", ""))
+	_, _ = c.Step("")
+	_, err = c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.NoError(t, err)
+	_, err = c.Step("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	assert.Error(t, err, "wrong server signature")
+	assert.False(t, c.conversation.Valid())
+}
+
+func TestSaramaConfig(t *testing.T) {
+	newConfig := func(modify func(c *Config)) *Config {
+		c := &Config{Brokers: []string{"localhost:9092"}, DefaultTopic: "topic"}
+		modify(c)
+		test.NewConfig(c, map[string]int{"gomaxprocs": 1, "capacity": 64})
+		return c
+	}
+
+	for name, tc := range map[string]struct {
+		config *Config
+		ok     bool
+	}{
+		"default": {
+			config: newConfig(func(c *Config) {}),
+			ok:     true,
+		},
+		"idempotent": {
+			config: newConfig(func(c *Config) { c.Idempotent = true; c.RequiredAcks = "all" }),
+			ok:     true,
+		},
+		"idempotent without acks": {
+			config: newConfig(func(c *Config) { c.Idempotent = true }),
+		},
+		"transactional": {
+			config: newConfig(func(c *Config) { c.TransactionalID = "file.d"; c.RequiredAcks = "all" }),
+			ok:     true,
+		},
+		"transactional without acks": {
+			config: newConfig(func(c *Config) { c.TransactionalID = "file.d" }),
+		},
+		"transactional old version": {
+			config: newConfig(func(c *Config) { c.TransactionalID = "file.d"; c.RequiredAcks = "all"; c.Version = "0.10.0" }),
+		},
+		"zstd": {
+			config: newConfig(func(c *Config) { c.Compression = "zstd"; c.Version = "2.1.0" }),
+			ok:     true,
+		},
+		"zstd old version": {
+			config: newConfig(func(c *Config) { c.Compression = "zstd" }),
+		},
+		"bad version": {
+			config: newConfig(func(c *Config) { c.Version = "x" }),
+		},
+		"scram": {
+			config: newConfig(func(c *Config) { c.SaslMechanism = saslScramSHA512; c.SaslUsername = "u"; c.SaslPassword = "p" }),
+			ok:     true,
+		},
+		"oauth without token url": {
+			config: newConfig(func(c *Config) { c.SaslMechanism = saslOAuthBearer; c.Version = "2.0.0" }),
+		},
+		"tls": {
+			config: newConfig(func(c *Config) { c.TLSEnabled = true }),
+			ok:     true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := &Plugin{config: tc.config}
+			config, err := p.newSaramaConfig()
+			if !tc.ok {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			// the transactions require the idempotent producer
+			assert.Equal(t, tc.config.Idempotent || tc.config.TransactionalID != "", config.Producer.Idempotent)
+			if tc.config.TransactionalID != "" {
+				config.Producer.Transaction.ID = tc.config.TransactionalID + "-0"
+				assert.NoError(t, config.Validate())
+			}
+			assert.Equal(t, tc.config.TLSEnabled, config.Net.TLS.Enable)
+			assert.Equal(t, tc.config.SaslMechanism != saslNone, config.Net.SASL.Enable)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ozontech/file.d/avro"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/protoschema"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	encodingJSON     = "json"
+	encodingAvro     = "avro"
+	encodingProtobuf = "protobuf"
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+type SchemaRegistryConfig struct {
+	// > @3@4@5@6
+	// >
+	// > URL of the schema registry, e.g. `http://schema-registry:8081`.
+	URL string `json:"url" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The subject of the schema. If it isn't set, `<default_topic>-value` is used.
+	Subject string `json:"subject" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The schema to register in the subject. The registry returns the id of the existing schema if it's already registered.
+	// > If it isn't set, the latest schema of the subject is used.
+	// > For `protobuf` encoding the messages are always encoded by `proto_descriptor_set`.
+	Schema string `json:"schema" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Username of the basic authentication.
+	Username string `json:"username" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Password of the basic authentication.
+	Password string `json:"password" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of the schema registry requests.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"10s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Path to the file descriptor set of the protobuf schema made by `protoc --include_imports --descriptor_set_out`.
+	ProtoDescriptorSet string `json:"proto_descriptor_set" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The full name of the protobuf message of the events, e.g. `logs.v1.Event`.
+	ProtoMessage string `json:"proto_message" default:""` // *
+}
+
+// messageEncoder encodes the events to the message values.
+type messageEncoder interface {
+	encode(buf []byte, root *insaneJSON.Root) ([]byte, error)
+}
+
+// newMessageEncoder returns the encoder of the events by the schema of the registry.
+func newMessageEncoder(encoding, defaultTopic string, c *SchemaRegistryConfig) (messageEncoder, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("schema registry url isn't set")
+	}
+
+	subject := c.Subject
+	if subject == "" {
+		subject = defaultTopic + "-value"
+	}
+	registry := &schemaRegistry{
+		config: c,
+		client: &http.Client{Timeout: c.RequestTimeout_},
+	}
+
+	switch encoding {
+	case encodingAvro:
+		id, schema, err := registry.getSchema(subject, "AVRO", c.Schema)
+		if err != nil {
+			return nil, err
+		}
+		avroSchema, err := avro.ParseSchema(schema)
+		if err != nil {
+			return nil, err
+		}
+		return &avroEncoder{header: schemaHeader(id), schema: avroSchema}, nil
+	case encodingProtobuf:
+		desc, err := protoschema.LoadMessage(c.ProtoDescriptorSet, c.ProtoMessage)
+		if err != nil {
+			return nil, err
+		}
+		id, _, err := registry.getSchema(subject, "PROTOBUF", c.Schema)
+		if err != nil {
+			return nil, err
+		}
+		header := append(schemaHeader(id), protoMessageIndexes(desc)...)
+		return &protobufEncoder{header: header, desc: desc}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// schemaHeader returns the wire format header of the messages: the magic byte and the schema id.
+func schemaHeader(id int) []byte {
+	return binary.BigEndian.AppendUint32([]byte{0}, uint32(id))
+}
+
+type avroEncoder struct {
+	header []byte
+	schema *avro.Schema
+}
+
+func (e *avroEncoder) encode(buf []byte, root *insaneJSON.Root) ([]byte, error) {
+	return e.schema.Encode(append(buf, e.header...), root.Node)
+}
+
+type protobufEncoder struct {
+	header []byte
+	desc   protoreflect.MessageDescriptor
+}
+
+func (e *protobufEncoder) encode(buf []byte, root *insaneJSON.Root) ([]byte, error) {
+	message := dynamicpb.NewMessage(e.desc)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(root.Encode(nil), message); err != nil {
+		return buf, err
+	}
+	return proto.MarshalOptions{}.MarshalAppend(append(buf, e.header...), message)
+}
+
+// protoMessageIndexes returns the path of the message in the proto file encoded as the wire format requires.
+// The path of the first message of the file is encoded as the single zero.
+func protoMessageIndexes(desc protoreflect.MessageDescriptor) []byte {
+	var path []int
+	for d := protoreflect.Descriptor(desc); ; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		path = append([]int{d.Index()}, path...)
+	}
+
+	if len(path) == 1 && path[0] == 0 {
+		return []byte{0}
+	}
+	buf := binary.AppendVarint(nil, int64(len(path)))
+	for _, i := range path {
+		buf = binary.AppendVarint(buf, int64(i))
+	}
+	return buf
+}
+
+type schemaRegistry struct {
+	config *SchemaRegistryConfig
+	client *http.Client
+}
+
+type schemaResponse struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+// getSchema registers the schema if it's set or gets the latest schema of the subject.
+func (r *schemaRegistry) getSchema(subject, schemaType, schema string) (int, string, error) {
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if schema == "" {
+		resp, err := r.do(http.MethodGet, path+"/latest", nil)
+		if err != nil {
+			return 0, "", fmt.Errorf("can't get latest schema of subject %q: %w", subject, err)
+		}
+		return resp.ID, resp.Schema, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"schema": schema, "schemaType": schemaType})
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := r.do(http.MethodPost, path, body)
+	if err != nil {
+		return 0, "", fmt.Errorf("can't register schema of subject %q: %w", subject, err)
+	}
+	return resp.ID, schema, nil
+}
+
+func (r *schemaRegistry) do(method, path string, body []byte) (*schemaResponse, error) {
+	endpoint := strings.TrimSuffix(r.config.URL, "/") + path
+	req, err := http.NewRequestWithContext(context.Background(), method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("can't create request: %w", err)
+	}
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+	if r.config.Username != "" {
+		req.SetBasicAuth(r.config.Username, r.config.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("wrong response status %s: %s", resp.Status, string(b))
+	}
+
+	result := &schemaResponse{}
+	if err := json.Unmarshal(b, result); err != nil {
+		return nil, fmt.Errorf("can't decode response: %w", err)
+	}
+	return result, nil
+}
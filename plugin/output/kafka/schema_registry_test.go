@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func newTestSchemaRegistry(t *testing.T, latestSchema string) (*httptest.Server, *[]map[string]string) {
+	registered := &[]map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "secret", password)
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/subjects/logs-value/versions/latest":
+			b, _ := json.Marshal(map[string]any{"id": 7, "version": 1, "schema": latestSchema})
+			_, _ = w.Write(b)
+		case r.Method == http.MethodPost && r.URL.Path == "/subjects/custom/versions":
+			b, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			body := map[string]string{}
+			require.NoError(t, json.Unmarshal(b, &body))
+			*registered = append(*registered, body)
+			_, _ = w.Write([]byte(`{"id":9}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, registered
+}
+
+func TestAvroEncoder(t *testing.T) {
+	server, registered := newTestSchemaRegistry(t, `{"type":"record","name":"E","fields":[{"name":"message","type":"string"}]}`)
+	config := &SchemaRegistryConfig{URL: server.URL, Username: "user", Password: "secret"}
+
+	root, err := insaneJSON.DecodeString(`{"message":"hi"}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(root)
+
+	encoder, err := newMessageEncoder(encodingAvro, "logs", config)
+	require.NoError(t, err)
+	result, err := encoder.encode([]byte("prefix"), root)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{'p', 'r', 'e', 'f', 'i', 'x', 0, 0, 0, 0, 7, 4, 'h', 'i'}, result)
+
+	config.Subject = "custom"
+	config.Schema = `{"type":"record","name":"E","fields":[{"name":"message","type":"string"},{"name":"n","type":"int","default":1}]}`
+	encoder, err = newMessageEncoder(encodingAvro, "logs", config)
+	require.NoError(t, err)
+	result, err = encoder.encode(nil, root)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 9, 4, 'h', 'i', 2}, result)
+	assert.Equal(t, []map[string]string{{"schema": config.Schema, "schemaType": "AVRO"}}, *registered)
+
+	config.Subject = "unknown"
+	config.Schema = ""
+	_, err = newMessageEncoder(encodingAvro, "logs", config)
+	assert.Error(t, err)
+}
+
+func TestProtobufEncoder(t *testing.T) {
+	server, _ := newTestSchemaRegistry(t, `syntax = "proto3"; package logs; message Meta {} message Event { message Inner {} string message = 1; int64 code = 2; }`)
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("logs.proto"),
+		Package: proto.String("logs"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Meta")},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("message"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), JsonName: proto.String("message")},
+					{Name: proto.String("code"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), JsonName: proto.String("code")},
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{Name: proto.String("Inner")}},
+			},
+		},
+	}}}
+	b, err := proto.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "logs.desc")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	config := &SchemaRegistryConfig{URL: server.URL, Username: "user", Password: "secret", ProtoDescriptorSet: path, ProtoMessage: "logs.Event"}
+	encoder, err := newMessageEncoder(encodingProtobuf, "logs", config)
+	require.NoError(t, err)
+
+	root, err := insaneJSON.DecodeString(`{"message":"hi","code":3,"unknown":true}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(root)
+
+	result, err := encoder.encode(nil, root)
+	require.NoError(t, err)
+	// schema id 7, message indexes [1] and the fields, the order of the fields isn't stable
+	header := []byte{0, 0, 0, 0, 7, 2, 2}
+	require.Equal(t, header, result[:len(header)])
+	message := dynamicpb.NewMessage(encoder.(*protobufEncoder).desc)
+	require.NoError(t, proto.Unmarshal(result[len(header):], message))
+	fields := message.Descriptor().Fields()
+	assert.Equal(t, "hi", message.Get(fields.ByName("message")).String())
+	assert.Equal(t, int64(3), message.Get(fields.ByName("code")).Int())
+
+	config.ProtoMessage = "logs.Event.Inner"
+	encoder, err = newMessageEncoder(encodingProtobuf, "logs", config)
+	require.NoError(t, err)
+	result, err = encoder.encode(nil, root)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 7, 4, 2, 0}, result, "message indexes [1, 0]")
+}
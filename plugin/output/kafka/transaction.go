@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ozontech/file.d/pipeline"
+)
+
+// kafkaSourceName is the source name of the events read by the kafka input.
+const kafkaSourceName = "kafka"
+
+// newSyncProducer is replaced in the tests.
+var newSyncProducer = sarama.NewSyncProducer
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// newTxnProducer creates the transactional producer of the worker, it blocks until the producer is initialized.
+// Every worker has its own producer since a transactional id can't be used concurrently.
+func (p *Plugin) newTxnProducer(id string) sarama.SyncProducer {
+	config := *p.saramaConfig
+	config.Producer.Transaction.ID = id
+
+	for {
+		producer, err := newSyncProducer(p.config.Brokers, &config)
+		if err == nil {
+			p.txnMu.Lock()
+			p.txnProducers[id] = producer
+			p.txnMu.Unlock()
+			return producer
+		}
+
+		p.logger.Errorf("can't create transactional producer %s, next attempt in %s: %s", id, p.config.Retention_.String(), err.Error())
+		time.Sleep(p.config.Retention_)
+	}
+}
+
+// sendTransaction blocks until the messages and the offsets of the read events are committed in the transaction.
+func (p *Plugin) sendTransaction(data *data, batch *pipeline.Batch, messages []*sarama.ProducerMessage) {
+	offsets := p.transactionOffsets(batch)
+	for {
+		err := commitTransaction(data.txn, messages, offsets, p.config.TransactionConsumerGroup)
+		if err == nil {
+			return
+		}
+
+		p.sendErrorMetric.WithLabelValues().Add(float64(len(messages)))
+		p.logger.Errorf("can't write batch in transaction, next attempt in %s: %s", p.config.Retention_.String(), err.Error())
+		p.abortTransaction(data)
+		time.Sleep(p.config.Retention_)
+	}
+}
+
+// transactionOffsets returns the next offsets of the topic partitions of the events read by the kafka input.
+// The offsets of the dropped events are committed too, so they aren't read again.
+func (p *Plugin) transactionOffsets(batch *pipeline.Batch) map[string][]*sarama.PartitionOffsetMetadata {
+	if p.config.TransactionConsumerGroup == "" {
+		return nil
+	}
+
+	next := make(map[topicPartition]int64)
+	for _, event := range batch.Events {
+		if event.SourceName != kafkaSourceName {
+			continue
+		}
+		index, partition := disassembleSourceID(event.SourceID)
+		if index >= len(p.config.TransactionConsumerTopics) {
+			p.logger.Errorf("can't commit offset of event, topic index=%d isn't in transaction_consumer_topics", index)
+			continue
+		}
+
+		tp := topicPartition{topic: p.config.TransactionConsumerTopics[index], partition: partition}
+		if offset, ok := next[tp]; !ok || event.Offset+1 > offset {
+			next[tp] = event.Offset + 1
+		}
+	}
+
+	offsets := make(map[string][]*sarama.PartitionOffsetMetadata)
+	for tp, offset := range next {
+		offsets[tp.topic] = append(offsets[tp.topic], &sarama.PartitionOffsetMetadata{
+			Partition: tp.partition,
+			Offset:    offset,
+		})
+	}
+	return offsets
+}
+
+// commitTransaction writes the messages and commits the offsets of the consumer group in the single transaction.
+func commitTransaction(producer sarama.SyncProducer, messages []*sarama.ProducerMessage, offsets map[string][]*sarama.PartitionOffsetMetadata, group string) error {
+	if err := producer.BeginTxn(); err != nil {
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+	if len(messages) > 0 {
+		if err := producer.SendMessages(messages); err != nil {
+			return err
+		}
+	}
+	if len(offsets) > 0 {
+		if err := producer.AddOffsetsToTxn(offsets, group); err != nil {
+			return fmt.Errorf("can't add offsets to transaction: %w", err)
+		}
+	}
+	if err := producer.CommitTxn(); err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+	return nil
+}
+
+// abortTransaction aborts the failed transaction, so the batch is written again in the next one.
+// The producer is recreated if it's fenced by the newer producer with the same transactional id
+// or its epoch is invalid, since it can't be used anymore.
+func (p *Plugin) abortTransaction(data *data) {
+	status := data.txn.TxnStatus()
+	if status&sarama.ProducerTxnFlagFatalError == 0 && status&(sarama.ProducerTxnFlagInTransaction|sarama.ProducerTxnFlagAbortableError) != 0 {
+		if err := data.txn.AbortTxn(); err != nil {
+			p.logger.Errorf("can't abort transaction: %s", err.Error())
+		}
+		status = data.txn.TxnStatus()
+	}
+
+	if status&sarama.ProducerTxnFlagFatalError == 0 {
+		return
+	}
+
+	p.logger.Errorf("transactional producer %s is fenced, make sure transactional_id is unique among the file.d instances", data.txnID)
+	p.closeTxnProducer(data.txnID)
+	data.txn = p.newTxnProducer(data.txnID)
+}
+
+func (p *Plugin) closeTxnProducer(id string) {
+	p.txnMu.Lock()
+	producer := p.txnProducers[id]
+	delete(p.txnProducers, id)
+	p.txnMu.Unlock()
+
+	if producer == nil {
+		return
+	}
+	if err := producer.Close(); err != nil {
+		p.logger.Errorf("can't stop transactional producer %s: %s", id, err.Error())
+	}
+}
+
+// disassembleSourceID returns the index of the topic in the kafka input config and the partition of the event.
+func disassembleSourceID(sourceID pipeline.SourceID) (index int, partition int32) {
+	return int(sourceID >> 16), int32(sourceID & 0xFFFF)
+}
@@ -0,0 +1,194 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+// txnProducerMock commits the messages in the transactions and fails the sending with the errors.
+type txnProducerMock struct {
+	sarama.SyncProducer
+
+	id        string
+	errs      []error
+	status    sarama.ProducerTxnStatusFlag
+	pending   []string
+	offsets   map[string][]*sarama.PartitionOffsetMetadata
+	committed [][]string
+	aborts    int
+	closed    bool
+}
+
+func (m *txnProducerMock) BeginTxn() error {
+	m.status = sarama.ProducerTxnFlagInTransaction
+	m.pending = nil
+	m.offsets = nil
+	return nil
+}
+
+func (m *txnProducerMock) SendMessages(msgs []*sarama.ProducerMessage) error {
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		m.status = sarama.ProducerTxnFlagInError | sarama.ProducerTxnFlagAbortableError
+		if errors.Is(err, sarama.ErrProducerFenced) {
+			m.status = sarama.ProducerTxnFlagInError | sarama.ProducerTxnFlagFatalError
+		}
+		return err
+	}
+
+	for _, msg := range msgs {
+		m.pending = append(m.pending, string(msg.Value.(sarama.ByteEncoder)))
+	}
+	return nil
+}
+
+func (m *txnProducerMock) AddOffsetsToTxn(offsets map[string][]*sarama.PartitionOffsetMetadata, _ string) error {
+	m.offsets = offsets
+	return nil
+}
+
+func (m *txnProducerMock) CommitTxn() error {
+	m.committed = append(m.committed, m.pending)
+	m.status = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (m *txnProducerMock) AbortTxn() error {
+	m.aborts++
+	m.status = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (m *txnProducerMock) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return m.status
+}
+
+func (m *txnProducerMock) Close() error {
+	m.closed = true
+	return nil
+}
+
+// badEncoder fails to encode the events with the "bad" field.
+type badEncoder struct{}
+
+func (badEncoder) encode(buf []byte, root *insaneJSON.Root) ([]byte, error) {
+	if root.Dig("bad") != nil {
+		return buf, errors.New("bad event")
+	}
+	return root.Encode(buf), nil
+}
+
+func newTxnTestPlugin(t *testing.T, producers ...*txnProducerMock) *Plugin {
+	created := 0
+	newSyncProducer = func(_ []string, config *sarama.Config) (sarama.SyncProducer, error) {
+		require.Less(t, created, len(producers), "unexpected producer")
+		producer := producers[created]
+		producer.id = config.Producer.Transaction.ID
+		created++
+		return producer, nil
+	}
+	t.Cleanup(func() { newSyncProducer = sarama.NewSyncProducer })
+
+	p := &Plugin{
+		logger: zap.NewExample().Sugar(),
+		config: &Config{
+			DefaultTopic:              "logs",
+			BatchSize_:                4,
+			Retention_:                time.Millisecond,
+			TransactionalID:           "file.d",
+			TransactionConsumerGroup:  "group",
+			TransactionConsumerTopics: []string{"in-0", "in-1"},
+		},
+		avgEventSize: 16,
+		saramaConfig: sarama.NewConfig(),
+		txnProducers: make(map[string]sarama.SyncProducer),
+		encoder:      badEncoder{},
+	}
+	p.RegisterMetrics(metric.New("test"))
+	return p
+}
+
+func newKafkaTestBatch(t *testing.T, offset int64, events ...string) *pipeline.Batch {
+	batch := newTestBatch(t, events...)
+	for i, event := range batch.Events {
+		event.SourceName = kafkaSourceName
+		event.SourceID = pipeline.SourceID(1<<16 + 2)
+		event.Offset = offset + int64(i)
+	}
+	return batch
+}
+
+func TestTransactionSkipsDroppedEvents(t *testing.T) {
+	producer := &txnProducerMock{}
+	p := newTxnTestPlugin(t, producer)
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newKafkaTestBatch(t, 10, `{"a":1}`, `{"a":2}`, `{"a":3}`))
+	p.out(&workerData, newKafkaTestBatch(t, 13, `{"b":1}`, `{"bad":2}`, `{"b":3}`))
+
+	assert.Equal(t, [][]string{
+		{`{"a":1}`, `{"a":2}`, `{"a":3}`},
+		{`{"b":1}`, `{"b":3}`},
+	}, producer.committed, "messages of the previous batch aren't sent again")
+	require.Len(t, producer.offsets["in-1"], 1)
+	assert.Equal(t, int32(2), producer.offsets["in-1"][0].Partition)
+	assert.Equal(t, int64(16), producer.offsets["in-1"][0].Offset, "offset of the dropped event is committed too")
+	assert.Equal(t, "file.d-0", producer.id)
+}
+
+func TestTransactionAbort(t *testing.T) {
+	producer := &txnProducerMock{errs: []error{sarama.ErrNotLeaderForPartition}}
+	p := newTxnTestPlugin(t, producer)
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newKafkaTestBatch(t, 0, `{"a":1}`, `{"a":2}`))
+
+	assert.Equal(t, 1, producer.aborts)
+	assert.Equal(t, [][]string{{`{"a":1}`, `{"a":2}`}}, producer.committed)
+	assert.False(t, producer.closed)
+}
+
+func TestTransactionFenced(t *testing.T) {
+	fenced := &txnProducerMock{errs: []error{sarama.ErrProducerFenced}}
+	producer := &txnProducerMock{}
+	p := newTxnTestPlugin(t, fenced, producer)
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newKafkaTestBatch(t, 0, `{"a":1}`))
+
+	assert.True(t, fenced.closed, "fenced producer can't be used anymore")
+	assert.Equal(t, 0, fenced.aborts)
+	assert.Empty(t, fenced.committed)
+	assert.Equal(t, [][]string{{`{"a":1}`}}, producer.committed)
+	assert.Equal(t, fenced.id, producer.id, "producer is recreated with the same transactional id")
+	assert.Equal(t, map[string]sarama.SyncProducer{producer.id: producer}, p.txnProducers)
+}
+
+func TestTransactionOffsets(t *testing.T) {
+	p := newTxnTestPlugin(t)
+	batch := newKafkaTestBatch(t, 5, `{"a":1}`, `{"a":2}`)
+	other := newTestBatch(t, `{"a":3}`).Events[0]
+	other.SourceName = "file"
+	other.Offset = 100
+	unknown := newTestBatch(t, `{"a":4}`).Events[0]
+	unknown.SourceName = kafkaSourceName
+	unknown.SourceID = pipeline.SourceID(5 << 16)
+	batch.Events = append(batch.Events, other, unknown)
+
+	offsets := p.transactionOffsets(batch)
+	require.Len(t, offsets, 1, "only events of the known kafka topics are committed")
+	assert.Equal(t, int64(7), offsets["in-1"][0].Offset)
+
+	p.config.TransactionConsumerGroup = ""
+	assert.Nil(t, p.transactionOffsets(batch))
+}
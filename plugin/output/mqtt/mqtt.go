@@ -0,0 +1,427 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/tls"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It publishes events to an MQTT broker, e.g. to push processed events back to IoT devices.
+
+The topic of each event is built from the event fields with `topic_format` and `topic_values`.
+With `qos: 1` events are committed to the input plugin only after the broker has acknowledged them,
+events which weren't acknowledged are republished after `retention`.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: mqtt
+      brokers: [tcp://mosquitto:1883]
+      topic_format: devices/%/events
+      topic_values: [device_id]
+      qos: 1
+```
+}*/
+
+const (
+	outPluginType = "mqtt"
+)
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.SugaredLogger
+	batcher    *pipeline.Batcher
+	controller pipeline.OutputPluginController
+
+	client      paho.Client
+	connMu      *sync.Mutex
+	topicValues [][]string
+	time        string
+	mu          *sync.Mutex
+
+	// plugin metrics
+
+	sendErrorMetric *prometheus.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > The list of the broker URLs, `tcp://`, `ssl://` and `ws://` schemes are supported.
+	// > The next broker is used if the current one isn't available.
+	Brokers []string `json:"brokers" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > MQTT client identifier, it must be unique across the clients of the broker.
+	// > `file.d-<hostname>-<pipeline name>` is used if it's empty.
+	ClientID string `json:"client_id"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Username for the authentication.
+	Username string `json:"username"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Password for the authentication.
+	Password string `json:"password"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA file for `ssl://` scheme.
+	CACert string `json:"ca_cert"` // *
+
+	// > @3@4@5@6
+	// >
+	// > It defines the pattern of the topic. Use `%` character as a placeholder. Use `topic_values` to define values for the replacement.
+	// > E.g. if `topic_format="devices/%/events"` and `topic_values="device_id"` and event is `{"device_id"="sensor-1"}`
+	// > then the topic for that event will be `devices/sensor-1/events`.
+	// > Wildcard characters `+` and `#` of the values are replaced with `_`.
+	TopicFormat string `json:"topic_format" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A list of event fields which will be used for replacement `topic_format`.
+	// > There is a special field `@@time` which equals the current time. Use the `time_format` to define a time format.
+	TopicValues []string `json:"topic_values" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The time format pattern to use as value for the `@@time` placeholder.
+	// > > Check out [func Parse doc](https://golang.org/pkg/time/#Parse) for details.
+	TimeFormat string `json:"time_format" default:"2006-01-02"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Quality of service level: `0` – at most once, `1` – at least once.
+	QoS int `json:"qos" default:"0"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the broker keeps the last event of the topic and sends it to the new subscribers.
+	Retained bool `json:"retained"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Interval of the keep alive pings.
+	KeepAlive  cfg.Duration `json:"keep_alive" default:"30s" parse:"duration"` // *
+	KeepAlive_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of connecting to the broker and waiting for the acknowledgements.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"10s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Retention between attempts to republish events which weren't acknowledged.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > A minimum size of events in a batch to send.
+	// > If both batch_size and batch_size_bytes are set, they will work together.
+	BatchSizeBytes  cfg.Expression `json:"batch_size_bytes" default:"0" parse:"expression"` // *
+	BatchSizeBytes_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+// message is an event to publish.
+type message struct {
+	topic   string
+	start   int
+	end     int
+	payload []byte
+	token   paho.Token
+}
+
+// data is a state of the worker.
+type data struct {
+	messages []*message
+	buf      []byte
+	topicBuf []byte
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.config = config.(*Config)
+
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+	if p.config.QoS != 0 && p.config.QoS != 1 {
+		p.logger.Fatalf("'qos' must be 0 or 1, got %d", p.config.QoS)
+	}
+	if strings.Count(p.config.TopicFormat, "%") != len(p.config.TopicValues) {
+		p.logger.Fatal("count of placeholders and values isn't match, check topic_format/topic_values config params")
+	}
+
+	if p.config.ClientID == "" {
+		hostname, _ := os.Hostname()
+		p.config.ClientID = fmt.Sprintf("file.d-%s-%s", hostname, params.PipelineName)
+	}
+
+	if err := p.init(); err != nil {
+		p.logger.Fatal(err.Error())
+	}
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		MaintenanceFn:  p.maintenance,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		BatchSizeBytes: p.config.BatchSizeBytes_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) init() error {
+	p.mu = &sync.Mutex{}
+	p.connMu = &sync.Mutex{}
+	p.time = time.Now().Format(p.config.TimeFormat)
+
+	p.topicValues = make([][]string, 0, len(p.config.TopicValues))
+	for _, value := range p.config.TopicValues {
+		p.topicValues = append(p.topicValues, cfg.ParseFieldSelector(value))
+	}
+
+	opts := paho.NewClientOptions()
+	for _, broker := range p.config.Brokers {
+		opts.AddBroker(broker)
+	}
+	opts.SetClientID(p.config.ClientID)
+	opts.SetUsername(p.config.Username)
+	opts.SetPassword(p.config.Password)
+	opts.SetKeepAlive(p.config.KeepAlive_)
+	opts.SetConnectTimeout(p.config.RequestTimeout_)
+	opts.SetWriteTimeout(p.config.RequestTimeout_)
+	opts.SetCleanSession(true)
+	opts.SetOrderMatters(false)
+	// the client completes the tokens of the pending messages without errors on resuming after the reconnect,
+	// so the plugin reconnects itself and republishes the messages which weren't acknowledged
+	opts.SetAutoReconnect(false)
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		p.logger.Errorf("connection to MQTT broker is lost: %s", err.Error())
+	})
+	if p.config.CACert != "" {
+		b := tls.NewConfigBuilder()
+		if err := b.AppendCARoot(p.config.CACert); err != nil {
+			return err
+		}
+		opts.SetTLSConfig(b.Build())
+	}
+
+	p.client = paho.NewClient(opts)
+	// the connection is retried on publishing if the broker isn't available now
+	if err := p.connect(); err != nil {
+		p.logger.Errorf("can't connect to MQTT broker: %s", err.Error())
+	}
+
+	return nil
+}
+
+// connect connects to the broker, the workers share the client, so only one of them connects.
+func (p *Plugin) connect() error {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	if p.client.IsConnected() {
+		return nil
+	}
+
+	token := p.client.Connect()
+	if !token.WaitTimeout(p.config.RequestTimeout_) {
+		return fmt.Errorf("connection timeout")
+	}
+	return token.Error()
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_mqtt_send_error", "Total MQTT send errors")
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+	p.client.Disconnect(uint(p.config.RequestTimeout_.Milliseconds()))
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{}
+	}
+
+	data := (*workerData).(*data)
+	data.messages = data.messages[:0]
+	data.buf = data.buf[:0]
+
+	for _, event := range batch.Events {
+		data.topicBuf = p.appendTopic(data.topicBuf[:0], event)
+		start := len(data.buf)
+		data.buf = event.Root.Encode(data.buf)
+		data.messages = append(data.messages, &message{
+			topic: string(data.topicBuf),
+			start: start,
+			end:   len(data.buf),
+		})
+	}
+	// payloads are sliced after the buffer is built since it may be reallocated
+	for _, m := range data.messages {
+		m.payload = data.buf[m.start:m.end]
+	}
+
+	pending := data.messages
+	for {
+		failed, err := p.publish(pending)
+		if len(failed) == 0 {
+			break
+		}
+
+		p.sendErrorMetric.WithLabelValues().Add(float64(len(failed)))
+		p.logger.Errorf("can't publish %d events to MQTT, next attempt in %s: %s", len(failed), p.config.Retention_.String(), err.Error())
+		pending = failed
+		time.Sleep(p.config.Retention_)
+	}
+}
+
+// publish publishes the messages and waits for the acknowledgements,
+// it returns the messages which weren't acknowledged.
+func (p *Plugin) publish(messages []*message) ([]*message, error) {
+	if !p.client.IsConnected() {
+		if err := p.connect(); err != nil {
+			return messages, fmt.Errorf("can't connect: %w", err)
+		}
+	}
+
+	for _, m := range messages {
+		m.token = p.client.Publish(m.topic, byte(p.config.QoS), p.config.Retained, m.payload)
+	}
+
+	var lastErr error
+	failed := messages[:0]
+	deadline := time.Now().Add(p.config.RequestTimeout_)
+	for _, m := range messages {
+		err := waitToken(m.token, time.Until(deadline))
+		if err != nil {
+			lastErr = err
+			failed = append(failed, m)
+		}
+	}
+
+	return failed, lastErr
+}
+
+func waitToken(token paho.Token, timeout time.Duration) error {
+	if timeout < 0 {
+		timeout = 0
+	}
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("acknowledgement timeout")
+	}
+	return token.Error()
+}
+
+func (p *Plugin) appendTopic(buf []byte, event *pipeline.Event) []byte {
+	replacements := 0
+	for _, c := range pipeline.StringToByteUnsafe(p.config.TopicFormat) {
+		if c != '%' {
+			buf = append(buf, c)
+			continue
+		}
+
+		value := p.topicValues[replacements]
+		replacements++
+
+		if len(value) == 1 && value[0] == "@time" {
+			p.mu.Lock()
+			buf = append(buf, p.time...)
+			p.mu.Unlock()
+			continue
+		}
+
+		node := event.Root.Dig(value...)
+		if node == nil {
+			buf = append(buf, pipeline.DefaultFieldValue...)
+			continue
+		}
+		buf = appendTopicLevel(buf, node.AsString())
+	}
+
+	return buf
+}
+
+// appendTopicLevel appends the value replacing the wildcards which aren't allowed in the topic names of the published messages.
+func appendTopicLevel(buf []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '+' || c == '#' || c == 0 {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+func (p *Plugin) maintenance(_ *pipeline.WorkerData) {
+	p.mu.Lock()
+	p.time = time.Now().Format(p.config.TimeFormat)
+	p.mu.Unlock()
+}
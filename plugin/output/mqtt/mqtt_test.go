@@ -0,0 +1,224 @@
+package mqtt
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+type publishedMessage struct {
+	topic    string
+	payload  string
+	qos      byte
+	retained bool
+}
+
+// fakeBroker implements the part of MQTT 3.1.1 used by the publisher.
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu sync.Mutex
+	// the count of the connections to drop on the first publish
+	dropConns int
+	connects  int
+	published []publishedMessage
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &fakeBroker{t: t, listener: listener}
+	go b.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(c)
+	}
+}
+
+func (b *fakeBroker) handle(c net.Conn) {
+	defer c.Close()
+
+	for {
+		packet, err := packets.ReadPacket(c)
+		if err != nil {
+			return
+		}
+
+		var resp packets.ControlPacket
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.connects++
+			b.mu.Unlock()
+			if p.Username != "user" || string(p.Password) != "secret" {
+				connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+				connack.ReturnCode = packets.ErrRefusedNotAuthorised
+				_ = connack.Write(c)
+				return
+			}
+			resp = packets.NewControlPacket(packets.Connack)
+		case *packets.PublishPacket:
+			b.mu.Lock()
+			drop := b.dropConns > 0
+			if drop {
+				b.dropConns--
+			} else {
+				b.published = append(b.published, publishedMessage{
+					topic:    p.TopicName,
+					payload:  string(p.Payload),
+					qos:      p.Qos,
+					retained: p.Retain,
+				})
+			}
+			b.mu.Unlock()
+			if drop {
+				return
+			}
+
+			if p.Qos == 1 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				resp = puback
+			}
+		case *packets.PingreqPacket:
+			resp = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+
+		if resp != nil {
+			if err := resp.Write(c); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// messages returns unique published messages sorted by the payload, QoS 1 messages can be duplicated.
+func (b *fakeBroker) messages() []publishedMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	unique := make(map[publishedMessage]bool)
+	result := make([]publishedMessage, 0, len(b.published))
+	for _, m := range b.published {
+		if !unique[m] {
+			unique[m] = true
+			result = append(result, m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].payload < result[j].payload })
+
+	return result
+}
+
+func newTestPlugin(t *testing.T, config *Config) *Plugin {
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1, "capacity": 64})
+	config.ClientID = "test"
+	config.Username = "user"
+	config.Password = "secret"
+
+	p := &Plugin{
+		config: config,
+		logger: zap.NewExample().Sugar(),
+	}
+	p.RegisterMetrics(metric.New("test"))
+	require.NoError(t, p.init())
+	t.Cleanup(func() { p.client.Disconnect(0) })
+
+	return p
+}
+
+func newTestBatch(t *testing.T, events ...string) *pipeline.Batch {
+	batch := &pipeline.Batch{}
+	for _, e := range events {
+		root, err := insaneJSON.DecodeString(e)
+		require.NoError(t, err)
+		t.Cleanup(func() { insaneJSON.Release(root) })
+		batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+	}
+	return batch
+}
+
+func TestPublish(t *testing.T) {
+	for _, qos := range []int{0, 1} {
+		broker := newFakeBroker(t)
+		p := newTestPlugin(t, &Config{
+			Brokers:     []string{broker.url()},
+			TopicFormat: "devices/%/events",
+			TopicValues: []string{"device.id"},
+			QoS:         qos,
+			Retained:    true,
+		})
+
+		workerData := pipeline.WorkerData(nil)
+		p.out(&workerData, newTestBatch(t,
+			`{"device":{"id":"sensor-1"},"temp":20}`,
+			`{"device":{"id":"sensor/+#"},"temp":21}`,
+			`{"temp":22}`,
+		))
+
+		// QoS 0 messages are acknowledged once they are written, so wait for the broker to read them
+		require.Eventually(t, func() bool {
+			return len(broker.messages()) == 3
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []publishedMessage{
+			{topic: "devices/sensor-1/events", payload: `{"device":{"id":"sensor-1"},"temp":20}`, qos: byte(qos), retained: true},
+			{topic: "devices/sensor/__/events", payload: `{"device":{"id":"sensor/+#"},"temp":21}`, qos: byte(qos), retained: true},
+			{topic: "devices/not_set/events", payload: `{"temp":22}`, qos: byte(qos), retained: true},
+		}, broker.messages())
+	}
+}
+
+func TestRepublish(t *testing.T) {
+	broker := newFakeBroker(t)
+	broker.dropConns = 1
+	p := newTestPlugin(t, &Config{
+		Brokers:        []string{broker.url()},
+		TopicFormat:    "events",
+		QoS:            1,
+		RequestTimeout: "200ms",
+		Retention:      "10ms",
+	})
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t, `{"a":1}`, `{"a":2}`))
+
+	assert.Equal(t, []publishedMessage{
+		{topic: "events", payload: `{"a":1}`, qos: 1},
+		{topic: "events", payload: `{"a":2}`, qos: 1},
+	}, broker.messages())
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	assert.GreaterOrEqual(t, broker.connects, 2, "client is reconnected")
+}
+
+func TestAppendTopicLevel(t *testing.T) {
+	assert.Equal(t, "a/b_c_d_", string(appendTopicLevel(nil, "a/b+c#d\x00")))
+}
@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	partitionIntervalNone    = "none"
+	partitionIntervalDaily   = "daily"
+	partitionIntervalMonthly = "monthly"
+
+	partitionsCheckInterval = time.Hour
+
+	partitionBoundFormat = "2006-01-02 15:04:05Z07:00"
+)
+
+// partitionManager creates the time-based partitions of the table ahead of writes and drops the expired ones.
+type partitionManager struct {
+	pool      PgxIface
+	logger    *zap.SugaredLogger
+	table     string
+	interval  string
+	premake   int
+	retention time.Duration
+	timeout   time.Duration
+}
+
+// run manages the partitions every partitionsCheckInterval until ctx is done.
+func (m *partitionManager) run(ctx context.Context) {
+	ticker := time.NewTicker(partitionsCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.manage(ctx, time.Now()); err != nil {
+				m.logger.Errorf("can't manage partitions of %s: %s", m.table, err.Error())
+			}
+		}
+	}
+}
+
+// manage creates the current partition along with premake next ones and drops the partitions
+// which range ends earlier than the retention.
+func (m *partitionManager) manage(ctx context.Context, now time.Time) error {
+	start := m.truncate(now.UTC())
+	for i := 0; i <= m.premake; i++ {
+		from := m.next(start, i)
+		to := m.next(from, 1)
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			m.partitionName(from), m.table, from.Format(partitionBoundFormat), to.Format(partitionBoundFormat))
+		if err := m.exec(ctx, query); err != nil {
+			return fmt.Errorf("can't create partition: %w", err)
+		}
+	}
+
+	if m.retention == 0 {
+		return nil
+	}
+
+	partitions, err := m.listPartitions(ctx)
+	if err != nil {
+		return fmt.Errorf("can't list partitions: %w", err)
+	}
+
+	expiration := now.Add(-m.retention)
+	for _, partition := range partitions {
+		from, ok := m.parsePartitionName(partition)
+		if !ok || !m.next(from, 1).Before(expiration) {
+			continue
+		}
+
+		if err := m.exec(ctx, "DROP TABLE IF EXISTS "+m.schemaPrefix()+partition); err != nil {
+			return fmt.Errorf("can't drop partition %s: %w", partition, err)
+		}
+		m.logger.Infof("partition %s is dropped", partition)
+	}
+
+	return nil
+}
+
+func (m *partitionManager) truncate(t time.Time) time.Time {
+	if m.interval == partitionIntervalMonthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// next returns the start of the n-th partition after the partition starting at t.
+func (m *partitionManager) next(t time.Time, n int) time.Time {
+	if m.interval == partitionIntervalMonthly {
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+func (m *partitionManager) layout() string {
+	if m.interval == partitionIntervalMonthly {
+		return "200601"
+	}
+	return "20060102"
+}
+
+// partitionName returns the schema qualified name of the partition starting at t.
+func (m *partitionManager) partitionName(t time.Time) string {
+	return m.table + "_p" + t.Format(m.layout())
+}
+
+// parsePartitionName returns the start of the partition by its name without the schema.
+// It returns false if the partition isn't created by the manager.
+func (m *partitionManager) parsePartitionName(name string) (time.Time, bool) {
+	prefix := strings.TrimPrefix(m.table, m.schemaPrefix()) + "_p"
+	if !strings.HasPrefix(name, prefix) {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(m.layout(), name[len(prefix):])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// schemaPrefix returns the schema of the table with the dot or the empty string if the table isn't schema qualified.
+func (m *partitionManager) schemaPrefix() string {
+	if i := strings.LastIndexByte(m.table, '.'); i != -1 {
+		return m.table[:i+1]
+	}
+	return ""
+}
+
+// listPartitions returns the partition names of the table without the schema.
+func (m *partitionManager) listPartitions(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	rows, err := m.pool.Query(ctx, "SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = $1::regclass", preferSimpleProtocol, m.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, name)
+	}
+
+	return partitions, rows.Err()
+}
+
+func (m *partitionManager) exec(ctx context.Context, query string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	rows, err := m.pool.Query(ctx, query, preferSimpleProtocol)
+	if err != nil {
+		return err
+	}
+	rows.Close()
+
+	return rows.Err()
+}
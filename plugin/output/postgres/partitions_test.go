@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/ozontech/file.d/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// partitionsPool records the queries and returns the partitions on listing.
+type partitionsPool struct {
+	queries    []string
+	partitions []string
+}
+
+func (p *partitionsPool) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	p.queries = append(p.queries, sql)
+	if len(p.partitions) > 0 && strings.HasPrefix(sql, "SELECT") {
+		return &partitionRows{names: p.partitions}, nil
+	}
+	return &rowsForTest{}, nil
+}
+
+func (p *partitionsPool) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, nil
+}
+
+func (p *partitionsPool) Close() {}
+
+type partitionRows struct {
+	rowsForTest
+	names []string
+	cur   string
+}
+
+func (r *partitionRows) Next() bool {
+	if len(r.names) == 0 {
+		return false
+	}
+	r.cur, r.names = r.names[0], r.names[1:]
+	return true
+}
+
+func (r *partitionRows) Scan(dest ...any) error {
+	*dest[0].(*string) = r.cur
+	return nil
+}
+
+func TestPartitionManager(t *testing.T) {
+	now := time.Date(2023, 12, 30, 15, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		table      string
+		interval   string
+		retention  time.Duration
+		partitions []string
+		queries    []string
+	}{
+		{
+			name:     "daily",
+			table:    "logs",
+			interval: partitionIntervalDaily,
+			queries: []string{
+				"CREATE TABLE IF NOT EXISTS logs_p20231230 PARTITION OF logs FOR VALUES FROM ('2023-12-30 00:00:00Z') TO ('2023-12-31 00:00:00Z')",
+				"CREATE TABLE IF NOT EXISTS logs_p20231231 PARTITION OF logs FOR VALUES FROM ('2023-12-31 00:00:00Z') TO ('2024-01-01 00:00:00Z')",
+				"CREATE TABLE IF NOT EXISTS logs_p20240101 PARTITION OF logs FOR VALUES FROM ('2024-01-01 00:00:00Z') TO ('2024-01-02 00:00:00Z')",
+			},
+		},
+		{
+			name:      "monthly_retention",
+			table:     "public.logs",
+			interval:  partitionIntervalMonthly,
+			retention: 30 * 24 * time.Hour,
+			partitions: []string{
+				"logs_p202310",
+				"logs_p202311",
+				"logs_p202312",
+				"logs_default",
+				"logs_p2023",
+			},
+			queries: []string{
+				"CREATE TABLE IF NOT EXISTS public.logs_p202312 PARTITION OF public.logs FOR VALUES FROM ('2023-12-01 00:00:00Z') TO ('2024-01-01 00:00:00Z')",
+				"CREATE TABLE IF NOT EXISTS public.logs_p202401 PARTITION OF public.logs FOR VALUES FROM ('2024-01-01 00:00:00Z') TO ('2024-02-01 00:00:00Z')",
+				"CREATE TABLE IF NOT EXISTS public.logs_p202402 PARTITION OF public.logs FOR VALUES FROM ('2024-02-01 00:00:00Z') TO ('2024-03-01 00:00:00Z')",
+				"SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = $1::regclass",
+				"DROP TABLE IF EXISTS public.logs_p202310",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := &partitionsPool{partitions: tc.partitions}
+			m := &partitionManager{
+				pool:      pool,
+				logger:    logger.Instance,
+				table:     tc.table,
+				interval:  tc.interval,
+				premake:   2,
+				retention: tc.retention,
+				timeout:   time.Second,
+			}
+
+			require.NoError(t, m.manage(context.Background(), now))
+			require.Equal(t, tc.queries, pool.queries)
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
@@ -21,6 +23,11 @@ import (
 
 /*{ introduction
 It sends the event batches to postgres db using pgx.
+
+Large batches can be written with `COPY ... FROM STDIN` binary protocol instead of multi-row INSERT queries, see `insert_mode`.
+
+The plugin can manage daily or monthly partitions of the table, see `partition_interval`.
+The partitions are checked every hour: the missing ones are created ahead of writes and the expired ones are dropped.
 }*/
 
 var (
@@ -31,6 +38,7 @@ var (
 
 type PgxIface interface {
 	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
 	Close()
 }
 
@@ -41,6 +49,9 @@ const (
 	preferSimpleProtocol = pgx.QuerySimpleProtocol(true)
 
 	nineThousandYear = 221842627200
+
+	insertModeInsert = "insert"
+	insertModeCopy   = "copy"
 )
 
 type pgType int
@@ -69,6 +80,7 @@ type Plugin struct {
 
 	queryBuilder PgQueryBuilder
 	pool         PgxIface
+	partitionsWg sync.WaitGroup
 
 	// plugin metrics
 
@@ -81,6 +93,8 @@ type ConfigColumn struct {
 	Name       string `json:"name" required:"true"`
 	ColumnType string `json:"type" required:"true" options:"int|string|bool|timestamp"`
 	Unique     bool   `json:"unique" default:"false"`
+	// OnConflict defines if the not unique column is updated with the inserted value on conflict.
+	OnConflict string `json:"on_conflict" default:"update" options:"update|keep"`
 }
 
 // ! config-params
@@ -111,11 +125,62 @@ type Config struct {
 	// > Array of DB columns. Each column have:
 	// > name, type (int, string, timestamp - which int that will be converted to timestamptz of rfc3339)
 	// > and nullable options.
+	// >
+	// > The `unique` columns are the default conflict target, the events are deduplicated by them in the batch.
+	// > The `on_conflict` option of the column is `update` to set the inserted value on conflict, or `keep` to leave the stored one.
 	Columns []ConfigColumn `json:"columns" required:"true" slice:"true"` // *
 
 	// > @3@4@5@6
 	// >
-	// > Retries of insertion.
+	// > The conflict target of `ON CONFLICT` clause, e.g. `(user_id, day)` or `ON CONSTRAINT stats_pkey`.
+	// > The unique columns are used if it's empty.
+	// > > The batch mustn't contain the events conflicting with each other, so set the unique columns to deduplicate them.
+	ConflictTarget string `json:"conflict_target"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The action on conflict:
+	// > * `update` runs `DO UPDATE SET` of the not unique columns with `on_conflict: update`; `DO NOTHING` is used if there are no such columns
+	// > * `nothing` runs `DO NOTHING`, so the re-delivered events are skipped
+	OnConflict string `json:"on_conflict" default:"update" options:"update|nothing"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The way to write the batches:
+	// > * `insert` uses multi-row INSERT queries
+	// > * `copy` uses `COPY ... FROM STDIN` binary protocol for the batches of at least `copy_min_batch_size` events
+	// >
+	// > > COPY can't resolve the conflicts, so the `copy` mode can't be used with unique columns or `conflict_target`.
+	InsertMode string `json:"insert_mode" default:"insert" options:"insert|copy"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The smaller batches are written with INSERT queries in the `copy` mode.
+	CopyMinBatchSize int `json:"copy_min_batch_size" default:"1000"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Interval of the partitions managed by file.d, `none` disables the management.
+	// > The table must be partitioned by range of a `timestamptz` column.
+	// > The partitions are named `<table>_pYYYYMMDD` for `daily` interval and `<table>_pYYYYMM` for `monthly` one, the bounds are in UTC.
+	PartitionInterval string `json:"partition_interval" default:"none" options:"none|daily|monthly"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How many partitions are created ahead of the current one.
+	PartitionPremake int `json:"partition_premake" default:"3"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How long the partitions are kept after their range ends, zero means they are never dropped.
+	// > Only the partitions named by file.d are dropped.
+	PartitionRetention  cfg.Duration `json:"partition_retention" default:"0s" parse:"duration"` // *
+	PartitionRetention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Retries of insertion, file.d crashes after all of them fail
+	// > unless the output has the [fallback output](/docs/configuring.md#fallback-output).
 	Retry int `json:"retry" default:"3"` // *
 
 	// > @3@4@5@6
@@ -202,11 +267,14 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 		p.logger.Fatal("'db_health_check_period' can't be <1")
 	}
 
-	queryBuilder, err := NewQueryBuilder(p.config.Columns, p.config.Table)
+	queryBuilder, err := NewQueryBuilder(p.config.Columns, p.config.Table, p.config.ConflictTarget, p.config.OnConflict)
 	if err != nil {
 		p.logger.Fatal(err)
 	}
 	p.queryBuilder = queryBuilder
+	if p.config.InsertMode == insertModeCopy && queryBuilder.GetPostfix() != "" {
+		p.logger.Fatal("'insert_mode' can't be 'copy' with conflict resolution")
+	}
 
 	pgCfg, err := p.parsePGConfig()
 	if err != nil {
@@ -234,15 +302,45 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 	p.ctx = ctx
 	p.cancelFunc = cancel
 
+	if p.config.PartitionInterval != partitionIntervalNone {
+		p.startPartitionManager()
+	}
+
 	p.batcher.Start(ctx)
 }
 
 func (p *Plugin) Stop() {
 	p.cancelFunc()
 	p.batcher.Stop()
+	p.partitionsWg.Wait()
 	p.pool.Close()
 }
 
+func (p *Plugin) startPartitionManager() {
+	if p.config.PartitionPremake < 0 {
+		p.logger.Fatal("'partition_premake' can't be <0")
+	}
+
+	manager := &partitionManager{
+		pool:      p.pool,
+		logger:    p.logger,
+		table:     p.config.Table,
+		interval:  p.config.PartitionInterval,
+		premake:   p.config.PartitionPremake,
+		retention: p.config.PartitionRetention_,
+		timeout:   p.config.DBRequestTimeout_,
+	}
+	if err := manager.manage(p.ctx, time.Now()); err != nil {
+		p.logger.Fatalf("can't manage partitions of %s: %s", p.config.Table, err.Error())
+	}
+
+	p.partitionsWg.Add(1)
+	go func() {
+		defer p.partitionsWg.Done()
+		manager.run(p.ctx)
+	}()
+}
+
 func (p *Plugin) Out(event *pipeline.Event) {
 	p.batcher.Add(event)
 }
@@ -256,6 +354,7 @@ func (p *Plugin) out(_ *pipeline.WorkerData, batch *pipeline.Batch) {
 
 	// Deduplicate events, pg can't do upsert with duplication.
 	uniqueEventsMap := make(map[string]struct{}, len(batch.Events))
+	rows := make([][]any, 0, len(batch.Events))
 
 	for _, event := range batch.Events {
 		fieldValues, uniqueID, err := p.processEvent(event, pgFields, uniqFields)
@@ -286,47 +385,77 @@ func (p *Plugin) out(_ *pipeline.WorkerData, batch *pipeline.Batch) {
 		}
 
 		// passes here only if event valid.
-		if _, ok := uniqueEventsMap[uniqueID]; ok {
-			p.duplicatedEventMetric.WithLabelValues().Inc()
-			p.logger.Infof("event duplicated. Fields: %v, values: %v", pgFields, fieldValues)
-		} else {
+		if len(uniqFields) > 0 {
+			if _, ok := uniqueEventsMap[uniqueID]; ok {
+				p.duplicatedEventMetric.WithLabelValues().Inc()
+				p.logger.Infof("event duplicated. Fields: %v, values: %v", pgFields, fieldValues)
+				continue
+			}
 			uniqueEventsMap[uniqueID] = struct{}{}
-			builder = builder.Values(fieldValues...)
 		}
+		rows = append(rows, fieldValues)
 	}
 
-	builder = builder.Suffix(p.queryBuilder.GetPostfix()).PlaceholderFormat(sq.Dollar)
-
 	// no valid events passed.
-	if len(uniqueEventsMap) == 0 {
+	if len(rows) == 0 {
 		return
 	}
 
-	query, args, err := builder.ToSql()
-	if err != nil {
-		p.logger.Fatalf("Invalid SQL. query: %s, args: %v, err: %v", query, args, err)
-	}
+	var (
+		query string
+		args  []any
+		write func() error
+	)
+	if p.config.InsertMode == insertModeCopy && len(rows) >= p.config.CopyMinBatchSize {
+		query = fmt.Sprintf("COPY %s FROM STDIN", p.config.Table)
+		err := p.prepareCopyRows(pgFields, rows)
+		if err != nil {
+			p.logger.Fatalf("can't prepare rows for COPY: %v", err)
+		}
+		write = func() error {
+			return p.copy(pgFields, rows)
+		}
+	} else {
+		for _, row := range rows {
+			builder = builder.Values(row...)
+		}
+		builder = builder.Suffix(p.queryBuilder.GetPostfix()).PlaceholderFormat(sq.Dollar)
+
+		var err error
+		query, args, err = builder.ToSql()
+		if err != nil {
+			p.logger.Fatalf("Invalid SQL. query: %s, args: %v, err: %v", query, args, err)
+		}
 
-	var argsSliceInterface = make([]any, len(args)+1)
+		var argsSliceInterface = make([]any, len(args)+1)
 
-	argsSliceInterface[0] = preferSimpleProtocol
-	for i := 1; i < len(args)+1; i++ {
-		argsSliceInterface[i] = args[i-1]
+		argsSliceInterface[0] = preferSimpleProtocol
+		for i := 1; i < len(args)+1; i++ {
+			argsSliceInterface[i] = args[i-1]
+		}
+		write = func() error {
+			return p.try(query, argsSliceInterface)
+		}
 	}
 
 	// Insert into pg with retry.
+	var err error
 	for i := p.config.Retry; i > 0; i-- {
-		err = p.try(query, argsSliceInterface)
+		err = write()
 		if err != nil {
 			p.logger.Errorf("can't exec query: %s", err.Error())
 			time.Sleep(p.config.Retention_)
 			continue
 		}
-		p.writtenEventMetric.WithLabelValues().Add(float64(len(uniqueEventsMap)))
+		p.writtenEventMetric.WithLabelValues().Add(float64(len(rows)))
 		break
 	}
 
 	if err != nil {
+		if p.batcher.Fallback(batch) {
+			p.logger.Errorf("failed insert into %s, batch of %d events is passed to the fallback output: %s", p.config.Table, len(batch.Events), err.Error())
+			return
+		}
 		p.pool.Close()
 		p.logger.Fatalf("failed insert into %s. query: %s, args: %v, err: %v", p.config.Table, query, args, err)
 	}
@@ -346,6 +475,37 @@ func (p *Plugin) try(query string, argsSliceInterface []any) error {
 	return err
 }
 
+// prepareCopyRows converts the row values to the types supported by the binary COPY protocol.
+func (p *Plugin) prepareCopyRows(pgFields []column, rows [][]any) error {
+	for _, row := range rows {
+		for i, field := range pgFields {
+			if field.ColType != pgTimestamp {
+				continue
+			}
+			ts, err := time.Parse(time.RFC3339, row[i].(string))
+			if err != nil {
+				return err
+			}
+			row[i] = ts
+		}
+	}
+	return nil
+}
+
+// copy writes the rows using COPY protocol.
+func (p *Plugin) copy(pgFields []column, rows [][]any) error {
+	ctx, cancel := context.WithTimeout(p.ctx, p.config.DBRequestTimeout_)
+	defer cancel()
+
+	columnNames := make([]string, 0, len(pgFields))
+	for _, field := range pgFields {
+		columnNames = append(columnNames, field.Name)
+	}
+
+	_, err := p.pool.CopyFrom(ctx, strings.Split(p.config.Table, "."), columnNames, pgx.CopyFromRows(rows))
+	return err
+}
+
 func (p *Plugin) processEvent(event *pipeline.Event, pgFields []column, uniqueFields map[string]pgType) (fieldValues []any, uniqueID string, err error) {
 	fieldValues = make([]any, 0, len(pgFields))
 	uniqueID = ""
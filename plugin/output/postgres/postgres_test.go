@@ -10,6 +10,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
 	"github.com/ozontech/file.d/logger"
 	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
@@ -78,7 +79,7 @@ func TestPrivateOut(t *testing.T) {
 		[]any{preferSimpleProtocol, strUniValue, intUniValue, intValue, time.Unix(int64(timestampValue), 0).Format(time.RFC3339)},
 	).Return(&rowsForTest{}, nil).Times(1)
 
-	builder, err := NewQueryBuilder(columns, table)
+	builder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 
 	p := &Plugin{
@@ -153,7 +154,7 @@ func TestPrivateOutWithRetry(t *testing.T) {
 		[]any{preferSimpleProtocol, strUniValue, intValue, time.Unix(int64(timestampValue), 0).Format(time.RFC3339)},
 	).Return(&rowsForTest{}, nil).Times(1)
 
-	builder, err := NewQueryBuilder(columns, table)
+	builder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 
 	p := &Plugin{
@@ -208,7 +209,7 @@ func TestPrivateOutNoGoodEvents(t *testing.T) {
 		Retry:   3,
 	}
 
-	builder, err := NewQueryBuilder(columns, table)
+	builder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 
 	p := &Plugin{
@@ -286,7 +287,7 @@ func TestPrivateOutDeduplicatedEvents(t *testing.T) {
 		[]any{preferSimpleProtocol, strUniValue, intUniValue, intValue, time.Unix(int64(timestampValue), 0).Format(time.RFC3339)},
 	).Return(&rowsForTest{}, nil).Times(1)
 
-	builder, err := NewQueryBuilder(columns, table)
+	builder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 
 	p := &Plugin{
@@ -354,7 +355,7 @@ func TestPrivateOutWrongTypeInField(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
 
-	builder, err := NewQueryBuilder(columns, table)
+	builder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 
 	p := &Plugin{
@@ -457,7 +458,7 @@ func TestPrivateOutFewUniqueEventsYetWithDeduplicationEventsAnpooladEvents(t *te
 			secStrUniValue, secIntUniValue, secIntValue, time.Unix(int64(secTimestampValue), 0).Format(time.RFC3339)},
 	).Return(&rowsForTest{}, nil).Times(1)
 
-	builder, err := NewQueryBuilder(columns, table)
+	builder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 
 	p := &Plugin{
@@ -491,3 +492,91 @@ func (r rowsForTest) Next() bool                                     { return fa
 func (r rowsForTest) Scan(dest ...any) error                         { return nil }
 func (r rowsForTest) Values() ([]any, error)                         { return nil, nil }
 func (r rowsForTest) RawValues() [][]byte                            { return nil }
+
+func TestPrivateOutCopy(t *testing.T) {
+	testLogger := logger.Instance
+
+	columns := []ConfigColumn{
+		{
+			Name:       "str_1",
+			ColumnType: "string",
+		},
+		{
+			Name:       "int_1",
+			ColumnType: "int",
+		},
+		{
+			Name:       "timestamp_1",
+			ColumnType: "timestamp",
+		},
+	}
+
+	events := make([]*pipeline.Event, 0, 3)
+	for i := 0; i < 3; i++ {
+		root := insaneJSON.Spawn()
+		defer insaneJSON.Release(root)
+
+		root.AddField(columns[0].Name).MutateToString("str_1_value")
+		root.AddField(columns[1].Name).MutateToInt(i)
+		root.AddField(columns[2].Name).MutateToInt(100)
+		events = append(events, &pipeline.Event{Root: root})
+	}
+
+	table := "public.table1"
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	mockpool := mock_pg.NewMockPgxIface(ctl)
+
+	ctx := context.Background()
+	var ctxMock = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+	var copied [][]any
+	mockpool.EXPECT().CopyFrom(
+		gomock.AssignableToTypeOf(ctxMock),
+		pgx.Identifier{"public", "table1"},
+		[]string{"str_1", "int_1", "timestamp_1"},
+		gomock.Any(),
+	).DoAndReturn(func(_ context.Context, _ pgx.Identifier, _ []string, rowSrc pgx.CopyFromSource) (int64, error) {
+		for rowSrc.Next() {
+			values, err := rowSrc.Values()
+			require.NoError(t, err)
+			copied = append(copied, values)
+		}
+		return int64(len(copied)), nil
+	}).Times(1)
+	mockpool.EXPECT().Query(
+		gomock.AssignableToTypeOf(ctxMock),
+		"INSERT INTO public.table1 (str_1,int_1,timestamp_1) VALUES ($1,$2,$3) ",
+		[]any{preferSimpleProtocol, "str_1_value", 0, time.Unix(100, 0).Format(time.RFC3339)},
+	).Return(&rowsForTest{}, nil).Times(1)
+
+	builder, err := NewQueryBuilder(columns, table, "", "")
+	require.NoError(t, err)
+
+	p := &Plugin{
+		config: &Config{
+			Table:            table,
+			Columns:          columns,
+			InsertMode:       insertModeCopy,
+			CopyMinBatchSize: 2,
+			Retry:            3,
+		},
+		queryBuilder: builder,
+		pool:         mockpool,
+		logger:       testLogger,
+		ctx:          ctx,
+	}
+
+	p.RegisterMetrics(metric.New("test"))
+
+	p.out(nil, &pipeline.Batch{Events: events})
+	require.Equal(t, [][]any{
+		{"str_1_value", 0, time.Unix(100, 0).UTC()},
+		{"str_1_value", 1, time.Unix(100, 0).UTC()},
+		{"str_1_value", 2, time.Unix(100, 0).UTC()},
+	}, copied)
+
+	// the batch is smaller than copy_min_batch_size
+	p.out(nil, &pipeline.Batch{Events: events[:1]})
+}
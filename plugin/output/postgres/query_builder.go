@@ -15,6 +15,8 @@ type column struct {
 	Name    string
 	ColType pgType
 	Unique  bool
+	// Keep is true if the column isn't updated on conflict.
+	Keep bool
 }
 
 type PgQueryBuilder interface {
@@ -27,6 +29,18 @@ type PgQueryBuilder interface {
 const (
 	doNothingPostfix = "ON CONFLICT (%s) DO NOTHING"
 	doUpdatePostfix  = "ON CONFLICT(%s) DO UPDATE SET %s"
+
+	// postfixes with the conflict target from the config.
+	targetDoNothingPostfix = "ON CONFLICT %s DO NOTHING"
+	targetDoUpdatePostfix  = "ON CONFLICT %s DO UPDATE SET %s"
+)
+
+const (
+	conflictActionUpdate  = "update"
+	conflictActionNothing = "nothing"
+
+	columnConflictUpdate = "update"
+	columnConflictKeep   = "keep"
 )
 
 type pgQueryBuilder struct {
@@ -37,7 +51,9 @@ type pgQueryBuilder struct {
 }
 
 // NewQueryBuilder returns new instance of builder.
-func NewQueryBuilder(cfgColumns []ConfigColumn, table string) (PgQueryBuilder, error) {
+// The unique columns are the conflict target if conflictTarget is empty.
+// The conflicts are updated unless conflictAction is "nothing".
+func NewQueryBuilder(cfgColumns []ConfigColumn, table, conflictTarget, conflictAction string) (PgQueryBuilder, error) {
 	qb := &pgQueryBuilder{}
 
 	if len(cfgColumns) == 0 {
@@ -53,7 +69,7 @@ func NewQueryBuilder(cfgColumns []ConfigColumn, table string) (PgQueryBuilder, e
 		return nil, err
 	}
 	qb.uniqFields = uniqueColumns
-	query, postfix := qb.createQuery(pgFields, table)
+	query, postfix := qb.createQuery(pgFields, table, conflictTarget, conflictAction)
 	qb.queryBuilder = query
 	qb.postfix = postfix
 
@@ -96,10 +112,17 @@ func (qb *pgQueryBuilder) initPgFields(cfgColumns []ConfigColumn) ([]column, map
 			return nil, nil, fmt.Errorf("invalid pg type: %v", col.ColumnType)
 		}
 
+		switch col.OnConflict {
+		case "", columnConflictUpdate, columnConflictKeep:
+		default:
+			return nil, nil, fmt.Errorf("invalid on conflict action of column %s: %v", col.Name, col.OnConflict)
+		}
+
 		pgFields = append(pgFields, column{
 			Name:    col.Name,
 			ColType: colType,
 			Unique:  col.Unique,
+			Keep:    col.OnConflict == columnConflictKeep,
 		})
 		if col.Unique {
 			uniqFields[col.Name] = colType
@@ -109,7 +132,7 @@ func (qb *pgQueryBuilder) initPgFields(cfgColumns []ConfigColumn) ([]column, map
 	return pgFields, uniqFields, nil
 }
 
-func (qb *pgQueryBuilder) createQuery(pgFields []column, table string) (sq.InsertBuilder, string) {
+func (qb *pgQueryBuilder) createQuery(pgFields []column, table, conflictTarget, conflictAction string) (sq.InsertBuilder, string) {
 	postfix := ""
 	uniqFields := []string{}
 	updateableFields := make([]string, 0, len(pgFields))
@@ -118,11 +141,26 @@ func (qb *pgQueryBuilder) createQuery(pgFields []column, table string) (sq.Inser
 		fieldsName = append(fieldsName, field.Name)
 		if field.Unique {
 			uniqFields = append(uniqFields, field.Name)
-		} else {
+		} else if !field.Keep {
 			updateableFields = append(updateableFields, field.Name)
 		}
 	}
-	if len(uniqFields) > 0 && len(updateableFields) > 0 {
+	if conflictAction == conflictActionNothing {
+		updateableFields = updateableFields[:0]
+	}
+
+	if conflictTarget != "" {
+		// ON CONFLICT ON CONSTRAINT table_pkey DO UPDATE SET col1updateable=EXCLUDED.col1updateable
+		if len(updateableFields) > 0 {
+			updatePostfix := make([]string, 0, len(updateableFields))
+			for _, field := range updateableFields {
+				updatePostfix = append(updatePostfix, field+"=EXCLUDED."+field)
+			}
+			postfix = fmt.Sprintf(targetDoUpdatePostfix, conflictTarget, strings.Join(updatePostfix, ","))
+		} else {
+			postfix = fmt.Sprintf(targetDoNothingPostfix, conflictTarget)
+		}
+	} else if len(uniqFields) > 0 && len(updateableFields) > 0 {
 		// ON CONFLICT (col1unique, col3unique) DO UPDATE SET col1updateable=EXCLUDED.col1updateable
 		updatePostfix := make([]string, 0, len(updateableFields))
 
@@ -37,7 +37,7 @@ func TestNewQueryBuilderError(t *testing.T) {
 
 	for _, tCase := range cases {
 		t.Run(tCase.name, func(t *testing.T) {
-			queryBuilder, err := NewQueryBuilder(tCase.cfgCols, tCase.table)
+			queryBuilder, err := NewQueryBuilder(tCase.cfgCols, tCase.table, "", "")
 			require.Error(t, err)
 			require.EqualError(t, tCase.err, err.Error())
 			require.Nil(t, queryBuilder)
@@ -186,7 +186,7 @@ func TestNewQueryBuilderSuccess(t *testing.T) {
 
 	for _, tCase := range cases {
 		t.Run(tCase.name, func(t *testing.T) {
-			queryBuilder, err := NewQueryBuilder(tCase.cfgColumns, tCase.table)
+			queryBuilder, err := NewQueryBuilder(tCase.cfgColumns, tCase.table, "", "")
 			require.NoError(t, err)
 			require.NotNil(t, queryBuilder)
 
@@ -226,7 +226,7 @@ func TestGetPgFields(t *testing.T) {
 		},
 	}
 
-	queryBuilder, err := NewQueryBuilder(columns, table)
+	queryBuilder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 	require.NotNil(t, queryBuilder)
 
@@ -251,7 +251,7 @@ func TestGetInsertBuilder(t *testing.T) {
 
 	expectedInsertBuilder := sq.Insert(table).Columns(columns[0].Name, columns[1].Name)
 
-	queryBuilder, err := NewQueryBuilder(columns, table)
+	queryBuilder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 	require.NotNil(t, queryBuilder)
 
@@ -276,7 +276,7 @@ func TestGetPostfixBuilder(t *testing.T) {
 
 	expectedPostfix := "ON CONFLICT(uni_str_col) DO UPDATE SET int_col=EXCLUDED.int_col"
 
-	queryBuilder, err := NewQueryBuilder(columns, table)
+	queryBuilder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 	require.NotNil(t, queryBuilder)
 
@@ -315,10 +315,71 @@ func TestGetUniqueFields(t *testing.T) {
 		"uni_timestamp_col": pgTimestamp,
 	}
 
-	queryBuilder, err := NewQueryBuilder(columns, table)
+	queryBuilder, err := NewQueryBuilder(columns, table, "", "")
 	require.NoError(t, err)
 	require.NotNil(t, queryBuilder)
 
 	uniqueFields := queryBuilder.GetUniqueFields()
 	require.Equal(t, expectedUniqueFields, uniqueFields)
 }
+
+func TestNewQueryBuilderConflict(t *testing.T) {
+	cfgColumns := []ConfigColumn{
+		{
+			Name:       "uni_str_col",
+			ColumnType: "string",
+			Unique:     true,
+		},
+		{
+			Name:       "int_col",
+			ColumnType: "int",
+			OnConflict: "update",
+		},
+		{
+			Name:       "timestamp_col",
+			ColumnType: "timestamp",
+			OnConflict: "keep",
+		},
+	}
+
+	cases := []struct {
+		name            string
+		conflictTarget  string
+		conflictAction  string
+		returnedPostfix string
+	}{
+		{
+			name:            "keep column",
+			conflictAction:  "update",
+			returnedPostfix: "ON CONFLICT(uni_str_col) DO UPDATE SET int_col=EXCLUDED.int_col",
+		},
+		{
+			name:            "do nothing",
+			conflictAction:  "nothing",
+			returnedPostfix: "ON CONFLICT (uni_str_col) DO NOTHING",
+		},
+		{
+			name:            "conflict target",
+			conflictTarget:  "ON CONSTRAINT table_pkey",
+			conflictAction:  "update",
+			returnedPostfix: "ON CONFLICT ON CONSTRAINT table_pkey DO UPDATE SET int_col=EXCLUDED.int_col",
+		},
+		{
+			name:            "conflict target do nothing",
+			conflictTarget:  "(uni_str_col, int_col)",
+			conflictAction:  "nothing",
+			returnedPostfix: "ON CONFLICT (uni_str_col, int_col) DO NOTHING",
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			queryBuilder, err := NewQueryBuilder(cfgColumns, "table", tCase.conflictTarget, tCase.conflictAction)
+			require.NoError(t, err)
+			require.Equal(t, tCase.returnedPostfix, queryBuilder.GetPostfix())
+		})
+	}
+
+	_, err := NewQueryBuilder([]ConfigColumn{{Name: "col", ColumnType: "int", OnConflict: "replace"}}, "table", "", "")
+	require.EqualError(t, err, "invalid on conflict action of column col: replace")
+}
@@ -0,0 +1,35 @@
+package pulsar
+
+import (
+	"github.com/apache/pulsar-client-go/pulsar/log"
+	"go.uber.org/zap"
+)
+
+// clientLogger writes the logs of the client to the logger of the plugin.
+type clientLogger struct {
+	*zap.SugaredLogger
+}
+
+func (l *clientLogger) SubLogger(fields log.Fields) log.Logger {
+	return l.with(fields)
+}
+
+func (l *clientLogger) WithFields(fields log.Fields) log.Entry {
+	return l.with(fields)
+}
+
+func (l *clientLogger) WithField(name string, value any) log.Entry {
+	return &clientLogger{l.With(name, value)}
+}
+
+func (l *clientLogger) WithError(err error) log.Entry {
+	return &clientLogger{l.With(zap.Error(err))}
+}
+
+func (l *clientLogger) with(fields log.Fields) *clientLogger {
+	args := make([]any, 0, 2*len(fields))
+	for name, value := range fields {
+		args = append(args, name, value)
+	}
+	return &clientLogger{l.With(args...)}
+}
@@ -0,0 +1,408 @@
+package pulsar
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It sends events to [Apache Pulsar](https://pulsar.apache.org/) topics using [the Go client](https://github.com/apache/pulsar-client-go).
+
+Every topic has a single producer shared by the workers.
+If the topic is partitioned, the partition is chosen by the hash of the key the same way Java client does,
+events without a key are spread across partitions in round-robin.
+
+Events are committed to the input plugin only after the broker has sent the receipts for all events of the batch.
+Events which weren't confirmed are resent after `retention`, events exceeding the max message size of the broker are dropped.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: pulsar
+      service_url: pulsar://pulsar:6650
+      topic_format: persistent://public/default/logs-%
+      topic_values: [k8s_namespace]
+      key_field: k8s_pod
+      compression: zstd
+```
+}*/
+
+const (
+	outPluginType = "pulsar"
+)
+
+// client is the part of pulsar.Client used by the plugin.
+type client interface {
+	CreateProducer(options pulsar.ProducerOptions) (pulsar.Producer, error)
+	Close()
+}
+
+type Plugin struct {
+	config     *Config
+	logger     *zap.SugaredLogger
+	batcher    *pipeline.Batcher
+	controller pipeline.OutputPluginController
+
+	client      client
+	producers   map[string]pulsar.Producer
+	producersMu *sync.Mutex
+	topicValues [][]string
+	time        string
+	mu          *sync.Mutex
+
+	// plugin metrics
+
+	sendErrorMetric     *prometheus.CounterVec
+	droppedEventsMetric *prometheus.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Pulsar service URL, `pulsar://` or `pulsar+ssl://` scheme is supported.
+	ServiceURL string `json:"service_url" default:"pulsar://127.0.0.1:6650"` // *
+
+	// > @3@4@5@6
+	// >
+	// > It defines the pattern of the topic name. Use `%` character as a placeholder. Use `topic_values` to define values for the replacement.
+	// > E.g. if `topic_format="persistent://public/default/logs-%"` and `topic_values="service"` and event is `{"service"="my-service"}`
+	// > then the topic for that event will be `persistent://public/default/logs-my-service`.
+	TopicFormat string `json:"topic_format" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A list of event fields which will be used for replacement `topic_format`.
+	// > There is a special field `@@time` which equals the current time. Use the `time_format` to define a time format.
+	TopicValues []string `json:"topic_values" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The time format pattern to use as value for the `@@time` placeholder.
+	// > > Check out [func Parse doc](https://golang.org/pkg/time/#Parse) for details.
+	TimeFormat string `json:"time_format" default:"2006-01-02"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field to use as the message key. Events with the same key are sent to the same partition.
+	KeyField  cfg.FieldSelector `json:"key_field" parse:"selector"` // *
+	KeyField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Compression of the messages.
+	Compression string `json:"compression" default:"none" options:"none|lz4|zstd"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The name of the producers, the client generates unique names if it's empty.
+	ProducerName string `json:"producer_name"` // *
+
+	// > @3@4@5@6
+	// >
+	// > JWT token for the authentication.
+	Token string `json:"token"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path to a PEM-encoded CA file for `pulsar+ssl://` scheme.
+	CACert string `json:"ca_cert"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Timeout of network operations including waiting for the receipts.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"30s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Retention between attempts to resend messages which weren't confirmed.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > A minimum size of events in a batch to send.
+	// > If both batch_size and batch_size_bytes are set, they will work together.
+	BatchSizeBytes  cfg.Expression `json:"batch_size_bytes" default:"0" parse:"expression"` // *
+	BatchSizeBytes_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+// data is a state of the worker.
+type data struct {
+	payloads [][]byte
+	failed   []*pipeline.Event
+	topicBuf []byte
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.config = config.(*Config)
+
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+	if strings.Count(p.config.TopicFormat, "%") != len(p.config.TopicValues) {
+		p.logger.Fatal("count of placeholders and values isn't match, check topic_format/topic_values config params")
+	}
+
+	p.init()
+
+	options := pulsar.ClientOptions{
+		URL:                   p.config.ServiceURL,
+		ConnectionTimeout:     p.config.RequestTimeout_,
+		OperationTimeout:      p.config.RequestTimeout_,
+		TLSTrustCertsFilePath: p.config.CACert,
+		Logger:                &clientLogger{p.logger},
+	}
+	if p.config.Token != "" {
+		options.Authentication = pulsar.NewAuthenticationToken(p.config.Token)
+	}
+	client, err := pulsar.NewClient(options)
+	if err != nil {
+		p.logger.Fatalf("can't create pulsar client: %s", err.Error())
+	}
+	p.client = client
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		MaintenanceFn:  p.maintenance,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		BatchSizeBytes: p.config.BatchSizeBytes_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) init() {
+	p.mu = &sync.Mutex{}
+	p.time = time.Now().Format(p.config.TimeFormat)
+	p.producers = make(map[string]pulsar.Producer)
+	p.producersMu = &sync.Mutex{}
+
+	p.topicValues = make([][]string, 0, len(p.config.TopicValues))
+	for _, value := range p.config.TopicValues {
+		p.topicValues = append(p.topicValues, cfg.ParseFieldSelector(value))
+	}
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_pulsar_send_error", "Total Pulsar send errors")
+	p.droppedEventsMetric = ctl.RegisterCounter("output_pulsar_dropped_events", "Total events dropped by Pulsar output")
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+
+	p.producersMu.Lock()
+	for _, producer := range p.producers {
+		producer.Close()
+	}
+	p.producersMu.Unlock()
+	p.client.Close()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{}
+	}
+	data := (*workerData).(*data)
+
+	pending := batch.Events
+	for {
+		err := p.send(data, pending)
+		if err == nil {
+			break
+		}
+
+		p.sendErrorMetric.WithLabelValues().Add(float64(len(data.failed)))
+		p.logger.Errorf("can't send %d events to Pulsar, next attempt in %s: %s", len(data.failed), p.config.Retention_.String(), err.Error())
+		// the failed events are copied since the slice is reused by the next attempt
+		pending = append([]*pipeline.Event(nil), data.failed...)
+		time.Sleep(p.config.Retention_)
+	}
+}
+
+// send sends the events and waits for the receipts, the events which aren't confirmed are collected to data.failed.
+func (p *Plugin) send(data *data, events []*pipeline.Event) error {
+	data.failed = data.failed[:0]
+	for len(data.payloads) < len(events) {
+		data.payloads = append(data.payloads, nil)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		lastErr error
+	)
+	fail := func(event *pipeline.Event, err error) {
+		mu.Lock()
+		data.failed = append(data.failed, event)
+		lastErr = err
+		mu.Unlock()
+	}
+
+	used := make(map[pulsar.Producer]struct{})
+	for i, event := range events {
+		data.topicBuf = p.appendTopic(data.topicBuf[:0], event)
+		producer, err := p.getProducer(string(data.topicBuf))
+		if err != nil {
+			fail(event, err)
+			continue
+		}
+		used[producer] = struct{}{}
+
+		message := &pulsar.ProducerMessage{}
+		if len(p.config.KeyField_) > 0 {
+			message.Key = event.Root.Dig(p.config.KeyField_...).AsString()
+		}
+		// the payload is kept by the client until the message is sent, so every event has its own buffer
+		data.payloads[i] = event.Root.Encode(data.payloads[i][:0])
+		message.Payload = data.payloads[i]
+
+		wg.Add(1)
+		event := event
+		producer.SendAsync(context.Background(), message, func(_ pulsar.MessageID, message *pulsar.ProducerMessage, err error) {
+			defer wg.Done()
+			if err == nil {
+				return
+			}
+			if errors.Is(err, pulsar.ErrMessageTooLarge) {
+				p.droppedEventsMetric.WithLabelValues().Inc()
+				p.logger.Errorf("event of %d bytes exceeds Pulsar max message size and is dropped", len(message.Payload))
+				return
+			}
+			fail(event, err)
+		})
+	}
+
+	// the batch is sent at once instead of waiting for the publish delay of the client
+	for producer := range used {
+		if err := producer.Flush(); err != nil {
+			p.logger.Errorf("can't flush producer of topic %s: %s", producer.Topic(), err.Error())
+		}
+	}
+	wg.Wait()
+
+	return lastErr
+}
+
+func (p *Plugin) appendTopic(buf []byte, event *pipeline.Event) []byte {
+	replacements := 0
+	for _, c := range pipeline.StringToByteUnsafe(p.config.TopicFormat) {
+		if c != '%' {
+			buf = append(buf, c)
+			continue
+		}
+
+		value := p.topicValues[replacements]
+		replacements++
+
+		if len(value) == 1 && value[0] == "@time" {
+			p.mu.Lock()
+			buf = append(buf, p.time...)
+			p.mu.Unlock()
+			continue
+		}
+
+		node := event.Root.Dig(value...)
+		if node == nil {
+			buf = append(buf, pipeline.DefaultFieldValue...)
+			continue
+		}
+		buf = append(buf, node.AsString()...)
+	}
+
+	return buf
+}
+
+// getProducer returns the producer of the topic, the producers are shared by the workers.
+func (p *Plugin) getProducer(topic string) (pulsar.Producer, error) {
+	p.producersMu.Lock()
+	defer p.producersMu.Unlock()
+
+	if producer, has := p.producers[topic]; has {
+		return producer, nil
+	}
+
+	options := pulsar.ProducerOptions{
+		Topic:         topic,
+		Name:          p.config.ProducerName,
+		SendTimeout:   p.config.RequestTimeout_,
+		HashingScheme: pulsar.JavaStringHash,
+	}
+	switch p.config.Compression {
+	case "lz4":
+		options.CompressionType = pulsar.LZ4
+	case "zstd":
+		options.CompressionType = pulsar.ZSTD
+	}
+
+	producer, err := p.client.CreateProducer(options)
+	if err != nil {
+		return nil, err
+	}
+
+	p.producers[topic] = producer
+	return producer, nil
+}
+
+func (p *Plugin) maintenance(_ *pipeline.WorkerData) {
+	p.mu.Lock()
+	p.time = time.Now().Format(p.config.TimeFormat)
+	p.mu.Unlock()
+}
@@ -0,0 +1,191 @@
+package pulsar
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+type receivedMessage struct {
+	topic string
+	key   string
+	event string
+}
+
+// fakeClient creates the producers which receive the messages instead of the broker.
+type fakeClient struct {
+	mu        sync.Mutex
+	options   []pulsar.ProducerOptions
+	received  []receivedMessage
+	failSends int
+	maxSize   int
+}
+
+func (c *fakeClient) CreateProducer(options pulsar.ProducerOptions) (pulsar.Producer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.options = append(c.options, options)
+	return &fakeProducer{client: c, topic: options.Topic}, nil
+}
+
+func (c *fakeClient) Close() {}
+
+type fakeProducer struct {
+	client *fakeClient
+	topic  string
+}
+
+func (p *fakeProducer) Topic() string {
+	return p.topic
+}
+
+func (p *fakeProducer) Name() string {
+	return "fake"
+}
+
+func (p *fakeProducer) Send(_ context.Context, _ *pulsar.ProducerMessage) (pulsar.MessageID, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakeProducer) SendAsync(_ context.Context, message *pulsar.ProducerMessage, callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)) {
+	c := p.client
+	c.mu.Lock()
+	var err error
+	switch {
+	case c.maxSize > 0 && len(message.Payload) > c.maxSize:
+		err = pulsar.ErrMessageTooLarge
+	case c.failSends > 0:
+		c.failSends--
+		err = errors.New("send timeout")
+	default:
+		c.received = append(c.received, receivedMessage{topic: p.topic, key: message.Key, event: string(message.Payload)})
+	}
+	c.mu.Unlock()
+
+	// the receipts are got asynchronously
+	go callback(nil, message, err)
+}
+
+func (p *fakeProducer) LastSequenceID() int64 {
+	return 0
+}
+
+func (p *fakeProducer) Flush() error {
+	return nil
+}
+
+func (p *fakeProducer) Close() {}
+
+func newTestPlugin(config *Config, client *fakeClient) *Plugin {
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1, "capacity": 64})
+	p := &Plugin{
+		config: config,
+		logger: zap.NewExample().Sugar(),
+		client: client,
+	}
+	p.RegisterMetrics(metric.New("test"))
+	p.init()
+	return p
+}
+
+func newTestBatch(t *testing.T, events ...string) *pipeline.Batch {
+	batch := &pipeline.Batch{}
+	for _, e := range events {
+		root, err := insaneJSON.DecodeString(e)
+		require.NoError(t, err)
+		t.Cleanup(func() { insaneJSON.Release(root) })
+		batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+	}
+	return batch
+}
+
+func sortReceived(received []receivedMessage) []receivedMessage {
+	sort.SliceStable(received, func(i, j int) bool {
+		if received[i].topic == received[j].topic {
+			return received[i].key < received[j].key
+		}
+		return received[i].topic < received[j].topic
+	})
+	return received
+}
+
+func TestSend(t *testing.T) {
+	client := &fakeClient{}
+	p := newTestPlugin(&Config{
+		TopicFormat:  "persistent://public/default/logs-%",
+		TopicValues:  []string{"ns"},
+		KeyField:     "pod",
+		Compression:  "zstd",
+		ProducerName: "file.d",
+	}, client)
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t,
+		`{"ns":"payment","pod":"api-1","message":"a"}`,
+		`{"ns":"payment","pod":"api-2","message":"b"}`,
+		`{"ns":"payment","pod":"api-1","message":"c"}`,
+		`{"ns":"search","message":"d"}`,
+	))
+
+	assert.Equal(t, []receivedMessage{
+		{topic: "persistent://public/default/logs-payment", key: "api-1", event: `{"ns":"payment","pod":"api-1","message":"a"}`},
+		{topic: "persistent://public/default/logs-payment", key: "api-1", event: `{"ns":"payment","pod":"api-1","message":"c"}`},
+		{topic: "persistent://public/default/logs-payment", key: "api-2", event: `{"ns":"payment","pod":"api-2","message":"b"}`},
+		{topic: "persistent://public/default/logs-search", event: `{"ns":"search","message":"d"}`},
+	}, sortReceived(client.received))
+
+	require.Equal(t, 2, len(client.options))
+	options := client.options[0]
+	assert.Equal(t, "persistent://public/default/logs-payment", options.Topic)
+	assert.Equal(t, "file.d", options.Name)
+	assert.Equal(t, pulsar.ZSTD, options.CompressionType)
+	assert.Equal(t, pulsar.JavaStringHash, options.HashingScheme)
+
+	// producers are reused
+	p.out(&workerData, newTestBatch(t, `{"ns":"search","message":"e"}`))
+	assert.Equal(t, 2, len(client.options))
+	assert.Equal(t, 5, len(client.received))
+}
+
+func TestResend(t *testing.T) {
+	client := &fakeClient{failSends: 3}
+	p := newTestPlugin(&Config{
+		TopicFormat: "logs",
+		Retention:   "1ms",
+	}, client)
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t, `{"message":"a"}`, `{"message":"b"}`))
+
+	// the events which aren't confirmed are resent until they are sent
+	assert.ElementsMatch(t, []receivedMessage{
+		{topic: "logs", event: `{"message":"a"}`},
+		{topic: "logs", event: `{"message":"b"}`},
+	}, client.received)
+	assert.Equal(t, float64(3), testutil.ToFloat64(p.sendErrorMetric.WithLabelValues()))
+}
+
+func TestDropTooLarge(t *testing.T) {
+	client := &fakeClient{maxSize: 20}
+	p := newTestPlugin(&Config{TopicFormat: "logs"}, client)
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t, `{"message":"a"}`, `{"message":"too large"}`))
+
+	assert.Equal(t, []receivedMessage{{topic: "logs", event: `{"message":"a"}`}}, client.received)
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.droppedEventsMetric.WithLabelValues()))
+	assert.Equal(t, float64(0), testutil.ToFloat64(p.sendErrorMetric.WithLabelValues()))
+}
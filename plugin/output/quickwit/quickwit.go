@@ -0,0 +1,453 @@
+package quickwit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/tls"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It sends events to [Quickwit](https://quickwit.io/docs/reference/rest-api#ingest-data-into-an-index) ingest API.
+
+Events are grouped by the index name and sent as NDJSON, one request per index.
+The index name can be built from the event fields, see `index_format` and `index_values`.
+
+Quickwit answers `429` when its ingest queue is full. In that case the request is retried
+with an exponential backoff from `retention` to `max_retention`, or after the time from `Retry-After` header.
+Other `4xx` responses aren't retried, the events are dropped.
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: quickwit
+      endpoint: http://quickwit:7280
+      index_format: logs-%
+      index_values: [k8s_namespace]
+```
+}*/
+
+const (
+	outPluginType = "quickwit"
+
+	// Quickwit rejects ingest requests larger than 10MB
+	maxRequestBytes = 10 * 1024 * 1024
+
+	retryAfterHeader = "Retry-After"
+)
+
+var errNotRetryable = errors.New("not retryable response")
+
+type Plugin struct {
+	config     *Config
+	client     *http.Client
+	logger     *zap.SugaredLogger
+	batcher    *pipeline.Batcher
+	controller pipeline.OutputPluginController
+
+	indexValues [][]string
+	time        string
+	mu          *sync.Mutex
+
+	// plugin metrics
+
+	sendErrorMetric      *prometheus.CounterVec
+	droppedEventsMetric  *prometheus.CounterVec
+	rejectedEventsMetric *prometheus.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Quickwit REST API address.
+	Endpoint string `json:"endpoint" default:"http://127.0.0.1:7280"` // *
+
+	// > @3@4@5@6
+	// >
+	// > It defines the pattern of the index name. Use `%` character as a placeholder. Use `index_values` to define values for the replacement.
+	// > E.g. if `index_format="logs-%"` and `index_values="service"` and event is `{"service"="my-service"}`
+	// > then index for that event will be `logs-my-service`.
+	IndexFormat string `json:"index_format" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A list of event fields which will be used for replacement `index_format`.
+	// > There is a special field `@@time` which equals the current time. Use the `time_format` to define a time format.
+	IndexValues []string `json:"index_values" slice:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The time format pattern to use as value for the `@@time` placeholder.
+	// > > Check out [func Parse doc](https://golang.org/pkg/time/#Parse) for details.
+	TimeFormat string `json:"time_format" default:"2006-01-02"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Commit behavior of the ingest requests.
+	// > * `auto` – the request returns as soon as the documents are accepted
+	// > * `wait_for` – the request waits for the documents to be committed by the regular commit
+	// > * `force` – the request forces the commit and waits for it, useful for tests but slow in production
+	Commit string `json:"commit" default:"auto" options:"auto|wait_for|force"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA file.
+	CACert string `json:"ca_cert"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Additional HTTP headers of requests, e.g. for the authentication in a proxy.
+	Headers map[string]string `json:"headers"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Client timeout of requests.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"30s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Initial retention between retries of failed requests.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Maximum retention between retries, the retention is doubled after each failed attempt.
+	MaxRetention  cfg.Duration `json:"max_retention" default:"30s" parse:"duration"` // *
+	MaxRetention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > A minimum size of events in a batch to send.
+	// > If both batch_size and batch_size_bytes are set, they will work together.
+	BatchSizeBytes  cfg.Expression `json:"batch_size_bytes" default:"0" parse:"expression"` // *
+	BatchSizeBytes_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+type data struct {
+	// indexes keeps the order of the indexes in the batch
+	indexes  []string
+	bodies   map[string][]byte
+	counts   map[string]int
+	indexBuf []byte
+}
+
+type ingestResponse struct {
+	NumRejectedDocs int               `json:"num_rejected_docs"`
+	ParseFailures   []json.RawMessage `json:"parse_failures"`
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.config = config.(*Config)
+
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+	if p.config.MaxRetention_ < p.config.Retention_ {
+		p.logger.Fatal("'max_retention' can't be less than 'retention'")
+	}
+	if strings.Count(p.config.IndexFormat, "%") != len(p.config.IndexValues) {
+		p.logger.Fatal("count of placeholders and values isn't match, check index_format/index_values config params")
+	}
+
+	if err := p.init(); err != nil {
+		p.logger.Fatal(err.Error())
+	}
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		MaintenanceFn:  p.maintenance,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		BatchSizeBytes: p.config.BatchSizeBytes_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) init() error {
+	p.mu = &sync.Mutex{}
+	p.time = time.Now().Format(p.config.TimeFormat)
+	p.config.Endpoint = strings.TrimSuffix(p.config.Endpoint, "/")
+
+	p.indexValues = make([][]string, 0, len(p.config.IndexValues))
+	for _, value := range p.config.IndexValues {
+		p.indexValues = append(p.indexValues, cfg.ParseFieldSelector(value))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.config.CACert != "" {
+		b := tls.NewConfigBuilder()
+		if err := b.AppendCARoot(p.config.CACert); err != nil {
+			return fmt.Errorf("can't append CA root: %w", err)
+		}
+		transport.TLSClientConfig = b.Build()
+	}
+
+	p.client = &http.Client{
+		Timeout:   p.config.RequestTimeout_,
+		Transport: transport,
+	}
+
+	return nil
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_quickwit_send_error", "Total Quickwit send errors")
+	p.droppedEventsMetric = ctl.RegisterCounter("output_quickwit_dropped_events", "Total events dropped by Quickwit output")
+	p.rejectedEventsMetric = ctl.RegisterCounter("output_quickwit_rejected_events", "Total events rejected by Quickwit while parsing")
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{
+			bodies: make(map[string][]byte),
+			counts: make(map[string]int),
+		}
+	}
+
+	data := (*workerData).(*data)
+	data.indexes = data.indexes[:0]
+	for index := range data.counts {
+		data.counts[index] = 0
+	}
+
+	for _, event := range batch.Events {
+		data.indexBuf = p.appendIndexName(data.indexBuf[:0], event)
+
+		body := data.bodies[string(data.indexBuf)]
+		// the first event of the index in the batch
+		if data.counts[string(data.indexBuf)] == 0 {
+			data.indexes = append(data.indexes, string(data.indexBuf))
+			body = body[:0]
+			// handle too much memory consumption
+			if cap(body) > maxRequestBytes {
+				body = nil
+			}
+		}
+
+		body = event.Root.Encode(body)
+		body = append(body, '\n')
+		data.bodies[string(data.indexBuf)] = body
+		data.counts[string(data.indexBuf)]++
+	}
+
+	for _, index := range data.indexes {
+		p.sendIndex(index, data.bodies[index])
+	}
+
+	// forget indexes which weren't present in the batch
+	for index, count := range data.counts {
+		if count == 0 {
+			delete(data.counts, index)
+			delete(data.bodies, index)
+		}
+	}
+}
+
+func (p *Plugin) appendIndexName(buf []byte, event *pipeline.Event) []byte {
+	replacements := 0
+	for _, c := range pipeline.StringToByteUnsafe(p.config.IndexFormat) {
+		if c != '%' {
+			buf = append(buf, c)
+			continue
+		}
+
+		value := p.indexValues[replacements]
+		replacements++
+
+		if len(value) == 1 && value[0] == "@time" {
+			p.mu.Lock()
+			buf = append(buf, p.time...)
+			p.mu.Unlock()
+			continue
+		}
+
+		node := event.Root.Dig(value...)
+		if node == nil {
+			buf = append(buf, pipeline.DefaultFieldValue...)
+			continue
+		}
+		buf = append(buf, node.AsString()...)
+	}
+
+	return buf
+}
+
+func (p *Plugin) maintenance(_ *pipeline.WorkerData) {
+	p.mu.Lock()
+	p.time = time.Now().Format(p.config.TimeFormat)
+	p.mu.Unlock()
+}
+
+// sendIndex splits the NDJSON body into requests fitting the Quickwit limit.
+func (p *Plugin) sendIndex(index string, body []byte) {
+	for len(body) > 0 {
+		chunk := body
+		if len(chunk) > maxRequestBytes {
+			// cut on the last line boundary which fits the limit,
+			// a single event larger than the limit is sent as is
+			cut := bytes.LastIndexByte(chunk[:maxRequestBytes], '\n')
+			if cut == -1 {
+				cut = bytes.IndexByte(chunk, '\n')
+			}
+			chunk = chunk[:cut+1]
+		}
+		body = body[len(chunk):]
+
+		p.send(index, chunk)
+	}
+}
+
+// send sends the body until success or not retryable error.
+func (p *Plugin) send(index string, body []byte) {
+	retention := p.config.Retention_
+	for {
+		retryAfter, err := p.request(index, body)
+		if err == nil {
+			return
+		}
+
+		p.sendErrorMetric.WithLabelValues().Inc()
+		if errors.Is(err, errNotRetryable) {
+			count := bytes.Count(body, []byte{'\n'})
+			p.droppedEventsMetric.WithLabelValues().Add(float64(count))
+			p.logger.Errorf("can't send data to Quickwit index %q, %d events are dropped: %s", index, count, err.Error())
+			return
+		}
+
+		if retryAfter == 0 {
+			retryAfter = retention
+			retention *= 2
+			if retention > p.config.MaxRetention_ {
+				retention = p.config.MaxRetention_
+			}
+		}
+		p.logger.Errorf("can't send data to Quickwit index %q, next attempt in %s: %s", index, retryAfter.String(), err.Error())
+		time.Sleep(retryAfter)
+	}
+}
+
+// request returns the time to wait before the next attempt if Quickwit asks for it.
+func (p *Plugin) request(index string, body []byte) (time.Duration, error) {
+	endpoint := p.config.Endpoint + "/api/v1/" + index + "/ingest?commit=" + p.config.Commit
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("can't create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range p.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("can't send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("can't read response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+		p.checkRejected(index, respBody)
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return parseRetryAfter(resp.Header.Get(retryAfterHeader)), fmt.Errorf("ingest queue is full: %s", resp.Status)
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= http.StatusInternalServerError:
+		return 0, fmt.Errorf("bad response: %s: %s", resp.Status, respBody)
+	default:
+		return 0, fmt.Errorf("%w: %s: %s", errNotRetryable, resp.Status, respBody)
+	}
+}
+
+// checkRejected reports the documents which Quickwit failed to parse, they can't be fixed by retrying.
+func (p *Plugin) checkRejected(index string, respBody []byte) {
+	resp := ingestResponse{}
+	if err := json.Unmarshal(respBody, &resp); err != nil || resp.NumRejectedDocs == 0 {
+		return
+	}
+
+	p.rejectedEventsMetric.WithLabelValues().Add(float64(resp.NumRejectedDocs))
+	if len(resp.ParseFailures) > 0 {
+		p.logger.Errorf("%d events are rejected by Quickwit index %q, first failure: %s", resp.NumRejectedDocs, index, resp.ParseFailures[0])
+	} else {
+		p.logger.Errorf("%d events are rejected by Quickwit index %q", resp.NumRejectedDocs, index)
+	}
+}
+
+// parseRetryAfter parses the number of seconds to wait from the Retry-After header.
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,171 @@
+package quickwit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+func newTestPlugin(t *testing.T, config *Config) *Plugin {
+	test.NewConfig(config, map[string]int{"gomaxprocs": 1, "capacity": 64})
+	p := &Plugin{
+		config: config,
+		logger: zap.NewExample().Sugar(),
+	}
+	p.RegisterMetrics(metric.New("test"))
+	require.NoError(t, p.init())
+	return p
+}
+
+func newTestBatch(t *testing.T, events ...string) *pipeline.Batch {
+	batch := &pipeline.Batch{}
+	for _, e := range events {
+		root, err := insaneJSON.DecodeString(e)
+		require.NoError(t, err)
+		t.Cleanup(func() { insaneJSON.Release(root) })
+		batch.Events = append(batch.Events, &pipeline.Event{Root: root})
+	}
+	return batch
+}
+
+type request struct {
+	path string
+	body string
+}
+
+func TestIndexes(t *testing.T) {
+	mu := sync.Mutex{}
+	requests := make([]request, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, request{path: r.URL.RequestURI(), body: string(body)})
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"num_docs_for_processing":1}`))
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(t, &Config{
+		Endpoint:    server.URL + "/",
+		IndexFormat: "logs-%",
+		IndexValues: []string{"k8s.namespace"},
+		Commit:      "force",
+	})
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t,
+		`{"message":"a","k8s":{"namespace":"payment"}}`,
+		`{"message":"b","k8s":{"namespace":"search"}}`,
+		`{"message":"c","k8s":{"namespace":"payment"}}`,
+		`{"message":"d"}`,
+	))
+
+	assert.Equal(t, []request{
+		{
+			path: "/api/v1/logs-payment/ingest?commit=force",
+			body: `{"message":"a","k8s":{"namespace":"payment"}}` + "\n" + `{"message":"c","k8s":{"namespace":"payment"}}` + "\n",
+		},
+		{
+			path: "/api/v1/logs-search/ingest?commit=force",
+			body: `{"message":"b","k8s":{"namespace":"search"}}` + "\n",
+		},
+		{
+			path: "/api/v1/logs-not_set/ingest?commit=force",
+			body: `{"message":"d"}` + "\n",
+		},
+	}, requests)
+
+	// buffers of the indexes which are absent in the next batch are released
+	requests = requests[:0]
+	p.out(&workerData, newTestBatch(t, `{"message":"e","k8s":{"namespace":"search"}}`))
+	assert.Equal(t, []request{{
+		path: "/api/v1/logs-search/ingest?commit=force",
+		body: `{"message":"e","k8s":{"namespace":"search"}}` + "\n",
+	}}, requests)
+	assert.Equal(t, 1, len(workerData.(*data).bodies))
+}
+
+func TestBackpressure(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"num_docs_for_processing":1}`))
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(t, &Config{
+		Endpoint:     server.URL,
+		IndexFormat:  "logs",
+		Retention:    "1ms",
+		MaxRetention: "2ms",
+	})
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t, `{"message":"a"}`))
+
+	assert.Equal(t, 3, attempts)
+}
+
+func TestNotRetryable(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"index not found"}`))
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(t, &Config{
+		Endpoint:    server.URL,
+		IndexFormat: "logs",
+		Retention:   "1ms",
+	})
+
+	workerData := pipeline.WorkerData(nil)
+	p.out(&workerData, newTestBatch(t, `{"message":"a"}`, `{"message":"b"}`))
+
+	assert.Equal(t, 1, attempts)
+}
+
+func TestSplit(t *testing.T) {
+	sizes := make([]int, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.True(t, strings.HasSuffix(string(body), "\n"))
+		sizes = append(sizes, len(body))
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(t, &Config{
+		Endpoint:    server.URL,
+		IndexFormat: "logs",
+	})
+
+	line := `{"message":"` + strings.Repeat("a", 1024*1024) + `"}` + "\n"
+	p.sendIndex("logs", []byte(strings.Repeat(line, 15)))
+
+	require.Equal(t, 2, len(sizes))
+	assert.Equal(t, 9*len(line), sizes[0])
+	assert.Equal(t, 6*len(line), sizes[1])
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, int64(0), int64(parseRetryAfter("")))
+	assert.Equal(t, int64(0), int64(parseRetryAfter("-1")))
+	assert.Equal(t, "5s", parseRetryAfter("5").String())
+}
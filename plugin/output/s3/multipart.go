@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minio/minio-go"
+)
+
+// uploadByParts returns true if files must be uploaded by the plugin itself
+// instead of the client library.
+func (p *Plugin) uploadByParts() bool {
+	return p.config.ChecksumMode != checksumModeAuto || p.config.PartSize_ != 0
+}
+
+func (p *Plugin) partSize() int {
+	if p.config.PartSize_ == 0 {
+		return defaultPartSize
+	}
+	return int(p.config.PartSize_)
+}
+
+// putObjectByParts uploads file with the multipart upload using configured part size and checksum mode.
+// Unfinished upload is aborted on error.
+func (p *Plugin) putObjectByParts(ctx context.Context, core minio.Core, bucketName, objectName, fileName string, opts minio.PutObjectOptions) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("can't open file: %w", err)
+	}
+	defer f.Close()
+
+	uploadID, err := core.NewMultipartUpload(bucketName, objectName, opts)
+	if err != nil {
+		return fmt.Errorf("can't start multipart upload: %w", err)
+	}
+
+	parts, err := p.putParts(ctx, core, bucketName, objectName, uploadID, f)
+	if err == nil {
+		_, err = core.CompleteMultipartUpload(bucketName, objectName, uploadID, parts)
+	}
+	if err != nil {
+		if abortErr := core.AbortMultipartUpload(bucketName, objectName, uploadID); abortErr != nil {
+			p.logger.Errorf("can't abort multipart upload %s: %s", uploadID, abortErr.Error())
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (p *Plugin) putParts(ctx context.Context, core minio.Core, bucketName, objectName, uploadID string, r io.Reader) ([]minio.CompletePart, error) {
+	buf := make([]byte, p.partSize())
+	parts := make([]minio.CompletePart, 0)
+	for partID := 1; ; partID++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n, err := io.ReadFull(r, buf)
+		// the first part is always sent to upload an empty file correctly.
+		if errors.Is(err, io.EOF) && partID > 1 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("can't read file: %w", err)
+		}
+
+		part, putErr := p.putPart(core, bucketName, objectName, uploadID, partID, buf[:n])
+		if putErr != nil {
+			return nil, putErr
+		}
+		parts = append(parts, part)
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	return parts, nil
+}
+
+// putPart uploads the data as the part of the multipart upload.
+func (p *Plugin) putPart(core minio.Core, bucketName, objectName, uploadID string, partID int, data []byte) (minio.CompletePart, error) {
+	md5Base64, sha256Hex := p.checksums(data)
+	part, err := core.PutObjectPart(bucketName, objectName, uploadID, partID, bytes.NewReader(data), int64(len(data)), md5Base64, sha256Hex, nil)
+	if err != nil {
+		return minio.CompletePart{}, fmt.Errorf("can't upload part %d: %w", partID, err)
+	}
+	return minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag}, nil
+}
+
+// checksums calculates payload checksums according to the checksum mode.
+// MD5 is used in auto mode since it's supported by all S3-compatible stores.
+func (p *Plugin) checksums(data []byte) (md5Base64, sha256Hex string) {
+	switch p.config.ChecksumMode {
+	case checksumModeAuto, checksumModeMD5:
+		sum := md5.Sum(data)
+		md5Base64 = base64.StdEncoding.EncodeToString(sum[:])
+	case checksumModeSHA256:
+		sum := sha256.Sum256(data)
+		sha256Hex = hex.EncodeToString(sum[:])
+	}
+	return md5Base64, sha256Hex
+}
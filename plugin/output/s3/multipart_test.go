@@ -0,0 +1,115 @@
+package s3
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/minio/minio-go"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMultipartS3 emulates path-style multipart upload handlers of S3.
+type fakeMultipartS3 struct {
+	mu        sync.Mutex
+	parts     map[string]string
+	md5s      []string
+	completed bool
+}
+
+func (s *fakeMultipartS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		_, _ = fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>id</UploadId></InitiateMultipartUploadResult>`, r.URL.Path)
+	case r.Method == http.MethodPut && q.Get("uploadId") == "id":
+		data, _ := io.ReadAll(r.Body)
+		s.parts[q.Get("partNumber")] = string(data)
+		s.md5s = append(s.md5s, r.Header.Get("Content-Md5"))
+		w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && q.Get("uploadId") == "id":
+		s.completed = true
+		_, _ = fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>object.zip</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestPutObjectByParts(t *testing.T) {
+	r := require.New(t)
+
+	server := &fakeMultipartS3{parts: map[string]string{}}
+	ts := httptest.NewTLSServer(server)
+	defer ts.Close()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	config := &Config{
+		Region:         "us-east-1",
+		ForcePathStyle: true,
+		CACert:         string(caCert),
+		ChecksumMode:   checksumModeMD5,
+		PartSize_:      minPartSize,
+	}
+	client, err := newMinioClient(config, strings.TrimPrefix(ts.URL, "https://"), "access", "secret", true)
+	r.NoError(err)
+
+	content := strings.Repeat("a", minPartSize) + "tail"
+	fileName := filepath.Join(t.TempDir(), "file.zip")
+	r.NoError(os.WriteFile(fileName, []byte(content), 0o600))
+
+	p := &Plugin{config: config, logger: logger.Instance}
+	err = p.putObjectByParts(context.Background(), minio.Core{Client: client}, "bucket", "object.zip", fileName, minio.PutObjectOptions{})
+	r.NoError(err)
+
+	r.True(server.completed)
+	r.Len(server.parts, 2)
+	r.Equal(content, server.parts["1"]+server.parts["2"])
+	for _, sum := range server.md5s {
+		r.NotEmpty(sum)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	cases := []struct {
+		mode       string
+		wantMD5    bool
+		wantSHA256 bool
+	}{
+		{mode: checksumModeAuto, wantMD5: true},
+		{mode: checksumModeMD5, wantMD5: true},
+		{mode: checksumModeSHA256, wantSHA256: true},
+		{mode: checksumModeNone},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			p := &Plugin{config: &Config{ChecksumMode: tc.mode}}
+			md5Base64, sha256Hex := p.checksums([]byte("data"))
+			require.Equal(t, tc.wantMD5, md5Base64 != "")
+			require.Equal(t, tc.wantSHA256, sha256Hex != "")
+		})
+	}
+}
+
+func TestPartSize(t *testing.T) {
+	p := &Plugin{config: &Config{ChecksumMode: checksumModeAuto}}
+	require.False(t, p.uploadByParts())
+	require.Equal(t, defaultPartSize, p.partSize())
+
+	p.config.PartSize_ = 16 * cfg.MiB
+	require.True(t, p.uploadByParts())
+	require.Equal(t, 16*cfg.MiB, p.partSize())
+}
@@ -0,0 +1,173 @@
+package s3
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/pipeline"
+)
+
+const (
+	objectKeyOpRaw = iota
+	objectKeyOpTime
+	objectKeyOpBucket
+	objectKeyOpFile
+	objectKeyOpField
+
+	// objectKeyEmptyValue replaces the missing and empty event fields in the object keys.
+	objectKeyEmptyValue = "_"
+)
+
+// objectKeyTimeLayouts are the time placeholders of the object key template.
+var objectKeyTimeLayouts = map[string]string{
+	"yyyy": "2006",
+	"MM":   "01",
+	"dd":   "02",
+	"HH":   "15",
+	"mm":   "04",
+	"ss":   "05",
+}
+
+type objectKeyOp struct {
+	kind  int
+	data  string
+	field []string
+}
+
+// objectKeyTemplate builds the object keys from the template with the `{...}` placeholders.
+type objectKeyTemplate struct {
+	ops []objectKeyOp
+	// fields is the count of the event field placeholders.
+	fields int
+}
+
+func parseObjectKeyTemplate(template string) (*objectKeyTemplate, error) {
+	t := &objectKeyTemplate{}
+	if strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("object key can't start with '/'")
+	}
+
+	hasFile := false
+	for template != "" {
+		start := strings.IndexByte(template, '{')
+		if start == -1 {
+			t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpRaw, data: template})
+			break
+		}
+		if start > 0 {
+			t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpRaw, data: template[:start]})
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end == -1 {
+			return nil, fmt.Errorf("can't find placeholder end '}': %s", template)
+		}
+		name := template[start+1 : start+end]
+		template = template[start+end+1:]
+
+		switch name {
+		case "":
+			return nil, fmt.Errorf("empty placeholder")
+		case "bucket":
+			t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpBucket})
+		case "file":
+			t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpFile})
+			hasFile = true
+		default:
+			if layout, ok := objectKeyTimeLayouts[name]; ok {
+				t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpTime, data: layout})
+				continue
+			}
+			t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpField, field: cfg.ParseFieldSelector(name)})
+			t.fields++
+		}
+	}
+
+	// the template without the file name is the prefix of the objects.
+	if !hasFile {
+		if len(t.ops) > 0 {
+			last := t.ops[len(t.ops)-1]
+			if last.kind != objectKeyOpRaw || !strings.HasSuffix(last.data, "/") {
+				t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpRaw, data: "/"})
+			}
+		}
+		t.ops = append(t.ops, objectKeyOp{kind: objectKeyOpFile})
+	}
+
+	return t, nil
+}
+
+// fieldValues returns the values of the event field placeholders.
+func (t *objectKeyTemplate) fieldValues(event *pipeline.Event) []string {
+	if t.fields == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, t.fields)
+	for _, op := range t.ops {
+		if op.kind != objectKeyOpField {
+			continue
+		}
+
+		value := event.Root.Dig(op.field...).AsString()
+		if value == "" {
+			value = objectKeyEmptyValue
+		}
+		// the values can't add the levels to the key hierarchy.
+		values = append(values, strings.ReplaceAll(pipeline.CloneString(value), "/", "_"))
+	}
+	return values
+}
+
+// render returns the object key, the field values must be in the order of the placeholders.
+func (t *objectKeyTemplate) render(bucketName, fileName string, now time.Time, fieldValues []string) string {
+	key := strings.Builder{}
+	field := 0
+	for _, op := range t.ops {
+		switch op.kind {
+		case objectKeyOpRaw:
+			key.WriteString(op.data)
+		case objectKeyOpTime:
+			key.WriteString(now.Format(op.data))
+		case objectKeyOpBucket:
+			key.WriteString(bucketName)
+		case objectKeyOpFile:
+			key.WriteString(fileName)
+		case objectKeyOpField:
+			value := objectKeyEmptyValue
+			if field < len(fieldValues) {
+				value = fieldValues[field]
+			}
+			key.WriteString(value)
+			field++
+		}
+	}
+	return key.String()
+}
+
+// isValidBucketName checks the bucket naming rules of S3:
+// 3-63 lowercase letters, digits, dots and hyphens, which start and end with a letter or digit and don't look like an IP address.
+func isValidBucketName(name string) bool {
+	if len(name) < 3 || len(name) > 63 {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		isAlnum := c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+		if (i == 0 || i == len(name)-1) && !isAlnum {
+			return false
+		}
+		if !isAlnum && c != '.' && c != '-' {
+			return false
+		}
+		if c == '.' && (name[i-1] == '.' || name[i-1] == '-' || name[i+1] == '-') {
+			return false
+		}
+	}
+
+	return net.ParseIP(name) == nil
+}
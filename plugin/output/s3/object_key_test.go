@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+func TestObjectKeyTemplate(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := `{"service":"api","k8s":{"namespace":"prod/eu"},"empty":""}`
+
+	for name, tc := range map[string]struct {
+		template string
+		key      string
+	}{
+		"default":  {template: "{file}", key: "file.zip"},
+		"time":     {template: "{bucket}/{yyyy}-{MM}-{dd}T{HH}:{mm}:{ss}/{file}", key: "logs/2023-01-02T03:04:05/file.zip"},
+		"prefix":   {template: "logs/{service}/{yyyy}/{MM}/{dd}/", key: "logs/api/2023/01/02/file.zip"},
+		"no slash": {template: "{k8s.namespace}", key: "prod_eu/file.zip"},
+		"missing":  {template: "{empty}/{missing}/{file}", key: "_/_/file.zip"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			template, err := parseObjectKeyTemplate(tc.template)
+			require.NoError(t, err)
+
+			root, err := insaneJSON.DecodeString(event)
+			require.NoError(t, err)
+			defer insaneJSON.Release(root)
+
+			values := template.fieldValues(&pipeline.Event{Root: root})
+			assert.Equal(t, tc.key, template.render("logs", "file.zip", now, values))
+		})
+	}
+
+	for _, template := range []string{"/logs/{file}", "logs/{service", "logs/{}/"} {
+		_, err := parseObjectKeyTemplate(template)
+		assert.Error(t, err, template)
+	}
+}
+
+func TestIsValidBucketName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"logs":           true,
+		"logs-2023.prod": true,
+		"lo":             false,
+		"Logs":           false,
+		"-logs":          false,
+		"logs.":          false,
+		"logs..prod":     false,
+		"logs.-prod":     false,
+		"logs_prod":      false,
+		"192.168.1.1":    false,
+		"logs/prod":      false,
+		"a-very-long-bucket-name-which-is-longer-than-sixty-three-letters": false,
+	} {
+		assert.Equal(t, valid, isValidBucketName(name), name)
+	}
+}
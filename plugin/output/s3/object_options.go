@@ -0,0 +1,105 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
+)
+
+const (
+	sseNone = "none"
+	sseS3   = "sse-s3"
+	sseKMS  = "sse-kms"
+
+	objectLockNone       = "none"
+	objectLockGovernance = "governance"
+	objectLockCompliance = "compliance"
+)
+
+// objectHeaders adds the tagging and object lock headers to the uploads along with the encryption ones,
+// because minio-go doesn't support them in the object options.
+// Only the requests creating the objects marshal the encryption headers, so the parts uploads aren't affected.
+type objectHeaders struct {
+	sse     encrypt.ServerSide
+	headers http.Header
+}
+
+func (h *objectHeaders) Type() encrypt.Type {
+	if h.sse == nil {
+		return ""
+	}
+	return h.sse.Type()
+}
+
+func (h *objectHeaders) Marshal(header http.Header) {
+	if h.sse != nil {
+		h.sse.Marshal(header)
+	}
+	for k, v := range h.headers {
+		header[k] = v
+	}
+}
+
+// newServerSideEncryption returns the encryption of the objects by the config or nil if it's disabled.
+func newServerSideEncryption(config *Config) (encrypt.ServerSide, error) {
+	switch config.ServerSideEncryption {
+	case sseS3:
+		return encrypt.NewSSE(), nil
+	case sseKMS:
+		if config.SSEKMSKeyID == "" {
+			return nil, fmt.Errorf("sse_kms_key_id isn't set")
+		}
+		return encrypt.NewSSEKMS(config.SSEKMSKeyID, nil)
+	default:
+		return nil, nil
+	}
+}
+
+func isObjectLockEnabled(config *Config) bool {
+	return config.ObjectLockMode == objectLockGovernance || config.ObjectLockMode == objectLockCompliance
+}
+
+// encodeTags returns the tags as the URL query which is expected by the tagging header.
+func encodeTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	query := make([]string, 0, len(keys))
+	for _, k := range keys {
+		query = append(query, url.QueryEscape(k)+"="+url.QueryEscape(tags[k]))
+	}
+	return strings.Join(query, "&")
+}
+
+// getObjectOptions returns the options of the uploaded objects: the compressor ones with the encryption,
+// storage class, tagging and object lock settings of the config.
+func (p *Plugin) getObjectOptions() minio.PutObjectOptions {
+	opts := p.compressor.getObjectOptions()
+	opts.StorageClass = p.config.StorageClass
+
+	headers := make(http.Header)
+	if len(p.config.Tags) > 0 {
+		headers.Set("X-Amz-Tagging", encodeTags(p.config.Tags))
+	}
+	if isObjectLockEnabled(p.config) {
+		retainUntil := time.Now().Add(p.config.ObjectLockRetention_).UTC()
+		headers.Set("X-Amz-Object-Lock-Mode", strings.ToUpper(p.config.ObjectLockMode))
+		headers.Set("X-Amz-Object-Lock-Retain-Until-Date", retainUntil.Format(time.RFC3339))
+	}
+
+	if len(headers) == 0 {
+		opts.ServerSideEncryption = p.sse
+		return opts
+	}
+	opts.ServerSideEncryption = &objectHeaders{sse: p.sse, headers: headers}
+	return opts
+}
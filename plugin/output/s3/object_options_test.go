@@ -0,0 +1,55 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetObjectOptions(t *testing.T) {
+	config := &Config{
+		ServerSideEncryption: sseKMS,
+		SSEKMSKeyID:          "key",
+		StorageClass:         "STANDARD_IA",
+		Tags:                 map[string]string{"team": "logs", "retention": "30 days"},
+		ObjectLockMode:       objectLockCompliance,
+		ObjectLockRetention_: time.Hour,
+	}
+	sse, err := newServerSideEncryption(config)
+	require.NoError(t, err)
+
+	p := &Plugin{config: config, compressor: newZipCompressor(logger.Instance), sse: sse}
+	header := p.getObjectOptions().Header()
+
+	assert.Equal(t, "application/zip", header.Get("Content-Type"))
+	assert.Equal(t, "aws:kms", header.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "key", header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	assert.Equal(t, "STANDARD_IA", header.Get("X-Amz-Storage-Class"))
+	assert.Equal(t, "retention=30+days&team=logs", header.Get("X-Amz-Tagging"))
+	assert.Equal(t, "COMPLIANCE", header.Get("X-Amz-Object-Lock-Mode"))
+
+	retainUntil, err := time.Parse(time.RFC3339, header.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), retainUntil, time.Minute)
+}
+
+func TestGetObjectOptionsDefault(t *testing.T) {
+	p := &Plugin{config: &Config{ServerSideEncryption: sseNone, ObjectLockMode: objectLockNone}, compressor: newZipCompressor(logger.Instance)}
+	opts := p.getObjectOptions()
+
+	assert.Nil(t, opts.ServerSideEncryption)
+	assert.Empty(t, opts.StorageClass)
+}
+
+func TestServerSideEncryptionConfig(t *testing.T) {
+	_, err := newServerSideEncryption(&Config{ServerSideEncryption: sseKMS})
+	assert.Error(t, err, "key id is required")
+
+	sse, err := newServerSideEncryption(&Config{ServerSideEncryption: sseS3})
+	require.NoError(t, err)
+	header := (&Plugin{config: &Config{}, compressor: newZipCompressor(logger.Instance), sse: sse}).getObjectOptions().Header()
+	assert.Equal(t, "AES256", header.Get("X-Amz-Server-Side-Encryption"))
+}
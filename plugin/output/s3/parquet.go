@@ -0,0 +1,237 @@
+package s3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow/go/v11/arrow"
+	"github.com/apache/arrow/go/v11/arrow/array"
+	"github.com/apache/arrow/go/v11/arrow/memory"
+	"github.com/apache/arrow/go/v11/parquet"
+	"github.com/apache/arrow/go/v11/parquet/compress"
+	"github.com/apache/arrow/go/v11/parquet/pqarrow"
+	"github.com/minio/minio-go"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+const (
+	parquetName = "parquet"
+
+	parquetColumnInt       = "int"
+	parquetColumnFloat     = "float"
+	parquetColumnString    = "string"
+	parquetColumnBool      = "bool"
+	parquetColumnTimestamp = "timestamp"
+)
+
+var parquetCodecs = map[string]compress.Compression{
+	"uncompressed": compress.Codecs.Uncompressed,
+	"snappy":       compress.Codecs.Snappy,
+	"gzip":         compress.Codecs.Gzip,
+	"zstd":         compress.Codecs.Zstd,
+}
+
+type ParquetColumn struct {
+	Name       string `json:"name" required:"true"`
+	ColumnType string `json:"type" required:"true" options:"int|float|string|bool|timestamp"`
+}
+
+type ParquetConfig struct {
+	// Columns are the event fields written to the objects, the missing fields and the fields of the wrong types are nulls.
+	Columns []ParquetColumn `json:"columns" slice:"true"`
+	// Codec compresses the data pages.
+	Codec string `json:"codec" default:"snappy" options:"uncompressed|snappy|gzip|zstd"`
+	// RowGroupSize is the max number of rows in the row group.
+	RowGroupSize int `json:"row_group_size" default:"100000"`
+}
+
+// parquetCompressor converts the files of the events to the Parquet objects.
+type parquetCompressor struct {
+	logger  *zap.SugaredLogger
+	config  *ParquetConfig
+	options minio.PutObjectOptions
+	schema  *arrow.Schema
+}
+
+func newParquetCompressor(config *Config, logger *zap.SugaredLogger) compressor {
+	if len(config.Parquet.Columns) == 0 {
+		logger.Fatalf("parquet columns aren't set")
+	}
+	if config.Parquet.RowGroupSize <= 0 {
+		logger.Fatalf("parquet row group size must be positive")
+	}
+
+	c := parquetCompressor{logger: logger, config: &config.Parquet}
+	c.options = c.getObjectOptions()
+
+	fields := make([]arrow.Field, 0, len(c.config.Columns))
+	for _, column := range c.config.Columns {
+		fields = append(fields, arrow.Field{Name: column.Name, Type: parquetDataType(column.ColumnType), Nullable: true})
+	}
+	c.schema = arrow.NewSchema(fields, nil)
+
+	return &c
+}
+
+func (c *parquetCompressor) getName(fileName string) string {
+	return fmt.Sprintf("%s.%s", fileName, parquetName)
+}
+
+func (c *parquetCompressor) compress(archiveName, fileName string) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		c.logger.Panicf("could not open file: %s, error: %s", fileName, err.Error())
+	}
+	defer file.Close()
+
+	parquetFile, err := os.Create(archiveName)
+	if err != nil {
+		c.logger.Panicf("could not create parquet file: %s, error: %s", archiveName, err.Error())
+	}
+	defer parquetFile.Close()
+
+	out := bufio.NewWriter(parquetFile)
+	if err := c.convert(out, bufio.NewReader(file)); err != nil {
+		c.logger.Panicf("could not convert file: %s to parquet, error: %s", fileName, err.Error())
+	}
+	if err := out.Flush(); err != nil {
+		c.logger.Panicf("could not write parquet file: %s, error: %s", archiveName, err.Error())
+	}
+}
+
+// convert writes the events of the reader, one per line, to the Parquet file.
+func (c *parquetCompressor) convert(out io.Writer, in *bufio.Reader) error {
+	props := parquet.NewWriterProperties(
+		parquet.WithCompression(parquetCodecs[c.config.Codec]),
+		parquet.WithMaxRowGroupLength(int64(c.config.RowGroupSize)),
+	)
+	writer, err := pqarrow.NewFileWriter(c.schema, out, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return err
+	}
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, c.schema)
+	defer builder.Release()
+
+	// every record is written as a row group
+	rows := 0
+	writeRowGroup := func() error {
+		if rows == 0 {
+			return nil
+		}
+		record := builder.NewRecord()
+		defer record.Release()
+		rows = 0
+		return writer.Write(record)
+	}
+
+	root := insaneJSON.Spawn()
+	defer insaneJSON.Release(root)
+
+	for {
+		line, err := in.ReadBytes('\n')
+		if len(line) > 0 {
+			if decodeErr := root.DecodeBytes(line); decodeErr != nil {
+				c.logger.Errorf("skipping wrong event in parquet file: %s", decodeErr.Error())
+			} else {
+				for i, column := range c.config.Columns {
+					appendParquetValue(builder.Field(i), column.ColumnType, root.Dig(column.Name))
+				}
+				rows++
+				if rows == c.config.RowGroupSize {
+					if err := writeRowGroup(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeRowGroup(); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func (c *parquetCompressor) getObjectOptions() minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		ContentType: "application/vnd.apache.parquet",
+	}
+}
+
+func (c *parquetCompressor) getExtension() string {
+	return fmt.Sprintf(".%s", parquetName)
+}
+
+func parquetDataType(columnType string) arrow.DataType {
+	switch columnType {
+	case parquetColumnInt:
+		return arrow.PrimitiveTypes.Int64
+	case parquetColumnFloat:
+		return arrow.PrimitiveTypes.Float64
+	case parquetColumnBool:
+		return arrow.FixedWidthTypes.Boolean
+	case parquetColumnTimestamp:
+		return arrow.FixedWidthTypes.Timestamp_ms
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// appendParquetValue converts the event field to the column type,
+// the numbers are accepted as strings as well, timestamps are unix seconds or RFC3339 strings.
+func appendParquetValue(b array.Builder, columnType string, node *insaneJSON.Node) {
+	if node == nil || node.IsNull() {
+		b.AppendNull()
+		return
+	}
+
+	isScalar := node.IsNumber() || node.IsString()
+	switch columnType {
+	case parquetColumnInt:
+		if v, err := strconv.ParseInt(node.AsString(), 10, 64); isScalar && err == nil {
+			b.(*array.Int64Builder).Append(v)
+			return
+		}
+	case parquetColumnFloat:
+		if v, err := strconv.ParseFloat(node.AsString(), 64); isScalar && err == nil {
+			b.(*array.Float64Builder).Append(v)
+			return
+		}
+	case parquetColumnBool:
+		if node.IsTrue() || node.IsFalse() {
+			b.(*array.BooleanBuilder).Append(node.IsTrue())
+			return
+		}
+	case parquetColumnTimestamp:
+		if node.IsNumber() {
+			b.(*array.TimestampBuilder).Append(arrow.Timestamp(node.AsFloat() * 1000))
+			return
+		}
+		if t, err := time.Parse(time.RFC3339Nano, node.AsString()); node.IsString() && err == nil {
+			b.(*array.TimestampBuilder).Append(arrow.Timestamp(t.UnixMilli()))
+			return
+		}
+	default:
+		if node.IsString() {
+			b.(*array.StringBuilder).Append(node.AsString())
+		} else {
+			b.(*array.StringBuilder).Append(node.EncodeToString())
+		}
+		return
+	}
+
+	b.AppendNull()
+}
@@ -0,0 +1,116 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow/go/v11/arrow"
+	"github.com/apache/arrow/go/v11/arrow/array"
+	"github.com/apache/arrow/go/v11/arrow/memory"
+	"github.com/apache/arrow/go/v11/parquet"
+	"github.com/apache/arrow/go/v11/parquet/compress"
+	"github.com/apache/arrow/go/v11/parquet/file"
+	"github.com/apache/arrow/go/v11/parquet/pqarrow"
+	"github.com/ozontech/file.d/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+func TestAppendParquetValue(t *testing.T) {
+	type testCase struct {
+		columnType string
+		json       string
+		values     string
+	}
+
+	for name, tc := range map[string]testCase{
+		"int": {
+			columnType: parquetColumnInt,
+			json:       `{"v":[1,"2","x",null,{},1.5]}`,
+			values:     `[1 2 (null) (null) (null) (null)]`,
+		},
+		"timestamp": {
+			columnType: parquetColumnTimestamp,
+			json:       `{"v":[1.5,"2023-01-02T03:04:05.123Z","yesterday"]}`,
+			values:     `[1500 1672628645123 (null)]`,
+		},
+		"bool": {
+			columnType: parquetColumnBool,
+			json:       `{"v":[true,"true",false]}`,
+			values:     `[true (null) false]`,
+		},
+		"string": {
+			columnType: parquetColumnString,
+			json:       `{"v":["a",{"b":1}]}`,
+			values:     `["a" "{\"b\":1}"]`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root, err := insaneJSON.DecodeString(tc.json)
+			require.NoError(t, err)
+			defer insaneJSON.Release(root)
+
+			b := array.NewBuilder(memory.DefaultAllocator, parquetDataType(tc.columnType))
+			defer b.Release()
+			for _, node := range root.Dig("v").AsArray() {
+				appendParquetValue(b, tc.columnType, node)
+			}
+			values := b.NewArray()
+			defer values.Release()
+			assert.Equal(t, tc.values, values.String())
+		})
+	}
+}
+
+func chunksToStrings(chunked *arrow.Chunked) []string {
+	out := make([]string, 0, len(chunked.Chunks()))
+	for _, chunk := range chunked.Chunks() {
+		out = append(out, chunk.String())
+	}
+	return out
+}
+
+func TestParquetCompress(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "events.log")
+	require.NoError(t, os.WriteFile(fileName, []byte("{\"level\":\"info\",\"code\":1}\nbroken\n{\"level\":\"error\"}\n{\"code\":\"3\"}"), 0o644))
+
+	config := &Config{Parquet: ParquetConfig{
+		Columns: []ParquetColumn{
+			{Name: "level", ColumnType: parquetColumnString},
+			{Name: "code", ColumnType: parquetColumnInt},
+		},
+		Codec:        "zstd",
+		RowGroupSize: 2,
+	}}
+	c := newParquetCompressor(config, logger.Instance)
+	archiveName := c.getName(fileName)
+	c.compress(archiveName, fileName)
+	assert.Equal(t, "events.log.parquet", filepath.Base(archiveName))
+
+	data, err := os.ReadFile(archiveName)
+	require.NoError(t, err)
+	reader, err := file.NewParquetReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer reader.Close()
+
+	assert.Equal(t, int64(3), reader.NumRows())
+	assert.Equal(t, 2, reader.NumRowGroups(), "rows must be split by row_group_size")
+	column, err := reader.MetaData().RowGroup(0).ColumnChunk(0)
+	require.NoError(t, err)
+	assert.Equal(t, compress.Codecs.Zstd, column.Compression())
+
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(data), parquet.NewReaderProperties(nil), pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	require.NoError(t, err)
+	defer table.Release()
+
+	require.Equal(t, int64(2), table.NumCols())
+	assert.Equal(t, "level", table.Column(0).Name())
+	assert.Equal(t, []string{`["info" "error" (null)]`}, chunksToStrings(table.Column(0).Data()))
+	assert.Equal(t, "code", table.Column(1).Name())
+	assert.Equal(t, []string{`[1 (null) 3]`}, chunksToStrings(table.Column(1).Data()))
+}
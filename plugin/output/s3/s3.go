@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
 	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
 	"github.com/ozontech/file.d/longpanic"
@@ -104,6 +105,18 @@ pipelines:
 }*/
 
 const (
+	outPluginType = "s3"
+
+	checksumModeAuto   = "auto"
+	checksumModeMD5    = "md5"
+	checksumModeSHA256 = "sha256"
+	checksumModeNone   = "none"
+
+	// minPartSize is the minimal size of the multipart upload part allowed by S3.
+	minPartSize = 5 * cfg.MiB
+	// defaultPartSize is used for uploads by parts if part_size isn't set.
+	defaultPartSize = 64 * cfg.MiB
+
 	fileNameSeparator  = "_"
 	attemptIntervalMin = 1 * time.Second
 	dirSep             = "/"
@@ -113,8 +126,11 @@ const (
 
 var (
 	attemptInterval = attemptIntervalMin
-	compressors     = map[string]func(*zap.SugaredLogger) compressor{
-		zipName: newZipCompressor,
+	compressors     = map[string]func(*Config, *zap.SugaredLogger) compressor{
+		zipName: func(_ *Config, logger *zap.SugaredLogger) compressor {
+			return newZipCompressor(logger)
+		},
+		parquetName: newParquetCompressor,
 	}
 
 	r = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -152,12 +168,25 @@ type Plugin struct {
 	uploadCh   chan fileDTO
 
 	compressor compressor
+	objectKey  *objectKeyTemplate
+	sse        encrypt.ServerSide
 	metricCtl  *metric.Ctl
 
 	// plugin metrics
 
-	sendErrorMetric  *prometheus.CounterVec
-	uploadFileMetric *prometheus.CounterVec
+	sendErrorMetric     *prometheus.CounterVec
+	uploadFileMetric    *prometheus.CounterVec
+	invalidBucketMetric *prometheus.CounterVec
+
+	// stream upload mode
+
+	streamBatcher        *pipeline.Batcher
+	streamCancel         context.CancelFunc
+	streamWg             sync.WaitGroup
+	streamMu             sync.Mutex
+	streamObjects        map[string]*streamObject
+	streamFileNames      map[string]string
+	streamDynamicBuckets map[string]bool
 }
 
 type fileDTO struct {
@@ -186,8 +215,46 @@ type Config struct {
 
 	// > @3@4@5@6
 	// >
-	// > Compressed files format.
-	CompressionType string `json:"compression_type" default:"zip" options:"zip"` // *
+	// > The way to upload the events:
+	// > * `file` – the events are written to the local files which are compressed and uploaded after sealing up
+	// > * `stream` – the events are compressed in memory and uploaded by multipart uploads without local files
+	// >
+	// > In the `stream` mode the parts of `part_size` are uploaded once they are filled, so the memory buffer of each bucket is limited by `part_size`.
+	// > The objects are completed every `file_config.retention_interval`, the batches are configured by `file_config` as well.
+	// > > ⚠ The events are committed once they are compressed in memory, so the uncompleted objects are lost on crash.
+	UploadMode string `json:"upload_mode" default:"file" options:"file|stream"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Compressed files format:
+	// > * `zip` – the files of the events are zipped as is
+	// > * `parquet` – the events are converted to Parquet objects by the `parquet` settings
+	// >
+	// > The `stream` upload mode supports `zip` only.
+	CompressionType string `json:"compression_type" default:"zip" options:"zip|parquet"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Parquet objects settings:
+	// > * `columns` – the list of the columns, each column has the event field `name` and the `type` – one of `int`, `float`, `string`, `bool`, `timestamp`;
+	// > the missing fields and the values of other types are written as nulls, objects and arrays of the `string` columns are written as JSON,
+	// > `timestamp` columns accept unix seconds or RFC3339 strings
+	// > * `codec` – the compression codec of the data pages, one of `uncompressed`, `snappy`, `gzip`, `zstd`, default is `snappy`
+	// > * `row_group_size` – the max number of rows in the row group, default is `100000`
+	// >
+	// > ```yaml
+	// > compression_type: parquet
+	// > parquet:
+	// >   codec: zstd
+	// >   columns:
+	// >     - name: time
+	// >       type: timestamp
+	// >     - name: level
+	// >       type: string
+	// >     - name: status
+	// >       type: int
+	// > ```
+	Parquet ParquetConfig `json:"parquet" child:"true"` // *
 
 	// s3 section
 	// > @3@4@5@6
@@ -224,9 +291,22 @@ type Config struct {
 	// > @3@4@5@6
 	// >
 	// > Change destination bucket of event.
-	// > Fallback to DefaultBucket if BucketEventField bucket doesn't exist.
+	// > Fallback to DefaultBucket if BucketEventField bucket doesn't exist or its name isn't valid S3 bucket name.
 	BucketEventField string `json:"bucket_field_event" default:""` // *
 
+	// > @3@4@5@6
+	// >
+	// > Template of the object keys. The placeholders are:
+	// > * `{file}` – the generated object name, e.g. `file-d_01-02-2006_15:04:05.log.1a2b3c4d.zip`
+	// > * `{bucket}` – the bucket name
+	// > * `{yyyy}`, `{MM}`, `{dd}`, `{HH}`, `{mm}`, `{ss}` – the time parts of the upload in the `file` mode or the object creation in the `stream` mode
+	// > * `{field.path}` – the value of the event field, the missing and empty fields are `_`, slashes are replaced by `_`
+	// >
+	// > The template without `{file}` is the prefix, the generated object name is appended to it,
+	// > e.g. `logs/{service}/{yyyy}/{MM}/{dd}/`.
+	// > > ⚠ The event fields are supported by the `stream` upload mode only, the events with different values are written to the different objects.
+	ObjectKey string `json:"object_key" default:"{file}"` // *
+
 	// > @3@4@5@6
 	// >
 	// > Regulates number of buckets that can be created dynamically.
@@ -237,6 +317,84 @@ type Config struct {
 	// > Sets upload timeout.
 	UploadTimeout  cfg.Duration `json:"upload_timeout" default:"1m" parse:"duration"` // *
 	UploadTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > S3 region. If set, the client doesn't request bucket locations,
+	// > which isn't supported by some S3-compatible stores.
+	// > Applied to all buckets.
+	Region string `json:"region" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Forces path-style addressing (`http://endpoint/bucket/object`) instead of virtual-hosted style.
+	// > Required by MinIO and Ceph RGW installations without wildcard DNS.
+	// > Applied to all buckets.
+	ForcePathStyle bool `json:"force_path_style" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA bundle used to verify the S3 endpoints.
+	// > Applied to all buckets.
+	CACert string `json:"ca_cert" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Payload checksum mode of uploads:
+	// > * `auto` – the client library decides which checksums to send, `md5` is used if `part_size` is set
+	// > * `md5` – every part is sent with `Content-MD5` header
+	// > * `sha256` – every part is signed with its SHA-256 hash
+	// > * `none` – no payload checksums are sent, payload is marked as `UNSIGNED-PAYLOAD`
+	// >
+	// > Any mode except `auto` uploads files by parts of `part_size`.
+	// > > ⚠ For insecure endpoints the client always uses the streaming (aws-chunked) signature, use `secure: true` to avoid it.
+	ChecksumMode string `json:"checksum_mode" default:"auto" options:"auto|md5|sha256|none"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Size of the multipart upload part, e.g. `16 MiB`. Must be at least `5 MiB`.
+	// > Zero means `64 MiB` for uploads by parts, otherwise the part size is chosen by the client library.
+	PartSize  string `json:"part_size" default:"0 b" parse:"data_unit"` // *
+	PartSize_ uint64
+
+	// > @3@4@5@6
+	// >
+	// > Server-side encryption of the objects:
+	// > * `none` – the objects are encrypted by the bucket settings
+	// > * `sse-s3` – the objects are encrypted by the keys managed by S3
+	// > * `sse-kms` – the objects are encrypted by the KMS key `sse_kms_key_id`
+	ServerSideEncryption string `json:"server_side_encryption" default:"none" options:"none|sse-s3|sse-kms"` // *
+
+	// > @3@4@5@6
+	// >
+	// > ID or ARN of the KMS key used by the `sse-kms` encryption.
+	SSEKMSKeyID string `json:"sse_kms_key_id" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Storage class of the objects, e.g. `STANDARD_IA` or `GLACIER_IR`. The bucket default is used if it's empty.
+	StorageClass string `json:"storage_class" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Tags of the objects, e.g. `{"retention": "30d", "team": "logs"}`, which can be used by the lifecycle rules.
+	Tags map[string]string `json:"tags"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Object lock retention mode of the objects, the bucket must have the object lock enabled:
+	// > * `none` – the bucket default retention is applied
+	// > * `governance` – the objects can't be deleted or overwritten until `object_lock_retention` passes unless the user has special permissions
+	// > * `compliance` – the objects can't be deleted or overwritten by anyone until `object_lock_retention` passes
+	// >
+	// > S3 requires `Content-MD5` of the locked objects, so `checksum_mode` must be `md5`.
+	ObjectLockMode string `json:"object_lock_mode" default:"none" options:"none|governance|compliance"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Retention period of the locked objects counted from the upload.
+	ObjectLockRetention  cfg.Duration `json:"object_lock_retention" default:"0s" parse:"duration"` // *
+	ObjectLockRetention_ time.Duration
 }
 
 func (c *Config) IsMultiBucketExists(bucketName string) bool {
@@ -255,7 +413,7 @@ func (c *Config) IsMultiBucketExists(bucketName string) bool {
 
 func init() {
 	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
-		Type:    "s3",
+		Type:    outPluginType,
 		Factory: Factory,
 	})
 }
@@ -271,6 +429,7 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
 	p.sendErrorMetric = ctl.RegisterCounter("output_s3_send_error", "Total s3 send errors")
 	p.uploadFileMetric = ctl.RegisterCounter("output_s3_upload_file", "Total files upload", "bucket_name")
+	p.invalidBucketMetric = ctl.RegisterCounter("output_s3_invalid_bucket", "Total events with invalid bucket names")
 	p.metricCtl = ctl
 }
 
@@ -290,7 +449,36 @@ func (p *Plugin) StartWithMinio(config pipeline.AnyConfig, params *pipeline.Outp
 	if !ok {
 		p.logger.Fatalf("compression type: %s is not supported", p.config.CompressionType)
 	}
-	p.compressor = newCompressor(p.logger)
+	p.compressor = newCompressor(p.config, p.logger)
+	if p.config.UploadMode == uploadModeStream && p.config.CompressionType != zipName {
+		p.logger.Fatalf("compression type %s isn't supported by the stream upload mode", p.config.CompressionType)
+	}
+
+	objectKey, err := parseObjectKeyTemplate(p.config.ObjectKey)
+	if err != nil {
+		p.logger.Fatalf("can't parse object key: %s", err.Error())
+	}
+	if objectKey.fields > 0 && p.config.UploadMode != uploadModeStream {
+		p.logger.Fatalf("event fields of object key are supported by the stream upload mode only")
+	}
+	p.objectKey = objectKey
+
+	p.sse, err = newServerSideEncryption(p.config)
+	if err != nil {
+		p.logger.Fatalf("can't set up server-side encryption: %s", err.Error())
+	}
+	if isObjectLockEnabled(p.config) {
+		if p.config.ObjectLockRetention_ <= 0 {
+			p.logger.Fatalf("object lock retention must be positive")
+		}
+		if p.config.ChecksumMode != checksumModeMD5 {
+			p.logger.Fatalf("object lock requires %s checksum mode", checksumModeMD5)
+		}
+	}
+
+	if p.config.PartSize_ != 0 && p.config.PartSize_ < minPartSize {
+		p.logger.Fatalf("part size %d is less than minimal %d", p.config.PartSize_, minPartSize)
+	}
 
 	// dir for all bucket files.
 	targetDirs, err := p.getStaticDirs(outPlugCount)
@@ -306,6 +494,11 @@ func (p *Plugin) StartWithMinio(config pipeline.AnyConfig, params *pipeline.Outp
 	p.defaultClient = defaultClient
 	p.clients = clients
 
+	if p.config.UploadMode == uploadModeStream {
+		p.startStream(params, p.getFileNames(outPlugCount))
+		return
+	}
+
 	// dynamicDirs needs defaultClient set.
 	dynamicDirs := p.getDynamicDirsArtifacts(targetDirs)
 	// file for each bucket.
@@ -331,10 +524,18 @@ func (p *Plugin) StartWithMinio(config pipeline.AnyConfig, params *pipeline.Outp
 }
 
 func (p *Plugin) Stop() {
+	if p.config.UploadMode == uploadModeStream {
+		p.stopStream()
+		return
+	}
 	p.outPlugins.Stop()
 }
 
 func (p *Plugin) Out(event *pipeline.Event) {
+	if p.config.UploadMode == uploadModeStream {
+		p.streamBatcher.Add(event)
+		return
+	}
 	p.outPlugins.Out(event, pipeline.PluginSelector{
 		CondType:  pipeline.ByNameSelector,
 		CondValue: p.getBucketName(event),
@@ -354,6 +555,11 @@ func (p *Plugin) getBucketName(event *pipeline.Event) string {
 		return bucketName
 	}
 
+	if !isValidBucketName(bucketName) {
+		p.invalidBucketMetric.WithLabelValues().Inc()
+		return p.config.DefaultBucket
+	}
+
 	// try to create dynamic bucketName
 	if created := p.tryRunNewPlugin(bucketName); created {
 		// succeed, return new bucketName
@@ -404,6 +610,31 @@ func (p *Plugin) tryRunNewPlugin(bucketName string) (isCreated bool) {
 	if p.outPlugins.IsDynamic(bucketName) {
 		return true
 	}
+	if !p.makeDynamicBucket(bucketName) {
+		return false
+	}
+
+	dir, _ := filepath.Split(p.config.FileConfig.TargetFile)
+	bucketDir := filepath.Join(dir, DynamicBucketDir, bucketName) + dirSep
+	// dynamic bucket share s3 credentials with DefaultBucket.
+	anyPlugin, _ := file.Factory()
+	outPlugin := anyPlugin.(*file.Plugin)
+	outPlugin.SealUpCallback = p.addFileJobWithBucket(bucketName)
+
+	localBucketConfig := p.config.FileConfig
+	localBucketConfig.TargetFile = fmt.Sprintf("%s%s%s", bucketDir, bucketName, p.fileExtension)
+	outPlugin.RegisterMetrics(p.metricCtl)
+	outPlugin.Start(&localBucketConfig, p.params)
+
+	p.outPlugins.Add(bucketName, outPlugin)
+	p.limiter.Increment()
+
+	return true
+}
+
+// makeDynamicBucket creates the bucket if it doesn't exist and the limit of dynamic buckets isn't reached.
+// Dynamic buckets share s3 credentials with DefaultBucket.
+func (p *Plugin) makeDynamicBucket(bucketName string) bool {
 	// If limit of dynamic buckets reached fallback to DefaultBucket.
 	if !p.limiter.CanCreate() {
 		p.logger.Warn(
@@ -429,21 +660,6 @@ func (p *Plugin) tryRunNewPlugin(bucketName string) (isCreated bool) {
 		}
 	}
 
-	dir, _ := filepath.Split(p.config.FileConfig.TargetFile)
-	bucketDir := filepath.Join(dir, DynamicBucketDir, bucketName) + dirSep
-	// dynamic bucket share s3 credentials with DefaultBucket.
-	anyPlugin, _ := file.Factory()
-	outPlugin := anyPlugin.(*file.Plugin)
-	outPlugin.SealUpCallback = p.addFileJobWithBucket(bucketName)
-
-	localBucketConfig := p.config.FileConfig
-	localBucketConfig.TargetFile = fmt.Sprintf("%s%s%s", bucketDir, bucketName, p.fileExtension)
-	outPlugin.RegisterMetrics(p.metricCtl)
-	outPlugin.Start(&localBucketConfig, p.params)
-
-	p.outPlugins.Add(bucketName, outPlugin)
-	p.limiter.Increment()
-
 	return true
 }
 
@@ -561,12 +777,23 @@ func (p *Plugin) uploadToS3(compressedDTO fileDTO) error {
 	ctx, cancel := context.WithTimeout(context.Background(), p.config.UploadTimeout_)
 	defer cancel()
 
-	_, err := cl.FPutObjectWithContext(
-		ctx,
-		compressedDTO.bucketName, p.generateObjectName(compressedDTO.fileName),
-		compressedDTO.fileName,
-		p.compressor.getObjectOptions(),
-	)
+	var err error
+	if mc, ok := cl.(*minio.Client); ok && p.uploadByParts() {
+		err = p.putObjectByParts(
+			ctx,
+			minio.Core{Client: mc},
+			compressedDTO.bucketName, p.generateObjectName(compressedDTO.bucketName, compressedDTO.fileName, nil),
+			compressedDTO.fileName,
+			p.getObjectOptions(),
+		)
+	} else {
+		_, err = cl.FPutObjectWithContext(
+			ctx,
+			compressedDTO.bucketName, p.generateObjectName(compressedDTO.bucketName, compressedDTO.fileName, nil),
+			compressedDTO.fileName,
+			p.getObjectOptions(),
+		)
+	}
 
 	if err != nil {
 		p.sendErrorMetric.WithLabelValues().Inc()
@@ -575,11 +802,12 @@ func (p *Plugin) uploadToS3(compressedDTO fileDTO) error {
 	return nil
 }
 
-// generateObjectName generates object name by compressed file name
-func (p *Plugin) generateObjectName(name string) string {
+// generateObjectName generates object name by compressed file name and the object key template.
+func (p *Plugin) generateObjectName(bucketName, name string, fieldValues []string) string {
 	n := strconv.FormatInt(r.Int63n(math.MaxInt64), 16)
 	n = n[len(n)-8:]
 	objectName := path.Base(name)
 	objectName = objectName[0 : len(objectName)-len(p.compressor.getExtension())]
-	return fmt.Sprintf("%s.%s%s", objectName, n, p.compressor.getExtension())
+	objectName = fmt.Sprintf("%s.%s%s", objectName, n, p.compressor.getExtension())
+	return p.objectKey.render(bucketName, objectName, time.Now(), fieldValues)
 }
@@ -3,12 +3,15 @@ package s3
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 
 	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin/output/file"
+	"github.com/ozontech/file.d/tls"
 )
 
 var (
@@ -21,13 +24,13 @@ type objStoreFactory func(cfg *Config) (ObjectStoreClient, map[string]ObjectStor
 func (p *Plugin) minioClientsFactory(cfg *Config) (ObjectStoreClient, map[string]ObjectStoreClient, error) {
 	minioClients := make(map[string]ObjectStoreClient)
 	// initialize minio clients object for main bucket.
-	defaultClient, err := minio.New(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, cfg.Secure)
+	defaultClient, err := newMinioClient(cfg, cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, cfg.Secure)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	for _, singleBucket := range cfg.MultiBuckets {
-		client, err := minio.New(singleBucket.Endpoint, singleBucket.AccessKey, singleBucket.SecretKey, singleBucket.Secure)
+		client, err := newMinioClient(cfg, singleBucket.Endpoint, singleBucket.AccessKey, singleBucket.SecretKey, singleBucket.Secure)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -38,6 +41,37 @@ func (p *Plugin) minioClientsFactory(cfg *Config) (ObjectStoreClient, map[string
 	return defaultClient, minioClients, nil
 }
 
+// newMinioClient creates minio client applying S3-compatibility settings of the config.
+func newMinioClient(cfg *Config, endpoint, accessKey, secretKey string, secure bool) (*minio.Client, error) {
+	bucketLookup := minio.BucketLookupAuto
+	if cfg.ForcePathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.NewWithOptions(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:       secure,
+		Region:       cfg.Region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CACert != "" {
+		b := tls.NewConfigBuilder()
+		if err := b.AppendCARoot(cfg.CACert); err != nil {
+			return nil, fmt.Errorf("can't append CA root: %w", err)
+		}
+
+		transport := minio.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = b.Build()
+		client.SetCustomTransport(transport)
+	}
+
+	return client, nil
+}
+
 func (p *Plugin) getStaticDirs(outPlugCount int) (map[string]string, error) {
 	// dir for all bucket files.
 	dir, _ := filepath.Split(p.config.FileConfig.TargetFile)
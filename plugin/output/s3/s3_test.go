@@ -215,7 +215,7 @@ func TestStartWithMultiBuckets(t *testing.T) {
 		t.Skip("skip long tests in short mode")
 	}
 	// will be created.
-	dynamicBucket := "FAKE_BUCKET"
+	dynamicBucket := "fake-bucket"
 
 	buckets := []string{"main", "multi_bucket1", "multi_bucket2"}
 	tests := struct {
@@ -0,0 +1,316 @@
+package s3
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/ozontech/file.d/pipeline"
+)
+
+const (
+	uploadModeFile   = "file"
+	uploadModeStream = "stream"
+)
+
+// streamObject is the object uploaded by parts while the events are written to it.
+type streamObject struct {
+	mu sync.Mutex
+
+	bucketName string
+	objectName string
+	uploadID   string
+	parts      []minio.CompletePart
+
+	// buf contains the compressed data which isn't uploaded yet.
+	buf   bytes.Buffer
+	zip   *zip.Writer
+	entry io.Writer
+	// sealed is true if the object is completed and can't be written anymore.
+	sealed bool
+}
+
+// streamData groups the events of the batch by the objects.
+type streamData struct {
+	objectsData map[string]*streamObjectData
+}
+
+type streamObjectData struct {
+	bucketName  string
+	fieldValues []string
+	buf         []byte
+}
+
+func (p *Plugin) startStream(params *pipeline.OutputPluginParams, fileNames map[string]string) {
+	for bucketName, client := range p.clients {
+		if _, ok := client.(*minio.Client); !ok {
+			p.logger.Fatalf("stream upload mode isn't supported by the client of bucket %s", bucketName)
+		}
+		exists, err := client.BucketExists(bucketName)
+		if err != nil {
+			p.logger.Panicf("%s %s with error: %s", ErrCreateOutputPluginCantCheckBucket.Error(), bucketName, err.Error())
+		}
+		if !exists {
+			p.logger.Fatalf("%s %s", ErrCreateOutputPluginNoSuchBucket.Error(), bucketName)
+		}
+	}
+
+	p.streamFileNames = fileNames
+	p.streamObjects = make(map[string]*streamObject)
+	p.streamDynamicBuckets = make(map[string]bool)
+
+	fileConfig := p.config.FileConfig
+	p.streamBatcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.outStream,
+		Controller:     p.controller,
+		Workers:        fileConfig.WorkersCount_,
+		BatchSizeCount: fileConfig.BatchSize_,
+		BatchSizeBytes: fileConfig.BatchSizeBytes_,
+		FlushTimeout:   fileConfig.BatchFlushTimeout_,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.streamCancel = cancel
+
+	p.streamWg.Add(1)
+	go func() {
+		defer p.streamWg.Done()
+		p.sealStreamObjectsTicker(ctx)
+	}()
+
+	p.streamBatcher.Start(ctx)
+}
+
+// stopStream completes the objects after the batches are written.
+func (p *Plugin) stopStream() {
+	p.streamBatcher.Stop()
+	p.streamCancel()
+	p.streamWg.Wait()
+	p.sealStreamObjects()
+}
+
+func (p *Plugin) outStream(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &streamData{objectsData: make(map[string]*streamObjectData)}
+	}
+	data := (*workerData).(*streamData)
+
+	for _, objectData := range data.objectsData {
+		objectData.buf = objectData.buf[:0]
+	}
+	for _, event := range batch.Events {
+		bucketName := p.getStreamBucketName(event)
+		fieldValues := p.objectKey.fieldValues(event)
+		key := streamObjectKey(bucketName, fieldValues)
+
+		objectData, ok := data.objectsData[key]
+		if !ok {
+			objectData = &streamObjectData{bucketName: bucketName, fieldValues: fieldValues}
+			data.objectsData[key] = objectData
+		}
+		objectData.buf, _ = event.Encode(objectData.buf)
+		objectData.buf = append(objectData.buf, '\n')
+	}
+
+	for key, objectData := range data.objectsData {
+		if len(objectData.buf) == 0 {
+			delete(data.objectsData, key)
+			continue
+		}
+		p.writeStream(objectData.bucketName, objectData.fieldValues, objectData.buf)
+	}
+}
+
+// streamObjectKey identifies the object of the bucket by the values of the object key template.
+func streamObjectKey(bucketName string, fieldValues []string) string {
+	if len(fieldValues) == 0 {
+		return bucketName
+	}
+	return bucketName + "\x00" + strings.Join(fieldValues, "\x00")
+}
+
+// getStreamBucketName decides which s3 bucket shall receive event in the stream mode.
+func (p *Plugin) getStreamBucketName(event *pipeline.Event) string {
+	bucketName := event.Root.Dig(p.config.BucketEventField).AsString()
+	if bucketName == "" {
+		return p.config.DefaultBucket
+	}
+	if _, ok := p.clients[bucketName]; ok {
+		// the name outlives the event in the worker data.
+		return pipeline.CloneString(bucketName)
+	}
+	if !isValidBucketName(bucketName) {
+		p.invalidBucketMetric.WithLabelValues().Inc()
+		return p.config.DefaultBucket
+	}
+
+	p.dynamicPlugCreationMu.Lock()
+	defer p.dynamicPlugCreationMu.Unlock()
+
+	if p.streamDynamicBuckets[bucketName] {
+		return bucketName
+	}
+	bucketName = pipeline.CloneString(bucketName)
+	if !p.makeDynamicBucket(bucketName) {
+		return p.config.DefaultBucket
+	}
+	p.streamDynamicBuckets[bucketName] = true
+	p.limiter.Increment()
+
+	return bucketName
+}
+
+// writeStream writes the data to the current object of the bucket and uploads the filled parts.
+// The object is chosen by the values of the object key template fields.
+func (p *Plugin) writeStream(bucketName string, fieldValues []string, data []byte) {
+	for {
+		obj := p.getStreamObject(bucketName, fieldValues)
+
+		obj.mu.Lock()
+		if obj.sealed {
+			// the object is completed concurrently, so the next one is used.
+			obj.mu.Unlock()
+			continue
+		}
+
+		// writing to the bytes.Buffer never fails.
+		_, _ = obj.entry.Write(data)
+		for obj.buf.Len() >= p.partSize() {
+			p.putStreamPart(obj, obj.buf.Next(p.partSize()))
+		}
+		obj.mu.Unlock()
+		return
+	}
+}
+
+func (p *Plugin) getStreamObject(bucketName string, fieldValues []string) *streamObject {
+	p.streamMu.Lock()
+	defer p.streamMu.Unlock()
+
+	key := streamObjectKey(bucketName, fieldValues)
+	obj, ok := p.streamObjects[key]
+	if !ok {
+		obj = p.newStreamObject(bucketName, fieldValues)
+		p.streamObjects[key] = obj
+	}
+	return obj
+}
+
+func (p *Plugin) newStreamObject(bucketName string, fieldValues []string) *streamObject {
+	fileName, ok := p.streamFileNames[bucketName]
+	if !ok {
+		fileName = bucketName
+	}
+	fileName = fmt.Sprintf("%s%s%s%s", fileName, fileNameSeparator, time.Now().Format(p.config.FileConfig.Layout), p.fileExtension)
+
+	obj := &streamObject{
+		bucketName: bucketName,
+		objectName: p.generateObjectName(bucketName, p.compressor.getName(fileName), fieldValues),
+	}
+	obj.zip = zip.NewWriter(&obj.buf)
+
+	entry, err := obj.zip.CreateHeader(&zip.FileHeader{Name: fileName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		p.logger.Panicf("can't create zip entry of object %s: %s", obj.objectName, err.Error())
+	}
+	obj.entry = entry
+
+	return obj
+}
+
+func (p *Plugin) sealStreamObjectsTicker(ctx context.Context) {
+	ticker := time.NewTicker(p.config.FileConfig.RetentionInterval_)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.sealStreamObjects()
+		}
+	}
+}
+
+// sealStreamObjects completes the current objects, the next writes create the new ones.
+func (p *Plugin) sealStreamObjects() {
+	p.streamMu.Lock()
+	objects := p.streamObjects
+	p.streamObjects = make(map[string]*streamObject, len(objects))
+	p.streamMu.Unlock()
+
+	for _, obj := range objects {
+		obj.mu.Lock()
+		obj.sealed = true
+		p.completeStreamObject(obj)
+		obj.mu.Unlock()
+	}
+}
+
+// completeStreamObject uploads the rest of the object as the last part and completes the upload.
+// The object must be locked.
+func (p *Plugin) completeStreamObject(obj *streamObject) {
+	if err := obj.zip.Close(); err != nil {
+		p.logger.Panicf("can't close zip of object %s: %s", obj.objectName, err.Error())
+	}
+	p.putStreamPart(obj, obj.buf.Bytes())
+
+	p.retryStream(obj, func(core minio.Core) error {
+		_, err := core.CompleteMultipartUpload(obj.bucketName, obj.objectName, obj.uploadID, obj.parts)
+		return err
+	})
+	p.uploadFileMetric.WithLabelValues(obj.bucketName).Inc()
+	p.logger.Infof("successfully uploaded object=%s, bucket=%s", obj.objectName, obj.bucketName)
+}
+
+// putStreamPart uploads the data as the next part of the object starting the multipart upload if it's needed.
+// The object must be locked.
+func (p *Plugin) putStreamPart(obj *streamObject, data []byte) {
+	if obj.uploadID == "" {
+		p.retryStream(obj, func(core minio.Core) error {
+			uploadID, err := core.NewMultipartUpload(obj.bucketName, obj.objectName, p.getObjectOptions())
+			obj.uploadID = uploadID
+			return err
+		})
+	}
+
+	partID := len(obj.parts) + 1
+	p.retryStream(obj, func(core minio.Core) error {
+		part, err := p.putPart(core, obj.bucketName, obj.objectName, obj.uploadID, partID, data)
+		if err != nil {
+			return err
+		}
+		obj.parts = append(obj.parts, part)
+		return nil
+	})
+}
+
+// retryStream calls fn until it succeeds like the uploads of the files are retried.
+func (p *Plugin) retryStream(obj *streamObject, fn func(core minio.Core) error) {
+	client, ok := p.clients[obj.bucketName]
+	if !ok {
+		client = p.defaultClient
+	}
+	core := minio.Core{Client: client.(*minio.Client)}
+
+	sleepTime := attemptInterval
+	for {
+		err := fn(core)
+		if err == nil {
+			return
+		}
+
+		p.sendErrorMetric.WithLabelValues().Inc()
+		sleepTime += sleepTime
+		p.logger.Errorf("could not upload object: %s, bucket: %s, next attempt in %s, error: %s", obj.objectName, obj.bucketName, sleepTime.String(), err.Error())
+		time.Sleep(sleepTime)
+	}
+}
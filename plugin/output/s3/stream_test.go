@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ozontech/file.d/logger"
+	"github.com/ozontech/file.d/metric"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamUpload(t *testing.T) {
+	r := require.New(t)
+
+	server := &fakeMultipartS3{parts: map[string]string{}}
+	ts := httptest.NewTLSServer(server)
+	defer ts.Close()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	config := &Config{
+		Region:         "us-east-1",
+		ForcePathStyle: true,
+		CACert:         string(caCert),
+		ChecksumMode:   checksumModeMD5,
+		PartSize_:      minPartSize,
+		DefaultBucket:  "bucket",
+		UploadMode:     uploadModeStream,
+	}
+	config.FileConfig.Layout = "01-02-2006_15:04:05"
+	client, err := newMinioClient(config, strings.TrimPrefix(ts.URL, "https://"), "access", "secret", true)
+	r.NoError(err)
+	objectKey, err := parseObjectKeyTemplate("{file}")
+	r.NoError(err)
+
+	p := &Plugin{
+		config:          config,
+		logger:          logger.Instance,
+		compressor:      newZipCompressor(logger.Instance),
+		objectKey:       objectKey,
+		defaultClient:   client,
+		clients:         map[string]ObjectStoreClient{"bucket": client},
+		fileExtension:   ".log",
+		streamFileNames: map[string]string{"bucket": "file-d"},
+		streamObjects:   map[string]*streamObject{},
+	}
+	p.RegisterMetrics(metric.New("test"))
+
+	// random data isn't compressed well, so there are two parts at least
+	content := &bytes.Buffer{}
+	random := make([]byte, 1024)
+	for content.Len() < 3*minPartSize {
+		_, err := rand.Read(random)
+		r.NoError(err)
+		line := hex.EncodeToString(random) + "\n"
+		content.WriteString(line)
+		p.writeStream("bucket", nil, []byte(line))
+	}
+	r.False(server.completed, "the object isn't completed before sealing up")
+	r.NotEmpty(server.parts, "filled parts are uploaded before sealing up")
+
+	p.sealStreamObjects()
+	r.True(server.completed)
+	r.GreaterOrEqual(len(server.parts), 2)
+	r.Empty(p.streamObjects)
+
+	object := &strings.Builder{}
+	for i := 1; i <= len(server.parts); i++ {
+		object.WriteString(server.parts[strconv.Itoa(i)])
+	}
+	archive, err := zip.NewReader(strings.NewReader(object.String()), int64(object.Len()))
+	r.NoError(err)
+	r.Len(archive.File, 1)
+	r.True(strings.HasPrefix(archive.File[0].Name, "file-d_"))
+	r.True(strings.HasSuffix(archive.File[0].Name, ".log"))
+
+	entry, err := archive.File[0].Open()
+	r.NoError(err)
+	data, err := io.ReadAll(entry)
+	r.NoError(err)
+	r.Equal(content.String(), string(data))
+}
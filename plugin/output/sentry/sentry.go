@@ -0,0 +1,442 @@
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozontech/file.d/buildinfo"
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It sends error events to [Sentry](https://sentry.io) via the store API, so exceptions in logs create Sentry issues.
+
+Only events which have `match_field` matching `match_pattern` are sent, other events are skipped.
+Event fields are mapped to the Sentry event:
+* `message_field` – the message
+* `level_field` – the level, it's converted to one of `fatal`, `error`, `warning`, `info`, `debug`
+* `fingerprint_fields` – values for issue grouping
+* `tags_fields` – tags, the last key of the field path is used as the tag name
+* the whole event is sent as `extra` data unless `skip_extra` is set
+
+**Example:**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: sentry
+      dsn: "https://public@o0.ingest.sentry.io/42"
+      environment: production
+      fingerprint_fields: ["service", "error.type"]
+      tags_fields: ["service", "k8s_pod"]
+```
+}*/
+
+const (
+	outPluginType = "sentry"
+
+	sentryVersion = "7"
+)
+
+var errNotRetryable = errors.New("not retryable response")
+
+type Plugin struct {
+	config       *Config
+	client       *http.Client
+	logger       *zap.SugaredLogger
+	avgEventSize int
+	batcher      *pipeline.Batcher
+	controller   pipeline.OutputPluginController
+
+	storeURL          string
+	authHeader        string
+	fingerprintFields [][]string
+	tagsFields        [][]string
+
+	// plugin metrics
+
+	sendErrorMetric     *prometheus.CounterVec
+	droppedEventsMetric *prometheus.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Sentry DSN. Format: `https://<public_key>@<host>/<project_id>`.
+	DSN string `json:"dsn" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field to match with `match_pattern`.
+	MatchField  cfg.FieldSelector `json:"match_field" default:"level" parse:"selector"` // *
+	MatchField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > A regexp which the `match_field` value must match to send the event.
+	MatchPattern  cfg.Regexp `json:"match_pattern" default:"/(?i)^(emerg|emergency|alert|crit|critical|err|error|fatal|panic)$/" parse:"regexp"` // *
+	MatchPattern_ *regexp.Regexp
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the message.
+	MessageField  cfg.FieldSelector `json:"message_field" default:"message" parse:"selector"` // *
+	MessageField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the level.
+	LevelField  cfg.FieldSelector `json:"level_field" default:"level" parse:"selector"` // *
+	LevelField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The level of events without a known level.
+	DefaultLevel string `json:"default_level" default:"error" options:"fatal|error|warning|info|debug"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Event fields which values are used as the fingerprint to group events into issues.
+	// > Sentry default grouping is used if empty.
+	FingerprintFields []string `json:"fingerprint_fields"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Event fields to add as tags.
+	TagsFields []string `json:"tags_fields"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The environment of events.
+	Environment string `json:"environment" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > The release of events.
+	Release string `json:"release" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the event itself isn't sent as extra data.
+	SkipExtra bool `json:"skip_extra" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Client timeout of requests.
+	RequestTimeout  cfg.Duration `json:"request_timeout" default:"5s" parse:"duration"` // *
+	RequestTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Retention between retries of failed requests.
+	Retention  cfg.Duration `json:"retention" default:"1s" parse:"duration"` // *
+	Retention_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch. Sentry events are sent one by one.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+// event is a Sentry event of the store API.
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   float64           `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Level       string            `json:"level"`
+	Message     string            `json:"message,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Fingerprint []string          `json:"fingerprint,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       json.RawMessage   `json:"extra,omitempty"`
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.avgEventSize = params.PipelineSettings.AvgEventSize
+	p.config = config.(*Config)
+
+	if p.config.Retention_ < 1 {
+		p.logger.Fatal("'retention' can't be <1")
+	}
+
+	if err := p.init(); err != nil {
+		p.logger.Fatalf("can't init sentry output: %s", err.Error())
+	}
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		MaintenanceFn:  p.maintenance,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) init() error {
+	storeURL, publicKey, secretKey, err := parseDSN(p.config.DSN)
+	if err != nil {
+		return err
+	}
+	p.storeURL = storeURL
+
+	p.authHeader = fmt.Sprintf("Sentry sentry_version=%s, sentry_client=file.d/%s, sentry_key=%s", sentryVersion, buildinfo.Version, publicKey)
+	if secretKey != "" {
+		p.authHeader += ", sentry_secret=" + secretKey
+	}
+
+	p.fingerprintFields = parseSelectors(p.config.FingerprintFields)
+	p.tagsFields = parseSelectors(p.config.TagsFields)
+
+	p.client = &http.Client{
+		Timeout: p.config.RequestTimeout_,
+	}
+
+	return nil
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_sentry_send_error", "Total Sentry send errors")
+	p.droppedEventsMetric = ctl.RegisterCounter("output_sentry_dropped_events", "Total events dropped by Sentry output")
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(_ *pipeline.WorkerData, batch *pipeline.Batch) {
+	for _, e := range batch.Events {
+		if !p.match(e.Root) {
+			continue
+		}
+
+		body, err := json.Marshal(p.makeEvent(e.Root))
+		if err != nil {
+			p.logger.Panicf("can't marshal sentry event: %s", err.Error())
+		}
+		p.send(body)
+	}
+}
+
+func (p *Plugin) maintenance(_ *pipeline.WorkerData) {}
+
+func (p *Plugin) match(root *insaneJSON.Root) bool {
+	node := root.Dig(p.config.MatchField_...)
+	if node == nil {
+		return false
+	}
+	return p.config.MatchPattern_.MatchString(node.AsString())
+}
+
+func (p *Plugin) makeEvent(root *insaneJSON.Root) *event {
+	e := &event{
+		EventID:     newEventID(),
+		Timestamp:   float64(time.Now().UnixNano()) / float64(time.Second),
+		Platform:    "other",
+		Logger:      "file.d",
+		Level:       p.level(root),
+		Message:     fieldValue(root, p.config.MessageField_),
+		Environment: p.config.Environment,
+		Release:     p.config.Release,
+	}
+
+	for _, field := range p.fingerprintFields {
+		if value := fieldValue(root, field); value != "" {
+			e.Fingerprint = append(e.Fingerprint, value)
+		}
+	}
+
+	for _, field := range p.tagsFields {
+		value := fieldValue(root, field)
+		if value == "" {
+			continue
+		}
+		if e.Tags == nil {
+			e.Tags = make(map[string]string, len(p.tagsFields))
+		}
+		e.Tags[field[len(field)-1]] = value
+	}
+
+	if !p.config.SkipExtra {
+		e.Extra = root.Encode(nil)
+	}
+
+	return e
+}
+
+// level converts the RFC-5424 level of the event to the Sentry level.
+func (p *Plugin) level(root *insaneJSON.Root) string {
+	switch pipeline.ParseLevelAsNumber(fieldValue(root, p.config.LevelField_)) {
+	case pipeline.LevelEmergency, pipeline.LevelAlert, pipeline.LevelCritical:
+		return "fatal"
+	case pipeline.LevelError:
+		return "error"
+	case pipeline.LevelWarning:
+		return "warning"
+	case pipeline.LevelNotice, pipeline.LevelInformational:
+		return "info"
+	case pipeline.LevelDebug:
+		return "debug"
+	default:
+		return p.config.DefaultLevel
+	}
+}
+
+// send sends the body until success or not retryable error.
+func (p *Plugin) send(body []byte) {
+	for {
+		retryAfter, err := p.request(body)
+		if err == nil {
+			return
+		}
+
+		p.sendErrorMetric.WithLabelValues().Inc()
+		if errors.Is(err, errNotRetryable) {
+			p.droppedEventsMetric.WithLabelValues().Inc()
+			p.logger.Errorf("can't send event to Sentry, the event is dropped: %s", err.Error())
+			return
+		}
+
+		if retryAfter == 0 {
+			retryAfter = p.config.Retention_
+		}
+		p.logger.Errorf("can't send event to Sentry, next attempt in %s: %s", retryAfter.String(), err.Error())
+		time.Sleep(retryAfter)
+	}
+}
+
+// request returns the time to wait before the next attempt if Sentry asks for it.
+func (p *Plugin) request(body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("can't create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", p.authHeader)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("can't send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("can't read response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(retryAfter) * time.Second, fmt.Errorf("rate limited: %s", resp.Status)
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= http.StatusInternalServerError:
+		return 0, fmt.Errorf("bad response: %s: %s", resp.Status, respBody)
+	default:
+		return 0, fmt.Errorf("%w: %s: %s", errNotRetryable, resp.Status, respBody)
+	}
+}
+
+// parseDSN returns the store API URL and keys of the DSN.
+func parseDSN(dsn string) (string, string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", "", fmt.Errorf("can't parse DSN: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", "", errors.New("DSN doesn't have a public key")
+	}
+
+	path := strings.Trim(u.Path, "/")
+	pos := strings.LastIndexByte(path, '/')
+	projectID := path[pos+1:]
+	if projectID == "" {
+		return "", "", "", errors.New("DSN doesn't have a project id")
+	}
+
+	secretKey, _ := u.User.Password()
+	storeURL := fmt.Sprintf("%s://%s/%sapi/%s/store/", u.Scheme, u.Host, path[:pos+1], projectID)
+
+	return storeURL, u.User.Username(), secretKey, nil
+}
+
+func parseSelectors(fields []string) [][]string {
+	selectors := make([][]string, 0, len(fields))
+	for _, field := range fields {
+		selectors = append(selectors, cfg.ParseFieldSelector(field))
+	}
+	return selectors
+}
+
+func fieldValue(root *insaneJSON.Root, field []string) string {
+	node := root.Dig(field...)
+	if node == nil {
+		return ""
+	}
+	return node.AsString()
+}
+
+func newEventID() string {
+	id := make([]byte, 16)
+	// crypto/rand never fails on supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
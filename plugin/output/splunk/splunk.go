@@ -3,11 +3,14 @@ package splunk
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/ozontech/file.d/cfg"
@@ -15,16 +18,26 @@ import (
 	"github.com/ozontech/file.d/metric"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/prometheus/client_golang/prometheus"
+	uuid "github.com/satori/go.uuid"
 	insaneJSON "github.com/vitkovskii/insane-json"
 	"go.uber.org/zap"
 )
 
 /*{ introduction
 It sends events to splunk.
+
+If `use_ack` is set, a batch is considered sent only after the
+[indexer acknowledgment](https://docs.splunk.com/Documentation/Splunk/latest/Data/AboutHECIDXAck) of it is received,
+otherwise the batch is sent again.
 }*/
 
 const (
 	outPluginType = "splunk"
+
+	compressionGzip = "gzip"
+
+	channelHeader = "X-Splunk-Request-Channel"
+	ackPath       = "/services/collector/ack"
 )
 
 type Plugin struct {
@@ -34,6 +47,8 @@ type Plugin struct {
 	avgEventSize int
 	batcher      *pipeline.Batcher
 	controller   pipeline.OutputPluginController
+	channel      string
+	ackEndpoint  string
 
 	// plugin metrics
 
@@ -83,10 +98,57 @@ type Config struct {
 	// > After this timeout the batch will be sent even if batch isn't completed.
 	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
 	BatchFlushTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > Compression of the request body.
+	Compression string `json:"compression" default:"none" options:"none|gzip"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the splunk index of the event. The default index of the token is used if the field isn't found.
+	IndexField  cfg.FieldSelector `json:"index_field" parse:"selector"` // *
+	IndexField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the sourcetype of the event. The default sourcetype of the token is used if the field isn't found.
+	SourceTypeField  cfg.FieldSelector `json:"sourcetype_field" parse:"selector"` // *
+	SourceTypeField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > The event field containing the host of the event. The default host of the token is used if the field isn't found.
+	HostField  cfg.FieldSelector `json:"host_field" parse:"selector"` // *
+	HostField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > If set, the plugin waits for the indexer acknowledgment of the batches. It must be enabled for the token.
+	UseAck bool `json:"use_ack" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > A channel of the acknowledgments. A random one is generated if it isn't set.
+	Channel string `json:"channel" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > How often the acknowledgment of a batch is checked.
+	AckPollInterval  cfg.Duration `json:"ack_poll_interval" default:"1s" parse:"duration"` // *
+	AckPollInterval_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch is sent again if it isn't acknowledged.
+	AckTimeout  cfg.Duration `json:"ack_timeout" default:"1m" parse:"duration"` // *
+	AckTimeout_ time.Duration
 }
 
 type data struct {
-	outBuf []byte
+	outBuf  []byte
+	gzipBuf *bytes.Buffer
+	gzip    *gzip.Writer
 }
 
 func init() {
@@ -107,6 +169,19 @@ func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginP
 	p.config = config.(*Config)
 	p.client = p.newClient(p.config.RequestTimeout_)
 
+	if p.config.UseAck {
+		p.channel = p.config.Channel
+		if p.channel == "" {
+			p.channel = uuid.NewV4().String()
+		}
+
+		ackEndpoint, err := makeAckEndpoint(p.config.Endpoint, p.channel)
+		if err != nil {
+			p.logger.Fatalf("can't make ack endpoint: %s", err.Error())
+		}
+		p.ackEndpoint = ackEndpoint
+	}
+
 	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
 		PipelineName:   params.PipelineName,
 		OutputType:     outPluginType,
@@ -152,6 +227,9 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 
 	for _, event := range batch.Events {
 		root.AddField("event").MutateToNode(event.Root.Node)
+		p.addMetadata(root, event.Root, "index", p.config.IndexField_)
+		p.addMetadata(root, event.Root, "sourcetype", p.config.SourceTypeField_)
+		p.addMetadata(root, event.Root, "host", p.config.HostField_)
 		outBuf = root.Encode(outBuf)
 		_ = root.DecodeString("{}")
 	}
@@ -160,8 +238,13 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 
 	p.logger.Debugf("trying to send: %s", outBuf)
 
+	body := outBuf
+	if p.config.Compression == compressionGzip {
+		body = p.compress(data, body)
+	}
+
 	for {
-		err := p.send(outBuf)
+		err := p.sendBatch(body)
 		if err != nil {
 			p.sendErrorMetric.WithLabelValues().Inc()
 			p.logger.Errorf("can't send data to splunk address=%s: %s", p.config.Endpoint, err.Error())
@@ -175,6 +258,53 @@ func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
 	p.logger.Debugf("successfully sent: %s", outBuf)
 }
 
+// addMetadata adds the event field value as the metadata of the splunk event if the field is found.
+func (p *Plugin) addMetadata(root *insaneJSON.Root, eventRoot *insaneJSON.Root, name string, field []string) {
+	if len(field) == 0 {
+		return
+	}
+	node := eventRoot.Dig(field...)
+	if node == nil || node.IsNull() {
+		return
+	}
+	root.AddFieldNoAlloc(root, name).MutateToString(node.AsString())
+}
+
+func (p *Plugin) compress(data *data, body []byte) []byte {
+	if data.gzip == nil {
+		data.gzipBuf = &bytes.Buffer{}
+		data.gzip = gzip.NewWriter(data.gzipBuf)
+	}
+
+	data.gzipBuf.Reset()
+	data.gzip.Reset(data.gzipBuf)
+	// writing to the bytes.Buffer never fails.
+	_, _ = data.gzip.Write(body)
+	_ = data.gzip.Close()
+
+	return data.gzipBuf.Bytes()
+}
+
+// sendBatch sends the batch and waits for its acknowledgment if it's enabled.
+func (p *Plugin) sendBatch(body []byte) error {
+	root, err := p.send(body)
+	if err != nil {
+		return err
+	}
+	defer insaneJSON.Release(root)
+
+	if !p.config.UseAck {
+		return nil
+	}
+
+	ackID := root.Dig("ackId")
+	if ackID == nil {
+		return fmt.Errorf("invalid response format, expecting json with 'ackId' field, got: %s", root.EncodeToString())
+	}
+
+	return p.waitAck(ackID.AsInt())
+}
+
 func (p *Plugin) maintenance(workerData *pipeline.WorkerData) {}
 
 func (p *Plugin) newClient(timeout time.Duration) http.Client {
@@ -189,44 +319,110 @@ func (p *Plugin) newClient(timeout time.Duration) http.Client {
 	}
 }
 
-func (p *Plugin) send(data []byte) error {
+func (p *Plugin) send(data []byte) (*insaneJSON.Root, error) {
 	r := bytes.NewReader(data)
 	// todo pass context from parent.
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.config.Endpoint, r)
 	if err != nil {
-		return fmt.Errorf("can't create request: %w", err)
+		return nil, fmt.Errorf("can't create request: %w", err)
+	}
+	if p.config.Compression == compressionGzip {
+		req.Header.Set("Content-Encoding", compressionGzip)
+	}
+
+	root, err := p.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	code := root.Dig("code")
+	if code == nil {
+		err = fmt.Errorf("invalid response format, expecting json with 'code' field, got: %s", root.EncodeToString())
+	} else if code.AsInt() > 0 {
+		err = fmt.Errorf("error while sending to splunk: %s", root.EncodeToString())
+	}
+	if err != nil {
+		insaneJSON.Release(root)
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// waitAck polls the acknowledgment of the batch until it's received or the ack timeout is expired.
+func (p *Plugin) waitAck(ackID int) error {
+	body := []byte(`{"acks":[` + strconv.Itoa(ackID) + `]}`)
+	deadline := time.Now().Add(p.config.AckTimeout_)
+	for {
+		time.Sleep(p.config.AckPollInterval_)
+
+		acked, err := p.checkAck(body, ackID)
+		if err != nil {
+			return err
+		}
+		if acked {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("batch isn't acknowledged in %s, ack id=%d", p.config.AckTimeout_.String(), ackID)
+		}
+	}
+}
+
+func (p *Plugin) checkAck(body []byte, ackID int) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.ackEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("can't create ack request: %w", err)
 	}
 
+	root, err := p.doRequest(req)
+	if err != nil {
+		return false, fmt.Errorf("can't check ack: %w", err)
+	}
+	defer insaneJSON.Release(root)
+
+	ack := root.Dig("acks", strconv.Itoa(ackID))
+	return ack != nil && ack.AsBool(), nil
+}
+
+// doRequest sends the request and returns the decoded response which must be released.
+func (p *Plugin) doRequest(req *http.Request) (*insaneJSON.Root, error) {
 	req.Header.Set("Authorization", "Splunk "+p.config.Token)
+	if p.channel != "" {
+		req.Header.Set(channelHeader, p.channel)
+	}
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("can't send request: %w", err)
+		return nil, fmt.Errorf("can't send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("can't send request: %s", resp.Status)
+		return nil, fmt.Errorf("can't send request: %s", resp.Status)
 	}
 
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("can't read response: %w", err)
+		return nil, fmt.Errorf("can't read response: %w", err)
 	}
 
 	root, err := insaneJSON.DecodeBytes(b)
-	defer insaneJSON.Release(root)
 	if err != nil {
-		return fmt.Errorf("can't decode response: %w", err)
+		insaneJSON.Release(root)
+		return nil, fmt.Errorf("can't decode response: %w", err)
 	}
 
-	code := root.Dig("code")
-	if code == nil {
-		return fmt.Errorf("invalid response format, expecting json with 'code' field, got: %s", string(b))
-	}
+	return root, nil
+}
 
-	if code.AsInt() > 0 {
-		return fmt.Errorf("error while sending to splunk: %s", string(b))
+// makeAckEndpoint returns the acknowledgment endpoint of the HEC endpoint host.
+func makeAckEndpoint(endpoint, channel string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
 	}
-
-	return nil
+	u.Path = ackPath
+	u.RawQuery = url.Values{"channel": []string{channel}}.Encode()
+	return u.String(), nil
 }
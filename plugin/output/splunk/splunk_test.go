@@ -1,13 +1,16 @@
 package splunk
 
 import (
+	"compress/gzip"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	insaneJSON "github.com/vitkovskii/insane-json"
 	"go.uber.org/zap"
 )
@@ -68,3 +71,88 @@ func TestSplunk(t *testing.T) {
 		})
 	}
 }
+
+func TestSplunkMetadataAndGzip(t *testing.T) {
+	input, err := insaneJSON.DecodeString(`{"msg":"AAAA","k8s":{"ns":"prod","app":"api"}}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(input)
+
+	var response []byte
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+		r, err := gzip.NewReader(req.Body)
+		require.NoError(t, err)
+		response, err = io.ReadAll(r)
+		require.NoError(t, err)
+		_, _ = res.Write([]byte(`{"code":0}`))
+	}))
+	defer testServer.Close()
+
+	plugin := Plugin{
+		config: &Config{
+			Endpoint:         testServer.URL,
+			Compression:      compressionGzip,
+			IndexField_:      []string{"k8s", "ns"},
+			SourceTypeField_: []string{"k8s", "app"},
+			HostField_:       []string{"host"},
+		},
+		logger: zap.NewExample().Sugar(),
+	}
+
+	batch := pipeline.Batch{Events: []*pipeline.Event{{Root: input}}}
+	data := pipeline.WorkerData(nil)
+	plugin.out(&data, &batch)
+
+	assert.Equal(t, `{"event":{"msg":"AAAA","k8s":{"ns":"prod","app":"api"}},"index":"prod","sourcetype":"api"}`, string(response))
+}
+
+func TestSplunkAck(t *testing.T) {
+	input, err := insaneJSON.DecodeString(`{"msg":"AAAA"}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(input)
+
+	sent, ackChecks := 0, 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "channel-1", req.Header.Get(channelHeader))
+		if req.URL.Path != ackPath {
+			sent++
+			_, _ = res.Write([]byte(`{"text":"Success","code":0,"ackId":7}`))
+			return
+		}
+
+		assert.Equal(t, "channel-1", req.URL.Query().Get("channel"))
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"acks":[7]}`, string(body))
+
+		ackChecks++
+		if ackChecks < 3 {
+			_, _ = res.Write([]byte(`{"acks":{"7":false}}`))
+			return
+		}
+		_, _ = res.Write([]byte(`{"acks":{"7":true}}`))
+	}))
+	defer testServer.Close()
+
+	ackEndpoint, err := makeAckEndpoint(testServer.URL+"/services/collector/event", "channel-1")
+	require.NoError(t, err)
+
+	plugin := Plugin{
+		config: &Config{
+			Endpoint:         testServer.URL + "/services/collector/event",
+			UseAck:           true,
+			AckPollInterval_: time.Millisecond,
+			AckTimeout_:      time.Minute,
+		},
+		logger:      zap.NewExample().Sugar(),
+		channel:     "channel-1",
+		ackEndpoint: ackEndpoint,
+	}
+
+	batch := pipeline.Batch{Events: []*pipeline.Event{{Root: input}}}
+	data := pipeline.WorkerData(nil)
+	plugin.out(&data, &batch)
+
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 3, ackChecks)
+}
@@ -1,27 +1,98 @@
 package stdout
 
 import (
-	"fmt"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"time"
 
+	"github.com/ozontech/file.d/cfg"
 	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/lineformat"
 	"github.com/ozontech/file.d/pipeline"
 	"github.com/ozontech/file.d/plugin"
+	"go.uber.org/zap"
 )
 
 /*{ introduction
 It writes events to stdout(also known as console).
+
+The events are collected in batches, each worker formats its batch into its own buffer
+and writes it with the single call, so the lines of the different workers aren't interleaved.
 }*/
 
+const outPluginType = "stdout"
+
 type Plugin struct {
-	controller pipeline.OutputPluginController
+	controller   pipeline.OutputPluginController
+	logger       *zap.SugaredLogger
+	config       *Config
+	formatter    *lineformat.Formatter
+	avgEventSize int
+	batcher      *pipeline.Batcher
+	writer       io.Writer
 	plugin.NoMetricsPlugin
 }
 
-type Config struct{}
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > Format of the lines:
+	// > * `type: json` – the events as is
+	// > * `type: raw` – the value of the `field`, `message` by default
+	// > * `type: template` – the `template` with `${field}` placeholders filled with the event fields
+	// > * `type: csv` – the values of the `columns` fields separated by the `delimiter`, `,` by default
+	// >
+	// > String values are written as is, other values are written as JSON, missing and null values are empty.
+	// > ```yaml
+	// > format:
+	// >   type: template
+	// >   template: "${ts} [${level}] ${message}"
+	// > ```
+	Format lineformat.Config `json:"format" child:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > If set, the events of each batch are written in the order they've got into the pipeline.
+	// > Set `workers_count` to `1` to keep the order between the batches too.
+	Ordered bool `json:"ordered" default:"false"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Only every N-th event is written, the rest are committed without writing.
+	SampleRate int `json:"sample_rate" default:"1"` // *
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to write batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be written even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+type data struct {
+	outBuf  []byte
+	events  []*pipeline.Event
+	sampled int
+}
 
 func init() {
 	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
-		Type:    "stdout",
+		Type:    outPluginType,
 		Factory: Factory,
 	})
 }
@@ -30,13 +101,84 @@ func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
 	return &Plugin{}, &Config{}
 }
 
-func (p *Plugin) Start(_ pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
 	p.controller = params.Controller
+	p.logger = params.Logger
+	p.avgEventSize = params.PipelineSettings.AvgEventSize
+	p.config = config.(*Config)
+	if p.writer == nil {
+		p.writer = os.Stdout
+	}
+
+	if p.config.SampleRate < 1 {
+		p.logger.Fatalf("sample_rate must be greater than 0")
+	}
+
+	formatter, err := lineformat.New(&p.config.Format)
+	if err != nil {
+		p.logger.Fatalf("can't create formatter: %s", err.Error())
+	}
+	p.formatter = formatter
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:   params.PipelineName,
+		OutputType:     outPluginType,
+		OutFn:          p.out,
+		Controller:     p.controller,
+		Workers:        p.config.WorkersCount_,
+		BatchSizeCount: p.config.BatchSize_,
+		FlushTimeout:   p.config.BatchFlushTimeout_,
+	})
+	p.batcher.Start(context.TODO())
 }
 
-func (_ *Plugin) Stop() {}
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+}
 
 func (p *Plugin) Out(event *pipeline.Event) {
-	fmt.Println(event.Root.EncodeToString())
-	p.controller.Commit(event)
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{
+			outBuf: make([]byte, 0, p.config.BatchSize_*p.avgEventSize),
+		}
+	}
+
+	data := (*workerData).(*data)
+	// handle to much memory consumption
+	if cap(data.outBuf) > p.config.BatchSize_*p.avgEventSize {
+		data.outBuf = make([]byte, 0, p.config.BatchSize_*p.avgEventSize)
+	}
+
+	events := batch.Events
+	if p.config.Ordered {
+		data.events = append(data.events[:0], batch.Events...)
+		sort.Slice(data.events, func(i, j int) bool {
+			return data.events[i].SeqID < data.events[j].SeqID
+		})
+		events = data.events
+	}
+
+	outBuf := data.outBuf[:0]
+	for _, event := range events {
+		data.sampled++
+		if data.sampled < p.config.SampleRate {
+			continue
+		}
+		data.sampled = 0
+
+		outBuf = p.formatter.Append(outBuf, event.Root)
+		outBuf = append(outBuf, '\n')
+	}
+	data.outBuf = outBuf
+
+	if len(outBuf) == 0 {
+		return
+	}
+	if _, err := p.writer.Write(outBuf); err != nil {
+		p.logger.Errorf("can't write batch to stdout: %s", err.Error())
+	}
 }
@@ -0,0 +1,63 @@
+package stdout
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/ozontech/file.d/lineformat"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+func TestOut(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ordered    bool
+		sampleRate int
+		expected   string
+	}{
+		"as is": {
+			sampleRate: 1,
+			expected:   "{\"a\":3}\n{\"a\":1}\n{\"a\":2}\n{\"a\":4}\n",
+		},
+		"ordered": {
+			ordered:    true,
+			sampleRate: 1,
+			expected:   "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n{\"a\":4}\n",
+		},
+		"sampled": {
+			ordered:    true,
+			sampleRate: 2,
+			expected:   "{\"a\":2}\n{\"a\":4}\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			formatter, err := lineformat.New(&lineformat.Config{Type: "json"})
+			require.NoError(t, err)
+
+			buf := &bytes.Buffer{}
+			p := &Plugin{
+				logger:       zap.NewExample().Sugar(),
+				config:       &Config{Ordered: tc.ordered, SampleRate: tc.sampleRate, BatchSize_: 4},
+				formatter:    formatter,
+				avgEventSize: 16,
+				writer:       buf,
+			}
+
+			batch := &pipeline.Batch{}
+			for _, seqID := range []uint64{3, 1, 2, 4} {
+				root, err := insaneJSON.DecodeString(`{"a":` + strconv.FormatUint(seqID, 10) + `}`)
+				require.NoError(t, err)
+				t.Cleanup(func() { insaneJSON.Release(root) })
+				batch.Events = append(batch.Events, &pipeline.Event{Root: root, SeqID: seqID})
+			}
+
+			workerData := pipeline.WorkerData(nil)
+			p.out(&workerData, batch)
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+const (
+	networkUDP = "udp"
+	networkTCP = "tcp"
+	networkTLS = "tls"
+)
+
+type client struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func newClient(network, address string, connTimeout, writeTimeout time.Duration, tlsConfig *tls.Config) (c *client, err error) {
+	c = &client{timeout: writeTimeout}
+
+	switch network {
+	case networkTLS:
+		c.conn, err = tls.DialWithDialer(&net.Dialer{Timeout: connTimeout}, networkTCP, address, tlsConfig)
+	default:
+		c.conn, err = net.DialTimeout(network, address, connTimeout)
+	}
+
+	return c, err
+}
+
+func (c *client) send(data []byte) (int, error) {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.conn.Write(data)
+}
+
+func (c *client) close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,616 @@
+package syslog
+
+import (
+	"context"
+	cryptoTLS "crypto/tls"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/fd"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/tls"
+	prom "github.com/prometheus/client_golang/prometheus"
+	insaneJSON "github.com/vitkovskii/insane-json"
+	"go.uber.org/zap"
+)
+
+/*{ introduction
+It sends event batches to the syslog server in [RFC5424](https://datatracker.ietf.org/doc/html/rfc5424)
+or [RFC3164](https://datatracker.ietf.org/doc/html/rfc3164) format.
+Transport level protocol UDP, TCP or TLS is configurable.
+
+For TCP and TLS messages are framed according to [RFC6587](https://datatracker.ietf.org/doc/html/rfc6587).
+For UDP every message is sent in a separate datagram.
+
+In RFC5424 format fields listed in `sd_fields` are sent as the structured data element:
+```
+<134>1 2009-11-10T23:00:00Z my-host my-app 42 - [fields@32473 service="checkout" trace_id="1234"] message text
+```
+
+**Example**
+```yaml
+pipelines:
+  example_pipeline:
+    ...
+    output:
+      type: syslog
+      endpoint: "siem.example.org:6514"
+      network: tls
+      ca_cert: /etc/ssl/siem-ca.pem
+      app_name_field: service
+      sd_fields:
+        - service
+        - trace_id
+```
+}*/
+
+const (
+	outPluginType = "syslog"
+
+	formatRFC5424 = "rfc5424"
+	formatRFC3164 = "rfc3164"
+
+	framingOctetCounting  = "octet_counting"
+	framingNonTransparent = "non_transparent"
+
+	nilValue = "-"
+
+	// maximal lengths of RFC5424 header fields.
+	maxHostnameLen = 255
+	maxAppNameLen  = 48
+	maxProcIDLen   = 128
+	maxMsgIDLen    = 32
+	maxSDNameLen   = 32
+)
+
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+type Plugin struct {
+	config       *Config
+	logger       *zap.SugaredLogger
+	avgEventSize int
+	batcher      *pipeline.Batcher
+	controller   pipeline.OutputPluginController
+
+	facility             int
+	hostname             string
+	tlsConfig            *cryptoTLS.Config
+	timestampFieldFormat string
+	sdFields             [][]string
+
+	// plugin metrics
+
+	sendErrorMetric *prom.CounterVec
+}
+
+// ! config-params
+// ^ config-params
+type Config struct {
+	// > @3@4@5@6
+	// >
+	// > An address of syslog server. Format: `HOST:PORT`. E.g. `localhost:514`.
+	Endpoint string `json:"endpoint" required:"true"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Transport level protocol.
+	Network string `json:"network" default:"tcp" options:"udp|tcp|tls"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Path or content of a PEM-encoded CA file. Used only if `network` is `tls`.
+	CACert string `json:"ca_cert" default:""` // *
+
+	// > @3@4@5@6
+	// >
+	// > Syslog message format.
+	Format string `json:"format" default:"rfc5424" options:"rfc5424|rfc3164"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Message framing for TCP and TLS:
+	// > * `octet_counting` – every message is prefixed with its length
+	// > * `non_transparent` – every message is terminated with the new line
+	Framing string `json:"framing" default:"octet_counting" options:"octet_counting|non_transparent"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Syslog facility of messages.
+	Facility string `json:"facility" default:"local0" options:"kern|user|mail|daemon|auth|syslog|lpr|news|uucp|cron|authpriv|ftp|local0|local1|local2|local3|local4|local5|local6|local7"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Which field of the event should be used as a severity. The field should contain level number or string according to RFC 5424.
+	// > Otherwise `6` (informational) will be used.
+	SeverityField  cfg.FieldSelector `json:"severity_field" default:"level" parse:"selector"` // *
+	SeverityField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Which field of the event should be used as a hostname. The host name of file.d is used if the field is empty.
+	HostnameField  cfg.FieldSelector `json:"hostname_field" default:"host" parse:"selector"` // *
+	HostnameField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Application name used if `app_name_field` is empty.
+	AppName string `json:"app_name" default:"file.d"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Which field of the event should be used as an application name (`TAG` for RFC3164).
+	AppNameField  cfg.FieldSelector `json:"app_name_field" default:"" parse:"selector"` // *
+	AppNameField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Which field of the event should be used as a process id.
+	ProcIDField  cfg.FieldSelector `json:"proc_id_field" default:"" parse:"selector"` // *
+	ProcIDField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Which field of the event should be used as a message id. Used only in RFC5424 format.
+	MsgIDField  cfg.FieldSelector `json:"msg_id_field" default:"" parse:"selector"` // *
+	MsgIDField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Which field of the event should be used as a message. The whole event is sent as JSON if the field is absent.
+	MessageField  cfg.FieldSelector `json:"message_field" default:"message" parse:"selector"` // *
+	MessageField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > Which field of the event should be used as a timestamp. The current time is used if the field is absent or can't be parsed.
+	TimestampField  cfg.FieldSelector `json:"timestamp_field" default:"time" parse:"selector"` // *
+	TimestampField_ []string
+
+	// > @3@4@5@6
+	// >
+	// > In which format timestamp field should be parsed.
+	TimestampFieldFormat string `json:"timestamp_field_format" default:"rfc3339nano" options:"ansic|unixdate|rubydate|rfc822|rfc822z|rfc850|rfc1123|rfc1123z|rfc3339|rfc3339nano|kitchen|stamp|stampmilli|stampmicro|stampnano"` // *
+
+	// > @3@4@5@6
+	// >
+	// > Fields of the event sent as parameters of the structured data element. Used only in RFC5424 format.
+	StructuredDataFields []string `json:"sd_fields"` // *
+
+	// > @3@4@5@6
+	// >
+	// > An id of the structured data element.
+	StructuredDataID string `json:"sd_id" default:"fields@32473"` // *
+
+	// > @3@4@5@6
+	// >
+	// > The plugin reconnects to endpoint periodically using this interval. It is useful if an endpoint is a load balancer.
+	ReconnectInterval  cfg.Duration `json:"reconnect_interval" default:"1m" parse:"duration"` // *
+	ReconnectInterval_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How much time to wait for the connection?
+	ConnectionTimeout  cfg.Duration `json:"connection_timeout" default:"5s" parse:"duration"` // *
+	ConnectionTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How much time to wait for the write?
+	WriteTimeout  cfg.Duration `json:"write_timeout" default:"10s" parse:"duration"` // *
+	WriteTimeout_ time.Duration
+
+	// > @3@4@5@6
+	// >
+	// > How many workers will be instantiated to send batches.
+	WorkersCount  cfg.Expression `json:"workers_count" default:"gomaxprocs*4" parse:"expression"` // *
+	WorkersCount_ int
+
+	// > @3@4@5@6
+	// >
+	// > A maximum quantity of events to pack into one batch.
+	BatchSize  cfg.Expression `json:"batch_size" default:"capacity/4" parse:"expression"` // *
+	BatchSize_ int
+
+	// > @3@4@5@6
+	// >
+	// > A minimum size of events in a batch to send.
+	// > If both batch_size and batch_size_bytes are set, they will work together.
+	BatchSizeBytes  cfg.Expression `json:"batch_size_bytes" default:"0" parse:"expression"` // *
+	BatchSizeBytes_ int
+
+	// > @3@4@5@6
+	// >
+	// > After this timeout the batch will be sent even if batch isn't completed.
+	BatchFlushTimeout  cfg.Duration `json:"batch_flush_timeout" default:"200ms" parse:"duration"` // *
+	BatchFlushTimeout_ time.Duration
+}
+
+type data struct {
+	outBuf []byte
+	// ends contains end offsets of messages in outBuf, it's used to send UDP datagrams.
+	ends   []int
+	syslog *client
+}
+
+func init() {
+	fd.DefaultPluginRegistry.RegisterOutput(&pipeline.PluginStaticInfo{
+		Type:    outPluginType,
+		Factory: Factory,
+	})
+}
+
+func Factory() (pipeline.AnyPlugin, pipeline.AnyConfig) {
+	return &Plugin{}, &Config{}
+}
+
+func (p *Plugin) Start(config pipeline.AnyConfig, params *pipeline.OutputPluginParams) {
+	p.controller = params.Controller
+	p.logger = params.Logger
+	p.avgEventSize = params.PipelineSettings.AvgEventSize
+	p.config = config.(*Config)
+
+	p.facility = facilities[p.config.Facility]
+	hostname, err := os.Hostname()
+	if err != nil {
+		p.logger.Errorf("can't get hostname: %s", err.Error())
+		hostname = nilValue
+	}
+	p.hostname = hostname
+
+	format, err := pipeline.ParseFormatName(p.config.TimestampFieldFormat)
+	if err != nil {
+		p.logger.Errorf("unknown time format: %s", err.Error())
+	}
+	p.timestampFieldFormat = format
+
+	p.sdFields = make([][]string, 0, len(p.config.StructuredDataFields))
+	for _, field := range p.config.StructuredDataFields {
+		p.sdFields = append(p.sdFields, cfg.ParseFieldSelector(field))
+	}
+
+	if p.config.Network == networkTLS && p.config.CACert != "" {
+		b := tls.NewConfigBuilder()
+		if err := b.AppendCARoot(p.config.CACert); err != nil {
+			p.logger.Fatalf("can't append CA root: %s", err.Error())
+		}
+		p.tlsConfig = b.Build()
+	}
+
+	p.batcher = pipeline.NewBatcher(pipeline.BatcherOptions{
+		PipelineName:        params.PipelineName,
+		OutputType:          outPluginType,
+		OutFn:               p.out,
+		MaintenanceFn:       p.maintenance,
+		Controller:          p.controller,
+		Workers:             p.config.WorkersCount_,
+		BatchSizeCount:      p.config.BatchSize_,
+		BatchSizeBytes:      p.config.BatchSizeBytes_,
+		FlushTimeout:        p.config.BatchFlushTimeout_,
+		MaintenanceInterval: p.config.ReconnectInterval_,
+	})
+
+	p.batcher.Start(context.TODO())
+}
+
+func (p *Plugin) Stop() {
+	p.batcher.Stop()
+}
+
+func (p *Plugin) Out(event *pipeline.Event) {
+	p.batcher.Add(event)
+}
+
+func (p *Plugin) RegisterMetrics(ctl *metric.Ctl) {
+	p.sendErrorMetric = ctl.RegisterCounter("output_syslog_send_error", "Total syslog send errors")
+}
+
+func (p *Plugin) out(workerData *pipeline.WorkerData, batch *pipeline.Batch) {
+	if *workerData == nil {
+		*workerData = &data{
+			outBuf: make([]byte, 0, p.config.BatchSize_*p.avgEventSize),
+			ends:   make([]int, 0, p.config.BatchSize_),
+		}
+	}
+
+	data := (*workerData).(*data)
+	// handle to much memory consumption
+	if cap(data.outBuf) > p.config.BatchSize_*p.avgEventSize {
+		data.outBuf = make([]byte, 0, p.config.BatchSize_*p.avgEventSize)
+	}
+
+	outBuf := data.outBuf[:0]
+	ends := data.ends[:0]
+	for _, event := range batch.Events {
+		outBuf = p.formatEvent(outBuf, event)
+		ends = append(ends, len(outBuf))
+	}
+	data.outBuf = outBuf
+	data.ends = ends
+
+	for {
+		if data.syslog == nil {
+			p.logger.Infof("connecting to syslog address=%s", p.config.Endpoint)
+
+			syslog, err := newClient(p.config.Network, p.config.Endpoint, p.config.ConnectionTimeout_, p.config.WriteTimeout_, p.tlsConfig)
+			if err != nil {
+				p.sendErrorMetric.WithLabelValues().Inc()
+				p.logger.Errorf("can't connect to syslog endpoint address=%s: %s", p.config.Endpoint, err.Error())
+				time.Sleep(time.Second)
+				continue
+			}
+			data.syslog = syslog
+		}
+
+		err := p.send(data.syslog, outBuf, ends)
+		if err != nil {
+			p.sendErrorMetric.WithLabelValues().Inc()
+			p.logger.Errorf("can't send data to syslog address=%s, err: %s", p.config.Endpoint, err.Error())
+			_ = data.syslog.close()
+			data.syslog = nil
+			time.Sleep(time.Second)
+			continue
+		}
+
+		break
+	}
+}
+
+// send writes the whole buffer for stream transports and a datagram per message for UDP.
+func (p *Plugin) send(c *client, outBuf []byte, ends []int) error {
+	if p.config.Network != networkUDP {
+		_, err := c.send(outBuf)
+		return err
+	}
+
+	start := 0
+	for _, end := range ends {
+		if _, err := c.send(outBuf[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+func (p *Plugin) maintenance(workerData *pipeline.WorkerData) {
+	if *workerData == nil {
+		return
+	}
+
+	data := (*workerData).(*data)
+	if data.syslog == nil {
+		return
+	}
+
+	p.logger.Infof("reconnecting worker...")
+	_ = data.syslog.close()
+	data.syslog = nil
+}
+
+// formatEvent appends framed syslog message made of the event to the buf.
+func (p *Plugin) formatEvent(buf []byte, event *pipeline.Event) []byte {
+	if p.config.Network == networkUDP || p.config.Framing == framingNonTransparent {
+		buf = p.formatMessage(buf, event.Root)
+		if p.config.Network != networkUDP {
+			buf = append(buf, '\n')
+		}
+		return buf
+	}
+
+	// octet counting: reserve space for the length, it's moved after the message is formatted.
+	start := len(buf)
+	buf = p.formatMessage(buf, event.Root)
+	msgLen := len(buf) - start
+
+	prefix := strconv.AppendInt(nil, int64(msgLen), 10)
+	prefix = append(prefix, ' ')
+	buf = append(buf, prefix...)
+	copy(buf[start+len(prefix):], buf[start:start+msgLen])
+	copy(buf[start:], prefix)
+
+	return buf
+}
+
+func (p *Plugin) formatMessage(buf []byte, root *insaneJSON.Root) []byte {
+	severity := p.severity(root)
+
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(p.facility*8+severity), 10)
+	buf = append(buf, '>')
+
+	ts := p.timestamp(root)
+	if p.config.Format == formatRFC3164 {
+		return p.formatRFC3164(buf, root, ts)
+	}
+	return p.formatRFC5424(buf, root, ts)
+}
+
+// formatRFC3164 appends `TIMESTAMP HOSTNAME TAG[PID]: MSG` part of the message.
+func (p *Plugin) formatRFC3164(buf []byte, root *insaneJSON.Root, ts time.Time) []byte {
+	buf = ts.AppendFormat(buf, time.Stamp)
+	buf = append(buf, ' ')
+	buf = appendHeaderField(buf, p.fieldOr(root, p.config.HostnameField_, p.hostname), maxHostnameLen)
+	buf = append(buf, ' ')
+	buf = appendHeaderField(buf, p.fieldOr(root, p.config.AppNameField_, p.config.AppName), maxAppNameLen)
+	if procID := p.fieldOr(root, p.config.ProcIDField_, ""); procID != "" {
+		buf = append(buf, '[')
+		buf = appendHeaderField(buf, procID, maxProcIDLen)
+		buf = append(buf, ']')
+	}
+	buf = append(buf, ':', ' ')
+
+	return p.appendMessage(buf, root)
+}
+
+// formatRFC5424 appends `VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG` part of the message.
+func (p *Plugin) formatRFC5424(buf []byte, root *insaneJSON.Root, ts time.Time) []byte {
+	buf = append(buf, '1', ' ')
+	buf = ts.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, ' ')
+	buf = appendHeaderField(buf, p.fieldOr(root, p.config.HostnameField_, p.hostname), maxHostnameLen)
+	buf = append(buf, ' ')
+	buf = appendHeaderField(buf, p.fieldOr(root, p.config.AppNameField_, p.config.AppName), maxAppNameLen)
+	buf = append(buf, ' ')
+	buf = appendHeaderField(buf, p.fieldOr(root, p.config.ProcIDField_, nilValue), maxProcIDLen)
+	buf = append(buf, ' ')
+	buf = appendHeaderField(buf, p.fieldOr(root, p.config.MsgIDField_, nilValue), maxMsgIDLen)
+	buf = append(buf, ' ')
+	buf = p.appendStructuredData(buf, root)
+	buf = append(buf, ' ')
+
+	return p.appendMessage(buf, root)
+}
+
+func (p *Plugin) appendStructuredData(buf []byte, root *insaneJSON.Root) []byte {
+	start := len(buf)
+	for i, field := range p.sdFields {
+		node := root.Dig(field...)
+		if node == nil {
+			continue
+		}
+
+		if len(buf) == start {
+			buf = append(buf, '[')
+			buf = appendSDName(buf, p.config.StructuredDataID)
+		}
+		buf = append(buf, ' ')
+		buf = appendSDName(buf, p.config.StructuredDataFields[i])
+		buf = append(buf, '=', '"')
+		buf = appendSDValue(buf, nodeValue(node))
+		buf = append(buf, '"')
+	}
+
+	if len(buf) == start {
+		return append(buf, nilValue...)
+	}
+	return append(buf, ']')
+}
+
+func (p *Plugin) appendMessage(buf []byte, root *insaneJSON.Root) []byte {
+	node := dig(root, p.config.MessageField_)
+	if node == nil {
+		return root.Encode(buf)
+	}
+	return append(buf, nodeValue(node)...)
+}
+
+func (p *Plugin) severity(root *insaneJSON.Root) int {
+	node := dig(root, p.config.SeverityField_)
+	if node == nil {
+		return int(pipeline.LevelInformational)
+	}
+
+	level := pipeline.ParseLevelAsNumber(node.AsString())
+	if level == pipeline.LevelUnknown {
+		return int(pipeline.LevelInformational)
+	}
+	return int(level)
+}
+
+func (p *Plugin) timestamp(root *insaneJSON.Root) time.Time {
+	node := dig(root, p.config.TimestampField_)
+	if node == nil {
+		return time.Now()
+	}
+
+	ts, err := time.Parse(p.timestampFieldFormat, node.AsString())
+	if err != nil {
+		return time.Now()
+	}
+	return ts
+}
+
+// fieldOr returns string value of the field or def if the field is absent or empty.
+func (p *Plugin) fieldOr(root *insaneJSON.Root, field []string, def string) string {
+	node := dig(root, field)
+	if node == nil {
+		return def
+	}
+
+	value := nodeValue(node)
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// dig returns nil for the empty field instead of the root.
+func dig(root *insaneJSON.Root, field []string) *insaneJSON.Node {
+	if len(field) == 0 {
+		return nil
+	}
+	return root.Dig(field...)
+}
+
+func nodeValue(node *insaneJSON.Node) string {
+	if node.IsString() {
+		return node.AsString()
+	}
+	return node.EncodeToString()
+}
+
+// appendHeaderField appends printable US-ASCII chars of the value, other chars are replaced with `_`.
+func appendHeaderField(buf []byte, value string, maxLen int) []byte {
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// appendSDName appends SD-NAME, chars `=`, ` `, `]`, `"` and non-printable ones are replaced with `_`.
+func appendSDName(buf []byte, name string) []byte {
+	if len(name) > maxSDNameLen {
+		name = name[:maxSDNameLen]
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// appendSDValue appends PARAM-VALUE escaping `"`, `\` and `]`.
+func appendSDValue(buf []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '"' || c == '\\' || c == ']' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
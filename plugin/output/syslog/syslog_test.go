@@ -0,0 +1,134 @@
+package syslog
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ozontech/file.d/cfg"
+	"github.com/ozontech/file.d/metric"
+	"github.com/ozontech/file.d/pipeline"
+	"github.com/ozontech/file.d/test"
+	"github.com/stretchr/testify/require"
+	insaneJSON "github.com/vitkovskii/insane-json"
+)
+
+func newPlugin(t *testing.T, configJSON string) *Plugin {
+	t.Helper()
+
+	config := &Config{}
+	require.NoError(t, json.Unmarshal([]byte(configJSON), config))
+	require.NoError(t, cfg.Parse(config, map[string]int{"gomaxprocs": 1, "capacity": 64}))
+
+	p := &Plugin{}
+	p.RegisterMetrics(metric.New("test"))
+	p.Start(config, test.NewEmptyOutputPluginParams())
+	t.Cleanup(p.Stop)
+
+	return p
+}
+
+func TestFormatEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		configJSON string
+		eventJSON  string
+		expected   string
+	}{
+		{
+			name:       "rfc5424",
+			configJSON: `{"endpoint":"localhost:514","proc_id_field":"pid","msg_id_field":"kind","sd_fields":["service","trace.id","missing"]}`,
+			eventJSON:  `{"host":"my-host","pid":42,"kind":"audit","level":"error","time":"2009-11-10T23:00:00Z","service":"chec\"kout]","trace":{"id":"1234"},"message":"some message"}`,
+			expected:   `118 <131>1 2009-11-10T23:00:00Z my-host file.d 42 audit [fields@32473 service="chec\"kout\]" trace.id="1234"] some message`,
+		},
+		{
+			name:       "rfc5424_nil_values",
+			configJSON: `{"endpoint":"localhost:514","framing":"non_transparent","facility":"user","app_name_field":"app"}`,
+			eventJSON:  `{"host":"my host","app":"my-app","time":"2009-11-10T23:00:00Z","message":"some message"}`,
+			expected:   "<14>1 2009-11-10T23:00:00Z my_host my-app - - - some message\n",
+		},
+		{
+			name:       "rfc3164",
+			configJSON: `{"endpoint":"localhost:514","network":"udp","format":"rfc3164","proc_id_field":"pid","severity_field":"severity"}`,
+			eventJSON:  `{"host":"my-host","pid":"42","severity":"warn","time":"2009-11-10T23:00:00Z","message":"some message"}`,
+			expected:   `<132>Nov 10 23:00:00 my-host file.d[42]: some message`,
+		},
+		{
+			name:       "whole_event",
+			configJSON: `{"endpoint":"localhost:514","network":"udp","format":"rfc3164","message_field":"msg"}`,
+			eventJSON:  `{"host":"my-host","time":"2009-11-10T23:00:00Z","field":"value"}`,
+			expected:   `<134>Nov 10 23:00:00 my-host file.d: {"host":"my-host","time":"2009-11-10T23:00:00Z","field":"value"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPlugin(t, tt.configJSON)
+
+			root, err := insaneJSON.DecodeString(tt.eventJSON)
+			require.NoError(t, err)
+			defer insaneJSON.Release(root)
+
+			result := p.formatEvent(nil, &pipeline.Event{Root: root})
+			require.Equal(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestSendTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	p := newPlugin(t, `{"endpoint":"`+ln.Addr().String()+`","sd_fields":["service"]}`)
+
+	root, err := insaneJSON.DecodeString(`{"host":"my-host","time":"2009-11-10T23:00:00Z","service":"checkout","message":"hello"}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(root)
+
+	var workerData pipeline.WorkerData
+	go p.out(&workerData, &pipeline.Batch{Events: []*pipeline.Event{{Root: root}, {Root: root}}})
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	msg := `<134>1 2009-11-10T23:00:00Z my-host file.d - - [fields@32473 service="checkout"] hello`
+	expected := "86 " + msg + "86 " + msg
+	buf := make([]byte, len(expected))
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, expected, string(buf))
+}
+
+func TestSendUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	p := newPlugin(t, `{"endpoint":"`+conn.LocalAddr().String()+`","network":"udp","format":"rfc3164"}`)
+
+	first, err := insaneJSON.DecodeString(`{"host":"my-host","time":"2009-11-10T23:00:00Z","message":"first"}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(first)
+	second, err := insaneJSON.DecodeString(`{"host":"my-host","time":"2009-11-10T23:00:00Z","message":"second"}`)
+	require.NoError(t, err)
+	defer insaneJSON.Release(second)
+
+	var workerData pipeline.WorkerData
+	p.out(&workerData, &pipeline.Batch{Events: []*pipeline.Event{{Root: first}, {Root: second}}})
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1024)
+	for _, expected := range []string{
+		"<134>Nov 10 23:00:00 my-host file.d: first",
+		"<134>Nov 10 23:00:00 my-host file.d: second",
+	} {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(buf[:n]))
+	}
+}
@@ -0,0 +1,44 @@
+// Package protoschema loads the protobuf message descriptors for the plugins encoding and decoding the events with protobuf.
+package protoschema
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadMessage finds the message descriptor by the full name in the file of the file descriptor set,
+// the file is made by `protoc --include_imports --descriptor_set_out`.
+func LoadMessage(path, name string) (protoreflect.MessageDescriptor, error) {
+	if path == "" || name == "" {
+		return nil, errors.New("proto descriptor set and proto message must be set")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read proto descriptor set: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return nil, fmt.Errorf("can't decode proto descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("wrong proto descriptor set: %w", err)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("can't find proto message %q: %w", name, err)
+	}
+	message, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q isn't proto message", name)
+	}
+	return message, nil
+}
@@ -0,0 +1,62 @@
+package protoschema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestLoadMessage(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("events.proto"),
+		Package: proto.String("events"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("user_id"),
+				JsonName: proto.String("userId"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+			NestedType: []*descriptorpb.DescriptorProto{{Name: proto.String("Meta")}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name:  proto.String("Level"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("INFO"), Number: proto.Int32(0)}},
+		}},
+	}}}
+	b, err := proto.Marshal(set)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.desc")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+	wrongPath := filepath.Join(dir, "wrong.desc")
+	require.NoError(t, os.WriteFile(wrongPath, []byte("wrong"), 0o600))
+
+	desc, err := LoadMessage(path, "events.Event")
+	require.NoError(t, err)
+	assert.Equal(t, "user_id", string(desc.Fields().ByNumber(1).Name()))
+
+	desc, err = LoadMessage(path, "events.Event.Meta")
+	require.NoError(t, err)
+	assert.Equal(t, "Meta", string(desc.Name()))
+
+	for _, tc := range []struct{ path, name string }{
+		{path: "", name: "events.Event"},
+		{path: path, name: ""},
+		{path: filepath.Join(dir, "missing.desc"), name: "events.Event"},
+		{path: wrongPath, name: "events.Event"},
+		{path: path, name: "events.Missing"},
+		{path: path, name: "events.Level"},
+	} {
+		_, err := LoadMessage(tc.path, tc.name)
+		assert.Error(t, err, "%s %s", tc.path, tc.name)
+	}
+}